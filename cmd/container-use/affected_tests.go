@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var affectedTestsCmd = &cobra.Command{
+	Use:   "affected-tests [<env>]",
+	Short: "List tests likely affected by an environment's changes",
+	Long: `Compute the test packages and files most likely affected by an environment's diff.
+Go packages are resolved along with the in-module packages importing them. JavaScript
+and Python test files are matched against the changed sources by naming convention.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Show affected tests for an environment
+container-use affected-tests fancy-mallard
+
+# Output as JSON for scripting
+container-use affected-tests fancy-mallard --json`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		affected, err := repo.AffectedTests(ctx, envID)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(affected)
+		}
+
+		if len(affected.Targets) == 0 {
+			fmt.Println("No affected tests found.")
+			return nil
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "LANGUAGE\tPATH\tREASON")
+		for _, target := range affected.Targets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", target.Language, target.Path, target.Reason)
+		}
+		tw.Flush()
+
+		languages := make([]string, 0, len(affected.Commands))
+		for language := range affected.Commands {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+
+		fmt.Println()
+		fmt.Println("Suggested commands:")
+		for _, language := range languages {
+			fmt.Printf("  %s\n", affected.Commands[language])
+		}
+		return nil
+	},
+}
+
+func init() {
+	affectedTestsCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(affectedTestsCmd, &repository.AffectedTests{})
+	rootCmd.AddCommand(affectedTestsCmd)
+}
@@ -3,13 +3,16 @@ package main
 import (
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
 )
 
 var (
-	applyDelete bool
+	applyDelete  bool
+	applyCommits []string
+	applyPicks   []string
 )
 
 var applyCmd = &cobra.Command{
@@ -21,6 +24,10 @@ for you to commit manually, discarding the original commit sequence. This lets y
 review and customize the final commit before making the agent's work permanent.
 Your working directory will be automatically stashed and restored.
 
+With --commits or --pick, only the selected commits are cherry-picked onto your
+branch instead, keeping their messages and authors. Use it when only part of the
+environment's work is wanted. Ranges follow git's syntax: a..b excludes a.
+
 If no environment is specified, automatically selects from environments 
 that are descendants of the current HEAD.`,
 	Args:              cobra.MaximumNArgs(1),
@@ -36,6 +43,10 @@ cu apply --delete backend-api
 git status
 git commit -m "Add backend API implementation"
 
+# Cherry-pick only some of the agent's commits
+cu apply backend-api --commits 1a2b3c4..5d6e7f8
+cu apply backend-api --pick 1a2b3c4 --pick 9f8e7d6
+
 # Auto-select environment
 cu apply`,
 	RunE: func(app *cobra.Command, args []string) error {
@@ -52,7 +63,11 @@ cu apply`,
 			return err
 		}
 
-		if err := repo.Apply(ctx, envID, os.Stdout); err != nil {
+		if revisions := slices.Concat(applyCommits, applyPicks); len(revisions) > 0 {
+			if err := repo.ApplyCommits(ctx, envID, revisions, os.Stdout); err != nil {
+				return fmt.Errorf("failed to apply commits: %w", err)
+			}
+		} else if err := repo.Apply(ctx, envID, os.Stdout); err != nil {
 			return fmt.Errorf("failed to apply environment: %w", err)
 		}
 
@@ -62,6 +77,8 @@ cu apply`,
 
 func init() {
 	applyCmd.Flags().BoolVarP(&applyDelete, "delete", "d", false, "Delete the environment after successful application")
+	applyCmd.Flags().StringArrayVar(&applyCommits, "commits", nil, "Cherry-pick a range of the environment's commits (<sha1>..<sha2>)")
+	applyCmd.Flags().StringArrayVar(&applyPicks, "pick", nil, "Cherry-pick a single commit of the environment")
 
 	rootCmd.AddCommand(applyCmd)
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var approveRequestCmd = &cobra.Command{
+	Use:   "approve-request [<id>]",
+	Short: "Approve or deny a destructive operation requested by an agent",
+	Long: `Approve or deny a destructive operation an agent is waiting to perform.
+
+When the MCP server runs with --require-approval, destructive tools (such as changing
+an environment's configuration or deleting files) wait until they're approved here.
+Commands an agent runs that fail on a prompt for input (e.g. a license agreement or
+an MFA code) also wait here for your answer, given with --answer.
+Without an ID, lists the pending requests.`,
+	Args: cobra.MaximumNArgs(1),
+	Example: `# List pending requests
+container-use approve-request
+
+# Approve a request
+container-use approve-request 3fa92c
+
+# Deny a request
+container-use approve-request 3fa92c --deny
+
+# Answer a command's prompt
+container-use approve-request 7b01de --answer yes`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		if len(args) == 0 {
+			return printApprovalRequests(repo)
+		}
+
+		id := args[0]
+		deny, _ := app.Flags().GetBool("deny")
+		answer, _ := app.Flags().GetString("answer")
+		answered := app.Flags().Changed("answer")
+		if deny && answered {
+			return fmt.Errorf("cannot use --answer with --deny")
+		}
+
+		req, err := repo.GetApproval(id)
+		if err != nil {
+			return err
+		}
+		if answered {
+			if err := repo.AnswerApproval(id, answer); err != nil {
+				return err
+			}
+			fmt.Printf("Answered %s on %s.\n", req.Operation, req.EnvironmentID)
+			return nil
+		}
+		if err := repo.ResolveApproval(id, !deny); err != nil {
+			return err
+		}
+
+		if deny {
+			fmt.Printf("Denied %s on %s.\n", req.Operation, req.EnvironmentID)
+		} else {
+			fmt.Printf("Approved %s on %s.\n", req.Operation, req.EnvironmentID)
+		}
+		return nil
+	},
+}
+
+func printApprovalRequests(repo *repository.Repository) error {
+	requests, err := repo.ListApprovals()
+	if err != nil {
+		return fmt.Errorf("failed to list approval requests: %w", err)
+	}
+	if len(requests) == 0 {
+		fmt.Println("No pending approval requests")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "ID\tOPERATION\tENVIRONMENT\tREQUESTED\tDETAILS")
+	for _, req := range requests {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s ago\t%s\n",
+			req.ID, req.Operation, req.EnvironmentID, time.Since(req.CreatedAt).Round(time.Second), req.Summary)
+	}
+	return nil
+}
+
+func init() {
+	approveRequestCmd.Flags().Bool("deny", false, "Deny the request instead of approving it")
+	approveRequestCmd.Flags().String("answer", "", "Answer a request for input, such as a command's prompt")
+	rootCmd.AddCommand(approveRequestCmd)
+}
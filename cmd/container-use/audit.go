@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the tool calls of MCP clients and the permission decisions",
+	Long: `Show the audit log of the tool calls MCP clients made in this repository, and whether
+the server's permissions allowed them.
+
+Calls are recorded when the MCP server runs with permission flags, such as
+'container-use stdio --deny delete'.`,
+	Args: cobra.NoArgs,
+	Example: `# Show the audit log
+container-use audit
+
+# Show the denied calls of a client
+container-use audit --denied --client cursor`,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		records, err := repo.AuditLog()
+		if err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		deniedOnly, _ := app.Flags().GetBool("denied")
+		client, _ := app.Flags().GetString("client")
+		filtered := []*repository.AuditRecord{}
+		for _, record := range records {
+			if (deniedOnly && record.Allowed) || (client != "" && record.Client != client) {
+				continue
+			}
+			filtered = append(filtered, record)
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(filtered)
+		}
+
+		if len(filtered) == 0 {
+			fmt.Println("No audit records")
+			return nil
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		defer tw.Flush()
+
+		fmt.Fprintln(tw, "TIME\tCLIENT\tTOOL\tENVIRONMENT\tDECISION")
+		for _, record := range filtered {
+			decision := "allowed"
+			if !record.Allowed {
+				decision = "denied"
+			}
+			environmentID := orDash(record.EnvironmentID)
+			if record.Hardened {
+				environmentID += " (hardened)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				record.Time.Local().Format(time.DateTime), record.Client, record.Tool, environmentID, decision)
+		}
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.Flags().Bool("denied", false, "Only show denied calls")
+	auditCmd.Flags().String("client", "", "Only show the calls of the given client")
+	auditCmd.Flags().Bool("json", false, "Output records as JSON")
+	withSchema(auditCmd, []*repository.AuditRecord{})
+
+	rootCmd.AddCommand(auditCmd)
+}
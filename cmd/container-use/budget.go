@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var budgetCmd = &cobra.Command{
+	Use:   "budget [<env>]",
+	Short: "Show an environment's change budget",
+	Long: `Show how much an environment changed relative to its change budget.
+
+Configure budgets with 'container-use config change-budget set'. Environments over budget
+are flagged in 'container-use list', and with a blocking budget the agent can't run
+commands in them until you review the changes and acknowledge them with 'budget ack'.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		status, err := repo.ChangeBudget(envID)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("Environment '%s' has no change budget.\n", envID)
+			return nil
+		}
+		fmt.Printf("%s\n", status)
+		if status.AcknowledgedFiles > 0 || status.AcknowledgedLines > 0 {
+			fmt.Printf("Acknowledged: %d files and %d lines\n", status.AcknowledgedFiles, status.AcknowledgedLines)
+		}
+		if status.Exceeded {
+			fmt.Printf("⚠ Over budget. Review with 'container-use diff %s', then run 'container-use budget ack %s'.\n", envID, envID)
+		}
+		return nil
+	},
+}
+
+var budgetAckCmd = &cobra.Command{
+	Use:               "ack [<env>]",
+	Short:             "Acknowledge an environment's changes",
+	Long:              `Acknowledge the changes an environment made so far, unblocking it. The budget then applies to further changes.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		status, err := repo.AcknowledgeChangeBudget(envID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Acknowledged %d files and %d lines changed in '%s'.\n", status.Files, status.Lines, envID)
+		return nil
+	},
+}
+
+func init() {
+	budgetCmd.AddCommand(budgetAckCmd)
+	rootCmd.AddCommand(budgetCmd)
+}
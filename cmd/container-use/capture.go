@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var captureCmd = &cobra.Command{
+	Use:   "capture <env> <path>",
+	Short: "Save and open an image or HTML file of an environment",
+	Long: `Save an image or HTML file of an environment, such as a screenshot taken by a
+browser test or a rendered page, on the host and open it with the default viewer.
+
+Supports PNG, JPEG, GIF, WebP, SVG and HTML files. Relative paths are relative to
+the environment's workdir. Without --output, the file is saved in a temporary directory.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Look at the screenshot an agent took
+container-use capture fancy-mallard screenshots/home.png
+
+# Save a rendered page without opening it
+container-use capture fancy-mallard dist/index.html -o index.html --no-open`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, args[0])
+		if err != nil {
+			return err
+		}
+
+		env, err := repo.Get(ctx, dag, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load environment: %w", err)
+		}
+
+		capture, err := env.Capture(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		output, _ := app.Flags().GetString("output")
+		if output == "" {
+			dir, err := os.MkdirTemp("", "container-use-capture-")
+			if err != nil {
+				return err
+			}
+			output = filepath.Join(dir, filepath.Base(capture.Path))
+		}
+		if err := os.WriteFile(output, capture.Data, 0644); err != nil {
+			return fmt.Errorf("failed to save capture: %w", err)
+		}
+		fmt.Printf("Saved %s to %s\n", capture.Path, output)
+
+		if noOpen, _ := app.Flags().GetBool("no-open"); noOpen {
+			return nil
+		}
+		return openFile(output)
+	},
+}
+
+// openFile opens a file with the host's default application.
+func openFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return cmd.Process.Release()
+}
+
+func init() {
+	captureCmd.Flags().StringP("output", "o", "", "Path to save the file to (default: a temporary file)")
+	captureCmd.Flags().Bool("no-open", false, "Don't open the file")
+
+	rootCmd.AddCommand(captureCmd)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check <env> [<path>...]",
+	Short: "Run fast syntax and type checks in an environment",
+	Long: `Run fast syntax and type checks on an environment's files and report diagnostics.
+The checker is picked from each file's language: gopls check for Go (gofmt when gopls
+isn't installed), tsc --noEmit for TypeScript and py_compile for Python.
+
+Without paths, the files changed by the environment are checked. Directories select
+the changed files they contain.`,
+	Args: cobra.MinimumNArgs(1),
+	Example: `# Check the files changed by an environment
+container-use check fancy-mallard
+
+# Check a single file and output diagnostics as JSON
+container-use check fancy-mallard cmd/server/main.go --json`,
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		jsonOutput, _ := app.Flags().GetBool("json")
+		noWait, _ := app.Flags().GetBool("no-wait")
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args[:1])
+		if err != nil {
+			return err
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+
+		slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+		if err != nil {
+			return err
+		}
+		defer slot.Release()
+
+		env, err := repo.Get(ctx, dag, envID)
+		if err != nil {
+			return fmt.Errorf("failed to load environment: %w", err)
+		}
+
+		report, err := repo.Check(ctx, env, args[1:])
+		if err != nil {
+			return fmt.Errorf("failed to check files: %w", err)
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		} else {
+			printCheckReport(report)
+		}
+
+		if !report.Passed() {
+			return fmt.Errorf("checks failed")
+		}
+		return nil
+	},
+}
+
+func printCheckReport(report *repository.CheckReport) {
+	if len(report.Commands) == 0 {
+		fmt.Println("No files to check.")
+		return
+	}
+
+	for _, diagnostic := range report.Diagnostics {
+		location := diagnostic.File
+		if diagnostic.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, diagnostic.Line)
+		}
+		if diagnostic.Column > 0 {
+			location = fmt.Sprintf("%s:%d", location, diagnostic.Column)
+		}
+		fmt.Printf("%s: %s: %s\n", location, diagnostic.Severity, diagnostic.Message)
+	}
+	for _, command := range report.Commands {
+		if command.Output != "" {
+			fmt.Printf("%s check exited with code %d:\n%s\n", command.Language, command.ExitCode, command.Output)
+		}
+	}
+
+	if report.Passed() {
+		fmt.Printf("✓ %d files checked, no problems found.\n", len(report.Files))
+	} else {
+		fmt.Printf("✗ %d files checked, problems found: %d.\n", len(report.Files), len(report.Diagnostics))
+	}
+}
+
+func init() {
+	checkCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(checkCmd, &repository.CheckReport{})
+	checkCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if another exec is running in the environment")
+
+	rootCmd.AddCommand(checkCmd)
+}
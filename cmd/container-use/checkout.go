@@ -50,7 +50,11 @@ container-use checkout`,
 			return err
 		}
 
-		fmt.Printf("Switched to branch '%s'\n", branch)
+		if repo.VCS().Name() == "jj" {
+			fmt.Printf("Switched to a new change on bookmark '%s'\n", branch)
+		} else {
+			fmt.Printf("Switched to branch '%s'\n", branch)
+		}
 		return nil
 	},
 }
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+// ciOutputLimit is the number of trailing characters of a command's output included in reports.
+const ciOutputLimit = 4000
+
+type ciCommandResult struct {
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	Passed     int    `json:"tests_passed"`
+	Failed     int    `json:"tests_failed"`
+	Skipped    int    `json:"tests_skipped"`
+}
+
+type ciReport struct {
+	Environment  string             `json:"environment"`
+	Commit       string             `json:"commit,omitempty"`
+	ConfigSource string             `json:"config_source"`
+	Commands     []*ciCommandResult `json:"commands"`
+}
+
+func (r *ciReport) success() bool {
+	for _, cmd := range r.Commands {
+		if cmd.ExitCode != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ciReport) summary() string {
+	failed := 0
+	for _, cmd := range r.Commands {
+		if cmd.ExitCode != 0 {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return fmt.Sprintf("%d of %d commands passed", len(r.Commands), len(r.Commands))
+	}
+	return fmt.Sprintf("%d of %d commands failed", failed, len(r.Commands))
+}
+
+// markdown renders the report for pull request comments and job summaries.
+func (r *ciReport) markdown() string {
+	var b strings.Builder
+
+	icon := "✅"
+	if !r.success() {
+		icon = "❌"
+	}
+	fmt.Fprintf(&b, "### %s container-use: `%s`\n\n", icon, r.Environment)
+	fmt.Fprintf(&b, "%s", r.summary())
+	if r.Commit != "" {
+		short := r.Commit
+		if len(short) > 7 {
+			short = short[:7]
+		}
+		fmt.Fprintf(&b, " on %s", short)
+	}
+	fmt.Fprintf(&b, " (configuration from %s).\n\n", r.ConfigSource)
+
+	b.WriteString("| Command | Result | Tests | Duration |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, cmd := range r.Commands {
+		result := "passed"
+		if cmd.ExitCode != 0 {
+			result = fmt.Sprintf("failed (exit %d)", cmd.ExitCode)
+		}
+		tests := "-"
+		if cmd.Passed+cmd.Failed+cmd.Skipped > 0 {
+			tests = fmt.Sprintf("%d passed, %d failed, %d skipped", cmd.Passed, cmd.Failed, cmd.Skipped)
+		}
+		duration := (time.Duration(cmd.DurationMs) * time.Millisecond).Round(time.Second)
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", strings.ReplaceAll(cmd.Command, "|", `\|`), result, tests, duration)
+	}
+
+	for _, cmd := range r.Commands {
+		if cmd.ExitCode == 0 {
+			continue
+		}
+		output := strings.TrimSpace(cmd.Stdout + "\n" + cmd.Stderr)
+		if len(output) > ciOutputLimit {
+			output = "..." + output[len(output)-ciOutputLimit:]
+		}
+		fmt.Fprintf(&b, "\n<details><summary>Output of <code>%s</code></summary>\n\n```\n%s\n```\n\n</details>\n", cmd.Command, output)
+	}
+	return b.String()
+}
+
+var ciCmd = &cobra.Command{
+	Use:   "ci",
+	Short: "Validate an environment branch in CI",
+	Long: `Recreate an environment from a pushed container-use branch and run validation
+commands in it, for use in CI systems such as GitHub Actions.
+
+Run it from a checkout of the environment's branch. The environment is configured
+from the state container-use pushes along with the branch when it's available
+(fetch it with "git fetch origin refs/notes/*:refs/notes/*"), or else from the
+configuration committed in the repository. When environments are tracked in a
+metadata repository, the state is fetched from it: pass it with --metadata-repo.
+
+Every command runs, even after a failure, and the command exits with an error if any
+of them failed. In GitHub Actions, the results are added to the job summary and, with
+--comment and --status, posted to the pull request and the commit (this requires
+GITHUB_TOKEN with pull-requests: write and statuses: write permissions).`,
+	Args: cobra.NoArgs,
+	Example: `# Run the tests of the checked out environment
+container-use ci --command "go test -v ./..."
+
+# In a pull request workflow, also comment on the pull request and set a commit status
+container-use ci --command "go vet ./..." --command "go test -v ./..." --comment --status`,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+
+		commands, _ := app.Flags().GetStringArray("command")
+		envID, _ := app.Flags().GetString("env")
+		shell, _ := app.Flags().GetString("shell")
+		comment, _ := app.Flags().GetBool("comment")
+		status, _ := app.Flags().GetBool("status")
+		jsonOutput, _ := app.Flags().GetBool("json")
+
+		if len(commands) == 0 {
+			return fmt.Errorf("at least one --command is required")
+		}
+
+		gh, err := githubActionsFromEnv()
+		if err != nil {
+			return err
+		}
+		if envID == "" {
+			envID = gh.environmentID()
+		}
+		if envID == "" {
+			envID = "ci"
+		}
+
+		remote := "origin"
+		if metadataRepo, _ := app.Flags().GetString("metadata-repo"); metadataRepo != "" {
+			remote = metadataRepo
+		} else if metadataRepo := repository.MetadataRepo(ctx, "."); metadataRepo != "" {
+			remote = metadataRepo
+		}
+		config, source, err := repository.CheckoutConfigFrom(ctx, ".", remote, gh.SHA, "HEAD")
+		if err != nil {
+			return err
+		}
+		slog.Info("loaded environment configuration", "env_id", envID, "source", source)
+
+		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+		if err != nil {
+			slog.Error("Error starting dagger", "error", err)
+
+			if isDockerDaemonError(err) {
+				handleDockerDaemonError()
+			}
+
+			return fmt.Errorf("failed to connect to dagger: %w", err)
+		}
+		defer dag.Close()
+
+		env, err := environment.New(ctx, environment.NewEnvArgs{
+			Dag:              dag,
+			ID:               envID,
+			Title:            "CI validation of " + envID,
+			Config:           config,
+			InitialSourceDir: dag.Host().Directory(".", dagger.HostDirectoryOpts{Exclude: []string{".git", "**/.git"}}),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create environment: %w", err)
+		}
+
+		report := &ciReport{Environment: envID, Commit: gh.SHA, ConfigSource: source}
+		for _, command := range commands {
+			slog.Info("running command", "env_id", envID, "command", command)
+			fmt.Fprintf(os.Stderr, "$ %s\n", command)
+
+			startedAt := time.Now()
+			stdout, stderr, exitCode, err := env.RunWithExitCode(ctx, command, shell, false)
+			if err != nil {
+				return fmt.Errorf("failed to run %q: %w", command, err)
+			}
+			run := &repository.TestRun{Results: repository.ParseTestOutput(stdout + "\n" + stderr)}
+			report.Commands = append(report.Commands, &ciCommandResult{
+				Command:    command,
+				ExitCode:   exitCode,
+				DurationMs: time.Since(startedAt).Milliseconds(),
+				Stdout:     stdout,
+				Stderr:     stderr,
+				Passed:     run.Count(repository.TestPassed),
+				Failed:     run.Count(repository.TestFailed),
+				Skipped:    run.Count(repository.TestSkipped),
+			})
+			if !jsonOutput {
+				fmt.Print(stdout)
+				fmt.Fprint(os.Stderr, stderr)
+			}
+		}
+
+		markdown := report.markdown()
+		if summaryPath := os.Getenv("GITHUB_STEP_SUMMARY"); summaryPath != "" {
+			if err := appendFile(summaryPath, markdown+"\n"); err != nil {
+				slog.Warn("failed to write job summary", "error", err)
+			}
+		}
+		if comment {
+			if gh.PullNumber == 0 {
+				fmt.Fprintln(os.Stderr, "Not a pull request build, skipping the pull request comment.")
+			} else if err := gh.upsertComment(ctx, markdown); err != nil {
+				return fmt.Errorf("failed to comment on pull request: %w", err)
+			}
+		}
+		if status {
+			if err := gh.setStatus(ctx, report.success(), report.summary()); err != nil {
+				return fmt.Errorf("failed to set commit status: %w", err)
+			}
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		} else {
+			fmt.Printf("\n%s\n", report.summary())
+		}
+
+		if !report.success() {
+			return fmt.Errorf("validation failed: %s", report.summary())
+		}
+		return nil
+	},
+}
+
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(content)
+	return err
+}
+
+func init() {
+	ciCmd.Flags().StringArray("command", nil, "Command to run in the environment (repeatable)")
+	ciCmd.Flags().String("env", "", "Environment ID (defaults to the ID in the container-use branch being built)")
+	ciCmd.Flags().String("shell", "sh", "Shell to run commands with")
+	ciCmd.Flags().Bool("comment", false, "Post the results as a pull request comment (GitHub Actions)")
+	ciCmd.Flags().Bool("status", false, "Set a commit status with the results (GitHub Actions)")
+	ciCmd.Flags().Bool("json", false, "Output the results as JSON")
+	withSchema(ciCmd, &ciReport{})
+	ciCmd.Flags().String("metadata-repo", "", "Metadata repository to fetch the environment's state from (default: origin)")
+
+	rootCmd.AddCommand(ciCmd)
+}
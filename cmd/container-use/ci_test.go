@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIReportMarkdown(t *testing.T) {
+	report := &ciReport{
+		Environment:  "fancy-mallard",
+		Commit:       "0123456789abcdef",
+		ConfigSource: "repository configuration",
+		Commands: []*ciCommandResult{
+			{Command: "go vet ./...", DurationMs: 1500},
+			{Command: "go test -v ./...", ExitCode: 1, Passed: 3, Failed: 1, Stdout: "--- FAIL: TestFoo"},
+		},
+	}
+
+	assert.False(t, report.success())
+	assert.Equal(t, "1 of 2 commands failed", report.summary())
+
+	markdown := report.markdown()
+	assert.Contains(t, markdown, "### ❌ container-use: `fancy-mallard`")
+	assert.Contains(t, markdown, "1 of 2 commands failed on 0123456 (configuration from repository configuration).")
+	assert.Contains(t, markdown, "| `go vet ./...` | passed | - | 2s |")
+	assert.Contains(t, markdown, "| `go test -v ./...` | failed (exit 1) | 3 passed, 1 failed, 0 skipped |")
+	assert.Contains(t, markdown, "--- FAIL: TestFoo")
+	assert.NotContains(t, markdown, "Output of <code>go vet")
+}
+
+func TestGitHubActions(t *testing.T) {
+	event := filepath.Join(t.TempDir(), "event.json")
+	require.NoError(t, os.WriteFile(event, []byte(`{"pull_request": {"number": 7, "head": {"sha": "abc123"}}}`), 0644))
+
+	var requests []string
+	var bodies []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"id": 1, "body": "LGTM"},
+				{"id": 2, "body": ciCommentMarker + "\nprevious results"},
+			})
+			return
+		}
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	t.Setenv("GITHUB_API_URL", server.URL)
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+	t.Setenv("GITHUB_SHA", "merge-commit")
+	t.Setenv("GITHUB_HEAD_REF", "container-use/fancy-mallard")
+	t.Setenv("GITHUB_EVENT_PATH", event)
+
+	gh, err := githubActionsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "fancy-mallard", gh.environmentID())
+	assert.Equal(t, 7, gh.PullNumber)
+	assert.Equal(t, "abc123", gh.SHA, "pull requests report on the head commit, not the merge commit")
+
+	ctx := context.Background()
+	require.NoError(t, gh.upsertComment(ctx, "new results"))
+	require.NoError(t, gh.setStatus(ctx, true, "2 of 2 commands passed"))
+
+	assert.Equal(t, []string{
+		"GET /repos/owner/repo/issues/7/comments",
+		"PATCH /repos/owner/repo/issues/comments/2",
+		"POST /repos/owner/repo/statuses/abc123",
+	}, requests)
+	assert.True(t, strings.HasSuffix(bodies[0]["body"].(string), "\nnew results"))
+	assert.Equal(t, "success", bodies[1]["state"])
+	assert.Equal(t, "container-use/ci", bodies[1]["context"])
+}
+
+func TestGithubRepositoryFromURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"git@github.com:dagger/container-use.git":       "dagger/container-use",
+		"https://github.com/dagger/container-use":       "dagger/container-use",
+		"https://github.com/dagger/container-use.git/":  "dagger/container-use",
+		"ssh://git@github.com/dagger/container-use.git": "dagger/container-use",
+		"https://gitlab.com/dagger/container-use.git":   "",
+		"https://github.com/dagger":                     "",
+		"/tmp/remote.git":                               "",
+	} {
+		assert.Equal(t, expected, githubRepositoryFromURL(url), url)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var cloneCmd = &cobra.Command{
+	Use:     "clone [<env>]",
+	Aliases: []string{"fork"},
+	Short:   "Create a new environment from an existing environment's current state",
+	Long: `Create a new environment from an existing environment, to branch an experiment
+off its current state without disturbing it. The new environment starts from the
+tip of the environment's branch, with its configuration and its container: files
+and packages outside the workdir, such as installed tools, come along, and no
+setup command runs again.
+
+The new environment is titled "Clone of <env>: <title>" and keeps the labels of
+the environment unless --title and --label are given. Both environments then
+evolve independently.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Try another approach without losing the current one
+container-use clone fancy-mallard --title "Try the iterative parser"
+
+# Clone with a chosen ID
+container-use clone fancy-mallard --id fancy-mallard-v2`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		// The clone starts from the environment's container, cached on the engine hosting it.
+		if engine := pool.EngineFor(ctx, repo, envID); engine != nil {
+			ctx = repository.WithEngine(ctx, engine.Name)
+		}
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+
+		if labels, _ := app.Flags().GetStringSlice("label"); len(labels) > 0 {
+			ctx = repository.WithLabels(ctx, labels)
+		}
+		title, _ := app.Flags().GetString("title")
+		requestedID, _ := app.Flags().GetString("id")
+		env, err := repo.Clone(ctx, dag, envID, requestedID, title)
+		if err != nil {
+			return fmt.Errorf("failed to clone %s: %w", envID, err)
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			out, err := json.MarshalIndent(&cloneResult{
+				ID:              env.ID,
+				ClonedFrom:      envID,
+				Title:           env.State.Title,
+				Labels:          env.State.Labels,
+				CheckoutCommand: fmt.Sprintf("container-use checkout %s", env.ID),
+			}, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+
+		fmt.Printf("Environment cloned from %s: %s\n", envID, env.ID)
+		fmt.Printf("  Title: %s\n", env.State.Title)
+		if len(env.State.Labels) > 0 {
+			fmt.Printf("  Labels: %s\n", strings.Join(env.State.Labels, ", "))
+		}
+		fmt.Println()
+		fmt.Println("Next steps:")
+		fmt.Printf("  View changes:    container-use diff %s\n", env.ID)
+		fmt.Printf("  Checkout branch: container-use checkout %s\n", env.ID)
+		return nil
+	},
+}
+
+// cloneResult is the JSON output of clone.
+type cloneResult struct {
+	ID              string   `json:"id"`
+	ClonedFrom      string   `json:"cloned_from"`
+	Title           string   `json:"title"`
+	Labels          []string `json:"labels"`
+	CheckoutCommand string   `json:"checkout_command"`
+}
+
+func init() {
+	cloneCmd.Flags().String("title", "", "Title of the new environment (default: \"Clone of <env>: <title>\")")
+	cloneCmd.Flags().String("id", "", "ID of the new environment (default: generated following the naming configuration)")
+	cloneCmd.Flags().StringSlice("label", nil, "Label the new environment instead of keeping the environment's labels (repeatable)")
+	cloneCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(cloneCmd, &cloneResult{})
+	rootCmd.AddCommand(cloneCmd)
+}
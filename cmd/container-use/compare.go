@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <env> <env> [<env>...]",
+	Short: "Compare environments addressing the same task side by side",
+	Long: `Compare environments side by side, e.g. the attempts of several agents at the
+same task, to pick the best one: their configuration (base image and toolchains),
+the size of their changes, their latest test results and the time spent on them.
+
+In the table, * marks the best value of the rows where one is better: the
+fewest failing tests, the highest coverage and the shortest active time. The
+configuration settings that differ between the environments are listed below it.
+Tests are those recorded by 'container-use test'. With --json, the summaries are
+the ones of 'container-use export --json'.`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Compare the attempts of two agents
+container-use compare fancy-mallard backend-api
+
+# Compare three environments as JSON
+container-use compare fancy-mallard backend-api quiet-otter --json`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		comparison, err := repo.Compare(ctx, args...)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.SetEscapeHTML(false)
+			return enc.Encode(comparison)
+		}
+		for _, env := range comparison.Environments {
+			for _, failure := range env.Errors {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", env.ID, failure)
+			}
+		}
+		if !comparison.SameBase {
+			fmt.Fprintln(os.Stderr, "Warning: the environments don't have the same base, so their changes and tests don't compare directly")
+		}
+		printComparison(os.Stdout, comparison)
+		return nil
+	},
+}
+
+// comparisonRow is a row of the comparison table: a value for each environment, and a score telling the
+// best one if scored.
+type comparisonRow struct {
+	label string
+	value func(env *repository.EnvironmentExport) string
+	// score returns the score of the environment's value, if it has one. The lowest score is the best.
+	score func(env *repository.EnvironmentExport) (float64, bool)
+}
+
+var comparisonRows = []comparisonRow{
+	{label: "Title", value: func(env *repository.EnvironmentExport) string { return env.Title }},
+	{label: "Agent", value: func(env *repository.EnvironmentExport) string { return env.Agent }},
+	{label: "Base image", value: func(env *repository.EnvironmentExport) string {
+		if env.Config == nil {
+			return ""
+		}
+		return env.Config.BaseImage
+	}},
+	{label: "Toolchains", value: func(env *repository.EnvironmentExport) string {
+		if env.Config == nil {
+			return ""
+		}
+		features := make([]string, 0, len(env.Config.Features))
+		for _, feature := range env.Config.Features {
+			features = append(features, describeFeature(feature))
+		}
+		return strings.Join(features, ", ")
+	}},
+	{label: "Base", value: func(env *repository.EnvironmentExport) string {
+		short := env.Base
+		if len(short) > 7 {
+			short = short[:7]
+		}
+		return short
+	}},
+	{label: "Commits", value: func(env *repository.EnvironmentExport) string { return fmt.Sprint(len(env.Commits)) }},
+	{label: "Files changed", value: func(env *repository.EnvironmentExport) string {
+		if env.DiffStat == nil {
+			return ""
+		}
+		return fmt.Sprint(env.DiffStat.FilesChanged)
+	}},
+	{label: "Lines", value: func(env *repository.EnvironmentExport) string {
+		if env.DiffStat == nil {
+			return ""
+		}
+		return fmt.Sprintf("+%d -%d", env.DiffStat.Insertions, env.DiffStat.Deletions)
+	}},
+	{
+		label: "Tests",
+		value: func(env *repository.EnvironmentExport) string {
+			if env.Tests == nil {
+				return ""
+			}
+			return fmt.Sprintf("%d passed, %d failed, %d skipped", env.Tests.Passed, env.Tests.Failed, env.Tests.Skipped)
+		},
+		score: func(env *repository.EnvironmentExport) (float64, bool) {
+			if env.Tests == nil {
+				return 0, false
+			}
+			return float64(env.Tests.Failed), true
+		},
+	},
+	{
+		label: "Coverage",
+		value: func(env *repository.EnvironmentExport) string {
+			if env.Tests == nil || env.Tests.Coverage == nil {
+				return ""
+			}
+			return fmt.Sprintf("%.1f%%", *env.Tests.Coverage)
+		},
+		score: func(env *repository.EnvironmentExport) (float64, bool) {
+			if env.Tests == nil || env.Tests.Coverage == nil {
+				return 0, false
+			}
+			return -*env.Tests.Coverage, true
+		},
+	},
+	{label: "Test command", value: func(env *repository.EnvironmentExport) string {
+		if env.Tests == nil {
+			return ""
+		}
+		return env.Tests.Command
+	}},
+	{label: "Wall clock", value: func(env *repository.EnvironmentExport) string {
+		if env.Time == nil {
+			return ""
+		}
+		return formatMS(env.Time.WallClockMS)
+	}},
+	{
+		label: "Active",
+		value: func(env *repository.EnvironmentExport) string {
+			if env.Time == nil {
+				return ""
+			}
+			return formatMS(env.Time.ActiveMS)
+		},
+		score: func(env *repository.EnvironmentExport) (float64, bool) {
+			if env.Time == nil {
+				return 0, false
+			}
+			return float64(env.Time.ActiveMS), true
+		},
+	},
+	{label: "Commands", value: func(env *repository.EnvironmentExport) string {
+		if env.Time == nil {
+			return ""
+		}
+		return formatMS(env.Time.ExecMS)
+	}},
+}
+
+func printComparison(w io.Writer, comparison *repository.Comparison) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	header := []string{""}
+	for _, env := range comparison.Environments {
+		header = append(header, env.ID)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range comparisonRows {
+		cells := []string{row.label}
+		best := bestEnvironments(comparison.Environments, row.score)
+		for i, env := range comparison.Environments {
+			cell := orDash(row.value(env))
+			if best[i] {
+				cell += " *"
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	if len(comparison.ConfigDifferences) == 0 {
+		fmt.Fprintln(w, "Configurations: identical")
+	} else {
+		fmt.Fprintf(w, "Configurations differ in: %s\n", strings.Join(comparison.ConfigDifferences, ", "))
+	}
+}
+
+// bestEnvironments tells which environments have the lowest score. None is best unless every environment is
+// scored and the scores differ.
+func bestEnvironments(envs []*repository.EnvironmentExport, score func(env *repository.EnvironmentExport) (float64, bool)) []bool {
+	best := make([]bool, len(envs))
+	if score == nil {
+		return best
+	}
+	scores := make([]float64, len(envs))
+	for i, env := range envs {
+		s, ok := score(env)
+		if !ok {
+			return best
+		}
+		scores[i] = s
+	}
+	lowest, highest := scores[0], scores[0]
+	for _, s := range scores {
+		lowest, highest = min(lowest, s), max(highest, s)
+	}
+	if lowest == highest {
+		return best
+	}
+	for i, s := range scores {
+		best[i] = s == lowest
+	}
+	return best
+}
+
+func init() {
+	compareCmd.Flags().Bool("json", false, "Output the comparison as JSON")
+	withSchema(compareCmd, &repository.Comparison{})
+	rootCmd.AddCommand(compareCmd)
+}
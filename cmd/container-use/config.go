@@ -1,14 +1,26 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
+	"dagger.io/dagger"
 	"github.com/dagger/container-use/cmd/container-use/agent"
 	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 )
 
@@ -44,6 +56,7 @@ func updateConfig(cmd *cobra.Command, fn func(*environment.EnvironmentConfig) er
 	if err := fn(config); err != nil {
 		return err
 	}
+	config.CommandInputs.Prune(config.SetupCommands, config.InstallCommands)
 
 	if err := config.Save(repo.SourcePath()); err != nil {
 		return fmt.Errorf("failed to save configuration: %w", err)
@@ -61,6 +74,7 @@ These settings are stored in .container-use/environment.json and apply to all ne
 
 func init() {
 	configShowCmd.Flags().Bool("json", false, "Dump the configuration in JSON")
+	withSchema(configShowCmd, &environment.EnvironmentConfig{})
 }
 
 var configShowCmd = &cobra.Command{
@@ -111,13 +125,31 @@ container-use config show my-env
 		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 		defer tw.Flush()
 
-		fmt.Fprintf(tw, "Base Image:\t%s\n", config.BaseImage)
+		if len(args) == 0 {
+			upstream, err := environment.LoadUpstream(repo.SourcePath())
+			if err != nil {
+				return fmt.Errorf("failed to load upstream configuration: %w", err)
+			}
+			if upstream != nil {
+				fmt.Fprintf(tw, "Upstream:\t%s (%s)\n", upstream, upstream.Revision)
+			}
+		}
+		fmt.Fprintf(tw, "Base Image:\t%s\n", config.BaseImageDescription())
 		fmt.Fprintf(tw, "Workdir:\t%s\n", config.Workdir)
 
+		if len(config.Features) > 0 {
+			fmt.Fprintf(tw, "Features:\t\n")
+			for i, feature := range config.Features {
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, describeFeature(feature))
+			}
+		} else {
+			fmt.Fprintf(tw, "Features:\t(none)\n")
+		}
+
 		if len(config.SetupCommands) > 0 {
 			fmt.Fprintf(tw, "Setup Commands:\t\n")
 			for i, cmd := range config.SetupCommands {
-				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, cmd)
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, describeCommand(config, cmd))
 			}
 		} else {
 			fmt.Fprintf(tw, "Setup Commands:\t(none)\n")
@@ -126,12 +158,39 @@ container-use config show my-env
 		if len(config.InstallCommands) > 0 {
 			fmt.Fprintf(tw, "Install Commands:\t\n")
 			for i, cmd := range config.InstallCommands {
-				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, cmd)
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, describeCommand(config, cmd))
 			}
 		} else {
 			fmt.Fprintf(tw, "Install Commands:\t(none)\n")
 		}
 
+		if len(config.Tasks) > 0 {
+			fmt.Fprintf(tw, "Tasks:\t\n")
+			for i, task := range config.Tasks {
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, describeTask(task))
+			}
+		} else {
+			fmt.Fprintf(tw, "Tasks:\t(none)\n")
+		}
+
+		if len(config.Services) > 0 {
+			fmt.Fprintf(tw, "Services:\t\n")
+			for i, service := range config.Services {
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, describeService(service))
+			}
+		} else {
+			fmt.Fprintf(tw, "Services:\t(none)\n")
+		}
+
+		if len(config.SnapshotPaths) > 0 {
+			fmt.Fprintf(tw, "Snapshot Paths:\t\n")
+			for i, snapshotPath := range config.SnapshotPaths {
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, snapshotPath)
+			}
+		} else {
+			fmt.Fprintf(tw, "Snapshot Paths:\t(none)\n")
+		}
+
 		envKeys := config.Env.Keys()
 		if len(envKeys) > 0 {
 			fmt.Fprintf(tw, "Environment Variables:\t\n")
@@ -154,6 +213,126 @@ container-use config show my-env
 			fmt.Fprintf(tw, "Secrets:\t(none)\n")
 		}
 
+		if len(config.DNSServers) > 0 || len(config.DNSSearch) > 0 {
+			fmt.Fprintf(tw, "DNS:\t%s\n", describeDNS(config))
+		} else {
+			fmt.Fprintf(tw, "DNS:\t(default)\n")
+		}
+
+		hostNames := config.Hosts.Keys()
+		if len(hostNames) > 0 {
+			fmt.Fprintf(tw, "Hosts:\t\n")
+			for i, host := range hostNames {
+				fmt.Fprintf(tw, "  %d.\t%s %s\n", i+1, config.Hosts.Get(host), host)
+			}
+		} else {
+			fmt.Fprintf(tw, "Hosts:\t(none)\n")
+		}
+
+		if len(config.HostFiles) > 0 {
+			fmt.Fprintf(tw, "Host Files:\t\n")
+			for i, file := range config.HostFiles {
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, file)
+			}
+		} else {
+			fmt.Fprintf(tw, "Host Files:\t(none)\n")
+		}
+
+		if config.Naming != nil {
+			fmt.Fprintf(tw, "Naming:\t%s\n", describeNaming(config.Naming))
+		} else {
+			fmt.Fprintf(tw, "Naming:\t(default)\n")
+		}
+
+		if config.CommitMessage != nil {
+			fmt.Fprintf(tw, "Commit Messages:\t%s\n", describeCommitMessage(config.CommitMessage))
+		} else {
+			fmt.Fprintf(tw, "Commit Messages:\t(default)\n")
+		}
+
+		if config.ChangeBudget != nil {
+			fmt.Fprintf(tw, "Change Budget:\t%s\n", describeChangeBudget(config.ChangeBudget))
+		} else {
+			fmt.Fprintf(tw, "Change Budget:\t(none)\n")
+		}
+
+		if config.ResourceGuard != nil {
+			fmt.Fprintf(tw, "Resource Guard:\t%s\n", describeResourceGuard(config.ResourceGuard))
+		} else {
+			fmt.Fprintf(tw, "Resource Guard:\t%s (default)\n", describeResourceGuard(environment.DefaultResourceGuard()))
+		}
+		if config.Retry != nil {
+			fmt.Fprintf(tw, "Retries:\t%s\n", describeRetry(config.Retry))
+		} else {
+			fmt.Fprintf(tw, "Retries:\t%s (default)\n", describeRetry(environment.DefaultRetry()))
+		}
+
+		if config.CommandTimeout != nil {
+			fmt.Fprintf(tw, "Command Timeout:\t%s\n", describeCommandTimeout(config.CommandTimeout))
+		} else {
+			fmt.Fprintf(tw, "Command Timeout:\t(none)\n")
+		}
+
+		if !config.Quota.IsZero() {
+			fmt.Fprintf(tw, "Quotas:\t%s\n", describeQuota(config.Quota))
+		} else {
+			fmt.Fprintf(tw, "Quotas:\t(none)\n")
+		}
+
+		if !config.Resources.IsZero() {
+			fmt.Fprintf(tw, "Resource Limits:\t%s\n", describeResourceLimits(config.Resources))
+		} else {
+			fmt.Fprintf(tw, "Resource Limits:\t(none)\n")
+		}
+
+		if config.Docker != nil {
+			fmt.Fprintf(tw, "Docker:\t%s\n", config.Docker)
+		} else {
+			fmt.Fprintf(tw, "Docker:\t(disabled)\n")
+		}
+
+		if config.DockerCredentials {
+			fmt.Fprintf(tw, "Docker Credentials:\thost\n")
+		} else {
+			fmt.Fprintf(tw, "Docker Credentials:\t(none)\n")
+		}
+
+		if config.Hardened {
+			fmt.Fprintf(tw, "Hardened:\tyes\n")
+		} else {
+			fmt.Fprintf(tw, "Hardened:\tno\n")
+		}
+
+		if config.AutoInstall {
+			fmt.Fprintf(tw, "Auto Install:\tyes\n")
+		} else {
+			fmt.Fprintf(tw, "Auto Install:\tno\n")
+		}
+
+		if config.Suggester != "" {
+			fmt.Fprintf(tw, "Suggester:\t%s\n", config.Suggester)
+		} else {
+			fmt.Fprintf(tw, "Suggester:\t(none)\n")
+		}
+
+		if config.CoverageCommand != "" {
+			fmt.Fprintf(tw, "Coverage Command:\t%s\n", config.CoverageCommand)
+		} else {
+			fmt.Fprintf(tw, "Coverage Command:\t(none)\n")
+		}
+
+		if config.GitIdentity != nil {
+			fmt.Fprintf(tw, "Git Identity:\t%s\n", config.GitIdentity)
+		} else {
+			fmt.Fprintf(tw, "Git Identity:\t(user's git identity)\n")
+		}
+
+		if config.Clone.IsPartial() {
+			fmt.Fprintf(tw, "Clone:\t%s\n", describeClone(config.Clone))
+		} else {
+			fmt.Fprintf(tw, "Clone:\t(full history)\n")
+		}
+
 		return nil
 	},
 }
@@ -194,11 +373,152 @@ container-use config import my-env`,
 	},
 }
 
+var configSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync shared configuration from an upstream source",
+	Long: `Fetch a shared configuration, such as an organization's default base image, setup
+commands and policies, from a git repository or an OCI image, and layer this repository's
+configuration on it: settings in .container-use/environment.json override the upstream
+settings key by key, the others follow the upstream configuration.
+
+The source is recorded in .container-use/upstream.json and the fetched configuration in
+.container-use/upstream-environment.json: commit both so everyone uses the same settings,
+and run sync again to pick up upstream changes. Sources are git URLs, read at --ref and
+--path (default environment.json), or OCI images prefixed with oci://, read at --path
+(default /environment.json).`,
+	Example: `# Sync from the platform team's repository
+container-use config sync --source https://github.com/acme/container-use-config.git
+
+# Sync from a branch and a path in the repository
+container-use config sync --source git@github.com:acme/platform.git --ref stable --path container-use/go.json
+
+# Sync from an OCI image
+container-use config sync --source oci://ghcr.io/acme/container-use-config:latest
+
+# Pick up upstream changes
+container-use config sync
+
+# Preview upstream changes
+container-use config sync --dry-run
+
+# Stop syncing, keeping the current settings
+container-use config sync --unlink`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		upstream, err := environment.LoadUpstream(repo.SourcePath())
+		if err != nil {
+			return fmt.Errorf("failed to load upstream configuration: %w", err)
+		}
+
+		if unlink, _ := cmd.Flags().GetBool("unlink"); unlink {
+			if upstream == nil {
+				return fmt.Errorf("the configuration isn't synced from an upstream source")
+			}
+			// Keep the upstream settings in the repository's configuration.
+			config := environment.DefaultConfig()
+			if err := config.Load(repo.SourcePath()); err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+			if err := environment.RemoveUpstream(repo.SourcePath()); err != nil {
+				return fmt.Errorf("failed to remove upstream configuration: %w", err)
+			}
+			if err := config.Save(repo.SourcePath()); err != nil {
+				return fmt.Errorf("failed to save configuration: %w", err)
+			}
+			fmt.Printf("Stopped syncing configuration from %s\n", upstream)
+			return nil
+		}
+
+		if source, _ := cmd.Flags().GetString("source"); source != "" {
+			upstream = &environment.UpstreamConfig{Source: source}
+		} else if upstream == nil {
+			return fmt.Errorf("the configuration isn't synced from an upstream source: use --source")
+		}
+		if cmd.Flags().Changed("ref") {
+			upstream.Ref, _ = cmd.Flags().GetString("ref")
+		}
+		if cmd.Flags().Changed("path") {
+			upstream.Path, _ = cmd.Flags().GetString("path")
+		}
+
+		var dag *dagger.Client
+		if upstream.IsOCI() {
+			dag, err = dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+			if err != nil {
+				if isDockerDaemonError(err) {
+					handleDockerDaemonError()
+				}
+				return fmt.Errorf("failed to connect to dagger: %w", err)
+			}
+			defer dag.Close()
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		result, err := repo.SyncUpstreamConfig(ctx, dag, upstream, dryRun)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(result)
+		}
+
+		printUpstreamSync(result, dryRun)
+		return nil
+	},
+}
+
+func printUpstreamSync(result *repository.UpstreamSync, dryRun bool) {
+	verb := "Synced"
+	if dryRun {
+		verb = "Would sync"
+	}
+	fmt.Printf("%s configuration from %s (%s)\n", verb, result.Source, result.Revision)
+	if len(result.Changes) == 0 {
+		fmt.Println("No upstream changes.")
+		return
+	}
+
+	overridden := false
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, change := range result.Changes {
+		var values string
+		switch change.Change {
+		case environment.SettingAdded:
+			values = string(change.New)
+		case environment.SettingRemoved:
+			values = string(change.Old)
+		default:
+			values = fmt.Sprintf("%s -> %s", change.Old, change.New)
+		}
+		if change.Overridden {
+			values += " (overridden)"
+			overridden = true
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", change.Change, change.Key, values)
+	}
+	tw.Flush()
+
+	if overridden {
+		fmt.Println("Overridden settings are set in .container-use/environment.json: remove them there to follow upstream.")
+	}
+}
+
 // Base image object commands
 var configBaseImageCmd = &cobra.Command{
 	Use:   "base-image",
 	Short: "Manage base container image",
-	Long:  `Manage the base container image for new environments.`,
+	Long: `Manage the base container image for new environments: a public image, or a
+build of a Containerfile of the repository, e.g. your team's dev image.`,
 }
 
 var configBaseImageSetCmd = &cobra.Command{
@@ -210,6 +530,7 @@ var configBaseImageSetCmd = &cobra.Command{
 		baseImage := args[0]
 		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
 			config.BaseImage = baseImage
+			config.BaseBuild = nil
 			fmt.Printf("Base image set to: %s\n", baseImage)
 			return nil
 		})
@@ -222,7 +543,7 @@ var configBaseImageGetCmd = &cobra.Command{
 	Long:  `Display the current base container image.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
-			fmt.Println(config.BaseImage)
+			fmt.Println(config.BaseImageDescription())
 			return nil
 		})
 	},
@@ -236,12 +557,60 @@ var configBaseImageResetCmd = &cobra.Command{
 		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
 			defaultConfig := environment.DefaultConfig()
 			config.BaseImage = defaultConfig.BaseImage
+			config.BaseBuild = nil
 			fmt.Printf("Base image reset to default: %s\n", defaultConfig.BaseImage)
 			return nil
 		})
 	},
 }
 
+var configBaseImageBuildCmd = &cobra.Command{
+	Use:   "build <containerfile>",
+	Short: "Build the base image from a Containerfile",
+	Long: `Build the base image of new environments from a Containerfile (or Dockerfile) of the
+repository, instead of pulling an image. Paths are relative to the repository root,
+and the Containerfile must be in the build context.
+
+Environments build the Containerfile of the commit they're created from. After
+editing it, roll it out to existing environments with 'container-use rebuild-base'.`,
+	Example: `# Use the team's dev image
+container-use config base-image build .devcontainer/Containerfile
+
+# Build the dev stage, with a build argument
+container-use config base-image build docker/Dockerfile --context docker --target dev --build-arg GO_VERSION=1.24`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildContext, _ := cmd.Flags().GetString("context")
+		target, _ := cmd.Flags().GetString("target")
+		buildArgs, _ := cmd.Flags().GetStringArray("build-arg")
+		build := &environment.BaseBuildConfig{
+			Containerfile: args[0],
+			Context:       buildContext,
+			Target:        target,
+		}
+		for _, arg := range buildArgs {
+			key, value, _ := strings.Cut(arg, "=")
+			build.BuildArgs.Set(key, value)
+		}
+		if err := build.Validate(); err != nil {
+			return err
+		}
+		repo, err := repository.Open(cmd.Context(), ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		if _, err := os.Stat(filepath.Join(repo.SourcePath(), build.Containerfile)); err != nil {
+			return fmt.Errorf("containerfile not found: %w", err)
+		}
+
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.BaseBuild = build
+			fmt.Printf("Base image set to: %s\n", build)
+			return nil
+		})
+	},
+}
+
 // Setup command object commands
 var configSetupCommandCmd = &cobra.Command{
 	Use:   "setup-command",
@@ -252,13 +621,19 @@ var configSetupCommandCmd = &cobra.Command{
 var configSetupCommandAddCmd = &cobra.Command{
 	Use:   "add <command>",
 	Short: "Add a setup command",
-	Long:  `Add a command to be run when creating new environments (e.g., "apt update && apt install -y python3").`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Add a command to be run when creating new environments (e.g., "apt update && apt install -y python3").
+
+Setup commands run before the source is copied. With --inputs, the given source files are copied
+for the command (e.g., requirements.txt for "pip install -r requirements.txt"): the command is only
+rerun when they change.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		command := args[0]
+		inputs, _ := cmd.Flags().GetStringSlice("inputs")
 		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
 			config.SetupCommands = append(config.SetupCommands, command)
-			fmt.Printf("Setup command added: %s\n", command)
+			config.CommandInputs.Set(command, inputs)
+			fmt.Printf("Setup command added: %s\n", describeCommand(config, command))
 			return nil
 		})
 	},
@@ -305,7 +680,7 @@ var configSetupCommandListCmd = &cobra.Command{
 			}
 
 			for i, command := range config.SetupCommands {
-				fmt.Printf("%d. %s\n", i+1, command)
+				fmt.Printf("%d. %s\n", i+1, describeCommand(config, command))
 			}
 			return nil
 		})
@@ -325,6 +700,220 @@ var configSetupCommandClearCmd = &cobra.Command{
 	},
 }
 
+// Snapshot path commands
+var configSnapshotPathCmd = &cobra.Command{
+	Use:   "snapshot-path",
+	Short: "Manage snapshot paths",
+	Long: `Manage the container paths outside the workdir whose changes are reported after each
+command, such as database data directories or tool caches. Their changes don't show up
+in the environment's diff: they're listed in the environment's log and by
+'container-use diff --state' instead.
+
+Every file under the snapshot paths is checksummed after each command, so prefer
+paths holding state you want to review over large caches.`,
+}
+
+var configSnapshotPathAddCmd = &cobra.Command{
+	Use:   "add <path>",
+	Short: "Add a snapshot path",
+	Long:  `Report the changes commands make under a container path. Relative paths are relative to the workdir.`,
+	Example: `# Review what the agent's commands did to the database
+container-use config snapshot-path add /var/lib/postgresql/data`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshotPath := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if slices.Contains(config.SnapshotPaths, snapshotPath) {
+				return fmt.Errorf("snapshot path already configured: %s", snapshotPath)
+			}
+			config.SnapshotPaths = append(config.SnapshotPaths, snapshotPath)
+			fmt.Printf("Snapshot path added: %s\n", snapshotPath)
+			return nil
+		})
+	},
+}
+
+var configSnapshotPathRemoveCmd = &cobra.Command{
+	Use:   "remove <path>",
+	Short: "Remove a snapshot path",
+	Long:  `Stop reporting the changes under a container path.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshotPath := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			i := slices.Index(config.SnapshotPaths, snapshotPath)
+			if i < 0 {
+				return fmt.Errorf("snapshot path not found: %s", snapshotPath)
+			}
+			config.SnapshotPaths = slices.Delete(config.SnapshotPaths, i, i+1)
+			fmt.Printf("Snapshot path removed: %s\n", snapshotPath)
+			return nil
+		})
+	},
+}
+
+var configSnapshotPathListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all snapshot paths",
+	Long:  `List the container paths whose changes are reported after each command.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.SnapshotPaths) == 0 {
+				fmt.Println("No snapshot paths configured")
+				return nil
+			}
+			for i, snapshotPath := range config.SnapshotPaths {
+				fmt.Printf("%d. %s\n", i+1, snapshotPath)
+			}
+			return nil
+		})
+	},
+}
+
+var configSnapshotPathClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all snapshot paths",
+	Long:  `Stop reporting the changes under every snapshot path.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.SnapshotPaths = nil
+			fmt.Println("All snapshot paths cleared")
+			return nil
+		})
+	},
+}
+
+// describeCommand returns a setup or install command with its inputs, if any.
+func describeCommand(config *environment.EnvironmentConfig, command string) string {
+	if inputs := config.CommandInputs[command]; len(inputs) > 0 {
+		return fmt.Sprintf("%s (inputs: %s)", command, strings.Join(inputs, ", "))
+	}
+	return command
+}
+
+// Feature object commands
+var configFeatureCmd = &cobra.Command{
+	Use:   "feature",
+	Short: "Manage dev container features",
+	Long: `Manage dev container features installed into new environments.
+Features are OCI-packaged installers (see https://containers.dev/features), such as
+ghcr.io/devcontainers/features/node:1. They are installed in order, before the setup commands.`,
+}
+
+var configFeatureAddCmd = &cobra.Command{
+	Use:   "add <ref>",
+	Short: "Add a feature",
+	Long:  `Add a dev container feature to install in new environments, optionally with options.`,
+	Example: `# Install Node.js 20
+container-use config feature add ghcr.io/devcontainers/features/node:1 --option version=20
+
+# Install the docker CLI and daemon
+container-use config feature add ghcr.io/devcontainers/features/docker-in-docker:2`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ref := args[0]
+		rawOptions, _ := cmd.Flags().GetStringSlice("option")
+
+		options := map[string]string{}
+		for _, raw := range rawOptions {
+			key, value, ok := strings.Cut(raw, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("invalid option %q: expected KEY=VALUE", raw)
+			}
+			options[key] = value
+		}
+
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			feature := &environment.FeatureConfig{Ref: ref}
+			if len(options) > 0 {
+				feature.Options = options
+			}
+			if existing := config.Features.Get(ref); existing != nil {
+				*existing = *feature
+				fmt.Printf("Feature updated: %s\n", describeFeature(feature))
+				return nil
+			}
+			config.Features = append(config.Features, feature)
+			fmt.Printf("Feature added: %s\n", describeFeature(feature))
+			return nil
+		})
+	},
+}
+
+var configFeatureRemoveCmd = &cobra.Command{
+	Use:   "remove <ref>",
+	Short: "Remove a feature",
+	Long:  `Remove a dev container feature from the environment configuration.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ref := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			newFeatures := make(environment.FeatureConfigs, 0, len(config.Features))
+			for _, feature := range config.Features {
+				if feature.Ref != ref {
+					newFeatures = append(newFeatures, feature)
+				}
+			}
+
+			if len(newFeatures) == len(config.Features) {
+				return fmt.Errorf("feature not found: %s", ref)
+			}
+
+			config.Features = newFeatures
+			fmt.Printf("Feature removed: %s\n", ref)
+			return nil
+		})
+	},
+}
+
+var configFeatureListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all features",
+	Long:  `List all dev container features that will be installed in environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.Features) == 0 {
+				fmt.Println("No features configured")
+				return nil
+			}
+
+			for i, feature := range config.Features {
+				fmt.Printf("%d. %s\n", i+1, describeFeature(feature))
+			}
+			return nil
+		})
+	},
+}
+
+var configFeatureClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all features",
+	Long:  `Remove all dev container features from the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Features = environment.FeatureConfigs{}
+			fmt.Println("All features cleared")
+			return nil
+		})
+	},
+}
+
+func describeFeature(feature *environment.FeatureConfig) string {
+	if len(feature.Options) == 0 {
+		return feature.Ref
+	}
+	keys := make([]string, 0, len(feature.Options))
+	for key := range feature.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	options := make([]string, len(keys))
+	for i, key := range keys {
+		options[i] = key + "=" + feature.Options[key]
+	}
+	return fmt.Sprintf("%s (%s)", feature.Ref, strings.Join(options, ", "))
+}
+
 // Install command object commands
 var configInstallCommandCmd = &cobra.Command{
 	Use:   "install-command",
@@ -335,13 +924,19 @@ var configInstallCommandCmd = &cobra.Command{
 var configInstallCommandAddCmd = &cobra.Command{
 	Use:   "add <command>",
 	Short: "Add an install command",
-	Long:  `Add a command to be run after copying code to new environments (e.g., "go mod download").`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Add a command to be run after copying code to new environments (e.g., "go mod download").
+
+With --inputs, the command only depends on the given source files (e.g., go.mod and go.sum):
+leading install commands with inputs run before the rest of the source is copied, so they're
+only rerun when their inputs change.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		command := args[0]
+		inputs, _ := cmd.Flags().GetStringSlice("inputs")
 		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
 			config.InstallCommands = append(config.InstallCommands, command)
-			fmt.Printf("Install command added: %s\n", command)
+			config.CommandInputs.Set(command, inputs)
+			fmt.Printf("Install command added: %s\n", describeCommand(config, command))
 			return nil
 		})
 	},
@@ -388,7 +983,7 @@ var configInstallCommandListCmd = &cobra.Command{
 			}
 
 			for i, command := range config.InstallCommands {
-				fmt.Printf("%d. %s\n", i+1, command)
+				fmt.Printf("%d. %s\n", i+1, describeCommand(config, command))
 			}
 			return nil
 		})
@@ -556,17 +1151,2289 @@ var configSecretClearCmd = &cobra.Command{
 	},
 }
 
-func init() {
-	// Add base-image commands
-	configBaseImageCmd.AddCommand(configBaseImageSetCmd)
-	configBaseImageCmd.AddCommand(configBaseImageGetCmd)
-	configBaseImageCmd.AddCommand(configBaseImageResetCmd)
+// DNS object commands
+var configDNSCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Manage DNS servers and search domains",
+	Long: `Manage custom DNS servers and search domains for environment containers.
+Useful for resolving internal service names behind split-horizon corporate DNS.`,
+}
 
-	// Add setup-command commands
-	configSetupCommandCmd.AddCommand(configSetupCommandAddCmd)
-	configSetupCommandCmd.AddCommand(configSetupCommandRemoveCmd)
-	configSetupCommandCmd.AddCommand(configSetupCommandListCmd)
-	configSetupCommandCmd.AddCommand(configSetupCommandClearCmd)
+var configDNSSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set DNS servers and search domains",
+	Long:  `Replace the DNS servers and/or search domains used by new environments.`,
+	Example: `# Use an internal resolver and search domain
+container-use config dns set --server 10.0.0.53 --search corp.example.com`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		servers, _ := cmd.Flags().GetStringSlice("server")
+		search, _ := cmd.Flags().GetStringSlice("search")
+		if !cmd.Flags().Changed("server") && !cmd.Flags().Changed("search") {
+			return fmt.Errorf("at least one of --server or --search is required")
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if cmd.Flags().Changed("server") {
+				config.DNSServers = servers
+			}
+			if cmd.Flags().Changed("search") {
+				config.DNSSearch = search
+			}
+			if err := config.ValidateNetwork(); err != nil {
+				return err
+			}
+			fmt.Printf("DNS set: %s\n", describeDNS(config))
+			return nil
+		})
+	},
+}
+
+var configDNSGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the current DNS settings",
+	Long:  `Display the DNS servers and search domains used by new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.DNSServers) == 0 && len(config.DNSSearch) == 0 {
+				fmt.Println("No DNS overrides configured")
+				return nil
+			}
+			fmt.Println(describeDNS(config))
+			return nil
+		})
+	},
+}
+
+var configDNSClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear DNS overrides",
+	Long:  `Remove custom DNS servers and search domains so environments use the default resolver.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.DNSServers = nil
+			config.DNSSearch = nil
+			fmt.Println("DNS overrides cleared")
+			return nil
+		})
+	},
+}
+
+func describeDNS(config *environment.EnvironmentConfig) string {
+	parts := []string{}
+	if len(config.DNSServers) > 0 {
+		parts = append(parts, "servers="+strings.Join(config.DNSServers, ","))
+	}
+	if len(config.DNSSearch) > 0 {
+		parts = append(parts, "search="+strings.Join(config.DNSSearch, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Host entry object commands
+var configHostCmd = &cobra.Command{
+	Use:   "host",
+	Short: "Manage /etc/hosts entries",
+	Long:  `Manage host entries that are added to /etc/hosts in environment containers.`,
+}
+
+var configHostSetCmd = &cobra.Command{
+	Use:   "set <hostname> <ip>",
+	Short: "Set a host entry",
+	Long:  `Map a host name to an IP address in new environments (e.g., "db.internal" "10.1.2.3").`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		host := args[0]
+		ip := args[1]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Hosts.Set(host, ip)
+			if err := config.ValidateNetwork(); err != nil {
+				return err
+			}
+			fmt.Printf("Host entry set: %s %s\n", ip, host)
+			return nil
+		})
+	},
+}
+
+var configHostUnsetCmd = &cobra.Command{
+	Use:   "unset <hostname>",
+	Short: "Unset a host entry",
+	Long:  `Remove a host entry from the environment configuration.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		host := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if !config.Hosts.Unset(host) {
+				return fmt.Errorf("host entry not found: %s", host)
+			}
+			fmt.Printf("Host entry unset: %s\n", host)
+			return nil
+		})
+	},
+}
+
+var configHostListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all host entries",
+	Long:  `List all host entries that will be added to environment containers.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			hosts := config.Hosts.Keys()
+			if len(hosts) == 0 {
+				fmt.Println("No host entries configured")
+				return nil
+			}
+
+			for i, host := range hosts {
+				fmt.Printf("%d. %s %s\n", i+1, config.Hosts.Get(host), host)
+			}
+			return nil
+		})
+	},
+}
+
+var configHostClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all host entries",
+	Long:  `Remove all host entries from the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Hosts.Clear()
+			fmt.Println("All host entries cleared")
+			return nil
+		})
+	},
+}
+
+// Host file object commands
+var configHostFileCmd = &cobra.Command{
+	Use:   "host-file",
+	Short: "Manage host files provided to environments",
+	Long: `Manage files of the host, such as ~/.netrc, ~/.npmrc or a kube config, that are
+copied or mounted into new environments so agents have working credentials and
+tool configuration.`,
+}
+
+var configHostFileAddCmd = &cobra.Command{
+	Use:   "add <source>",
+	Short: "Provide a host file to new environments",
+	Long: `Provide a host file to new environments. A leading ~/ refers to your home
+directory on the host, and to /root in the environment unless --target is set.
+
+In the copy mode, the file is copied into the environment after replacing the
+matches of --redact patterns with REDACTED (only the groups of patterns that have
+some). In the secret mode, the file is mounted read-only, kept out of the
+environment's container state and scrubbed from command output.
+
+With --prompt, you're asked whether to provide the file every time an environment
+is created: on the terminal for 'container-use create', and through
+'container-use approve-request' for agents. Files added without --prompt are trusted
+to be provided without asking; files configured by someone else are asked about the
+same way until you trust them with 'container-use config trust'.`,
+	Example: `# Give environments your npm credentials
+container-use config host-file add ~/.npmrc
+
+# Provide git credentials without their passwords
+container-use config host-file add ~/.netrc --redact 'password (\S+)'
+
+# Mount a kube config, asking before each environment gets it
+container-use config host-file add ~/.kube/config --mode secret --prompt`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, _ := cmd.Flags().GetString("target")
+		mode, _ := cmd.Flags().GetString("mode")
+		redact, _ := cmd.Flags().GetStringArray("redact")
+		prompt, _ := cmd.Flags().GetBool("prompt")
+		file := &environment.HostFile{
+			Source: args[0],
+			Target: target,
+			Mode:   mode,
+			Redact: redact,
+			Prompt: prompt,
+		}
+		if err := file.Validate(); err != nil {
+			return err
+		}
+
+		if err := updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if existing := config.HostFiles.Find(file.Source); existing != nil {
+				*existing = *file
+			} else {
+				config.HostFiles = append(config.HostFiles, file)
+			}
+			fmt.Printf("Host file added: %s\n", file)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if file.Prompt {
+			return nil
+		}
+		return trustConfigValue(cmd, repository.TrustHostFile, repository.HostFileTrustValue(file))
+	},
+}
+
+var configHostFileRemoveCmd = &cobra.Command{
+	Use:   "remove <source>",
+	Short: "Stop providing a host file",
+	Long:  `Stop providing a host file to new environments.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			file := config.HostFiles.Find(args[0])
+			if file == nil {
+				return fmt.Errorf("host file not found: %s", args[0])
+			}
+			config.HostFiles = slices.DeleteFunc(config.HostFiles, func(f *environment.HostFile) bool {
+				return f == file
+			})
+			fmt.Printf("Host file removed: %s\n", file.Source)
+			return nil
+		})
+	},
+}
+
+var configHostFileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List host files",
+	Long:  `List the host files provided to new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.HostFiles) == 0 {
+				fmt.Println("No host files configured")
+				return nil
+			}
+
+			for i, file := range config.HostFiles {
+				fmt.Printf("%d. %s\n", i+1, file)
+			}
+			return nil
+		})
+	},
+}
+
+var configHostFileClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all host files",
+	Long:  `Stop providing any host file to new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.HostFiles = nil
+			fmt.Println("All host files cleared")
+			return nil
+		})
+	},
+}
+
+// Naming object commands
+var configNamingCmd = &cobra.Command{
+	Use:   "naming",
+	Short: "Manage environment ID generation",
+	Long: `Manage how IDs are generated for new environments.
+IDs default to random adjective-animal names. A prefix, a custom word list, sequential
+numbers or a template can be configured instead. Generated IDs never reuse an existing one.`,
+}
+
+var configNamingSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the environment ID generator",
+	Long: `Set how IDs are generated for new environments.
+
+Styles:
+  petname     random adjective-animal names (default)
+  words       random words from --words
+  sequential  zero-padded increasing numbers, e.g. 0001
+
+A template overrides the style and may reference {name} (a name generated with the
+style), {seq} (a zero-padded sequence number), {date} (YYYYMMDD) and {rand} (random hex).`,
+	Example: `# Prefix IDs with the team name
+container-use config naming set --prefix team-a-
+
+# Sortable sequential IDs: team-a-0001, team-a-0002, ...
+container-use config naming set --prefix team-a- --style sequential
+
+# Custom template
+container-use config naming set --template "{date}-{seq}"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Naming == nil {
+				config.Naming = &environment.NamingConfig{}
+			}
+			naming := config.Naming
+			if cmd.Flags().Changed("prefix") {
+				naming.Prefix, _ = cmd.Flags().GetString("prefix")
+			}
+			if cmd.Flags().Changed("style") {
+				naming.Style, _ = cmd.Flags().GetString("style")
+			}
+			if cmd.Flags().Changed("words") {
+				naming.Words, _ = cmd.Flags().GetStringSlice("words")
+			}
+			if cmd.Flags().Changed("length") {
+				naming.Length, _ = cmd.Flags().GetInt("length")
+			}
+			if cmd.Flags().Changed("template") {
+				naming.Template, _ = cmd.Flags().GetString("template")
+			}
+
+			switch naming.Style {
+			case "", environment.NamingStylePetname, environment.NamingStyleSequential:
+			case environment.NamingStyleWords:
+				if len(naming.Words) == 0 {
+					return fmt.Errorf("the words style requires --words")
+				}
+			default:
+				return fmt.Errorf("unknown naming style %q", naming.Style)
+			}
+
+			fmt.Printf("Naming set: %s\n", describeNaming(naming))
+			return nil
+		})
+	},
+}
+
+var configNamingGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the environment ID generator",
+	Long:  `Display how IDs are generated for new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Naming == nil {
+				fmt.Println("default (petname)")
+				return nil
+			}
+			fmt.Println(describeNaming(config.Naming))
+			return nil
+		})
+	},
+}
+
+var configNamingResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the environment ID generator to default",
+	Long:  `Reset environment ID generation to random adjective-animal names.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Naming = nil
+			fmt.Println("Naming reset to default")
+			return nil
+		})
+	},
+}
+
+func describeNaming(naming *environment.NamingConfig) string {
+	parts := []string{}
+	if naming.Prefix != "" {
+		parts = append(parts, fmt.Sprintf("prefix=%q", naming.Prefix))
+	}
+	if naming.Template != "" {
+		parts = append(parts, fmt.Sprintf("template=%q", naming.Template))
+	}
+	style := naming.Style
+	if style == "" {
+		style = environment.NamingStylePetname
+	}
+	parts = append(parts, "style="+style)
+	if len(naming.Words) > 0 {
+		parts = append(parts, fmt.Sprintf("words=%d", len(naming.Words)))
+	}
+	if naming.Length > 0 {
+		parts = append(parts, fmt.Sprintf("length=%d", naming.Length))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Commit message object commands
+var configCommitMessageCmd = &cobra.Command{
+	Use:   "commit-message",
+	Short: "Manage generated commit messages",
+	Long: `Manage how messages are generated for commits recording environment changes.
+By default, messages describe the changed files and the commands that changed them.`,
+}
+
+var configCommitMessageSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the commit message generator",
+	Long: `Set how messages are generated for commits recording environment changes.
+
+Styles:
+  detailed     a subject plus the commands run and files changed (default)
+  subject      the subject line only
+  explanation  the agent's explanation only, without generated details
+
+A hook is a host command that receives the staged diff on stdin and prints the message
+to use, e.g. a script calling an LLM. It also receives CONTAINER_USE_EXPLANATION,
+CONTAINER_USE_COMMANDS and CONTAINER_USE_MESSAGE (the generated message). If the hook
+fails or prints nothing, the generated message is used.`,
+	Example: `# Only keep the subject line
+container-use config commit-message set --style subject
+
+# Generate messages with a script
+container-use config commit-message set --hook ./scripts/commit-message.sh`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var hook string
+		if err := updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.CommitMessage == nil {
+				config.CommitMessage = &environment.CommitMessageConfig{}
+			}
+			msg := config.CommitMessage
+			if cmd.Flags().Changed("style") {
+				msg.Style, _ = cmd.Flags().GetString("style")
+			}
+			if cmd.Flags().Changed("max-files") {
+				msg.MaxFiles, _ = cmd.Flags().GetInt("max-files")
+			}
+			if cmd.Flags().Changed("hook") {
+				msg.Hook, _ = cmd.Flags().GetString("hook")
+			}
+
+			switch msg.Style {
+			case "", environment.CommitMessageDetailed, environment.CommitMessageSubject, environment.CommitMessageExplanation:
+			default:
+				return fmt.Errorf("unknown commit message style %q", msg.Style)
+			}
+
+			fmt.Printf("Commit message set: %s\n", describeCommitMessage(msg))
+			hook = msg.Hook
+			return nil
+		}); err != nil {
+			return err
+		}
+		if !cmd.Flags().Changed("hook") {
+			return nil
+		}
+		return trustConfigValue(cmd, repository.TrustCommitHook, hook)
+	},
+}
+
+var configCommitMessageGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the commit message generator",
+	Long:  `Display how messages are generated for commits recording environment changes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.CommitMessage == nil {
+				fmt.Println("default (detailed)")
+				return nil
+			}
+			fmt.Println(describeCommitMessage(config.CommitMessage))
+			return nil
+		})
+	},
+}
+
+var configCommitMessageResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the commit message generator to default",
+	Long:  `Reset commit messages to detailed generated messages without a hook.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CommitMessage = nil
+			fmt.Println("Commit message reset to default")
+			return nil
+		})
+	},
+}
+
+func describeCommitMessage(msg *environment.CommitMessageConfig) string {
+	style := msg.Style
+	if style == "" {
+		style = environment.CommitMessageDetailed
+	}
+	parts := []string{"style=" + style}
+	if msg.MaxFiles > 0 {
+		parts = append(parts, fmt.Sprintf("max-files=%d", msg.MaxFiles))
+	}
+	if msg.Hook != "" {
+		parts = append(parts, fmt.Sprintf("hook=%q", msg.Hook))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Change budget object commands
+var configChangeBudgetCmd = &cobra.Command{
+	Use:   "change-budget",
+	Short: "Manage the change budget of environments",
+	Long: `Manage how much environments may change (files and lines, relative to their base)
+before a human reviews them. Environments over budget record a budget_exceeded event
+and are flagged in 'container-use list'. With --block, the agent can't run commands
+in them until the changes are acknowledged with 'container-use budget ack'.`,
+}
+
+var configChangeBudgetSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the change budget",
+	Long:  `Set the change budget of new environments. A limit of 0 disables it.`,
+	Example: `# Warn when an environment changes more than 20 files or 500 lines
+container-use config change-budget set --max-files 20 --max-lines 500
+
+# Also stop the agent until the changes are acknowledged
+container-use config change-budget set --max-lines 500 --block`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.ChangeBudget == nil {
+				config.ChangeBudget = &environment.ChangeBudgetConfig{}
+			}
+			budget := config.ChangeBudget
+			if cmd.Flags().Changed("max-files") {
+				budget.MaxFiles, _ = cmd.Flags().GetInt("max-files")
+			}
+			if cmd.Flags().Changed("max-lines") {
+				budget.MaxLines, _ = cmd.Flags().GetInt("max-lines")
+			}
+			if cmd.Flags().Changed("block") {
+				budget.Block, _ = cmd.Flags().GetBool("block")
+			}
+			if budget.MaxFiles < 0 || budget.MaxLines < 0 {
+				return fmt.Errorf("limits must not be negative")
+			}
+			if budget.MaxFiles == 0 && budget.MaxLines == 0 {
+				return fmt.Errorf("set --max-files and/or --max-lines")
+			}
+
+			fmt.Printf("Change budget set: %s\n", describeChangeBudget(budget))
+			return nil
+		})
+	},
+}
+
+var configChangeBudgetGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the change budget",
+	Long:  `Display the change budget of new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.ChangeBudget == nil {
+				fmt.Println("none")
+				return nil
+			}
+			fmt.Println(describeChangeBudget(config.ChangeBudget))
+			return nil
+		})
+	},
+}
+
+var configChangeBudgetResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove the change budget",
+	Long:  `Let new environments change any number of files and lines.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.ChangeBudget = nil
+			fmt.Println("Change budget removed")
+			return nil
+		})
+	},
+}
+
+func describeChangeBudget(budget *environment.ChangeBudgetConfig) string {
+	parts := []string{}
+	if budget.MaxFiles > 0 {
+		parts = append(parts, fmt.Sprintf("max-files=%d", budget.MaxFiles))
+	}
+	if budget.MaxLines > 0 {
+		parts = append(parts, fmt.Sprintf("max-lines=%d", budget.MaxLines))
+	}
+	if budget.Block {
+		parts = append(parts, "block")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Task object commands
+var configTaskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "Manage tasks",
+	Long: `Manage the named tasks of the project, such as build, test, lint or e2e, with the
+tasks they depend on and the services they require. Run them with
+'container-use task', and agents with the environment_run_task tool, instead of
+inventing command lines.`,
+}
+
+var configTaskSetCmd = &cobra.Command{
+	Use:   "set <name> <command>",
+	Short: "Add or replace a task",
+	Long: `Add a task, or replace the task with the same name.
+
+Its dependencies run before it, in order, each of them once. Services given with
+--service are started for the task's command only, reachable at their name; set
+their command, ports and environment variables in .container-use/environment.json.`,
+	Example: `# Build, then test
+container-use config task set build "go build ./..."
+container-use config task set test "go test ./..." --depends-on build --description "Unit tests"
+
+# End-to-end tests with a browser
+container-use config task set e2e "npm run e2e" --depends-on build --service chrome=selenium/standalone-chrome`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		task := &environment.TaskConfig{Name: args[0], Command: args[1]}
+		task.Description, _ = cmd.Flags().GetString("description")
+		task.DependsOn, _ = cmd.Flags().GetStringSlice("depends-on")
+		services, _ := cmd.Flags().GetStringArray("service")
+		for _, service := range services {
+			name, image, ok := strings.Cut(service, "=")
+			if !ok || name == "" || image == "" {
+				return fmt.Errorf("invalid --service %q, expected name=image", service)
+			}
+			task.Services = append(task.Services, &environment.ServiceConfig{Name: name, Image: image})
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			tasks := make(environment.TaskConfigs, 0, len(config.Tasks)+1)
+			replaced := false
+			for _, existing := range config.Tasks {
+				if existing.Name == task.Name {
+					existing, replaced = task, true
+				}
+				tasks = append(tasks, existing)
+			}
+			if !replaced {
+				tasks = append(tasks, task)
+			}
+			if err := tasks.Validate(); err != nil {
+				return err
+			}
+			config.Tasks = tasks
+			fmt.Printf("Task set: %s\n", describeTask(task))
+			return nil
+		})
+	},
+}
+
+var configTaskRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a task",
+	Long:  `Remove a task from the environment configuration. Tasks depending on it must be removed first.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Tasks.Get(name) == nil {
+				return fmt.Errorf("task not found: %s", name)
+			}
+			tasks := make(environment.TaskConfigs, 0, len(config.Tasks))
+			for _, task := range config.Tasks {
+				if task.Name == name {
+					continue
+				}
+				if slices.Contains(task.DependsOn, name) {
+					return fmt.Errorf("task %s depends on %s", task.Name, name)
+				}
+				tasks = append(tasks, task)
+			}
+			config.Tasks = tasks
+			fmt.Printf("Task removed: %s\n", name)
+			return nil
+		})
+	},
+}
+
+var configTaskListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all tasks",
+	Long:  `List the tasks of the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			return printTasks(config.Tasks, false)
+		})
+	},
+}
+
+var configTaskClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all tasks",
+	Long:  `Remove all tasks from the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Tasks = nil
+			fmt.Println("All tasks cleared")
+			return nil
+		})
+	},
+}
+
+func describeTask(task *environment.TaskConfig) string {
+	description := fmt.Sprintf("%s: %s", task.Name, task.Command)
+	if len(task.DependsOn) > 0 {
+		description += fmt.Sprintf(" (after %s)", strings.Join(task.DependsOn, ", "))
+	}
+	if len(task.Services) > 0 {
+		names := make([]string, 0, len(task.Services))
+		for _, service := range task.Services {
+			names = append(names, service.Name)
+		}
+		description += fmt.Sprintf(" [services: %s]", strings.Join(names, ", "))
+	}
+	return description
+}
+
+// Service object commands
+var configServiceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage service containers",
+	Long: `Manage the services of the environments, such as databases and caches the tests
+need. Services run in their own containers next to the environment's, reachable
+from its commands at their name. They're started before the environment's first
+command, and waited for until their ports listen and their healthcheck succeeds.
+Their exposed ports are also forwarded to the host.`,
+}
+
+var configServiceSetCmd = &cobra.Command{
+	Use:   "set <name> <image>",
+	Short: "Add or replace a service",
+	Long: `Add a service, or replace the service with the same name.
+
+The healthcheck runs in a container of the service's image, which reaches the
+service at its name, until it succeeds: e.g. "pg_isready -h db" for a Postgres
+service named db. Secrets of the configuration are available to services too.`,
+	Example: `# A Postgres database, reachable at db:5432
+container-use config service set db postgres:16 --port 5432 -e POSTGRES_PASSWORD=postgres --healthcheck "pg_isready -h db"
+
+# A Redis cache
+container-use config service set cache redis:7 --port 6379 --healthcheck "redis-cli -h cache ping"`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		service := &environment.ServiceConfig{Name: args[0], Image: args[1]}
+		service.Command, _ = cmd.Flags().GetString("command")
+		service.ExposedPorts, _ = cmd.Flags().GetIntSlice("port")
+		service.Env, _ = cmd.Flags().GetStringArray("env")
+		if healthcheck, _ := cmd.Flags().GetString("healthcheck"); healthcheck != "" {
+			interval, _ := cmd.Flags().GetDuration("healthcheck-interval")
+			retries, _ := cmd.Flags().GetInt("healthcheck-retries")
+			service.Healthcheck = &environment.ServiceHealthcheck{Command: healthcheck, IntervalMS: interval.Milliseconds(), Retries: retries}
+		}
+		if err := service.Validate(); err != nil {
+			return err
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if i := slices.IndexFunc(config.Services, func(existing *environment.ServiceConfig) bool { return existing.Name == service.Name }); i >= 0 {
+				config.Services[i] = service
+			} else {
+				config.Services = append(config.Services, service)
+			}
+			fmt.Printf("Service set: %s\n", describeService(service))
+			return nil
+		})
+	},
+}
+
+var configServiceRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a service",
+	Long:  `Remove a service from the environment configuration.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Services.Get(name) == nil {
+				return fmt.Errorf("service not found: %s", name)
+			}
+			config.Services = slices.DeleteFunc(config.Services, func(service *environment.ServiceConfig) bool { return service.Name == name })
+			fmt.Printf("Service removed: %s\n", name)
+			return nil
+		})
+	},
+}
+
+var configServiceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all services",
+	Long:  `List the services of the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.Services) == 0 {
+				fmt.Println("No services configured, see 'container-use config service set'")
+				return nil
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(tw, "SERVICE\tIMAGE\tPORTS\tHEALTHCHECK")
+			for _, service := range config.Services {
+				healthcheck := "-"
+				if service.Healthcheck != nil {
+					healthcheck = service.Healthcheck.Command
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", service.Name, service.Image, orDash(joinPorts(service.ExposedPorts)), healthcheck)
+			}
+			return tw.Flush()
+		})
+	},
+}
+
+var configServiceClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all services",
+	Long:  `Remove all services from the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Services = nil
+			fmt.Println("All services cleared")
+			return nil
+		})
+	},
+}
+
+func describeService(service *environment.ServiceConfig) string {
+	description := fmt.Sprintf("%s: %s", service.Name, service.Image)
+	if len(service.ExposedPorts) > 0 {
+		description += fmt.Sprintf(" (ports %s)", joinPorts(service.ExposedPorts))
+	}
+	if service.Healthcheck != nil {
+		description += fmt.Sprintf(" [healthcheck: %s]", service.Healthcheck.Command)
+	}
+	return description
+}
+
+func joinPorts(ports []int) string {
+	parts := make([]string, 0, len(ports))
+	for _, port := range ports {
+		parts = append(parts, strconv.Itoa(port))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Resource guard object commands
+var configResourceGuardCmd = &cobra.Command{
+	Use:   "resource-guard",
+	Short: "Manage the host resources required to create environments and run commands",
+	Long: `Manage the free disk space and available memory the host must have left before
+environments are created and commands are run, so the Dagger engine doesn't fill
+the disk and corrupt ongoing builds. The disk of container-use's data directory is
+checked, along with the data directories of Docker and Podman when they exist and
+the --path directories. Available memory is only measured on Linux.
+
+Without a configured guard, 2GB of disk space and 256MB of memory are required.`,
+}
+
+var configResourceGuardSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the resource guard",
+	Long:  `Set the resources required by the repository's environments. A threshold of 0 disables its check.`,
+	Example: `# Require 10GB of free disk space
+container-use config resource-guard set --min-free-disk 10GB
+
+# Also check the disk the Dagger engine stores its cache on, and only warn
+container-use config resource-guard set --path /mnt/engine --warn-only`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.ResourceGuard == nil {
+				config.ResourceGuard = environment.DefaultResourceGuard()
+			}
+			guard := config.ResourceGuard
+			for _, threshold := range []struct {
+				flag  string
+				value *uint64
+			}{{"min-free-disk", &guard.MinFreeDisk}, {"min-free-memory", &guard.MinFreeMemory}} {
+				if !cmd.Flags().Changed(threshold.flag) {
+					continue
+				}
+				value, _ := cmd.Flags().GetString(threshold.flag)
+				size, err := humanize.ParseBytes(value)
+				if err != nil {
+					return fmt.Errorf("invalid --%s %q: %w", threshold.flag, value, err)
+				}
+				*threshold.value = size
+			}
+			if cmd.Flags().Changed("path") {
+				guard.Paths, _ = cmd.Flags().GetStringSlice("path")
+			}
+			if cmd.Flags().Changed("warn-only") {
+				guard.WarnOnly, _ = cmd.Flags().GetBool("warn-only")
+			}
+
+			fmt.Printf("Resource guard set: %s\n", describeResourceGuard(guard))
+			return nil
+		})
+	},
+}
+
+var configResourceGuardGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the resource guard",
+	Long:  `Display the resources required by the repository's environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.ResourceGuard == nil {
+				fmt.Printf("%s (default)\n", describeResourceGuard(environment.DefaultResourceGuard()))
+				return nil
+			}
+			fmt.Println(describeResourceGuard(config.ResourceGuard))
+			return nil
+		})
+	},
+}
+
+var configResourceGuardResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the resource guard to the defaults",
+	Long:  `Require the default free disk space and available memory.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.ResourceGuard = nil
+			fmt.Printf("Resource guard reset to the defaults: %s\n", describeResourceGuard(environment.DefaultResourceGuard()))
+			return nil
+		})
+	},
+}
+
+func describeResourceGuard(guard *environment.ResourceGuardConfig) string {
+	parts := []string{}
+	for _, threshold := range []struct {
+		name  string
+		value uint64
+	}{{"min-free-disk", guard.MinFreeDisk}, {"min-free-memory", guard.MinFreeMemory}} {
+		if threshold.value > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%s", threshold.name, humanize.Bytes(threshold.value)))
+		} else {
+			parts = append(parts, threshold.name+"=off")
+		}
+	}
+	if len(guard.Paths) > 0 {
+		parts = append(parts, "paths="+strings.Join(guard.Paths, ","))
+	}
+	if guard.WarnOnly {
+		parts = append(parts, "warn-only")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Retry object commands
+var configRetryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Manage the retries of operations failing on transient errors",
+	Long: `Manage how connecting to the Dagger engine, pulling images and running commands
+are retried when they fail on transient network or registry errors, such as a
+reset connection or a registry rate limit, instead of failing at once. Each retry
+waits twice as long as the previous one, up to the maximum delay. Permanent
+errors, such as a missing image or a denied access, aren't retried. Retries are
+shown in the progress output and noted in the environment's log.
+
+Without configured retries, operations are attempted 3 times, with a 1s initial
+delay and a 30s maximum delay.`,
+}
+
+var configRetrySetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the retries",
+	Long:  `Set the retries of the repository's operations. 1 attempt disables retries.`,
+	Example: `# Be more patient with a flaky registry
+container-use config retry set --attempts 5 --initial-delay 2s --max-delay 1m
+
+# Never retry
+container-use config retry set --attempts 1`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Retry == nil {
+				config.Retry = environment.DefaultRetry()
+			}
+			retry := config.Retry
+			if cmd.Flags().Changed("attempts") {
+				retry.Attempts, _ = cmd.Flags().GetInt("attempts")
+			}
+			for _, delay := range []struct {
+				flag  string
+				value *int64
+			}{{"initial-delay", &retry.InitialDelayMS}, {"max-delay", &retry.MaxDelayMS}} {
+				if cmd.Flags().Changed(delay.flag) {
+					value, _ := cmd.Flags().GetDuration(delay.flag)
+					*delay.value = value.Milliseconds()
+				}
+			}
+			if err := retry.Validate(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Retries set: %s\n", describeRetry(retry))
+			return nil
+		})
+	},
+}
+
+var configRetryGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the retries",
+	Long:  `Display the retries of the repository's operations.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Retry == nil {
+				fmt.Printf("%s (default)\n", describeRetry(environment.DefaultRetry()))
+				return nil
+			}
+			fmt.Println(describeRetry(config.Retry))
+			return nil
+		})
+	},
+}
+
+var configRetryResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the retries to the defaults",
+	Long:  `Retry operations failing on transient errors with the default attempts and delays.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Retry = nil
+			fmt.Printf("Retries reset to the defaults: %s\n", describeRetry(environment.DefaultRetry()))
+			return nil
+		})
+	},
+}
+
+func describeRetry(retry *environment.RetryConfig) string {
+	if retry.Attempts <= 1 {
+		return "attempts=1 (no retries)"
+	}
+	return fmt.Sprintf("attempts=%d initial-delay=%s max-delay=%s", retry.Attempts,
+		time.Duration(retry.InitialDelayMS)*time.Millisecond, time.Duration(retry.MaxDelayMS)*time.Millisecond)
+}
+
+// Command timeout object commands
+var configCommandTimeoutCmd = &cobra.Command{
+	Use:   "command-timeout",
+	Short: "Manage the timeout of commands",
+	Long: `Manage how long the commands of agents and users may run in environments, so
+commands stuck on an interactive prompt or servers started in the foreground don't
+hang forever. Once the timeout expires, the command is sent a signal, TERM by
+default, then killed if it's still running after the grace period. It exits with
+code 124, and the changes it made until then are kept. 'container-use exec
+--timeout' overrides the timeout for a command.
+
+Without a configured timeout, commands may run for any time.`,
+}
+
+var configCommandTimeoutSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the timeout of commands",
+	Long:  `Set the timeout of the commands of new environments.`,
+	Example: `# Stop commands running for more than 15 minutes
+container-use config command-timeout set --timeout 15m
+
+# Give servers 30s to shut down cleanly on SIGINT
+container-use config command-timeout set --timeout 15m --signal INT --grace-period 30s`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.CommandTimeout == nil {
+				config.CommandTimeout = &environment.CommandTimeout{}
+			}
+			timeout := config.CommandTimeout
+			if cmd.Flags().Changed("timeout") {
+				duration, _ := cmd.Flags().GetDuration("timeout")
+				timeout.DurationMS = duration.Milliseconds()
+			}
+			if cmd.Flags().Changed("signal") {
+				signal, _ := cmd.Flags().GetString("signal")
+				timeout.Signal = environment.ParseTimeoutSignal(signal)
+			}
+			if cmd.Flags().Changed("grace-period") {
+				grace, _ := cmd.Flags().GetDuration("grace-period")
+				timeout.GracePeriodMS = grace.Milliseconds()
+			}
+			if err := timeout.Validate(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Command timeout set: %s\n", describeCommandTimeout(timeout))
+			return nil
+		})
+	},
+}
+
+var configCommandTimeoutGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the timeout of commands",
+	Long:  `Display the timeout of the commands of new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.CommandTimeout == nil {
+				fmt.Println("none")
+				return nil
+			}
+			fmt.Println(describeCommandTimeout(config.CommandTimeout))
+			return nil
+		})
+	},
+}
+
+var configCommandTimeoutResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove the timeout of commands",
+	Long:  `Let the commands of new environments run for any time.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CommandTimeout = nil
+			fmt.Println("Command timeout removed")
+			return nil
+		})
+	},
+}
+
+func describeCommandTimeout(timeout *environment.CommandTimeout) string {
+	return fmt.Sprintf("timeout=%s signal=%s grace-period=%s", timeout.Duration(), timeout.StopSignal(), timeout.GracePeriod())
+}
+
+// Quota object commands
+var configQuotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Manage the quotas of live environments",
+	Long: `Manage how many environments may live at once in the repository, with each label,
+and created by each agent (the MCP client creating them), so a runaway orchestrator
+can't create hundreds of environments on a shared machine. Creating an environment
+that would exceed a quota fails, listing the least recently updated environments to
+delete. Agents can check the quotas with the environment_quota tool.
+
+Without configured quotas, any number of environments can be created.`,
+}
+
+var configQuotaSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the quotas",
+	Long: `Set the quotas of the repository. A limit of 0 is unlimited: --label and --agent
+set the limit of a label or an agent, overriding --max-per-label and --max-per-agent.`,
+	Example: `# At most 20 environments, 5 per agent
+container-use config quota set --max-environments 20 --max-per-agent 5
+
+# At most 2 experiments at once
+container-use config quota set --label experiment=2
+
+# Let the orchestrator create more environments than other agents
+container-use config quota set --max-per-agent 3 --agent orchestrator=10`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Quota == nil {
+				config.Quota = &environment.QuotaConfig{}
+			}
+			quota := config.Quota
+			for _, limit := range []struct {
+				flag  string
+				value *int
+			}{{"max-environments", &quota.MaxEnvironments}, {"max-per-label", &quota.MaxPerLabel}, {"max-per-agent", &quota.MaxPerAgent}} {
+				if cmd.Flags().Changed(limit.flag) {
+					*limit.value, _ = cmd.Flags().GetInt(limit.flag)
+				}
+			}
+			for _, limits := range []struct {
+				flag   string
+				values *map[string]int
+			}{{"label", &quota.Labels}, {"agent", &quota.Agents}} {
+				specs, _ := cmd.Flags().GetStringArray(limits.flag)
+				for _, spec := range specs {
+					name, value, ok := strings.Cut(spec, "=")
+					limit, err := strconv.Atoi(value)
+					if !ok || name == "" || err != nil {
+						return fmt.Errorf("invalid --%s %q: expected name=limit", limits.flag, spec)
+					}
+					if *limits.values == nil {
+						*limits.values = map[string]int{}
+					}
+					(*limits.values)[strings.ToLower(name)] = limit
+				}
+			}
+			if err := quota.Validate(); err != nil {
+				return err
+			}
+			if quota.IsZero() {
+				config.Quota = nil
+			}
+
+			fmt.Printf("Quotas set: %s\n", describeQuota(config.Quota))
+			return nil
+		})
+	},
+}
+
+var configQuotaGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the quotas",
+	Long:  `Display the quotas of the repository, and how many environments count toward them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		status, err := repo.QuotaStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+		fmt.Fprintf(tw, "Environments:\t%s\n", describeQuotaUsage(status.Environments))
+		for _, group := range []struct {
+			name   string
+			usages map[string]repository.QuotaUsage
+		}{{"Label", status.Labels}, {"Agent", status.Agents}} {
+			for _, name := range slices.Sorted(maps.Keys(group.usages)) {
+				fmt.Fprintf(tw, "%s %s:\t%s\n", group.name, name, describeQuotaUsage(group.usages[name]))
+			}
+		}
+		return nil
+	},
+}
+
+var configQuotaResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove the quotas",
+	Long:  `Let any number of environments be created.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Quota = nil
+			fmt.Println("Quotas removed")
+			return nil
+		})
+	},
+}
+
+func describeQuota(quota *environment.QuotaConfig) string {
+	if quota.IsZero() {
+		return "none"
+	}
+	parts := []string{}
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{{"max-environments", quota.MaxEnvironments}, {"max-per-label", quota.MaxPerLabel}, {"max-per-agent", quota.MaxPerAgent}} {
+		if limit.value > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", limit.name, limit.value))
+		}
+	}
+	for _, limits := range []struct {
+		name   string
+		values map[string]int
+	}{{"label", quota.Labels}, {"agent", quota.Agents}} {
+		for _, name := range slices.Sorted(maps.Keys(limits.values)) {
+			parts = append(parts, fmt.Sprintf("%s:%s=%d", limits.name, name, limits.values[name]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func describeQuotaUsage(usage repository.QuotaUsage) string {
+	if usage.Max == 0 {
+		return fmt.Sprintf("%d (unlimited)", usage.Used)
+	}
+	if usage.Exceeded() {
+		return fmt.Sprintf("%d/%d (full)", usage.Used, usage.Max)
+	}
+	return fmt.Sprintf("%d/%d", usage.Used, usage.Max)
+}
+
+// Resource limits object commands
+var configResourcesCmd = &cobra.Command{
+	Use:   "resources",
+	Short: "Manage the CPU, memory and disk limits of environments",
+	Long: `Manage the host resources the commands of new environments may use, so a runaway
+agent command can't starve the host by accident. The Dagger engine can't put its
+containers in cgroups of their own, so the limits are advisory: they're applied to
+each command of the agent and the user with per-process tools, which don't add up
+and which the commands can undo.
+
+  cpus    the CPUs commands start on, rounded up (with taskset, when the image
+          has it); commands running as root can pin themselves to other CPUs
+  memory  the address space of each process (with ulimit -v), not the memory of
+          the command as a whole; runtimes reserving a lot of address space up
+          front, such as the JVM or sanitizers, may fail to start under it
+  disk    the size of each file commands write (with ulimit -f), not of all of
+          them; commands leaving the workdir larger than that are reported
+
+Commands running as root can raise the memory and disk limits again: use hardened
+environments for code that can't be trusted to stay within them.
+
+The limits are recorded in each environment when it's created, and can be set for
+a single environment with 'container-use create --cpus --memory --disk'.
+
+Without configured limits, commands may use any resources of the host.`,
+}
+
+var configResourcesSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the resource limits",
+	Long:  `Set the resource limits of the repository's new environments. A limit of 0 is unlimited.`,
+	Example: `# At most 2 CPUs and 4GB of memory
+container-use config resources set --cpus 2 --memory 4GB
+
+# Stop commands writing files over 10GB
+container-use config resources set --disk 10GB`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			limits, err := resourceLimitsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			if config.Resources == nil {
+				config.Resources = &environment.ResourceLimits{}
+			}
+			if cmd.Flags().Changed("cpus") {
+				config.Resources.CPUs = limits.CPUs
+			}
+			if cmd.Flags().Changed("memory") {
+				config.Resources.Memory = limits.Memory
+			}
+			if cmd.Flags().Changed("disk") {
+				config.Resources.Disk = limits.Disk
+			}
+			if config.Resources.IsZero() {
+				config.Resources = nil
+			}
+
+			fmt.Printf("Resource limits set: %s\n", describeResourceLimits(config.Resources))
+			return nil
+		})
+	},
+}
+
+var configResourcesGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the resource limits",
+	Long:  `Display the resource limits of the repository's new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			fmt.Println(describeResourceLimits(config.Resources))
+			return nil
+		})
+	},
+}
+
+var configResourcesResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove the resource limits",
+	Long:  `Let the commands of new environments use any resources of the host.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Resources = nil
+			fmt.Println("Resource limits removed")
+			return nil
+		})
+	},
+}
+
+// resourceLimitsFromFlags parses the --cpus, --memory and --disk flags of cmd. Unset flags are 0.
+func resourceLimitsFromFlags(cmd *cobra.Command) (*environment.ResourceLimits, error) {
+	limits := &environment.ResourceLimits{}
+	limits.CPUs, _ = cmd.Flags().GetFloat64("cpus")
+	for _, limit := range []struct {
+		flag  string
+		value *uint64
+	}{{"memory", &limits.Memory}, {"disk", &limits.Disk}} {
+		if !cmd.Flags().Changed(limit.flag) {
+			continue
+		}
+		value, _ := cmd.Flags().GetString(limit.flag)
+		size, err := humanize.ParseBytes(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s %q: %w", limit.flag, value, err)
+		}
+		*limit.value = size
+	}
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// describeResourceLimits describes the limits, as advisory: see configResourcesCmd.
+func describeResourceLimits(limits *environment.ResourceLimits) string {
+	if limits.IsZero() {
+		return "none"
+	}
+	parts := []string{}
+	if limits.CPUs > 0 {
+		parts = append(parts, "cpus="+strconv.FormatFloat(limits.CPUs, 'f', -1, 64))
+	}
+	for _, limit := range []struct {
+		name  string
+		value uint64
+	}{{"memory", limits.Memory}, {"disk", limits.Disk}} {
+		if limit.value > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%s", limit.name, humanize.Bytes(limit.value)))
+		}
+	}
+	return strings.Join(parts, " ") + " (advisory)"
+}
+
+// Docker object commands
+var configDockerCmd = &cobra.Command{
+	Use:   "docker",
+	Short: "Manage Docker support inside environments",
+	Long: `Manage running docker and docker compose inside environments, for projects whose
+test suites start containers (e.g. with testcontainers or compose).
+
+Modes:
+  dind         run a dedicated Docker daemon for each environment (default)
+  host-socket  give environments the host's Docker socket
+
+With host-socket, environments can start privileged containers on the host and
+see every container running there: only use it with trusted agents. It can only
+be enabled from the host; agents may only enable dind.`,
+}
+
+var configDockerEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable Docker inside environments",
+	Long:  `Install the docker CLI and compose plugin in new environments and connect them to a Docker daemon.`,
+	Example: `# Run a Docker daemon in each environment
+container-use config docker enable
+
+# Use the host's Docker daemon
+container-use config docker enable --mode host-socket`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			docker := &environment.DockerConfig{}
+			docker.Mode, _ = cmd.Flags().GetString("mode")
+			docker.Image, _ = cmd.Flags().GetString("image")
+			docker.Socket, _ = cmd.Flags().GetString("socket")
+			if err := docker.Validate(); err != nil {
+				return err
+			}
+			config.Docker = docker
+			fmt.Printf("Docker enabled: %s\n", docker)
+			return nil
+		})
+	},
+}
+
+var configDockerDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable Docker inside environments",
+	Long:  `Stop providing docker and a Docker daemon to new environments.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Docker = nil
+			fmt.Println("Docker disabled")
+			return nil
+		})
+	},
+}
+
+var configDockerGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the Docker support settings",
+	Long:  `Display whether and how environments can run docker.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Docker == nil {
+				fmt.Println("disabled")
+				return nil
+			}
+			fmt.Println(config.Docker)
+			return nil
+		})
+	},
+}
+
+// Docker credentials commands
+var configDockerCredentialsCmd = &cobra.Command{
+	Use:   "docker-credentials",
+	Short: "Manage the use of the host's Docker credentials",
+	Long: `Manage the use of the host's Docker credentials, for images in private registries.
+
+With Docker credentials enabled, the base image, the images of services and the
+Docker daemon image are pulled with the credentials Docker has on the host for
+their registry: from its credential helpers (osxkeychain, pass, wincred, ...) or
+its config.json, in $DOCKER_CONFIG or ~/.docker. With Docker enabled, the docker
+CLI of environments gets the credentials of these registries too, through a
+configuration mounted as a secret: the credentials of other registries are never
+given to environments. Credentials are read when environments are built and never
+stored in the repository's configuration.
+
+The configuration is committed: credentials are only used once you trusted them
+for the registries of the environment's images, with 'container-use config trust'.
+Enabling them here trusts them; changing the images asks again.`,
+}
+
+var configDockerCredentialsEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Use the host's Docker credentials",
+	Long:  `Pull images of new environments with the host's Docker credentials, and trust them for the registries of these images.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var value string
+		if err := updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.DockerCredentials = true
+			fmt.Println("Docker credentials enabled")
+			printCredentialRegistries(config)
+			value = repository.DockerCredentialsTrustValue(config)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return trustConfigValue(cmd, repository.TrustDockerCredentials, value)
+	},
+}
+
+var configDockerCredentialsDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop using the host's Docker credentials",
+	Long:  `Pull images of new environments anonymously.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.DockerCredentials = false
+			fmt.Println("Docker credentials disabled")
+			return nil
+		})
+	},
+}
+
+var configDockerCredentialsGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get whether the host's Docker credentials are used",
+	Long:  `Display whether the host's Docker credentials are used, and the registries they're used for.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if !config.DockerCredentials {
+				fmt.Println("disabled")
+				return nil
+			}
+			fmt.Println("enabled")
+			printCredentialRegistries(config)
+			return nil
+		})
+	},
+}
+
+// printCredentialRegistries prints the registries of the configuration's images the host has Docker
+// credentials for, asking its credential helpers.
+func printCredentialRegistries(config *environment.EnvironmentConfig) {
+	var registries []string
+	for _, registry := range config.ImageRegistries() {
+		credential, err := environment.HostRegistryCredential(registry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		if credential != nil {
+			registries = append(registries, registry)
+		}
+	}
+	if len(registries) == 0 {
+		fmt.Println("The host has no Docker credentials for the registries of the images: log in with 'docker login'")
+		return
+	}
+	fmt.Printf("Registries: %s\n", strings.Join(registries, ", "))
+}
+
+// Hardened mode commands
+var configHardenedCmd = &cobra.Command{
+	Use:   "hardened",
+	Short: "Manage the hardened mode of environments",
+	Long: `Manage the hardened mode, for environments running untrusted agent-generated code.
+
+Hardened environments run the agent's commands as an unprivileged user, with no
+capabilities, no way to gain privileges and no access to the engine's API: the
+system directories are read-only to them. A seccomp filter denies the syscalls
+that create namespaces, mount filesystems, trace processes or load kernel code;
+no AppArmor profile is applied beyond the engine's. Setup and install commands
+from this configuration still run as root, and agents can't change the base
+image, features or setup commands of their environment. Agents can't install
+system packages in hardened environments, and Docker can't be enabled.`,
+}
+
+var configHardenedEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Harden new environments",
+	Long:  `Run the agent's commands unprivileged in new environments.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Docker != nil {
+				return fmt.Errorf("docker is enabled: disable it first with 'container-use config docker disable'")
+			}
+			config.Hardened = true
+			fmt.Println("Hardened mode enabled")
+			return nil
+		})
+	},
+}
+
+var configHardenedDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop hardening new environments",
+	Long:  `Run the agent's commands as the image's user again in new environments.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Hardened = false
+			fmt.Println("Hardened mode disabled")
+			return nil
+		})
+	},
+}
+
+var configHardenedGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the hardened mode",
+	Long:  `Display whether new environments are hardened.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Hardened {
+				fmt.Println("enabled")
+			} else {
+				fmt.Println("disabled")
+			}
+			return nil
+		})
+	},
+}
+
+// Auto-install commands
+var configAutoInstallCmd = &cobra.Command{
+	Use:   "auto-install",
+	Short: "Manage the installation of missing commands",
+	Long: `Manage the installation of commands the agent's commands can't find.
+
+When a command fails with "command not found" and the missing command is known,
+the package providing it is installed with the image's package manager (apt-get,
+apk or brew) and the command runs again. Installs are recorded like the agent's
+commands: add them to the configuration with 'container-use promote'. Hardened
+environments never install missing commands.`,
+}
+
+var configAutoInstallEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Install missing commands in environments",
+	Long:  `Install the package providing a missing command and run the command again.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.AutoInstall = true
+			fmt.Println("Auto-install enabled")
+			return nil
+		})
+	},
+}
+
+var configAutoInstallDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop installing missing commands",
+	Long:  `Let commands fail when they can't find a command.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.AutoInstall = false
+			fmt.Println("Auto-install disabled")
+			return nil
+		})
+	},
+}
+
+var configAutoInstallGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the auto-install mode",
+	Long:  `Display whether missing commands are installed.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.AutoInstall {
+				fmt.Println("enabled")
+			} else {
+				fmt.Println("disabled")
+			}
+			return nil
+		})
+	},
+}
+
+// Metadata repository commands
+var configMetadataRepoCmd = &cobra.Command{
+	Use:   "metadata-repo",
+	Short: "Manage the repository environments are tracked in",
+	Long: `Manage the metadata repository, a dedicated repository the branches and notes of
+environments are pushed to as they change, so they never need to be pushed to the
+product repository. Use it when the product repository's ref policies or server-side
+hooks reject container-use's refs, or to share environments between clones.
+
+The setting is stored in the repository's git config (container-use.metadataRepo),
+not in the committed configuration. Environments already in the metadata repository,
+e.g. pushed from another clone, become available when it's set.`,
+}
+
+var configMetadataRepoSetCmd = &cobra.Command{
+	Use:   "set <path-or-url>",
+	Short: "Track environments in a metadata repository",
+	Long:  `Push the branches and notes of environments to the given repository, a path or git URL.`,
+	Example: `# Track environments in a dedicated repository
+container-use config metadata-repo set git@github.com:acme/shop-environments.git
+
+# Or in a local bare repository
+git init --bare ~/shop-environments.git
+container-use config metadata-repo set ~/shop-environments.git`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		if err := repo.SetMetadataRepo(ctx, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Metadata repository set to: %s\n", args[0])
+		return nil
+	},
+}
+
+var configMetadataRepoGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the metadata repository",
+	Long:  `Display the repository environments are tracked in.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		if url := repo.MetadataRepo(ctx); url != "" {
+			fmt.Println(url)
+		} else {
+			fmt.Println("(none)")
+		}
+		return nil
+	},
+}
+
+var configMetadataRepoResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Stop tracking environments in a metadata repository",
+	Long:  `Stop pushing environments to the metadata repository. Environments already pushed there are kept.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		if err := repo.SetMetadataRepo(ctx, ""); err != nil {
+			return err
+		}
+		fmt.Println("Metadata repository reset")
+		return nil
+	},
+}
+
+// Suggester commands
+var configSuggesterCmd = &cobra.Command{
+	Use:   "suggester",
+	Short: "Manage the title suggester",
+	Long: `Manage the suggester, a host command proposing the title and labels of environments
+created without a title, e.g. by automations.
+
+The suggester receives the task description (create --task) and the latest commits of
+the ref the environment is created from as JSON on stdin, and CONTAINER_USE_TASK and
+CONTAINER_USE_FROM_REF in its environment. It runs in the repository and prints either
+the title, or {"title": "...", "labels": ["..."]}. Any local model or script can be used.`,
+}
+
+var configSuggesterSetCmd = &cobra.Command{
+	Use:   "set <command>",
+	Short: "Set the suggester",
+	Long:  `Set the host command proposing titles and labels, run with sh -c.`,
+	Example: `# Title environments after the task with a local model
+container-use config suggester set 'ollama run llama3.2 "Give a short title for: $CONTAINER_USE_TASK"'
+
+# Use a script
+container-use config suggester set ./scripts/suggest-title.sh`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Suggester = args[0]
+			fmt.Printf("Suggester set to: %s\n", args[0])
+			return nil
+		}); err != nil {
+			return err
+		}
+		return trustConfigValue(cmd, repository.TrustSuggester, args[0])
+	},
+}
+
+var configSuggesterGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the suggester",
+	Long:  `Display the host command proposing titles and labels.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Suggester == "" {
+				fmt.Println("(none)")
+				return nil
+			}
+			fmt.Println(config.Suggester)
+			return nil
+		})
+	},
+}
+
+var configSuggesterResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove the suggester",
+	Long:  `Remove the suggester, so creating an environment requires a title again.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Suggester = ""
+			fmt.Println("Suggester removed")
+			return nil
+		})
+	},
+}
+
+// Trust commands
+var configTrustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Trust the host commands and files of the configuration",
+	Long: `Review and trust the host commands and files of the configuration: the commit message
+hook and the suggester, which run on your machine outside of environments, the host
+files provided to environments without asking, and the host's Docker credentials of the
+registries of the environments' images. The configuration is committed with the
+repository: commands only run once you trusted them here, untrusted host files are
+asked about when environments are created, and untrusted credentials aren't used. Trust is recorded per repository for the
+exact command or file, so changing it asks again. What you set with 'container-use config'
+is trusted already.`,
+	Example: `# Review the untrusted commands and trust them
+container-use config trust
+
+# Trust them without asking
+container-use config trust --yes`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		config := environment.DefaultConfig()
+		if err := config.Load(repo.SourcePath()); err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		untrusted, err := repo.Untrusted(config)
+		if err != nil {
+			return err
+		}
+		if len(untrusted) == 0 {
+			fmt.Println("Nothing to trust")
+			return nil
+		}
+		fmt.Println("The configuration uses these on your machine:")
+		for _, value := range untrusted {
+			fmt.Printf("  %s: %s\n", value.Kind, value.Value)
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			if !isInteractive() {
+				return errors.New("refusing to trust without confirmation: use --yes")
+			}
+			fmt.Fprint(os.Stderr, "Trust them? [y/N] ")
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+				return errors.New("trust cancelled")
+			}
+		}
+
+		for _, value := range untrusted {
+			if err := repo.Trust(value.Kind, value.Value); err != nil {
+				return fmt.Errorf("failed to trust %s: %w", value.Kind, err)
+			}
+		}
+		fmt.Printf("Trusted %d value(s)\n", len(untrusted))
+		return nil
+	},
+}
+
+var configTrustListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the trusted host commands and files",
+	Long:  `List the host commands and files of the configuration you trusted in this repository.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := repository.Open(cmd.Context(), ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		trusted, err := repo.ListTrusted()
+		if err != nil {
+			return err
+		}
+		if len(trusted) == 0 {
+			fmt.Println("Nothing trusted")
+			return nil
+		}
+		for _, value := range trusted {
+			fmt.Printf("%s: %s\n", value.Kind, value.Value)
+		}
+		return nil
+	},
+}
+
+var configTrustResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Forget the trusted host commands and files",
+	Long:  `Forget the host commands and files you trusted in this repository, so they aren't used until trusted again.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, err := repository.Open(cmd.Context(), ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		if err := repo.ResetTrust(); err != nil {
+			return err
+		}
+		fmt.Println("Trust reset")
+		return nil
+	},
+}
+
+// trustConfigValue records that the user trusts a value they set themselves.
+func trustConfigValue(cmd *cobra.Command, kind, value string) error {
+	if value == "" {
+		return nil
+	}
+	repo, err := repository.Open(cmd.Context(), ".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	return repo.Trust(kind, value)
+}
+
+// Coverage command commands
+var configCoverageCommandCmd = &cobra.Command{
+	Use:   "coverage-command",
+	Short: "Manage the coverage command",
+	Long: `Manage the coverage command, run in the environment after the tests of
+'container-use test' to report their coverage when the test output doesn't, e.g. to
+summarize a coverage profile the tests wrote.
+
+Coverage is parsed from go test -cover, go tool cover -func, coverage.py (pytest --cov)
+and Istanbul (jest --coverage, nyc) text reports.`,
+}
+
+var configCoverageCommandSetCmd = &cobra.Command{
+	Use:   "set <command>",
+	Short: "Set the coverage command",
+	Long:  `Set the command reporting the coverage of the tests, run after them in the environment.`,
+	Example: `# Summarize the profile of go test -coverprofile=coverage.out
+container-use config coverage-command set "go tool cover -func=coverage.out"
+
+# Report the coverage of pytest --cov
+container-use config coverage-command set "coverage report"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CoverageCommand = args[0]
+			fmt.Printf("Coverage command set to: %s\n", args[0])
+			return nil
+		})
+	},
+}
+
+var configCoverageCommandGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the coverage command",
+	Long:  `Display the command reporting the coverage of the tests.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.CoverageCommand == "" {
+				fmt.Println("(none)")
+				return nil
+			}
+			fmt.Println(config.CoverageCommand)
+			return nil
+		})
+	},
+}
+
+var configCoverageCommandResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Remove the coverage command",
+	Long:  `Remove the coverage command, so coverage is only parsed from the test output.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CoverageCommand = ""
+			fmt.Println("Coverage command removed")
+			return nil
+		})
+	},
+}
+
+// Git identity object commands
+var configGitIdentityCmd = &cobra.Command{
+	Use:   "git-identity",
+	Short: "Manage the identity of environment commits",
+	Long: `Manage the author and committer of the commits recording environment changes,
+so blame and history tell agent changes apart from your own.
+By default, environment commits use your git identity.
+
+The identity is set for new environments, or for an existing environment with --env.
+Agents can also be given their own identity with 'container-use stdio --git-identity'.`,
+}
+
+var configGitIdentitySetCmd = &cobra.Command{
+	Use:   "set <identity>",
+	Short: "Set the identity of environment commits",
+	Long:  `Set the author and committer of environment commits, in the "Name <email>" form.`,
+	Example: `# Author the commits of new environments as a bot
+container-use config git-identity set "agent[bot] <agent-bot@users.noreply.github.com>"
+
+# Change the identity of an existing environment
+container-use config git-identity set "Reviewer Bot <reviewer@example.com>" --env fancy-mallard`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identity, err := environment.ParseGitIdentity(args[0])
+		if err != nil {
+			return err
+		}
+		if envID, _ := cmd.Flags().GetString("env"); envID != "" {
+			if err := setEnvironmentGitIdentity(cmd, envID, identity); err != nil {
+				return err
+			}
+			fmt.Printf("Git identity of %s set to: %s\n", envID, identity)
+			return nil
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.GitIdentity = identity
+			fmt.Printf("Git identity set to: %s\n", identity)
+			return nil
+		})
+	},
+}
+
+var configGitIdentityGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the identity of environment commits",
+	Long:  `Display the author and committer of the commits of new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.GitIdentity == nil {
+				fmt.Println("default (user's git identity)")
+				return nil
+			}
+			fmt.Println(config.GitIdentity)
+			return nil
+		})
+	},
+}
+
+var configGitIdentityResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the identity of environment commits to default",
+	Long:  `Reset environment commits to use your git identity.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if envID, _ := cmd.Flags().GetString("env"); envID != "" {
+			if err := setEnvironmentGitIdentity(cmd, envID, nil); err != nil {
+				return err
+			}
+			fmt.Printf("Git identity of %s reset to default\n", envID)
+			return nil
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.GitIdentity = nil
+			fmt.Println("Git identity reset to default")
+			return nil
+		})
+	},
+}
+
+// setEnvironmentGitIdentity changes the identity stored in an existing environment's state.
+func setEnvironmentGitIdentity(cmd *cobra.Command, envID string, identity *environment.GitIdentity) error {
+	ctx := cmd.Context()
+	repo, err := repository.Open(ctx, ".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	raw, err := repo.RawState(ctx, envID)
+	if err != nil {
+		return err
+	}
+	state := &environment.State{}
+	if err := state.Unmarshal(raw); err != nil {
+		return fmt.Errorf("failed to parse state: %w", err)
+	}
+	if state.Config == nil {
+		return fmt.Errorf("environment %q has no configuration", envID)
+	}
+	state.Config.GitIdentity = identity
+	data, err := state.Marshal()
+	if err != nil {
+		return err
+	}
+	return repo.SetRawState(ctx, envID, data)
+}
+
+// Clone object commands
+var configCloneCmd = &cobra.Command{
+	Use:   "clone",
+	Short: "Manage shallow clone settings",
+	Long: `Manage how much git history is provisioned for new environments.
+For very large repositories, a shallow depth and/or a partial clone filter make environment
+creation much faster. Missing history is fetched automatically when an operation needs it.`,
+}
+
+var configCloneSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the clone depth and filter",
+	Long:  `Set the history depth and partial clone filter used when creating new environments.`,
+	Example: `# Only provision the latest commit, without historical file contents
+container-use config clone set --depth 1 --filter blob:none`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		depth, _ := cmd.Flags().GetInt("depth")
+		filter, _ := cmd.Flags().GetString("filter")
+		if depth < 0 {
+			return fmt.Errorf("depth must not be negative: %d", depth)
+		}
+		if !cmd.Flags().Changed("depth") && !cmd.Flags().Changed("filter") {
+			return fmt.Errorf("at least one of --depth or --filter is required")
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Clone == nil {
+				config.Clone = &environment.CloneConfig{}
+			}
+			if cmd.Flags().Changed("depth") {
+				config.Clone.Depth = depth
+			}
+			if cmd.Flags().Changed("filter") {
+				config.Clone.Filter = filter
+			}
+			if !config.Clone.IsPartial() {
+				config.Clone = nil
+				fmt.Println("Clone settings cleared, environments will use full history")
+				return nil
+			}
+			fmt.Printf("Clone settings set: %s\n", describeClone(config.Clone))
+			return nil
+		})
+	},
+}
+
+var configCloneGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the current clone settings",
+	Long:  `Display the history depth and partial clone filter used for new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if !config.Clone.IsPartial() {
+				fmt.Println("full history")
+				return nil
+			}
+			fmt.Println(describeClone(config.Clone))
+			return nil
+		})
+	},
+}
+
+var configCloneResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset clone settings to full history",
+	Long:  `Remove the clone depth and filter so new environments get the full history.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Clone = nil
+			fmt.Println("Clone settings reset, environments will use full history")
+			return nil
+		})
+	},
+}
+
+func describeClone(clone *environment.CloneConfig) string {
+	parts := []string{}
+	if clone.Depth > 0 {
+		parts = append(parts, fmt.Sprintf("depth=%d", clone.Depth))
+	}
+	if clone.Filter != "" {
+		parts = append(parts, "filter="+clone.Filter)
+	}
+	return strings.Join(parts, " ")
+}
+
+func init() {
+	configDNSSetCmd.Flags().StringSlice("server", nil, "DNS server IP address (repeatable)")
+	configDNSSetCmd.Flags().StringSlice("search", nil, "DNS search domain (repeatable)")
+
+	configNamingSetCmd.Flags().String("prefix", "", "Prefix for every environment ID (e.g., team-a-)")
+	configNamingSetCmd.Flags().String("style", "", "Naming style: petname, words or sequential")
+	configNamingSetCmd.Flags().StringSlice("words", nil, "Word list for the words style")
+	configNamingSetCmd.Flags().Int("length", 0, "Number of words per ID (default 2)")
+	configNamingSetCmd.Flags().String("template", "", "ID template using {name}, {seq}, {date} and {rand}")
+
+	configFeatureAddCmd.Flags().StringSlice("option", nil, "Feature option as KEY=VALUE (repeatable)")
+
+	configCommitMessageSetCmd.Flags().String("style", "", "Message style: detailed, subject or explanation")
+	configCommitMessageSetCmd.Flags().Int("max-files", 0, "Maximum number of files listed in detailed messages (default 20)")
+	configCommitMessageSetCmd.Flags().String("hook", "", "Host command generating the message from the diff on stdin")
+
+	configChangeBudgetSetCmd.Flags().Int("max-files", 0, "Number of changed files allowed (0 for no limit)")
+	configChangeBudgetSetCmd.Flags().Int("max-lines", 0, "Number of changed lines allowed (0 for no limit)")
+	configChangeBudgetSetCmd.Flags().Bool("block", false, "Refuse agent commands once over budget, until the changes are acknowledged")
+	configTaskSetCmd.Flags().String("description", "", "What the task does, shown to agents")
+	configTaskSetCmd.Flags().StringSlice("depends-on", nil, "Tasks to run before this one, in order")
+	configServiceSetCmd.Flags().String("command", "", "Command of the service, instead of its image's")
+	configServiceSetCmd.Flags().IntSlice("port", nil, "Port the service listens on, waited for and forwarded to the host (repeatable)")
+	configServiceSetCmd.Flags().StringArrayP("env", "e", nil, "Environment variable of the service, as KEY=VALUE (repeatable)")
+	configServiceSetCmd.Flags().String("healthcheck", "", "Command telling when the service is ready, run in a container of its image")
+	configServiceSetCmd.Flags().Duration("healthcheck-interval", 0, "Delay between the attempts of the healthcheck (default 1s)")
+	configServiceSetCmd.Flags().Int("healthcheck-retries", 0, "Number of attempts of the healthcheck (default 30)")
+	configTaskSetCmd.Flags().StringArray("service", nil, "Service started for the task's command only, as name=image (repeatable)")
+	configResourceGuardSetCmd.Flags().String("min-free-disk", "", "Free disk space required, e.g. 5GB (0 to disable the check)")
+	configResourceGuardSetCmd.Flags().String("min-free-memory", "", "Available memory required, e.g. 512MB (0 to disable the check)")
+	configResourceGuardSetCmd.Flags().StringSlice("path", nil, "Other directories whose disk is checked, such as the Dagger engine's data directory")
+	configResourceGuardSetCmd.Flags().Bool("warn-only", false, "Warn instead of refusing when resources are low")
+	configCommandTimeoutSetCmd.Flags().Duration("timeout", 0, "How long commands may run")
+	configCommandTimeoutSetCmd.Flags().String("signal", "", "Signal asking commands to stop once the timeout expired (default TERM)")
+	configCommandTimeoutSetCmd.Flags().Duration("grace-period", 0, "How long commands have to stop after the signal before they're killed (default 10s)")
+	configQuotaSetCmd.Flags().Int("max-environments", 0, "Number of live environments of the repository (0 for no limit)")
+	configQuotaSetCmd.Flags().Int("max-per-label", 0, "Number of live environments with any given label (0 for no limit)")
+	configQuotaSetCmd.Flags().Int("max-per-agent", 0, "Number of live environments created by any given agent (0 for no limit)")
+	configQuotaSetCmd.Flags().StringArray("label", nil, "Number of live environments with a label, as label=limit (repeatable)")
+	configQuotaSetCmd.Flags().StringArray("agent", nil, "Number of live environments created by an agent, as agent=limit (repeatable)")
+	configResourcesSetCmd.Flags().Float64("cpus", 0, "Advisory CPU limit: the number of CPUs commands start on, rounded up (0 for no limit)")
+	configResourcesSetCmd.Flags().String("memory", "", "Advisory memory limit: the address space of each process of the commands, e.g. 4GB (0 for no limit)")
+	configResourcesSetCmd.Flags().String("disk", "", "Advisory disk limit: the size of each file commands write, e.g. 10GB (0 for no limit)")
+	configRetrySetCmd.Flags().Int("attempts", 0, "Number of attempts of an operation (1 to never retry)")
+	configRetrySetCmd.Flags().Duration("initial-delay", 0, "Delay before the first retry, doubled before each of the next ones")
+	configRetrySetCmd.Flags().Duration("max-delay", 0, "Maximum delay between retries")
+
+	configDockerEnableCmd.Flags().String("mode", environment.DockerModeDind, "Docker mode: dind or host-socket")
+	configDockerEnableCmd.Flags().String("image", "", "Image providing the Docker daemon and CLI (default docker:28-dind)")
+	configDockerEnableCmd.Flags().String("socket", "", "Host Docker socket for the host-socket mode (default /var/run/docker.sock)")
+
+	configGitIdentitySetCmd.Flags().String("env", "", "Set the identity of this existing environment instead")
+	configGitIdentityResetCmd.Flags().String("env", "", "Reset the identity of this existing environment instead")
+
+	configCloneSetCmd.Flags().Int("depth", 0, "Number of commits of history to provision (0 for full history)")
+	configCloneSetCmd.Flags().String("filter", "", "Partial clone filter (e.g., blob:none)")
+
+	// Add base-image commands
+	configBaseImageCmd.AddCommand(configBaseImageSetCmd)
+	configBaseImageCmd.AddCommand(configBaseImageGetCmd)
+	configBaseImageCmd.AddCommand(configBaseImageResetCmd)
+	configBaseImageBuildCmd.Flags().String("context", "", "Build context, relative to the repository root (default: the repository root)")
+	configBaseImageBuildCmd.Flags().String("target", "", "Stage to build, for multi-stage Containerfiles")
+	configBaseImageBuildCmd.Flags().StringArray("build-arg", nil, "Build argument, as KEY=VALUE (repeatable)")
+	configBaseImageCmd.AddCommand(configBaseImageBuildCmd)
+
+	// Add setup-command commands
+	configSetupCommandAddCmd.Flags().StringSlice("inputs", nil, "Source files the command depends on (e.g., requirements.txt)")
+	configInstallCommandAddCmd.Flags().StringSlice("inputs", nil, "Source files the command depends on (e.g., go.mod,go.sum)")
+	configSetupCommandCmd.AddCommand(configSetupCommandAddCmd)
+	configSetupCommandCmd.AddCommand(configSetupCommandRemoveCmd)
+	configSetupCommandCmd.AddCommand(configSetupCommandListCmd)
+	configSetupCommandCmd.AddCommand(configSetupCommandClearCmd)
 
 	// Add install-command commands
 	configInstallCommandCmd.AddCommand(configInstallCommandAddCmd)
@@ -575,6 +3442,11 @@ func init() {
 	configInstallCommandCmd.AddCommand(configInstallCommandClearCmd)
 
 	// Add env commands
+	configSnapshotPathCmd.AddCommand(configSnapshotPathAddCmd)
+	configSnapshotPathCmd.AddCommand(configSnapshotPathRemoveCmd)
+	configSnapshotPathCmd.AddCommand(configSnapshotPathListCmd)
+	configSnapshotPathCmd.AddCommand(configSnapshotPathClearCmd)
+
 	configEnvCmd.AddCommand(configEnvSetCmd)
 	configEnvCmd.AddCommand(configEnvUnsetCmd)
 	configEnvCmd.AddCommand(configEnvListCmd)
@@ -586,15 +3458,152 @@ func init() {
 	configSecretCmd.AddCommand(configSecretListCmd)
 	configSecretCmd.AddCommand(configSecretClearCmd)
 
+	// Add dns commands
+	configDNSCmd.AddCommand(configDNSSetCmd)
+	configDNSCmd.AddCommand(configDNSGetCmd)
+	configDNSCmd.AddCommand(configDNSClearCmd)
+
+	// Add host commands
+	configHostCmd.AddCommand(configHostSetCmd)
+	configHostCmd.AddCommand(configHostUnsetCmd)
+	configHostCmd.AddCommand(configHostListCmd)
+	configHostCmd.AddCommand(configHostClearCmd)
+
+	configHostFileAddCmd.Flags().String("target", "", "Path of the file in the environment")
+	configHostFileAddCmd.Flags().String("mode", environment.HostFileCopy, "How to provide the file: copy or secret")
+	configHostFileAddCmd.Flags().StringArray("redact", nil, "Regular expression whose matches are replaced with REDACTED (repeatable)")
+	configHostFileAddCmd.Flags().Bool("prompt", false, "Ask before providing the file to each new environment")
+	configHostFileCmd.AddCommand(configHostFileAddCmd)
+	configHostFileCmd.AddCommand(configHostFileRemoveCmd)
+	configHostFileCmd.AddCommand(configHostFileListCmd)
+	configHostFileCmd.AddCommand(configHostFileClearCmd)
+
+	// Add naming commands
+	configNamingCmd.AddCommand(configNamingSetCmd)
+	configNamingCmd.AddCommand(configNamingGetCmd)
+	configNamingCmd.AddCommand(configNamingResetCmd)
+
+	// Add clone commands
+	configFeatureCmd.AddCommand(configFeatureAddCmd)
+	configFeatureCmd.AddCommand(configFeatureRemoveCmd)
+	configFeatureCmd.AddCommand(configFeatureListCmd)
+	configFeatureCmd.AddCommand(configFeatureClearCmd)
+
+	configCommitMessageCmd.AddCommand(configCommitMessageSetCmd)
+	configCommitMessageCmd.AddCommand(configCommitMessageGetCmd)
+	configCommitMessageCmd.AddCommand(configCommitMessageResetCmd)
+
+	configChangeBudgetCmd.AddCommand(configChangeBudgetSetCmd)
+	configChangeBudgetCmd.AddCommand(configChangeBudgetGetCmd)
+	configChangeBudgetCmd.AddCommand(configChangeBudgetResetCmd)
+	configTaskCmd.AddCommand(configTaskSetCmd)
+	configTaskCmd.AddCommand(configTaskRemoveCmd)
+	configTaskCmd.AddCommand(configTaskListCmd)
+	configTaskCmd.AddCommand(configTaskClearCmd)
+	configServiceCmd.AddCommand(configServiceSetCmd)
+	configServiceCmd.AddCommand(configServiceRemoveCmd)
+	configServiceCmd.AddCommand(configServiceListCmd)
+	configServiceCmd.AddCommand(configServiceClearCmd)
+	configResourceGuardCmd.AddCommand(configResourceGuardSetCmd)
+	configResourceGuardCmd.AddCommand(configResourceGuardGetCmd)
+	configResourceGuardCmd.AddCommand(configResourceGuardResetCmd)
+	configResourcesCmd.AddCommand(configResourcesSetCmd)
+	configResourcesCmd.AddCommand(configResourcesGetCmd)
+	configResourcesCmd.AddCommand(configResourcesResetCmd)
+	configCommandTimeoutCmd.AddCommand(configCommandTimeoutSetCmd)
+	configCommandTimeoutCmd.AddCommand(configCommandTimeoutGetCmd)
+	configCommandTimeoutCmd.AddCommand(configCommandTimeoutResetCmd)
+	configQuotaCmd.AddCommand(configQuotaSetCmd)
+	configQuotaCmd.AddCommand(configQuotaGetCmd)
+	configQuotaCmd.AddCommand(configQuotaResetCmd)
+	configRetryCmd.AddCommand(configRetrySetCmd)
+	configRetryCmd.AddCommand(configRetryGetCmd)
+	configRetryCmd.AddCommand(configRetryResetCmd)
+
+	configDockerCmd.AddCommand(configDockerEnableCmd)
+	configDockerCmd.AddCommand(configDockerDisableCmd)
+	configDockerCmd.AddCommand(configDockerGetCmd)
+
+	configDockerCredentialsCmd.AddCommand(configDockerCredentialsEnableCmd)
+	configDockerCredentialsCmd.AddCommand(configDockerCredentialsDisableCmd)
+	configDockerCredentialsCmd.AddCommand(configDockerCredentialsGetCmd)
+	configHardenedCmd.AddCommand(configHardenedEnableCmd)
+	configHardenedCmd.AddCommand(configHardenedDisableCmd)
+	configHardenedCmd.AddCommand(configHardenedGetCmd)
+
+	configAutoInstallCmd.AddCommand(configAutoInstallEnableCmd)
+	configAutoInstallCmd.AddCommand(configAutoInstallDisableCmd)
+	configAutoInstallCmd.AddCommand(configAutoInstallGetCmd)
+
+	configMetadataRepoCmd.AddCommand(configMetadataRepoSetCmd)
+	configMetadataRepoCmd.AddCommand(configMetadataRepoGetCmd)
+	configMetadataRepoCmd.AddCommand(configMetadataRepoResetCmd)
+
+	configSuggesterCmd.AddCommand(configSuggesterSetCmd)
+	configSuggesterCmd.AddCommand(configSuggesterGetCmd)
+	configSuggesterCmd.AddCommand(configSuggesterResetCmd)
+
+	configTrustCmd.Flags().BoolP("yes", "y", false, "Trust without asking")
+	configTrustCmd.AddCommand(configTrustListCmd)
+	configTrustCmd.AddCommand(configTrustResetCmd)
+
+	configCoverageCommandCmd.AddCommand(configCoverageCommandSetCmd)
+	configCoverageCommandCmd.AddCommand(configCoverageCommandGetCmd)
+	configCoverageCommandCmd.AddCommand(configCoverageCommandResetCmd)
+
+	configGitIdentityCmd.AddCommand(configGitIdentitySetCmd)
+	configGitIdentityCmd.AddCommand(configGitIdentityGetCmd)
+	configGitIdentityCmd.AddCommand(configGitIdentityResetCmd)
+
+	configCloneCmd.AddCommand(configCloneSetCmd)
+	configCloneCmd.AddCommand(configCloneGetCmd)
+	configCloneCmd.AddCommand(configCloneResetCmd)
+
 	// Add object commands to config
 	configCmd.AddCommand(configBaseImageCmd)
+	configCmd.AddCommand(configFeatureCmd)
 	configCmd.AddCommand(configSetupCommandCmd)
 	configCmd.AddCommand(configInstallCommandCmd)
+	configCmd.AddCommand(configSnapshotPathCmd)
 	configCmd.AddCommand(configEnvCmd)
 	configCmd.AddCommand(configSecretCmd)
+	configCmd.AddCommand(configDNSCmd)
+	configCmd.AddCommand(configHostCmd)
+	configCmd.AddCommand(configHostFileCmd)
+	configCmd.AddCommand(configNamingCmd)
+	configCmd.AddCommand(configCommitMessageCmd)
+	configCmd.AddCommand(configGitIdentityCmd)
+	configCmd.AddCommand(configDockerCmd)
+	configCmd.AddCommand(configDockerCredentialsCmd)
+	configCmd.AddCommand(configHardenedCmd)
+	configCmd.AddCommand(configAutoInstallCmd)
+	configCmd.AddCommand(configSuggesterCmd)
+	configCmd.AddCommand(configTrustCmd)
+	configCmd.AddCommand(configMetadataRepoCmd)
+	configCmd.AddCommand(configCoverageCommandCmd)
+	configCmd.AddCommand(configChangeBudgetCmd)
+	configCmd.AddCommand(configTaskCmd)
+	configCmd.AddCommand(configServiceCmd)
+	configCmd.AddCommand(configResourceGuardCmd)
+	configCmd.AddCommand(configRetryCmd)
+	configCmd.AddCommand(configQuotaCmd)
+	configCmd.AddCommand(configResourcesCmd)
+	configCmd.AddCommand(configCommandTimeoutCmd)
+	configCmd.AddCommand(configCloneCmd)
 	configCmd.AddCommand(configShowCmd)
 	configCmd.AddCommand(configImportCmd)
 
+	configSyncCmd.Flags().String("source", "", "Git URL or oci:// image reference to sync from")
+	configSyncCmd.Flags().String("ref", "", "Git branch or tag to sync from")
+	configSyncCmd.Flags().String("path", "", "Path of the configuration in the source")
+	configSyncCmd.Flags().Bool("dry-run", false, "Show the upstream changes without syncing them")
+	configSyncCmd.Flags().Bool("unlink", false, "Stop syncing, keeping the current settings in the repository's configuration")
+	configSyncCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(configSyncCmd, &repository.UpstreamSync{})
+	configSyncCmd.MarkFlagsMutuallyExclusive("unlink", "source")
+	configSyncCmd.MarkFlagsMutuallyExclusive("unlink", "dry-run")
+	configCmd.AddCommand(configSyncCmd)
+
 	// Add agent command
 	configCmd.AddCommand(agent.AgentCmd)
 
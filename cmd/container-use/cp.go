@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp <env>:<path> <local-path> | cp <local-path> <env>:<path>",
+	Short: "Copy files between the host and an environment",
+	Long: `Copy a file or directory between the host and an environment's container,
+like 'docker cp'. Paths in the environment are relative to its workdir unless
+absolute. A directory at the destination receives the copy under the source's
+name.
+
+Copies into an environment are committed to its branch, like changes made by
+commands. Copies out of an environment leave it as it was.`,
+	Args: cobra.ExactArgs(2),
+	Example: `# Bring a log file out of an environment
+container-use cp fancy-mallard:build/output.log .
+
+# Copy a fixture into an environment
+container-use cp testdata/fixture.json fancy-mallard:testdata/
+
+# Copy a directory out of an environment
+container-use cp fancy-mallard:/tmp/screenshots ./screenshots`,
+	RunE: func(app *cobra.Command, args []string) (rerr error) {
+		ctx := app.Context()
+
+		srcEnv, srcPath := parseCopyPath(args[0])
+		dstEnv, dstPath := parseCopyPath(args[1])
+		switch {
+		case srcEnv != "" && dstEnv != "":
+			return errors.New("copying between environments isn't supported, copy through the host")
+		case srcEnv == "" && dstEnv == "":
+			return errors.New("one of the paths must be in an environment, as <env>:<path>")
+		}
+		envID := srcEnv + dstEnv
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+
+		if srcEnv != "" {
+			env, err := repo.Get(ctx, dag, envID)
+			if err != nil {
+				return fmt.Errorf("failed to load environment: %w", err)
+			}
+			copied, err := env.CopyToHost(ctx, srcPath, dstPath)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Copied %s to %s\n", args[0], copied)
+			return nil
+		}
+
+		noWait, _ := app.Flags().GetBool("no-wait")
+		slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+		if err != nil {
+			return err
+		}
+		defer slot.Release()
+
+		operationStartedAt := time.Now()
+		defer func() { repo.RecordOperation(envID, "cp", repository.OperationSourceCLI, operationStartedAt, rerr) }()
+
+		env, err := repo.Get(ctx, dag, envID)
+		if err != nil {
+			return fmt.Errorf("failed to load environment: %w", err)
+		}
+		copied, err := env.CopyFromHost(ctx, srcPath, dstPath)
+		if err != nil {
+			return err
+		}
+		if err := repo.Update(ctx, env, fmt.Sprintf("Copy %s from the host", filepath.Base(srcPath))); err != nil {
+			return fmt.Errorf("copied but failed to update repository: %w", err)
+		}
+		fmt.Printf("Copied %s to %s:%s\n", srcPath, envID, copied)
+		return nil
+	},
+}
+
+// parseCopyPath splits an <env>:<path> argument of cp, returning an empty environment for host paths. Like
+// docker cp, arguments whose colon follows a path separator, and Windows drive letters, are host paths.
+func parseCopyPath(arg string) (envID, path string) {
+	envID, path, found := strings.Cut(arg, ":")
+	if !found || envID == "" || len(filepath.VolumeName(arg)) > 0 || strings.ContainsAny(envID, `/\`) {
+		return "", arg
+	}
+	return envID, path
+}
+
+func init() {
+	cpCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if a command is running in the environment")
+	rootCmd.AddCommand(cpCmd)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCopyPath(t *testing.T) {
+	tests := []struct {
+		arg   string
+		envID string
+		path  string
+	}{
+		{arg: "fancy-mallard:build/output.log", envID: "fancy-mallard", path: "build/output.log"},
+		{arg: "fancy-mallard:/tmp", envID: "fancy-mallard", path: "/tmp"},
+		{arg: "fancy-mallard:", envID: "fancy-mallard", path: ""},
+		{arg: "output.log", path: "output.log"},
+		{arg: "./notes:today.txt", path: "./notes:today.txt"},
+		{arg: "/tmp/a:b", path: "/tmp/a:b"},
+		{arg: ":output.log", path: ":output.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			envID, path := parseCopyPath(tt.arg)
+			assert.Equal(t, tt.envID, envID)
+			assert.Equal(t, tt.path, path)
+		})
+	}
+}
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
 
-	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/messages"
 	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var createCmd = &cobra.Command{
@@ -16,10 +28,65 @@ var createCmd = &cobra.Command{
 	Short: "Create a new containerized environment",
 	Long: `Create a new development environment in a container.
 The environment is created from a git reference (defaults to HEAD) and includes
-the configured base image and setup commands.
+the configured base image and setup commands. A reference the repository doesn't
+have, such as origin/feature-x, is fetched from its remote with your git
+credentials, and the commit it resolved to is recorded in the environment.
 
 The title describes the work that will be done in this environment. You can
-provide it as a positional argument or via the --title flag.`,
+provide it as a positional argument or via the --title flag. Without a title,
+the configured suggester (see 'container-use config suggester') proposes a
+title and labels from the recent commits and the --task description, so
+automations don't have to come up with one.
+
+Environment IDs are generated following the naming configuration, unless --id
+requests a specific one. Creating an environment with the ID of an existing one
+fails; the leftovers of an interrupted creation of that ID are cleaned up instead.
+
+Uncommitted changes aren't included unless --include-uncommitted selects their
+categories: staged, unstaged (tracked files changed but not staged), untracked,
+and ignored (only the files environments usually need, such as .env files), or
+all. Without categories, it includes staged, unstaged and untracked changes.
+They're recorded in a commit on top of HEAD, leaving your index and working tree
+alone. The JSON output lists the uncommitted changes by category, with those
+included and excluded.
+
+With --template, the environment is created from an environment template of the
+repository: a .container-use/templates/<name>.json file with a "description" and
+the "config" settings it layers on the repository's configuration, such as a
+base image with its setup commands, secrets and services. Settings the template
+has replace the repository's. --list-templates lists the templates.
+
+Environment variables can be set with --env-var KEY=VALUE and --env-file (a
+dotenv file), in addition to the configured variables, which they override.
+They're kept in the environment's configuration, so its setup commands and all
+its commands get them, but not in the repository's. --env-var KEY passes the
+host's value of KEY.
+
+With --depends-on <env>[:<path>][=<target>], the environment consumes an output
+of another environment: the file or directory at path in its container, relative
+to its workdir, or the files of its branch tip without a path. It's copied to
+target, by default /deps/<env> (or /deps/<env>/<base name of path>), when the
+environment is created; 'container-use deps --refresh' copies it again.
+
+With --dockerfile, the base container is built from a Containerfile (or
+Dockerfile) of the repository instead of pulling the configured base image, with
+the repository root as build context. A directory detects the Containerfile in
+it, or in its .devcontainer directory: --dockerfile . for the repository's. The
+Containerfile of the ref the environment is created from is built, so it must be
+committed, or included with --include-uncommitted. To build it for every
+environment, with a target or build arguments, see 'container-use config
+base-image build'.
+
+When created from a ref other than HEAD, the output tells how far the ref has
+diverged from your current branch, and warns when it lacks commits of the branch:
+the agent would work against older code than yours.
+
+With --plan, nothing is created: the resolved configuration, the commit of the
+ref, the ID and branch the environment would get, the digest and size of the base
+image, and the setup commands are output as JSON, without connecting to the
+container runtime. Orchestrators can validate and present a creation before
+spending minutes building it. Generated IDs may differ on creation, unless
+requested with --id.`,
 	Args: cobra.MaximumNArgs(1),
 	Example: `# Create environment with title as argument
 container-use create "Fix authentication bug"
@@ -27,13 +94,55 @@ container-use create "Fix authentication bug"
 # Create from a specific branch
 container-use create "Add new feature" --from-ref main
 
+# Create from a branch a teammate just pushed, fetching it
+container-use create "Review the new parser" --from-ref origin/feature-x
+
 # Create with title as flag
 container-use create --title "Refactor database layer"
 
+# Create with a specific ID
+container-use create "Fix login redirect" --id fix-login
+
+# Let the suggester title and label the environment
+container-use create --task "Users get logged out when their session refreshes"
+
+# Create an environment from the repository's "postgres" template
+container-use create "Fix the slow report query" --template postgres
+
+# Create an environment with the variables of a dotenv file, and a debug flag
+container-use create "Fix the payment webhook" --env-file .env.test -e DEBUG=1
+
+# Create an end-to-end test environment with the binary a build environment produces
+container-use create "Test the login flow" --depends-on build-server:bin/server=/usr/local/bin/server
+
+# Build the base container from the repository's Dockerfile
+container-use create "Fix the flaky test" --dockerfile ./Dockerfile
+
+# Build it from the Containerfile detected in the repository, e.g. .devcontainer/Dockerfile
+container-use create "Fix the flaky test" --dockerfile .
+
+# Create a hardened environment to run untrusted code
+container-use create "Try the generated migration" --hardened
+
+# Include everything that isn't committed, .env files too
+container-use create "Fix the flaky test" --include-uncommitted=all
+
+# Show what creating the environment would do, without creating it
+container-use create "Update dependencies" --plan
+
 # Create and output as JSON
-container-use create "Update dependencies" --json`,
-	RunE: func(app *cobra.Command, args []string) error {
+container-use create "Update dependencies" --json
+
+# Stream progress events as NDJSON
+container-use create "Update dependencies" --json-stream`,
+	RunE: func(app *cobra.Command, args []string) (rerr error) {
 		ctx := app.Context()
+		stream := jsonStreamFromFlags(app, os.Stdout)
+		defer func() { stream.Fail(rerr) }()
+
+		if list, _ := app.Flags().GetBool("list-templates"); list {
+			return listEnvironmentTemplates(ctx)
+		}
 
 		// Resolve title from positional argument or flag
 		title := ""
@@ -46,10 +155,6 @@ container-use create "Update dependencies" --json`,
 			title = flagTitle
 		}
 
-		if title == "" {
-			return fmt.Errorf("title is required: provide it as an argument or use --title flag")
-		}
-
 		// Get flags
 		fromRef, _ := app.Flags().GetString("from-ref")
 		if fromRef == "" {
@@ -57,68 +162,189 @@ container-use create "Update dependencies" --json`,
 		}
 
 		jsonOutput, _ := app.Flags().GetBool("json")
+		labels, _ := app.Flags().GetStringSlice("label")
+
+		// Open repository
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
 
-		// Connect to Dagger
-		slog.Info("connecting to dagger")
+		templateName, _ := app.Flags().GetString("template")
+		if templateName != "" {
+			// Unknown or invalid templates fail before anything is created.
+			if _, err := environment.LoadEnvironmentTemplate(repo.SourcePath(), templateName); err != nil {
+				return fmt.Errorf("%w: see 'container-use create --list-templates'", err)
+			}
+		}
 
-		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+		vars, err := envVariablesFromFlags(app)
 		if err != nil {
-			slog.Error("Error starting dagger", "error", err)
+			return err
+		}
 
-			if isDockerDaemonError(err) {
-				handleDockerDaemonError()
+		specs, _ := app.Flags().GetStringArray("depends-on")
+		var deps []*environment.Dependency
+		var pinned []string
+		for _, spec := range specs {
+			dep, err := environment.ParseDependency(spec)
+			if err != nil {
+				return err
+			}
+			deps = append(deps, dep)
+			if dep.Path != "" {
+				pinned = append(pinned, dep.Environment)
 			}
+		}
 
-			return fmt.Errorf("failed to connect to dagger: %w", err)
+		if title == "" {
+			task, _ := app.Flags().GetString("task")
+			suggestion, err := repo.SuggestTitle(ctx, fromRef, task)
+			if errors.Is(err, repository.ErrNoSuggester) {
+				return fmt.Errorf("title is required: provide it as an argument or use --title flag, or configure a suggester with 'container-use config suggester set'")
+			}
+			if err != nil {
+				return fmt.Errorf("failed to suggest a title: %w", err)
+			}
+			title = suggestion.Title
+			labels = append(labels, suggestion.Labels...)
+			stream.Emit("title_suggested", map[string]any{"title": suggestion.Title, "labels": suggestion.Labels})
+			if stream == nil && !jsonOutput {
+				fmt.Fprintf(os.Stderr, "Suggested title: %s\n", title)
+			}
 		}
-		defer dag.Close()
 
-		// Open repository
-		repo, err := repository.Open(ctx, ".")
+		var included []string
+		if app.Flags().Changed("include-uncommitted") {
+			categories, _ := app.Flags().GetStringSlice("include-uncommitted")
+			if included, err = repository.ParseUncommittedCategories(categories); err != nil {
+				return err
+			}
+			if fromRef != "HEAD" {
+				return errors.New("--include-uncommitted only applies to environments created from HEAD")
+			}
+			commit, err := repo.CommitUncommitted(ctx, included)
+			if err != nil {
+				return fmt.Errorf("failed to include uncommitted changes: %w", err)
+			}
+			if commit != "" {
+				fromRef = commit
+			}
+		}
+
+		if app.Flags().Changed("dockerfile") {
+			dockerfile, _ := app.Flags().GetString("dockerfile")
+			build, err := containerfileBuild(ctx, repo, dockerfile, fromRef)
+			if err != nil {
+				return err
+			}
+			config := environment.DefaultConfig()
+			if err := config.Load(repo.SourcePath()); err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+			config.BaseBuild = build
+			ctx = repository.WithConfig(ctx, config)
+		}
+
+		if len(vars) > 0 {
+			ctx = repository.WithEnvVariables(ctx, vars)
+		}
+		if len(deps) > 0 {
+			ctx = repository.WithDependencies(ctx, deps)
+		}
+		if hardened, _ := app.Flags().GetBool("hardened"); hardened {
+			ctx = repository.WithHardened(ctx)
+		}
+		if app.Flags().Changed("cpus") || app.Flags().Changed("memory") || app.Flags().Changed("disk") {
+			limits, err := resourceLimitsFromFlags(app)
+			if err != nil {
+				return err
+			}
+			ctx = repository.WithResourceLimits(ctx, limits)
+		}
+		if templateName != "" {
+			ctx = repository.WithTemplate(ctx, templateName)
+		}
+		if len(labels) > 0 {
+			ctx = repository.WithLabels(ctx, labels)
+		}
+		requestedID, _ := app.Flags().GetString("id")
+
+		if plan, _ := app.Flags().GetBool("plan"); plan {
+			// Plans never connect to an engine: they're resolved from the repository and registries.
+			plan, err := repo.Plan(ctx, requestedID, title, fromRef)
+			if err != nil {
+				return fmt.Errorf("failed to plan environment: %w", err)
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(plan); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+			return nil
+		}
+
+		pool, err := newEnginePool(logWriter)
 		if err != nil {
-			return fmt.Errorf("failed to open repository: %w", err)
+			return err
+		}
+		defer pool.Close()
+		// Environments copying files of the containers of others are hosted by the same engine.
+		ctx, dag, err := pool.ScheduleWith(ctx, repo, pinned)
+		if err != nil {
+			return err
 		}
+		stream.Emit("connected", nil)
 
 		// Create environment
 		slog.Info("creating environment", "title", title, "from_ref", fromRef)
 
-		env, err := repo.Create(ctx, dag, title, "", fromRef)
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			ctx = repository.WithHostFilePrompt(ctx, promptHostFile)
+			ctx = repository.WithInputPrompt(ctx, promptInput)
+		}
+		if stream != nil {
+			ctx = repository.WithProgress(ctx, stream.Emit)
+		} else if !jsonOutput && term.IsTerminal(int(os.Stderr.Fd())) {
+			ctx = repository.WithProgress(ctx, newPullProgress(os.Stderr).Handle)
+		}
+		env, err := repo.CreateWithID(ctx, dag, requestedID, title, "", fromRef)
 		if err != nil {
 			return fmt.Errorf("failed to create environment: %w", err)
 		}
 
+		var divergence *repository.Divergence
+		if len(included) == 0 && fromRef != "HEAD" {
+			// The ref may only exist on a remote: it was fetched, compare its commit.
+			if divergence, err = repo.Divergence(ctx, env.State.Source.Commit); err != nil {
+				slog.Warn("failed to compare the ref with HEAD", "ref", fromRef, "err", err)
+			} else {
+				divergence.Ref = fromRef
+			}
+		}
+
 		// Check for uncommitted changes
-		dirty, status, err := repo.IsDirty(ctx)
+		changes, err := repo.UncommittedChanges(ctx)
 		if err != nil {
 			return fmt.Errorf("unable to check if repository is dirty: %w", err)
 		}
+		uncommitted := &uncommittedOutput{UncommittedChanges: changes, Included: included, Excluded: changes.Excluded(included)}
+		var status string
+		if len(uncommitted.Excluded) > 0 {
+			if _, status, err = repo.IsDirty(ctx); err != nil {
+				return fmt.Errorf("unable to check if repository is dirty: %w", err)
+			}
+		}
 
 		// Output based on format
+		if stream != nil {
+			stream.Result(createOutput(env, divergence, uncommitted, status))
+			return nil
+		}
 		if jsonOutput {
-			// JSON output
-			output := map[string]interface{}{
-				"id":              env.ID,
-				"title":           env.State.Title,
-				"remote_ref":      fmt.Sprintf("container-use/%s", env.ID),
-				"checkout_command": fmt.Sprintf("container-use checkout %s", env.ID),
-				"log_command":     fmt.Sprintf("container-use log %s", env.ID),
-				"diff_command":    fmt.Sprintf("container-use diff %s", env.ID),
-				"config": map[string]interface{}{
-					"base_image":       env.State.Config.BaseImage,
-					"workdir":          env.State.Config.Workdir,
-					"setup_commands":   env.State.Config.SetupCommands,
-					"install_commands": env.State.Config.InstallCommands,
-				},
-			}
-
-			if dirty {
-				output["warning"] = "Repository has uncommitted changes that are NOT included in this environment"
-				output["uncommitted_changes"] = status
-			}
-
 			enc := json.NewEncoder(os.Stdout)
 			enc.SetIndent("", "  ")
-			if err := enc.Encode(output); err != nil {
+			if err := enc.Encode(createOutput(env, divergence, uncommitted, status)); err != nil {
 				return fmt.Errorf("failed to encode JSON: %w", err)
 			}
 
@@ -126,50 +352,283 @@ container-use create "Update dependencies" --json`,
 		}
 
 		// Standard output
-		fmt.Printf("Environment created: %s\n", env.ID)
+		fmt.Println(messages.Get("create.created", env.ID))
 		fmt.Println()
-		fmt.Println("Configuration:")
-		fmt.Printf("  Base Image: %s\n", env.State.Config.BaseImage)
-		fmt.Printf("  Workdir: %s\n", env.State.Config.Workdir)
+		fmt.Println(messages.Get("create.configuration"))
+		fmt.Printf("  %s\n", messages.Get("create.base_image", env.State.Config.BaseImageDescription()))
+		fmt.Printf("  %s\n", messages.Get("create.workdir", env.State.Config.Workdir))
+		if len(env.State.Labels) > 0 {
+			fmt.Printf("  %s\n", messages.Get("create.labels", strings.Join(env.State.Labels, ", ")))
+		}
+		if env.State.Config.Hardened {
+			fmt.Printf("  %s\n", messages.Get("create.hardened"))
+		}
+		if !env.State.Config.Resources.IsZero() {
+			fmt.Printf("  %s\n", messages.Get("create.resources", describeResourceLimits(env.State.Config.Resources)))
+		}
+		if divergence != nil {
+			fmt.Printf("  %s\n", messages.Get("create.from_ref", divergence.Ref, divergence.Commit[:min(len(divergence.Commit), 7)], divergence.Ahead, divergence.Behind, cmp.Or(divergence.Branch, "HEAD")))
+			if env.State.Source.Remote != "" {
+				fmt.Printf("  %s\n", messages.Get("create.from_ref_fetched", env.State.Source.Remote, cmp.Or(env.State.Source.RemoteURL, env.State.Source.Remote)))
+			}
+			fmt.Printf("  %s\n", messages.Get("create.from_ref_last_commit", divergence.LastCommit.Subject, divergence.LastCommit.Author, humanize.Time(divergence.LastCommit.Time)))
+		}
+		if env.State.Engine != "" {
+			fmt.Printf("  %s\n", messages.Get("create.engine", env.State.Engine))
+		}
+		if env.State.Template != "" {
+			fmt.Printf("  %s\n", messages.Get("create.template", env.State.Template))
+		}
+		for _, dep := range env.State.Dependencies {
+			fmt.Printf("  %s\n", messages.Get("create.dependency", dep))
+		}
 
 		if len(env.State.Config.SetupCommands) > 0 {
-			fmt.Printf("  Setup Commands: %d\n", len(env.State.Config.SetupCommands))
+			fmt.Printf("  %s\n", messages.Get("create.setup_commands", len(env.State.Config.SetupCommands)))
 		}
 
 		if len(env.State.Config.InstallCommands) > 0 {
-			fmt.Printf("  Install Commands: %d\n", len(env.State.Config.InstallCommands))
+			fmt.Printf("  %s\n", messages.Get("create.install_commands", len(env.State.Config.InstallCommands)))
 		}
 
 		envCount := len(env.State.Config.Env.Keys())
 		if envCount > 0 {
-			fmt.Printf("  Environment Variables: %d\n", envCount)
+			fmt.Printf("  %s\n", messages.Get("create.env_variables", envCount))
 		}
 
 		fmt.Println()
-		fmt.Println("Next steps:")
-		fmt.Printf("  View logs:       container-use log %s\n", env.ID)
-		fmt.Printf("  View changes:    container-use diff %s\n", env.ID)
-		fmt.Printf("  Checkout branch: container-use checkout %s\n", env.ID)
+		fmt.Println(messages.Get("next.steps"))
+		printNextStep(os.Stdout, "next.view_logs", "container-use log "+env.ID)
+		printNextStep(os.Stdout, "next.view_changes", "container-use diff "+env.ID)
+		printNextStep(os.Stdout, "next.checkout", "container-use checkout "+env.ID)
 
-		if dirty {
+		if divergence != nil && divergence.Stale() {
 			fmt.Println()
-			fmt.Printf("⚠️  WARNING: The repository has uncommitted changes that are NOT included in this environment.\n")
-			fmt.Println("   The environment was created from the last committed state only.")
+			fmt.Println(messages.Get("create.from_ref_stale", divergence.Ref, divergence.Behind, cmp.Or(divergence.Branch, "HEAD")))
+		}
+		if included := uncommitted.describe(uncommitted.Included); included != "" {
+			fmt.Println()
+			fmt.Println(messages.Get("create.included_uncommitted", included))
+		}
+		if len(uncommitted.Excluded) > 0 {
+			fmt.Println()
+			fmt.Println(messages.Get("create.uncommitted_warning", uncommitted.describe(uncommitted.Excluded)))
 			fmt.Println()
-			fmt.Println("Uncommitted changes detected:")
+			fmt.Println(messages.Get("create.uncommitted_detected"))
 			fmt.Println(status)
 			fmt.Println()
-			fmt.Println("To include these changes, commit them first using git.")
+			fmt.Println(messages.Get("create.include_hint", strings.Join(uncommitted.Excluded, ",")))
+		}
+		if len(uncommitted.Ignored) > 0 && !slices.Contains(uncommitted.Included, repository.UncommittedIgnored) {
+			fmt.Println()
+			fmt.Println(messages.Get("create.ignored_hint", strings.Join(uncommitted.Ignored, ", ")))
 		}
 
 		return nil
 	},
 }
 
+// containerfileBuild returns the build of the Containerfile at path, or detected in the directory at path, for
+// an environment created from ref. Relative paths are relative to the current directory.
+func containerfileBuild(ctx context.Context, repo *repository.Repository, path, ref string) (*environment.BaseBuildConfig, error) {
+	root, err := filepath.EvalSymlinks(repo.SourcePath())
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, fmt.Errorf("containerfile not found: %w", err)
+	}
+	if info, err := os.Stat(abs); err == nil && info.IsDir() {
+		detected, err := environment.DetectContainerfile(abs)
+		if err != nil {
+			return nil, err
+		}
+		abs = filepath.Join(abs, detected)
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("the Containerfile %s must be in the repository", path)
+	}
+
+	build := &environment.BaseBuildConfig{Containerfile: filepath.ToSlash(rel)}
+	if err := build.Validate(); err != nil {
+		return nil, err
+	}
+	// Refs that are only on a remote are fetched when the environment is created.
+	if _, err := repository.RunGitCommand(ctx, root, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+		if _, err := repository.RunGitCommand(ctx, root, "cat-file", "-e", ref+":"+build.Containerfile); err != nil {
+			return nil, fmt.Errorf("%s isn't committed in %s: commit it, or include it with --include-uncommitted", build.Containerfile, ref)
+		}
+	}
+	return build, nil
+}
+
+// listEnvironmentTemplates prints the environment templates of the repository.
+func listEnvironmentTemplates(ctx context.Context) error {
+	repo, err := repository.Open(ctx, ".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	templates, err := environment.EnvironmentTemplates(repo.SourcePath())
+	if err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		fmt.Printf("No environment templates: add them to %s as <name>.json files.\n", environment.EnvironmentTemplatesDir(repo.SourcePath()))
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "TEMPLATE\tDESCRIPTION")
+	for _, tmpl := range templates {
+		fmt.Fprintf(tw, "%s\t%s\n", tmpl.Name, tmpl.Description)
+	}
+	return tw.Flush()
+}
+
+// suggestEnvironmentTemplates completes the names of the environment templates of the repository.
+func suggestEnvironmentTemplates(app *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	repo, err := repository.Open(app.Context(), ".")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	templates, _ := environment.EnvironmentTemplates(repo.SourcePath())
+	names := make([]string, 0, len(templates))
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// uncommittedOutput describes the uncommitted changes of the repository when an environment was created.
+type uncommittedOutput struct {
+	*repository.UncommittedChanges
+	// Included are the categories included in the environment, Excluded those with changes that weren't.
+	Included []string `json:"included"`
+	Excluded []string `json:"excluded"`
+}
+
+// describe counts the changed files of categories, e.g. "2 staged, 1 untracked".
+func (u *uncommittedOutput) describe(categories []string) string {
+	var counts []string
+	for _, category := range categories {
+		if files := u.Files(category); len(files) > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", len(files), category))
+		}
+	}
+	return strings.Join(counts, ", ")
+}
+
+// createResult is the JSON description of a created environment.
+type createResult struct {
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Labels          []string `json:"labels"`
+	RemoteRef       string   `json:"remote_ref"`
+	CheckoutCommand string   `json:"checkout_command"`
+	LogCommand      string   `json:"log_command"`
+	DiffCommand     string   `json:"diff_command"`
+	// Engine is the engine of the pool hosting the environment, if any.
+	Engine string `json:"engine,omitempty"`
+	// Template is the environment template the environment was created from, if any.
+	Template string `json:"template,omitempty"`
+	// Dependencies are the outputs of other environments copied into the environment, if any.
+	Dependencies []*environment.Dependency `json:"dependencies,omitempty"`
+	// Source is the ref the environment was created from and its commit, fetched from a remote if needed.
+	Source *environment.Source `json:"source"`
+	// FromRef tells how the ref the environment was created from diverges from HEAD, unless it's HEAD.
+	FromRef *repository.Divergence `json:"from_ref,omitempty"`
+	Config  struct {
+		BaseImage       string                       `json:"base_image"`
+		BaseBuild       *environment.BaseBuildConfig `json:"base_build"`
+		Workdir         string                       `json:"workdir"`
+		SetupCommands   []string                     `json:"setup_commands"`
+		InstallCommands []string                     `json:"install_commands"`
+		Hardened        bool                         `json:"hardened"`
+		Resources       *environment.ResourceLimits  `json:"resources,omitempty"`
+	} `json:"config"`
+	Uncommitted *uncommittedOutput `json:"uncommitted"`
+	// Warning and UncommittedChanges are set when the repository has changes the environment doesn't include.
+	Warning            string `json:"warning,omitempty"`
+	UncommittedChanges string `json:"uncommitted_changes,omitempty"`
+}
+
+func createOutput(env *environment.Environment, divergence *repository.Divergence, uncommitted *uncommittedOutput, status string) *createResult {
+	output := &createResult{
+		ID:              env.ID,
+		Title:           env.State.Title,
+		Labels:          env.State.Labels,
+		RemoteRef:       fmt.Sprintf("container-use/%s", env.ID),
+		CheckoutCommand: fmt.Sprintf("container-use checkout %s", env.ID),
+		LogCommand:      fmt.Sprintf("container-use log %s", env.ID),
+		DiffCommand:     fmt.Sprintf("container-use diff %s", env.ID),
+		Engine:          env.State.Engine,
+		Template:        env.State.Template,
+		Dependencies:    env.State.Dependencies,
+		FromRef:         divergence,
+		Source:          env.State.Source,
+	}
+	output.Config.BaseImage = env.State.Config.BaseImage
+	output.Config.BaseBuild = env.State.Config.BaseBuild
+	output.Config.Workdir = env.State.Config.Workdir
+	output.Config.SetupCommands = env.State.Config.SetupCommands
+	output.Config.InstallCommands = env.State.Config.InstallCommands
+	output.Config.Hardened = env.State.Config.Hardened
+	output.Config.Resources = env.State.Config.Resources
+
+	if uncommitted.Included == nil {
+		uncommitted.Included = []string{}
+	}
+	if uncommitted.Excluded == nil {
+		uncommitted.Excluded = []string{}
+	}
+	output.Uncommitted = uncommitted
+	if len(uncommitted.Excluded) > 0 {
+		output.Warning = "Repository has uncommitted changes that are NOT included in this environment"
+		output.UncommittedChanges = status
+	}
+	return output
+}
+
+// promptHostFile asks on the terminal whether to provide a host file to a new environment.
+func promptHostFile(_ context.Context, _ *repository.Repository, envID string, file *environment.HostFile) (bool, error) {
+	fmt.Fprintf(os.Stderr, "Provide host file %s to environment %s? [y/N] ", file, envID)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
 func init() {
 	createCmd.Flags().StringP("title", "t", "", "Title describing the work in this environment")
-	createCmd.Flags().StringP("from-ref", "r", "HEAD", "Git reference to create the environment from (branch, tag, or SHA)")
+	createCmd.Flags().StringP("from-ref", "r", "HEAD", "Git reference to create the environment from (branch, tag, or SHA), fetched from its remote if missing")
+	createCmd.Flags().String("id", "", "ID of the environment (default: generated following the naming configuration)")
+	createCmd.Flags().String("task", "", "Description of the task, given to the suggester when no title is provided")
+	createCmd.Flags().StringSlice("label", nil, "Label the environment (repeatable)")
+	createCmd.Flags().StringSlice("include-uncommitted", nil, "Include uncommitted changes of these categories: staged, unstaged, untracked, ignored, or all")
+	createCmd.Flags().Lookup("include-uncommitted").NoOptDefVal = "staged,unstaged,untracked"
+	createCmd.Flags().String("template", "", "Environment template of the repository to create the environment from")
+	createCmd.RegisterFlagCompletionFunc("template", suggestEnvironmentTemplates)
+	createCmd.Flags().Bool("list-templates", false, "List the environment templates of the repository")
+	createCmd.Flags().StringArrayP("env-var", "e", nil, "Set an environment variable in the environment, as KEY=VALUE, or KEY to pass the host's (repeatable)")
+	createCmd.Flags().StringArray("env-file", nil, "Set the environment variables of a dotenv file in the environment (repeatable)")
+	createCmd.Flags().StringArray("depends-on", nil, "Copy an output of another environment, as <env>[:<path>][=<target>] (repeatable)")
+	createCmd.Flags().String("dockerfile", "", "Build the base container from this Containerfile of the repository, or the one detected in this directory")
+	createCmd.Flags().Bool("hardened", false, "Run the agent's commands unprivileged, for untrusted code (see 'container-use config hardened')")
+	createCmd.Flags().Float64("cpus", 0, "Advisory CPU limit: the number of CPUs the environment's commands start on, rounded up (see 'container-use config resources')")
+	createCmd.Flags().String("memory", "", "Advisory memory limit: the address space of each process of the environment's commands, e.g. 4GB")
+	createCmd.Flags().String("disk", "", "Advisory disk limit: the size of each file the environment's commands write, e.g. 10GB")
 	createCmd.Flags().Bool("json", false, "Output result as JSON")
+	createCmd.Flags().Bool("json-stream", false, "Output progress events and the result as newline-delimited JSON")
+	createCmd.Flags().Bool("plan", false, "Output what creating the environment would do as JSON, without creating it")
+	withSchema(createCmd, &createResult{}, &repository.CreatePlan{})
+	createCmd.MarkFlagsMutuallyExclusive("json", "json-stream")
+	createCmd.MarkFlagsMutuallyExclusive("plan", "json-stream")
 
 	rootCmd.AddCommand(createCmd)
 }
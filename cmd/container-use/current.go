@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var currentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Print the environment the current branch was checked out from",
+	Long: `Print the ID of the environment the current branch was checked out from
+with 'container-use checkout'. Commands taking an environment use it when
+none is given, e.g. 'container-use diff' on that branch.
+
+Fails if the current branch wasn't checked out from an existing environment.`,
+	Args: cobra.NoArgs,
+	Example: `# Which environment is this branch?
+container-use current
+
+# Use it in scripts
+container-use exec "$(container-use current)" "go test ./..."`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := repo.CurrentEnvironment(ctx)
+		if err != nil {
+			return err
+		}
+		if envID == "" {
+			return errors.New("the current branch wasn't checked out from an environment")
+		}
+		fmt.Println(envID)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(currentCmd)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/daemon"
+	"github.com/dagger/container-use/repository"
+	"github.com/dagger/container-use/webui"
+	"github.com/spf13/cobra"
+)
+
+// daemonEndpoint is the line the daemon prints once it listens, for the editor extension that started it.
+type daemonEndpoint struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Serve a JSON-RPC endpoint for editor extensions",
+	Long: `Serve a local JSON-RPC 2.0 endpoint for editor extensions, such as VS Code or
+JetBrains ones, so they list environments, follow their changes, open their
+diffs and run commands in them without starting the CLI for every action.
+
+Messages are framed like the Language Server Protocol, with a Content-Length
+header, so editors' JSON-RPC libraries speak it as they are. With --stdio, the
+endpoint is served on the standard input and output of the daemon, for the
+extension that started it. Otherwise it listens on a loopback address and prints
+it as JSON with a random token: connections must first call initialize with the
+token. The methods are documented in the CLI reference.`,
+	Example: `# Serve on a random loopback port, printing it with the token
+container-use daemon
+
+# Serve on the standard streams of the process
+container-use daemon --stdio`,
+	Args: cobra.NoArgs,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		// Engines are only connected to for the first command run in their environments.
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		clientFor := func(ctx context.Context, envID string) (*dagger.Client, error) {
+			return pool.ClientFor(ctx, repo, envID)
+		}
+
+		if stdio, _ := app.Flags().GetBool("stdio"); stdio {
+			return daemon.New(repo, clientFor, "", version).ServeConn(ctx, os.Stdin, os.Stdout)
+		}
+
+		token, err := webui.NewToken()
+		if err != nil {
+			return fmt.Errorf("failed to generate access token: %w", err)
+		}
+		addr, _ := app.Flags().GetString("addr")
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(&daemonEndpoint{Addr: listener.Addr().String(), Token: token}); err != nil {
+			listener.Close()
+			return err
+		}
+		return daemon.New(repo, clientFor, token, version).Serve(ctx, listener)
+	},
+}
+
+func init() {
+	daemonCmd.Flags().String("addr", "127.0.0.1:0", "Address to listen on, a random loopback port by default")
+	daemonCmd.Flags().Bool("stdio", false, "Serve on the standard input and output instead of listening")
+	daemonCmd.MarkFlagsMutuallyExclusive("addr", "stdio")
+	rootCmd.AddCommand(daemonCmd)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+// engineTimeout bounds the time spent connecting to the Dagger engine for its diagnostics: a bundle is
+// most needed when the engine is broken.
+const engineTimeout = 30 * time.Second
+
+var debugBundleCmd = &cobra.Command{
+	Use:   "debug-bundle [<env>]",
+	Short: "Collect diagnostics of an environment for a bug report",
+	Long: `Collect diagnostics of an environment into a gzipped tar archive to attach to a
+bug report: its state and configuration, its event log (setup steps and commands
+with their durations), the notes of its last commits with the output of their
+commands, the end of the container-use and Dagger log, and information about the
+host (versions of container-use, git, Dagger and the container runtime).
+
+Secrets are scrubbed from every file: the values of variables whose names look
+secret, and well-known credentials such as tokens, keys and passwords in URLs.
+Review the archive before sharing it all the same. Files are truncated to keep
+the archive under --max-size, logs keeping their end.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Bundle the current environment
+container-use debug-bundle
+
+# Bundle the last 20 commands of an environment, up to 2MB
+container-use debug-bundle fancy-mallard --execs 20 --max-size 2MB -o bundle.tar.gz`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		execs, _ := app.Flags().GetInt("execs")
+		maxSize, _ := app.Flags().GetString("max-size")
+		maxBytes, err := humanize.ParseBytes(maxSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-size %q: %w", maxSize, err)
+		}
+
+		opts := repository.DebugBundleOptions{
+			Execs:    execs,
+			MaxBytes: int64(maxBytes),
+		}
+		host, err := json.MarshalIndent(collectHostInfo(ctx), "", "  ")
+		if err != nil {
+			return err
+		}
+		opts.Files = append(opts.Files, &repository.DebugBundleFile{Name: "host.json", Content: host})
+		if log, err := readRecentLogs(int64(maxBytes)); err == nil {
+			opts.Files = append(opts.Files, &repository.DebugBundleFile{Name: "container-use.log", Content: log, KeepTail: true})
+		}
+
+		output, _ := app.Flags().GetString("output")
+		if output == "" {
+			output = envID + "-debug-bundle.tar.gz"
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer f.Close()
+
+		manifest, err := repo.DebugBundle(ctx, envID, f, opts)
+		if err != nil {
+			os.Remove(output)
+			return fmt.Errorf("failed to bundle %s: %w", envID, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		for _, item := range manifest.Files {
+			if item.Truncated {
+				fmt.Fprintf(os.Stderr, "%s truncated from %s to %s\n", item.Name, humanize.Bytes(uint64(item.OriginalSize)), humanize.Bytes(uint64(item.Size)))
+			}
+		}
+		for _, e := range manifest.Errors {
+			fmt.Fprintf(os.Stderr, "Couldn't collect %s\n", e)
+		}
+		fmt.Printf("Debug bundle of %s written to %s\n", envID, output)
+		return nil
+	},
+}
+
+// hostInfo describes the host for a debug bundle.
+type hostInfo struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit"`
+	BuildDate        string `json:"build_date"`
+	OS               string `json:"os"`
+	Arch             string `json:"arch"`
+	GoVersion        string `json:"go_version"`
+	ContainerRuntime string `json:"container_runtime"`
+	Git              string `json:"git"`
+	DaggerCLI        string `json:"dagger_cli"`
+	DaggerEngine     string `json:"dagger_engine"`
+	DaggerError      string `json:"dagger_error,omitempty"`
+}
+
+func collectHostInfo(ctx context.Context) *hostInfo {
+	info := &hostInfo{
+		Version:          version,
+		Commit:           commit,
+		BuildDate:        date,
+		OS:               runtime.GOOS,
+		Arch:             runtime.GOARCH,
+		GoVersion:        runtime.Version(),
+		ContainerRuntime: "not found",
+		Git:              getToolVersion(ctx, "git", "--version"),
+		DaggerCLI:        getToolVersion(ctx, "dagger", "version"),
+	}
+	if rt := detectContainerRuntime(ctx); rt != nil {
+		info.ContainerRuntime = rt.String()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, engineTimeout)
+	defer cancel()
+	dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+	if err != nil {
+		info.DaggerError = err.Error()
+		return info
+	}
+	defer dag.Close()
+	if info.DaggerEngine, err = dag.Version(ctx); err != nil {
+		info.DaggerError = err.Error()
+	}
+	return info
+}
+
+// readTail returns up to the last n bytes of a file, or all of it if n is 0.
+func readTail(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if n > 0 {
+		stat, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if stat.Size() > n {
+			if _, err := f.Seek(-n, io.SeekEnd); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return io.ReadAll(f)
+}
+
+func init() {
+	debugBundleCmd.Flags().StringP("output", "o", "", "Archive to write (default <env>-debug-bundle.tar.gz)")
+	debugBundleCmd.Flags().Int("execs", 10, "Number of most recent commits whose command outputs are included (0 for all)")
+	debugBundleCmd.Flags().String("max-size", "10MB", "Maximum size of the bundled files before compression")
+	rootCmd.AddCommand(debugBundleCmd)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var depsCmd = &cobra.Command{
+	Use:   "deps [<env>]",
+	Short: "List or refresh the dependencies of an environment on other environments",
+	Long: `List the outputs of other environments an environment depends on, declared with
+'container-use create --depends-on', and whether they're stale: the environment
+producing them changed since they were copied.
+
+With --refresh, the current outputs are copied into the environment again,
+replacing the previous copies, and committed. --from only refreshes the
+dependencies on some environments.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Show whether the dependencies of an environment are up to date
+container-use deps e2e-tests
+
+# Copy the binary the build environment just rebuilt again
+container-use deps e2e-tests --refresh --from build-server`,
+	RunE: func(app *cobra.Command, args []string) (rerr error) {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		from, _ := app.Flags().GetStringSlice("from")
+		if refresh, _ := app.Flags().GetBool("refresh"); refresh {
+			pool, err := newEnginePool(logWriter)
+			if err != nil {
+				return err
+			}
+			defer pool.Close()
+			dag, err := pool.ClientFor(ctx, repo, envID)
+			if err != nil {
+				return err
+			}
+
+			noWait, _ := app.Flags().GetBool("no-wait")
+			slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+			if err != nil {
+				return err
+			}
+			defer slot.Release()
+
+			operationStartedAt := time.Now()
+			defer func() { repo.RecordOperation(envID, "deps", repository.OperationSourceCLI, operationStartedAt, rerr) }()
+
+			env, err := repo.Get(ctx, dag, envID)
+			if err != nil {
+				return fmt.Errorf("failed to load environment: %w", err)
+			}
+			if len(env.State.Dependencies) == 0 {
+				return fmt.Errorf("environment %s has no dependencies", envID)
+			}
+			refreshed, err := repo.RefreshDependencies(ctx, dag, env, from)
+			if err != nil {
+				return fmt.Errorf("failed to refresh the dependencies: %w", err)
+			}
+			if err := repo.Update(ctx, env, fmt.Sprintf("Refresh %d dependencies", len(refreshed))); err != nil {
+				return fmt.Errorf("refreshed but failed to update repository: %w", err)
+			}
+		} else if len(from) > 0 {
+			return fmt.Errorf("--from only applies with --refresh")
+		}
+
+		statuses, err := repo.DependencyStatuses(ctx, envID)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(statuses)
+		}
+
+		if len(statuses) == 0 {
+			fmt.Printf("Environment '%s' has no dependencies.\n", envID)
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ENVIRONMENT\tPATH\tTARGET\tREVISION\tREFRESHED\tSTATUS")
+		for _, status := range statuses {
+			state := "up to date"
+			switch {
+			case status.Error != "":
+				state = "error: " + status.Error
+			case status.Stale:
+				state = "stale"
+			}
+			refreshed := "-"
+			if !status.RefreshedAt.IsZero() {
+				refreshed = status.RefreshedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", status.Environment, orDash(status.Path), status.Target, orDash(status.Revision[:min(len(status.Revision), 7)]), refreshed, state)
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	depsCmd.Flags().Bool("refresh", false, "Copy the current outputs of the dependencies again and commit them")
+	depsCmd.Flags().StringSlice("from", nil, "Only refresh the dependencies on these environments")
+	depsCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if a command is running in the environment")
+	depsCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(depsCmd, []*repository.DependencyStatus{})
+
+	rootCmd.AddCommand(depsCmd)
+}
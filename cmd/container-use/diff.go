@@ -1,21 +1,37 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"time"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
 )
 
 var diffCmd = &cobra.Command{
-	Use:   "diff [<env>]",
+	Use:   "diff [<env>] [-- <path>...]",
 	Short: "Show what files an agent changed",
 	Long: `Display the code changes made by an agent in an environment.
 Shows a git diff between the environment's state and your current branch.
 
+With --stat, shows a summary of the changes of each file instead, and with
+--name-only, the changed files only. Paths after -- limit the diff to these files
+or directories, relative to the repository root.
+
+With --state, shows the changes the environment's commands made to the
+snapshot paths instead (see 'container-use config snapshot-path'): state
+outside the worktree, such as databases, that doesn't show up in the diff.
+
 If no environment is specified, automatically selects from environments 
 that are descendants of the current HEAD.`,
-	Args:              cobra.MaximumNArgs(1),
+	Args: func(app *cobra.Command, args []string) error {
+		if dash := app.ArgsLenAtDash(); dash >= 0 {
+			args = args[:dash]
+		}
+		return cobra.MaximumNArgs(1)(app, args)
+	},
 	ValidArgsFunction: suggestEnvironments,
 	Example: `# See what changes the agent made
 container-use diff fancy-mallard
@@ -23,6 +39,15 @@ container-use diff fancy-mallard
 # Quick assessment before merging
 container-use diff backend-api
 
+# See which files the agent touched, and how much
+container-use diff fancy-mallard --stat
+
+# Only show the changes to the frontend
+container-use diff fancy-mallard -- web/src
+
+# See what the agent's commands did to the database
+container-use diff fancy-mallard --state
+
 # Auto-select environment
 container-use diff`,
 	RunE: func(app *cobra.Command, args []string) error {
@@ -34,15 +59,51 @@ container-use diff`,
 			return err
 		}
 
+		var paths []string
+		if dash := app.ArgsLenAtDash(); dash >= 0 {
+			args, paths = args[:dash], args[dash:]
+		}
 		envID, err := resolveEnvironmentID(ctx, repo, args)
 		if err != nil {
 			return err
 		}
 
-		return repo.Diff(ctx, envID, os.Stdout)
+		if state, _ := app.Flags().GetBool("state"); state {
+			if len(paths) > 0 {
+				return fmt.Errorf("--state can't be combined with paths")
+			}
+			return printStateChanges(repo, envID)
+		}
+		opts := repository.DiffOptions{Paths: paths}
+		opts.Stat, _ = app.Flags().GetBool("stat")
+		opts.NameOnly, _ = app.Flags().GetBool("name-only")
+		return repo.Diff(ctx, envID, opts, os.Stdout)
 	},
 }
 
+func printStateChanges(repo *repository.Repository, envID string) error {
+	commands, err := repo.StateChanges(envID)
+	if err != nil {
+		return err
+	}
+	if len(commands) == 0 {
+		fmt.Println("No state changes recorded")
+		return nil
+	}
+	for i, command := range commands {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("$ %s (%s)\n", command.Command, command.Time.Local().Format(time.DateTime))
+		fmt.Println(environment.FormatStateChanges(command.Changes, 0))
+	}
+	return nil
+}
+
 func init() {
+	diffCmd.Flags().Bool("state", false, "Show the changes of commands to the snapshot paths")
+	diffCmd.Flags().Bool("stat", false, "Show a summary of the changes of each file")
+	diffCmd.Flags().Bool("name-only", false, "Only show the names of the changed files")
+	diffCmd.MarkFlagsMutuallyExclusive("state", "stat", "name-only")
 	rootCmd.AddCommand(diffCmd)
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/dagger/container-use/messages"
 )
 
 // isDockerDaemonError checks if the error is related to Docker daemon connectivity
@@ -36,6 +38,6 @@ func isDockerDaemonError(err error) bool {
 
 // handleDockerDaemonError prints a helpful error message for Docker daemon issues
 func handleDockerDaemonError() {
-	fmt.Fprintf(os.Stderr, "\nError: Docker daemon is not running.\n")
-	fmt.Fprintf(os.Stderr, "Please start Docker and try again.\n\n")
+	fmt.Fprintf(os.Stderr, "\n%s\n", messages.Get("docker.not_running"))
+	fmt.Fprintf(os.Stderr, "%s\n\n", messages.Get("docker.start"))
 }
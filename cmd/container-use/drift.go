@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var driftCmd = &cobra.Command{
+	Use:   "drift [<env>]",
+	Short: "Compare an environment with what its configuration builds",
+	Long: `Compare an environment's container with the container its recorded configuration
+builds: installed packages (apt, apk, pip, npm), executables outside of the system
+directories and environment variables.
+
+Drift is usually caused by the agent installing tools with commands that aren't part
+of the configuration. Review it before promoting the environment's setup into the
+shared configuration: the suggested commands reproduce the drift in new environments.
+
+The configuration is rebuilt on top of the environment's current files to compare with,
+which runs its setup and install commands.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Show what the agent installed in an environment
+container-use drift fancy-mallard
+
+# Output as JSON
+container-use drift fancy-mallard --json`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+
+		env, err := repo.Get(ctx, dag, envID)
+		if err != nil {
+			return fmt.Errorf("failed to load environment: %w", err)
+		}
+
+		drift, err := env.Drift(ctx)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(drift)
+		}
+
+		printDrift(drift)
+		return nil
+	},
+}
+
+func printDrift(drift *environment.Drift) {
+	if len(drift.Items) == 0 {
+		fmt.Printf("No drift: environment '%s' matches its configuration.\n", drift.EnvironmentID)
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tCHANGE\tCONFIGURED\tACTUAL")
+	for _, item := range drift.Items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.Kind, item.Name, item.Change, orDash(item.Expected), orDash(item.Actual))
+	}
+	tw.Flush()
+
+	if len(drift.Suggestions) > 0 {
+		fmt.Println()
+		fmt.Println("To reproduce it in new environments:")
+		for _, suggestion := range drift.Suggestions {
+			fmt.Printf("  %s\n", suggestion)
+		}
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	driftCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(driftCmd, &environment.Drift{})
+
+	rootCmd.AddCommand(driftCmd)
+}
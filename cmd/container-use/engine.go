@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+// connectDagger connects to the Dagger engine at host, or to the default engine if host is empty.
+func connectDagger(ctx context.Context, host string, logOutput io.Writer) (*dagger.Client, error) {
+	slog.Info("connecting to dagger", "host", host)
+
+	opts := []dagger.ClientOpt{dagger.WithLogOutput(logOutput)}
+	if host != "" {
+		opts = append(opts, dagger.WithRunnerHost(host))
+	}
+	var dag *dagger.Client
+	err := retryConfig(ctx).Do(ctx, func() error {
+		var err error
+		dag, err = dagger.Connect(ctx, opts...)
+		return err
+	}, func(retry int, delay time.Duration, err error) {
+		slog.Warn("retrying to connect to dagger", "host", host, "retry", retry, "delay", delay, "error", err)
+		fmt.Fprintf(os.Stderr, "⟳ Retrying to connect to the engine in %s: %v\n", delay, err)
+	})
+	if err != nil {
+		slog.Error("Error starting dagger", "error", err)
+
+		if host == "" && isDockerDaemonError(err) {
+			handleDockerDaemonError()
+		}
+
+		return nil, fmt.Errorf("failed to connect to dagger: %w", err)
+	}
+	return dag, nil
+}
+
+// retryConfig returns the retries configured in the repository of the current directory, if any, or else the
+// default ones.
+func retryConfig(ctx context.Context) *environment.RetryConfig {
+	root, err := repository.RunGitCommand(ctx, ".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return environment.DefaultRetry()
+	}
+	config := environment.DefaultConfig()
+	if err := config.Load(strings.TrimSpace(root)); err != nil || config.Retry == nil {
+		return environment.DefaultRetry()
+	}
+	return config.Retry
+}
+
+// newEnginePool returns the pool of engines environments are scheduled on, writing the engines' logs to
+// logOutput. Close it once done.
+func newEnginePool(logOutput io.Writer) (*repository.EnginePool, error) {
+	engines, err := repository.LoadEngines(repository.DataDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the engines: %w", err)
+	}
+	return repository.NewEnginePool(engines, func(ctx context.Context, host string) (*dagger.Client, error) {
+		return connectDagger(ctx, host, logOutput)
+	}), nil
+}
+
+var engineCmd = &cobra.Command{
+	Use:   "engine",
+	Short: "Manage the pool of engines environments run on",
+	Long: `Configure the Dagger engines environments are scheduled on, e.g. a build
+server a team shares for agent workloads.
+
+Without engines, environments run on the engine Dagger provisions locally. With
+engines, each new environment is scheduled on the least loaded one that can be
+reached, and stays on it: commands in the environment connect to its engine.
+Environments whose engine is removed from the pool move to the local engine.
+
+The engines are configured for all repositories.`,
+}
+
+var engineAddCmd = &cobra.Command{
+	Use:   "add <name> <host>",
+	Short: "Add an engine to the pool",
+	Long: `Add an engine to the pool. The host is a Dagger runner host, such as
+tcp://build-server:8080, docker-container://dagger-engine or
+kube-pod://dagger-engine?namespace=dagger.`,
+	Args: cobra.ExactArgs(2),
+	Example: `# Schedule environments on a shared build server too
+container-use engine add build-server tcp://build-server.internal:8080`,
+	RunE: func(app *cobra.Command, args []string) error {
+		name, host := args[0], args[1]
+		engines, err := repository.LoadEngines(repository.DataDir())
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(engines, func(engine *repository.Engine) bool { return engine.Name == name }) {
+			return fmt.Errorf("engine %q already exists", name)
+		}
+		engines = append(engines, &repository.Engine{Name: name, Host: host})
+		if err := repository.SaveEngines(repository.DataDir(), engines); err != nil {
+			return err
+		}
+		fmt.Printf("Engine '%s' added.\n", name)
+		return nil
+	},
+}
+
+var engineRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove an engine from the pool",
+	Long:  `Remove an engine from the pool. Its environments move to the local engine the next time they're used.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(app *cobra.Command, args []string) error {
+		engines, err := repository.LoadEngines(repository.DataDir())
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(engines, func(engine *repository.Engine) bool { return engine.Name == args[0] })
+		if i < 0 {
+			return fmt.Errorf("engine %q not found", args[0])
+		}
+		if err := repository.SaveEngines(repository.DataDir(), slices.Delete(engines, i, i+1)); err != nil {
+			return err
+		}
+		fmt.Printf("Engine '%s' removed.\n", args[0])
+		return nil
+	},
+}
+
+var engineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the engines of the pool with their load",
+	Long: `List the engines of the pool, with the load of their host per CPU and the
+number of environments of the current repository they host. Each engine is
+connected to, to report its load.`,
+	Args: cobra.NoArgs,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		// The environments are counted in the current repository, if any.
+		repo, _ := repository.Open(ctx, ".")
+		loads := pool.Loads(ctx, repo)
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(loads)
+		}
+		if len(loads) == 0 {
+			fmt.Println("No engines configured: environments run on the local engine.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tHOST\tLOAD\tENVIRONMENTS")
+		for _, load := range loads {
+			status := fmt.Sprintf("%.2f", load.Load)
+			if load.Error != "" {
+				status = "unreachable: " + load.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", load.Engine.Name, load.Engine.Host, status, load.Environments)
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	engineListCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(engineListCmd, []*repository.EngineLoad{})
+	engineCmd.AddCommand(engineAddCmd, engineRemoveCmd, engineListCmd)
+	rootCmd.AddCommand(engineCmd)
+}
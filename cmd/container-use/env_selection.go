@@ -4,16 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/charmbracelet/huh"
 	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"golang.org/x/term"
 )
 
+// noInteractive disables interactive prompts, for use in scripts.
+var noInteractive bool
+
+// isInteractive returns true if prompts can be shown to the user.
+func isInteractive() bool {
+	return !noInteractive && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
 // resolveEnvironmentID resolves the environment ID for commands that take env_id as the only positional argument.
-// If no args are provided, it filters environments to those where the local repo head is a parent of the environment's head,
+// If no args are provided and the current branch was checked out from an environment, that environment is used.
+// Otherwise, it filters environments to those where the local repo head is a parent of the environment's head,
 // then either auto-selects if there's only one match or prompts the user to select from multiple options.
+// If no environment descends from the current head, the user picks from all environments instead.
 func resolveEnvironmentID(ctx context.Context, repo *repository.Repository, args []string) (string, error) {
 	if len(args) == 1 {
 		return args[0], nil
@@ -22,6 +35,14 @@ func resolveEnvironmentID(ctx context.Context, repo *repository.Repository, args
 		return "", errors.New("too many arguments")
 	}
 
+	current, err := repo.CurrentEnvironment(ctx)
+	if err != nil {
+		return "", err
+	}
+	if current != "" {
+		return current, nil
+	}
+
 	// Get current user repo head - this could easily go inside ListDescendantEnvironments, but keeping it outside simplifies testing
 	currentHead, err := repository.RunGitCommand(ctx, repo.SourcePath(), "rev-parse", "HEAD")
 	if err != nil {
@@ -35,37 +56,66 @@ func resolveEnvironmentID(ctx context.Context, repo *repository.Repository, args
 		return "", fmt.Errorf("failed to list descendant environments: %w", err)
 	}
 
-	if len(filteredEnvs) == 0 {
-		return "", errors.New("no environments found that are descendants of the current HEAD")
-	}
-
 	// If only one environment matches, use it
 	if len(filteredEnvs) == 1 {
 		return filteredEnvs[0].ID, nil
 	}
 
+	if !isInteractive() {
+		if len(filteredEnvs) == 0 {
+			return "", errors.New("no environments found that are descendants of the current HEAD")
+		}
+		return "", fmt.Errorf("multiple environments match the current HEAD, specify one of: %s", environmentIDs(filteredEnvs))
+	}
+
+	if len(filteredEnvs) == 0 {
+		filteredEnvs, err = repo.List(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list environments: %w", err)
+		}
+		if len(filteredEnvs) == 0 {
+			return "", errors.New("no environments found")
+		}
+	}
+
 	// Multiple environments - prompt user to select
-	return promptForEnvironmentSelection(filteredEnvs)
+	return promptForEnvironmentSelection(ctx, repo, filteredEnvs)
 }
 
-// promptForEnvironmentSelection prompts the user to select from multiple environments
-func promptForEnvironmentSelection(envs []*environment.EnvironmentInfo) (string, error) {
+func environmentIDs(envs []*environment.EnvironmentInfo) string {
+	ids := make([]string, len(envs))
+	for i, env := range envs {
+		ids[i] = env.ID
+	}
+	return strings.Join(ids, ", ")
+}
+
+// promptForEnvironmentSelection prompts the user to select from multiple environments.
+// Typing filters the list by ID and title.
+func promptForEnvironmentSelection(ctx context.Context, repo *repository.Repository, envs []*environment.EnvironmentInfo) (string, error) {
 	var options []huh.Option[string]
 
+	maxTitleLength := calculateMaxTitleLength(getTerminalWidth())
 	for _, env := range envs {
 		title := env.State.Title
 		if title == "" {
 			title = "No description"
 		}
+		title = repository.Ellipsis(title, maxTitleLength)
 
-		label := fmt.Sprintf("%s - %s", env.ID, title)
+		label := fmt.Sprintf("%s - %s (updated %s", env.ID, title, humanize.Time(env.State.UpdatedAt))
+		if stat, err := repo.DiffStat(ctx, env.ID); err == nil && stat != "" {
+			label += ", " + stat
+		}
+		label += ")"
 		options = append(options, huh.NewOption(label, env.ID))
 	}
 
 	var selectedID string
 	prompt := huh.NewSelect[string]().
-		Title("Select an environment:").
+		Title("Select an environment (type / to filter):").
 		Options(options...).
+		Filtering(true).
 		Value(&selectedID)
 
 	if err := prompt.Run(); err != nil {
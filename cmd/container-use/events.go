@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events [<env>]",
+	Short: "Stream an environment's lifecycle events as NDJSON",
+	Long: `Print the machine-readable event log of an environment, one JSON object per line.
+Events include creation, command execution start and finish, commits, checkpoints,
+merges and deletion. Use --follow to keep streaming new events as they happen.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Print all events recorded so far
+container-use events fancy-mallard
+
+# Stream events as they happen
+container-use events fancy-mallard --follow
+
+# Only show finished commands
+container-use events fancy-mallard | jq 'select(.type == "exec_finished")'`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		follow, _ := app.Flags().GetBool("follow")
+
+		return repo.Events(ctx, envID, follow, os.Stdout)
+	},
+}
+
+func init() {
+	eventsCmd.Flags().BoolP("follow", "f", false, "Keep streaming new events")
+	rootCmd.AddCommand(eventsCmd)
+}
@@ -1,19 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/exec"
+	"regexp"
+	"strings"
 	"time"
 
-	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/messages"
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
 )
 
+// jobEnvVariable is set to the job's ID in the processes running the commands of exec --detach.
+const jobEnvVariable = "CONTAINER_USE_JOB"
+
 var execCmd = &cobra.Command{
-	Use:   "exec <env-id> <command>",
+	Use:   "exec [<env-id>] <command> | exec [<env-id>] --parallel <command>... | exec --all|--env <env-id>,... <command>",
 	Short: "Execute a command in an environment",
 	Long: `Execute a single command in a containerized environment.
 
@@ -21,48 +34,183 @@ The command runs in the environment's container and any filesystem changes
 are persisted to the environment's git branch. The output is displayed
 when the command completes.
 
+If the environment is omitted, it is selected automatically or picked interactively.
+
+Environment variables can be set for the command with --env-var KEY=VALUE and
+--env-file (a dotenv file), in addition to the environment's configured variables,
+which they override. They only apply to this command and aren't kept in the
+environment. --env-var KEY passes the host's value of KEY.
+
+Host files can be staged for the command with --input source[:target], e.g. fixtures
+the command reads. Targets are relative to the workdir (the source's base name by
+default). Inputs are removed once the command ran, so they're never committed,
+unless --keep-inputs is set.
+
+Concurrent execs in the same environment (e.g. yours and an agent's) run one at a
+time in arrival order. Use --no-wait to fail immediately if the environment is busy.
+
+Independent commands (e.g. lint, unit tests and type checking) can run concurrently
+with --parallel, repeated for each command. Each command runs on its own copy of the
+environment, then the changes they made to the workdir are merged. Files changed
+differently by several commands are reported as conflicts and left unchanged; changes
+outside the workdir are discarded.
+
+The same command can run in several environments with --all (every environment of
+the repository) or --env, e.g. to run the test suite of parallel attempts at a task.
+It runs in the environments concurrently, each one waiting for its own turn, and the
+results are reported per environment, with a combined report with --json.
+
+Long or colored outputs can be filtered with --strip-ansi (colors, cursor movements
+and progress bars), --grep-output (lines matching a regular expression) and --tail
+(the last lines), applied in this order to stdout and stderr before the output is
+recorded in the environment's history and shown.
+
+Long-running commands, such as test suites or builds, can stream their output with
+--stream: it's shown as it's produced rather than when the command completes. The
+output filters only apply to the output recorded in the history, not to the streamed
+output.
+
+Commands that may hang, e.g. on an interactive prompt or a server started in the
+foreground, can be stopped with --timeout, overriding the environment's default (see
+'container-use config command-timeout'); --timeout 0 lifts it. Once it expires, the
+command is sent --timeout-signal (TERM by default) then killed after --kill-after.
+It exits with code 124, and the changes it made until then are kept.
+
+Long builds can run in the background with --detach: the command is started in a
+job and exec returns immediately with its ID. The job runs like exec would, waiting
+for its turn and committing the changes, and its output is written to a log file.
+Jobs are recorded in the environment's state: check on them with 'container-use jobs'.
+
 For interactive shell sessions, use 'container-use terminal' instead.`,
-	Args: cobra.ExactArgs(2),
+	Args: func(app *cobra.Command, args []string) error {
+		if parallel, _ := app.Flags().GetStringArray("parallel"); len(parallel) > 0 {
+			return cobra.MaximumNArgs(1)(app, args)
+		}
+		if multiEnvironmentExec(app) {
+			return cobra.ExactArgs(1)(app, args)
+		}
+		return cobra.RangeArgs(1, 2)(app, args)
+	},
 	Example: `# Execute a simple command
 container-use exec adaptive-koala "ls -la"
 
 # Run tests in an environment
 container-use exec adaptive-koala "npm test"
 
+# Pick the environment interactively
+container-use exec "npm test"
+
 # Execute with JSON output
 container-use exec adaptive-koala "go build ./..." --json
 
+# Stream progress events as NDJSON
+container-use exec adaptive-koala "go build ./..." --json-stream
+
+# Follow a long test suite as it runs
+container-use exec adaptive-koala "go test ./..." --stream
+
 # Use bash instead of default sh
 container-use exec adaptive-koala "echo \$SHELL" --shell bash
 
+# Run an import on a fixture that isn't part of the repository
+container-use exec adaptive-koala --input fixture.json:/tmp/fixture.json "run-import /tmp/fixture.json"
+
+# Run the integration tests against a local database
+container-use exec adaptive-koala "go test ./integration/..." -e DATABASE_URL=postgres://db:5432/test --env-file .env.test
+
+# Fail instead of waiting if another exec is running
+container-use exec adaptive-koala "make lint" --no-wait
+
+# Run the tests in every environment
+container-use exec --all "go test ./..."
+
+# Run the tests in some environments, with a combined JSON report
+container-use exec --env adaptive-koala,fancy-mallard "go test ./..." --json
+
+# Run lint, tests and type checking concurrently
+container-use exec adaptive-koala --parallel "make lint" --parallel "go test ./..." --parallel "make typecheck"
+
+# Only keep the failures of a long, colored test run
+container-use exec adaptive-koala "npm test" --strip-ansi --grep-output 'FAIL|Error' --tail 200
+
+# Stop the tests if they run for more than 10 minutes
+container-use exec adaptive-koala "npm test" --timeout 10m
+
+# Let a server shut down cleanly when it times out
+container-use exec adaptive-koala "./serve --once" --timeout 30s --timeout-signal INT --kill-after 5s
+
+# Start a long build in the background, then check on it
+container-use exec adaptive-koala "make release" --detach
+container-use jobs status 3fa9c1
+
 # Use the container's entrypoint
 container-use exec adaptive-koala "version" --use-entrypoint`,
 	ValidArgsFunction: suggestEnvironments,
-	RunE: func(app *cobra.Command, args []string) error {
+	RunE: func(app *cobra.Command, args []string) (rerr error) {
 		ctx := app.Context()
-
-		envID := args[0]
-		command := args[1]
+		stream := jsonStreamFromFlags(app, os.Stdout)
+		defer func() { stream.Fail(rerr) }()
 
 		// Get flags
+		parallel, _ := app.Flags().GetStringArray("parallel")
 		jsonOutput, _ := app.Flags().GetBool("json")
 		shell, _ := app.Flags().GetString("shell")
 		useEntrypoint, _ := app.Flags().GetBool("use-entrypoint")
+		noWait, _ := app.Flags().GetBool("no-wait")
+		keepInputs, _ := app.Flags().GetBool("keep-inputs")
+		streamOutput, _ := app.Flags().GetBool("stream")
+		detach, _ := app.Flags().GetBool("detach")
+		jobID := os.Getenv(jobEnvVariable)
+		if detach && jobID != "" {
+			// The output of a job goes to its log, as it's produced.
+			jsonOutput = false
+			streamOutput = !useEntrypoint
+		}
 
-		// Connect to Dagger
-		slog.Info("connecting to dagger")
+		inputs, _ := app.Flags().GetStringArray("input")
+		if len(parallel) > 0 && (len(inputs) > 0 || useEntrypoint) {
+			return fmt.Errorf("--parallel can't be combined with --input or --use-entrypoint")
+		}
+		if streamOutput && (len(parallel) > 0 || useEntrypoint) {
+			return fmt.Errorf("--stream can't be combined with --parallel or --use-entrypoint")
+		}
+		var attachments []*environment.Attachment
+		for _, input := range inputs {
+			attachment, err := environment.ParseAttachment(input)
+			if err != nil {
+				return err
+			}
+			attachments = append(attachments, attachment)
+		}
 
-		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+		filter, err := outputFilterFromFlags(app)
 		if err != nil {
-			slog.Error("Error starting dagger", "error", err)
-
-			if isDockerDaemonError(err) {
-				handleDockerDaemonError()
-			}
+			return err
+		}
+		if filter != nil {
+			ctx = environment.WithOutputFilter(ctx, filter)
+		}
+		vars, err := envVariablesFromFlags(app)
+		if err != nil {
+			return err
+		}
+		if len(vars) > 0 {
+			ctx = environment.WithCommandEnv(ctx, vars)
+		}
+		if ctx, err = withTimeoutFromFlags(ctx, app); err != nil {
+			return err
+		}
+		if streamOutput {
+			ctx = environment.WithOutputStream(ctx, &environment.OutputStream{Stdout: os.Stdout, Stderr: os.Stderr})
+		}
 
-			return fmt.Errorf("failed to connect to dagger: %w", err)
+		if stream != nil {
+			ctx = repository.WithProgress(ctx, stream.Emit)
+		}
+		// Concurrent commands in several environments can't share the terminal to ask for input.
+		if term.IsTerminal(int(os.Stdin.Fd())) && !multiEnvironmentExec(app) {
+			ctx = repository.WithInputPrompt(ctx, promptInput)
 		}
-		defer dag.Close()
 
 		// Open repository
 		repo, err := repository.Open(ctx, ".")
@@ -70,6 +218,68 @@ container-use exec adaptive-koala "version" --use-entrypoint`,
 			return fmt.Errorf("failed to open repository: %w", err)
 		}
 
+		if multiEnvironmentExec(app) {
+			envIDs, err := execEnvironmentIDs(ctx, app, repo)
+			if err != nil {
+				return err
+			}
+			return execInEnvironments(ctx, repo, envIDs, args[0], shell, useEntrypoint, attachments, keepInputs, noWait, jsonOutput, stream)
+		}
+
+		envArgs := args
+		if len(parallel) == 0 {
+			envArgs = args[:len(args)-1]
+		}
+		envID, err := resolveEnvironmentID(ctx, repo, envArgs)
+		if err != nil {
+			return err
+		}
+
+		var jobExitCode *int
+		if detach {
+			if jobID == "" {
+				return startJob(ctx, app, repo, envID, args[len(args)-1], shell, jsonOutput)
+			}
+			release, err := repo.HoldJob(envID, jobID)
+			if err != nil {
+				return err
+			}
+			defer release()
+			defer func() {
+				if err := repo.FinishJob(context.WithoutCancel(ctx), envID, jobID, jobExitCode, rerr); err != nil {
+					slog.Error("failed to record the end of the job", "job", jobID, "error", err)
+				}
+			}()
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+		stream.Emit("connected", nil)
+
+		resourceWarnings, err := repo.CheckHostResources()
+		if err != nil {
+			return err
+		}
+		for _, warning := range resourceWarnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+
+		slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+		if err != nil {
+			return err
+		}
+		defer slot.Release()
+
+		operationStartedAt := time.Now()
+		defer func() { repo.RecordOperation(envID, "exec", repository.OperationSourceCLI, operationStartedAt, rerr) }()
+
 		// Load environment
 		env, err := repo.Get(ctx, dag, envID)
 		if err != nil {
@@ -78,11 +288,16 @@ container-use exec adaptive-koala "version" --use-entrypoint`,
 			return fmt.Errorf("failed to load environment: %w", err)
 		}
 
+		if len(parallel) > 0 {
+			return execParallel(ctx, repo, env, parallel, shell, jsonOutput, stream, slot)
+		}
+
 		// Execute command
+		command := args[len(args)-1]
 		slog.Info("executing command", "env_id", envID, "command", command, "shell", shell)
 
 		startTime := time.Now()
-		stdout, stderr, exitCode, err := env.RunWithExitCode(ctx, command, shell, useEntrypoint)
+		stdout, stderr, exitCode, err := env.RunWithAttachments(ctx, command, shell, useEntrypoint, attachments, keepInputs)
 		executionTime := time.Since(startTime)
 
 		if err != nil {
@@ -95,6 +310,7 @@ container-use exec adaptive-koala "version" --use-entrypoint`,
 			slog.Error("failed to update repository", "error", updateErr)
 			return fmt.Errorf("command executed but failed to update repository: %w", updateErr)
 		}
+		jobExitCode = &exitCode
 
 		// Combine output
 		output := stdout
@@ -106,22 +322,32 @@ container-use exec adaptive-koala "version" --use-entrypoint`,
 		}
 
 		// Output based on format
-		if jsonOutput {
-			result := map[string]interface{}{
-				"environment_id":    envID,
-				"command":           command,
-				"shell":             shell,
-				"use_entrypoint":    useEntrypoint,
-				"exit_code":         exitCode,
-				"stdout":            stdout,
-				"stderr":            stderr,
-				"execution_time_ms": executionTime.Milliseconds(),
+		if jsonOutput || stream != nil {
+			result := &execResult{
+				EnvironmentID:   envID,
+				Command:         command,
+				Shell:           shell,
+				UseEntrypoint:   useEntrypoint,
+				ExitCode:        exitCode,
+				Stdout:          stdout,
+				Stderr:          stderr,
+				ExecutionTimeMS: executionTime.Milliseconds(),
+				QueueWaitMS:     slot.Waited.Milliseconds(),
+				TimedOut:        timedOut(ctx, env, exitCode),
+			}
+			if len(attachments) > 0 {
+				result.Inputs = attachments
+				result.KeepInputs = &keepInputs
 			}
 
-			enc := json.NewEncoder(os.Stdout)
-			enc.SetIndent("", "  ")
-			if err := enc.Encode(result); err != nil {
-				return fmt.Errorf("failed to encode JSON: %w", err)
+			if stream != nil {
+				stream.Result(result)
+			} else {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(result); err != nil {
+					return fmt.Errorf("failed to encode JSON: %w", err)
+				}
 			}
 
 			if exitCode != 0 {
@@ -130,16 +356,20 @@ container-use exec adaptive-koala "version" --use-entrypoint`,
 			return nil
 		}
 
-		// Standard output
-		if output != "" {
+		// Standard output, unless it was streamed
+		if output != "" && !streamOutput {
 			fmt.Print(output)
 			if output[len(output)-1] != '\n' {
 				fmt.Println()
 			}
 		}
 
+		if timedOut(ctx, env, exitCode) {
+			fmt.Fprintf(os.Stderr, "\n%s\n", messages.Get("command.timed_out", env.CommandTimeout(ctx).Duration()))
+			return fmt.Errorf("command timed out after %s", env.CommandTimeout(ctx).Duration())
+		}
 		if exitCode != 0 {
-			fmt.Fprintf(os.Stderr, "\n❌ Command failed with exit code %d\n", exitCode)
+			fmt.Fprintf(os.Stderr, "\n%s\n", messages.Get("command.failed", exitCode))
 			return fmt.Errorf("command exited with code %d", exitCode)
 		}
 
@@ -147,10 +377,289 @@ container-use exec adaptive-koala "version" --use-entrypoint`,
 	},
 }
 
+// execResult is the JSON output of a command.
+type execResult struct {
+	EnvironmentID   string `json:"environment_id"`
+	Command         string `json:"command"`
+	Shell           string `json:"shell"`
+	UseEntrypoint   bool   `json:"use_entrypoint"`
+	ExitCode        int    `json:"exit_code"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	ExecutionTimeMS int64  `json:"execution_time_ms"`
+	QueueWaitMS     int64  `json:"queue_wait_ms"`
+	// TimedOut is set when the command was stopped by its timeout.
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Inputs and KeepInputs are set when host files were staged for the command.
+	Inputs     []*environment.Attachment `json:"inputs,omitempty"`
+	KeepInputs *bool                     `json:"keep_inputs,omitempty"`
+	// Error is set when the command couldn't run in the environment, with --all or --env.
+	Error string `json:"error,omitempty"`
+}
+
+// parallelExecResult is the JSON output of commands run with --parallel.
+type parallelExecResult struct {
+	EnvironmentID string `json:"environment_id"`
+	Shell         string `json:"shell"`
+	*environment.ParallelResult
+	ExecutionTimeMS int64 `json:"execution_time_ms"`
+	QueueWaitMS     int64 `json:"queue_wait_ms"`
+}
+
+// execParallel runs the commands concurrently in the environment and reports their combined result.
+func execParallel(ctx context.Context, repo *repository.Repository, env *environment.Environment, commands []string, shell string, jsonOutput bool, stream *jsonStream, slot *repository.ExecSlot) error {
+	slog.Info("executing commands in parallel", "env_id", env.ID, "commands", commands, "shell", shell)
+
+	startTime := time.Now()
+	result, err := env.RunParallel(ctx, commands, shell)
+	executionTime := time.Since(startTime)
+	if err != nil {
+		return fmt.Errorf("failed to execute commands: %w", err)
+	}
+
+	slog.Info("updating repository")
+	if updateErr := repo.Update(ctx, env, ""); updateErr != nil {
+		slog.Error("failed to update repository", "error", updateErr)
+		return fmt.Errorf("commands executed but failed to update repository: %w", updateErr)
+	}
+
+	failed := result.Failed()
+	if jsonOutput || stream != nil {
+		output := &parallelExecResult{
+			EnvironmentID:   env.ID,
+			Shell:           shell,
+			ParallelResult:  result,
+			ExecutionTimeMS: executionTime.Milliseconds(),
+			QueueWaitMS:     slot.Waited.Milliseconds(),
+		}
+		if stream != nil {
+			stream.Result(output)
+		} else {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(output); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		}
+	} else {
+		for _, command := range result.Commands {
+			status := "✅"
+			if command.ExitCode != 0 {
+				status = fmt.Sprintf("❌ exit code %d,", command.ExitCode)
+			}
+			fmt.Printf("=== %s (%s %s)\n", command.Command, status, (time.Duration(command.DurationMS) * time.Millisecond).Round(100*time.Millisecond))
+			printCommandOutput(command.Stdout, command.Stderr)
+		}
+		fmt.Printf("\n%d file(s) merged\n", len(result.Merged))
+		if len(result.Conflicts) > 0 {
+			fmt.Fprintf(os.Stderr, "\n⚠️  %d file(s) changed differently by several commands, their changes weren't kept:\n", len(result.Conflicts))
+			for _, conflict := range result.Conflicts {
+				fmt.Fprintf(os.Stderr, "  %s (%s)\n", conflict.Path, strings.Join(conflict.Commands, ", "))
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		if !jsonOutput && stream == nil {
+			fmt.Fprintf(os.Stderr, "\n❌ %d of %d commands failed\n", len(failed), len(result.Commands))
+		}
+		return fmt.Errorf("%d of %d commands failed", len(failed), len(result.Commands))
+	}
+	return nil
+}
+
+// startJob records a job running command in the environment and starts it in a detached process: exec with
+// the same flags, which records how the job ended.
+func startJob(ctx context.Context, app *cobra.Command, repo *repository.Repository, envID, command, shell string, jsonOutput bool) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find container-use executable: %w", err)
+	}
+	job, err := repo.StartJob(ctx, envID, command, shell)
+	if err != nil {
+		return err
+	}
+	log, err := os.OpenFile(job.LogPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open job log: %w", err)
+	}
+	defer log.Close()
+
+	process := exec.Command(self, jobArgs(app, envID, command)...)
+	process.Env = append(os.Environ(), jobEnvVariable+"="+job.ID)
+	process.Stdout = log
+	process.Stderr = log
+	process.SysProcAttr = detachedProcess()
+	if err := process.Start(); err != nil {
+		if finishErr := repo.FinishJob(ctx, envID, job.ID, nil, err); finishErr != nil {
+			slog.Error("failed to record the end of the job", "job", job.ID, "error", finishErr)
+		}
+		return fmt.Errorf("failed to start job: %w", err)
+	}
+	process.Process.Release()
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&repository.JobInfo{EnvironmentID: envID, Job: job}); err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return nil
+	}
+	fmt.Println(messages.Get("command.detached", job.ID, envID))
+	fmt.Println(messages.Get("command.detached_hint", job.ID, job.LogPath))
+	return nil
+}
+
+// jobArgs returns the arguments of the job's process: exec of command in the environment, with the flags
+// app was run with.
+func jobArgs(app *cobra.Command, envID, command string) []string {
+	args := []string{app.Name()}
+	app.Flags().Visit(func(flag *pflag.Flag) {
+		if values, ok := flag.Value.(pflag.SliceValue); ok {
+			for _, value := range values.GetSlice() {
+				args = append(args, "--"+flag.Name+"="+value)
+			}
+			return
+		}
+		args = append(args, "--"+flag.Name+"="+flag.Value.String())
+	})
+	return append(args, "--", envID, command)
+}
+
+// promptInput asks on the terminal for the answer to the prompt a command failed on.
+// An empty answer leaves the command failed.
+func promptInput(_ context.Context, _ *repository.Repository, envID, command, prompt string) (string, bool, error) {
+	fmt.Fprintf(os.Stderr, "%q in %s is waiting for input (leave empty to let it fail):\n%s ", command, envID, prompt)
+
+	var answer string
+	if environment.IsSecretPrompt(prompt) {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", false, err
+		}
+		answer = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", false, err
+		}
+		answer = strings.TrimRight(line, "\r\n")
+	}
+	return answer, answer != "", nil
+}
+
+// acquireExecSlot waits for the environment to be free, reporting the queue position on stderr.
+func acquireExecSlot(ctx context.Context, repo *repository.Repository, envID string, noWait bool) (*repository.ExecSlot, error) {
+	waiting := false
+	slot, err := repo.AcquireExec(ctx, envID, noWait, func(position int) {
+		waiting = true
+		fmt.Fprintf(os.Stderr, "⏳ Environment '%s' is busy, position %d in queue...\n", envID, position)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire environment: %w", err)
+	}
+	if waiting {
+		fmt.Fprintf(os.Stderr, "Waited %s for environment '%s'.\n", slot.Waited.Round(100*time.Millisecond), envID)
+	}
+	return slot, nil
+}
+
 func init() {
 	execCmd.Flags().Bool("json", false, "Output result as JSON")
+	execCmd.Flags().Bool("json-stream", false, "Output progress events and the result as newline-delimited JSON")
+	withSchema(execCmd, &execResult{}, &parallelExecResult{}, &multiExecResult{}, &repository.JobInfo{})
+	execCmd.MarkFlagsMutuallyExclusive("json", "json-stream")
+	execCmd.Flags().Bool("stream", false, "Show the output as the command produces it")
+	execCmd.MarkFlagsMutuallyExclusive("stream", "json", "json-stream")
 	execCmd.Flags().String("shell", "sh", "Shell to use for command execution")
 	execCmd.Flags().Bool("use-entrypoint", false, "Use the container's entrypoint")
+	execCmd.Flags().StringArray("input", nil, "Stage a host file for the command, as source[:target] (repeatable)")
+	execCmd.Flags().Bool("keep-inputs", false, "Keep the inputs in the environment after the command ran")
+	execCmd.Flags().StringArrayP("env-var", "e", nil, "Set an environment variable for the command, as KEY=VALUE, or KEY to pass the host's (repeatable)")
+	execCmd.Flags().StringArray("env-file", nil, "Set the environment variables of a dotenv file for the command (repeatable)")
+	execCmd.Flags().StringArray("parallel", nil, "Run a command concurrently with the other --parallel commands (repeatable)")
+	execCmd.Flags().Bool("strip-ansi", false, "Strip colors, cursor movements and progress bars from the output")
+	execCmd.Flags().String("grep-output", "", "Only keep the output lines matching this regular expression")
+	execCmd.Flags().Int("tail", 0, "Only keep the last lines of the output")
+	execCmd.Flags().Duration("timeout", 0, "Stop the command if it runs for longer, overriding the environment's default (0 for no limit)")
+	execCmd.Flags().String("timeout-signal", "", "Signal asking the command to stop once the timeout expired (default TERM)")
+	execCmd.Flags().Duration("kill-after", 0, "Kill the command if it's still running this long after the timeout signal (default 10s)")
+	execCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if another exec is running in the environment")
+	execCmd.Flags().Bool("detach", false, "Run the command in a background job and return its ID immediately")
+	for _, exclusive := range []string{"parallel", "stream", "json-stream"} {
+		execCmd.MarkFlagsMutuallyExclusive("detach", exclusive)
+	}
+	execCmd.Flags().Bool("all", false, "Run the command in every environment")
+	execCmd.Flags().StringSlice("env", nil, "Run the command in these environments (comma-separated or repeatable)")
+	execCmd.MarkFlagsMutuallyExclusive("all", "env")
+	for _, multi := range []string{"all", "env"} {
+		execCmd.MarkFlagsMutuallyExclusive(multi, "parallel")
+		execCmd.MarkFlagsMutuallyExclusive(multi, "stream")
+		execCmd.MarkFlagsMutuallyExclusive(multi, "detach")
+	}
 
 	rootCmd.AddCommand(execCmd)
 }
+
+// envVariablesFromFlags returns the variables of the --env-file and --env-var flags, the latter overriding
+// the former.
+func envVariablesFromFlags(app *cobra.Command) (environment.KVList, error) {
+	envFiles, _ := app.Flags().GetStringArray("env-file")
+	assignments, _ := app.Flags().GetStringArray("env-var")
+	return environment.ParseEnvVariables(envFiles, assignments)
+}
+
+// withTimeoutFromFlags returns a context running commands with the timeout of the --timeout, --timeout-signal
+// and --kill-after flags, or ctx itself without --timeout, keeping the environment's.
+func withTimeoutFromFlags(ctx context.Context, app *cobra.Command) (context.Context, error) {
+	if !app.Flags().Changed("timeout") {
+		if app.Flags().Changed("timeout-signal") || app.Flags().Changed("kill-after") {
+			return nil, fmt.Errorf("--timeout-signal and --kill-after need --timeout")
+		}
+		return ctx, nil
+	}
+	duration, _ := app.Flags().GetDuration("timeout")
+	if duration == 0 {
+		return environment.WithCommandTimeout(ctx, nil), nil
+	}
+	signal, _ := app.Flags().GetString("timeout-signal")
+	killAfter, _ := app.Flags().GetDuration("kill-after")
+	timeout := &environment.CommandTimeout{
+		DurationMS:    duration.Milliseconds(),
+		Signal:        environment.ParseTimeoutSignal(signal),
+		GracePeriodMS: killAfter.Milliseconds(),
+	}
+	if err := timeout.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid --timeout: %w", err)
+	}
+	return environment.WithCommandTimeout(ctx, timeout), nil
+}
+
+// timedOut reports whether a command of env exited because its timeout expired.
+func timedOut(ctx context.Context, env *environment.Environment, exitCode int) bool {
+	return exitCode == environment.TimedOutExitCode && env.CommandTimeout(ctx) != nil
+}
+
+// outputFilterFromFlags returns the output filter of the --strip-ansi, --grep-output and --tail flags,
+// or nil if none is set.
+func outputFilterFromFlags(app *cobra.Command) (*environment.OutputFilter, error) {
+	filter := &environment.OutputFilter{}
+	filter.StripANSI, _ = app.Flags().GetBool("strip-ansi")
+	filter.Tail, _ = app.Flags().GetInt("tail")
+	if filter.Tail < 0 {
+		return nil, fmt.Errorf("--tail must be positive")
+	}
+	if pattern, _ := app.Flags().GetString("grep-output"); pattern != "" {
+		grep, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --grep-output pattern: %w", err)
+		}
+		filter.Grep = grep
+	}
+	if !filter.StripANSI && filter.Grep == nil && filter.Tail == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
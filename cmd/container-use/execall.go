@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+// multiExecResult is the JSON output of a command run in several environments with --all or --env.
+type multiExecResult struct {
+	Command string `json:"command"`
+	Shell   string `json:"shell"`
+	// Results are the outcomes of the command in each environment, in the order of the environments.
+	Results []*execResult `json:"results"`
+	// Succeeded, Failed and Errored count the environments where the command exited with code 0, exited with
+	// another code, and couldn't run.
+	Succeeded       int   `json:"succeeded"`
+	Failed          int   `json:"failed"`
+	Errored         int   `json:"errored"`
+	ExecutionTimeMS int64 `json:"execution_time_ms"`
+}
+
+// tally counts the outcomes of the results.
+func (r *multiExecResult) tally() {
+	r.Succeeded, r.Failed, r.Errored = 0, 0, 0
+	for _, result := range r.Results {
+		switch {
+		case result.Error != "":
+			r.Errored++
+		case result.ExitCode != 0:
+			r.Failed++
+		default:
+			r.Succeeded++
+		}
+	}
+}
+
+// multiEnvironmentExec reports whether the command runs in several environments, with --all or --env.
+func multiEnvironmentExec(app *cobra.Command) bool {
+	all, _ := app.Flags().GetBool("all")
+	envIDs, _ := app.Flags().GetStringSlice("env")
+	return all || len(envIDs) > 0
+}
+
+// execEnvironmentIDs returns the environments selected with --all or --env.
+func execEnvironmentIDs(ctx context.Context, app *cobra.Command, repo *repository.Repository) ([]string, error) {
+	if all, _ := app.Flags().GetBool("all"); all {
+		envs, err := repo.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list environments: %w", err)
+		}
+		if len(envs) == 0 {
+			return nil, fmt.Errorf("no environments found")
+		}
+		envIDs := make([]string, 0, len(envs))
+		for _, env := range envs {
+			envIDs = append(envIDs, env.ID)
+		}
+		return envIDs, nil
+	}
+
+	envIDs, _ := app.Flags().GetStringSlice("env")
+	seen := map[string]bool{}
+	var unique []string
+	for _, envID := range envIDs {
+		if envID == "" || seen[envID] {
+			continue
+		}
+		seen[envID] = true
+		// Unknown environments fail before the command runs anywhere.
+		if _, err := repo.Info(ctx, envID); err != nil {
+			return nil, fmt.Errorf("environment '%s' not found: %w", envID, err)
+		}
+		unique = append(unique, envID)
+	}
+	return unique, nil
+}
+
+// execInEnvironments runs the command in the environments concurrently, each one waiting for its own turn,
+// and reports the results per environment. A failure in an environment doesn't stop the others.
+func execInEnvironments(ctx context.Context, repo *repository.Repository, envIDs []string, command, shell string, useEntrypoint bool, attachments []*environment.Attachment, keepInputs, noWait, jsonOutput bool, stream *jsonStream) error {
+	slog.Info("executing command in environments", "env_ids", envIDs, "command", command, "shell", shell)
+
+	pool, err := newEnginePool(logWriter)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	stream.Emit("connected", nil)
+
+	resourceWarnings, err := repo.CheckHostResources()
+	if err != nil {
+		return err
+	}
+	for _, warning := range resourceWarnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	startTime := time.Now()
+	report := &multiExecResult{Command: command, Shell: shell, Results: make([]*execResult, len(envIDs))}
+	var printMu sync.Mutex
+	var wg sync.WaitGroup
+	for i, envID := range envIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := &execResult{EnvironmentID: envID, Command: command, Shell: shell, UseEntrypoint: useEntrypoint}
+			if len(attachments) > 0 {
+				result.Inputs = attachments
+				result.KeepInputs = &keepInputs
+			}
+			if err := execInEnvironment(ctx, repo, pool, result, attachments, keepInputs, noWait); err != nil {
+				slog.Error("Failed to execute command", "environment-id", envID, "err", err)
+				result.Error = err.Error()
+			}
+			report.Results[i] = result
+
+			stream.Emit("environment_done", map[string]any{"environment_id": envID, "exit_code": result.ExitCode, "error": result.Error})
+			if !jsonOutput && stream == nil {
+				// Results are printed as the environments finish.
+				printMu.Lock()
+				printEnvironmentResult(result)
+				printMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	report.ExecutionTimeMS = time.Since(startTime).Milliseconds()
+	report.tally()
+
+	if jsonOutput || stream != nil {
+		if stream != nil {
+			stream.Result(report)
+		} else {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		}
+	} else {
+		fmt.Printf("\n%d environment(s): %d succeeded, %d failed, %d couldn't run the command\n", len(envIDs), report.Succeeded, report.Failed, report.Errored)
+	}
+
+	if unsuccessful := report.Failed + report.Errored; unsuccessful > 0 {
+		return fmt.Errorf("command failed in %d of %d environments", unsuccessful, len(envIDs))
+	}
+	return nil
+}
+
+// execInEnvironment runs the command of result in its environment, filling in the outcome.
+func execInEnvironment(ctx context.Context, repo *repository.Repository, pool *repository.EnginePool, result *execResult, attachments []*environment.Attachment, keepInputs, noWait bool) (rerr error) {
+	envID := result.EnvironmentID
+	dag, err := pool.ClientFor(ctx, repo, envID)
+	if err != nil {
+		return err
+	}
+	slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+	if err != nil {
+		return err
+	}
+	defer slot.Release()
+	result.QueueWaitMS = slot.Waited.Milliseconds()
+
+	operationStartedAt := time.Now()
+	defer func() {
+		err := rerr
+		if err == nil && result.ExitCode != 0 {
+			err = fmt.Errorf("command exited with code %d", result.ExitCode)
+		}
+		repo.RecordOperation(envID, "exec", repository.OperationSourceCLI, operationStartedAt, err)
+	}()
+
+	env, err := repo.Get(ctx, dag, envID)
+	if err != nil {
+		return fmt.Errorf("failed to load environment: %w", err)
+	}
+
+	startTime := time.Now()
+	stdout, stderr, exitCode, err := env.RunWithAttachments(ctx, result.Command, result.Shell, result.UseEntrypoint, attachments, keepInputs)
+	result.ExecutionTimeMS = time.Since(startTime).Milliseconds()
+	if err != nil {
+		return fmt.Errorf("failed to execute command: %w", err)
+	}
+	result.ExitCode, result.Stdout, result.Stderr = exitCode, stdout, stderr
+	result.TimedOut = timedOut(ctx, env, exitCode)
+
+	if err := repo.Update(ctx, env, ""); err != nil {
+		return fmt.Errorf("command executed but failed to update repository: %w", err)
+	}
+	return nil
+}
+
+// printEnvironmentResult prints the outcome of a command in one of several environments.
+func printEnvironmentResult(result *execResult) {
+	duration := (time.Duration(result.ExecutionTimeMS) * time.Millisecond).Round(100 * time.Millisecond)
+	switch {
+	case result.Error != "":
+		fmt.Printf("=== %s (⚠️  %s)\n", result.EnvironmentID, result.Error)
+		return
+	case result.ExitCode != 0:
+		fmt.Printf("=== %s (❌ exit code %d, %s)\n", result.EnvironmentID, result.ExitCode, duration)
+	default:
+		fmt.Printf("=== %s (✅ %s)\n", result.EnvironmentID, duration)
+	}
+	printCommandOutput(result.Stdout, result.Stderr)
+}
+
+// printCommandOutput prints the output of a command, stderr after stdout.
+func printCommandOutput(stdout, stderr string) {
+	output := stdout
+	if stderr != "" {
+		if output != "" {
+			output += "\n"
+		}
+		output += "stderr: " + stderr
+	}
+	if output != "" {
+		fmt.Print(output)
+		if !strings.HasSuffix(output, "\n") {
+			fmt.Println()
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiExecResultTally(t *testing.T) {
+	report := &multiExecResult{Results: []*execResult{
+		{EnvironmentID: "passing", ExitCode: 0},
+		{EnvironmentID: "failing", ExitCode: 1},
+		{EnvironmentID: "busy", Error: "failed to acquire environment: environment is busy"},
+		{EnvironmentID: "also-passing", ExitCode: 0},
+	}}
+	report.tally()
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 1, report.Errored)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [<env>...]",
+	Short: "Export environments for dashboards and review tools, or as images",
+	Long: `Export a snapshot of environments: their metadata, configuration, commits,
+diff stats relative to their base and latest test results.
+
+With --json, the snapshot is a single JSON document meant to be ingested by
+dashboards or custom review tools. Its format is versioned by schema_version
+and documented in the CLI reference. Parts of an environment that can't be
+summarized are listed in its "errors" field instead of failing the export.
+
+With --image, --oci or --push, the container of an environment is exported as
+an image instead, with everything installed in it: loaded into the local image
+store (e.g. Docker's), written as an OCI tarball, or pushed to a registry. The
+image can then be the base image of new environments ('container-use config
+base-image set') or of CI jobs. It's labeled with the environment and the commit
+of its files. The configured environment variables are part of the image, but
+not the secrets. If no environment is specified, automatically selects from
+environments that are descendants of the current HEAD.`,
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Export every environment as JSON
+container-use export --all --json > environments.json
+
+# Summarize two environments
+container-use export fancy-mallard backend-api
+
+# Snapshot an environment into a local Docker image
+container-use export fancy-mallard --image myapp-dev:latest
+
+# Write an OCI tarball, e.g. to load it elsewhere
+container-use export fancy-mallard --oci myapp-dev.tar
+
+# Push the image to a registry and use it as the base image of new environments
+container-use export fancy-mallard --push ghcr.io/acme/myapp-dev:v1
+container-use config base-image set ghcr.io/acme/myapp-dev:v1`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		var target environment.ImageExport
+		target.Image, _ = app.Flags().GetString("image")
+		target.Tarball, _ = app.Flags().GetString("oci")
+		target.Registry, _ = app.Flags().GetString("push")
+		if target != (environment.ImageExport{}) {
+			return exportImage(app, args, target)
+		}
+
+		all, _ := app.Flags().GetBool("all")
+		if all == (len(args) > 0) {
+			return fmt.Errorf("specify environments to export or --all")
+		}
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		export, err := repo.Export(ctx, args...)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.SetEscapeHTML(false)
+			return enc.Encode(export)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+
+		fmt.Fprintln(tw, "ID\tCOMMITS\tFILES\tINSERTIONS\tDELETIONS\tTESTS\tACTIVE")
+		for _, env := range export.Environments {
+			files, insertions, deletions := "-", "-", "-"
+			if env.DiffStat != nil {
+				files = fmt.Sprint(env.DiffStat.FilesChanged)
+				insertions = fmt.Sprintf("+%d", env.DiffStat.Insertions)
+				deletions = fmt.Sprintf("-%d", env.DiffStat.Deletions)
+			}
+			tests := "-"
+			if env.Tests != nil {
+				tests = fmt.Sprintf("%d passed, %d failed", env.Tests.Passed, env.Tests.Failed)
+			}
+			active := "-"
+			if env.Time != nil {
+				active = formatMS(env.Time.ActiveMS)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", env.ID, len(env.Commits), files, insertions, deletions, tests, active)
+		}
+		return nil
+	},
+}
+
+// imageExportResult is the JSON output of export with --image, --oci or --push.
+type imageExportResult struct {
+	EnvironmentID string `json:"environment_id"`
+	// Ref is the image name, tarball path, or reference pushed with its digest.
+	Ref      string `json:"ref"`
+	Revision string `json:"revision"`
+}
+
+// exportImage exports the container of an environment as an image.
+func exportImage(app *cobra.Command, args []string, target environment.ImageExport) (rerr error) {
+	ctx := app.Context()
+	if len(args) > 1 {
+		return fmt.Errorf("only one environment can be exported as an image")
+	}
+	if err := target.Validate(); err != nil {
+		return err
+	}
+
+	repo, err := repository.Open(ctx, ".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	envID, err := resolveEnvironmentID(ctx, repo, args)
+	if err != nil {
+		return err
+	}
+
+	pool, err := newEnginePool(logWriter)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	dag, err := pool.ClientFor(ctx, repo, envID)
+	if err != nil {
+		return err
+	}
+
+	operationStartedAt := time.Now()
+	defer func() { repo.RecordOperation(envID, "export", repository.OperationSourceCLI, operationStartedAt, rerr) }()
+
+	env, err := repo.Get(ctx, dag, envID)
+	if err != nil {
+		return fmt.Errorf("failed to load environment: %w", err)
+	}
+	refs, err := repo.StateRefs(ctx, envID)
+	if err != nil {
+		return err
+	}
+	ref, err := env.ExportImage(ctx, target, refs.Head)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(&imageExportResult{EnvironmentID: envID, Ref: ref, Revision: refs.Head})
+	}
+	switch {
+	case target.Image != "":
+		fmt.Printf("Environment %s exported as image %s\n", envID, ref)
+	case target.Tarball != "":
+		fmt.Printf("Environment %s exported as OCI tarball %s\n", envID, ref)
+	default:
+		fmt.Printf("Environment %s pushed as %s\n", envID, ref)
+	}
+	if target.Tarball == "" {
+		fmt.Printf("Use it as the base image of new environments: container-use config base-image set %s\n", cmp.Or(target.Image, target.Registry))
+	}
+	return nil
+}
+
+func init() {
+	exportCmd.Flags().Bool("all", false, "Export all environments")
+	exportCmd.Flags().Bool("json", false, "Output the full snapshot as JSON")
+	exportCmd.Flags().String("image", "", "Export the environment's container as an image of this name in the local image store, e.g. Docker's")
+	exportCmd.Flags().String("oci", "", "Export the environment's container as an OCI tarball at this path")
+	exportCmd.Flags().String("push", "", "Export the environment's container as an image pushed to this registry reference")
+	exportCmd.MarkFlagsMutuallyExclusive("image", "oci", "push", "all")
+	withSchema(exportCmd, &repository.Export{}, &imageExportResult{})
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var exportScriptCmd = &cobra.Command{
+	Use:   "export-script [<env>]",
+	Short: "Export the commands of an environment as a script reproducing it",
+	Long: `Print a script reproducing an environment: its base image, variables and
+workdir, its setup and install commands, then the commands that succeeded in it,
+in the order they ran. The steps an agent discovered can be captured this way
+into CI or documentation.
+
+The script is a shell script, or a Dockerfile with --format dockerfile. It runs
+from the root of the repository. Secrets, services and dev container features
+aren't reproduced: the script lists the ones it leaves out.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Print the commands of an environment as a shell script
+container-use export-script fancy-mallard
+
+# Save them as a Dockerfile
+container-use export-script fancy-mallard --format dockerfile -o Dockerfile.repro`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+		envInfo, err := repo.Info(ctx, envID)
+		if err != nil {
+			return err
+		}
+		commands, err := repo.SuccessfulCommands(envID)
+		if err != nil {
+			return fmt.Errorf("failed to read the history of %s: %w", envID, err)
+		}
+
+		format, _ := app.Flags().GetString("format")
+		script, err := repository.ReproductionScript(envID, envInfo.State.Config, commands, format)
+		if err != nil {
+			return err
+		}
+
+		output, _ := app.Flags().GetString("output")
+		if output == "" {
+			fmt.Print(script)
+			return nil
+		}
+		mode := os.FileMode(0644)
+		if format == repository.ScriptFormatShell {
+			mode = 0755
+		}
+		if err := os.WriteFile(output, []byte(script), mode); err != nil {
+			return fmt.Errorf("failed to save the script: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Saved %d command(s) of %s to %s\n", len(commands), envID, output)
+		return nil
+	},
+}
+
+func init() {
+	exportScriptCmd.Flags().String("format", repository.ScriptFormatShell, "Format of the script: sh or dockerfile")
+	exportScriptCmd.Flags().StringP("output", "o", "", "Save the script to a file instead of printing it")
+	rootCmd.AddCommand(exportScriptCmd)
+}
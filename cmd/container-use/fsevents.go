@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var fsEventsCmd = &cobra.Command{
+	Use:   "fs-events [<env>]",
+	Short: "Stream the file changes of an environment as NDJSON",
+	Long: `Print the files of an environment's workdir that its tool calls added, changed
+or removed, one file_changed event per line. Use --follow to keep streaming
+changes as the agent makes them, e.g. to restart a dev server or refresh a
+dashboard without polling the diff.
+
+Changes are reported once each tool call's changes are committed to the
+environment's branch: a command changing a file several times reports it once.
+Files that aren't committed, such as ignored or binary files, aren't reported.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Print the file changes so far
+container-use fs-events fancy-mallard
+
+# Stream changes as they happen
+container-use fs-events fancy-mallard --follow
+
+# Restart a dev server when Go files change
+container-use fs-events fancy-mallard --follow | jq --unbuffered -r 'select(.data.path | endswith(".go")) | .data.path' | while read -r f; do make restart; done`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		follow, _ := app.Flags().GetBool("follow")
+
+		return repo.FileEvents(ctx, envID, follow, os.Stdout)
+	},
+}
+
+func init() {
+	fsEventsCmd.Flags().BoolP("follow", "f", false, "Keep streaming new file changes")
+	rootCmd.AddCommand(fsEventsCmd)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ciCommentMarker identifies the pull request comment maintained by container-use ci.
+const ciCommentMarker = "<!-- container-use-ci -->"
+
+// githubActions is the context of a GitHub Actions run, read from its environment variables.
+type githubActions struct {
+	APIURL     string
+	Token      string
+	Repository string
+	SHA        string
+	Branch     string
+	PullNumber int
+}
+
+func githubActionsFromEnv() (*githubActions, error) {
+	gh := &githubActions{
+		APIURL:     os.Getenv("GITHUB_API_URL"),
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		Repository: os.Getenv("GITHUB_REPOSITORY"),
+		SHA:        os.Getenv("GITHUB_SHA"),
+		Branch:     os.Getenv("GITHUB_HEAD_REF"),
+	}
+	if gh.APIURL == "" {
+		gh.APIURL = "https://api.github.com"
+	}
+	if gh.Branch == "" {
+		gh.Branch = os.Getenv("GITHUB_REF_NAME")
+	}
+
+	// For pull requests, the event has the PR number and the head commit (GITHUB_SHA is the merge commit).
+	if eventPath := os.Getenv("GITHUB_EVENT_PATH"); eventPath != "" {
+		data, err := os.ReadFile(eventPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GitHub event: %w", err)
+		}
+		var event struct {
+			PullRequest *struct {
+				Number int `json:"number"`
+				Head   struct {
+					SHA string `json:"sha"`
+				} `json:"head"`
+			} `json:"pull_request"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub event: %w", err)
+		}
+		if event.PullRequest != nil {
+			gh.PullNumber = event.PullRequest.Number
+			gh.SHA = event.PullRequest.Head.SHA
+		}
+	}
+	return gh, nil
+}
+
+// environmentID returns the environment ID of the branch being built, if it's an environment branch.
+func (gh *githubActions) environmentID() string {
+	for _, prefix := range []string{"container-use/", "cu-"} {
+		if id, ok := strings.CutPrefix(gh.Branch, prefix); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// setStatus sets the commit status of the built commit.
+func (gh *githubActions) setStatus(ctx context.Context, success bool, description string) error {
+	state := "failure"
+	if success {
+		state = "success"
+	}
+	return gh.request(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/statuses/%s", gh.Repository, gh.SHA), map[string]any{
+		"state":       state,
+		"context":     "container-use/ci",
+		"description": description,
+	}, nil)
+}
+
+// upsertComment creates the pull request comment, or updates it if a previous run already posted it.
+func (gh *githubActions) upsertComment(ctx context.Context, body string) error {
+	body = ciCommentMarker + "\n" + body
+
+	var comments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	if err := gh.request(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100", gh.Repository, gh.PullNumber), nil, &comments); err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if strings.HasPrefix(comment.Body, ciCommentMarker) {
+			return gh.request(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/comments/%d", gh.Repository, comment.ID), map[string]any{"body": body}, nil)
+		}
+	}
+	return gh.request(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", gh.Repository, gh.PullNumber), map[string]any{"body": body}, nil)
+}
+
+// githubRepositoryFromURL returns the owner/name of the GitHub repository of a git remote URL,
+// or "" if the remote isn't on github.com.
+func githubRepositoryFromURL(remoteURL string) string {
+	rest := ""
+	for _, prefix := range []string{"git@github.com:", "https://github.com/", "ssh://git@github.com/", "git://github.com/"} {
+		if after, ok := strings.CutPrefix(remoteURL, prefix); ok {
+			rest = after
+			break
+		}
+	}
+	rest = strings.TrimSuffix(strings.TrimSuffix(rest, "/"), ".git")
+	if owner, name, ok := strings.Cut(rest, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return ""
+	}
+	return rest
+}
+
+// githubBranchProtected reports whether a branch of a GitHub repository is protected.
+// It needs a token in GITHUB_TOKEN or GH_TOKEN.
+func githubBranchProtected(ctx context.Context, repository, branch string) (bool, error) {
+	gh := &githubActions{
+		APIURL:     os.Getenv("GITHUB_API_URL"),
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		Repository: repository,
+	}
+	if gh.APIURL == "" {
+		gh.APIURL = "https://api.github.com"
+	}
+	if gh.Token == "" {
+		gh.Token = os.Getenv("GH_TOKEN")
+	}
+
+	var result struct {
+		Protected bool `json:"protected"`
+	}
+	if err := gh.request(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/branches/%s", repository, url.PathEscape(branch)), nil, &result); err != nil {
+		return false, err
+	}
+	return result.Protected, nil
+}
+
+func (gh *githubActions) request(ctx context.Context, method, path string, body, result any) error {
+	if gh.Token == "" {
+		return fmt.Errorf("GITHUB_TOKEN is not set")
+	}
+	if gh.Repository == "" {
+		return fmt.Errorf("GITHUB_REPOSITORY is not set")
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(gh.APIURL, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+gh.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub API %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
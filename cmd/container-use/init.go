@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up container-use for a new project",
+	Long: `Set up container-use in the current directory, so agents can be pointed at a
+brand-new project and still get a working, configured sandbox.
+
+The directory becomes a git repository if it isn't in one, and the repository's
+configuration is saved (.container-use/environment.json), from --template if set.
+A repository without commits gets a first one with the configuration, since
+environments are created from a commit.
+
+With --template, a new environment is also created with the template's starter
+project (e.g. a Go module with an HTTP server and its tests): review it with
+'container-use diff' and bring it in with 'container-use merge', or let an agent
+carry on in it. --no-project only saves the configuration.`,
+	Args: cobra.NoArgs,
+	Example: `# Configure the repository and scaffold a Go service in a new environment
+container-use init --template go-service --module github.com/acme/billing
+
+# Only save the template's configuration
+container-use init --template go-service --no-project
+
+# List the templates
+container-use init --list-templates`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		if list, _ := app.Flags().GetBool("list-templates"); list {
+			templates, err := environment.ProjectTemplates()
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(tw, "TEMPLATE\tDESCRIPTION")
+			for _, tmpl := range templates {
+				fmt.Fprintf(tw, "%s\t%s\n", tmpl.Name, tmpl.Description)
+			}
+			return tw.Flush()
+		}
+
+		config := environment.DefaultConfig()
+		var tmpl *environment.ProjectTemplate
+		if name, _ := app.Flags().GetString("template"); name != "" {
+			var err error
+			if tmpl, err = environment.GetProjectTemplate(name); err != nil {
+				return fmt.Errorf("%w: see 'container-use init --list-templates'", err)
+			}
+			config = tmpl.Config.Copy()
+		}
+
+		force, _ := app.Flags().GetBool("force")
+		repo, err := repository.Bootstrap(ctx, ".", config, force)
+		if errors.Is(err, repository.ErrConfigExists) {
+			return fmt.Errorf("%w: use --force to replace it", err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Configuration saved to %s\n", environment.ConfigFile(repo.SourcePath()))
+
+		if noProject, _ := app.Flags().GetBool("no-project"); tmpl == nil || noProject {
+			return nil
+		}
+
+		vars := environment.ProjectTemplateVars{Name: filepath.Base(repo.SourcePath())}
+		vars.Module, _ = app.Flags().GetString("module")
+		title, _ := app.Flags().GetString("title")
+		if title == "" {
+			title = fmt.Sprintf("Scaffold %s (%s)", vars.Name, tmpl.Name)
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		ctx, dag, err := pool.Schedule(ctx, repo)
+		if err != nil {
+			return err
+		}
+
+		env, err := repo.Scaffold(ctx, dag, tmpl, vars, title)
+		if err != nil {
+			return fmt.Errorf("failed to scaffold the project: %w", err)
+		}
+
+		fmt.Printf("Project scaffolded in environment: %s\n", env.ID)
+		fmt.Println()
+		fmt.Println("Next steps:")
+		fmt.Printf("  View the project: container-use diff %s\n", env.ID)
+		fmt.Printf("  Open a shell:     container-use terminal %s\n", env.ID)
+		fmt.Printf("  Accept it:        container-use merge %s\n", env.ID)
+		return nil
+	},
+}
+
+func init() {
+	initCmd.Flags().StringP("template", "t", "", "Project template to configure the repository and scaffold a project with")
+	initCmd.Flags().Bool("list-templates", false, "List the project templates")
+	initCmd.Flags().String("module", "", "Module or package name of the scaffolded project (default the directory name)")
+	initCmd.Flags().String("title", "", "Title of the scaffolding environment")
+	initCmd.Flags().Bool("no-project", false, "Only save the configuration, without scaffolding a project")
+	initCmd.Flags().BoolP("force", "f", false, "Replace an existing configuration")
+	rootCmd.AddCommand(initCmd)
+}
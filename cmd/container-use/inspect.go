@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
 )
@@ -33,7 +34,14 @@ var inspectCmd = &cobra.Command{
 		}
 
 		envInfo.State.Container = ""
-		out, err := json.MarshalIndent(envInfo, "", "  ")
+		timeReport, err := repo.TimeReport(ctx, envID)
+		if err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(struct {
+			*environment.EnvironmentInfo
+			Time *repository.TimeReport `json:"time"`
+		}{envInfo, timeReport}, "", "  ")
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+// jobPollInterval is how often a job is checked while waiting for it or following its log.
+const jobPollInterval = 500 * time.Millisecond
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs [<env-id>]",
+	Short: "List the background jobs of environments",
+	Long: `List the jobs started with 'container-use exec --detach', of an environment or
+of every environment of the repository, oldest first.
+
+A job is running (including while it waits for its turn in the environment), has
+succeeded or failed, with its exit code, or is lost: its process exited without
+recording how the command ended, e.g. when it was killed or the host rebooted.
+Jobs are recorded in the environment's state, so they're kept across CLI restarts.`,
+	Args: cobra.MaximumNArgs(1),
+	Example: `# List the jobs of every environment
+container-use jobs
+
+# List the jobs of an environment as JSON
+container-use jobs adaptive-koala --json`,
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		envID := ""
+		if len(args) > 0 {
+			envID = args[0]
+		}
+		jobs, err := repo.Jobs(ctx, envID)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(jobs)
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No jobs. Start one with 'container-use exec --detach'.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "ID\tENVIRONMENT\tSTATUS\tSTARTED\tDURATION\tCOMMAND")
+		for _, job := range jobs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.EnvironmentID, jobStatus(job.Job),
+				humanize.Time(job.StartedAt), job.Duration().Round(time.Second), truncate(app, job.Command, 50))
+		}
+		return tw.Flush()
+	},
+}
+
+var jobsStatusCmd = &cobra.Command{
+	Use:   "status <job-id>",
+	Short: "Show the status of a background job",
+	Long: `Show the status of a job started with 'container-use exec --detach': its command,
+environment, start and end times, exit code and log file.
+
+With --wait, wait for the job to end: the command then fails if the job did.`,
+	Args: cobra.ExactArgs(1),
+	Example: `# Check on a job
+container-use jobs status 3fa9c1
+
+# Wait for a job, failing if it does
+container-use jobs status 3fa9c1 --wait`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		job, err := repo.Job(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		wait, _ := app.Flags().GetBool("wait")
+		if wait {
+			if job, err = waitForJob(ctx, repo, job); err != nil {
+				return err
+			}
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(job); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		} else {
+			printJob(job)
+		}
+
+		if wait && job.Status != environment.JobSucceeded {
+			return fmt.Errorf("job %s %s", job.ID, jobStatus(job.Job))
+		}
+		return nil
+	},
+}
+
+var jobsLogsCmd = &cobra.Command{
+	Use:   "logs <job-id>",
+	Short: "Show the output of a background job",
+	Long: `Show the output of a job started with 'container-use exec --detach', as written to
+its log file so far. With --follow, keep showing it as it's produced until the job ends.`,
+	Args: cobra.ExactArgs(1),
+	Example: `# Follow a long build
+container-use jobs logs 3fa9c1 --follow`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		job, err := repo.Job(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		log, err := os.Open(job.LogPath)
+		if err != nil {
+			return fmt.Errorf("failed to open job log: %w", err)
+		}
+		defer log.Close()
+
+		follow, _ := app.Flags().GetBool("follow")
+		for {
+			if _, err := io.Copy(os.Stdout, log); err != nil {
+				return fmt.Errorf("failed to read job log: %w", err)
+			}
+			// The job is refreshed after each copy: the output of a job that just ended is copied before returning.
+			if !follow || job.Status != environment.JobRunning {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(jobPollInterval):
+			}
+			if job, err = repo.Job(ctx, job.ID); err != nil {
+				return err
+			}
+		}
+	},
+}
+
+// waitForJob polls the job until it's no longer running.
+func waitForJob(ctx context.Context, repo *repository.Repository, job *repository.JobInfo) (*repository.JobInfo, error) {
+	for job.Status == environment.JobRunning {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(jobPollInterval):
+		}
+		var err error
+		if job, err = repo.Job(ctx, job.ID); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// jobStatus describes the job's status, with its exit code once it completed.
+func jobStatus(job *environment.Job) string {
+	if job.ExitCode != nil && *job.ExitCode != 0 {
+		return fmt.Sprintf("%s (exit code %d)", job.Status, *job.ExitCode)
+	}
+	return job.Status
+}
+
+func printJob(job *repository.JobInfo) {
+	fmt.Printf("Job:         %s\n", job.ID)
+	fmt.Printf("Environment: %s\n", job.EnvironmentID)
+	fmt.Printf("Command:     %s\n", job.Command)
+	fmt.Printf("Status:      %s\n", jobStatus(job.Job))
+	if job.Error != "" {
+		fmt.Printf("Error:       %s\n", job.Error)
+	}
+	fmt.Printf("Started:     %s (%s)\n", job.StartedAt.Local().Format(time.DateTime), humanize.Time(job.StartedAt))
+	if job.FinishedAt != nil {
+		fmt.Printf("Finished:    %s, after %s\n", job.FinishedAt.Local().Format(time.DateTime), job.Duration().Round(time.Second))
+	} else {
+		fmt.Printf("Running for: %s\n", job.Duration().Round(time.Second))
+	}
+	fmt.Printf("Log:         %s\n", job.LogPath)
+}
+
+func init() {
+	jobsCmd.Flags().Bool("json", false, "Output result as JSON")
+	jobsCmd.Flags().Bool("no-trunc", false, "Don't truncate the commands")
+	withSchema(jobsCmd, []*repository.JobInfo{})
+	jobsStatusCmd.Flags().Bool("json", false, "Output result as JSON")
+	jobsStatusCmd.Flags().Bool("wait", false, "Wait for the job to end, failing if it does")
+	withSchema(jobsStatusCmd, &repository.JobInfo{})
+	jobsLogsCmd.Flags().BoolP("follow", "f", false, "Keep showing the output until the job ends")
+	jobsCmd.AddCommand(jobsStatusCmd, jobsLogsCmd)
+	rootCmd.AddCommand(jobsCmd)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// streamEvent is a line of --json-stream output.
+type streamEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// ElapsedMS is the time since the command started, StepMS the time since the previous event.
+	ElapsedMS int64          `json:"elapsed_ms"`
+	StepMS    int64          `json:"step_ms"`
+	Data      map[string]any `json:"data,omitempty"`
+	Result    any            `json:"result,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// jsonStream writes the progress of a long-running command as newline-delimited JSON events,
+// ending with a "result" event carrying the --json payload, or an "error" event.
+// A nil stream discards events, so commands can report progress unconditionally.
+type jsonStream struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	started time.Time
+	last    time.Time
+	done    bool
+}
+
+func newJSONStream(w io.Writer) *jsonStream {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	now := time.Now()
+	return &jsonStream{enc: enc, started: now, last: now}
+}
+
+// jsonStreamFromFlags returns a stream on w if --json-stream is set, or nil.
+func jsonStreamFromFlags(cmd *cobra.Command, w io.Writer) *jsonStream {
+	if enabled, _ := cmd.Flags().GetBool("json-stream"); enabled {
+		return newJSONStream(w)
+	}
+	return nil
+}
+
+func (s *jsonStream) write(event streamEvent) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	event.Time = now.UTC()
+	event.ElapsedMS = now.Sub(s.started).Milliseconds()
+	event.StepMS = now.Sub(s.last).Milliseconds()
+	s.last = now
+	s.done = s.done || event.Event == "result" || event.Event == "error"
+	// Events are best effort: a closed output must not fail the command.
+	_ = s.enc.Encode(event)
+}
+
+// Emit reports a phase of the command. Event names use dashes, e.g. setup_step_complete becomes setup-step-complete.
+func (s *jsonStream) Emit(event string, data map[string]any) {
+	s.write(streamEvent{Event: strings.ReplaceAll(event, "_", "-"), Data: data})
+}
+
+// Result reports the outcome of the command, with the same payload as --json.
+func (s *jsonStream) Result(result any) {
+	s.write(streamEvent{Event: "result", Result: result})
+}
+
+// Fail reports that the command failed, if err is set and no result was reported:
+// a result with a non-zero exit code is the last event of a command that failed.
+func (s *jsonStream) Fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if !done {
+		s.write(streamEvent{Event: "error", Error: err.Error()})
+	}
+}
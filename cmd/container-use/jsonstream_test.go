@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONStream(t *testing.T) {
+	decode := func(t *testing.T, out string) []map[string]any {
+		t.Helper()
+		var events []map[string]any
+		for line := range strings.SplitSeq(strings.TrimSpace(out), "\n") {
+			event := map[string]any{}
+			require.NoError(t, json.Unmarshal([]byte(line), &event))
+			events = append(events, event)
+		}
+		return events
+	}
+
+	t.Run("result", func(t *testing.T) {
+		var buf bytes.Buffer
+		stream := newJSONStream(&buf)
+		stream.Emit("connected", nil)
+		stream.Emit("setup_step_complete", map[string]any{"command": "apt-get update"})
+		stream.Result(map[string]any{"id": "fancy-mallard"})
+		// A failure reported after the result, e.g. a non-zero exit code, doesn't add an event.
+		stream.Fail(errors.New("command exited with code 1"))
+
+		events := decode(t, buf.String())
+		require.Len(t, events, 3)
+		assert.Equal(t, "connected", events[0]["event"])
+		assert.Equal(t, "setup-step-complete", events[1]["event"])
+		assert.Equal(t, map[string]any{"command": "apt-get update"}, events[1]["data"])
+		assert.Contains(t, events[1], "elapsed_ms")
+		assert.Contains(t, events[1], "step_ms")
+		assert.Equal(t, "result", events[2]["event"])
+		assert.Equal(t, map[string]any{"id": "fancy-mallard"}, events[2]["result"])
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var buf bytes.Buffer
+		stream := newJSONStream(&buf)
+		stream.Emit("connected", nil)
+		stream.Fail(errors.New("failed to create environment"))
+
+		events := decode(t, buf.String())
+		require.Len(t, events, 2)
+		assert.Equal(t, "error", events[1]["event"])
+		assert.Equal(t, "failed to create environment", events[1]["error"])
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var stream *jsonStream
+		stream.Emit("connected", nil)
+		stream.Result(nil)
+		stream.Fail(errors.New("ignored"))
+	})
+}
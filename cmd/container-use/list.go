@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 	"text/tabwriter"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
@@ -14,7 +18,25 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all environments",
 	Long: `Display all active environments with their IDs, titles, and timestamps.
-Use -q for environment IDs only, useful for scripting.`,
+Use -q for environment IDs only, useful for scripting.
+
+--format prints each environment with a Go template, or as a line of JSON with
+--format json. --columns selects the columns of the table. Both use the fields of
+'container-use export': templates use their Go names (.ID, .DiffStat.FilesChanged)
+and columns their JSON names (id, diff_stat.files_changed). Fields needing git
+or the event log (head, base, commits, diff_stat, tests, time) are only computed
+when used.`,
+	Example: `# Environment IDs and titles, tab-separated
+container-use list --format '{{.ID}}\t{{.Title}}'
+
+# Changed files per environment, e.g. for a tmux status line
+container-use list --format '{{.ID}}: {{.DiffStat.FilesChanged}} files'
+
+# One JSON document per environment
+container-use list --format json
+
+# Pick the columns of the table
+container-use list --columns id,title,diff_stat.files_changed,tests.failed`,
 	RunE: func(app *cobra.Command, _ []string) error {
 		ctx := app.Context()
 		repo, err := repository.Open(ctx, ".")
@@ -32,12 +54,75 @@ Use -q for environment IDs only, useful for scripting.`,
 			return nil
 		}
 
+		if format, _ := app.Flags().GetString("format"); format != "" {
+			summarize := formatNeedsSummaries(format)
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetEscapeHTML(false)
+				for _, envInfo := range envInfos {
+					if err := enc.Encode(repo.ExportEnvironment(ctx, envInfo, summarize)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			tmpl, err := parseListFormat(format)
+			if err != nil {
+				return err
+			}
+			for _, envInfo := range envInfos {
+				if err := tmpl.Execute(os.Stdout, repo.ExportEnvironment(ctx, envInfo, summarize)); err != nil {
+					return fmt.Errorf("failed to format %s: %w", envInfo.ID, err)
+				}
+				fmt.Println()
+			}
+			return nil
+		}
+
+		if columns, _ := app.Flags().GetStringSlice("columns"); len(columns) > 0 {
+			summarize := columnsNeedSummaries(columns)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			defer tw.Flush()
+			fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+			for _, envInfo := range envInfos {
+				fields, err := exportedFields(repo.ExportEnvironment(ctx, envInfo, summarize))
+				if err != nil {
+					return err
+				}
+				values := make([]string, 0, len(columns))
+				for _, column := range columns {
+					values = append(values, truncate(app, columnValue(fields, column), 40))
+				}
+				fmt.Fprintln(tw, strings.Join(values, "\t"))
+			}
+			return nil
+		}
+
+		// The limits are only shown when some environment has them.
+		limited := slices.ContainsFunc(envInfos, func(envInfo *environment.EnvironmentInfo) bool {
+			return !envInfo.State.Config.Resources.IsZero()
+		})
 		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(tw, "ID\tTITLE\tCREATED\tUPDATED")
+		if limited {
+			fmt.Fprintln(tw, "ID\tTITLE\tCREATED\tUPDATED\tLIMITS")
+		} else {
+			fmt.Fprintln(tw, "ID\tTITLE\tCREATED\tUPDATED")
+		}
 
 		defer tw.Flush()
 		for _, envInfo := range envInfos {
-			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", envInfo.ID, truncate(app, envInfo.State.Title, 40), humanize.Time(envInfo.State.CreatedAt), humanize.Time(envInfo.State.UpdatedAt))
+			title := truncate(app, envInfo.State.Title, 40)
+			if budget, _ := repo.ChangeBudget(envInfo.ID); budget != nil && budget.Exceeded {
+				title = "⚠ over budget: " + title
+			}
+			if len(envInfo.State.Conflicts) > 0 {
+				title = "⚠ conflicts: " + title
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s", envInfo.ID, title, humanize.Time(envInfo.State.CreatedAt), humanize.Time(envInfo.State.UpdatedAt))
+			if limited {
+				fmt.Fprintf(tw, "\t%s", describeResourceLimits(envInfo.State.Config.Resources))
+			}
+			fmt.Fprintln(tw)
 		}
 		return nil
 	},
@@ -47,14 +132,15 @@ func truncate(app *cobra.Command, s string, max int) string {
 	if noTrunc, _ := app.Flags().GetBool("no-trunc"); noTrunc {
 		return s
 	}
-	if len(s) > max {
-		return s[:max] + "…"
-	}
-	return s
+	return repository.Ellipsis(s, max)
 }
 
 func init() {
 	listCmd.Flags().BoolP("quiet", "q", false, "Display only environment IDs")
 	listCmd.Flags().BoolP("no-trunc", "", false, "Don't truncate output")
+	listCmd.Flags().String("format", "", "Print each environment with a Go template, or as JSON with 'json'")
+	withSchema(listCmd, &repository.EnvironmentExport{})
+	listCmd.Flags().StringSlice("columns", nil, "Columns of the table, as JSON field names of 'container-use export' (e.g. id,title,diff_stat.files_changed)")
+	listCmd.MarkFlagsMutuallyExclusive("quiet", "format", "columns")
 	rootCmd.AddCommand(listCmd)
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+)
+
+// stateFields are the fields of an exported environment read from its state. The others (head, base,
+// commits, diff_stat, tests and errors) need git, so they're only computed when used.
+var stateFields = map[string]bool{
+	"ID": true, "Title": true, "CreatedAt": true, "UpdatedAt": true, "Config": true, "RemoteRef": true, "Conflicts": true,
+	"id": true, "title": true, "created_at": true, "updated_at": true, "config": true, "remote_ref": true, "conflicts": true,
+}
+
+var (
+	// templateField matches the top-level field references of a template, e.g. .DiffStat in
+	// {{.DiffStat.FilesChanged}}, but not .FilesChanged.
+	templateField = regexp.MustCompile(`(^|[^\w.)\]])\.([A-Za-z_]\w*)`)
+	// templateDot matches references to the whole environment, e.g. {{json .}}.
+	templateDot = regexp.MustCompile(`(^|[^\w.)\]])\.($|[^\w])`)
+)
+
+var listTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"ago":   func(t time.Time) string { return humanize.Time(t) },
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// parseListFormat parses a --format template, applied to each environment as exported by
+// 'container-use export'. \t and \n escapes are expanded, so formats can be typed in a shell.
+func parseListFormat(format string) (*template.Template, error) {
+	format = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(format)
+	tmpl, err := template.New("format").Funcs(listTemplateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// formatNeedsSummaries reports whether a --format template uses fields computed with git.
+func formatNeedsSummaries(format string) bool {
+	if format == "json" || templateDot.MatchString(format) {
+		return true
+	}
+	for _, m := range templateField.FindAllStringSubmatch(format, -1) {
+		if !stateFields[m[2]] {
+			return true
+		}
+	}
+	return false
+}
+
+// columnsNeedSummaries reports whether --columns selects fields computed with git.
+func columnsNeedSummaries(columns []string) bool {
+	for _, column := range columns {
+		field, _, _ := strings.Cut(column, ".")
+		if !stateFields[field] {
+			return true
+		}
+	}
+	return false
+}
+
+// exportedFields returns the JSON document of an exported environment as a map, numbers kept exact.
+func exportedFields(env *repository.EnvironmentExport) (map[string]any, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	fields := map[string]any{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// columnValue returns the value of a column, a dot-separated path of JSON field names such as
+// diff_stat.files_changed, or "-" if the environment doesn't have it.
+func columnValue(fields map[string]any, column string) string {
+	var value any = fields
+	for name := range strings.SplitSeq(column, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "-"
+		}
+		if value, ok = object[name]; !ok {
+			return "-"
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatNeedsSummaries(t *testing.T) {
+	assert.False(t, formatNeedsSummaries(`{{.ID}}\t{{.Title}}`))
+	assert.False(t, formatNeedsSummaries(`{{.ID}} {{.Config.BaseImage}} {{ago .UpdatedAt}}`))
+	assert.True(t, formatNeedsSummaries(`{{.ID}}\t{{.DiffStat.FilesChanged}}`))
+	assert.True(t, formatNeedsSummaries(`{{with .Tests}}{{.Failed}}{{end}}`))
+	assert.True(t, formatNeedsSummaries(`{{json .}}`))
+	assert.True(t, formatNeedsSummaries("json"))
+
+	assert.False(t, columnsNeedSummaries([]string{"id", "title", "config.base_image"}))
+	assert.True(t, columnsNeedSummaries([]string{"id", "diff_stat.files_changed"}))
+}
+
+func TestListFormat(t *testing.T) {
+	env := &repository.EnvironmentExport{
+		ID:        "fancy-mallard",
+		Title:     "Add login",
+		UpdatedAt: time.Now().Add(-time.Hour),
+		Commits:   []*repository.CommitSummary{},
+		DiffStat:  &repository.DiffStats{FilesChanged: 3, Insertions: 40},
+	}
+
+	tmpl, err := parseListFormat(`{{.ID}}\t{{.Title}}\t{{.DiffStat.FilesChanged}}\t{{ago .UpdatedAt}}`)
+	require.NoError(t, err)
+	var out strings.Builder
+	require.NoError(t, tmpl.Execute(&out, env))
+	assert.Equal(t, "fancy-mallard\tAdd login\t3\t1 hour ago", out.String())
+
+	_, err = parseListFormat(`{{.ID`)
+	assert.Error(t, err)
+
+	fields, err := exportedFields(env)
+	require.NoError(t, err)
+	assert.Equal(t, "fancy-mallard", columnValue(fields, "id"))
+	assert.Equal(t, "3", columnValue(fields, "diff_stat.files_changed"))
+	assert.Equal(t, "0", columnValue(fields, "diff_stat.deletions"))
+	assert.Equal(t, "-", columnValue(fields, "tests.failed"))
+	assert.Equal(t, "-", columnValue(fields, "id.nested"))
+	assert.Equal(t, "[]", columnValue(fields, "commits"))
+}
@@ -1,21 +1,36 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
 
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
 )
 
 var logCmd = &cobra.Command{
-	Use:   "log [<env>]",
-	Short: "View what an agent did step-by-step",
+	Use:     "log [<env>]",
+	Aliases: []string{"logs"},
+	Short:   "View what an agent did step-by-step",
 	Long: `Display the complete development history for an environment.
 Shows all commits made by the agent plus command execution notes.
 Use -p to include code patches in the output.
 
 If no environment is specified, automatically selects from environments 
-that are descendants of the current HEAD.`,
+that are descendants of the current HEAD.
+
+With --self, display the internal logs of container-use and of the Dagger
+engine instead, to debug container-use itself. Each invocation of container-use
+writes its own log, at the level set with --verbosity.`,
 	Args:              cobra.MaximumNArgs(1),
 	ValidArgsFunction: suggestEnvironments,
 	Example: `# See what agent did
@@ -25,10 +40,34 @@ container-use log fancy-mallard
 container-use log fancy-mallard -p
 
 # Auto-select environment
-container-use log`,
+container-use log
+
+# Show the internal logs of the last invocation
+container-use logs --self
+
+# Show the warnings and errors of the last 3 MCP server sessions
+container-use logs --self --command stdio -n 3 --level warn`,
 	RunE: func(app *cobra.Command, args []string) error {
 		ctx := app.Context()
 
+		if self, _ := app.Flags().GetBool("self"); self {
+			if len(args) > 0 {
+				return fmt.Errorf("--self shows the logs of container-use, not of an environment")
+			}
+			opts := selfLogOptions{}
+			opts.Invocations, _ = app.Flags().GetInt("invocations")
+			opts.Command, _ = app.Flags().GetString("command")
+			opts.List, _ = app.Flags().GetBool("list")
+			if level, _ := app.Flags().GetString("level"); level != "" {
+				minLevel, err := parseLogLevel(level)
+				if err != nil {
+					return err
+				}
+				opts.Level = &minLevel
+			}
+			return printSelfLogs(os.Stdout, opts)
+		}
+
 		// Ensure we're in a git repository
 		repo, err := repository.Open(ctx, ".")
 		if err != nil {
@@ -47,8 +86,103 @@ container-use log`,
 	},
 }
 
+type selfLogOptions struct {
+	Invocations int
+	Command     string
+	Level       *slog.Level
+	List        bool
+}
+
+// printSelfLogs writes the logs of the previous invocations of container-use.
+func printSelfLogs(w io.Writer, opts selfLogOptions) error {
+	logs, err := previousLogs()
+	if err != nil {
+		return fmt.Errorf("failed to list logs: %w", err)
+	}
+	if opts.Command != "" {
+		logs = slices.DeleteFunc(logs, func(log string) bool { return logCommand(log) != opts.Command })
+	}
+
+	if opts.List {
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "COMMAND\tSIZE\tFILE")
+		for _, log := range logs {
+			var size int64
+			for _, path := range []string{log + ".1", log} {
+				if stat, err := os.Stat(path); err == nil {
+					size += stat.Size()
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", logCommand(log), humanize.Bytes(uint64(size)), log)
+		}
+		return tw.Flush()
+	}
+
+	if len(logs) == 0 {
+		return fmt.Errorf("no logs found in %s", logDir)
+	}
+	if opts.Invocations > 0 && len(logs) > opts.Invocations {
+		logs = logs[len(logs)-opts.Invocations:]
+	}
+	for i, log := range logs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "==> %s <==\n", filepath.Base(log))
+		for _, path := range []string{log + ".1", log} {
+			if err := copyLogLines(w, path, opts.Level); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyLogLines copies a log, keeping the lines of the given level and above when there is one. Lines
+// without a level, such as the output of the Dagger engine, are left out then.
+func copyLogLines(w io.Writer, path string, minLevel *slog.Level) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if minLevel == nil {
+		_, err := io.Copy(w, f)
+		return err
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogFileSize)
+	for scanner.Scan() {
+		if level, ok := logLineLevel(scanner.Text()); ok && level >= *minLevel {
+			fmt.Fprintln(w, scanner.Text())
+		}
+	}
+	return scanner.Err()
+}
+
+// logLineLevel returns the level of a line written by the slog text handler.
+func logLineLevel(line string) (slog.Level, bool) {
+	_, rest, ok := strings.Cut(line, " level=")
+	if !ok || !strings.HasPrefix(line, "time=") {
+		return 0, false
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, false
+	}
+	return level, true
+}
+
 func init() {
 	logCmd.Flags().BoolP("patch", "p", false, "Generate patch")
 	logCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(logCmd, &repository.EnvironmentLog{})
+	logCmd.Flags().Bool("self", false, "Show the internal logs of container-use instead of an environment's history")
+	logCmd.Flags().IntP("invocations", "n", 1, "With --self, number of most recent invocations to show")
+	logCmd.Flags().String("command", "", "With --self, only show the invocations of a command, e.g. stdio")
+	logCmd.Flags().String("level", "", "With --self, only show the log lines of this level and above: debug, info, warn or error")
+	logCmd.Flags().Bool("list", false, "With --self, list the log files instead of showing them")
 	rootCmd.AddCommand(logCmd)
 }
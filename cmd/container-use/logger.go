@@ -1,57 +1,255 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maxLogFileSize caps the log of an invocation. Past it, the log is rotated to <file>.1, so long-running
+	// commands such as stdio keep their most recent logs.
+	maxLogFileSize = 10 << 20
+	// maxLogFiles is the number of invocation logs kept.
+	maxLogFiles = 50
 )
 
 var (
 	logWriter = io.Discard
+	// logFile is the log of the current invocation, if any.
+	logFile   string
+	logDir    = filepath.Join(repository.DataDir(), "logs")
+	verbosity string
 )
 
-func parseLogLevel(levelStr string) slog.Level {
-	switch levelStr {
-	case "debug", "DEBUG":
-		return slog.LevelDebug
-	case "info", "INFO":
-		return slog.LevelInfo
-	case "warn", "WARN", "warning", "WARNING":
-		return slog.LevelWarn
-	case "error", "ERROR":
-		return slog.LevelError
-	default:
-		return slog.LevelInfo
+var verbosityLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+func parseLogLevel(levelStr string) (slog.Level, error) {
+	levelStr = strings.ToLower(levelStr)
+	if levelStr == "warning" {
+		levelStr = "warn"
+	}
+	level, ok := verbosityLevels[levelStr]
+	if !ok {
+		return 0, fmt.Errorf("invalid verbosity %q, expected one of: debug, info, warn, error", levelStr)
 	}
+	return level, nil
 }
 
-func setupLogger() error {
-	var writers []io.Writer
+func defaultVerbosity() string {
+	if v := os.Getenv("CONTAINER_USE_LOG_LEVEL"); v != "" {
+		if _, err := parseLogLevel(v); err == nil {
+			return strings.ToLower(v)
+		}
+	}
+	return "info"
+}
 
-	logFile := filepath.Join(os.TempDir(), "container-use.debug.stderr.log")
-	if v, ok := os.LookupEnv("CONTAINER_USE_STDERR_FILE"); ok {
-		logFile = v
+// setupLogger writes the logs of container-use and of the Dagger engine to a log file of the invocation,
+// named after its time and command so `container-use logs --self` can find it.
+func setupLogger(cmd *cobra.Command) error {
+	level, err := parseLogLevel(verbosity)
+	if err != nil {
+		return err
+	}
+	// Looking at the logs would otherwise add logs of its own, and push the oldest out.
+	if self, _ := cmd.Flags().GetBool("self"); self {
+		return nil
 	}
 
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf("failed to create log directory %s: %w", logDir, err)
+	}
+	if err := pruneLogs(logDir, maxLogFiles-1); err != nil {
+		return fmt.Errorf("failed to prune logs: %w", err)
+	}
+	logFile = filepath.Join(logDir, logFileName(time.Now(), os.Getpid(), cmd.Name()))
+	file, err := openRotatingFile(logFile, maxLogFileSize)
 	if err != nil {
 		return fmt.Errorf("failed to open log file %s: %w", logFile, err)
 	}
-	writers = append(writers, file)
+	writers := []io.Writer{file}
 
-	if len(writers) == 0 {
-		fmt.Fprintf(os.Stderr, "%s Logging disabled. Set CONTAINER_USE_STDERR_FILE and CONTAINER_USE_LOG_LEVEL environment variables\n", time.Now().Format(time.DateTime))
+	// Logs used to go to a single file, which scripts may still rely on.
+	if path, ok := os.LookupEnv("CONTAINER_USE_STDERR_FILE"); ok {
+		legacy, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file %s: %w", path, err)
+		}
+		writers = append(writers, legacy)
 	}
 
-	logLevel := parseLogLevel(os.Getenv("CONTAINER_USE_LOG_LEVEL"))
 	logWriter = io.MultiWriter(writers...)
 	handler := slog.NewTextHandler(logWriter, &slog.HandlerOptions{
-		Level: logLevel,
+		Level: level,
 	})
 	slog.SetDefault(slog.New(handler))
+	slog.Debug("container-use started", "version", version, "args", os.Args[1:])
+
+	return nil
+}
+
+// logFileName names the log of an invocation so the names sort by time.
+func logFileName(startedAt time.Time, pid int, command string) string {
+	return fmt.Sprintf("%s-%d-%s.log", startedAt.UTC().Format("20060102T150405.000"), pid, command)
+}
+
+// logCommand returns the command of an invocation from the name of its log.
+func logCommand(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), ".log")
+	parts := strings.SplitN(name, "-", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
+
+// listLogs returns the invocation logs, oldest first.
+func listLogs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var logs []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			logs = append(logs, filepath.Join(dir, entry.Name()))
+		}
+	}
+	slices.Sort(logs)
+	return logs, nil
+}
+
+// previousLogs returns the logs of the invocations before the current one, oldest first.
+func previousLogs() ([]string, error) {
+	logs, err := listLogs(logDir)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(logs, func(log string) bool { return log == logFile }), nil
+}
+
+// readRecentLogs returns the end of the logs of the previous invocations, up to about n bytes, each one
+// headed with its name.
+func readRecentLogs(n int64) ([]byte, error) {
+	logs, err := previousLogs()
+	if err != nil {
+		return nil, err
+	}
+	var parts [][]byte
+	var size int64
+	for i := len(logs) - 1; i >= 0 && size < n; i-- {
+		content, err := readTail(logs[i], n-size)
+		if err != nil {
+			return nil, err
+		}
+		part := append([]byte(fmt.Sprintf("==> %s <==\n", filepath.Base(logs[i]))), content...)
+		parts = append(parts, part)
+		size += int64(len(part))
+	}
+	if len(parts) == 0 {
+		return nil, os.ErrNotExist
+	}
+	slices.Reverse(parts)
+	return slices.Concat(parts...), nil
+}
+
+// pruneLogs removes the oldest invocation logs, with their rotated part, to keep the given number.
+func pruneLogs(dir string, keep int) error {
+	logs, err := listLogs(dir)
+	if err != nil {
+		return err
+	}
+	if len(logs) <= keep {
+		return nil
+	}
+	var errs []error
+	for _, log := range logs[:len(logs)-keep] {
+		for _, path := range []string{log + ".1", log} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rotatingFile is a file that is moved to <file>.1 and started over when it grows past its maximum size.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
 
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = stat.Size()
 	return nil
 }
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	f, err := openRotatingFile(path, 10)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "third\n", string(content))
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(rotated), "only one rotated part is kept")
+}
+
+func TestPruneLogs(t *testing.T) {
+	dir := t.TempDir()
+	startedAt := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+	var names []string
+	for i, command := range []string{"stdio", "debug-bundle", "exec", "list"} {
+		name := logFileName(startedAt.Add(time.Duration(i)*time.Minute), 100+i, command)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(command), 0644))
+		names = append(names, name)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, names[0]+".1"), []byte("stdio"), 0644))
+	assert.Equal(t, "debug-bundle", logCommand(names[1]))
+
+	require.NoError(t, pruneLogs(dir, 2))
+	logs, err := listLogs(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, names[2]), filepath.Join(dir, names[3])}, logs)
+	assert.NoFileExists(t, filepath.Join(dir, names[0]+".1"))
+}
+
+func TestPrintSelfLogs(t *testing.T) {
+	oldDir, oldFile := logDir, logFile
+	t.Cleanup(func() { logDir, logFile = oldDir, oldFile })
+	logDir = t.TempDir()
+
+	startedAt := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+	write := func(i int, command, content string) string {
+		path := filepath.Join(logDir, logFileName(startedAt.Add(time.Duration(i)*time.Minute), 100+i, command))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	write(0, "stdio", "time=2025-07-01T10:00:00Z level=INFO msg=\"connecting to dagger\"\n"+
+		"1   : connect\n"+
+		"time=2025-07-01T10:00:01Z level=ERROR msg=\"Error starting dagger\" error=\"no engine\"\n")
+	write(1, "exec", "time=2025-07-01T10:01:00Z level=WARN msg=\"slow\"\n")
+	logFile = write(2, "logs", "time=2025-07-01T10:02:00Z level=INFO msg=\"current\"\n")
+
+	var out bytes.Buffer
+	require.NoError(t, printSelfLogs(&out, selfLogOptions{Invocations: 1}))
+	assert.Contains(t, out.String(), "-exec.log <==\n")
+	assert.Contains(t, out.String(), "msg=\"slow\"")
+	assert.NotContains(t, out.String(), "current", "the current invocation is left out")
+
+	out.Reset()
+	level := slog.LevelWarn
+	require.NoError(t, printSelfLogs(&out, selfLogOptions{Invocations: 1, Command: "stdio", Level: &level}))
+	assert.Contains(t, out.String(), "Error starting dagger")
+	assert.NotContains(t, out.String(), "connecting to dagger")
+	assert.NotContains(t, out.String(), "1   : connect")
+
+	out.Reset()
+	require.NoError(t, printSelfLogs(&out, selfLogOptions{List: true}))
+	assert.Contains(t, out.String(), "stdio")
+	assert.Contains(t, out.String(), "exec")
+	assert.NotContains(t, out.String(), "logs ")
+}
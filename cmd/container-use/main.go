@@ -4,6 +4,8 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 
 	"github.com/charmbracelet/fang"
@@ -19,17 +21,28 @@ var (
 		Short: "Containerized environments for coding agents",
 		Long: `Container Use creates isolated development environments for AI agents.
 Each environment runs in its own container with dedicated git branches.`,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if err := setupMessages(); err != nil {
+				return err
+			}
+			return setupLogger(cmd)
+		},
 	}
 )
 
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&noInteractive, "no-interactive", false, "Never prompt; fail instead when an environment can't be determined")
+	rootCmd.PersistentFlags().StringVar(&lang, "lang", "", "Language of the messages: en, ja or de (default: from CONTAINER_USE_LANG, LC_ALL, LC_MESSAGES or LANG)")
+	rootCmd.PersistentFlags().StringVar(&verbosity, "verbosity", defaultVerbosity(), "Level of the logs written to the log file: debug, info, warn or error (see 'container-use logs --self')")
+}
+
 func main() {
 	ctx := context.Background()
 	setupSignalHandling()
 
-	if err := setupLogger(); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to setup logger: %v\n", err)
-		os.Exit(1)
-	}
+	// Commands set up their log file before running: until then, and for shell completions, which don't
+	// run as commands, logs are discarded.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
 
 	// FIXME(aluzzardi): `fang` misbehaves with the `stdio` command.
 	// It hangs on Ctrl-C. Traced the hang back to `lipgloss.HasDarkBackground(os.Stdin, os.Stdout)`
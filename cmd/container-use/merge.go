@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
@@ -20,6 +26,16 @@ var mergeCmd = &cobra.Command{
 This makes the agent's work permanent in your repository.
 Your working directory will be automatically stashed and restored.
 
+Before merging, the current branch is checked against its upstream branch: if
+the upstream branch is protected, or has commits your branch doesn't, you
+couldn't push the merge. You're then pointed to the apply and pull request flow,
+and asked to confirm (or --force is required when not running interactively).
+Protection is looked up on GitHub when GITHUB_TOKEN or GH_TOKEN is set, and in
+the container-use.protectedBranch git config (glob patterns) for other hosts.
+
+With --push, the merged branch is pushed to its upstream branch, or to a
+branch of the same name on origin if it has none.
+
 If no environment is specified, automatically selects from environments 
 that are descendants of the current HEAD.`,
 	Args:              cobra.MaximumNArgs(1),
@@ -32,9 +48,20 @@ container-use merge -d backend-api
 container-use merge --delete backend-api
 
 # Auto-select environment
-container-use merge`,
-	RunE: func(app *cobra.Command, args []string) error {
+container-use merge
+
+# Merge and push the result
+container-use merge backend-api --push
+
+# Mark release branches as protected for hosts other than GitHub
+git config --add container-use.protectedBranch 'release/*'
+
+# Stream progress events as NDJSON
+container-use merge backend-api --json-stream`,
+	RunE: func(app *cobra.Command, args []string) (rerr error) {
 		ctx := app.Context()
+		stream := jsonStreamFromFlags(app, os.Stdout)
+		defer func() { stream.Fail(rerr) }()
 
 		// Ensure we're in a git repository
 		repo, err := repository.Open(ctx, ".")
@@ -47,14 +74,128 @@ container-use merge`,
 			return err
 		}
 
-		if err := repo.Merge(ctx, envID, os.Stdout); err != nil {
+		target, err := repo.MergeTarget(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to inspect the current branch: %w", err)
+		}
+		push, _ := app.Flags().GetBool("push")
+		if push && target.Branch == "" {
+			return errors.New("can't push the merge: HEAD is detached")
+		}
+		lookupBranchProtection(ctx, target)
+		if force, _ := app.Flags().GetBool("force"); !force {
+			if err := confirmMergeTarget(target, envID, stream == nil); err != nil {
+				return err
+			}
+		}
+
+		// Keep stdout for events when streaming.
+		var gitOutput io.Writer = os.Stdout
+		if stream != nil {
+			gitOutput = os.Stderr
+		}
+		if err := repo.Merge(ctx, envID, gitOutput); err != nil {
 			return fmt.Errorf("failed to merge environment: %w", err)
 		}
+		stream.Emit("merged", map[string]any{"environment_id": envID})
+
+		var pushedRef, pushedCommit string
+		if push {
+			if pushedRef, pushedCommit, err = repo.PushMergeTarget(ctx, target, "origin", gitOutput); err != nil {
+				return fmt.Errorf("environment '%s' merged but push failed: %w", envID, err)
+			}
+			stream.Emit("pushed", map[string]any{"ref": pushedRef, "commit": pushedCommit})
+			if stream == nil {
+				fmt.Printf("Pushed %s to %s\n", pushedCommit[:min(len(pushedCommit), 12)], pushedRef)
+			}
+		}
 
-		return deleteAfterMerge(ctx, repo, envID, mergeDelete, "merged")
+		if stream == nil {
+			return deleteAfterMerge(ctx, repo, envID, mergeDelete, "merged")
+		}
+		if mergeDelete {
+			if err := repo.Delete(ctx, envID); err != nil {
+				return fmt.Errorf("environment '%s' merged but delete failed: %w", envID, err)
+			}
+			stream.Emit("deleted", map[string]any{"environment_id": envID})
+		}
+		stream.Result(&mergeResult{
+			EnvironmentID: envID,
+			Merged:        true,
+			Deleted:       mergeDelete,
+			PushedRef:     pushedRef,
+			PushedCommit:  pushedCommit,
+		})
+		return nil
 	},
 }
 
+// lookupBranchProtection marks the target as protected if its upstream branch is protected on GitHub.
+// The lookup is best effort: without a token, or if GitHub can't be reached, the git config is all there is.
+func lookupBranchProtection(ctx context.Context, target *repository.MergeTarget) {
+	githubRepository := githubRepositoryFromURL(target.RemoteURL)
+	if target.Protected || githubRepository == "" || (os.Getenv("GITHUB_TOKEN") == "" && os.Getenv("GH_TOKEN") == "") {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	protected, err := githubBranchProtected(ctx, githubRepository, target.RemoteBranch)
+	if err != nil {
+		slog.Warn("Failed to look up branch protection", "repository", githubRepository, "branch", target.RemoteBranch, "err", err)
+		return
+	}
+	if protected {
+		target.Protected = true
+		target.ProtectedBy = "GitHub branch protection on " + githubRepository
+	}
+}
+
+// mergeResult is the result of a merge reported by --json-stream.
+type mergeResult struct {
+	EnvironmentID string `json:"environment_id"`
+	Merged        bool   `json:"merged"`
+	Deleted       bool   `json:"deleted"`
+	// PushedRef and PushedCommit are set with --push.
+	PushedRef    string `json:"pushed_ref,omitempty"`
+	PushedCommit string `json:"pushed_commit,omitempty"`
+}
+
+// confirmMergeTarget warns when the merge couldn't be pushed to the upstream branch, points to the
+// apply and pull request flow instead, and asks whether to merge anyway.
+func confirmMergeTarget(target *repository.MergeTarget, envID string, prompt bool) error {
+	var problem string
+	switch {
+	case target.Protected:
+		problem = fmt.Sprintf("%s is protected (%s): you won't be able to push the merge", target.Upstream(), target.ProtectedBy)
+		if target.Remote == "" {
+			problem = fmt.Sprintf("%s is protected (%s): you won't be able to push the merge", target.Branch, target.ProtectedBy)
+		}
+	case target.Diverged():
+		problem = fmt.Sprintf("%s has %d commit(s) your branch %s doesn't: pull them before merging, or the push will be rejected", target.Upstream(), target.Behind, target.Branch)
+	default:
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "⚠️  %s.\n\n", problem)
+	fmt.Fprintln(os.Stderr, "To propose the changes through a pull request instead:")
+	fmt.Fprintf(os.Stderr, "  git switch -c %s\n", envID)
+	fmt.Fprintf(os.Stderr, "  container-use apply %s\n", envID)
+	fmt.Fprintf(os.Stderr, "  git commit && git push -u origin %s\n\n", envID)
+
+	if !prompt || !isInteractive() {
+		return errors.New("refusing to merge: use --force to merge anyway")
+	}
+	fmt.Fprintf(os.Stderr, "Merge into %s anyway? [y/N] ", target.Branch)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return errors.New("merge cancelled")
+	}
+	return nil
+}
+
 func deleteAfterMerge(ctx context.Context, repo *repository.Repository, env string, delete bool, verb string) error {
 	if !delete {
 		fmt.Printf("Environment '%s' %s successfully.\n", env, verb)
@@ -69,6 +210,10 @@ func deleteAfterMerge(ctx context.Context, repo *repository.Repository, env stri
 
 func init() {
 	mergeCmd.Flags().BoolVarP(&mergeDelete, "delete", "d", false, "Delete the environment after successful merge")
+	mergeCmd.Flags().Bool("push", false, "Push the merged branch to its upstream branch")
+	mergeCmd.Flags().Bool("force", false, "Merge even if the upstream branch is protected or has diverged")
+	mergeCmd.Flags().Bool("json-stream", false, "Output progress events and the result as newline-delimited JSON")
+	withSchema(mergeCmd, &mergeResult{})
 
 	rootCmd.AddCommand(mergeCmd)
 }
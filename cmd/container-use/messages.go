@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/dagger/container-use/messages"
+	"github.com/dagger/container-use/repository"
+)
+
+// lang is the language of the user-facing messages, set with --lang.
+var lang string
+
+// messagesDir holds the user's message catalogs, overriding the built-in messages or adding languages.
+var messagesDir = filepath.Join(repository.DataDir(), "messages")
+
+// setupMessages selects the catalog of the user-facing messages: that of --lang, or else of the user's
+// locale, falling back to English when it isn't supported.
+func setupMessages() error {
+	if lang != "" {
+		catalog, err := messages.Load(lang, messagesDir)
+		if err != nil {
+			return err
+		}
+		messages.SetDefault(catalog)
+		return nil
+	}
+	catalog, err := messages.Load(messages.DetectLocale(), messagesDir)
+	if err != nil {
+		slog.Debug("using English messages", "err", err)
+		if catalog, err = messages.Load(messages.DefaultLocale, messagesDir); err != nil {
+			return err
+		}
+	}
+	messages.SetDefault(catalog)
+	return nil
+}
+
+// printNextStep prints a suggested command, after the message of key describing it.
+func printNextStep(w io.Writer, key, command string) {
+	fmt.Fprintf(w, "  %-17s%s\n", messages.Get(key)+":", command)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// multiplexerSession is the tmux/zellij session holding the terminals opened by container-use.
+const multiplexerSession = "container-use"
+
+// multiplexerTerminal opens an environment's terminal in a window of a terminal multiplexer session,
+// so it can be detached from and reattached to, and several windows can share an environment.
+type multiplexerTerminal struct {
+	// Session is the multiplexer session holding the windows.
+	Session string
+	// EnvID is the environment the window opens a terminal into.
+	EnvID string
+	// Dir is the repository the terminal command runs from.
+	Dir string
+	// Command runs the environment's terminal, e.g. ["container-use", "terminal", "fancy-mallard"].
+	Command []string
+	// NewWindow opens another window even if the environment already has one.
+	NewWindow bool
+}
+
+// window returns the name of the environment's windows, prefixed so they stand out from other windows.
+func (t *multiplexerTerminal) window() string {
+	return "cu-" + t.EnvID
+}
+
+func newMultiplexerTerminal(envID string, newWindow bool) (*multiplexerTerminal, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find container-use executable: %w", err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return &multiplexerTerminal{
+		Session:   multiplexerSession,
+		EnvID:     envID,
+		Dir:       dir,
+		Command:   []string{self, "terminal", envID},
+		NewWindow: newWindow,
+	}, nil
+}
+
+// tmuxCommands returns the tmux commands opening (or selecting) the environment's window.
+// Attaching to the session is left to attachTmux.
+func (t *multiplexerTerminal) tmuxCommands(sessionExists, windowExists bool) [][]string {
+	target := t.Session + ":" + t.window()
+	switch {
+	case !sessionExists:
+		return [][]string{append([]string{"tmux", "new-session", "-d", "-s", t.Session, "-n", t.window(), "-c", t.Dir, "--"}, t.Command...)}
+	case windowExists && !t.NewWindow:
+		return [][]string{{"tmux", "select-window", "-t", target}}
+	default:
+		return [][]string{append([]string{"tmux", "new-window", "-t", t.Session + ":", "-n", t.window(), "-c", t.Dir, "--"}, t.Command...)}
+	}
+}
+
+func (t *multiplexerTerminal) openTmux() error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux is not installed: %w", err)
+	}
+
+	sessionExists := exec.Command("tmux", "has-session", "-t", "="+t.Session).Run() == nil
+	windowExists := false
+	if sessionExists {
+		out, err := exec.Command("tmux", "list-windows", "-t", "="+t.Session, "-F", "#{window_name}").Output()
+		if err != nil {
+			return fmt.Errorf("failed to list tmux windows: %w", err)
+		}
+		for name := range strings.Lines(string(out)) {
+			if strings.TrimSpace(name) == t.window() {
+				windowExists = true
+			}
+		}
+	}
+
+	for _, args := range t.tmuxCommands(sessionExists, windowExists) {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed: %w: %s", strings.Join(args[:2], " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// Inside tmux, switch the current client instead of nesting sessions.
+	if os.Getenv("TMUX") != "" {
+		return runAttached("tmux", "switch-client", "-t", t.Session)
+	}
+	return runAttached("tmux", "attach-session", "-t", t.Session)
+}
+
+// zellijLayout returns a layout running the terminal command in a single pane.
+func (t *multiplexerTerminal) zellijLayout() string {
+	args := make([]string, 0, len(t.Command)-1)
+	for _, arg := range t.Command[1:] {
+		args = append(args, strconv.Quote(arg))
+	}
+	return fmt.Sprintf("layout {\n    pane command=%s cwd=%s close_on_exit=true {\n        args %s\n    }\n}\n",
+		strconv.Quote(t.Command[0]), strconv.Quote(t.Dir), strings.Join(args, " "))
+}
+
+func (t *multiplexerTerminal) openZellij() error {
+	if _, err := exec.LookPath("zellij"); err != nil {
+		return fmt.Errorf("zellij is not installed: %w", err)
+	}
+
+	layout, err := os.CreateTemp("", "container-use-layout-*.kdl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(layout.Name())
+	if _, err := layout.WriteString(t.zellijLayout()); err != nil {
+		layout.Close()
+		return err
+	}
+	layout.Close()
+
+	sessions, _ := exec.Command("zellij", "list-sessions", "--short", "--no-formatting").Output()
+	sessionExists := false
+	for name := range strings.Lines(string(sessions)) {
+		if strings.TrimSpace(name) == t.Session {
+			sessionExists = true
+		}
+	}
+	if !sessionExists {
+		if out, err := exec.Command("zellij", "attach", "--create-background", t.Session).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to create zellij session: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	zellij := func(args ...string) error {
+		args = append([]string{"--session", t.Session, "action"}, args...)
+		if out, err := exec.Command("zellij", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("zellij %s failed: %w: %s", args[2], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	windowExists := false
+	if tabs, err := exec.Command("zellij", "--session", t.Session, "action", "query-tab-names").Output(); err == nil {
+		for name := range strings.Lines(string(tabs)) {
+			if strings.TrimSpace(name) == t.window() {
+				windowExists = true
+			}
+		}
+	}
+	if windowExists && !t.NewWindow {
+		err = zellij("go-to-tab-name", t.window())
+	} else {
+		err = zellij("new-tab", "--name", t.window(), "--layout", layout.Name())
+	}
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("ZELLIJ_SESSION_NAME") == t.Session {
+		return nil
+	}
+	if os.Getenv("ZELLIJ") != "" {
+		return errors.New("already inside another zellij session: attach with 'zellij attach " + t.Session + "'")
+	}
+	return runAttached("zellij", "attach", t.Session)
+}
+
+// runAttached runs a command attached to the current terminal.
+func runAttached(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiplexerTerminal(t *testing.T) {
+	mux := &multiplexerTerminal{
+		Session: "container-use",
+		EnvID:   "fancy-mallard",
+		Dir:     "/src/project",
+		Command: []string{"/usr/local/bin/container-use", "terminal", "fancy-mallard"},
+	}
+
+	assert.Equal(t, [][]string{{
+		"tmux", "new-session", "-d", "-s", "container-use", "-n", "cu-fancy-mallard", "-c", "/src/project", "--",
+		"/usr/local/bin/container-use", "terminal", "fancy-mallard",
+	}}, mux.tmuxCommands(false, false))
+
+	assert.Equal(t, [][]string{{"tmux", "select-window", "-t", "container-use:cu-fancy-mallard"}}, mux.tmuxCommands(true, true),
+		"an existing window is reattached")
+
+	mux.NewWindow = true
+	assert.Equal(t, [][]string{{
+		"tmux", "new-window", "-t", "container-use:", "-n", "cu-fancy-mallard", "-c", "/src/project", "--",
+		"/usr/local/bin/container-use", "terminal", "fancy-mallard",
+	}}, mux.tmuxCommands(true, true))
+
+	assert.Equal(t, `layout {
+    pane command="/usr/local/bin/container-use" cwd="/src/project" close_on_exit=true {
+        args "terminal" "fancy-mallard"
+    }
+}
+`, mux.zellijLayout())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var orphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "Find and purge the data of deleted or moved repositories",
+	Long: `List the data container-use keeps for repositories that no longer exist: when
+a repository is deleted or moved, its fork, the worktrees of its environments and
+their event logs are left behind in container-use's data directory.
+
+A fork is orphaned when none of the repositories that used it exists anymore, or
+uses it anymore. Forks of the same origin are shared by its clones. Forks last
+used by an older version of container-use don't record their repositories: they
+are listed as unknown until one of their repositories is used again.
+
+Use --purge to delete the orphans. This can be run from any directory.`,
+	Args: cobra.NoArgs,
+	Example: `# List the orphans
+container-use orphans
+
+# Delete them
+container-use orphans --purge`,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+		purge, _ := app.Flags().GetBool("purge")
+		jsonOutput, _ := app.Flags().GetBool("json")
+
+		report, err := repository.FindOrphans(ctx, repository.DataDir())
+		if err != nil {
+			return fmt.Errorf("failed to find orphans: %w", err)
+		}
+
+		failed := map[string]string{}
+		if purge {
+			for _, orphan := range report.Orphans {
+				if err := repository.PurgeOrphan(orphan); err != nil {
+					failed[orphan.Fork] = err.Error()
+				}
+			}
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(&orphansResult{OrphanReport: report, Purged: purge, Failed: failed}); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		} else {
+			printOrphans(report, purge, failed)
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to purge %d orphan(s)", len(failed))
+		}
+		return nil
+	},
+}
+
+// orphansResult is the JSON output of orphans.
+type orphansResult struct {
+	*repository.OrphanReport
+	Purged bool `json:"purged"`
+	// Failed are the errors of the orphans that couldn't be purged, by fork.
+	Failed map[string]string `json:"failed"`
+}
+
+func printOrphans(report *repository.OrphanReport, purge bool, failed map[string]string) {
+	if len(report.Orphans) == 0 {
+		fmt.Println("No orphans found.")
+	}
+	for _, orphan := range report.Orphans {
+		fmt.Printf("%s (%s)\n", orphan.Fork, humanize.Bytes(uint64(orphan.Size)))
+		if len(orphan.Sources) > 0 {
+			fmt.Printf("  repositories: %s\n", strings.Join(orphan.Sources, ", "))
+		} else {
+			fmt.Println("  fork already deleted")
+		}
+		if len(orphan.Environments) > 0 {
+			fmt.Printf("  environments: %s\n", strings.Join(orphan.Environments, ", "))
+		}
+		if err, ok := failed[orphan.Fork]; ok {
+			fmt.Printf("  failed to purge: %s\n", err)
+		}
+	}
+	for _, fork := range report.Unknown {
+		fmt.Printf("%s (unknown repositories)\n", fork)
+	}
+
+	if len(report.Orphans) == 0 {
+		return
+	}
+	if !purge {
+		fmt.Printf("\n%d orphan(s) using %s. Run 'container-use orphans --purge' to delete them.\n", len(report.Orphans), humanize.Bytes(uint64(report.Size())))
+		return
+	}
+	fmt.Printf("\nPurged %d orphan(s), freeing %s.\n", len(report.Orphans)-len(failed), humanize.Bytes(uint64(report.Size())))
+	fmt.Println("The Dagger engine frees the containers of their environments when it collects its cache; run 'dagger core engine local-cache prune' to free them now.")
+}
+
+func init() {
+	orphansCmd.Flags().Bool("purge", false, "Delete the orphans")
+	orphansCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(orphansCmd, &orphansResult{})
+	rootCmd.AddCommand(orphansCmd)
+}
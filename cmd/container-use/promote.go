@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/charmbracelet/huh"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote [<env>]",
+	Short: "Add the tools an agent installed in an environment to the configuration",
+	Long: `Find the commands that installed tools in an environment, such as 'apt-get install -y jq'
+or 'pip install ruff', and add them to the repository's environment configuration so new
+environments have the tools from the start.
+
+Commands installing from the source, such as 'pip install -r requirements.txt', are added
+to the install commands, the others to the setup commands. Commands already in the
+configuration and commands that failed are skipped.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Pick the commands to promote
+container-use promote fancy-mallard
+
+# Promote all the install commands without prompting
+container-use promote fancy-mallard --all
+
+# Show the commands that would be promoted
+container-use promote fancy-mallard --dry-run`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		commands, err := repo.InstallCommands(envID)
+		if err != nil {
+			return fmt.Errorf("failed to read the history of %s: %w", envID, err)
+		}
+
+		config := environment.DefaultConfig()
+		if err := config.Load(repo.SourcePath()); err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		commands = slices.DeleteFunc(commands, func(command *repository.InstallCommand) bool {
+			return slices.Contains(config.SetupCommands, command.Command) || slices.Contains(config.InstallCommands, command.Command)
+		})
+
+		all, _ := app.Flags().GetBool("all")
+		dryRun, _ := app.Flags().GetBool("dry-run")
+		jsonOutput, _ := app.Flags().GetBool("json")
+
+		if len(commands) > 0 && !all && !dryRun {
+			if !isInteractive() {
+				if !jsonOutput {
+					printInstallCommands(commands)
+				}
+				return errors.New("use --all to promote these commands without prompting")
+			}
+			if commands, err = promptInstallCommands(commands); err != nil {
+				return err
+			}
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(commands); err != nil {
+				return err
+			}
+		}
+		if len(commands) == 0 {
+			if !jsonOutput {
+				fmt.Printf("No install commands to promote from %s\n", envID)
+			}
+			return nil
+		}
+		if dryRun {
+			if !jsonOutput {
+				printInstallCommands(commands)
+			}
+			return nil
+		}
+
+		if err := updateConfig(app, func(config *environment.EnvironmentConfig) error {
+			for _, command := range commands {
+				if command.Install {
+					config.InstallCommands = append(config.InstallCommands, command.Command)
+				} else {
+					config.SetupCommands = append(config.SetupCommands, command.Command)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if !jsonOutput {
+			printInstallCommands(commands)
+			fmt.Printf("Promoted %d command(s) from %s to the environment configuration\n", len(commands), envID)
+		}
+		return nil
+	},
+}
+
+func printInstallCommands(commands []*repository.InstallCommand) {
+	for _, command := range commands {
+		kind := "setup"
+		if command.Install {
+			kind = "install"
+		}
+		fmt.Printf("  %-8s %s\n", kind, command.Command)
+	}
+}
+
+// promptInstallCommands lets the user pick the commands to promote, all selected by default.
+func promptInstallCommands(commands []*repository.InstallCommand) ([]*repository.InstallCommand, error) {
+	var options []huh.Option[int]
+	for i, command := range commands {
+		options = append(options, huh.NewOption(command.Command, i).Selected(true))
+	}
+
+	var selected []int
+	prompt := huh.NewMultiSelect[int]().
+		Title("Select the commands to add to the environment configuration:").
+		Options(options...).
+		Value(&selected)
+	if err := prompt.Run(); err != nil {
+		return nil, err
+	}
+
+	picked := []*repository.InstallCommand{}
+	for _, i := range selected {
+		picked = append(picked, commands[i])
+	}
+	return picked, nil
+}
+
+func init() {
+	promoteCmd.Flags().Bool("all", false, "Promote all the install commands without prompting")
+	promoteCmd.Flags().Bool("dry-run", false, "Show the commands that would be promoted without changing the configuration")
+	promoteCmd.Flags().Bool("json", false, "Output the promoted commands as JSON")
+	withSchema(promoteCmd, []*repository.InstallCommand{})
+
+	rootCmd.AddCommand(promoteCmd)
+}
@@ -1,106 +1,187 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/dagger/container-use/messages"
 	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
 	"github.com/karrick/tparse"
 	"github.com/spf13/cobra"
 )
 
 var pruneCmd = &cobra.Command{
-	Use:   "prune",
-	Short: "Delete environments older than specified age",
-	Long: `Delete environments that haven't been updated within the specified time period.
-This permanently removes old environments and their associated resources including
-branches and container state. By default, environments older than 1 week are pruned.
+	Use:     "prune",
+	Aliases: []string{"gc"},
+	Short:   "Delete environments inactive for longer than specified age",
+	Long: `Delete environments without activity within the specified time period: no
+change, command or tool call. This permanently removes old environments and
+their associated resources: branches, worktrees, remote branches, and the git
+notes of their commits holding their container state, command logs and test
+results. Notes of commits that are also in your branches, such as merged ones,
+are kept. By default, environments inactive for 1 week are pruned.
+
+Each environment's branch and notes are removed at once: if that fails, the
+environment is left intact.
 
 Use --dry-run to see what would be deleted without actually deleting anything.
-Use --before to configure the age threshold (e.g., 24h, 3d, 2w, 1mo).`,
-	Example: `# Prune environments older than 1 week (default)
+Use --older-than to configure the age threshold (e.g., 24h, 3d, 2w, 1mo).
+Use --merged-only to only delete environments whose changes are in the history
+of the current branch.`,
+	Example: `# Prune environments inactive for 1 week (default)
 container-use prune
 
-# Prune environments older than 3 days
-container-use prune --before 3d
+# Prune environments inactive for 14 days
+container-use gc --older-than 14d
+
+# Prune the environments merged into the current branch, whatever their age
+container-use gc --merged-only --older-than 0s
 
 # See what would be pruned without deleting
 container-use prune --dry-run
 
-# Prune environments older than 2 weeks
-container-use prune --before 2w`,
-	RunE: func(cmd *cobra.Command, args []string) error {
+# Stream progress events as NDJSON
+container-use gc --json-stream`,
+	RunE: func(cmd *cobra.Command, args []string) (rerr error) {
 		ctx := cmd.Context()
-		before, _ := cmd.Flags().GetString("before")
+		olderThan, _ := cmd.Flags().GetString("older-than")
+		if cmd.Flags().Changed("before") && !cmd.Flags().Changed("older-than") {
+			olderThan, _ = cmd.Flags().GetString("before")
+		}
+		if olderThan == "" {
+			olderThan = "1w"
+		}
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		mergedOnly, _ := cmd.Flags().GetBool("merged-only")
+		stream := jsonStreamFromFlags(cmd, os.Stdout)
+		defer func() { stream.Fail(rerr) }()
 
 		repo, err := repository.Open(ctx, ".")
 		if err != nil {
 			return fmt.Errorf("failed to open repository: %w", err)
 		}
 
-		var duration time.Duration
-		if before == "" {
-			duration = 7 * 24 * time.Hour
-		} else {
-			targetTime, err := tparse.ParseNow(time.RFC3339, "now-"+before)
-			if err != nil {
-				return fmt.Errorf("invalid --before format: %w", err)
-			}
-			duration = time.Since(targetTime)
-		}
-
-		envs, err := repo.List(ctx)
+		targetTime, err := tparse.ParseNow(time.RFC3339, "now-"+olderThan)
 		if err != nil {
-			return fmt.Errorf("failed to list environments: %w", err)
+			return fmt.Errorf("invalid --older-than format: %w", err)
 		}
+		duration := time.Since(targetTime).Round(time.Second)
 
-		if len(envs) == 0 {
-			fmt.Println("No environments found.")
-			return nil
+		candidates, err := repo.GCCandidates(ctx, repository.GCOptions{OlderThan: duration, MergedOnly: mergedOnly})
+		if err != nil {
+			return err
 		}
-
 		cutoff := time.Now().Add(-duration)
-		var envsToPrune []string
 
-		for _, env := range envs {
-			if env.State.UpdatedAt.Before(cutoff) {
-				envsToPrune = append(envsToPrune, env.ID)
-			}
+		if stream != nil {
+			return streamPrune(ctx, stream, repo, candidates, cutoff, dryRun)
 		}
 
-		if len(envsToPrune) == 0 {
-			fmt.Printf("No environments older than %s found.\n", duration)
+		selection := messages.Get("prune.inactive", duration)
+		if mergedOnly {
+			selection = messages.Get("prune.merged_inactive", duration)
+		}
+		if len(candidates) == 0 {
+			fmt.Println(messages.Get("prune.none", selection))
 			return nil
 		}
 
 		if dryRun {
-			fmt.Printf("Would prune %d environment(s) older than %s:\n", len(envsToPrune), duration)
-			for _, envID := range envsToPrune {
-				fmt.Printf("  - %s\n", envID)
+			fmt.Println(messages.Get("prune.would_prune", len(candidates), selection))
+			for _, candidate := range candidates {
+				fmt.Printf("  - %s\n", describeCandidate(candidate))
 			}
 			return nil
 		}
 
-		fmt.Printf("Pruning %d environment(s) older than %s...\n", len(envsToPrune), duration)
+		fmt.Println(messages.Get("prune.pruning", len(candidates), selection))
 
 		var deletedCount int
-		for _, envID := range envsToPrune {
-			if err := repo.Delete(ctx, envID); err != nil {
-				fmt.Printf("Failed to delete environment '%s': %v\n", envID, err)
+		for _, candidate := range candidates {
+			if err := repo.Collect(ctx, candidate.ID); err != nil {
+				fmt.Println(messages.Get("prune.delete_failed", candidate.ID, err))
 			} else {
-				fmt.Printf("Environment '%s' deleted successfully.\n", envID)
+				fmt.Println(messages.Get("prune.deleted", candidate.ID))
 				deletedCount++
 			}
 		}
 
-		fmt.Printf("Successfully deleted %d environment(s).\n", deletedCount)
+		fmt.Println(messages.Get("prune.summary", deletedCount))
+		if deletedCount < len(candidates) {
+			return fmt.Errorf("failed to delete %d environment(s)", len(candidates)-deletedCount)
+		}
 		return nil
 	},
 }
 
+// describeCandidate describes an environment to prune, e.g. "fancy-mallard (last active 3 weeks ago, merged)".
+func describeCandidate(candidate *repository.GCCandidate) string {
+	details := messages.Get("prune.last_active", humanize.Time(candidate.LastActivityAt))
+	if candidate.Merged {
+		details += ", " + messages.Get("prune.merged")
+	}
+	return fmt.Sprintf("%s (%s)", candidate.ID, details)
+}
+
+// pruneResult is the result of a prune reported by --json-stream.
+type pruneResult struct {
+	Cutoff     time.Time `json:"cutoff"`
+	DryRun     bool      `json:"dry_run"`
+	Candidates []string  `json:"candidates"`
+	// Environments describes the candidates: their last activity and whether they're merged.
+	Environments []*repository.GCCandidate `json:"environments"`
+	Deleted      []string                  `json:"deleted"`
+	// Failed are the errors of the environments that couldn't be deleted, by environment.
+	Failed map[string]string `json:"failed"`
+}
+
+// streamPrune deletes the environments to prune, reporting each deletion as an event.
+func streamPrune(ctx context.Context, stream *jsonStream, repo *repository.Repository, candidates []*repository.GCCandidate, cutoff time.Time, dryRun bool) error {
+	envIDs := []string{}
+	for _, candidate := range candidates {
+		envIDs = append(envIDs, candidate.ID)
+	}
+	if candidates == nil {
+		candidates = []*repository.GCCandidate{}
+	}
+	deleted := []string{}
+	failed := map[string]string{}
+	if !dryRun {
+		for _, envID := range envIDs {
+			if err := repo.Collect(ctx, envID); err != nil {
+				failed[envID] = err.Error()
+				stream.Emit("delete-failed", map[string]any{"environment_id": envID, "error": err.Error()})
+				continue
+			}
+			deleted = append(deleted, envID)
+			stream.Emit("deleted", map[string]any{"environment_id": envID})
+		}
+	}
+
+	stream.Result(&pruneResult{
+		Cutoff:       cutoff.UTC(),
+		DryRun:       dryRun,
+		Candidates:   envIDs,
+		Environments: candidates,
+		Deleted:      deleted,
+		Failed:       failed,
+	})
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %d environment(s)", len(failed))
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(pruneCmd)
-	pruneCmd.Flags().String("before", "1w", "Delete environments older than this duration (e.g., 24h, 3d, 2w, 1mo)")
+	pruneCmd.Flags().String("older-than", "1w", "Delete environments inactive for this duration (e.g., 24h, 3d, 2w, 1mo)")
+	pruneCmd.Flags().String("before", "1w", "Delete environments inactive for this duration")
+	pruneCmd.Flags().MarkDeprecated("before", "use --older-than instead")
+	pruneCmd.Flags().Bool("merged-only", false, "Only delete environments whose changes are in the history of the current branch")
 	pruneCmd.Flags().Bool("dry-run", false, "Show what would be pruned without actually deleting")
+	pruneCmd.Flags().Bool("json-stream", false, "Output progress events and the result as newline-delimited JSON")
+	withSchema(pruneCmd, &pruneResult{})
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	// maxPullProgressLayers is the number of layers given their own progress bar, the others are summed up.
+	maxPullProgressLayers = 6
+	pullProgressBarWidth  = 30
+	// slowPullFactor is how many times slower than usual a pull is before suggesting to check the network.
+	slowPullFactor = 2
+)
+
+// pullProgress draws the progress of base image pulls on a terminal: a bar per layer and an ETA.
+// The engine doesn't report how many bytes it downloaded, so progress is estimated from how long
+// pulls usually take.
+type pullProgress struct {
+	mu       sync.Mutex
+	w        io.Writer
+	image    string
+	layers   []environment.ImageLayer
+	total    int64
+	estimate time.Duration
+	drawn    int
+	// shown is set once something was printed about the current pull.
+	shown bool
+}
+
+func newPullProgress(w io.Writer) *pullProgress {
+	return &pullProgress{w: w}
+}
+
+// Handle receives the progress events of a creation.
+func (p *pullProgress) Handle(eventType string, data map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch eventType {
+	case environment.EventImagePullStarted:
+		p.image, _ = data["image"].(string)
+		p.layers, _ = data["layers"].([]environment.ImageLayer)
+		p.total, _ = data["total_bytes"].(int64)
+		estimated, _ := data["estimated_ms"].(int64)
+		p.estimate = time.Duration(estimated) * time.Millisecond
+		p.shown = false
+	case environment.EventImagePullProgress:
+		elapsed, _ := data["elapsed_ms"].(int64)
+		p.draw(time.Duration(elapsed) * time.Millisecond)
+	case environment.EventRetry:
+		p.clear()
+		operation, _ := data["operation"].(string)
+		delay, _ := data["delay_ms"].(int64)
+		message, _ := data["error"].(string)
+		fmt.Fprintf(p.w, "⟳ Retrying %s in %s after a transient error: %s\n", operation, time.Duration(delay)*time.Millisecond, message)
+		p.shown = true
+	case environment.EventImagePulled:
+		if !p.shown {
+			// Cached: there was nothing to show.
+			return
+		}
+		p.clear()
+		duration, _ := data["duration_ms"].(int64)
+		usual, _ := data["usual_ms"].(int64)
+		fmt.Fprintln(p.w, pullSummary(p.image, time.Duration(duration)*time.Millisecond, time.Duration(usual)*time.Millisecond))
+	}
+}
+
+func (p *pullProgress) clear() {
+	for range p.drawn {
+		fmt.Fprint(p.w, "\x1b[1A\x1b[2K")
+	}
+	p.drawn = 0
+}
+
+func (p *pullProgress) draw(elapsed time.Duration) {
+	p.clear()
+	lines := p.lines(elapsed)
+	for _, line := range lines {
+		fmt.Fprintln(p.w, line)
+	}
+	p.drawn = len(lines)
+	p.shown = true
+}
+
+// lines renders the pull after elapsed. Layers are assumed to download in order at a constant rate.
+func (p *pullProgress) lines(elapsed time.Duration) []string {
+	header := fmt.Sprintf("Pulling %s", p.image)
+	if p.total > 0 {
+		header += fmt.Sprintf(" (%s in %d layers)", humanize.Bytes(uint64(p.total)), len(p.layers))
+	}
+	header += fmt.Sprintf(" %s", elapsed.Round(time.Second))
+
+	fraction := -1.0
+	if p.estimate > 0 {
+		// Never show a pull as complete before it is.
+		fraction = min(float64(elapsed)/float64(p.estimate), 0.99)
+		if remaining := p.estimate - elapsed; remaining > 0 {
+			header += fmt.Sprintf(", about %s left", remaining.Round(time.Second))
+		} else {
+			header += ", taking longer than usual"
+		}
+	} else {
+		header += ", no previous pulls to estimate from"
+	}
+	lines := []string{header}
+	if len(p.layers) == 0 {
+		return lines
+	}
+
+	done := int64(fraction * float64(p.total))
+	var others, othersDone int64
+	for i, layer := range p.layers {
+		layerDone := max(min(done, layer.Size), 0)
+		done -= layer.Size
+		if i >= maxPullProgressLayers {
+			others += layer.Size
+			othersDone += layerDone
+			continue
+		}
+		lines = append(lines, layerLine(shortDigest(layer.Digest), layer.Size, layerDone, fraction >= 0))
+	}
+	if others > 0 {
+		lines = append(lines, layerLine(fmt.Sprintf("+%d more", len(p.layers)-maxPullProgressLayers), others, othersDone, fraction >= 0))
+	}
+	return lines
+}
+
+func layerLine(name string, size, done int64, estimated bool) string {
+	if !estimated {
+		return fmt.Sprintf("  %-12s %10s", name, humanize.Bytes(uint64(size)))
+	}
+	filled := 0
+	if size > 0 {
+		filled = int(done * pullProgressBarWidth / size)
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", pullProgressBarWidth-filled)
+	return fmt.Sprintf("  %-12s [%s] %10s / %s", name, bar, humanize.Bytes(uint64(done)), humanize.Bytes(uint64(size)))
+}
+
+func shortDigest(digest string) string {
+	_, hex, _ := strings.Cut(digest, ":")
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+// pullSummary tells how long a pull took compared to the usual, suggesting to check the network when
+// it was much slower.
+func pullSummary(image string, duration, usual time.Duration) string {
+	summary := fmt.Sprintf("Pulled %s in %s", image, duration.Round(time.Second))
+	if usual <= 0 {
+		return summary
+	}
+	summary += fmt.Sprintf(" (usually %s)", usual.Round(time.Second))
+	if duration > slowPullFactor*usual {
+		summary += ". That's slower than usual: check your network, proxy or registry mirror."
+	}
+	return summary
+}
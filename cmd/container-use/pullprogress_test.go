@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullProgressLines(t *testing.T) {
+	p := newPullProgress(&bytes.Buffer{})
+	p.Handle(environment.EventImagePullStarted, map[string]any{
+		"image": "alpine:3",
+		"layers": []environment.ImageLayer{
+			{Digest: "sha256:aaaaaaaaaaaaaaaaaaaa", Size: 3_000_000},
+			{Digest: "sha256:bbbbbbbbbbbbbbbbbbbb", Size: 1_000_000},
+		},
+		"total_bytes":  int64(4_000_000),
+		"estimated_ms": int64(8000),
+	})
+
+	lines := p.lines(4 * time.Second)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "Pulling alpine:3 (4.0 MB in 2 layers) 4s, about 4s left", lines[0])
+	assert.Contains(t, lines[1], "aaaaaaaaaaaa")
+	assert.Contains(t, lines[1], "2.0 MB / 3.0 MB", "half of the bytes are in the first layer")
+	assert.Contains(t, lines[2], "0 B / 1.0 MB")
+
+	lines = p.lines(20 * time.Second)
+	assert.Contains(t, lines[0], "taking longer than usual")
+	assert.Contains(t, lines[2], "/ 1.0 MB")
+	assert.NotContains(t, lines[2], "1.0 MB / 1.0 MB", "pulls never look complete before they are")
+}
+
+func TestPullProgressWithoutEstimate(t *testing.T) {
+	var out bytes.Buffer
+	p := newPullProgress(&out)
+	p.Handle(environment.EventImagePullStarted, map[string]any{"image": "registry.internal/app:1"})
+	p.Handle(environment.EventImagePullProgress, map[string]any{"elapsed_ms": int64(2000)})
+	assert.Contains(t, out.String(), "Pulling registry.internal/app:1 2s, no previous pulls to estimate from")
+
+	p.Handle(environment.EventRetry, map[string]any{"operation": "pull of registry.internal/app:1", "delay_ms": int64(1000), "error": "connection reset by peer"})
+	assert.Contains(t, out.String(), "Retrying pull of registry.internal/app:1 in 1s after a transient error: connection reset by peer\n")
+
+	p.Handle(environment.EventImagePulled, map[string]any{"duration_ms": int64(3000)})
+	assert.Contains(t, out.String(), "Pulled registry.internal/app:1 in 3s\n")
+}
+
+func TestPullSummary(t *testing.T) {
+	assert.Equal(t, "Pulled alpine:3 in 5s (usually 4s)", pullSummary("alpine:3", 5*time.Second, 4*time.Second))
+	assert.Contains(t, pullSummary("alpine:3", 30*time.Second, 4*time.Second), "slower than usual")
+}
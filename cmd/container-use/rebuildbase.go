@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var rebuildBaseCmd = &cobra.Command{
+	Use:   "rebuild-base [<env>...]",
+	Short: "Rebuild environments on the configured base image",
+	Long: `Rebuild environments on the base image configured in the repository, e.g.
+after editing the Containerfile set with 'container-use config base-image build'
+or changing the base image tag. Containerfile base images are built from your
+working tree, uncommitted changes included.
+
+The environments keep their files and the rest of their configuration, but the
+container state of their previous commands (e.g. packages installed by the
+agent) is lost, as their setup and install commands run again on the new base.
+
+Use --all to rebuild every environment. If no environment is specified,
+automatically selects from environments that are descendants of the current HEAD.`,
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Roll an updated dev image out to an environment
+container-use rebuild-base fancy-mallard
+
+# Rebuild several environments
+container-use rebuild-base fancy-mallard backend-api
+
+# Rebuild every environment
+container-use rebuild-base --all`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		all, _ := app.Flags().GetBool("all")
+		noWait, _ := app.Flags().GetBool("no-wait")
+		if all && len(args) > 0 {
+			return errors.New("cannot specify environment names when using --all flag")
+		}
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		envIDs := args
+		switch {
+		case all:
+			envs, err := repo.List(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list environments: %w", err)
+			}
+			if len(envs) == 0 {
+				fmt.Println("No environments found to rebuild.")
+				return nil
+			}
+			for _, env := range envs {
+				envIDs = append(envIDs, env.ID)
+			}
+		case len(args) == 0:
+			envID, err := resolveEnvironmentID(ctx, repo, nil)
+			if err != nil {
+				return err
+			}
+			envIDs = []string{envID}
+		}
+
+		config := environment.DefaultConfig()
+		if err := config.Load(repo.SourcePath()); err != nil {
+			return err
+		}
+		fmt.Printf("Rebuilding %d environment(s) on %s...\n", len(envIDs), config.BaseImageDescription())
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			ctx = repository.WithInputPrompt(ctx, promptInput)
+		}
+
+		var failed int
+		for _, envID := range envIDs {
+			if err := rebuildBase(ctx, repo, pool, envID, noWait); err != nil {
+				slog.Error("Failed to rebuild environment", "environment-id", envID, "err", err)
+				fmt.Printf("❌ %s: %s\n", envID, err)
+				failed++
+				continue
+			}
+			fmt.Printf("✅ %s rebuilt\n", envID)
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to rebuild %d of %d environment(s)", failed, len(envIDs))
+		}
+		return nil
+	},
+}
+
+func rebuildBase(ctx context.Context, repo *repository.Repository, pool *repository.EnginePool, envID string, noWait bool) error {
+	dag, err := pool.ClientFor(ctx, repo, envID)
+	if err != nil {
+		return err
+	}
+	slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+	if err != nil {
+		return err
+	}
+	defer slot.Release()
+
+	_, err = repo.RebuildBase(ctx, dag, envID)
+	return err
+}
+
+func init() {
+	rebuildBaseCmd.Flags().Bool("all", false, "Rebuild all environments")
+	rebuildBaseCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if a command is running in an environment")
+	rootCmd.AddCommand(rebuildBaseCmd)
+}
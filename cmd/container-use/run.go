@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/messages"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <command>",
+	Short: "Run a command in a throwaway environment",
+	Long: `Create an environment, run a command in it and delete it, for throwaway
+experiments such as trying a command on another image or running the tests on a
+clean checkout.
+
+The environment is created from HEAD (or --from-ref) with the repository's
+configuration, on the base image given by --image if set, and its setup commands
+run first. The output of the command is printed and the command fails with the
+command's exit code.
+
+The environment is deleted once the command ran, unless --keep is set and the
+command changed files: its branch is then kept so the changes can be reviewed
+and merged like those of any environment. Uncommitted changes aren't included
+unless --include-uncommitted selects them, like 'container-use create'.`,
+	Args: cobra.ExactArgs(1),
+	Example: `# Run the tests on Node 20
+container-use run "npm test" --image node:20
+
+# Try an upgrade, keeping the environment if it changed files
+container-use run "npm update && npm test" --keep
+
+# Run the tests of another branch
+container-use run "go test ./..." --from-ref feature/parser
+
+# Run the tests with the uncommitted changes
+container-use run "go test ./..." --include-uncommitted`,
+	RunE: func(app *cobra.Command, args []string) (rerr error) {
+		ctx := app.Context()
+		stream := jsonStreamFromFlags(app, os.Stdout)
+		defer func() { stream.Fail(rerr) }()
+
+		command := args[0]
+		jsonOutput, _ := app.Flags().GetBool("json")
+		shell, _ := app.Flags().GetString("shell")
+		keep, _ := app.Flags().GetBool("keep")
+		fromRef, _ := app.Flags().GetString("from-ref")
+		if fromRef == "" {
+			fromRef = "HEAD"
+		}
+
+		vars, err := envVariablesFromFlags(app)
+		if err != nil {
+			return err
+		}
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		if image, _ := app.Flags().GetString("image"); image != "" {
+			config := environment.DefaultConfig()
+			if err := config.Load(repo.SourcePath()); err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+			config.BaseImage = image
+			config.BaseBuild = nil
+			ctx = repository.WithConfig(ctx, config)
+		}
+
+		if app.Flags().Changed("include-uncommitted") {
+			categories, _ := app.Flags().GetStringSlice("include-uncommitted")
+			included, err := repository.ParseUncommittedCategories(categories)
+			if err != nil {
+				return err
+			}
+			if fromRef != "HEAD" {
+				return fmt.Errorf("--include-uncommitted only applies to environments created from HEAD")
+			}
+			commit, err := repo.CommitUncommitted(ctx, included)
+			if err != nil {
+				return fmt.Errorf("failed to include uncommitted changes: %w", err)
+			}
+			if commit != "" {
+				fromRef = commit
+			}
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		ctx, dag, err := pool.Schedule(ctx, repo)
+		if err != nil {
+			return err
+		}
+		stream.Emit("connected", nil)
+
+		if stream != nil {
+			ctx = repository.WithProgress(ctx, stream.Emit)
+		}
+		if len(vars) > 0 {
+			ctx = repository.WithEnvVariables(ctx, vars)
+		}
+
+		slog.Info("creating throwaway environment", "command", command, "from_ref", fromRef)
+		env, err := repo.Create(ctx, dag, fmt.Sprintf("Run %s", command), "", fromRef)
+		if err != nil {
+			return fmt.Errorf("failed to create environment: %w", err)
+		}
+
+		result := &runResult{EnvironmentID: env.ID, Command: command, Shell: shell}
+		// The environment is deleted unless it's kept for its changes, even when the command is interrupted.
+		defer func() {
+			if result.Kept {
+				return
+			}
+			if err := repo.Delete(context.WithoutCancel(ctx), env.ID); err != nil {
+				stream.Emit("delete-failed", map[string]any{"environment_id": env.ID, "error": err.Error()})
+				fmt.Fprintf(os.Stderr, "Warning: failed to delete environment %s: %v\n", env.ID, err)
+				return
+			}
+			stream.Emit("deleted", map[string]any{"environment_id": env.ID})
+		}()
+
+		startTime := time.Now()
+		stdout, stderr, exitCode, err := env.RunWithExitCode(ctx, command, shell, false)
+		if err != nil {
+			return fmt.Errorf("failed to execute command: %w", err)
+		}
+		result.ExitCode, result.Stdout, result.Stderr = exitCode, stdout, stderr
+		result.ExecutionTimeMS = time.Since(startTime).Milliseconds()
+
+		if err := repo.Update(ctx, env, ""); err != nil {
+			return fmt.Errorf("command executed but failed to update repository: %w", err)
+		}
+		if result.ChangedFiles, err = repo.ChangedFiles(ctx, env.ID); err != nil {
+			return fmt.Errorf("failed to list the changed files: %w", err)
+		}
+		if keep && len(result.ChangedFiles) > 0 {
+			result.Kept = true
+			result.CheckoutCommand = fmt.Sprintf("container-use checkout %s", env.ID)
+		}
+
+		switch {
+		case stream != nil:
+			stream.Result(result)
+		case jsonOutput:
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(result); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		default:
+			printCommandOutput(stdout, stderr)
+			switch {
+			case result.Kept:
+				fmt.Fprintf(os.Stderr, "\n%s\n", messages.Get("run.kept", len(result.ChangedFiles), env.ID))
+				printNextStep(os.Stderr, "next.view_changes", "container-use diff "+env.ID)
+				printNextStep(os.Stderr, "next.checkout", "container-use checkout "+env.ID)
+			case len(result.ChangedFiles) > 0:
+				fmt.Fprintf(os.Stderr, "\n%s\n", messages.Get("run.discarded", len(result.ChangedFiles)))
+			}
+		}
+
+		if exitCode != 0 {
+			if !jsonOutput && stream == nil {
+				fmt.Fprintf(os.Stderr, "\n%s\n", messages.Get("command.failed", exitCode))
+			}
+			return fmt.Errorf("command exited with code %d", exitCode)
+		}
+		return nil
+	},
+}
+
+// runResult is the JSON output of run.
+type runResult struct {
+	EnvironmentID   string   `json:"environment_id"`
+	Command         string   `json:"command"`
+	Shell           string   `json:"shell"`
+	ExitCode        int      `json:"exit_code"`
+	Stdout          string   `json:"stdout"`
+	Stderr          string   `json:"stderr"`
+	ExecutionTimeMS int64    `json:"execution_time_ms"`
+	ChangedFiles    []string `json:"changed_files"`
+	// Kept is set when the environment was kept for its changes, with --keep.
+	Kept            bool   `json:"kept"`
+	CheckoutCommand string `json:"checkout_command,omitempty"`
+}
+
+func init() {
+	runCmd.Flags().String("image", "", "Base image of the environment, instead of the configured one")
+	runCmd.Flags().StringP("from-ref", "r", "HEAD", "Git reference to create the environment from (branch, tag, or SHA), fetched from its remote if missing")
+	runCmd.Flags().String("shell", "sh", "Shell to use for command execution")
+	runCmd.Flags().Bool("keep", false, "Keep the environment if the command changed files")
+	runCmd.Flags().StringSlice("include-uncommitted", nil, "Include uncommitted changes of these categories: staged, unstaged, untracked, ignored, or all")
+	runCmd.Flags().Lookup("include-uncommitted").NoOptDefVal = "staged,unstaged,untracked"
+	runCmd.Flags().StringArrayP("env-var", "e", nil, "Set an environment variable in the environment, as KEY=VALUE, or KEY to pass the host's (repeatable)")
+	runCmd.Flags().StringArray("env-file", nil, "Set the environment variables of a dotenv file in the environment (repeatable)")
+	runCmd.Flags().Bool("json", false, "Output result as JSON")
+	runCmd.Flags().Bool("json-stream", false, "Output progress events and the result as newline-delimited JSON")
+	withSchema(runCmd, &runResult{})
+	runCmd.MarkFlagsMutuallyExclusive("json", "json-stream")
+	rootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/spf13/cobra"
+)
+
+// schemaVersion is the version of the schemas of the JSON outputs. Adding a field to an output keeps the
+// version. Removing, renaming or retyping one bumps it, so wrappers can rely on the schemas published under
+// schemas/v<version>.
+const schemaVersion = 1
+
+// schemaBaseURL is where the schemas are published.
+const schemaBaseURL = "https://container-use.com/schemas"
+
+// outputSchema describes the JSON output of a command with the Go types it encodes. Commands with several
+// outputs, e.g. depending on a flag, output one of them.
+type outputSchema struct {
+	cmd     *cobra.Command
+	outputs []any
+}
+
+// outputSchemas are the commands with a --schema flag.
+var outputSchemas []*outputSchema
+
+// withSchema adds a --schema flag to a command with JSON output, printing the JSON Schema of its output
+// generated from the Go types of outputs.
+func withSchema(cmd *cobra.Command, outputs ...any) {
+	schema := &outputSchema{cmd: cmd, outputs: outputs}
+	outputSchemas = append(outputSchemas, schema)
+
+	cmd.Flags().Bool("schema", false, "Print the JSON Schema of the JSON output and exit")
+	validateArgs, run := cmd.Args, cmd.RunE
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if printSchema, _ := cmd.Flags().GetBool("schema"); printSchema || validateArgs == nil {
+			return nil
+		}
+		return validateArgs(cmd, args)
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if printSchema, _ := cmd.Flags().GetBool("schema"); printSchema {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(schema.Schema())
+		}
+		return run(cmd, args)
+	}
+}
+
+// Name returns the name of the schema, e.g. config-show for `container-use config show`.
+func (s *outputSchema) Name() string {
+	path := strings.Fields(s.cmd.CommandPath())
+	return strings.Join(path[1:], "-")
+}
+
+// Schema generates the JSON Schema of the output.
+func (s *outputSchema) Schema() *jsonschema.Schema {
+	schema := reflectSchema(s.outputs...)
+	schema.ID = jsonschema.ID(fmt.Sprintf("%s/v%d/%s.json", schemaBaseURL, schemaVersion, s.Name()))
+	schema.Title = fmt.Sprintf("Output of %s", s.cmd.CommandPath())
+	return schema
+}
+
+// streamEventSchema generates the JSON Schema of the events of --json-stream. The payload of their result
+// event is the output described by the command's --schema.
+func streamEventSchema() *jsonschema.Schema {
+	schema := reflectSchema(&streamEvent{})
+	schema.ID = jsonschema.ID(fmt.Sprintf("%s/v%d/json-stream-event.json", schemaBaseURL, schemaVersion))
+	schema.Title = "Event of --json-stream"
+	return schema
+}
+
+// reflectSchema generates the JSON Schema of one of outputs. Objects allow additional properties: new fields
+// don't break consumers.
+func reflectSchema(outputs ...any) *jsonschema.Schema {
+	reflector := &jsonschema.Reflector{AllowAdditionalProperties: true, Namer: schemaName}
+	if len(outputs) == 1 {
+		schema := reflector.Reflect(outputs[0])
+		allowNull(reflect.TypeOf(outputs[0]), schema, schema.Definitions, map[reflect.Type]bool{})
+		return schema
+	}
+
+	schema := &jsonschema.Schema{Version: jsonschema.Version, Definitions: jsonschema.Definitions{}}
+	for _, output := range outputs {
+		variant := reflector.Reflect(output)
+		for name, definition := range variant.Definitions {
+			schema.Definitions[name] = definition
+		}
+		variant.Version = ""
+		variant.ID = ""
+		variant.Definitions = nil
+		schema.AnyOf = append(schema.AnyOf, variant)
+	}
+	seen := map[reflect.Type]bool{}
+	for i, output := range outputs {
+		allowNull(reflect.TypeOf(output), schema.AnyOf[i], schema.Definitions, seen)
+	}
+	return schema
+}
+
+// schemaName names the definition of a type. Outputs of commands have unexported types: execResult is
+// named ExecResult.
+func schemaName(t reflect.Type) string {
+	if t.Name() == "" {
+		return ""
+	}
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+// allowNull lets the properties of the schema of t be null when Go encodes them as null: nil pointers,
+// slices and maps that aren't omitted when empty.
+func allowNull(t reflect.Type, schema *jsonschema.Schema, definitions jsonschema.Definitions, seen map[reflect.Type]bool) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	if t.Name() != "" {
+		// Named types are defined once, inline structs are described by the property holding them.
+		seen[t] = true
+		schema = definitions[schemaName(t)]
+	}
+	if schema == nil || schema.Properties == nil {
+		return
+	}
+
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+		property, ok := schema.Properties.Get(name)
+		if !ok {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+			if !strings.Contains(options, "omitempty") {
+				schema.Properties.Set(name, &jsonschema.Schema{AnyOf: []*jsonschema.Schema{property, {Type: "null"}}})
+			}
+		}
+		allowNull(field.Type, property, definitions, seen)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateSchemas = flag.Bool("update-schemas", false, "Write the schemas of the JSON outputs to schemas/")
+
+// TestSchemas checks that the published schemas match the JSON outputs. Regenerate them with
+// go test ./cmd/container-use -run TestSchemas -update-schemas
+func TestSchemas(t *testing.T) {
+	dir := filepath.Join("..", "..", "schemas", fmt.Sprintf("v%d", schemaVersion))
+	schemas := map[string]any{"json-stream-event.json": streamEventSchema()}
+	for _, schema := range outputSchemas {
+		schemas[schema.Name()+".json"] = schema.Schema()
+	}
+
+	if *updateSchemas {
+		require.NoError(t, os.RemoveAll(dir))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	for name, schema := range schemas {
+		generated, err := json.MarshalIndent(schema, "", "  ")
+		require.NoError(t, err)
+		generated = append(generated, '\n')
+		path := filepath.Join(dir, name)
+		if *updateSchemas {
+			require.NoError(t, os.WriteFile(path, generated, 0644))
+			continue
+		}
+		published, err := os.ReadFile(path)
+		require.NoError(t, err, "%s isn't published: run with -update-schemas", name)
+		assert.Equal(t, string(published), string(generated),
+			"%s changed: run with -update-schemas, after bumping schemaVersion if a field was removed, renamed or retyped", name)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.Contains(t, schemas, entry.Name(), "no command outputs %s anymore", entry.Name())
+	}
+}
+
+func TestWithSchema(t *testing.T) {
+	for _, schema := range outputSchemas {
+		generated := schema.Schema()
+		assert.Equal(t, "https://container-use.com/schemas/v1/"+schema.Name()+".json", string(generated.ID))
+		assert.NotEmpty(t, generated.Definitions, schema.Name())
+	}
+
+	// Arguments aren't required to print the schema.
+	var stdout *os.File
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout, os.Stdout = os.Stdout, w
+	defer func() { os.Stdout = stdout }()
+	require.NoError(t, execCmd.Flags().Set("schema", "true"))
+	defer execCmd.Flags().Set("schema", "false")
+	require.NoError(t, execCmd.Args(execCmd, nil))
+	require.NoError(t, execCmd.RunE(execCmd, nil))
+	w.Close()
+
+	var schema map[string]any
+	require.NoError(t, json.NewDecoder(r).Decode(&schema))
+	assert.Equal(t, "Output of container-use exec", schema["title"])
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [<query>...]",
+	Short: "Find environments across all repositories",
+	Long: `Search the environments of every repository by ID, title, label or repository path,
+from any directory: e.g. to find which repository an agent's task lived in.
+
+Every word of the query must match, ignoring case. Environments are listed most
+recently active first, with their repository and status: active, merged, applied or
+deleted. Deleted environments are kept, so their repository can still be found.
+
+The environments are recorded in a global index of the container-use data directory
+as they're created, updated, merged and deleted. Use --reindex to record the
+environments of all repositories first, e.g. those created before the index existed.`,
+	Example: `# Find the environment of a task
+container-use search login redirect
+
+# Find the active environments labeled backend
+container-use search backend --status active
+
+# Record the environments of all repositories, then list them
+container-use search --reindex`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		if reindex, _ := app.Flags().GetBool("reindex"); reindex {
+			count, err := repository.RebuildIndex(ctx, repository.DataDir())
+			if err != nil {
+				return fmt.Errorf("failed to rebuild the environment index: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Indexed %d environment(s).\n", count)
+		}
+
+		entries, err := repository.SearchIndex(repository.DataDir(), strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		if statuses, _ := app.Flags().GetStringSlice("status"); len(statuses) > 0 {
+			entries = slices.DeleteFunc(entries, func(entry *repository.IndexEntry) bool {
+				return !slices.Contains(statuses, entry.Status)
+			})
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(entries)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No environments found. Environments are indexed as they're used: run 'container-use search --reindex' to index them all.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTITLE\tLABELS\tSTATUS\tACTIVE\tREPOSITORY")
+		for _, entry := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.ID, truncate(app, entry.Title, 40), strings.Join(entry.Labels, ","),
+				entry.Status, humanize.Time(entry.LastActivityAt), entry.Repository)
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	searchCmd.Flags().StringSlice("status", nil, "Only list the environments with these statuses: active, merged, applied or deleted")
+	searchCmd.Flags().Bool("reindex", false, "Record the environments of all repositories in the index first")
+	searchCmd.Flags().Bool("json", false, "Output result as JSON")
+	searchCmd.Flags().Bool("no-trunc", false, "Don't truncate the titles")
+	withSchema(searchCmd, []*repository.IndexEntry{})
+	rootCmd.AddCommand(searchCmd)
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+// releasesRepository is the GitHub repository publishing the release binaries.
+const releasesRepository = "dagger/container-use"
+
+// Release channels.
+const (
+	channelStable = "stable"
+	channelEdge   = "edge"
+)
+
+// release is a GitHub release of container-use.
+type release struct {
+	Tag        string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the release's asset named name.
+func (r *release) assetURL(name string) (string, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no %s", r.Tag, name)
+}
+
+var selfUpgradeCmd = &cobra.Command{
+	Use:   "self-upgrade",
+	Short: "Upgrade container-use to the latest release",
+	Long: `Download the latest release of container-use for this platform and replace the
+running binary with it.
+
+The archive is verified against the checksums published with the release. This
+only checks the download's integrity, not who published it: the checksums come
+from the same GitHub release as the archive and aren't signed, so anyone able to
+publish a release of the repository could publish a binary that passes. The
+new binary replaces this one at once, then checks it can read the environments of
+the data directory and migrates them to its format if needed. If it can't, the
+current binary is put back: a failed upgrade leaves the current binary and the
+environments as they were, unless a migration already changed the environments,
+in which case run 'container-use migrate' to finish it.
+
+The stable channel follows the published releases, the edge channel the
+pre-releases too. Binaries installed with Homebrew or Nix are upgraded with them.
+Set GITHUB_TOKEN or GH_TOKEN to raise GitHub's rate limit.`,
+	Example: `# Upgrade to the latest release
+container-use self-upgrade
+
+# Follow the pre-releases
+container-use self-upgrade --channel edge
+
+# Check for an upgrade without installing it
+container-use self-upgrade --check
+
+# Install a given release
+container-use self-upgrade --version v0.4.2`,
+	Args: cobra.NoArgs,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+		channel, _ := app.Flags().GetString("channel")
+		if channel != channelStable && channel != channelEdge {
+			return fmt.Errorf("invalid channel %q: expected stable or edge", channel)
+		}
+		tag, _ := app.Flags().GetString("version")
+		if tag != "" && !strings.HasPrefix(tag, "v") {
+			tag = "v" + tag
+		}
+
+		rel, err := findRelease(ctx, channel, tag)
+		if err != nil {
+			return fmt.Errorf("failed to find the release to upgrade to: %w", err)
+		}
+		current := version
+		if current != "dev" {
+			current = "v" + strings.TrimPrefix(current, "v")
+		}
+		force, _ := app.Flags().GetBool("force")
+		// Explicit versions are installed even when older, e.g. to roll back.
+		if !force && current == rel.Tag && tag != "" {
+			fmt.Printf("container-use %s is already installed.\n", current)
+			return nil
+		}
+		if !force && tag == "" && (current == rel.Tag || (current != "dev" && compareVersions(current, rel.Tag) > 0)) {
+			fmt.Printf("container-use %s is up to date (latest %s release: %s).\n", current, channel, rel.Tag)
+			return nil
+		}
+		if check, _ := app.Flags().GetBool("check"); check {
+			fmt.Printf("container-use %s is available (current: %s). Run 'container-use self-upgrade' to install it.\n", rel.Tag, current)
+			return nil
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if executable, err = filepath.EvalSymlinks(executable); err != nil {
+			return err
+		}
+		if manager := packageManager(executable); manager != "" {
+			return fmt.Errorf("container-use was installed with %s: upgrade it with %s", manager, manager)
+		}
+
+		fmt.Fprintf(os.Stderr, "Downloading container-use %s for %s/%s...\n", rel.Tag, runtime.GOOS, runtime.GOARCH)
+		staged, err := stageRelease(ctx, rel, filepath.Dir(executable))
+		if err != nil {
+			return fmt.Errorf("failed to download container-use %s: %w", rel.Tag, err)
+		}
+		defer os.Remove(staged)
+
+		// The data is migrated once the new binary is installed, so a failed replace doesn't leave this one
+		// with environments it can't read.
+		dataVersion, err := repository.DataVersion(repository.DataDir())
+		if err != nil {
+			return err
+		}
+		backup, err := replaceExecutable(executable, staged)
+		if err != nil {
+			return fmt.Errorf("failed to replace %s: %w", executable, err)
+		}
+		if err := migrateWith(ctx, executable); err != nil {
+			if migrated, _ := repository.DataVersion(repository.DataDir()); migrated != dataVersion {
+				return fmt.Errorf("%w\nRun 'container-use migrate' to finish migrating the environments", err)
+			}
+			if restoreErr := restoreExecutable(executable, backup); restoreErr != nil {
+				return errors.Join(err, fmt.Errorf("failed to put %s back: %w", executable, restoreErr))
+			}
+			return err
+		}
+		// Running executables can't be removed on Windows: the next upgrade removes it.
+		os.Remove(backup)
+		fmt.Printf("Upgraded container-use from %s to %s.\n", current, rel.Tag)
+		return nil
+	},
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the environments to this version's format",
+	Long: `Migrate the data directory holding the environments of every repository to the
+format of this version of container-use. 'container-use self-upgrade' runs it
+with the new binary once installed; run it again after an interrupted upgrade. It fails if the data directory was written by a newer version.`,
+	Args: cobra.NoArgs,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ran, err := repository.Migrate(app.Context(), repository.DataDir())
+		for _, description := range ran {
+			fmt.Fprintf(os.Stderr, "Migrated: %s\n", description)
+		}
+		return err
+	},
+}
+
+// githubGet decodes the GitHub API response at endpoint into result. A token raises the rate limit, but isn't
+// required.
+func githubGet(ctx context.Context, endpoint string, result any) error {
+	apiURL := os.Getenv("GITHUB_API_URL")
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(apiURL, "/")+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if token := cmp.Or(os.Getenv("GITHUB_TOKEN"), os.Getenv("GH_TOKEN")); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub API GET %s: %s: %s", endpoint, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// findRelease returns the release tagged tag, or else the latest release of channel.
+func findRelease(ctx context.Context, channel, tag string) (*release, error) {
+	rel := &release{}
+	switch {
+	case tag != "":
+		return rel, githubGet(ctx, fmt.Sprintf("/repos/%s/releases/tags/%s", releasesRepository, tag), rel)
+	case channel == channelStable:
+		return rel, githubGet(ctx, fmt.Sprintf("/repos/%s/releases/latest", releasesRepository), rel)
+	}
+	// Releases are listed newest first, pre-releases included.
+	var releases []*release
+	if err := githubGet(ctx, fmt.Sprintf("/repos/%s/releases?per_page=30", releasesRepository), &releases); err != nil {
+		return nil, err
+	}
+	for _, rel := range releases {
+		if !rel.Draft {
+			return rel, nil
+		}
+	}
+	return nil, errors.New("no release found")
+}
+
+// download returns the content at url.
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// stageRelease downloads the binary of the release for this platform to a new executable file of dir, once
+// its archive matches the release's checksums, and returns its path. The checksums aren't signed: they catch
+// corrupted downloads, not a compromised release.
+func stageRelease(ctx context.Context, rel *release, dir string) (string, error) {
+	archiveName := fmt.Sprintf("container-use_%s_%s_%s.tar.gz", rel.Tag, runtime.GOOS, runtime.GOARCH)
+	archiveURL, err := rel.assetURL(archiveName)
+	if err != nil {
+		return "", err
+	}
+	checksumsURL, err := rel.assetURL("checksums.txt")
+	if err != nil {
+		return "", err
+	}
+	checksums, err := download(ctx, checksumsURL)
+	if err != nil {
+		return "", err
+	}
+	archive, err := download(ctx, archiveURL)
+	if err != nil {
+		return "", err
+	}
+	if err := verifyChecksum(archiveName, archive, checksums); err != nil {
+		return "", err
+	}
+
+	binaryName := "container-use"
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+	binary, err := extractFile(archive, binaryName)
+	if err != nil {
+		return "", err
+	}
+	// The binary is staged next to the current one, so it replaces it with a rename.
+	staged, err := os.CreateTemp(dir, ".container-use-upgrade-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := staged.Write(binary); err != nil {
+		staged.Close()
+		os.Remove(staged.Name())
+		return "", err
+	}
+	if err := staged.Close(); err != nil {
+		os.Remove(staged.Name())
+		return "", err
+	}
+	if err := os.Chmod(staged.Name(), 0755); err != nil {
+		os.Remove(staged.Name())
+		return "", err
+	}
+	return staged.Name(), nil
+}
+
+// verifyChecksum checks the SHA-256 checksum of the file name, with content data, is the one of checksums,
+// in the format of sha256sum.
+func verifyChecksum(name string, data, checksums []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, fields[0]) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], actual)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum published for %s", name)
+}
+
+// extractFile returns the content of the file named name in the gzipped tar archive.
+func extractFile(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in the archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// migrateWith has the binary migrate the data directory, which also checks it can read it.
+// Releases older than the migrate command read the data directory's first version only.
+func migrateWith(ctx context.Context, binary string) error {
+	out, err := exec.CommandContext(ctx, binary, "migrate").CombinedOutput()
+	if err == nil {
+		os.Stderr.Write(out)
+		return nil
+	}
+	if !strings.Contains(string(out), `unknown command "migrate"`) {
+		return fmt.Errorf("the new binary can't use the environments of this machine: %s", strings.TrimSpace(string(out)))
+	}
+	dataVersion, err := repository.DataVersion(repository.DataDir())
+	if err != nil {
+		return err
+	}
+	if dataVersion > 1 {
+		return fmt.Errorf("the new binary can't read the environments of this machine, migrated to version %d", dataVersion)
+	}
+	return nil
+}
+
+// replaceExecutable replaces the executable with the one at staged, with renames, and returns where the
+// replaced executable was moved. Running executables can't be replaced on Windows, but they can be moved aside.
+func replaceExecutable(executable, staged string) (string, error) {
+	backup := executable + ".old"
+	os.Remove(backup)
+	if err := os.Rename(executable, backup); err != nil {
+		return "", err
+	}
+	if err := os.Rename(staged, executable); err != nil {
+		os.Rename(backup, executable)
+		return "", err
+	}
+	return backup, nil
+}
+
+// restoreExecutable puts back the executable replaced by replaceExecutable.
+func restoreExecutable(executable, backup string) error {
+	if err := os.Remove(executable); err != nil {
+		return err
+	}
+	return os.Rename(backup, executable)
+}
+
+// packageManager returns the package manager that installed the executable, if any.
+func packageManager(executable string) string {
+	switch {
+	case strings.Contains(executable, "/Cellar/") || strings.Contains(executable, "/Caskroom/"):
+		return "Homebrew"
+	case strings.HasPrefix(executable, "/nix/store/"):
+		return "Nix"
+	}
+	return ""
+}
+
+// compareVersions compares release versions such as v1.2.3 and v1.3.0-rc1: pre-releases come before their
+// release.
+func compareVersions(a, b string) int {
+	parse := func(v string) ([3]int, string) {
+		core, pre, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+		var numbers [3]int
+		for i, part := range strings.SplitN(core, ".", 3) {
+			numbers[i], _ = strconv.Atoi(part)
+		}
+		return numbers, pre
+	}
+	aNumbers, aPre := parse(a)
+	bNumbers, bPre := parse(b)
+	for i := range aNumbers {
+		if aNumbers[i] != bNumbers[i] {
+			return aNumbers[i] - bNumbers[i]
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
+
+func init() {
+	selfUpgradeCmd.Flags().String("channel", channelStable, "Release channel: stable, or edge to include pre-releases")
+	selfUpgradeCmd.Flags().String("version", "", "Install this release instead of the latest one, e.g. v0.4.2")
+	selfUpgradeCmd.Flags().Bool("check", false, "Only report whether an upgrade is available")
+	selfUpgradeCmd.Flags().Bool("force", false, "Install the release even if it's the current version")
+	selfUpgradeCmd.MarkFlagsMutuallyExclusive("channel", "version")
+	rootCmd.AddCommand(selfUpgradeCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
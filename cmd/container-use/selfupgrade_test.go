@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	assert.Zero(t, compareVersions("v1.2.3", "1.2.3"))
+	assert.Positive(t, compareVersions("v1.10.0", "v1.9.9"))
+	assert.Negative(t, compareVersions("v1.3.0-rc1", "v1.3.0"), "pre-releases come before their release")
+	assert.Positive(t, compareVersions("v1.3.0-rc2", "v1.3.0-rc1"))
+	assert.Positive(t, compareVersions("v1.3.0-rc1", "v1.2.9"))
+}
+
+func TestSelfUpgradeRelease(t *testing.T) {
+	binaryName := "container-use"
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{"README.md": "readme", binaryName: "new binary"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	archiveName := fmt.Sprintf("container-use_v0.5.0-rc1_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	checksums := fmt.Sprintf("%x  %s\n", sha256.Sum256(archive.Bytes()), archiveName)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asset := func(name string) map[string]string {
+			return map[string]string{"name": name, "browser_download_url": server.URL + "/download/" + name}
+		}
+		stable := map[string]any{"tag_name": "v0.4.2", "assets": []any{}}
+		edge := map[string]any{"tag_name": "v0.5.0-rc1", "prerelease": true, "assets": []any{asset(archiveName), asset("checksums.txt")}}
+		switch r.URL.Path {
+		case "/repos/dagger/container-use/releases/latest":
+			json.NewEncoder(w).Encode(stable)
+		case "/repos/dagger/container-use/releases":
+			json.NewEncoder(w).Encode([]any{edge, stable})
+		case "/repos/dagger/container-use/releases/tags/v0.4.2":
+			json.NewEncoder(w).Encode(stable)
+		case "/download/" + archiveName:
+			w.Write(archive.Bytes())
+		case "/download/checksums.txt":
+			w.Write([]byte(checksums))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("GITHUB_API_URL", server.URL)
+	ctx := context.Background()
+
+	rel, err := findRelease(ctx, channelStable, "")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.4.2", rel.Tag)
+	rel, err = findRelease(ctx, channelStable, "v0.4.2")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.4.2", rel.Tag)
+	_, err = findRelease(ctx, channelStable, "v9.9.9")
+	assert.ErrorContains(t, err, "404")
+
+	rel, err = findRelease(ctx, channelEdge, "")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.5.0-rc1", rel.Tag)
+	staged, err := stageRelease(ctx, rel, t.TempDir())
+	require.NoError(t, err)
+	content, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	assert.Equal(t, "new binary", string(content))
+
+	// Archives that don't match their checksum are refused.
+	checksums = fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte("tampered")), archiveName)
+	_, err = stageRelease(ctx, rel, t.TempDir())
+	assert.ErrorContains(t, err, "checksum mismatch")
+	checksums = ""
+	_, err = stageRelease(ctx, rel, t.TempDir())
+	assert.ErrorContains(t, err, "no checksum published")
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	dir := t.TempDir()
+	executable, staged := dir+"/container-use", dir+"/.container-use-upgrade-1"
+	require.NoError(t, os.WriteFile(executable, []byte("old"), 0755))
+	require.NoError(t, os.WriteFile(staged, []byte("new"), 0755))
+	backup, err := replaceExecutable(executable, staged)
+	require.NoError(t, err)
+	content, err := os.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+	assert.NoFileExists(t, staged)
+
+	// A failed migration puts the previous executable back.
+	require.NoError(t, restoreExecutable(executable, backup))
+	content, err = os.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+	assert.NoFileExists(t, backup)
+
+	// A failed replace leaves the executable in place.
+	_, err = replaceExecutable(executable, dir+"/missing")
+	assert.Error(t, err)
+	content, err = os.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+
+	assert.Equal(t, "Homebrew", packageManager("/opt/homebrew/Cellar/container-use/0.4.2/bin/container-use"))
+	assert.Equal(t, "Nix", packageManager("/nix/store/abc-container-use/bin/container-use"))
+	assert.Empty(t, packageManager("/usr/local/bin/container-use"))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var stapledReviewCmd = &cobra.Command{
+	Use:   "stapled-review [<env>]",
+	Short: "Bundle an environment's work into a single HTML file for offline review",
+	Long: `Write a single self-contained HTML file reviewing an environment: a summary
+(commits, diff stats, latest test results), the commands it ran with their
+output, and its diff relative to the current branch.
+
+The file has no external resources, so it can be reviewed offline or attached to
+a ticket system that doesn't integrate with git. Command outputs are included as
+recorded: check the file for secrets before sharing it.
+
+If no environment is specified, automatically selects from environments that are
+descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Write fancy-mallard-review.html
+container-use stapled-review fancy-mallard
+
+# Choose the output file
+container-use stapled-review fancy-mallard -o review.html
+
+# Write to stdout
+container-use stapled-review fancy-mallard -o -`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		review, err := repo.Review(ctx, envID)
+		if err != nil {
+			return err
+		}
+
+		output, _ := app.Flags().GetString("output")
+		if output == "-" {
+			return review.WriteHTML(os.Stdout)
+		}
+		if output == "" {
+			output = envID + "-review.html"
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		if err := review.WriteHTML(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write review: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Wrote review of %s to %s\n", envID, output)
+		for _, e := range review.Environment.Errors {
+			fmt.Fprintf(os.Stderr, "Warning: couldn't include %s\n", e)
+		}
+		return nil
+	},
+}
+
+func init() {
+	stapledReviewCmd.Flags().StringP("output", "o", "", "File to write the review to, or - for stdout (default: <env>-review.html)")
+	rootCmd.AddCommand(stapledReviewCmd)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect and repair raw environment state",
+	Long: `Low-level commands to inspect and surgically fix the state container-use stores
+for each environment, for scripts and debugging.
+
+An environment is a branch in a fork of your repository. Its state (configuration,
+container, title...) is a JSON document stored as a git note on the branch head,
+next to the notes holding the command log and test results.
+
+These commands operate on the raw data without validating the environment further:
+prefer the regular commands when they can do the job.`,
+}
+
+var stateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List environments with their head commit and state note",
+	Args:  cobra.NoArgs,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		envs, err := repo.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		defer tw.Flush()
+
+		fmt.Fprintln(tw, "ENVIRONMENT\tHEAD\tSTATE NOTE")
+		for _, env := range envs {
+			refs, err := repo.StateRefs(ctx, env.ID)
+			if err != nil {
+				return err
+			}
+			note := refs.Notes["refs/notes/"+repository.NotesRefs["state"]]
+			if note == "" {
+				note = "(none)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", env.ID, refs.Head, note)
+		}
+		return nil
+	},
+}
+
+var stateRefsCmd = &cobra.Command{
+	Use:               "refs <env>",
+	Short:             "Show the git refs and paths backing an environment",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		refs, err := repo.StateRefs(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		if ok, _ := app.Flags().GetBool("json"); ok {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(refs)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+
+		fmt.Fprintf(tw, "Head:\t%s\n", refs.Head)
+		fmt.Fprintf(tw, "Branch:\t%s\n", refs.Branch)
+		fmt.Fprintf(tw, "Remote Ref:\t%s\n", refs.RemoteRef)
+		fmt.Fprintf(tw, "Fork Repository:\t%s\n", refs.ForkRepo)
+		fmt.Fprintf(tw, "Worktree:\t%s\n", refs.Worktree)
+		notesRefs := make([]string, 0, len(refs.Notes))
+		for ref := range refs.Notes {
+			notesRefs = append(notesRefs, ref)
+		}
+		sort.Strings(notesRefs)
+		for _, ref := range notesRefs {
+			blob := refs.Notes[ref]
+			if blob == "" {
+				blob = "(none)"
+			}
+			fmt.Fprintf(tw, "%s:\t%s\n", ref, blob)
+		}
+		return nil
+	},
+}
+
+var stateGetCmd = &cobra.Command{
+	Use:   "get <env> [<key>]",
+	Short: "Print an environment's raw state",
+	Long: `Print an environment's raw state JSON, or a single value with a dotted key path
+such as "title", "config.base_image" or "config.services.0.image".
+Strings are printed unquoted; other values are printed as JSON.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Dump the whole state
+container-use state get fancy-mallard
+
+# Print the base image
+container-use state get fancy-mallard config.base_image`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		raw, err := repo.RawState(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			_, err := os.Stdout.Write(append(bytes.TrimSpace(raw), '\n'))
+			return err
+		}
+
+		var state any
+		if err := json.Unmarshal(raw, &state); err != nil {
+			return fmt.Errorf("failed to parse state: %w", err)
+		}
+		value, err := getStatePath(state, args[1])
+		if err != nil {
+			return err
+		}
+		if s, ok := value.(string); ok {
+			fmt.Println(s)
+			return nil
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	},
+}
+
+var stateSetCmd = &cobra.Command{
+	Use:   "set <env> [<key> <value>]",
+	Short: "Overwrite an environment's raw state",
+	Long: `Overwrite a single value of an environment's state, or the whole state with --file.
+
+Values are parsed as JSON when possible (e.g. 42, true, ["a","b"]) and used as strings
+otherwise. The resulting state is validated before it's written. The environment's
+container is not rebuilt: changes to the configuration apply the next time it is.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if file, _ := cmd.Flags().GetString("file"); file != "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(3)(cmd, args)
+	},
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Rename an environment
+container-use state set fancy-mallard title "Fix the login form"
+
+# Replace the state with an edited copy
+container-use state get fancy-mallard > state.json
+container-use state set fancy-mallard --file state.json`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		envID := args[0]
+
+		var raw []byte
+		if file, _ := app.Flags().GetString("file"); file != "" {
+			if file == "-" {
+				raw, err = io.ReadAll(os.Stdin)
+			} else {
+				raw, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read state: %w", err)
+			}
+		} else {
+			current, err := repo.RawState(ctx, envID)
+			if err != nil {
+				return err
+			}
+			var state any
+			if err := json.Unmarshal(current, &state); err != nil {
+				return fmt.Errorf("failed to parse state: %w", err)
+			}
+			if state, err = setStatePath(state, args[1], parseStateValue(args[2])); err != nil {
+				return err
+			}
+			if raw, err = json.Marshal(state); err != nil {
+				return err
+			}
+		}
+
+		if err := repo.SetRawState(ctx, envID, raw); err != nil {
+			return err
+		}
+		fmt.Printf("State of %s updated\n", envID)
+		return nil
+	},
+}
+
+var stateNoteCmd = &cobra.Command{
+	Use:   "note <env> [log|state|tests]",
+	Short: "Print the raw contents of an environment's git note",
+	Long: `Print the raw contents of a git note attached to the environment's head
+(or to --commit). Defaults to the log note, which records the commands run.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		name := "log"
+		if len(args) == 2 {
+			name = args[1]
+		}
+		ref, ok := repository.NotesRefs[name]
+		if !ok {
+			return fmt.Errorf("unknown note %q: must be one of log, state or tests", name)
+		}
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		commit, _ := app.Flags().GetString("commit")
+		note, err := repo.Note(ctx, args[0], ref, commit)
+		if err != nil {
+			return err
+		}
+		if note != "" {
+			fmt.Println(strings.TrimSpace(note))
+		}
+		return nil
+	},
+}
+
+// getStatePath returns the value at a dotted path, such as "config.services.0.image".
+func getStatePath(value any, path string) (any, error) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("key not found: %s", path)
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("invalid index %q in %s", key, path)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("key not found: %s", path)
+		}
+	}
+	return value, nil
+}
+
+// setStatePath sets the value at a dotted path, creating missing objects along the way.
+func setStatePath(value any, path string, newValue any) (any, error) {
+	key, rest, nested := strings.Cut(path, ".")
+
+	switch v := value.(type) {
+	case nil:
+		if _, err := strconv.Atoi(key); err == nil {
+			return nil, fmt.Errorf("cannot index missing list with %q", key)
+		}
+		return setStatePath(map[string]any{}, path, newValue)
+	case map[string]any:
+		if !nested {
+			v[key] = newValue
+			return v, nil
+		}
+		child, err := setStatePath(v[key], rest, newValue)
+		if err != nil {
+			return nil, err
+		}
+		v[key] = child
+		return v, nil
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, fmt.Errorf("invalid index %q", key)
+		}
+		if !nested {
+			v[i] = newValue
+			return v, nil
+		}
+		child, err := setStatePath(v[i], rest, newValue)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = child
+		return v, nil
+	default:
+		return nil, fmt.Errorf("cannot set %q on a %T", key, value)
+	}
+}
+
+func parseStateValue(raw string) any {
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err == nil {
+		return value
+	}
+	return raw
+}
+
+func init() {
+	stateRefsCmd.Flags().Bool("json", false, "Output as JSON")
+	withSchema(stateRefsCmd, &repository.StateRefs{})
+	stateSetCmd.Flags().String("file", "", "Replace the whole state with the JSON in this file (- for stdin)")
+	stateNoteCmd.Flags().String("commit", "", "Show the note attached to this commit of the environment's history")
+
+	stateCmd.AddCommand(stateListCmd)
+	stateCmd.AddCommand(stateRefsCmd)
+	stateCmd.AddCommand(stateGetCmd)
+	stateCmd.AddCommand(stateSetCmd)
+	stateCmd.AddCommand(stateNoteCmd)
+
+	rootCmd.AddCommand(stateCmd)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatePath(t *testing.T) {
+	var state any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"title": "Old",
+		"config": {"base_image": "ubuntu:24.04", "services": [{"name": "db", "image": "postgres:15"}]}
+	}`), &state))
+
+	value, err := getStatePath(state, "config.services.0.image")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres:15", value)
+
+	_, err = getStatePath(state, "config.missing")
+	assert.Error(t, err)
+	_, err = getStatePath(state, "config.services.3")
+	assert.Error(t, err)
+
+	state, err = setStatePath(state, "title", parseStateValue("New title"))
+	require.NoError(t, err)
+	state, err = setStatePath(state, "config.services.0.exposed_ports", parseStateValue("[5432]"))
+	require.NoError(t, err)
+	state, err = setStatePath(state, "config.clone.depth", parseStateValue("1"))
+	require.NoError(t, err)
+
+	out, err := json.Marshal(state)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"title": "New title",
+		"config": {
+			"base_image": "ubuntu:24.04",
+			"services": [{"name": "db", "image": "postgres:15", "exposed_ports": [5432]}],
+			"clone": {"depth": 1}
+		}
+	}`, string(out))
+
+	_, err = setStatePath(state, "title.nested", "x")
+	assert.Error(t, err, "cannot set a key on a string")
+}
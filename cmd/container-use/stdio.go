@@ -1,42 +1,110 @@
 package main
 
 import (
-	"log/slog"
 	"os"
+	"time"
 
-	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/mcpserver"
 	"github.com/spf13/cobra"
 )
 
-var singleTenant bool
+var stdioOpts mcpserver.ServerOptions
 
 var stdioCmd = &cobra.Command{
 	Use:   "stdio",
 	Short: "Start MCP server for agent integration",
-	Long:  `Start the Model Context Protocol server that enables AI agents to create and manage containerized environments. This is typically used by agents like Claude Code, Cursor, or VSCode.`,
+	Long: `Start the Model Context Protocol server that enables AI agents to create and manage containerized environments. This is typically used by agents like Claude Code, Cursor, or VSCode.
+
+The server watches the repository's .container-use configuration and notifies the agent when it is reloaded or invalid.
+New environments always use the latest configuration; use --reload-environments to also rebuild the environments
+the server has opened, replacing any configuration changes made in them.
+
+With --require-approval, destructive tools (such as changing an environment's configuration or deleting files,
+including file batches deleting or renaming files) wait until the user approves them on the host with
+'container-use approve-request <id>'.
+
+With --idle-timeout, the services and background commands of environments unused for that long are
+stopped to free resources. Environments restart transparently from their last committed state when
+they're next used, but background commands must be started again.
+
+With --metrics-interval, the status, last command, diff stat and health of every environment of the
+repositories the server used are published as resources (container-use://environments/<id>/metrics),
+refreshed that often, and clients are notified when they change, to render them in a side panel.
+
+With --git-identity, the commits of environments created by the server are authored by the given
+identity instead of the repository's configured one, so history shows which agent made them.
+
+With --allow and --deny, clients may only call the tools of the given scopes: read, create, config,
+exec, write, delete and checkpoint, or individual tool names such as environment_file_delete. File batches deleting or renaming
+files need the delete scope too.
+--client-allow and --client-deny set rules for the client reporting the given name, e.g. cursor:
+a client's allow rule replaces the server's, its deny rule adds to the server's, and deny rules always
+win. Every call is then recorded in the audit log, shown by 'container-use audit'.`,
+	Example: `# Let agents read and run commands, but not write files
+container-use stdio --allow read,create,exec
+
+# Let every agent do everything but delete files, and cursor only read
+container-use stdio --deny delete --client-allow cursor=read`,
 	RunE: func(app *cobra.Command, _ []string) error {
 		ctx := app.Context()
 
-		slog.Info("connecting to dagger")
+		if identity, _ := app.Flags().GetString("git-identity"); identity != "" {
+			var err error
+			if stdioOpts.GitIdentity, err = environment.ParseGitIdentity(identity); err != nil {
+				return err
+			}
+		}
 
-		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
-		if err != nil {
-			slog.Error("Error starting dagger", "error", err)
+		if err := parsePermissionFlags(app); err != nil {
+			return err
+		}
 
-			if isDockerDaemonError(err) {
-				handleDockerDaemonError()
+		engines, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer engines.Close()
+		// Without a pool, every environment runs on the local engine: start it right away. Engines of a pool
+		// are connected to when environments are scheduled on them.
+		if len(engines.Engines) == 0 {
+			if _, err := engines.Client(ctx, ""); err != nil {
+				os.Exit(1)
 			}
-
-			os.Exit(1)
 		}
-		defer dag.Close()
 
-		return mcpserver.RunStdioServer(ctx, dag, singleTenant)
+		return mcpserver.RunStdioServer(ctx, engines, stdioOpts)
 	},
 }
 
 func init() {
-	stdioCmd.Flags().BoolVar(&singleTenant, "single-tenant", false, "Enable single-tenant mode where environment ID is optional (assumes one session per server)")
+	stdioCmd.Flags().BoolVar(&stdioOpts.SingleTenant, "single-tenant", false, "Enable single-tenant mode where environment ID is optional (assumes one session per server)")
+	stdioCmd.Flags().BoolVar(&stdioOpts.ReloadEnvironments, "reload-environments", false, "Rebuild environments opened by the server when the configuration changes")
+	stdioCmd.Flags().BoolVar(&stdioOpts.RequireApproval, "require-approval", false, "Require approval with 'container-use approve-request' before running destructive tools")
+	stdioCmd.Flags().DurationVar(&stdioOpts.ApprovalTimeout, "approval-timeout", 10*time.Minute, "How long destructive tools, host file prompts and command input prompts wait for the user")
+	stdioCmd.Flags().DurationVar(&stdioOpts.IdleTimeout, "idle-timeout", 0, "Stop the services and background commands of environments unused for this long (e.g. 30m)")
+	stdioCmd.Flags().BoolVar(&stdioOpts.FileEvents, "fs-events", false, "Send a resources/updated notification for each file the agent's tool calls change")
+	stdioCmd.Flags().DurationVar(&stdioOpts.MetricsInterval, "metrics-interval", 0, "Publish the live metrics of environments as resources, refreshed this often (e.g. 5s)")
+	stdioCmd.Flags().StringSlice("allow", nil, "Scopes or tools clients may use (default: all)")
+	stdioCmd.Flags().StringSlice("deny", nil, "Scopes or tools clients may not use")
+	stdioCmd.Flags().StringArray("client-allow", nil, `Scopes or tools a client may use, as "client=scope,scope" (replaces --allow for that client)`)
+	stdioCmd.Flags().StringArray("client-deny", nil, `Scopes or tools a client may not use, as "client=scope,scope"`)
+	stdioCmd.Flags().String("git-identity", "", `Author the commits of environments created by the server as "Name <email>"`)
 	rootCmd.AddCommand(stdioCmd)
 }
+
+// parsePermissionFlags restricts the server to the scopes of the permission flags, if any is set.
+func parsePermissionFlags(app *cobra.Command) error {
+	flags := app.Flags()
+	if !flags.Changed("allow") && !flags.Changed("deny") && !flags.Changed("client-allow") && !flags.Changed("client-deny") {
+		return nil
+	}
+	allow, _ := flags.GetStringSlice("allow")
+	deny, _ := flags.GetStringSlice("deny")
+	clientAllow, _ := flags.GetStringArray("client-allow")
+	clientDeny, _ := flags.GetStringArray("client-deny")
+
+	var err error
+	stdioOpts.Permissions, err = mcpserver.ParsePermissions(allow, deny, clientAllow, clientDeny)
+	return err
+}
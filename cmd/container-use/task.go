@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var taskCmd = &cobra.Command{
+	Use:   "task [<env-id>] <task>",
+	Short: "Run a task of the environment's configuration",
+	Long: `Run a named task of the environment's configuration, such as build, test or lint
+(see 'container-use config task'), after the tasks it depends on. Tasks stop at
+the first one failing, and the tasks after it are skipped. Services the task
+requires are started for its command only.
+
+Agents run the same tasks with the environment_run_task tool, so everyone uses the
+project's blessed entry points instead of inventing command lines.`,
+	Args: func(app *cobra.Command, args []string) error {
+		if list, _ := app.Flags().GetBool("list"); list {
+			return cobra.MaximumNArgs(1)(app, args)
+		}
+		return cobra.RangeArgs(1, 2)(app, args)
+	},
+	Example: `# Run the tests, after the tasks they depend on
+container-use task adaptive-koala test
+
+# List the tasks of an environment
+container-use task adaptive-koala --list
+
+# Output the result as JSON
+container-use task adaptive-koala lint --json`,
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		jsonOutput, _ := app.Flags().GetBool("json")
+		shell, _ := app.Flags().GetString("shell")
+		noWait, _ := app.Flags().GetBool("no-wait")
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		if list, _ := app.Flags().GetBool("list"); list {
+			envID, err := resolveEnvironmentID(ctx, repo, args)
+			if err != nil {
+				return err
+			}
+			envInfo, err := repo.Info(ctx, envID)
+			if err != nil {
+				return err
+			}
+			return printTasks(envInfo.State.Config.Tasks, jsonOutput)
+		}
+
+		task := args[len(args)-1]
+		envID, err := resolveEnvironmentID(ctx, repo, args[:len(args)-1])
+		if err != nil {
+			return err
+		}
+
+		resourceWarnings, err := repo.CheckHostResources()
+		if err != nil {
+			return err
+		}
+		for _, warning := range resourceWarnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+
+		slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+		if err != nil {
+			return err
+		}
+		defer slot.Release()
+
+		env, err := repo.Get(ctx, dag, envID)
+		if err != nil {
+			return fmt.Errorf("failed to load environment: %w", err)
+		}
+
+		slog.Info("running task", "env_id", envID, "task", task)
+		result, runErr := env.RunTask(ctx, task, shell)
+		if result != nil && len(result.Runs) > 0 {
+			// We want to update the repository even if a task failed.
+			if err := repo.Update(ctx, env, "Run task "+task); err != nil {
+				return fmt.Errorf("task executed but failed to update repository: %w", err)
+			}
+		}
+		if runErr != nil {
+			return runErr
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(result); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		} else {
+			for _, run := range result.Runs {
+				fmt.Fprintf(os.Stderr, "==> %s: %s\n", run.Task, run.Command)
+				fmt.Print(run.Stdout)
+				fmt.Fprint(os.Stderr, run.Stderr)
+			}
+			if len(result.Skipped) > 0 {
+				fmt.Fprintf(os.Stderr, "Skipped: %s\n", strings.Join(result.Skipped, ", "))
+			}
+		}
+
+		if failed := result.Failed(); failed != nil {
+			return fmt.Errorf("task %s exited with code %d", failed.Task, failed.ExitCode)
+		}
+		return nil
+	},
+}
+
+func printTasks(tasks environment.TaskConfigs, jsonOutput bool) error {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if tasks == nil {
+			tasks = environment.TaskConfigs{}
+		}
+		return enc.Encode(tasks)
+	}
+	if len(tasks) == 0 {
+		fmt.Println("No tasks configured, see 'container-use config task set'")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tDEPENDS ON\tSERVICES\tCOMMAND")
+	for _, task := range tasks {
+		services := make([]string, 0, len(task.Services))
+		for _, service := range task.Services {
+			services = append(services, service.Name)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", task.Name, orDash(strings.Join(task.DependsOn, ", ")), orDash(strings.Join(services, ", ")), task.Command)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	taskCmd.Flags().Bool("list", false, "List the tasks of the environment")
+	taskCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(taskCmd, &environment.TaskResult{}, environment.TaskConfigs{})
+	taskCmd.Flags().String("shell", "sh", "Shell to use for the tasks' commands")
+	taskCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if another exec is running in the environment")
+	rootCmd.AddCommand(taskCmd)
+}
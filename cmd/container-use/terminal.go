@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 
 	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
 )
@@ -16,8 +19,25 @@ var terminalCmd = &cobra.Command{
 	Short: "Get a shell inside an environment's container",
 	Long: `Open an interactive terminal in the exact container environment the agent used. Perfect for debugging, testing, or hands-on exploration.
 
+Changes made to the workdir in the terminal are kept when you exit it. If the
+environment changed meanwhile, e.g. because the agent kept working, both are
+merged: files changed on both sides are merged line by line, with conflict
+markers where the changes overlap, and the environment lists them as conflicts
+until they're resolved. Changes made outside the workdir are discarded.
+
 If no environment is specified, automatically selects from environments 
-that are descendants of the current HEAD.`,
+that are descendants of the current HEAD.
+
+With --tmux or --zellij, the terminal opens in a window named cu-<env> of a
+"container-use" multiplexer session, so long interactive sessions can be
+detached from and reattached to. Running the command again reattaches to the
+environment's window; --new-window opens another window into the same environment.
+
+With --share, the terminal runs in a tmux session that teammates logged in to the
+same machine can attach to with 'container-use terminal --join <token>', e.g. to
+pair-debug an agent's sandbox. They join read-only unless --writable is set. Other
+users must be allowed with --allow-user, and their access is enforced by tmux (3.3
+or later). Sharing stops when you exit the terminal or detach from it.`,
 	Args:              cobra.MaximumNArgs(1),
 	ValidArgsFunction: suggestEnvironments,
 	Example: `# Drop into environment's container
@@ -27,15 +47,76 @@ container-use terminal fancy-mallard
 container-use terminal backend-api
 
 # Auto-select environment
-container-use terminal`,
+container-use terminal
+
+# Open the terminal in a tmux session you can detach from
+container-use terminal fancy-mallard --tmux
+
+# Share the terminal, read-only, with teammate alice
+container-use terminal fancy-mallard --share --allow-user alice
+
+# Join a shared terminal
+container-use terminal --join 3f9c1a2b7d4e6f80`,
 	RunE: func(app *cobra.Command, args []string) error {
 		ctx := app.Context()
 
+		if token, _ := app.Flags().GetString("join"); token != "" {
+			if len(args) > 0 {
+				return errors.New("cannot specify an environment when joining a shared terminal")
+			}
+			return joinTerminal(token)
+		}
+
 		repo, err := repository.Open(ctx, ".")
 		if err != nil {
 			return err
 		}
 
+		share, _ := app.Flags().GetBool("share")
+		writable, _ := app.Flags().GetBool("writable")
+		allowUsers, _ := app.Flags().GetStringSlice("allow-user")
+		if !share && (writable || len(allowUsers) > 0) {
+			return errors.New("--writable and --allow-user require --share")
+		}
+		if share {
+			envID, err := resolveEnvironmentID(ctx, repo, args)
+			if err != nil {
+				return err
+			}
+			mux, err := newMultiplexerTerminal(envID, false)
+			if err != nil {
+				return err
+			}
+			shared, err := newSharedTerminal(envID, writable, allowUsers)
+			if err != nil {
+				return err
+			}
+			return shareTerminal(mux, shared)
+		}
+
+		useTmux, _ := app.Flags().GetBool("tmux")
+		useZellij, _ := app.Flags().GetBool("zellij")
+		if useTmux || useZellij {
+			envID, err := resolveEnvironmentID(ctx, repo, args)
+			if err != nil {
+				return err
+			}
+			newWindow, _ := app.Flags().GetBool("new-window")
+			mux, err := newMultiplexerTerminal(envID, newWindow)
+			if err != nil {
+				return err
+			}
+			if useTmux {
+				return mux.openTmux()
+			}
+			return mux.openZellij()
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
 		// FIXME(aluzzardi): This is a hack to make sure we're wrapped in `dagger run` since `Terminal()` only works with the CLI.
 		// If not, it will auto-wrap this command in a `dagger run`.
 		if _, ok := os.LookupEnv("DAGGER_SESSION_TOKEN"); !ok {
@@ -46,32 +127,85 @@ container-use terminal`,
 				}
 				return fmt.Errorf("failed to look up dagger binary: %w", err)
 			}
-			return execDaggerRun(daggerBin, append([]string{"dagger", "run"}, os.Args...), os.Environ())
+			runArgs := append([]string{"dagger", "run"}, os.Args...)
+			if len(args) == 0 {
+				// Don't ask again for the environment once wrapped.
+				runArgs = append(runArgs, envID)
+			}
+			environ := os.Environ()
+			pool, err := newEnginePool(os.Stderr)
+			if err != nil {
+				return err
+			}
+			if engine := pool.EngineFor(ctx, repo, envID); engine != nil {
+				environ = append(environ, "_EXPERIMENTAL_DAGGER_RUNNER_HOST="+engine.Host)
+			}
+			return execDaggerRun(daggerBin, runArgs, environ)
 		}
 
-		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(os.Stderr))
+		// The session of `dagger run` is connected to the engine hosting the environment.
+		dag, err := connectDagger(ctx, "", os.Stderr)
 		if err != nil {
-			if isDockerDaemonError(err) {
-				handleDockerDaemonError()
-			}
-			return fmt.Errorf("failed to connect to dagger: %w", err)
+			return err
 		}
 		defer dag.Close()
 
-		envID, err := resolveEnvironmentID(ctx, repo, args)
+		env, err := repo.Get(ctx, dag, envID)
 		if err != nil {
 			return err
 		}
 
-		env, err := repo.Get(ctx, dag, envID)
+		session, err := env.Terminal(ctx)
 		if err != nil {
 			return err
 		}
-
-		return env.Terminal(ctx)
+		return mergeTerminalSession(ctx, repo, dag, envID, session)
 	},
 }
 
+// mergeTerminalSession merges the changes made to the workdir in a terminal session into the environment,
+// along with the ones made meanwhile, e.g. by the agent.
+func mergeTerminalSession(ctx context.Context, repo *repository.Repository, dag *dagger.Client, envID string, session *environment.TerminalSession) error {
+	// Commands in the environment wait for the merge, so none of their changes is lost.
+	slot, err := repo.AcquireExec(ctx, envID, false, nil)
+	if err != nil {
+		return err
+	}
+	defer slot.Release()
+
+	env, err := repo.Get(ctx, dag, envID)
+	if err != nil {
+		return err
+	}
+	merge, err := env.MergeTerminal(ctx, session)
+	if err != nil {
+		return err
+	}
+	if len(merge.Merged) == 0 && len(merge.Conflicts) == 0 {
+		return nil
+	}
+	if err := repo.Update(ctx, env, "Merge changes made in the terminal"); err != nil {
+		return fmt.Errorf("failed to update the environment: %w", err)
+	}
+
+	if len(merge.Merged) > 0 {
+		fmt.Printf("Kept the changes made in the terminal to %s.\n", strings.Join(merge.Merged, ", "))
+	}
+	if len(merge.Conflicts) > 0 {
+		fmt.Printf("The environment changed meanwhile, conflicts to resolve in %s.\n", strings.Join(merge.Conflicts, ", "))
+		fmt.Printf("Edit the conflict markers, or the %s copies of files that couldn't be merged, e.g. in 'container-use terminal %s'.\n", environment.ConflictCopySuffix, envID)
+	}
+	return nil
+}
+
 func init() {
+	terminalCmd.Flags().Bool("tmux", false, "Open the terminal in a window of a managed tmux session")
+	terminalCmd.Flags().Bool("zellij", false, "Open the terminal in a tab of a managed zellij session")
+	terminalCmd.Flags().Bool("new-window", false, "With --tmux or --zellij, open another window even if the environment has one")
+	terminalCmd.Flags().Bool("share", false, "Share the terminal with teammates on this machine through tmux")
+	terminalCmd.Flags().Bool("writable", false, "With --share, let teammates type in the terminal instead of only watching")
+	terminalCmd.Flags().StringSlice("allow-user", nil, "With --share, let another local user join (repeatable)")
+	terminalCmd.Flags().String("join", "", "Join the terminal shared with this token")
+	terminalCmd.MarkFlagsMutuallyExclusive("tmux", "zellij", "share", "join")
 	rootCmd.AddCommand(terminalCmd)
 }
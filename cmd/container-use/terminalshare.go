@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sharedTerminalDir holds the sockets of shared terminals. It's in the system's temporary directory
+// rather than the user's, so teammates logged in to the same machine find them.
+func sharedTerminalDir() string {
+	return filepath.Join(os.TempDir(), "container-use-share")
+}
+
+// sharedTerminal is an environment's terminal running in a tmux server of its own, which teammates
+// attach to with the share's token.
+type sharedTerminal struct {
+	Token     string    `json:"token"`
+	EnvID     string    `json:"environment_id"`
+	Writable  bool      `json:"writable"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+	// AllowUsers are the other local users allowed to join.
+	AllowUsers []string `json:"allow_users,omitempty"`
+}
+
+func (s *sharedTerminal) socket() string {
+	return filepath.Join(sharedTerminalDir(), s.Token+".sock")
+}
+
+func (s *sharedTerminal) infoPath() string {
+	return filepath.Join(sharedTerminalDir(), s.Token+".json")
+}
+
+// session is the name of the tmux session running the terminal.
+func (s *sharedTerminal) session() string {
+	return "cu-" + s.EnvID
+}
+
+// tmuxCommands returns the tmux commands starting the shared session, running command from dir.
+// Other users are granted access to the server, read-only unless the share is writable.
+func (s *sharedTerminal) tmuxCommands(dir string, command []string) [][]string {
+	commands := [][]string{
+		append([]string{"tmux", "-S", s.socket(), "new-session", "-d", "-s", s.session(), "-c", dir, "--"}, command...),
+	}
+	for _, name := range s.AllowUsers {
+		access := "-r"
+		if s.Writable {
+			access = "-w"
+		}
+		commands = append(commands, []string{"tmux", "-S", s.socket(), "server-access", "-a", access, name})
+	}
+	return commands
+}
+
+// joinArgs returns the tmux command attaching to the shared session, read-only unless the share is writable.
+func (s *sharedTerminal) joinArgs() []string {
+	args := []string{"tmux", "-S", s.socket(), "attach-session", "-t", "=" + s.session()}
+	if !s.Writable {
+		args = append(args, "-r")
+	}
+	return args
+}
+
+func newSharedTerminal(envID string, writable bool, allowUsers []string) (*sharedTerminal, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	owner := ""
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	return &sharedTerminal{
+		Token:      hex.EncodeToString(b),
+		EnvID:      envID,
+		Writable:   writable,
+		Owner:      owner,
+		CreatedAt:  time.Now().UTC(),
+		AllowUsers: allowUsers,
+	}, nil
+}
+
+// shareTerminal runs the environment's terminal in a shared tmux session, attaches to it, and stops
+// sharing once the session ends or the sharer detaches.
+func shareTerminal(mux *multiplexerTerminal, share *sharedTerminal) error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux is required to share terminals: %w", err)
+	}
+
+	// Like /tmp: everyone can create shares, only their owner can remove them.
+	if err := os.MkdirAll(sharedTerminalDir(), 0o1777); err != nil {
+		return fmt.Errorf("failed to create shared terminals directory: %w", err)
+	}
+	_ = os.Chmod(sharedTerminalDir(), 0o1777)
+
+	data, err := json.Marshal(share)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(share.infoPath(), data, 0o644); err != nil {
+		return fmt.Errorf("failed to record shared terminal: %w", err)
+	}
+	defer func() {
+		_ = exec.Command("tmux", "-S", share.socket(), "kill-server").Run() // Ignore error - the session may have ended
+		os.Remove(share.socket())
+		os.Remove(share.infoPath())
+	}()
+
+	for i, args := range share.tmuxCommands(mux.Dir, mux.Command) {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("tmux %s failed: %w: %s", args[3], err, strings.TrimSpace(string(out)))
+		}
+		if i == 0 && len(share.AllowUsers) > 0 {
+			// Other users need to be able to connect to the socket; tmux checks their access itself.
+			if err := os.Chmod(share.socket(), 0o777); err != nil {
+				return fmt.Errorf("failed to open the shared terminal to other users: %w", err)
+			}
+		}
+	}
+
+	mode := "read-only"
+	if share.Writable {
+		mode = "writable"
+	}
+	fmt.Fprintf(os.Stderr, "Sharing the terminal of %s (%s). Teammates can join with:\n\n  container-use terminal --join %s\n\n", share.EnvID, mode, share.Token)
+	fmt.Fprintf(os.Stderr, "The terminal stops being shared when you exit it or detach from tmux (Ctrl-b d by default). Press Enter to continue.")
+	_, _ = fmt.Scanln()
+
+	cmd := exec.Command("tmux", "-S", share.socket(), "attach-session", "-t", "="+share.session())
+	cmd.Env = withoutTmuxEnv(os.Environ())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Stopped sharing the terminal of %s.\n", share.EnvID)
+	return nil
+}
+
+// joinTerminal attaches to the terminal shared with token.
+func joinTerminal(token string) error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux is required to join shared terminals: %w", err)
+	}
+	if token == "" || strings.ContainsAny(token, `/\.`) {
+		return fmt.Errorf("invalid shared terminal token %q", token)
+	}
+
+	share := &sharedTerminal{Token: token}
+	data, err := os.ReadFile(share.infoPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no terminal is shared with token %s on this machine", token)
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, share); err != nil {
+		return fmt.Errorf("invalid shared terminal %s: %w", token, err)
+	}
+
+	mode := "read-only"
+	if share.Writable {
+		mode = "writable"
+	}
+	fmt.Fprintf(os.Stderr, "Joining the terminal of %s shared by %s (%s). Detach with Ctrl-b d by default.\n", share.EnvID, share.Owner, mode)
+
+	args := share.joinArgs()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = withoutTmuxEnv(os.Environ())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// withoutTmuxEnv drops TMUX from env, so the shared session can be attached from inside another tmux session.
+func withoutTmuxEnv(env []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, "TMUX=") {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedTerminal(t *testing.T) {
+	t.Setenv("TMPDIR", "/tmp")
+	share := &sharedTerminal{Token: "3f9c1a2b7d4e6f80", EnvID: "fancy-mallard", AllowUsers: []string{"alice"}}
+	command := []string{"/usr/local/bin/container-use", "terminal", "fancy-mallard"}
+
+	assert.Equal(t, [][]string{
+		{
+			"tmux", "-S", "/tmp/container-use-share/3f9c1a2b7d4e6f80.sock", "new-session", "-d", "-s", "cu-fancy-mallard", "-c", "/src/project", "--",
+			"/usr/local/bin/container-use", "terminal", "fancy-mallard",
+		},
+		{"tmux", "-S", "/tmp/container-use-share/3f9c1a2b7d4e6f80.sock", "server-access", "-a", "-r", "alice"},
+	}, share.tmuxCommands("/src/project", command))
+	assert.Equal(t, []string{"tmux", "-S", "/tmp/container-use-share/3f9c1a2b7d4e6f80.sock", "attach-session", "-t", "=cu-fancy-mallard", "-r"}, share.joinArgs(),
+		"teammates join read-only by default")
+
+	share.Writable = true
+	assert.Equal(t, []string{"tmux", "-S", "/tmp/container-use-share/3f9c1a2b7d4e6f80.sock", "server-access", "-a", "-w", "alice"}, share.tmuxCommands("/src/project", command)[1])
+	assert.Equal(t, []string{"tmux", "-S", "/tmp/container-use-share/3f9c1a2b7d4e6f80.sock", "attach-session", "-t", "=cu-fancy-mallard"}, share.joinArgs())
+}
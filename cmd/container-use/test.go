@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test [<env-id>] <command>",
+	Short: "Run tests in an environment and report regressions",
+	Long: `Run a test command in an environment, record the parsed results, and report
+tests that started failing since the previous run and relative to the environment's base.
+
+Results are parsed from verbose test output (go test -v, pytest -v or pytest -rA)
+and stored with the environment's history, so every run is compared with the last.
+Coverage is recorded too when the output reports it (go test -cover, pytest --cov,
+jest --coverage), or when the configured coverage command does (see
+'container-use config coverage-command'), and drops are reported.
+Base comparisons use the most recent run recorded before the environment changed
+any files, e.g. running the tests right after creating the environment.`,
+	Args: cobra.RangeArgs(1, 2),
+	Example: `# Run Go tests and compare with the previous run
+container-use test adaptive-koala "go test -v ./..."
+
+# Record coverage too
+container-use test adaptive-koala "go test -v -cover ./..."
+
+# Run pytest and output the report as JSON
+container-use test adaptive-koala "pytest -rA" --json`,
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		command := args[len(args)-1]
+
+		jsonOutput, _ := app.Flags().GetBool("json")
+		shell, _ := app.Flags().GetString("shell")
+		noWait, _ := app.Flags().GetBool("no-wait")
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args[:len(args)-1])
+		if err != nil {
+			return err
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+
+		slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+		if err != nil {
+			return err
+		}
+		defer slot.Release()
+
+		env, err := repo.Get(ctx, dag, envID)
+		if err != nil {
+			return fmt.Errorf("failed to load environment: %w", err)
+		}
+
+		slog.Info("running tests", "env_id", envID, "command", command)
+
+		startedAt := time.Now()
+		stdout, stderr, exitCode, err := env.RunWithExitCode(ctx, command, shell, false)
+		if err != nil {
+			return fmt.Errorf("failed to execute tests: %w", err)
+		}
+
+		coverage := repository.ParseCoverage(stdout + "\n" + stderr)
+		if coverageCommand := env.State.Config.CoverageCommand; coverageCommand != "" {
+			slog.Info("measuring coverage", "env_id", envID, "command", coverageCommand)
+			coverageStdout, coverageStderr, coverageExitCode, err := env.RunWithExitCode(ctx, coverageCommand, shell, false)
+			switch {
+			case err != nil:
+				return fmt.Errorf("failed to execute coverage command: %w", err)
+			case coverageExitCode != 0:
+				fmt.Fprintf(os.Stderr, "Warning: coverage command exited with code %d: %s\n", coverageExitCode, coverageStderr)
+			default:
+				if measured := repository.ParseCoverage(coverageStdout + "\n" + coverageStderr); measured != nil {
+					coverage = measured
+				}
+			}
+		}
+
+		if err := repo.Update(ctx, env, ""); err != nil {
+			return fmt.Errorf("tests executed but failed to update repository: %w", err)
+		}
+
+		report, err := repo.RecordTestRun(ctx, env, &repository.TestRun{
+			Command:   command,
+			ExitCode:  exitCode,
+			StartedAt: startedAt,
+			Results:   repository.ParseTestOutput(stdout + "\n" + stderr),
+			Coverage:  coverage,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record test results: %w", err)
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		} else {
+			fmt.Print(stdout)
+			fmt.Fprint(os.Stderr, stderr)
+			printTestReport(report)
+		}
+
+		if exitCode != 0 {
+			return fmt.Errorf("tests exited with code %d", exitCode)
+		}
+		return nil
+	},
+}
+
+func printTestReport(report *repository.TestReport) {
+	run := report.Run
+	fmt.Println()
+	fmt.Printf("Tests: %d passed, %d failed, %d skipped\n",
+		run.Count(repository.TestPassed), run.Count(repository.TestFailed), run.Count(repository.TestSkipped))
+
+	if run.Coverage != nil {
+		fmt.Printf("Coverage: %.1f%%\n", run.Coverage.Total)
+	}
+
+	if report.SincePrevious != nil {
+		printTestComparison("previous run", report.SincePrevious)
+	} else {
+		fmt.Println("No previous run to compare with.")
+	}
+
+	if report.SinceBase != nil {
+		printTestComparison("base", report.SinceBase)
+	} else {
+		fmt.Println("No run recorded on the base; run the tests before making changes to enable regression detection.")
+	}
+}
+
+func printTestComparison(label string, comparison *repository.TestComparison) {
+	short := comparison.Commit
+	if len(short) > 7 {
+		short = short[:7]
+	}
+
+	if len(comparison.NewFailures) == 0 {
+		fmt.Printf("No new failures since %s (%s).\n", label, short)
+	} else {
+		fmt.Printf("New failures since %s (%s):\n", label, short)
+		for _, name := range comparison.NewFailures {
+			fmt.Printf("  ✗ %s\n", name)
+		}
+	}
+
+	if len(comparison.Fixed) > 0 {
+		fmt.Printf("Fixed since %s (%s):\n", label, short)
+		for _, name := range comparison.Fixed {
+			fmt.Printf("  ✓ %s\n", name)
+		}
+	}
+
+	if delta := comparison.Coverage; delta != nil {
+		fmt.Printf("Coverage since %s (%s): %s\n", label, short, formatCoverageDelta(delta))
+		for _, pkg := range delta.Dropped {
+			fmt.Printf("  ↓ %s\n", pkg)
+		}
+	}
+}
+
+// formatCoverageDelta describes a change of coverage, e.g. "81.2% → 78.0% (-3.2)".
+func formatCoverageDelta(delta *repository.CoverageDelta) string {
+	return fmt.Sprintf("%.1f%% → %.1f%% (%+.1f)", delta.Previous, delta.Current, delta.Delta)
+}
+
+func init() {
+	testCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(testCmd, &repository.TestReport{})
+	testCmd.Flags().String("shell", "sh", "Shell to use for command execution")
+	testCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if another exec is running in the environment")
+
+	rootCmd.AddCommand(testCmd)
+}
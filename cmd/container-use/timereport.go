@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var timeReportCmd = &cobra.Command{
+	Use:   "time-report [<env>...]",
+	Short: "Report the time spent on environments",
+	Long: `Report the time spent on environments: the wall clock time from their creation
+to their last activity, the time agents and users were active (at least one tool
+call or exec running), the time commands ran, and the time of each kind of
+operation.
+
+Times are shown in the local time zone, or in UTC with --utc. --json prints the
+reports, --csv every operation with its start, end and duration, e.g. for a
+spreadsheet.`,
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Time spent on the current environment
+container-use time-report
+
+# Every operation of every environment, as CSV
+container-use time-report --all --csv > operations.csv`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		ids := args
+		if all, _ := app.Flags().GetBool("all"); all {
+			envInfos, err := repo.List(ctx)
+			if err != nil {
+				return err
+			}
+			ids = nil
+			for _, envInfo := range envInfos {
+				ids = append(ids, envInfo.ID)
+			}
+		} else if len(ids) == 0 {
+			envID, err := resolveEnvironmentID(ctx, repo, nil)
+			if err != nil {
+				return err
+			}
+			ids = []string{envID}
+		}
+
+		location := time.Local
+		if utc, _ := app.Flags().GetBool("utc"); utc {
+			location = time.UTC
+		}
+
+		if csvOutput, _ := app.Flags().GetBool("csv"); csvOutput {
+			return writeOperationsCSV(os.Stdout, repo, ids, location)
+		}
+
+		reports := make([]*repository.TimeReport, 0, len(ids))
+		for _, id := range ids {
+			report, err := repo.TimeReport(ctx, id)
+			if err != nil {
+				return fmt.Errorf("failed to report time of %s: %w", id, err)
+			}
+			reports = append(reports, report)
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(reports)
+		}
+		for i, report := range reports {
+			if i > 0 {
+				fmt.Println()
+			}
+			printTimeReport(os.Stdout, report, location)
+		}
+		return nil
+	},
+}
+
+func printTimeReport(w io.Writer, report *repository.TimeReport, location *time.Location) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "%s\n", report.Environment)
+	fmt.Fprintf(tw, "  Created:\t%s\n", formatLocalTime(report.CreatedAt, location))
+	fmt.Fprintf(tw, "  Last activity:\t%s\n", formatLocalTime(report.LastActivityAt, location))
+	fmt.Fprintf(tw, "  Wall clock:\t%s\n", formatMS(report.WallClockMS))
+	active := formatMS(report.ActiveMS)
+	if report.WallClockMS > 0 {
+		active += fmt.Sprintf(" (%d%%)", report.ActiveMS*100/report.WallClockMS)
+	}
+	fmt.Fprintf(tw, "  Active:\t%s\n", active)
+	fmt.Fprintf(tw, "  Idle:\t%s\n", formatMS(report.IdleMS()))
+	fmt.Fprintf(tw, "  Commands:\t%s\n", formatMS(report.ExecMS))
+	for _, total := range report.Operations {
+		line := fmt.Sprintf("  %s:\t%s\t%d call(s)", total.Name, formatMS(total.TotalMS), total.Count)
+		if total.Errors > 0 {
+			line += fmt.Sprintf(", %d failed", total.Errors)
+		}
+		fmt.Fprintln(tw, line)
+	}
+}
+
+// writeOperationsCSV writes every operation of the environments, one per row.
+func writeOperationsCSV(w io.Writer, repo *repository.Repository, ids []string, location *time.Location) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"environment", "operation", "source", "started_at", "ended_at", "duration_ms", "error"}); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		operations, err := repo.Operations(id)
+		if err != nil {
+			return fmt.Errorf("failed to read operations of %s: %w", id, err)
+		}
+		for _, operation := range operations {
+			if err := out.Write([]string{
+				id,
+				operation.Name,
+				operation.Source,
+				operation.StartedAt.In(location).Format(time.RFC3339Nano),
+				operation.EndedAt.In(location).Format(time.RFC3339Nano),
+				strconv.FormatInt(operation.DurationMS, 10),
+				operation.Error,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// formatLocalTime formats t in location with its zone, e.g. "2025-07-01 10:00:00 CEST".
+func formatLocalTime(t time.Time, location *time.Location) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.In(location).Format("2006-01-02 15:04:05 MST")
+}
+
+func formatMS(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second).String()
+}
+
+func init() {
+	timeReportCmd.Flags().Bool("all", false, "Report the time of all environments")
+	timeReportCmd.Flags().Bool("json", false, "Output the reports as JSON")
+	withSchema(timeReportCmd, []*repository.TimeReport{})
+	timeReportCmd.Flags().Bool("csv", false, "Output every operation as CSV")
+	timeReportCmd.MarkFlagsMutuallyExclusive("json", "csv")
+	timeReportCmd.Flags().Bool("utc", false, "Show times in UTC instead of the local time zone")
+	rootCmd.AddCommand(timeReportCmd)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+// tourEnvironment is the ID of the environment of the tour.
+const tourEnvironment = "greet-in-french"
+
+// tourFiles are the files of the demo project of the tour.
+var tourFiles = map[string]string{
+	"README.md": "# Greeter\n\nA tiny project for the container-use tour. Run `sh greet.sh`.\n",
+	"greet.sh":  "#!/bin/sh\necho \"Hello, world!\"\n",
+}
+
+// tourStep is a step of the tour: a container-use command run in the scratch repository.
+type tourStep struct {
+	title       string
+	explanation string
+	args        []string
+}
+
+var tourSteps = []tourStep{
+	{
+		title: "Create an environment",
+		explanation: `An environment is a container with its own copy of the repository, on its own
+git branch. Agents work in environments, so your working tree stays untouched.`,
+		args: []string{"create", "Greet in French", "--id", tourEnvironment},
+	},
+	{
+		title: "Run a command in it",
+		explanation: `Commands run in the environment's container. The changes they make to the files
+are committed to the environment's branch, not to your working tree.`,
+		args: []string{"exec", tourEnvironment, "sed -i 's/Hello, world/Bonjour, le monde/' greet.sh && sh greet.sh"},
+	},
+	{
+		title: "Review the changes",
+		explanation: `Before bringing anything in, review what the environment changed compared to your
+branch.`,
+		args: []string{"diff", tourEnvironment},
+	},
+	{
+		title: "Merge them",
+		explanation: `Happy with the changes? Merge the environment's branch into your branch, or
+discard them with 'container-use delete'.`,
+		args: []string{"merge", tourEnvironment},
+	},
+}
+
+var tourCmd = &cobra.Command{
+	Use:   "tour",
+	Short: "Take a guided tour of container-use",
+	Long: `Walk through the container-use workflow with real commands: create an
+environment, run a command in it, review its changes and merge them.
+
+The tour first checks your setup: a container runtime such as Docker and the
+Dagger engine. It then creates a scratch repository with a tiny demo project and
+runs each command in it, pausing before each step so you can follow along.
+
+The scratch repository and the data container-use keeps for it are deleted at
+the end, unless --keep is set.`,
+	Args: cobra.NoArgs,
+	Example: `# Take the tour
+container-use tour
+
+# Run it without pausing, keeping the scratch repository
+container-use tour --yes --keep --dir ./tour`,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+		yes, _ := app.Flags().GetBool("yes")
+		keep, _ := app.Flags().GetBool("keep")
+		dir, _ := app.Flags().GetString("dir")
+		pause := !yes && isInteractive()
+
+		fmt.Println("Welcome to container-use!")
+		fmt.Println()
+		fmt.Println("Checking your setup...")
+		if err := checkTourSetup(ctx); err != nil {
+			return err
+		}
+
+		dir, err := setupTourRepo(ctx, dir)
+		if err != nil {
+			return fmt.Errorf("failed to create the scratch repository: %w", err)
+		}
+		if keep {
+			defer fmt.Printf("\nThe scratch repository is kept in %s.\n", dir)
+		} else {
+			defer cleanupTour(context.WithoutCancel(ctx), dir)
+		}
+		fmt.Printf("\nCreated a scratch repository with a demo project in %s:\n", dir)
+		fmt.Print(tourFiles["greet.sh"])
+
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find container-use executable: %w", err)
+		}
+		for i, step := range tourSteps {
+			fmt.Printf("\nStep %d/%d: %s\n\n%s\n\n", i+1, len(tourSteps), step.title, step.explanation)
+			fmt.Printf("  $ container-use %s\n\n", quoteArgs(step.args))
+			if pause && !waitForEnter() {
+				return errors.New("tour stopped")
+			}
+			cmd := exec.CommandContext(ctx, self, step.args...)
+			cmd.Dir = dir
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("step %d (%s) failed: %w", i+1, step.title, err)
+			}
+		}
+
+		greeter, err := os.ReadFile(filepath.Join(dir, "greet.sh"))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nThe changes are now in your branch:\n%s\n", greeter)
+		fmt.Println("That's the whole workflow! Next, point your agent at container-use:")
+		fmt.Println("  https://container-use.com/quickstart")
+		return nil
+	},
+}
+
+// checkTourSetup checks that a container runtime is available and that the Dagger engine starts.
+func checkTourSetup(ctx context.Context) error {
+	rt := detectContainerRuntime(ctx)
+	if rt == nil {
+		return errors.New("no container runtime found: install Docker (https://www.docker.com/get-started) and try again")
+	}
+	fmt.Printf("  ✓ %s %s\n", rt.Name, rt.Version)
+
+	slog.Info("connecting to dagger")
+	dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+	if err != nil {
+		slog.Error("Error starting dagger", "error", err)
+
+		if isDockerDaemonError(err) {
+			handleDockerDaemonError()
+		}
+
+		return fmt.Errorf("failed to connect to dagger: %w", err)
+	}
+	defer dag.Close()
+	engine, err := dag.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reach the dagger engine: %w", err)
+	}
+	fmt.Printf("  ✓ Dagger engine %s\n", engine)
+	return nil
+}
+
+// setupTourRepo creates the scratch repository with the demo project in dir, or in a temporary directory if
+// dir is empty. It returns the path of the repository.
+func setupTourRepo(ctx context.Context, dir string) (string, error) {
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", "container-use-tour-"); err != nil {
+			return "", err
+		}
+	} else {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return "", fmt.Errorf("%s is not empty", dir)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+	// Repositories are identified by their resolved path, e.g. /private/var rather than /var on macOS.
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return "", err
+	}
+
+	for name, content := range tourFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			return "", err
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-b", "main"},
+		// The commits of the tour don't depend on the user's git identity.
+		{"config", "user.name", "container-use tour"},
+		{"config", "user.email", "tour@container-use.com"},
+		{"add", "."},
+		{"commit", "-m", "Add the greeter"},
+	} {
+		if _, err := repository.RunGitCommand(ctx, dir, args...); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// cleanupTour deletes the tour's environment, the scratch repository and the fork container-use created for it.
+func cleanupTour(ctx context.Context, dir string) {
+	self, err := os.Executable()
+	if err == nil {
+		cmd := exec.CommandContext(ctx, self, "delete", tourEnvironment)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			slog.Warn("failed to delete the tour environment", "error", err, "output", string(output))
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		slog.Warn("failed to delete the scratch repository", "path", dir, "error", err)
+		return
+	}
+
+	report, err := repository.FindOrphans(ctx, repository.DataDir())
+	if err != nil {
+		slog.Warn("failed to find the data of the scratch repository", "error", err)
+		return
+	}
+	for _, orphan := range report.Orphans {
+		if !slices.Equal(orphan.Sources, []string{dir}) {
+			continue
+		}
+		if err := repository.PurgeOrphan(orphan); err != nil {
+			slog.Warn("failed to delete the data of the scratch repository", "fork", orphan.Fork, "error", err)
+		}
+	}
+	fmt.Println("\nCleaned up the scratch repository.")
+}
+
+// waitForEnter waits for the user to press Enter, returning false if stdin was closed.
+func waitForEnter() bool {
+	fmt.Print("Press Enter to run it, or Ctrl-C to stop. ")
+	_, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Println()
+	return !errors.Is(err, io.EOF)
+}
+
+// quoteArgs formats the arguments of a command the way they would be typed in a shell.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " '\"&|;$<>") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+func init() {
+	tourCmd.Flags().BoolP("yes", "y", false, "Run the steps without pausing")
+	tourCmd.Flags().Bool("keep", false, "Keep the scratch repository and its environment")
+	tourCmd.Flags().String("dir", "", "Directory of the scratch repository (default a temporary directory)")
+	rootCmd.AddCommand(tourCmd)
+}
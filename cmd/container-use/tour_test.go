@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupTourRepo(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "tour")
+
+	dir, err := setupTourRepo(ctx, dir)
+	require.NoError(t, err)
+	greeter, err := os.ReadFile(filepath.Join(dir, "greet.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, tourFiles["greet.sh"], string(greeter))
+	status, err := repository.RunGitCommand(ctx, dir, "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Empty(t, strings.TrimSpace(status), "the demo project is committed")
+
+	_, err = setupTourRepo(ctx, dir)
+	assert.ErrorContains(t, err, "is not empty")
+}
+
+func TestQuoteArgs(t *testing.T) {
+	assert.Equal(t, "diff greet-in-french", quoteArgs([]string{"diff", "greet-in-french"}))
+	assert.Equal(t, `exec env 'sed -i '\''s/a/b/'\'' f && sh f'`, quoteArgs([]string{"exec", "env", "sed -i 's/a/b/' f && sh f"}))
+}
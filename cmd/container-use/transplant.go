@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var transplantCmd = &cobra.Command{
+	Use:   "transplant [<env>] --to-repo <path>",
+	Short: "Recreate an environment in another repository",
+	Long: `Recreate an environment in another repository, for code that was moved or
+vendored there: a new environment is created in the target repository with the
+same container configuration, and the environment's commits are applied on top
+of the target's HEAD, one commit each, keeping their message and author.
+
+The changed paths are relocated with --strip, which removes leading directories,
+and --directory, which prepends one. Hunks that don't apply, and files that
+don't exist in the target, are reported instead of failing the transplant: the
+rest of the changes still make it into the new environment.
+
+Neither repository's working tree is touched.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Recreate an environment in a fork
+container-use transplant fancy-mallard --to-repo ../fork
+
+# The code of lib/ is vendored under third_party/lib in the other repository
+container-use transplant fancy-mallard --to-repo ../app --strip 1 --directory third_party/lib`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+		source, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		envID, err := resolveEnvironmentID(ctx, source, args)
+		if err != nil {
+			return err
+		}
+
+		toRepo, _ := app.Flags().GetString("to-repo")
+		target, err := repository.Open(ctx, toRepo)
+		if err != nil {
+			return fmt.Errorf("failed to open repository %s: %w", toRepo, err)
+		}
+		if target.SourcePath() == source.SourcePath() {
+			return fmt.Errorf("%s is the environment's repository", toRepo)
+		}
+
+		var opts repository.TransplantOptions
+		opts.Strip, _ = app.Flags().GetInt("strip")
+		opts.Directory, _ = app.Flags().GetString("directory")
+		if opts.Strip < 0 {
+			return fmt.Errorf("invalid --strip %d", opts.Strip)
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		ctx, dag, err := pool.Schedule(ctx, target)
+		if err != nil {
+			return err
+		}
+
+		env, result, err := target.Transplant(ctx, dag, source, envID, opts)
+		if err != nil {
+			return fmt.Errorf("failed to transplant %s: %w", envID, err)
+		}
+
+		if jsonOutput, _ := app.Flags().GetBool("json"); jsonOutput {
+			out, err := json.MarshalIndent(&transplantResult{env.ID, target.SourcePath(), result}, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+
+		for _, patch := range result.Patches {
+			status := "applied"
+			switch {
+			case patch.Applied == "":
+				status = "skipped"
+			case len(patch.Rejected) > 0:
+				status = "partially applied"
+			}
+			fmt.Printf("%s %s: %s\n", patch.Commit[:7], patch.Subject(), status)
+			for _, rejected := range patch.Rejected {
+				fmt.Printf("  %s: %s\n", rejected.File, rejected.Reason)
+				for line := range strings.Lines(rejected.Hunks) {
+					fmt.Print("    " + line)
+				}
+			}
+		}
+		fmt.Println()
+		fmt.Printf("Environment transplanted to %s: %s\n", target.SourcePath(), env.ID)
+		if rejected := result.Rejected(); rejected > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d change(s) didn't apply, make them in the new environment\n", rejected)
+		}
+		return nil
+	},
+}
+
+// transplantResult is the JSON output of transplant.
+type transplantResult struct {
+	ID         string `json:"id"`
+	Repository string `json:"repository"`
+	*repository.PatchSeriesResult
+}
+
+func init() {
+	transplantCmd.Flags().String("to-repo", "", "Path of the repository to recreate the environment in")
+	transplantCmd.MarkFlagRequired("to-repo")
+	transplantCmd.Flags().Int("strip", 0, "Remove this many leading directories from the changed paths")
+	transplantCmd.Flags().String("directory", "", "Prepend this directory to the changed paths")
+	transplantCmd.Flags().Bool("json", false, "Output result as JSON")
+	withSchema(transplantCmd, &transplantResult{})
+	rootCmd.AddCommand(transplantCmd)
+}
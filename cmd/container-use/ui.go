@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Manage environments from an interactive terminal dashboard",
+	Long: `Open a terminal dashboard listing the environments of the repository with their
+live status, their last command, and how far their branch diverged from your
+current branch. The list refreshes every --interval.
+
+The selected environment can be acted on with a key:
+
+  enter, l   show its log
+  d          show its diff
+  e          run a command in it, and show its output
+  t          open a terminal in it
+  x          delete it, after confirmation
+  r          refresh the list
+  q          quit
+
+Logs, diffs and command outputs open in a viewer scrolled with j/k, pgup/pgdown
+and g/G, and closed with q or esc.`,
+	Args: cobra.NoArgs,
+	Example: `# Open the dashboard
+container-use ui
+
+# Refresh every 10 seconds
+container-use ui --interval 10s`,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+
+		interval, _ := app.Flags().GetDuration("interval")
+		if interval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find container-use executable: %w", err)
+		}
+
+		model := newUIModel(ctx, repo, self, interval)
+		if _, err := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx)).Run(); err != nil {
+			return fmt.Errorf("failed to run the dashboard: %w", err)
+		}
+		return nil
+	},
+}
+
+// uiRow is an environment listed in the dashboard.
+type uiRow struct {
+	metrics *repository.EnvironmentMetrics
+	// divergence compares the environment's branch with the user's HEAD, unset when it couldn't be compared.
+	divergence *repository.Divergence
+}
+
+// loadDashboard returns the environments of repo, with their metrics and divergence.
+func loadDashboard(ctx context.Context, repo *repository.Repository) ([]uiRow, error) {
+	envs, err := repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	rows := make([]uiRow, 0, len(envs))
+	for _, env := range envs {
+		metrics, err := repo.Metrics(ctx, env.ID)
+		if err != nil {
+			continue
+		}
+		row := uiRow{metrics: metrics}
+		row.divergence, _ = repo.Divergence(ctx, "container-use/"+env.ID)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// uiMode is what the dashboard shows and what keys do.
+type uiMode int
+
+const (
+	uiModeList uiMode = iota
+	// uiModeExec reads the command to run in the selected environment.
+	uiModeExec
+	// uiModeDelete asks to confirm the deletion of the selected environment.
+	uiModeDelete
+	// uiModeOutput shows the output of an action.
+	uiModeOutput
+)
+
+type (
+	uiRowsMsg struct {
+		rows []uiRow
+		err  error
+	}
+	uiTickMsg   time.Time
+	uiOutputMsg struct {
+		title  string
+		output string
+		err    error
+	}
+	// uiDoneMsg reports an action that has no output to show, refreshing the list.
+	uiDoneMsg struct {
+		status string
+		err    error
+	}
+)
+
+type uiModel struct {
+	ctx      context.Context
+	repo     *repository.Repository
+	self     string
+	interval time.Duration
+
+	rows    []uiRow
+	cursor  int
+	mode    uiMode
+	loading bool
+	status  string
+
+	// target is the environment uiModeExec and uiModeDelete act on, chosen when entering the mode:
+	// the list reloads meanwhile, and the selection may move to another environment.
+	target string
+	// input is the command typed in uiModeExec.
+	input string
+
+	title  string
+	output []string
+	offset int
+
+	width, height int
+}
+
+func newUIModel(ctx context.Context, repo *repository.Repository, self string, interval time.Duration) uiModel {
+	return uiModel{ctx: ctx, repo: repo, self: self, interval: interval, loading: true}
+}
+
+func (m uiModel) Init() tea.Cmd {
+	return tea.Batch(m.load(), m.tick())
+}
+
+func (m uiModel) load() tea.Cmd {
+	return func() tea.Msg {
+		rows, err := loadDashboard(m.ctx, m.repo)
+		return uiRowsMsg{rows: rows, err: err}
+	}
+}
+
+func (m uiModel) tick() tea.Cmd {
+	return tea.Tick(m.interval, func(t time.Time) tea.Msg { return uiTickMsg(t) })
+}
+
+// selected returns the ID of the selected environment, empty when there are none.
+func (m uiModel) selected() string {
+	if m.cursor < 0 || m.cursor >= len(m.rows) {
+		return ""
+	}
+	return m.rows[m.cursor].metrics.ID
+}
+
+// capture runs the action writing to the output shown under title.
+func (m uiModel) capture(title string, action func(w *bytes.Buffer) error) tea.Cmd {
+	return func() tea.Msg {
+		var out bytes.Buffer
+		err := action(&out)
+		return uiOutputMsg{title: title, output: out.String(), err: err}
+	}
+}
+
+func (m uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case uiTickMsg:
+		if m.loading {
+			return m, m.tick()
+		}
+		m.loading = true
+		return m, tea.Batch(m.load(), m.tick())
+	case uiRowsMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.status = msg.err.Error()
+			return m, nil
+		}
+		// Keep the same environment selected when others appear or go away.
+		selected := m.selected()
+		m.rows = msg.rows
+		m.cursor = min(m.cursor, max(len(m.rows)-1, 0))
+		for i, row := range m.rows {
+			if row.metrics.ID == selected {
+				m.cursor = i
+			}
+		}
+	case uiOutputMsg:
+		m.mode = uiModeOutput
+		m.title = msg.title
+		m.output = strings.Split(strings.TrimRight(msg.output, "\n"), "\n")
+		if msg.err != nil {
+			m.output = append(m.output, "", "Error: "+msg.err.Error())
+		}
+		m.offset = 0
+		m.status = ""
+	case uiDoneMsg:
+		m.status = msg.status
+		if msg.err != nil {
+			m.status = "Error: " + msg.err.Error()
+		}
+		m.loading = true
+		return m, m.load()
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m uiModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit
+	}
+
+	switch m.mode {
+	case uiModeExec:
+		switch msg.Type {
+		case tea.KeyEsc:
+			m.mode, m.input, m.target = uiModeList, "", ""
+		case tea.KeyEnter:
+			command, id := strings.TrimSpace(m.input), m.target
+			m.mode, m.input, m.target = uiModeList, "", ""
+			if command == "" || id == "" {
+				return m, nil
+			}
+			m.status = fmt.Sprintf("Running %q in %s...", command, id)
+			return m, m.capture(fmt.Sprintf("%s $ %s", id, command), func(w *bytes.Buffer) error {
+				// Commands starting with a dash, e.g. "--help", are the command to run, not flags of exec.
+				cmd := exec.CommandContext(m.ctx, m.self, "exec", "--", id, command)
+				cmd.Stdout, cmd.Stderr = w, w
+				return cmd.Run()
+			})
+		case tea.KeyBackspace:
+			if runes := []rune(m.input); len(runes) > 0 {
+				m.input = string(runes[:len(runes)-1])
+			}
+		case tea.KeySpace:
+			m.input += " "
+		case tea.KeyRunes:
+			m.input += string(msg.Runes)
+		}
+		return m, nil
+
+	case uiModeDelete:
+		id := m.target
+		m.mode, m.target = uiModeList, ""
+		if msg.String() != "y" || id == "" {
+			m.status = ""
+			return m, nil
+		}
+		m.status = fmt.Sprintf("Deleting %s...", id)
+		return m, func() tea.Msg {
+			if err := m.repo.Delete(m.ctx, id); err != nil {
+				return uiDoneMsg{err: fmt.Errorf("failed to delete environment '%s': %w", id, err)}
+			}
+			return uiDoneMsg{status: fmt.Sprintf("Environment '%s' deleted.", id)}
+		}
+
+	case uiModeOutput:
+		page := max(m.viewerHeight(), 1)
+		last := max(len(m.output)-page, 0)
+		switch msg.String() {
+		case "q", "esc":
+			m.mode, m.output = uiModeList, nil
+		case "down", "j":
+			m.offset = min(m.offset+1, last)
+		case "up", "k":
+			m.offset = max(m.offset-1, 0)
+		case "pgdown", " ":
+			m.offset = min(m.offset+page, last)
+		case "pgup":
+			m.offset = max(m.offset-page, 0)
+		case "g", "home":
+			m.offset = 0
+		case "G", "end":
+			m.offset = last
+		}
+		return m, nil
+	}
+
+	id := m.selected()
+	switch msg.String() {
+	case "q", "esc":
+		return m, tea.Quit
+	case "down", "j":
+		m.cursor = min(m.cursor+1, max(len(m.rows)-1, 0))
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "r":
+		if !m.loading {
+			m.loading = true
+			return m, m.load()
+		}
+	case "enter", "l":
+		if id != "" {
+			return m, m.capture("Log of "+id, func(w *bytes.Buffer) error {
+				return m.repo.Log(m.ctx, id, false, false, w)
+			})
+		}
+	case "d":
+		if id != "" {
+			return m, m.capture("Diff of "+id, func(w *bytes.Buffer) error {
+				return m.repo.Diff(m.ctx, id, repository.DiffOptions{}, w)
+			})
+		}
+	case "e":
+		if id != "" {
+			m.mode, m.target = uiModeExec, id
+		}
+	case "t":
+		if id != "" {
+			return m, tea.ExecProcess(exec.CommandContext(m.ctx, m.self, "terminal", id), func(err error) tea.Msg {
+				return uiDoneMsg{err: err}
+			})
+		}
+	case "x":
+		if id != "" {
+			m.mode, m.target = uiModeDelete, id
+		}
+	}
+	return m, nil
+}
+
+// viewerHeight returns how many lines of output fit on the screen, 0 when its size is unknown.
+func (m uiModel) viewerHeight() int {
+	if m.height == 0 {
+		return 0
+	}
+	return max(m.height-2, 1)
+}
+
+var (
+	uiTitleStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FAFAFA")).Background(lipgloss.Color("#7D56F4")).Padding(0, 1).Bold(true)
+	uiHeaderStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#7D56F4")).Bold(true)
+	uiSelectedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FAFAFA")).Background(lipgloss.Color("#F25D94")).Bold(true)
+	uiWarningStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500"))
+	uiFooterStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#626262"))
+)
+
+func (m uiModel) View() string {
+	if m.mode == uiModeOutput {
+		return m.viewOutput()
+	}
+
+	var s strings.Builder
+	s.WriteString(uiTitleStyle.Render("container-use environments"))
+	s.WriteString("\n\n")
+
+	if len(m.rows) == 0 {
+		if m.loading {
+			s.WriteString("Loading environments...\n")
+		} else {
+			s.WriteString("No environments found.\n")
+		}
+	} else {
+		lines := strings.Split(strings.TrimRight(m.table(), "\n"), "\n")
+		s.WriteString(uiHeaderStyle.Render(lines[0]))
+		s.WriteString("\n")
+		for i, line := range lines[1:] {
+			if i == m.cursor {
+				line = uiSelectedStyle.Render(line)
+			}
+			s.WriteString(line)
+			s.WriteString("\n")
+		}
+		if row := m.rows[m.cursor]; row.metrics.Title != "" || len(row.metrics.Problems) > 0 {
+			s.WriteString("\n")
+			if row.metrics.Title != "" {
+				s.WriteString(row.metrics.Title)
+				s.WriteString("\n")
+			}
+			for _, problem := range row.metrics.Problems {
+				s.WriteString(uiWarningStyle.Render("⚠ " + problem))
+				s.WriteString("\n")
+			}
+		}
+	}
+
+	s.WriteString("\n")
+	switch m.mode {
+	case uiModeExec:
+		fmt.Fprintf(&s, "Run in %s: %s█\n", m.target, m.input)
+		s.WriteString(uiFooterStyle.Render("enter run • esc cancel"))
+	case uiModeDelete:
+		s.WriteString(uiWarningStyle.Render(fmt.Sprintf("Delete environment %s? [y/N]", m.target)))
+	default:
+		if m.status != "" {
+			s.WriteString(m.status)
+			s.WriteString("\n")
+		}
+		s.WriteString(uiFooterStyle.Render("↑/↓ select • enter log • d diff • e exec • t terminal • x delete • r refresh • q quit"))
+	}
+	return s.String()
+}
+
+// table renders the environments as aligned columns, a header line first.
+func (m uiModel) table() string {
+	var out bytes.Buffer
+	tw := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tBRANCH\tLAST COMMAND\tUPDATED")
+	for _, row := range m.rows {
+		status := row.metrics.Status
+		if !row.metrics.Healthy {
+			status += " ⚠"
+		}
+		updated := "-"
+		if !row.metrics.UpdatedAt.IsZero() {
+			updated = humanize.Time(row.metrics.UpdatedAt)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", row.metrics.ID, status, describeDivergence(row.divergence), describeLastCommand(row.metrics), updated)
+	}
+	tw.Flush()
+	return out.String()
+}
+
+// describeDivergence summarizes the commits an environment's branch and the user's branch don't share.
+func describeDivergence(divergence *repository.Divergence) string {
+	if divergence == nil {
+		return "-"
+	}
+	if divergence.Ahead == 0 && divergence.Behind == 0 {
+		return "up to date"
+	}
+	return fmt.Sprintf("↑%d ↓%d", divergence.Ahead, divergence.Behind)
+}
+
+// describeLastCommand summarizes the command running in an environment, or else the last one that finished.
+func describeLastCommand(metrics *repository.EnvironmentMetrics) string {
+	const width = 40
+	switch {
+	case len(metrics.RunningCommands) > 0:
+		return "▶ " + repository.Ellipsis(metrics.RunningCommands[0], width)
+	case metrics.LastCommand == nil:
+		return "-"
+	case metrics.LastCommand.ExitCode == nil:
+		return "✗ " + repository.Ellipsis(metrics.LastCommand.Command, width) + " (failed to run)"
+	case *metrics.LastCommand.ExitCode != 0:
+		return fmt.Sprintf("✗ %s (exit %d)", repository.Ellipsis(metrics.LastCommand.Command, width), *metrics.LastCommand.ExitCode)
+	default:
+		return "✓ " + repository.Ellipsis(metrics.LastCommand.Command, width)
+	}
+}
+
+// ellipsis shortens s to max runes, on a single line.
+func (m uiModel) viewOutput() string {
+	lines := m.output
+	if height := m.viewerHeight(); height > 0 {
+		lines = lines[m.offset:min(m.offset+height, len(lines))]
+	}
+	var s strings.Builder
+	s.WriteString(uiTitleStyle.Render(m.title))
+	s.WriteString("\n")
+	for _, line := range lines {
+		s.WriteString(line)
+		s.WriteString("\n")
+	}
+	s.WriteString(uiFooterStyle.Render(fmt.Sprintf("lines %d-%d of %d • j/k scroll • pgup/pgdown page • g/G top/bottom • q back",
+		min(m.offset+1, len(m.output)), m.offset+len(lines), len(m.output))))
+	return s.String()
+}
+
+func init() {
+	uiCmd.Flags().Duration("interval", 2*time.Second, "How often to refresh the list of environments")
+	rootCmd.AddCommand(uiCmd)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dagger/container-use/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUIModel(t *testing.T) {
+	failed := 2
+	rows := []uiRow{
+		{metrics: &repository.EnvironmentMetrics{ID: "fancy-mallard", Status: "idle", Healthy: true, UpdatedAt: time.Now()}},
+		{
+			metrics: &repository.EnvironmentMetrics{
+				ID:          "backend-api",
+				Title:       "Add the users endpoint",
+				Status:      "idle",
+				LastCommand: &repository.CommandSummary{Command: "go test ./...", ExitCode: &failed},
+				Problems:    []string{"last command failed"},
+			},
+			divergence: &repository.Divergence{Ahead: 3, Behind: 1},
+		},
+	}
+	var model tea.Model = newUIModel(t.Context(), nil, "container-use", time.Second)
+	model, _ = model.Update(uiRowsMsg{rows: rows})
+
+	view := model.View()
+	assert.Contains(t, view, "fancy-mallard")
+	assert.Contains(t, view, "↑3 ↓1")
+	assert.Contains(t, view, "✗ go test ./... (exit 2)")
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, "backend-api", model.(uiModel).selected())
+	assert.Contains(t, model.View(), "⚠ last command failed")
+
+	// The selection follows the environment when the list changes.
+	model, _ = model.Update(uiRowsMsg{rows: rows[1:]})
+	assert.Equal(t, "backend-api", model.(uiModel).selected())
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	assert.Contains(t, model.View(), "Delete environment backend-api?")
+	model, cmd := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	assert.Nil(t, cmd, "anything but y cancels")
+	assert.Equal(t, uiModeList, model.(uiModel).mode)
+
+	// The confirmed deletion targets the environment chosen, even if the list changed meanwhile.
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	model, _ = model.Update(uiRowsMsg{rows: rows[:1]})
+	assert.Equal(t, "fancy-mallard", model.(uiModel).selected())
+	assert.Contains(t, model.View(), "Delete environment backend-api?")
+	model, cmd = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	assert.NotNil(t, cmd)
+	assert.Equal(t, "Deleting backend-api...", model.(uiModel).status)
+	model, _ = model.Update(uiRowsMsg{rows: rows[1:]})
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	model, _ = model.Update(uiRowsMsg{rows: rows})
+	for _, key := range []tea.KeyMsg{{Type: tea.KeyRunes, Runes: []rune("ls")}, {Type: tea.KeySpace}, {Type: tea.KeyRunes, Runes: []rune("-la")}, {Type: tea.KeyBackspace}} {
+		model, _ = model.Update(key)
+	}
+	assert.Contains(t, model.View(), "Run in backend-api: ls -l")
+
+	model, _ = model.Update(tea.WindowSizeMsg{Width: 80, Height: 4})
+	model, _ = model.Update(uiOutputMsg{title: "Log of backend-api", output: "one\ntwo\nthree\nfour\n"})
+	assert.Contains(t, model.View(), "lines 1-2 of 4")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("G")})
+	assert.Contains(t, model.View(), "three\nfour\n")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.Equal(t, uiModeList, model.(uiModel).mode)
+}
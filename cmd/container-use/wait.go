@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+// waitResult is the JSON result of the wait command.
+type waitResult struct {
+	Environment string `json:"environment"`
+	Condition   string `json:"condition"`
+	Met         bool   `json:"met"`
+	ElapsedMS   int64  `json:"elapsed_ms"`
+	// Detail describes the last state observed, e.g. the commands still running.
+	Detail string `json:"detail,omitempty"`
+	// ExitCode is the exit code of the finished command or of the health check.
+	ExitCode *int `json:"exit_code,omitempty"`
+}
+
+// waitCheck reports whether a condition is met, and describes the state it observed.
+type waitCheck func(ctx context.Context) (met bool, detail string, exitCode *int, err error)
+
+var waitCmd = &cobra.Command{
+	Use:   "wait [<env>]",
+	Short: "Wait until an environment reaches a condition",
+	Long: `Block until an environment reaches a condition, for scripts and CI orchestrating agents:
+
+  --created            the environment's creation completed (default)
+  --idle               no command is running in the environment
+  --finished <text>    the last run of a command containing <text> finished
+  --healthy <command>  a check command succeeds in the environment
+  --file <path>        a file or directory exists in the environment
+
+Every condition first waits for the environment's creation to complete.
+The command fails if the timeout expires first, or if the command waited for
+with --finished failed.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD. Waiting for the creation of an
+environment requires its ID.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Wait for an environment created with a known ID
+container-use create "Fix login redirect" --id fix-login &
+container-use wait fix-login
+
+# Wait for the agent's test run to finish
+container-use wait fancy-mallard --finished "go test"
+
+# Wait for the database service to accept connections, for up to 2 minutes
+container-use wait fancy-mallard --healthy "pg_isready -h db" --timeout 2m
+
+# Wait for a build artifact and get a JSON result
+container-use wait fancy-mallard --file dist/index.html --json`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		finished, _ := app.Flags().GetString("finished")
+		healthy, _ := app.Flags().GetString("healthy")
+		file, _ := app.Flags().GetString("file")
+		idle, _ := app.Flags().GetBool("idle")
+		shell, _ := app.Flags().GetString("shell")
+		timeout, _ := app.Flags().GetDuration("timeout")
+		interval, _ := app.Flags().GetDuration("interval")
+		jsonOutput, _ := app.Flags().GetBool("json")
+
+		var envID string
+		if finished == "" && healthy == "" && file == "" && !idle {
+			// The environment may not exist yet, so it can't be looked up.
+			if len(args) == 0 {
+				return errors.New("waiting for an environment's creation requires its ID")
+			}
+			envID = args[0]
+		} else if envID, err = resolveEnvironmentID(ctx, repo, args); err != nil {
+			return err
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		// Health checks and files are looked up in the environment's container.
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		connect := func() (*dagger.Client, error) {
+			return pool.ClientFor(ctx, repo, envID)
+		}
+
+		condition := "created"
+		var check waitCheck
+		switch {
+		case idle:
+			condition = "idle"
+			check = func(ctx context.Context) (bool, string, *int, error) {
+				running, err := repo.RunningCommands(envID)
+				if err != nil || len(running) > 0 {
+					return false, "running: " + strings.Join(running, ", "), nil, err
+				}
+				return true, "no command running", nil, nil
+			}
+		case finished != "":
+			condition = "finished"
+			check = func(ctx context.Context) (bool, string, *int, error) {
+				event, err := repo.CommandFinished(envID, finished)
+				if err != nil || event == nil {
+					return false, "not finished", nil, err
+				}
+				command, _ := event.Data["command"].(string)
+				exitCode, ok := event.Data["exit_code"].(float64)
+				if !ok {
+					errMessage, _ := event.Data["error"].(string)
+					return true, fmt.Sprintf("%s failed: %s", command, errMessage), nil, nil
+				}
+				code := int(exitCode)
+				return true, fmt.Sprintf("%s exited with code %d", command, code), &code, nil
+			}
+		case healthy != "":
+			condition = "healthy"
+			check = func(ctx context.Context) (bool, string, *int, error) {
+				dag, err := connect()
+				if err != nil {
+					return false, "", nil, err
+				}
+				env, err := repo.Get(ctx, dag, envID)
+				if err != nil {
+					return false, "", nil, err
+				}
+				exitCode, output, err := env.Probe(ctx, healthy, shell)
+				if err != nil {
+					return false, "", nil, err
+				}
+				return exitCode == 0, output, &exitCode, nil
+			}
+		case file != "":
+			condition = "file"
+			check = func(ctx context.Context) (bool, string, *int, error) {
+				dag, err := connect()
+				if err != nil {
+					return false, "", nil, err
+				}
+				env, err := repo.Get(ctx, dag, envID)
+				if err != nil {
+					return false, "", nil, err
+				}
+				exists, err := env.Exists(ctx, file)
+				if err != nil || !exists {
+					return false, file + " doesn't exist", nil, err
+				}
+				return true, file + " exists", nil, nil
+			}
+		}
+
+		result, err := waitFor(ctx, envID, condition, interval, func(ctx context.Context) (bool, string, *int, error) {
+			if !repo.CreationComplete(ctx, envID) {
+				return false, "creating", nil, nil
+			}
+			if check == nil {
+				return true, "", nil, nil
+			}
+			return check(ctx)
+		})
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(result); err != nil {
+				return err
+			}
+		}
+
+		if !result.Met {
+			return fmt.Errorf("timed out after %s waiting for condition %s on %s%s", timeout, condition, envID, formatWaitDetail(result))
+		}
+		if !jsonOutput {
+			elapsed := time.Duration(result.ElapsedMS) * time.Millisecond
+			fmt.Printf("%s: condition %s met after %s%s\n", envID, condition, elapsed.Round(time.Second), formatWaitDetail(result))
+		}
+		if finished != "" && (result.ExitCode == nil || *result.ExitCode != 0) {
+			return fmt.Errorf("%s", result.Detail)
+		}
+		return nil
+	},
+}
+
+func formatWaitDetail(result *waitResult) string {
+	if result.Detail == "" {
+		return ""
+	}
+	return " (" + result.Detail + ")"
+}
+
+// waitFor calls check every interval until the condition is met or the context is done, in which
+// case the result isn't met. Errors of the check are retried, as they can be transient (e.g. the
+// environment's state being updated), but returned if they persist until the end.
+func waitFor(ctx context.Context, envID, condition string, interval time.Duration, check waitCheck) (*waitResult, error) {
+	result := &waitResult{Environment: envID, Condition: condition}
+	startedAt := time.Now()
+	var lastErr error
+	for {
+		met, detail, exitCode, err := check(ctx)
+		result.ElapsedMS = time.Since(startedAt).Milliseconds()
+		switch {
+		case err == nil:
+			lastErr = nil
+			result.Met, result.Detail, result.ExitCode = met, detail, exitCode
+			if met {
+				return result, nil
+			}
+		case ctx.Err() == nil:
+			// Errors caused by the timeout itself aren't worth reporting.
+			lastErr = err
+			slog.Warn("Wait check failed", "environment-id", envID, "condition", condition, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ctx.Err()
+			}
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return result, nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func init() {
+	waitCmd.Flags().Bool("created", false, "Wait for the environment's creation to complete (default)")
+	waitCmd.Flags().Bool("idle", false, "Wait until no command is running in the environment")
+	waitCmd.Flags().String("finished", "", "Wait until the last run of a command containing this text finished")
+	waitCmd.Flags().String("healthy", "", "Wait until this check command succeeds in the environment")
+	waitCmd.Flags().String("file", "", "Wait until this file or directory exists in the environment")
+	waitCmd.MarkFlagsMutuallyExclusive("created", "idle", "finished", "healthy", "file")
+	waitCmd.Flags().String("shell", "sh", "Shell running the --healthy check")
+	waitCmd.Flags().Duration("timeout", 10*time.Minute, "Give up after this long (0 to wait forever)")
+	waitCmd.Flags().Duration("interval", 2*time.Second, "Time between checks")
+	waitCmd.Flags().Bool("json", false, "Output the result as JSON")
+	withSchema(waitCmd, &waitResult{})
+
+	rootCmd.AddCommand(waitCmd)
+}
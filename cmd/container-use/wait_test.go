@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitFor(t *testing.T) {
+	t.Run("met", func(t *testing.T) {
+		checks := 0
+		result, err := waitFor(context.Background(), "test-env", "idle", time.Millisecond, func(context.Context) (bool, string, *int, error) {
+			checks++
+			if checks == 1 {
+				return false, "", nil, errors.New("transient")
+			}
+			return checks == 3, "detail", nil, nil
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Met)
+		assert.Equal(t, "detail", result.Detail)
+		assert.Equal(t, 3, checks)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		result, err := waitFor(ctx, "test-env", "idle", time.Millisecond, func(context.Context) (bool, string, *int, error) {
+			return false, "running: go test", nil, nil
+		})
+		require.NoError(t, err)
+		assert.False(t, result.Met)
+		assert.Equal(t, "running: go test", result.Detail)
+	})
+
+	t.Run("persistent error", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := waitFor(ctx, "test-env", "healthy", time.Millisecond, func(context.Context) (bool, string, *int, error) {
+			return false, "", nil, errors.New("engine unreachable")
+		})
+		assert.ErrorContains(t, err, "engine unreachable")
+	})
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/dagger/container-use/repository"
@@ -11,18 +12,44 @@ import (
 )
 
 var watchCmd = &cobra.Command{
-	Use:   "watch",
-	Short: "Watch environment activity in real-time",
+	Use:   "watch [<env>]",
+	Short: "Watch environment activity in real-time, or sync local edits into an environment",
 	Long: `Continuously display environment activity as agents work.
 Shows new commits and environment changes updated every second.
-Press Ctrl+C to stop watching.`,
+Press Ctrl+C to stop watching.
+
+With --sync, the changes you make to the working tree are synced into the
+container of an environment instead, so you can edit locally and run commands
+in the environment without committing each change. Files git ignores aren't
+synced, nor symlinks. Changes are synced once the working tree stayed unchanged
+for --debounce, and committed to the environment's branch like the changes of
+its commands. Only the changes made after starting are synced: edits to the
+same files in the environment are overwritten.
+
+If no environment is specified with --sync, automatically selects from
+environments that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
 	Example: `# Watch all environment activity
 container-use watch
 
 # Monitor agents while they work
-container-use watch`,
-	RunE: func(app *cobra.Command, _ []string) error {
+container-use watch
+
+# Edit locally and run the tests in an environment
+container-use watch fancy-mallard --sync
+container-use exec fancy-mallard "go test ./..."
+
+# Wait for 2 seconds without changes before syncing
+container-use watch fancy-mallard --sync --debounce 2s`,
+	RunE: func(app *cobra.Command, args []string) error {
 		ctx := app.Context()
+		if sync, _ := app.Flags().GetBool("sync"); sync {
+			return watchSync(app, args)
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("watching an environment requires --sync")
+		}
 
 		// Ensure we're in a git repository
 		if _, err := repository.Open(ctx, "."); err != nil {
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+// syncPollInterval is how often the working tree is scanned for changes by watch --sync.
+const syncPollInterval = 250 * time.Millisecond
+
+// watchSync syncs the changes of the working tree into an environment until interrupted.
+func watchSync(app *cobra.Command, args []string) error {
+	ctx := app.Context()
+	debounce, _ := app.Flags().GetDuration("debounce")
+	if debounce < 0 {
+		return errors.New("--debounce must not be negative")
+	}
+
+	repo, err := repository.Open(ctx, ".")
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	envID, err := resolveEnvironmentID(ctx, repo, args)
+	if err != nil {
+		return err
+	}
+
+	pool, err := newEnginePool(logWriter)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	dag, err := pool.ClientFor(ctx, repo, envID)
+	if err != nil {
+		return err
+	}
+	// Fail early on unknown environments.
+	if _, err := repo.Info(ctx, envID); err != nil {
+		return err
+	}
+
+	synced, err := repo.WorkingTreeFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list the files of the working tree: %w", err)
+	}
+	fmt.Printf("Syncing changes of %s into %s, press Ctrl+C to stop...\n", repo.SourcePath(), envID)
+
+	latest := synced
+	var changedAt time.Time
+	ticker := time.NewTicker(syncPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		files, err := repo.WorkingTreeFiles(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list the files of the working tree: %v\n", err)
+			continue
+		}
+		if !maps.Equal(files, latest) {
+			latest, changedAt = files, time.Now()
+			continue
+		}
+		// Wait for the working tree to settle, e.g. while an editor saves several files or a branch is checked out.
+		if maps.Equal(latest, synced) || time.Since(changedAt) < debounce {
+			continue
+		}
+
+		changed, removed := repository.ChangedFiles(synced, latest)
+		synced = latest
+		if err := syncFiles(app, repo, dag, envID, changed, removed); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Warning: failed to sync %s: %v\n", strings.Join(append(changed, removed...), ", "), err)
+			continue
+		}
+		fmt.Printf("%s Synced %s\n", time.Now().Format(time.TimeOnly), describeSync(changed, removed))
+	}
+}
+
+// syncFiles copies the changed files of the working tree into an environment and deletes the removed ones,
+// recording the change like any other.
+func syncFiles(app *cobra.Command, repo *repository.Repository, dag *dagger.Client, envID string, changed, removed []string) (rerr error) {
+	ctx := app.Context()
+	slot, err := acquireExecSlot(ctx, repo, envID, false)
+	if err != nil {
+		return err
+	}
+	defer slot.Release()
+
+	operationStartedAt := time.Now()
+	defer func() {
+		repo.RecordOperation(envID, "watch-sync", repository.OperationSourceCLI, operationStartedAt, rerr)
+	}()
+
+	env, err := repo.Get(ctx, dag, envID)
+	if err != nil {
+		return fmt.Errorf("failed to load environment: %w", err)
+	}
+	if err := env.SyncFromHost(ctx, repo.SourcePath(), changed, removed); err != nil {
+		return err
+	}
+	return repo.Update(ctx, env, "Sync "+describeSync(changed, removed)+" from the host")
+}
+
+// describeSync summarizes synced files, e.g. "main.go, util.go, 1 removed".
+func describeSync(changed, removed []string) string {
+	var parts []string
+	if len(changed) > 3 {
+		parts = append(parts, fmt.Sprintf("%d files", len(changed)))
+	} else {
+		parts = append(parts, changed...)
+	}
+	if len(removed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d removed", len(removed)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	watchCmd.Flags().Bool("sync", false, "Sync the changes of the working tree into an environment instead of showing activity")
+	watchCmd.Flags().Duration("debounce", 500*time.Millisecond, "With --sync, how long the working tree must stay unchanged before its changes are synced")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/repository"
+	"github.com/dagger/container-use/webui"
+	"github.com/spf13/cobra"
+)
+
+var webCmd = &cobra.Command{
+	Use:   "web",
+	Short: "Serve a local web dashboard for reviewing environments",
+	Long: `Start a local web dashboard that lists environments, shows their diffs and logs,
+and offers merge, apply, and delete actions from the browser. The Terminal tab opens
+'container-use terminal' in the environment, in the page: changes made to the workdir
+are merged into the environment when the shell exits. Commands can also be run one
+line at a time from the Run tab, like 'container-use exec'.
+
+The dashboard is served from assets embedded in the binary. Access is protected by a
+random token included in the printed URL; only share it with people you trust.`,
+	Example: `# Serve the dashboard on the default address
+container-use web
+
+# Serve on a different port
+container-use web --addr 127.0.0.1:9000`,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+
+		addr, _ := app.Flags().GetString("addr")
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		// The dashboard stays useful for review without dagger; only running commands needs it.
+		slog.Info("connecting to dagger")
+		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+		if err != nil {
+			slog.Error("Error starting dagger", "error", err)
+			if isDockerDaemonError(err) {
+				handleDockerDaemonError()
+			}
+			fmt.Fprintf(os.Stderr, "Warning: dagger is unavailable, running commands is disabled: %v\n", err)
+			dag = nil
+		} else {
+			defer dag.Close()
+		}
+
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find container-use executable: %w", err)
+		}
+
+		token, err := webui.NewToken()
+		if err != nil {
+			return fmt.Errorf("failed to generate access token: %w", err)
+		}
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		fmt.Printf("Serving container-use dashboard at http://%s/?token=%s\n", listener.Addr(), token)
+		fmt.Println("Press Ctrl+C to stop.")
+
+		return webui.New(repo, dag, self, token).Serve(ctx, listener)
+	},
+}
+
+func init() {
+	webCmd.Flags().String("addr", "127.0.0.1:8088", "Address to serve the dashboard on")
+	rootCmd.AddCommand(webCmd)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var writeCmd = &cobra.Command{
+	Use:   "write [<env>]",
+	Short: "Apply a batch of file operations to an environment in a single commit",
+	Long: `Create, update, delete and rename files of an environment at once, in a single
+commit, like the environment_file_batch MCP tool. The operations are read as a
+JSON array from --file, or from stdin:
+
+  [
+    {"action": "rename", "path": "pkg/util.go", "to": "pkg/strings.go"},
+    {"action": "update", "path": "main.go", "contents": "package main\n..."},
+    {"action": "create", "path": "pkg/strings_test.go", "contents": "..."},
+    {"action": "delete", "path": "pkg/old.go"}
+  ]
+
+Paths are relative to the workdir unless absolute. The operations are applied
+in order, all or nothing: created files mustn't exist, updated, deleted and
+renamed files must, and if any operation fails none is applied. A rename can
+set "contents" to also rewrite the file.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Apply the operations of a file
+container-use write fancy-mallard --file operations.json
+
+# Apply operations generated by a script
+./generate-operations.sh | container-use write fancy-mallard -m "Rename util to strings"`,
+	RunE: func(app *cobra.Command, args []string) (rerr error) {
+		ctx := app.Context()
+
+		input := io.Reader(os.Stdin)
+		if file, _ := app.Flags().GetString("file"); file != "" && file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			input = f
+		}
+		var operations []environment.FileOperation
+		if err := json.NewDecoder(input).Decode(&operations); err != nil {
+			return fmt.Errorf("failed to read the file operations: %w", err)
+		}
+		for i, op := range operations {
+			if err := op.Validate(); err != nil {
+				return fmt.Errorf("operation %d: %w", i+1, err)
+			}
+		}
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		pool, err := newEnginePool(logWriter)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		dag, err := pool.ClientFor(ctx, repo, envID)
+		if err != nil {
+			return err
+		}
+
+		noWait, _ := app.Flags().GetBool("no-wait")
+		slot, err := acquireExecSlot(ctx, repo, envID, noWait)
+		if err != nil {
+			return err
+		}
+		defer slot.Release()
+
+		operationStartedAt := time.Now()
+		defer func() { repo.RecordOperation(envID, "write", repository.OperationSourceCLI, operationStartedAt, rerr) }()
+
+		env, err := repo.Get(ctx, dag, envID)
+		if err != nil {
+			return fmt.Errorf("failed to load environment: %w", err)
+		}
+		message, _ := app.Flags().GetString("message")
+		if message == "" {
+			message = fmt.Sprintf("Apply %d file operation(s)", len(operations))
+		}
+		if err := env.FileBatch(ctx, message, operations); err != nil {
+			return fmt.Errorf("failed to apply the file operations, none was applied: %w", err)
+		}
+		if err := repo.Update(ctx, env, message); err != nil {
+			return fmt.Errorf("applied but failed to update repository: %w", err)
+		}
+
+		fmt.Printf("Applied %d file operation(s) to %s:\n", len(operations), envID)
+		for _, op := range operations {
+			fmt.Printf("  %s\n", op.String())
+		}
+		return nil
+	},
+}
+
+func init() {
+	writeCmd.Flags().StringP("file", "f", "", "JSON file with the operations to apply (default: read from stdin)")
+	writeCmd.Flags().StringP("message", "m", "", "Explanation of the change, used in its commit message")
+	writeCmd.Flags().Bool("no-wait", false, "Fail instead of waiting if a command is running in the environment")
+	rootCmd.AddCommand(writeCmd)
+}
@@ -0,0 +1,143 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// maxMessageSize bounds the messages clients send, which are small requests.
+const maxMessageSize = 16 << 20
+
+// JSON-RPC error codes: the ones of the specification, and the ones of the Language Server Protocol that editor
+// extensions already handle.
+const (
+	codeParseError       = -32700
+	codeInvalidRequest   = -32600
+	codeMethodNotFound   = -32601
+	codeInvalidParams    = -32602
+	codeInternalError    = -32603
+	codeNotInitialized   = -32002
+	codeUnauthorized     = -32001
+	codeRequestCancelled = -32800
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification tells whether the request expects no response.
+func (r *request) isNotification() bool {
+	return len(r.ID) == 0
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// rpcError is the error of a JSON-RPC response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func errorf(code int, format string, args ...any) *rpcError {
+	return &rpcError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// stream reads and writes JSON-RPC messages framed like the base protocol of the Language Server Protocol,
+// each preceded by a Content-Length header, so the JSON-RPC libraries of editors read them as they are.
+// Writes are serialized: responses and notifications are sent concurrently.
+type stream struct {
+	reader *textproto.Reader
+
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func newStream(r io.Reader, w io.Writer) *stream {
+	return &stream{reader: textproto.NewReader(bufio.NewReader(r)), writer: w}
+}
+
+// read returns the next message. Malformed headers fail the stream, which can't find the next message;
+// malformed JSON only fails the message.
+func (s *stream) read() ([]byte, error) {
+	header, err := s.reader.ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read the message header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is larger than the maximum of %d", length, maxMessageSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader.R, body); err != nil {
+		return nil, fmt.Errorf("failed to read the message: %w", err)
+	}
+	return body, nil
+}
+
+func (s *stream) write(message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.writer.Write(body)
+	return err
+}
+
+// respond sends the result of the request, or its error.
+func (s *stream) respond(id json.RawMessage, result any, err error) error {
+	resp := &response{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return s.write(resp)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return s.write(&response{JSONRPC: "2.0", ID: id, Error: errorf(codeInternalError, "failed to encode the result: %s", err)})
+	}
+	resp.Result = data
+	return s.write(resp)
+}
+
+// notify sends a notification, which expects no response.
+func (s *stream) notify(method string, params any) error {
+	return s.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
@@ -0,0 +1,589 @@
+// Package daemon serves a local JSON-RPC endpoint for editor extensions, such as VS Code or JetBrains ones,
+// so they list environments, follow their changes, open their diffs and run commands without starting the
+// CLI for every action.
+//
+// Messages are JSON-RPC 2.0, framed like the Language Server Protocol: the JSON-RPC libraries of editors
+// speak it as they are. The endpoint is served on the standard streams of the daemon, or on a loopback
+// address where every connection must first initialize with the session token printed at startup.
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+)
+
+// changePollInterval is how often the environments are listed for the subscribers to their changes.
+var changePollInterval = time.Second
+
+// ClientFunc returns a Dagger client of the engine hosting an environment.
+type ClientFunc func(ctx context.Context, envID string) (*dagger.Client, error)
+
+type Server struct {
+	repo      *repository.Repository
+	clientFor ClientFunc
+	token     string
+	version   string
+}
+
+// New returns a server of the repository's environments. Connections must initialize with the token, unless
+// it's empty.
+func New(repo *repository.Repository, clientFor ClientFunc, token, version string) *Server {
+	return &Server{
+		repo:      repo,
+		clientFor: clientFor,
+		token:     token,
+		version:   version,
+	}
+}
+
+// Serve serves the connections of the listener until the context is cancelled.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			connCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			// Closing the connection unblocks the read of the next message.
+			go func() {
+				<-connCtx.Done()
+				conn.Close()
+			}()
+			if err := s.ServeConn(connCtx, conn, conn); err != nil && connCtx.Err() == nil {
+				slog.Warn("daemon connection failed", "remote", conn.RemoteAddr(), "err", err)
+			}
+		}()
+	}
+}
+
+// ServeConn serves the messages read from r, writing the responses and notifications to w, until r is closed.
+// Requests are handled concurrently: a long command doesn't hold the others back.
+func (s *Server) ServeConn(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	sess := &session{
+		ctx:     ctx,
+		server:  s,
+		stream:  newStream(r, w),
+		pending: map[string]context.CancelFunc{},
+	}
+	defer func() {
+		cancel()
+		sess.wg.Wait()
+	}()
+
+	for {
+		body, err := sess.stream.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			sess.stream.respond(nil, nil, errorf(codeParseError, "invalid JSON: %s", err))
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			if !req.isNotification() {
+				sess.stream.respond(req.ID, nil, errorf(codeInvalidRequest, "expected a JSON-RPC 2.0 request"))
+			}
+			continue
+		}
+		if req.isNotification() {
+			sess.handleNotification(&req)
+			continue
+		}
+		// Requests are only handled once initialized, which is done before reading the next one.
+		if req.Method == "initialize" {
+			result, err := sess.initialize(req.Params)
+			sess.stream.respond(req.ID, result, err)
+			continue
+		}
+		if !sess.initialized.Load() {
+			sess.stream.respond(req.ID, nil, errorf(codeNotInitialized, "the connection must be initialized first"))
+			continue
+		}
+		sess.dispatch(ctx, &req)
+	}
+}
+
+// session is the state of a connection.
+type session struct {
+	// ctx is cancelled once the connection is closed.
+	ctx         context.Context
+	server      *Server
+	stream      *stream
+	initialized atomic.Bool
+	wg          sync.WaitGroup
+
+	mu sync.Mutex
+	// pending cancels the requests being handled, by ID.
+	pending map[string]context.CancelFunc
+	// unsubscribe stops sending the changes of the environments, if subscribed.
+	unsubscribe context.CancelFunc
+}
+
+type method func(sess *session, ctx context.Context, id json.RawMessage, params json.RawMessage) (any, error)
+
+var methods = map[string]method{
+	"environments/list":         (*session).list,
+	"environments/get":          (*session).get,
+	"environments/diff":         (*session).diff,
+	"environments/changedFiles": (*session).changedFiles,
+	"environments/fileVersions": (*session).fileVersions,
+	"environments/exec":         (*session).exec,
+	"environments/subscribe":    (*session).subscribe,
+	"environments/unsubscribe":  (*session).unsubscribeChanges,
+}
+
+// dispatch handles the request in the background, until it's done or cancelled.
+func (sess *session) dispatch(ctx context.Context, req *request) {
+	handler, ok := methods[req.Method]
+	if !ok {
+		sess.stream.respond(req.ID, nil, errorf(codeMethodNotFound, "method not found: %s", req.Method))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	key := string(req.ID)
+	sess.mu.Lock()
+	sess.pending[key] = cancel
+	sess.mu.Unlock()
+
+	sess.wg.Add(1)
+	go func() {
+		defer sess.wg.Done()
+		defer func() {
+			sess.mu.Lock()
+			delete(sess.pending, key)
+			sess.mu.Unlock()
+			cancel()
+		}()
+
+		result, err := handler(sess, ctx, req.ID, req.Params)
+		if err != nil && ctx.Err() != nil {
+			err = errorf(codeRequestCancelled, "request cancelled")
+		}
+		if err := sess.stream.respond(req.ID, result, err); err != nil {
+			slog.Warn("failed to send the daemon response", "method", req.Method, "err", err)
+		}
+	}()
+}
+
+type cancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// handleNotification handles the notifications of the client: only the cancellation of requests, like in
+// the Language Server Protocol. Others are ignored, as the specification requires.
+func (sess *session) handleNotification(req *request) {
+	if req.Method != "$/cancelRequest" {
+		return
+	}
+	var params cancelParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return
+	}
+	sess.mu.Lock()
+	cancel := sess.pending[string(params.ID)]
+	sess.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// decodeParams decodes the params of a request, failing with an invalid params error.
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		params = []byte("{}")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return errorf(codeInvalidParams, "invalid params: %s", err)
+	}
+	return nil
+}
+
+type initializeParams struct {
+	Token string `json:"token"`
+}
+
+type initializeResult struct {
+	Version    string   `json:"version"`
+	Repository string   `json:"repository"`
+	Methods    []string `json:"methods"`
+}
+
+func (sess *session) initialize(params json.RawMessage) (*initializeResult, error) {
+	var p initializeParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if token := sess.server.token; token != "" && subtle.ConstantTimeCompare([]byte(p.Token), []byte(token)) != 1 {
+		return nil, errorf(codeUnauthorized, "invalid or missing token")
+	}
+	sess.initialized.Store(true)
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return &initializeResult{
+		Version:    sess.server.version,
+		Repository: sess.server.repo.SourcePath(),
+		Methods:    names,
+	}, nil
+}
+
+type environmentParams struct {
+	ID string `json:"id"`
+}
+
+func (p *environmentParams) validate() error {
+	if p.ID == "" {
+		return errorf(codeInvalidParams, "id is required")
+	}
+	return nil
+}
+
+// environmentSummary is an environment as listed by environments/list.
+type environmentSummary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Agent     string    `json:"agent,omitempty"`
+	Labels    []string  `json:"labels,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func summarize(envInfo *environment.EnvironmentInfo) *environmentSummary {
+	return &environmentSummary{
+		ID:        envInfo.ID,
+		Title:     envInfo.State.Title,
+		Agent:     envInfo.State.Agent,
+		Labels:    envInfo.State.Labels,
+		CreatedAt: envInfo.State.CreatedAt,
+		UpdatedAt: envInfo.State.UpdatedAt,
+	}
+}
+
+func (sess *session) list(ctx context.Context, _, _ json.RawMessage) (any, error) {
+	envs, err := sess.server.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]*environmentSummary, 0, len(envs))
+	for _, envInfo := range envs {
+		summaries = append(summaries, summarize(envInfo))
+	}
+	return summaries, nil
+}
+
+func (sess *session) get(ctx context.Context, _, params json.RawMessage) (any, error) {
+	var p environmentParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	envInfo, err := sess.server.repo.Info(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	envInfo.State.Container = ""
+	return envInfo, nil
+}
+
+type diffParams struct {
+	environmentParams
+	// Paths limits the diff to these files or directories, relative to the repository root.
+	Paths []string `json:"paths,omitempty"`
+}
+
+type diffResult struct {
+	Diff string `json:"diff"`
+}
+
+func (sess *session) diff(ctx context.Context, _, params json.RawMessage) (any, error) {
+	var p diffParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := sess.server.repo.Diff(ctx, p.ID, repository.DiffOptions{Paths: p.Paths}, &buf); err != nil {
+		return nil, err
+	}
+	return &diffResult{Diff: buf.String()}, nil
+}
+
+func (sess *session) changedFiles(ctx context.Context, _, params json.RawMessage) (any, error) {
+	var p environmentParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return sess.server.repo.ChangedFileStats(ctx, p.ID)
+}
+
+type fileVersionsParams struct {
+	environmentParams
+	Path string `json:"path"`
+}
+
+func (sess *session) fileVersions(ctx context.Context, _, params json.RawMessage) (any, error) {
+	var p fileVersionsParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if p.Path == "" {
+		return nil, errorf(codeInvalidParams, "path is required")
+	}
+	return sess.server.repo.FileVersions(ctx, p.ID, p.Path)
+}
+
+type execParams struct {
+	environmentParams
+	Command       string `json:"command"`
+	Shell         string `json:"shell,omitempty"`
+	UseEntrypoint bool   `json:"use_entrypoint,omitempty"`
+}
+
+type execResult struct {
+	EnvironmentID   string `json:"environment_id"`
+	ExitCode        int    `json:"exit_code"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	ExecutionTimeMS int64  `json:"execution_time_ms"`
+	QueueWaitMS     int64  `json:"queue_wait_ms"`
+}
+
+// execOutput is the params of the exec/output notifications, streaming the output of a command.
+type execOutput struct {
+	RequestID json.RawMessage `json:"request_id"`
+	// Stream is stdout or stderr.
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
+
+// execQueued is the params of the exec/queued notifications, telling a command waits for the others running in
+// the environment.
+type execQueued struct {
+	RequestID json.RawMessage `json:"request_id"`
+	Position  int             `json:"position"`
+}
+
+// outputWriter sends what's written to it as exec/output notifications.
+type outputWriter struct {
+	sess      *session
+	requestID json.RawMessage
+	stream    string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if err := w.sess.stream.notify("exec/output", &execOutput{RequestID: w.requestID, Stream: w.stream, Data: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// exec runs a command in the environment like container-use exec, streaming its output as exec/output
+// notifications, and commits its changes.
+func (sess *session) exec(ctx context.Context, id, params json.RawMessage) (_ any, rerr error) {
+	p := execParams{Shell: "sh"}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if p.Command == "" {
+		return nil, errorf(codeInvalidParams, "command is required")
+	}
+
+	repo := sess.server.repo
+	dag, err := sess.server.clientFor(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := repo.AcquireExec(ctx, p.ID, false, func(position int) {
+		sess.stream.notify("exec/queued", &execQueued{RequestID: id, Position: position})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire environment: %w", err)
+	}
+	defer slot.Release()
+
+	operationStartedAt := time.Now()
+	defer func() { repo.RecordOperation(p.ID, "exec", repository.OperationSourceIDE, operationStartedAt, rerr) }()
+
+	env, err := repo.Get(ctx, dag, p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load environment: %w", err)
+	}
+	ctx = environment.WithOutputStream(ctx, &environment.OutputStream{
+		Stdout: &outputWriter{sess: sess, requestID: id, stream: "stdout"},
+		Stderr: &outputWriter{sess: sess, requestID: id, stream: "stderr"},
+	})
+
+	startTime := time.Now()
+	stdout, stderr, exitCode, err := env.RunWithExitCode(ctx, p.Command, p.Shell, p.UseEntrypoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute command: %w", err)
+	}
+	executionTime := time.Since(startTime)
+	if err := repo.Update(ctx, env, ""); err != nil {
+		return nil, fmt.Errorf("command executed but failed to update repository: %w", err)
+	}
+	return &execResult{
+		EnvironmentID:   p.ID,
+		ExitCode:        exitCode,
+		Stdout:          stdout,
+		Stderr:          stderr,
+		ExecutionTimeMS: executionTime.Milliseconds(),
+		QueueWaitMS:     slot.Waited.Milliseconds(),
+	}, nil
+}
+
+// Changes of environments.
+const (
+	changeCreated = "created"
+	changeUpdated = "updated"
+	changeDeleted = "deleted"
+)
+
+// environmentChange is the params of the environments/changed notifications.
+type environmentChange struct {
+	ID string `json:"id"`
+	// Change is created, updated or deleted.
+	Change string `json:"change"`
+	// Environment is the environment as listed by environments/list, unless deleted.
+	Environment *environmentSummary `json:"environment,omitempty"`
+}
+
+// subscribe sends environments/changed notifications whenever an environment is created, updated or deleted,
+// until unsubscribed or the connection is closed.
+func (sess *session) subscribe(ctx context.Context, _, _ json.RawMessage) (any, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.unsubscribe != nil {
+		return nil, nil
+	}
+
+	// The changes are relative to the environments when subscribing, so none is missed after listing them.
+	envs, err := sess.server.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, known := diffEnvironments(nil, envs)
+
+	// The subscription outlives the request, until the connection is closed.
+	watchCtx, cancel := context.WithCancel(sess.ctx)
+	sess.unsubscribe = cancel
+	sess.wg.Add(1)
+	go func() {
+		defer sess.wg.Done()
+		sess.watchChanges(watchCtx, known)
+	}()
+	return nil, nil
+}
+
+func (sess *session) unsubscribeChanges(context.Context, json.RawMessage, json.RawMessage) (any, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.unsubscribe != nil {
+		sess.unsubscribe()
+		sess.unsubscribe = nil
+	}
+	return nil, nil
+}
+
+// watchChanges lists the environments until the context is cancelled, notifying their changes since the
+// known ones.
+func (sess *session) watchChanges(ctx context.Context, known map[string]time.Time) {
+	ticker := time.NewTicker(changePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		envs, err := sess.server.repo.List(ctx)
+		if err != nil {
+			slog.Warn("failed to list the environments of the daemon subscription", "err", err)
+			continue
+		}
+		var changes []*environmentChange
+		changes, known = diffEnvironments(known, envs)
+		for _, change := range changes {
+			if err := sess.stream.notify("environments/changed", change); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// diffEnvironments returns the changes of the environments since the known ones, by ID with their last update,
+// and the known environments to compare the next ones with.
+func diffEnvironments(known map[string]time.Time, envs []*environment.EnvironmentInfo) ([]*environmentChange, map[string]time.Time) {
+	changes := []*environmentChange{}
+	current := map[string]time.Time{}
+	for _, envInfo := range envs {
+		current[envInfo.ID] = envInfo.State.UpdatedAt
+		updatedAt, ok := known[envInfo.ID]
+		switch {
+		case !ok:
+			changes = append(changes, &environmentChange{ID: envInfo.ID, Change: changeCreated, Environment: summarize(envInfo)})
+		case !updatedAt.Equal(envInfo.State.UpdatedAt):
+			changes = append(changes, &environmentChange{ID: envInfo.ID, Change: changeUpdated, Environment: summarize(envInfo)})
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(known)) {
+		if _, ok := current[id]; !ok {
+			changes = append(changes, &environmentChange{ID: id, Change: changeDeleted})
+		}
+	}
+	return changes, current
+}
@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// client is the client side of a connection to the server.
+type client struct {
+	t      *testing.T
+	stream *stream
+	nextID int
+}
+
+// call sends a request and returns its response, skipping notifications.
+func (c *client) call(method string, params any) *response {
+	c.t.Helper()
+	c.nextID++
+	id, _ := json.Marshal(c.nextID)
+	data, err := json.Marshal(params)
+	require.NoError(c.t, err)
+	require.NoError(c.t, c.stream.write(&request{JSONRPC: "2.0", ID: id, Method: method, Params: data}))
+	for {
+		body, err := c.stream.read()
+		require.NoError(c.t, err)
+		var resp response
+		require.NoError(c.t, json.Unmarshal(body, &resp))
+		if resp.ID != nil {
+			assert.JSONEq(c.t, string(id), string(resp.ID))
+			return &resp
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	userRepo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-b", "main"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = userRepo
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	repo, err := repository.OpenWithBasePath(ctx, userRepo, t.TempDir())
+	require.NoError(t, err)
+
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- New(repo, nil, "secret", "v1.2.3").ServeConn(ctx, serverReader, serverWriter)
+	}()
+	c := &client{t: t, stream: newStream(clientReader, clientWriter)}
+
+	resp := c.call("environments/list", nil)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, codeNotInitialized, resp.Error.Code)
+
+	resp = c.call("initialize", map[string]string{"token": "wrong"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, codeUnauthorized, resp.Error.Code)
+
+	resp = c.call("initialize", map[string]string{"token": "secret"})
+	require.Nil(t, resp.Error)
+	var initialized initializeResult
+	require.NoError(t, json.Unmarshal(resp.Result, &initialized))
+	assert.Equal(t, "v1.2.3", initialized.Version)
+	assert.Contains(t, initialized.Methods, "environments/exec")
+
+	resp = c.call("environments/list", nil)
+	require.Nil(t, resp.Error)
+	assert.JSONEq(t, "[]", string(resp.Result))
+
+	resp = c.call("environments/get", map[string]string{})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, codeInvalidParams, resp.Error.Code)
+
+	resp = c.call("environments/merge", map[string]string{"id": "fancy-mallard"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, codeMethodNotFound, resp.Error.Code)
+
+	resp = c.call("environments/subscribe", nil)
+	require.Nil(t, resp.Error)
+	assert.JSONEq(t, "null", string(resp.Result))
+
+	clientWriter.Close()
+	require.NoError(t, <-done)
+}
+
+func TestDiffEnvironments(t *testing.T) {
+	t0 := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+	env := func(id string, updatedAt time.Time) *environment.EnvironmentInfo {
+		return &environment.EnvironmentInfo{ID: id, State: &environment.State{UpdatedAt: updatedAt}}
+	}
+
+	changes, known := diffEnvironments(nil, []*environment.EnvironmentInfo{env("a", t0), env("b", t0)})
+	assert.Len(t, changes, 2)
+
+	changes, known = diffEnvironments(known, []*environment.EnvironmentInfo{env("a", t0.Add(time.Second)), env("c", t0)})
+	require.Len(t, changes, 3)
+	assert.Equal(t, &environmentChange{ID: "a", Change: changeUpdated, Environment: &environmentSummary{ID: "a", UpdatedAt: t0.Add(time.Second)}}, changes[0])
+	assert.Equal(t, changeCreated, changes[1].Change)
+	assert.Equal(t, &environmentChange{ID: "b", Change: changeDeleted}, changes[2])
+
+	changes, _ = diffEnvironments(known, []*environment.EnvironmentInfo{env("a", t0.Add(time.Second)), env("c", t0)})
+	assert.Empty(t, changes)
+}
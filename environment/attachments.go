@@ -0,0 +1,80 @@
+package environment
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// Attachment is a host file staged into the container for a single command, such as a fixture.
+type Attachment struct {
+	// Source is the path of the file on the host.
+	Source string `json:"source"`
+	// Target is the path of the file in the container, relative to the workdir unless absolute.
+	Target string `json:"target"`
+}
+
+// ParseAttachment parses a "source[:target]" attachment. Without a target, the file is staged in the
+// workdir under its base name.
+func ParseAttachment(spec string) (*Attachment, error) {
+	source, target := spec, ""
+	// Split on the last colon, past the drive letter of Windows paths (C:\...).
+	if i := strings.LastIndex(spec, ":"); i > len(filepath.VolumeName(spec)) {
+		source, target = spec[:i], spec[i+1:]
+	}
+	if source == "" {
+		return nil, fmt.Errorf("invalid attachment %q: the source is empty", spec)
+	}
+	if target == "" {
+		target = filepath.Base(source)
+	}
+
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attachment %q: %w", spec, err)
+	}
+	info, err := os.Stat(absSource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attachment %q: %w", spec, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("invalid attachment %q: %s is a directory", spec, source)
+	}
+	return &Attachment{Source: absSource, Target: target}, nil
+}
+
+func (a *Attachment) targetPath(workdir string) string {
+	if path.IsAbs(a.Target) {
+		return a.Target
+	}
+	return path.Join(workdir, a.Target)
+}
+
+// withAttachments stages the attachments into the container. Unless keep is set, they're mounted, so
+// the returned cleanup removes them from the container once the command ran and they never reach the
+// environment's state. Kept attachments are copied, like files written by the agent.
+func (env *Environment) withAttachments(container *dagger.Container, attachments []*Attachment, keep bool) (*dagger.Container, func(*dagger.Container) *dagger.Container) {
+	owner := env.State.Config.fileOwner()
+	var mounted []string
+	for _, attachment := range attachments {
+		source := env.dag.Host().File(attachment.Source)
+		target := attachment.targetPath(env.State.Config.Workdir)
+		if keep {
+			container = container.WithFile(target, source, dagger.ContainerWithFileOpts{Owner: owner})
+			continue
+		}
+		container = container.WithMountedFile(target, source, dagger.ContainerWithMountedFileOpts{Owner: owner})
+		mounted = append(mounted, target)
+	}
+
+	return container, func(container *dagger.Container) *dagger.Container {
+		for _, target := range mounted {
+			container = container.WithoutMount(target)
+		}
+		return container
+	}
+}
@@ -0,0 +1,36 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAttachment(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("fixture.json", []byte("{}"), 0644))
+	source := filepath.Join(dir, "fixture.json")
+
+	attachment, err := ParseAttachment("fixture.json:/tmp/fixture.json")
+	require.NoError(t, err)
+	assert.Equal(t, &Attachment{Source: source, Target: "/tmp/fixture.json"}, attachment)
+	assert.Equal(t, "/tmp/fixture.json", attachment.targetPath("/workdir"))
+
+	attachment, err = ParseAttachment("fixture.json")
+	require.NoError(t, err)
+	assert.Equal(t, &Attachment{Source: source, Target: "fixture.json"}, attachment)
+	assert.Equal(t, "/workdir/fixture.json", attachment.targetPath("/workdir"))
+
+	attachment, err = ParseAttachment(source + ":testdata/in.json")
+	require.NoError(t, err)
+	assert.Equal(t, "/workdir/testdata/in.json", attachment.targetPath("/workdir"))
+
+	_, err = ParseAttachment("missing.json:/tmp/missing.json")
+	assert.Error(t, err)
+	_, err = ParseAttachment(".:/tmp/dir")
+	assert.ErrorContains(t, err, "is a directory")
+}
@@ -0,0 +1,161 @@
+package environment
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// commandNotFoundExitCode is the exit code of shells failing to find a command.
+const commandNotFoundExitCode = 127
+
+// packageManagerScript prints the first package manager of the container that auto-install supports.
+const packageManagerScript = `for m in apt-get apk brew; do command -v "$m" >/dev/null 2>&1 && echo "$m" && exit 0; done; true`
+
+// commandNotFound matches the errors of shells for missing commands, e.g. "sh: 1: jq: not found" or
+// "bash: line 1: jq: command not found".
+var commandNotFound = regexp.MustCompile(`(?m)(?:^|: )([\w.+-]+): (?:command )?not found\s*$`)
+
+// packages provides a missing command, by package manager.
+type packages struct {
+	Apt, Apk, Brew string
+}
+
+// missingCommandPackages maps the commands auto-install knows to the packages providing them.
+// Commands missing from the map are never installed, so a typo doesn't install an unrelated package.
+var missingCommandPackages = map[string]packages{
+	"bc":         {"bc", "bc", "bc"},
+	"cargo":      {"cargo", "cargo", "rust"},
+	"convert":    {"imagemagick", "imagemagick", "imagemagick"},
+	"curl":       {"curl", "curl", "curl"},
+	"dig":        {"dnsutils", "bind-tools", "bind"},
+	"fd":         {"fd-find", "fd", "fd"},
+	"file":       {"file", "file", ""},
+	"g++":        {"g++", "g++", "gcc"},
+	"gcc":        {"gcc", "gcc", "gcc"},
+	"git":        {"git", "git", "git"},
+	"go":         {"golang-go", "go", "go"},
+	"gzip":       {"gzip", "gzip", "gzip"},
+	"htop":       {"htop", "htop", "htop"},
+	"ip":         {"iproute2", "iproute2", ""},
+	"jq":         {"jq", "jq", "jq"},
+	"less":       {"less", "less", "less"},
+	"lsof":       {"lsof", "lsof", "lsof"},
+	"make":       {"make", "make", "make"},
+	"mysql":      {"default-mysql-client", "mysql-client", "mysql-client"},
+	"nc":         {"netcat-openbsd", "netcat-openbsd", "netcat"},
+	"netstat":    {"net-tools", "net-tools", ""},
+	"node":       {"nodejs", "nodejs", "node"},
+	"npm":        {"npm", "npm", "node"},
+	"nslookup":   {"dnsutils", "bind-tools", "bind"},
+	"patch":      {"patch", "patch", "gpatch"},
+	"ping":       {"iputils-ping", "iputils", ""},
+	"pip":        {"python3-pip", "py3-pip", "python"},
+	"pip3":       {"python3-pip", "py3-pip", "python"},
+	"ps":         {"procps", "procps", ""},
+	"psql":       {"postgresql-client", "postgresql-client", "libpq"},
+	"python":     {"python-is-python3", "python3", "python"},
+	"python3":    {"python3", "python3", "python"},
+	"redis-cli":  {"redis-tools", "redis", "redis"},
+	"rg":         {"ripgrep", "ripgrep", "ripgrep"},
+	"rsync":      {"rsync", "rsync", "rsync"},
+	"rustc":      {"rustc", "rust", "rust"},
+	"shellcheck": {"shellcheck", "shellcheck", "shellcheck"},
+	"sqlite3":    {"sqlite3", "sqlite", "sqlite"},
+	"ssh":        {"openssh-client", "openssh-client", "openssh"},
+	"strace":     {"strace", "strace", ""},
+	"tree":       {"tree", "tree", "tree"},
+	"unzip":      {"unzip", "unzip", "unzip"},
+	"vim":        {"vim", "vim", "vim"},
+	"wget":       {"wget", "wget", "wget"},
+	"xxd":        {"xxd", "xxd", "vim"},
+	"xz":         {"xz-utils", "xz", "xz"},
+	"yq":         {"yq", "yq", "yq"},
+	"zip":        {"zip", "zip", "zip"},
+}
+
+// DetectMissingCommand returns the command a failed command couldn't find, if any.
+func DetectMissingCommand(exitCode int, stderr string) (string, bool) {
+	if exitCode != commandNotFoundExitCode {
+		return "", false
+	}
+	m := commandNotFound.FindStringSubmatch(stderr)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// InstallCommandFor returns the command installing the package providing a missing command with a
+// package manager (apt-get, apk or brew), if auto-install knows it.
+func InstallCommandFor(command, manager string) (string, bool) {
+	pkgs, ok := missingCommandPackages[command]
+	if !ok {
+		return "", false
+	}
+	switch {
+	case manager == "apt-get" && pkgs.Apt != "":
+		return "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y " + pkgs.Apt, true
+	case manager == "apk" && pkgs.Apk != "":
+		return "apk add --no-cache " + pkgs.Apk, true
+	case manager == "brew" && pkgs.Brew != "":
+		return "brew install " + pkgs.Brew, true
+	}
+	return "", false
+}
+
+// installMissingCommand installs the command a command failed to find on container, when auto-install
+// is enabled and the command is known, returning the container with the command installed. The install
+// is recorded like the agent's own commands, so `container-use promote` can add it to the configuration.
+func (env *Environment) installMissingCommand(ctx context.Context, container *dagger.Container, exitCode int, stderr string) (*dagger.Container, bool) {
+	if !env.State.Config.AutoInstall {
+		return nil, false
+	}
+	missing, found := DetectMissingCommand(exitCode, stderr)
+	if !found {
+		return nil, false
+	}
+	if env.State.Config.Hardened {
+		env.Notes.Add("Not installing the missing command %s: hardened environments can't install system packages. Add it as a setup command.", missing)
+		return nil, false
+	}
+
+	manager, err := container.WithExec([]string{"sh", "-c", packageManagerScript}).Stdout(ctx)
+	if err != nil {
+		slog.Warn("Failed to find a package manager", "environment-id", env.ID, "err", err)
+		return nil, false
+	}
+	install, ok := InstallCommandFor(missing, strings.TrimSpace(manager))
+	if !ok {
+		env.Notes.Add("Not installing the missing command %s: no known package provides it with this image's package manager.", missing)
+		return nil, false
+	}
+
+	slog.Info("Installing missing command", "environment-id", env.ID, "command", missing, "install", install)
+	startedAt := time.Now()
+	env.emit(EventExecStarted, map[string]any{"command": install})
+	installed := container.WithExec(env.State.Config.execArgs([]string{"sh", "-c", install}), dagger.ContainerWithExecOpts{
+		Expect:                        dagger.ReturnTypeAny,
+		ExperimentalPrivilegedNesting: env.State.Config.privilegedNesting(),
+	})
+	installExitCode, err := installed.ExitCode(ctx)
+	if err != nil {
+		env.emit(EventExecFinished, map[string]any{"command": install, "error": err.Error(), "duration_ms": time.Since(startedAt).Milliseconds()})
+		slog.Warn("Failed to install missing command", "environment-id", env.ID, "command", missing, "err", err)
+		return nil, false
+	}
+	env.emit(EventExecFinished, map[string]any{"command": install, "exit_code": installExitCode, "duration_ms": time.Since(startedAt).Milliseconds()})
+
+	installStdout, _ := installed.Stdout(ctx)
+	installStderr, _ := installed.Stderr(ctx)
+	env.Notes.AddCommand(install, installExitCode, installStdout, installStderr)
+	if installExitCode != 0 {
+		return nil, false
+	}
+	env.Notes.Add("Installed the missing command %s and ran the command again. Add the install to the configuration with 'container-use promote'.", missing)
+	return installed, true
+}
@@ -0,0 +1,55 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectMissingCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+		stderr   string
+		command  string
+		found    bool
+	}{
+		{"dash", 127, "sh: 1: jq: not found\n", "jq", true},
+		{"bash", 127, "bash: line 1: rg: command not found\n", "rg", true},
+		{"busybox", 127, "sh: redis-cli: not found\n", "redis-cli", true},
+		{"after output", 127, "building...\nsh: 1: g++: not found\n", "g++", true},
+		{"other exit code", 1, "sh: 1: jq: not found\n", "", false},
+		{"no message", 127, "", "", false},
+		{"file not found", 127, "cat: config.yaml: No such file or directory\n", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, found := DetectMissingCommand(tt.exitCode, tt.stderr)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.command, command)
+		})
+	}
+}
+
+func TestInstallCommandFor(t *testing.T) {
+	install, ok := InstallCommandFor("rg", "apt-get")
+	assert.True(t, ok)
+	assert.Equal(t, "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y ripgrep", install)
+
+	install, ok = InstallCommandFor("dig", "apk")
+	assert.True(t, ok)
+	assert.Equal(t, "apk add --no-cache bind-tools", install)
+
+	install, ok = InstallCommandFor("psql", "brew")
+	assert.True(t, ok)
+	assert.Equal(t, "brew install libpq", install)
+
+	_, ok = InstallCommandFor("jqq", "apt-get")
+	assert.False(t, ok, "unknown commands are never installed")
+
+	_, ok = InstallCommandFor("ping", "brew")
+	assert.False(t, ok, "commands without a package for the manager aren't installed")
+
+	_, ok = InstallCommandFor("jq", "dnf")
+	assert.False(t, ok)
+}
@@ -0,0 +1,150 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// BaseBuildConfig builds the base image of environments from a Containerfile of the repository,
+// instead of pulling BaseImage.
+type BaseBuildConfig struct {
+	// Containerfile is the path of the Containerfile (or Dockerfile), relative to the repository root.
+	Containerfile string `json:"containerfile"`
+	// Context is the build context, relative to the repository root (default: the repository root).
+	// It must contain the Containerfile.
+	Context string `json:"context,omitempty"`
+	// Target is the stage to build, for multi-stage Containerfiles (default: the last one).
+	Target string `json:"target,omitempty"`
+	// BuildArgs are the build arguments, as KEY=VALUE.
+	BuildArgs KVList `json:"build_args,omitempty"`
+}
+
+// Validate returns an error if the paths of the build aren't in the repository, or the Containerfile
+// isn't in the build context.
+func (b *BaseBuildConfig) Validate() error {
+	if b.Containerfile == "" {
+		return fmt.Errorf("the Containerfile of the base image build is required")
+	}
+	for _, p := range []string{b.Containerfile, b.Context} {
+		if path.IsAbs(p) || strings.HasPrefix(path.Clean(p), "..") {
+			return fmt.Errorf("invalid base image build path %q: it must be relative to the repository root", p)
+		}
+	}
+	if _, err := b.containerfileInContext(); err != nil {
+		return err
+	}
+	for _, arg := range b.BuildArgs {
+		if key, _, ok := strings.Cut(arg, "="); !ok || key == "" {
+			return fmt.Errorf("invalid build argument %q: expected KEY=VALUE", arg)
+		}
+	}
+	return nil
+}
+
+func (b *BaseBuildConfig) context() string {
+	if b.Context == "" {
+		return "."
+	}
+	return path.Clean(b.Context)
+}
+
+// containerfileInContext returns the path of the Containerfile relative to the build context.
+func (b *BaseBuildConfig) containerfileInContext() (string, error) {
+	rel := path.Clean(b.Containerfile)
+	if context := b.context(); context != "." {
+		if !strings.HasPrefix(rel, context+"/") {
+			return "", fmt.Errorf("the Containerfile %s must be in the build context %s", b.Containerfile, context)
+		}
+		rel = strings.TrimPrefix(rel, context+"/")
+	}
+	return rel, nil
+}
+
+func (b *BaseBuildConfig) String() string {
+	s := "build of " + b.Containerfile
+	var details []string
+	if b.Context != "" {
+		details = append(details, "context "+b.Context)
+	}
+	if b.Target != "" {
+		details = append(details, "target "+b.Target)
+	}
+	for _, key := range b.BuildArgs.Keys() {
+		details = append(details, key+"="+b.BuildArgs.Get(key))
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+// containerfileCandidates are the paths, relative to the repository root, where DetectContainerfile looks for a
+// Containerfile, in order.
+var containerfileCandidates = []string{
+	"Containerfile",
+	"Dockerfile",
+	".devcontainer/Containerfile",
+	".devcontainer/Dockerfile",
+}
+
+// DetectContainerfile returns the path of the Containerfile (or Dockerfile) of the repository at root, relative
+// to it: at its root, or else in .devcontainer.
+func DetectContainerfile(root string) (string, error) {
+	for _, candidate := range containerfileCandidates {
+		if info, err := os.Stat(filepath.Join(root, candidate)); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no Containerfile found: expected one of %s", strings.Join(containerfileCandidates, ", "))
+}
+
+// BaseImageDescription describes the base image of environments: the image, or the Containerfile build.
+func (config *EnvironmentConfig) BaseImageDescription() string {
+	if config.BaseBuild != nil {
+		return config.BaseBuild.String()
+	}
+	return config.BaseImage
+}
+
+// baseContainer returns the base image of the environment: the configured image, or the build of the
+// configured Containerfile from the repository files in source.
+func (env *Environment) baseContainer(source *dagger.Directory) (*dagger.Container, error) {
+	build := env.State.Config.BaseBuild
+	if build == nil {
+		return env.imageContainer(env.State.Config.BaseImage), nil
+	}
+
+	if err := build.Validate(); err != nil {
+		return nil, err
+	}
+	containerfile, _ := build.containerfileInContext()
+	buildArgs := make([]dagger.BuildArg, 0, len(build.BuildArgs))
+	for _, key := range build.BuildArgs.Keys() {
+		buildArgs = append(buildArgs, dagger.BuildArg{Name: key, Value: build.BuildArgs.Get(key)})
+	}
+	return source.Directory(build.context()).DockerBuild(dagger.DirectoryDockerBuildOpts{
+		Dockerfile: containerfile,
+		Target:     build.Target,
+		BuildArgs:  buildArgs,
+	}), nil
+}
+
+// baseCacheKey returns the key of the base image, which the keys of the setup steps are derived from:
+// the image's digest, or the digest of the build's context and options.
+func (env *Environment) baseCacheKey(ctx context.Context, container *dagger.Container, source *dagger.Directory) (string, error) {
+	build := env.State.Config.BaseBuild
+	if build == nil {
+		return container.ImageRef(ctx)
+	}
+	digest, err := source.Directory(build.context()).Digest(ctx)
+	if err != nil {
+		return "", err
+	}
+	return stepCacheKey(digest, build.String(), ""), nil
+}
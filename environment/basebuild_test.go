@@ -0,0 +1,63 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseBuildConfig(t *testing.T) {
+	build := &BaseBuildConfig{Containerfile: "docker/dev/Containerfile", Context: "docker", Target: "dev", BuildArgs: KVList{"GO_VERSION=1.24"}}
+	require.NoError(t, build.Validate())
+	containerfile, err := build.containerfileInContext()
+	require.NoError(t, err)
+	assert.Equal(t, "dev/Containerfile", containerfile)
+	assert.Equal(t, "build of docker/dev/Containerfile (context docker, target dev, GO_VERSION=1.24)", build.String())
+
+	build = &BaseBuildConfig{Containerfile: "Containerfile"}
+	require.NoError(t, build.Validate())
+	containerfile, err = build.containerfileInContext()
+	require.NoError(t, err)
+	assert.Equal(t, "Containerfile", containerfile)
+	assert.Equal(t, ".", build.context())
+
+	for _, invalid := range []*BaseBuildConfig{
+		{},
+		{Containerfile: "/etc/Containerfile"},
+		{Containerfile: "../Containerfile"},
+		{Containerfile: "Containerfile", Context: "docker"},
+		{Containerfile: "docker/Containerfile", Context: "docker", BuildArgs: KVList{"NOVALUE"}},
+	} {
+		assert.Error(t, invalid.Validate(), "%+v", invalid)
+	}
+}
+
+func TestBaseImageDescription(t *testing.T) {
+	config := DefaultConfig()
+	assert.Equal(t, defaultImage, config.BaseImageDescription())
+
+	config.BaseBuild = &BaseBuildConfig{Containerfile: "Containerfile"}
+	assert.Equal(t, "build of Containerfile", config.BaseImageDescription())
+	assert.NotSame(t, config.BaseBuild, config.Copy().BaseBuild)
+}
+
+func TestDetectContainerfile(t *testing.T) {
+	root := t.TempDir()
+	_, err := DetectContainerfile(root)
+	assert.ErrorContains(t, err, "no Containerfile found")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".devcontainer"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".devcontainer", "Dockerfile"), []byte("FROM golang"), 0644))
+	containerfile, err := DetectContainerfile(root)
+	require.NoError(t, err)
+	assert.Equal(t, ".devcontainer/Dockerfile", containerfile)
+
+	// The Containerfile at the root is preferred.
+	require.NoError(t, os.WriteFile(filepath.Join(root, "Dockerfile"), []byte("FROM golang"), 0644))
+	containerfile, err = DetectContainerfile(root)
+	require.NoError(t, err)
+	assert.Equal(t, "Dockerfile", containerfile)
+}
@@ -0,0 +1,80 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MaxCaptureSize caps the size of captured files, so they fit in a tool response.
+const MaxCaptureSize = 5 << 20
+
+// captureTypes are the MIME types of the files that can be captured, by extension.
+var captureTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+	".html": "text/html",
+	".htm":  "text/html",
+}
+
+// Capture is a file of an environment captured to show it to the user, such as a screenshot or a rendered page.
+type Capture struct {
+	// Path is the absolute path of the file in the environment.
+	Path     string
+	MIMEType string
+	Data     []byte
+}
+
+// IsText reports whether the captured file is a text document (HTML or SVG) rather than a raster image.
+func (capture *Capture) IsText() bool {
+	return strings.HasPrefix(capture.MIMEType, "text/") || capture.MIMEType == "image/svg+xml"
+}
+
+// CaptureMIMEType returns the MIME type of a file that can be captured, or "" if it can't.
+func CaptureMIMEType(path string) string {
+	return captureTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+// Capture reads an image or HTML file of the environment, e.g. a screenshot taken by a browser test.
+func (env *Environment) Capture(ctx context.Context, targetFile string) (*Capture, error) {
+	mimeType := CaptureMIMEType(targetFile)
+	if mimeType == "" {
+		return nil, fmt.Errorf("can't capture %s: only PNG, JPEG, GIF, WebP, SVG and HTML files can be captured", targetFile)
+	}
+
+	if !path.IsAbs(targetFile) {
+		targetFile = path.Join(env.State.Config.Workdir, targetFile)
+	}
+	file := env.container().File(targetFile)
+	size, err := file.Size(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxCaptureSize {
+		return nil, fmt.Errorf("can't capture %s: %d bytes is over the %d bytes limit", targetFile, size, MaxCaptureSize)
+	}
+
+	// Export rather than read the contents, which are returned as a string and can't hold binary data.
+	tmp, err := os.CreateTemp("", "container-use-capture-*"+filepath.Ext(targetFile))
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if _, err := file.Export(ctx, tmp.Name()); err != nil {
+		return nil, fmt.Errorf("failed to export %s: %w", targetFile, err)
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Capture{Path: targetFile, MIMEType: mimeType, Data: data}, nil
+}
@@ -0,0 +1,17 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureMIMEType(t *testing.T) {
+	assert.Equal(t, "image/png", CaptureMIMEType("screenshots/home.PNG"))
+	assert.Equal(t, "text/html", CaptureMIMEType("/workdir/dist/index.html"))
+	assert.Empty(t, CaptureMIMEType("main.go"))
+
+	assert.False(t, (&Capture{MIMEType: "image/jpeg"}).IsText())
+	assert.True(t, (&Capture{MIMEType: "image/svg+xml"}).IsText())
+	assert.True(t, (&Capture{MIMEType: "text/html"}).IsText())
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -24,13 +26,169 @@ func DefaultConfig() *EnvironmentConfig {
 }
 
 type EnvironmentConfig struct {
-	Workdir         string         `json:"workdir,omitempty"`
-	BaseImage       string         `json:"base_image,omitempty"`
-	SetupCommands   []string       `json:"setup_commands,omitempty"`
-	InstallCommands []string       `json:"install_commands,omitempty"`
-	Env             KVList         `json:"env,omitempty"`
-	Secrets         KVList         `json:"secrets,omitempty"`
-	Services        ServiceConfigs `json:"services,omitempty"`
+	Workdir         string               `json:"workdir,omitempty"`
+	BaseImage       string               `json:"base_image,omitempty"`
+	BaseBuild       *BaseBuildConfig     `json:"base_build,omitempty"`
+	SetupCommands   []string             `json:"setup_commands,omitempty"`
+	InstallCommands []string             `json:"install_commands,omitempty"`
+	CommandInputs   CommandInputs        `json:"command_inputs,omitempty"`
+	Env             KVList               `json:"env,omitempty"`
+	Secrets         KVList               `json:"secrets,omitempty"`
+	Services        ServiceConfigs       `json:"services,omitempty"`
+	Tasks           TaskConfigs          `json:"tasks,omitempty"`
+	Clone           *CloneConfig         `json:"clone,omitempty"`
+	DNSServers      []string             `json:"dns_servers,omitempty"`
+	DNSSearch       []string             `json:"dns_search,omitempty"`
+	Hosts           KVList               `json:"hosts,omitempty"`
+	Naming          *NamingConfig        `json:"naming,omitempty"`
+	Features        FeatureConfigs       `json:"features,omitempty"`
+	CommitMessage   *CommitMessageConfig `json:"commit_message,omitempty"`
+	GitIdentity     *GitIdentity         `json:"git_identity,omitempty"`
+	Docker          *DockerConfig        `json:"docker,omitempty"`
+	ChangeBudget    *ChangeBudgetConfig  `json:"change_budget,omitempty"`
+	ResourceGuard   *ResourceGuardConfig `json:"resource_guard,omitempty"`
+	Retry           *RetryConfig         `json:"retry,omitempty"`
+	Quota           *QuotaConfig         `json:"quota,omitempty"`
+	Resources       *ResourceLimits      `json:"resources,omitempty"`
+	CommandTimeout  *CommandTimeout      `json:"command_timeout,omitempty"`
+	HostFiles       HostFiles            `json:"host_files,omitempty"`
+	// Hardened runs the agent's commands unprivileged, for untrusted code: see withHardening.
+	Hardened bool `json:"hardened,omitempty"`
+	// AutoInstall installs the system package providing a command the agent's commands can't find,
+	// then runs them again: see installMissingCommand.
+	AutoInstall bool `json:"auto_install,omitempty"`
+	// DockerCredentials pulls the base image, the services and the images pulled with docker in the
+	// environment with the host's Docker credentials of their registries, from its credential helpers: see
+	// imageContainer. The repository only uses them once the user trusted them for these registries.
+	DockerCredentials bool `json:"docker_credentials,omitempty"`
+	// Suggester is a host command suggesting the title and labels of environments created without a title,
+	// e.g. a script calling a local model.
+	Suggester string `json:"suggester,omitempty"`
+	// SnapshotPaths are container paths outside the workdir, such as database data directories, whose
+	// changes are reported after each command since they don't show up in the environment's diff.
+	SnapshotPaths []string `json:"snapshot_paths,omitempty"`
+	// CoverageCommand runs after the tests of `container-use test` to report their coverage, e.g.
+	// "go tool cover -func=coverage.out", when the test output doesn't include it.
+	CoverageCommand string `json:"coverage_command,omitempty"`
+}
+
+// ChangeBudgetConfig caps how much an environment may change before a human reviews it.
+type ChangeBudgetConfig struct {
+	// MaxFiles is the number of changed files allowed (0 for no limit).
+	MaxFiles int `json:"max_files,omitempty"`
+	// MaxLines is the number of changed lines (insertions plus deletions) allowed (0 for no limit).
+	MaxLines int `json:"max_lines,omitempty"`
+	// Block refuses commands in environments over budget until the changes are acknowledged.
+	Block bool `json:"block,omitempty"`
+}
+
+// ResourceGuardConfig sets the host resources that must be left before creating environments and running
+// commands, so the Dagger engine doesn't fill the disk and corrupt ongoing builds.
+type ResourceGuardConfig struct {
+	// MinFreeDisk is the free disk space required, in bytes (0 disables the check).
+	MinFreeDisk uint64 `json:"min_free_disk,omitempty"`
+	// MinFreeMemory is the available memory required, in bytes (0 disables the check).
+	MinFreeMemory uint64 `json:"min_free_memory,omitempty"`
+	// Paths are directories whose disk is checked besides container-use's own, such as the engine's
+	// data directory when it isn't in a default location.
+	Paths []string `json:"paths,omitempty"`
+	// WarnOnly warns instead of refusing.
+	WarnOnly bool `json:"warn_only,omitempty"`
+}
+
+// DefaultResourceGuard returns the thresholds applying when the repository doesn't configure any.
+func DefaultResourceGuard() *ResourceGuardConfig {
+	return &ResourceGuardConfig{
+		MinFreeDisk:   2 * 1000 * 1000 * 1000,
+		MinFreeMemory: 256 * 1000 * 1000,
+	}
+}
+
+// GitIdentity is the author and committer of the commits recording environment changes,
+// so they can be told apart from the user's own commits.
+type GitIdentity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ParseGitIdentity parses an identity in the "Name <email>" form used by git.
+func ParseGitIdentity(s string) (*GitIdentity, error) {
+	name, rest, ok := strings.Cut(s, "<")
+	email, trailing, closed := strings.Cut(rest, ">")
+	name, email = strings.TrimSpace(name), strings.TrimSpace(email)
+	if !ok || !closed || strings.TrimSpace(trailing) != "" || name == "" || email == "" {
+		return nil, fmt.Errorf("invalid git identity %q: expected \"Name <email>\"", s)
+	}
+	return &GitIdentity{Name: name, Email: email}, nil
+}
+
+func (identity *GitIdentity) String() string {
+	return fmt.Sprintf("%s <%s>", identity.Name, identity.Email)
+}
+
+// Env returns the environment variables making git use the identity for both author and committer.
+func (identity *GitIdentity) Env() []string {
+	return []string{
+		"GIT_AUTHOR_NAME=" + identity.Name,
+		"GIT_AUTHOR_EMAIL=" + identity.Email,
+		"GIT_COMMITTER_NAME=" + identity.Name,
+		"GIT_COMMITTER_EMAIL=" + identity.Email,
+	}
+}
+
+// Commit message styles.
+const (
+	CommitMessageDetailed    = "detailed"
+	CommitMessageSubject     = "subject"
+	CommitMessageExplanation = "explanation"
+)
+
+// CommitMessageConfig controls the messages of commits recording environment changes.
+type CommitMessageConfig struct {
+	// Style is one of detailed (default: a subject plus the commands run and files changed),
+	// subject (the subject line only) or explanation (the agent's explanation only).
+	Style string `json:"style,omitempty"`
+	// MaxFiles caps the number of files listed in detailed messages (default 20).
+	MaxFiles int `json:"max_files,omitempty"`
+	// Hook is a host command generating the message, e.g. a script calling an LLM.
+	// It receives the staged diff on stdin; its output replaces the generated message.
+	Hook string `json:"hook,omitempty"`
+}
+
+// Environment ID naming styles.
+const (
+	NamingStylePetname    = "petname"
+	NamingStyleWords      = "words"
+	NamingStyleSequential = "sequential"
+)
+
+// NamingConfig controls how new environment IDs are generated.
+type NamingConfig struct {
+	// Prefix is prepended to every generated ID, e.g. "team-a-".
+	Prefix string `json:"prefix,omitempty"`
+	// Style is one of petname (default), words or sequential.
+	Style string `json:"style,omitempty"`
+	// Words is the word list used by the words style.
+	Words []string `json:"words,omitempty"`
+	// Length is the number of words in petname and words IDs (default 2).
+	Length int `json:"length,omitempty"`
+	// Template, if set, overrides Style. It may reference {name} (a name generated with Style),
+	// {seq} (a zero-padded sequence number), {date} (YYYYMMDD) and {rand} (random hex).
+	Template string `json:"template,omitempty"`
+}
+
+// CloneConfig limits how much git history is provisioned for new environments.
+// Useful for very large repositories where copying the full history is slow.
+type CloneConfig struct {
+	// Depth truncates history to the given number of commits (0 means full history).
+	Depth int `json:"depth,omitempty"`
+	// Filter is a partial clone filter, such as "blob:none".
+	Filter string `json:"filter,omitempty"`
+}
+
+// IsPartial returns true if environments should be provisioned with limited history.
+func (c *CloneConfig) IsPartial() bool {
+	return c != nil && (c.Depth > 0 || c.Filter != "")
 }
 
 type ServiceConfig struct {
@@ -39,6 +197,19 @@ type ServiceConfig struct {
 	Command      string   `json:"command,omitempty"`
 	ExposedPorts []int    `json:"exposed_ports,omitempty"`
 	Env          []string `json:"env,omitempty"`
+	// Healthcheck tells when the service is ready for the environment's commands, if set.
+	Healthcheck *ServiceHealthcheck `json:"healthcheck,omitempty"`
+}
+
+func (cfg *ServiceConfig) clone() *ServiceConfig {
+	clone := *cfg
+	clone.ExposedPorts = slices.Clone(cfg.ExposedPorts)
+	clone.Env = slices.Clone(cfg.Env)
+	if cfg.Healthcheck != nil {
+		healthcheck := *cfg.Healthcheck
+		clone.Healthcheck = &healthcheck
+	}
+	return &clone
 }
 
 type ServiceConfigs []*ServiceConfig
@@ -114,12 +285,105 @@ func (config *EnvironmentConfig) Copy() *EnvironmentConfig {
 	copy := *config
 	copy.Services = make(ServiceConfigs, len(config.Services))
 	for i, svc := range config.Services {
-		svcCopy := *svc
-		copy.Services[i] = &svcCopy
+		copy.Services[i] = svc.clone()
+	}
+	if config.Tasks != nil {
+		copy.Tasks = make(TaskConfigs, len(config.Tasks))
+		for i, task := range config.Tasks {
+			taskCopy := *task
+			taskCopy.DependsOn = slices.Clone(task.DependsOn)
+			taskCopy.Services = make(ServiceConfigs, len(task.Services))
+			for j, svc := range task.Services {
+				taskCopy.Services[j] = svc.clone()
+			}
+			copy.Tasks[i] = &taskCopy
+		}
+	}
+	copy.Features = make(FeatureConfigs, len(config.Features))
+	for i, feature := range config.Features {
+		featureCopy := *feature
+		featureCopy.Options = maps.Clone(feature.Options)
+		copy.Features[i] = &featureCopy
+	}
+	if config.Clone != nil {
+		cloneCopy := *config.Clone
+		copy.Clone = &cloneCopy
+	}
+	if config.CommitMessage != nil {
+		commitMessageCopy := *config.CommitMessage
+		copy.CommitMessage = &commitMessageCopy
+	}
+	if config.GitIdentity != nil {
+		gitIdentityCopy := *config.GitIdentity
+		copy.GitIdentity = &gitIdentityCopy
+	}
+	if config.Docker != nil {
+		dockerCopy := *config.Docker
+		copy.Docker = &dockerCopy
+	}
+	if config.ChangeBudget != nil {
+		changeBudgetCopy := *config.ChangeBudget
+		copy.ChangeBudget = &changeBudgetCopy
+	}
+	if config.ResourceGuard != nil {
+		resourceGuardCopy := *config.ResourceGuard
+		resourceGuardCopy.Paths = slices.Clone(config.ResourceGuard.Paths)
+		copy.ResourceGuard = &resourceGuardCopy
+	}
+	if config.Retry != nil {
+		retryCopy := *config.Retry
+		copy.Retry = &retryCopy
+	}
+	if config.CommandTimeout != nil {
+		commandTimeoutCopy := *config.CommandTimeout
+		copy.CommandTimeout = &commandTimeoutCopy
+	}
+	if config.Quota != nil {
+		quotaCopy := *config.Quota
+		quotaCopy.Labels = maps.Clone(config.Quota.Labels)
+		quotaCopy.Agents = maps.Clone(config.Quota.Agents)
+		copy.Quota = &quotaCopy
+	}
+	if config.Resources != nil {
+		resourcesCopy := *config.Resources
+		copy.Resources = &resourcesCopy
+	}
+	if config.BaseBuild != nil {
+		baseBuildCopy := *config.BaseBuild
+		baseBuildCopy.BuildArgs = slices.Clone(config.BaseBuild.BuildArgs)
+		copy.BaseBuild = &baseBuildCopy
+	}
+	if config.Naming != nil {
+		namingCopy := *config.Naming
+		copy.Naming = &namingCopy
+	}
+	if config.CommandInputs != nil {
+		copy.CommandInputs = make(CommandInputs, len(config.CommandInputs))
+		for command, inputs := range config.CommandInputs {
+			copy.CommandInputs[command] = slices.Clone(inputs)
+		}
+	}
+	if config.HostFiles != nil {
+		copy.HostFiles = make(HostFiles, len(config.HostFiles))
+		for i, file := range config.HostFiles {
+			fileCopy := *file
+			fileCopy.Redact = slices.Clone(file.Redact)
+			copy.HostFiles[i] = &fileCopy
+		}
 	}
 	return &copy
 }
 
+// ConfigDir returns the directory holding the configuration of the repository at baseDir.
+func ConfigDir(baseDir string) string {
+	return filepath.Join(baseDir, configDir)
+}
+
+// ConfigFile returns the configuration file of the repository at baseDir.
+func ConfigFile(baseDir string) string {
+	return filepath.Join(baseDir, configDir, environmentFile)
+}
+
 func (config *EnvironmentConfig) Save(baseDir string) error {
 	configPath := filepath.Join(baseDir, configDir)
 	if err := os.MkdirAll(configPath, 0755); err != nil {
@@ -136,7 +400,17 @@ func (config *EnvironmentConfig) Save(baseDir string) error {
 		return err
 	}
 
-	if err := os.WriteFile(filepath.Join(configPath, environmentFile), buf.Bytes(), 0600); err != nil {
+	// Only settings overriding the upstream configuration belong to the repository.
+	upstream, err := LoadUpstreamSettings(baseDir)
+	if err != nil {
+		return err
+	}
+	data, err := withoutUpstreamSettings(buf.Bytes(), upstream)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(configPath, environmentFile), data, 0600); err != nil {
 		return err
 	}
 
@@ -146,6 +420,17 @@ func (config *EnvironmentConfig) Save(baseDir string) error {
 func (config *EnvironmentConfig) Load(baseDir string) error {
 	configPath := filepath.Join(baseDir, configDir)
 
+	// The repository's settings are layered on the synced upstream configuration, if any.
+	upstream, err := LoadUpstreamSettings(baseDir)
+	if err != nil {
+		return err
+	}
+	if upstream != nil {
+		if err := json.Unmarshal(upstream, config); err != nil {
+			return fmt.Errorf("invalid upstream configuration: %w", err)
+		}
+	}
+
 	data, err := os.ReadFile(filepath.Join(configPath, environmentFile))
 	if err != nil && !os.IsNotExist(err) {
 		return err
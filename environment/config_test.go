@@ -1,11 +1,15 @@
 package environment
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -171,3 +175,189 @@ func createConfigFile(t *testing.T, dir string, config *EnvironmentConfig) {
 	require.NoError(t, err)
 	require.NoError(t, os.WriteFile(filepath.Join(configDir, "environment.json"), data, 0644))
 }
+
+func TestEnvironmentConfig_NetworkOverrides(t *testing.T) {
+	t.Run("no_overrides", func(t *testing.T) {
+		config := DefaultConfig()
+		args := []string{"sh", "-c", "echo hi"}
+		assert.Equal(t, args, config.withNetworkOverrides(args))
+	})
+
+	t.Run("dns_and_hosts", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DNSServers = []string{"10.0.0.53"}
+		config.DNSSearch = []string{"corp.example.com"}
+		config.Hosts.Set("db.internal", "10.1.2.3")
+		require.NoError(t, config.ValidateNetwork())
+
+		args := config.withNetworkOverrides([]string{"bash", "-c", "echo hi"})
+		require.Len(t, args, 10)
+		assert.Equal(t, []string{"sh", "-c", networkScript}, args[:3])
+		// The values are arguments of the script, never part of it.
+		assert.Equal(t, []string{"corp.example.com", "nameserver 10.0.0.53", "10.1.2.3 db.internal"}, args[4:7])
+		assert.Equal(t, []string{"bash", "-c", "echo hi"}, args[7:])
+	})
+
+	t.Run("script", func(t *testing.T) {
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh isn't available")
+		}
+		config := DefaultConfig()
+		config.DNSSearch = []string{"corp.example.com"}
+		config.Hosts.Set("db.internal", "10.1.2.3")
+
+		// Run the script on copies of the files, with the values the runtime would write.
+		dir := t.TempDir()
+		script := strings.NewReplacer("/etc/", dir+"/").Replace(networkScript)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "resolv.conf"), []byte("nameserver 192.168.0.1\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "hosts"), []byte("127.0.0.1 localhost\n"), 0o644))
+		args := config.withNetworkOverrides([]string{"echo", "$(reboot)"})
+		args[2] = script
+		output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		require.NoError(t, err, string(output))
+		assert.Equal(t, "$(reboot)\n", string(output))
+
+		resolv, err := os.ReadFile(filepath.Join(dir, "resolv.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "search corp.example.com\nnameserver 192.168.0.1\n", string(resolv))
+		hosts, err := os.ReadFile(filepath.Join(dir, "hosts"))
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1 localhost\n10.1.2.3 db.internal\n", string(hosts))
+	})
+
+	t.Run("invalid_values", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DNSServers = []string{"not-an-ip"}
+		assert.Error(t, config.ValidateNetwork())
+
+		config = DefaultConfig()
+		config.DNSSearch = []string{"$(reboot)"}
+		assert.Error(t, config.ValidateNetwork())
+
+		config = DefaultConfig()
+		config.Hosts.Set("db.internal", "nowhere")
+		assert.Error(t, config.ValidateNetwork())
+
+		// A state edited by hand isn't loaded.
+		config = DefaultConfig()
+		config.DNSServers = []string{`1.1.1.1" && reboot; "`}
+		state, err := (&State{Config: config}).Marshal()
+		require.NoError(t, err)
+		_, err = Load(context.Background(), nil, "test-env", state, t.TempDir())
+		assert.ErrorContains(t, err, "invalid DNS server")
+	})
+}
+
+func TestEnvironmentConfig_FeatureInstallEnv(t *testing.T) {
+	manifest := &featureManifest{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "node",
+		"options": {
+			"version": {"type": "string", "default": "lts"},
+			"installYarn": {"type": "boolean", "default": true},
+			"nvm-dir": {"type": "string"}
+		}
+	}`), manifest))
+
+	vars := featureInstallEnv(manifest, map[string]string{"version": "20"})
+	assert.Equal(t, "20", vars["VERSION"])
+	assert.Equal(t, "true", vars["INSTALLYARN"])
+	assert.NotContains(t, vars, "NVM_DIR")
+	assert.Equal(t, "root", vars["_REMOTE_USER"])
+
+	assert.Equal(t, "NVM_DIR", featureOptionEnv("nvm-dir"))
+	assert.Equal(t, "_VERSION", featureOptionEnv("1version"))
+
+	config := DefaultConfig()
+	config.Features = FeatureConfigs{{Ref: "ghcr.io/devcontainers/features/node:1", Options: map[string]string{"version": "20"}}}
+	copied := config.Copy()
+	copied.Features[0].Options["version"] = "22"
+	assert.Equal(t, "20", config.Features.Get("ghcr.io/devcontainers/features/node:1").Options["version"])
+}
+
+func TestParseGitIdentity(t *testing.T) {
+	identity, err := ParseGitIdentity("agent[bot] <agent@users.noreply.github.com>")
+	require.NoError(t, err)
+	assert.Equal(t, &GitIdentity{Name: "agent[bot]", Email: "agent@users.noreply.github.com"}, identity)
+	assert.Equal(t, "agent[bot] <agent@users.noreply.github.com>", identity.String())
+
+	for _, invalid := range []string{"agent", "<agent@example.com>", "agent <>", "agent <a@example.com> extra", "agent a@example.com>"} {
+		_, err := ParseGitIdentity(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDockerConfig(t *testing.T) {
+	docker := &DockerConfig{}
+	require.NoError(t, docker.Validate())
+	assert.Equal(t, "dind (docker:28-dind)", docker.String())
+
+	docker = &DockerConfig{Mode: DockerModeHostSocket}
+	require.NoError(t, docker.Validate())
+	assert.Equal(t, "host-socket (/var/run/docker.sock)", docker.String())
+
+	assert.Error(t, (&DockerConfig{Mode: "podman"}).Validate())
+
+	config := DefaultConfig()
+	config.Docker = &DockerConfig{Image: "docker:27-dind"}
+	copied := config.Copy()
+	copied.Docker.Image = "docker:28-dind"
+	assert.Equal(t, "docker:27-dind", config.Docker.Image, "Copy doesn't share the docker configuration")
+}
+
+func TestHostFile(t *testing.T) {
+	netrc := &HostFile{Source: "~/.netrc", Redact: []string{`password (\S+)`, `secret-token`}}
+	require.NoError(t, netrc.Validate())
+	assert.Equal(t, "/root/.netrc", netrc.TargetPath())
+
+	content, err := netrc.RedactContent("machine github.com login me password hunter2\nmachine example.com login me password secret-token\n")
+	require.NoError(t, err)
+	assert.Equal(t, "machine github.com login me password REDACTED\nmachine example.com login me password REDACTED\n", content)
+
+	kubeconfig := &HostFile{Source: "~/.kube/config", Target: "/home/dev/.kube/config", Mode: HostFileSecret, Prompt: true}
+	require.NoError(t, kubeconfig.Validate())
+	assert.Equal(t, "/home/dev/.kube/config", kubeconfig.TargetPath())
+
+	assert.Error(t, (&HostFile{Source: "~/.kube/config", Mode: HostFileSecret, Redact: []string{"token"}}).Validate())
+	assert.Error(t, (&HostFile{Source: "~/.npmrc", Mode: "link"}).Validate())
+	assert.Error(t, (&HostFile{Source: "~/.npmrc", Redact: []string{"("}}).Validate())
+	assert.Error(t, (&HostFile{Source: "relative/file"}).Validate())
+
+	// Prompting files are kept only if they were confirmed.
+	files := HostFiles{netrc, kubeconfig}
+	assert.Equal(t, HostFiles{netrc}, files.Confirmed(nil))
+	assert.Equal(t, files, files.Confirmed(HostFiles{kubeconfig}))
+}
+
+func TestServiceConfigs_Validate(t *testing.T) {
+	db := &ServiceConfig{
+		Name:         "db",
+		Image:        "postgres:16",
+		ExposedPorts: []int{5432},
+		Env:          []string{"POSTGRES_PASSWORD=postgres"},
+		Healthcheck:  &ServiceHealthcheck{Command: "pg_isready -h db"},
+	}
+	require.NoError(t, ServiceConfigs{db}.Validate())
+	assert.Equal(t, time.Second, db.Healthcheck.Interval())
+	assert.Equal(t, 30, db.Healthcheck.Attempts())
+
+	copied := db.clone()
+	copied.Healthcheck.Retries = 5
+	copied.ExposedPorts[0] = 5433
+	assert.Zero(t, db.Healthcheck.Retries, "clones don't share their healthcheck")
+	assert.Equal(t, []int{5432}, db.ExposedPorts)
+
+	for _, tc := range []struct {
+		service *ServiceConfig
+		err     string
+	}{
+		{&ServiceConfig{Name: "my.db", Image: "postgres"}, "invalid service name"},
+		{&ServiceConfig{Name: "db"}, "has no image"},
+		{&ServiceConfig{Name: "db", Image: "postgres", ExposedPorts: []int{70000}}, "invalid port"},
+		{&ServiceConfig{Name: "db", Image: "postgres", Env: []string{"PASSWORD"}}, "expected KEY=VALUE"},
+		{&ServiceConfig{Name: "db", Image: "postgres", Healthcheck: &ServiceHealthcheck{}}, "has no command"},
+	} {
+		assert.ErrorContains(t, tc.service.Validate(), tc.err)
+	}
+	assert.ErrorContains(t, ServiceConfigs{db, db}.Validate(), "defined more than once")
+}
@@ -0,0 +1,121 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"dagger.io/dagger"
+)
+
+// containerPath returns a path of the container given relative to the workdir, unless absolute.
+func (env *Environment) containerPath(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(env.State.Config.Workdir, p)
+}
+
+// CopyFromHost copies a file or directory of the host into the container at target, relative to the
+// workdir unless absolute. Like cp, a directory at target receives the copy under the source's base name.
+// It returns the path of the copy in the container.
+func (env *Environment) CopyFromHost(ctx context.Context, source, target string) (string, error) {
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", err
+	}
+
+	container := env.container()
+	target = env.containerPath(target)
+	isDir, err := container.Exists(ctx, target, dagger.ContainerExistsOpts{ExpectedType: dagger.ExistsTypeDirectoryType})
+	if err != nil {
+		return "", fmt.Errorf("failed to check %s: %w", target, err)
+	}
+	if isDir {
+		target = path.Join(target, filepath.Base(source))
+	}
+	if err := env.validateNotSubmoduleFile(target); err != nil {
+		return "", err
+	}
+
+	owner := env.State.Config.fileOwner()
+	if info.IsDir() {
+		container = container.WithDirectory(target, env.dag.Host().Directory(source), dagger.ContainerWithDirectoryOpts{Owner: owner})
+	} else {
+		container = container.WithFile(target, env.dag.Host().File(source), dagger.ContainerWithFileOpts{Owner: owner})
+	}
+	if err := env.apply(ctx, container); err != nil {
+		return "", fmt.Errorf("failed applying copy, skipping git propagation: %w", err)
+	}
+	env.Notes.Add("Copy %s from the host to %s", filepath.Base(source), target)
+	return target, nil
+}
+
+// CopyToHost copies a file or directory of the container, relative to the workdir unless absolute, to
+// target on the host. Like cp, a directory at target receives the copy under the source's base name. It
+// returns the path of the copy on the host.
+func (env *Environment) CopyToHost(ctx context.Context, source, target string) (string, error) {
+	container := env.container()
+	source = env.containerPath(source)
+	exists, err := container.Exists(ctx, source)
+	if err != nil {
+		return "", fmt.Errorf("failed to check %s: %w", source, err)
+	}
+	if !exists {
+		return "", fmt.Errorf("%s: no such file or directory", source)
+	}
+	isDir, err := container.Exists(ctx, source, dagger.ContainerExistsOpts{ExpectedType: dagger.ExistsTypeDirectoryType})
+	if err != nil {
+		return "", fmt.Errorf("failed to check %s: %w", source, err)
+	}
+
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		target = filepath.Join(target, path.Base(source))
+	}
+
+	if isDir {
+		_, err = container.Directory(source).Export(ctx, target)
+	} else {
+		_, err = container.File(source).Export(ctx, target)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to export %s: %w", source, err)
+	}
+	return target, nil
+}
+
+// SyncFromHost mirrors files of the host directory root into the workdir: the files at changed, relative to
+// root, are copied to the same paths of the workdir, and those at removed are deleted from it.
+func (env *Environment) SyncFromHost(ctx context.Context, root string, changed, removed []string) error {
+	container := env.container()
+	owner := env.State.Config.fileOwner()
+	for _, p := range changed {
+		target := env.containerPath(filepath.ToSlash(p))
+		if err := env.validateNotSubmoduleFile(target); err != nil {
+			return err
+		}
+		container = container.WithFile(target, env.dag.Host().File(filepath.Join(root, p)), dagger.ContainerWithFileOpts{Owner: owner})
+	}
+	if len(removed) > 0 {
+		targets := make([]string, 0, len(removed))
+		for _, p := range removed {
+			targets = append(targets, env.containerPath(filepath.ToSlash(p)))
+		}
+		container = container.WithoutFiles(targets)
+	}
+	if err := env.apply(ctx, container); err != nil {
+		return fmt.Errorf("failed applying sync, skipping git propagation: %w", err)
+	}
+	env.Notes.Add("Sync %d changed and %d removed file(s) from the host", len(changed), len(removed))
+	return nil
+}
@@ -0,0 +1,103 @@
+package environment
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// dependenciesDir is where dependencies are copied in the container unless they have a target.
+const dependenciesDir = "/deps"
+
+// Dependency is an output of another environment an environment consumes, such as the binary a build
+// environment produces for an end-to-end test environment. It's copied into the container when the
+// environment is created, and again when it's refreshed.
+type Dependency struct {
+	// Environment is the ID of the environment producing the output.
+	Environment string `json:"environment"`
+	// Path is the file or directory of the environment's container to copy, relative to its workdir
+	// unless absolute. When empty, the files of the environment's branch tip are copied.
+	Path string `json:"path,omitempty"`
+	// Target is where the output is copied in the container, relative to its workdir unless absolute.
+	Target string `json:"target"`
+	// Revision is the tip of the environment's branch when the output was last copied, and SourceUpdatedAt
+	// the last change of its container.
+	Revision        string    `json:"revision,omitempty"`
+	SourceUpdatedAt time.Time `json:"source_updated_at,omitzero"`
+	RefreshedAt     time.Time `json:"refreshed_at,omitzero"`
+}
+
+// ParseDependency parses a dependency given as <env>[:<path>][=<target>]: the file or directory path of the
+// environment env, or its branch tip without a path, copied to target, by default under /deps/<env>.
+func ParseDependency(spec string) (*Dependency, error) {
+	source, target, _ := strings.Cut(spec, "=")
+	envID, sourcePath, _ := strings.Cut(source, ":")
+	if envID == "" || strings.ContainsAny(envID, `/\ `) {
+		return nil, fmt.Errorf("invalid dependency %q: expected <env>[:<path>][=<target>]", spec)
+	}
+	dep := &Dependency{Environment: envID, Path: sourcePath, Target: target}
+	if dep.Target == "" {
+		dep.Target = path.Join(dependenciesDir, envID)
+		if sourcePath != "" {
+			dep.Target = path.Join(dep.Target, path.Base(sourcePath))
+		}
+	}
+	return dep, nil
+}
+
+func (dep *Dependency) String() string {
+	source := dep.Environment
+	if dep.Path != "" {
+		source += ":" + dep.Path
+	}
+	return source + "=" + dep.Target
+}
+
+// DependencyOutput is the current output of a dependency, a file or a directory.
+type DependencyOutput struct {
+	Dependency      *Dependency
+	File            *dagger.File
+	Directory       *dagger.Directory
+	Revision        string
+	SourceUpdatedAt time.Time
+}
+
+// WireDependencies copies the outputs of dependencies into the container, replacing their previous
+// copies, and records the revisions copied.
+func (env *Environment) WireDependencies(ctx context.Context, outputs []*DependencyOutput) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	container := env.container()
+	owner := env.State.Config.fileOwner()
+	for _, output := range outputs {
+		target := env.containerPath(output.Dependency.Target)
+		if err := env.validateNotSubmoduleFile(target); err != nil {
+			return err
+		}
+		if output.Directory != nil {
+			container = container.
+				WithoutDirectory(target).
+				WithDirectory(target, output.Directory, dagger.ContainerWithDirectoryOpts{Owner: owner})
+		} else {
+			container = container.WithFile(target, output.File, dagger.ContainerWithFileOpts{Owner: owner})
+		}
+	}
+	if err := env.apply(ctx, container); err != nil {
+		return fmt.Errorf("failed applying dependencies, skipping git propagation: %w", err)
+	}
+
+	now := time.Now()
+	for _, output := range outputs {
+		output.Dependency.Revision = output.Revision
+		output.Dependency.SourceUpdatedAt = output.SourceUpdatedAt
+		output.Dependency.RefreshedAt = now
+		env.Notes.Add("Copy %s from environment %s to %s", cmp.Or(output.Dependency.Path, "its branch tip"), output.Dependency.Environment, output.Dependency.Target)
+	}
+	return nil
+}
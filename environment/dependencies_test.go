@@ -0,0 +1,43 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDependency(t *testing.T) {
+	tests := []struct {
+		spec string
+		want *Dependency
+	}{
+		{"build", &Dependency{Environment: "build", Target: "/deps/build"}},
+		{"build:bin/server", &Dependency{Environment: "build", Path: "bin/server", Target: "/deps/build/server"}},
+		{"build:/out/dist/", &Dependency{Environment: "build", Path: "/out/dist/", Target: "/deps/build/dist"}},
+		{"build:bin/server=/usr/local/bin/server", &Dependency{Environment: "build", Path: "bin/server", Target: "/usr/local/bin/server"}},
+		{"schema=api/schema", &Dependency{Environment: "schema", Target: "api/schema"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			dep, err := ParseDependency(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, dep)
+		})
+	}
+
+	for _, spec := range []string{"", ":bin/server", "=/deps/x", "../build:bin"} {
+		_, err := ParseDependency(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestDependencyString(t *testing.T) {
+	dep, err := ParseDependency("build:bin/server")
+	require.NoError(t, err)
+	assert.Equal(t, "build:bin/server=/deps/build/server", dep.String())
+
+	dep, err = ParseDependency("build")
+	require.NoError(t, err)
+	assert.Equal(t, "build=/deps/build", dep.String())
+}
@@ -0,0 +1,118 @@
+package environment
+
+import (
+	"fmt"
+
+	"dagger.io/dagger"
+)
+
+// Docker modes.
+const (
+	// DockerModeDind runs a dedicated Docker daemon for the environment.
+	DockerModeDind = "dind"
+	// DockerModeHostSocket gives the environment the host's Docker socket.
+	// Containers started from the environment then run on the host, so it can only be enabled from the host.
+	DockerModeHostSocket = "host-socket"
+)
+
+const (
+	defaultDockerImage  = "docker:28-dind"
+	defaultDockerSocket = "/var/run/docker.sock"
+	dockerHostname      = "docker"
+	dockerPort          = 2375
+)
+
+// DockerConfig enables running docker and docker compose inside an environment,
+// e.g. for test suites using testcontainers.
+type DockerConfig struct {
+	// Mode is dind (default) or host-socket.
+	Mode string `json:"mode,omitempty"`
+	// Image is the Docker image providing the daemon and the CLI (default docker:28-dind).
+	Image string `json:"image,omitempty"`
+	// Socket is the path of the host's Docker socket in host-socket mode (default /var/run/docker.sock).
+	Socket string `json:"socket,omitempty"`
+}
+
+func (docker *DockerConfig) mode() string {
+	if docker.Mode == "" {
+		return DockerModeDind
+	}
+	return docker.Mode
+}
+
+func (docker *DockerConfig) image() string {
+	if docker.Image == "" {
+		return defaultDockerImage
+	}
+	return docker.Image
+}
+
+func (docker *DockerConfig) socket() string {
+	if docker.Socket == "" {
+		return defaultDockerSocket
+	}
+	return docker.Socket
+}
+
+// Validate checks the Docker configuration.
+func (docker *DockerConfig) Validate() error {
+	switch docker.mode() {
+	case DockerModeDind, DockerModeHostSocket:
+		return nil
+	default:
+		return fmt.Errorf("unknown docker mode %q: must be %s or %s", docker.Mode, DockerModeDind, DockerModeHostSocket)
+	}
+}
+
+func (docker *DockerConfig) String() string {
+	switch docker.mode() {
+	case DockerModeHostSocket:
+		return fmt.Sprintf("%s (%s)", DockerModeHostSocket, docker.socket())
+	default:
+		return fmt.Sprintf("%s (%s)", DockerModeDind, docker.image())
+	}
+}
+
+// withDocker installs the docker CLI and compose plugin in the container and connects them to a Docker daemon.
+func (env *Environment) withDocker(container *dagger.Container) (*dagger.Container, error) {
+	docker := env.State.Config.Docker
+	if err := docker.Validate(); err != nil {
+		return nil, err
+	}
+
+	image := env.imageContainer(docker.image())
+	container = container.
+		WithFile("/usr/local/bin/docker", image.File("/usr/local/bin/docker")).
+		WithDirectory("/usr/local/libexec/docker/cli-plugins", image.Directory("/usr/local/libexec/docker/cli-plugins"))
+	if env.State.Config.DockerCredentials {
+		var err error
+		if container, err = env.withDockerCredentials(container); err != nil {
+			return nil, err
+		}
+	}
+
+	if docker.mode() == DockerModeHostSocket {
+		return container.
+			WithUnixSocket("/var/run/docker.sock", env.dag.Host().UnixSocket(docker.socket())).
+			WithEnvVariable("DOCKER_HOST", "unix:///var/run/docker.sock"), nil
+	}
+
+	daemon := image.
+		WithEnvVariable("DOCKER_TLS_CERTDIR", "").
+		WithMountedCache("/var/lib/docker", env.dag.CacheVolume("container-use-docker-"+env.ID)).
+		WithExposedPort(dockerPort).
+		AsService(dagger.ContainerAsServiceOpts{
+			Args:                     []string{"dockerd", "--host=tcp://0.0.0.0:2375", "--tls=false"},
+			InsecureRootCapabilities: true,
+		})
+
+	env.mu.Lock()
+	env.docker = daemon
+	env.mu.Unlock()
+
+	return container.
+		WithServiceBinding(dockerHostname, daemon).
+		WithEnvVariable("DOCKER_HOST", fmt.Sprintf("tcp://%s:%d", dockerHostname, dockerPort)).
+		// Containers started by tests publish their ports on the daemon's host, not on localhost.
+		WithEnvVariable("TESTCONTAINERS_HOST_OVERRIDE", dockerHostname), nil
+}
@@ -0,0 +1,296 @@
+package environment
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+const (
+	// dockerHubServer is the server Docker's configuration and credential helpers know Docker Hub as.
+	dockerHubServer = "https://index.docker.io/v1/"
+	// dockerConfigDir holds the Docker configuration with the host's credentials in environments.
+	dockerConfigDir = "/run/container-use/docker"
+)
+
+// RegistryCredential is the credential of a registry, as stored by Docker on the host.
+type RegistryCredential struct {
+	// Registry is the registry's host, docker.io for Docker Hub.
+	Registry string
+	Username string
+	Secret   string
+}
+
+// hostDockerConfig is the part of the host's Docker configuration (config.json) telling where credentials are.
+type hostDockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth,omitempty"`
+	} `json:"auths,omitempty"`
+	// CredsStore is the credential helper storing the credentials of every registry, e.g. osxkeychain.
+	CredsStore string `json:"credsStore,omitempty"`
+	// CredHelpers are the credential helpers of specific registries, e.g. ecr-login.
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// loadHostDockerConfig reads the host's Docker configuration, from $DOCKER_CONFIG or ~/.docker. A missing
+// configuration has no credentials.
+func loadHostDockerConfig() (*hostDockerConfig, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	config := &hostDockerConfig{}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid Docker configuration: %w", err)
+	}
+	return config, nil
+}
+
+// normalizeRegistry returns the host of a registry as found in Docker's configuration, which may be a URL,
+// with Docker Hub's aliases mapped to docker.io.
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	registry, _, _ = strings.Cut(registry, "/")
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+	return registry
+}
+
+// helper returns the credential helper storing the credentials of the registry, if any.
+func (c *hostDockerConfig) helper(registry string) string {
+	for server, helper := range c.CredHelpers {
+		if normalizeRegistry(server) == registry {
+			return helper
+		}
+	}
+	return c.CredsStore
+}
+
+// credential returns the credential of the registry, or nil if the host has none.
+func (c *hostDockerConfig) credential(registry string) (*RegistryCredential, error) {
+	registry = normalizeRegistry(registry)
+	if helper := c.helper(registry); helper != "" {
+		server := registry
+		if registry == "docker.io" {
+			server = dockerHubServer
+		}
+		return helperCredential(helper, registry, server)
+	}
+
+	for server, auth := range c.Auths {
+		if normalizeRegistry(server) != registry || auth.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Docker credential of %s: %w", registry, err)
+		}
+		username, secret, _ := strings.Cut(string(decoded), ":")
+		return &RegistryCredential{Registry: registry, Username: username, Secret: secret}, nil
+	}
+	return nil, nil
+}
+
+// credentials returns the credentials of every registry the host has credentials for, sorted by registry.
+func (c *hostDockerConfig) credentials() ([]*RegistryCredential, error) {
+	registries := map[string]bool{}
+	for server := range c.Auths {
+		registries[normalizeRegistry(server)] = true
+	}
+	for server := range c.CredHelpers {
+		registries[normalizeRegistry(server)] = true
+	}
+	if c.CredsStore != "" {
+		output, err := runCredentialHelper(c.CredsStore, "list", "")
+		if err != nil {
+			return nil, err
+		}
+		servers := map[string]string{}
+		if err := json.Unmarshal(output, &servers); err != nil {
+			return nil, fmt.Errorf("invalid output of docker-credential-%s list: %w", c.CredsStore, err)
+		}
+		for server := range servers {
+			registries[normalizeRegistry(server)] = true
+		}
+	}
+
+	var credentials []*RegistryCredential
+	for registry := range registries {
+		credential, err := c.credential(registry)
+		if err != nil {
+			return nil, err
+		}
+		if credential != nil {
+			credentials = append(credentials, credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool { return credentials[i].Registry < credentials[j].Registry })
+	return credentials, nil
+}
+
+// helperCredential asks a credential helper for the credential of a registry.
+func helperCredential(helper, registry, server string) (*RegistryCredential, error) {
+	output, err := runCredentialHelper(helper, "get", server)
+	if err != nil {
+		if strings.Contains(err.Error(), "credentials not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var credential struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(output, &credential); err != nil {
+		return nil, fmt.Errorf("invalid output of docker-credential-%s get: %w", helper, err)
+	}
+	return &RegistryCredential{Registry: registry, Username: credential.Username, Secret: credential.Secret}, nil
+}
+
+// runCredentialHelper runs an action of a Docker credential helper (docker-credential-<helper>), following
+// the credential helper protocol: the input on stdin, the result as JSON on stdout.
+func runCredentialHelper(helper, action, input string) ([]byte, error) {
+	cmd := exec.Command("docker-credential-"+helper, action)
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Helpers report errors such as missing credentials on stdout.
+		message := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		return nil, fmt.Errorf("docker-credential-%s %s failed: %w: %s", helper, action, err, message)
+	}
+	return stdout.Bytes(), nil
+}
+
+// HostRegistryCredential returns the host's Docker credential of a registry, or nil if it has none.
+func HostRegistryCredential(registry string) (*RegistryCredential, error) {
+	config, err := loadHostDockerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.credential(registry)
+}
+
+// HostRegistryCredentials returns the host's Docker credentials of every registry.
+func HostRegistryCredentials() ([]*RegistryCredential, error) {
+	config, err := loadHostDockerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.credentials()
+}
+
+// imageContainer returns a container of the image, pulled with the host's Docker credential of its
+// registry when the environment uses them. Images are pulled anonymously when the host has no credential.
+func (env *Environment) imageContainer(image string) *dagger.Container {
+	container := env.dag.Container()
+	if !env.State.Config.DockerCredentials {
+		return container.From(image)
+	}
+	registry := normalizeRegistry(parseImageReference(image).Registry)
+	credential, err := HostRegistryCredential(registry)
+	if err != nil {
+		slog.Warn("Failed to read the host's Docker credential, pulling anonymously", "environment-id", env.ID, "registry", registry, "error", err)
+	}
+	if credential != nil {
+		secret := env.dag.SetSecret("docker-credential-"+env.ID+"-"+registry, credential.Secret)
+		container = container.WithRegistryAuth(registry, credential.Username, secret)
+	}
+	return container.From(image)
+}
+
+// ImageRegistries returns the registries of the images the environment pulls, sorted: its base image, the
+// images of its services and tasks' services, and the Docker image. Only their credentials are used.
+func (config *EnvironmentConfig) ImageRegistries() []string {
+	images := []string{config.BaseImage}
+	for _, svc := range config.Services {
+		images = append(images, svc.Image)
+	}
+	for _, task := range config.Tasks {
+		for _, svc := range task.Services {
+			images = append(images, svc.Image)
+		}
+	}
+	if config.Docker != nil {
+		images = append(images, config.Docker.image())
+	}
+
+	seen := map[string]bool{}
+	var registries []string
+	for _, image := range images {
+		if image == "" {
+			continue
+		}
+		registry := normalizeRegistry(parseImageReference(image).Registry)
+		if !seen[registry] {
+			seen[registry] = true
+			registries = append(registries, registry)
+		}
+	}
+	sort.Strings(registries)
+	return registries
+}
+
+// withDockerCredentials gives the docker CLI of the container the host's Docker credentials of the
+// registries of the environment's images, as a configuration mounted as a secret, so images pulled from
+// the environment are authenticated. The credentials of other registries aren't given to the environment.
+func (env *Environment) withDockerCredentials(container *dagger.Container) (*dagger.Container, error) {
+	hostConfig, err := loadHostDockerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the host's Docker credentials: %w", err)
+	}
+
+	type auth struct {
+		Auth string `json:"auth"`
+	}
+	auths := map[string]auth{}
+	for _, registry := range env.State.Config.ImageRegistries() {
+		credential, err := hostConfig.credential(registry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the host's Docker credential of %s: %w", registry, err)
+		}
+		if credential == nil {
+			continue
+		}
+		server := credential.Registry
+		if server == "docker.io" {
+			server = dockerHubServer
+		}
+		auths[server] = auth{Auth: base64.StdEncoding.EncodeToString([]byte(credential.Username + ":" + credential.Secret))}
+	}
+	if len(auths) == 0 {
+		return container, nil
+	}
+	config, err := json.Marshal(map[string]any{"auths": auths})
+	if err != nil {
+		return nil, err
+	}
+	secret := env.dag.SetSecret("docker-config-"+env.ID, string(config))
+	return container.
+		WithMountedSecret(dockerConfigDir+"/config.json", secret).
+		WithEnvVariable("DOCKER_CONFIG", dockerConfigDir), nil
+}
@@ -0,0 +1,93 @@
+package environment
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeRegistry(t *testing.T) {
+	assert.Equal(t, "docker.io", normalizeRegistry("https://index.docker.io/v1/"))
+	assert.Equal(t, "docker.io", normalizeRegistry("registry-1.docker.io"))
+	assert.Equal(t, "ghcr.io", normalizeRegistry("https://ghcr.io"))
+	assert.Equal(t, "localhost:5000", normalizeRegistry("localhost:5000"))
+}
+
+func TestHostRegistryCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+
+	configDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", configDir)
+
+	credentials, err := HostRegistryCredentials()
+	require.NoError(t, err)
+	assert.Empty(t, credentials)
+
+	// A fake helper knowing Docker Hub and ghcr.io.
+	binDir := t.TempDir()
+	helper := `#!/bin/sh
+read server
+case "$1 $server" in
+list*) echo '{"https://index.docker.io/v1/":"hub-user","ghcr.io":"gh-user"}' ;;
+"get https://index.docker.io/v1/") echo '{"ServerURL":"https://index.docker.io/v1/","Username":"hub-user","Secret":"hub-secret"}' ;;
+"get ghcr.io") echo '{"ServerURL":"ghcr.io","Username":"gh-user","Secret":"gh-secret"}' ;;
+*) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "docker-credential-fake"), []byte(helper), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	auth := base64.StdEncoding.EncodeToString([]byte("ci:registry-password"))
+	config := `{
+		"auths": {"registry.example.com": {"auth": "` + auth + `"}, "ghcr.io": {}},
+		"credsStore": "fake",
+		"credHelpers": {"registry.example.com": "none"}
+	}`
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(config), 0600))
+
+	credential, err := HostRegistryCredential("registry-1.docker.io")
+	require.NoError(t, err)
+	assert.Equal(t, &RegistryCredential{Registry: "docker.io", Username: "hub-user", Secret: "hub-secret"}, credential)
+
+	credential, err = HostRegistryCredential("quay.io")
+	require.NoError(t, err)
+	assert.Nil(t, credential)
+
+	// registry.example.com has a helper that doesn't exist.
+	_, err = HostRegistryCredential("registry.example.com")
+	assert.ErrorContains(t, err, "docker-credential-none get failed")
+
+	// Without helpers, the credentials of config.json are used.
+	config = `{"auths": {"https://registry.example.com": {"auth": "` + auth + `"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(config), 0600))
+	credential, err = HostRegistryCredential("registry.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, &RegistryCredential{Registry: "registry.example.com", Username: "ci", Secret: "registry-password"}, credential)
+
+	config = `{"credsStore": "fake"}`
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(config), 0600))
+	credentials, err = HostRegistryCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, []*RegistryCredential{
+		{Registry: "docker.io", Username: "hub-user", Secret: "hub-secret"},
+		{Registry: "ghcr.io", Username: "gh-user", Secret: "gh-secret"},
+	}, credentials)
+}
+
+func TestImageRegistries(t *testing.T) {
+	config := DefaultConfig()
+	assert.Equal(t, []string{"docker.io"}, config.ImageRegistries())
+
+	config.BaseImage = "ghcr.io/acme/base:1"
+	config.Services = ServiceConfigs{{Name: "db", Image: "postgres:16"}, {Name: "cache", Image: "registry.example.com:5000/redis"}}
+	config.Tasks = TaskConfigs{{Name: "e2e", Services: ServiceConfigs{{Name: "browser", Image: "ghcr.io/acme/browser"}}}}
+	config.Docker = &DockerConfig{Image: "mirror.example.com/docker:dind"}
+	assert.Equal(t, []string{"docker.io", "ghcr.io", "mirror.example.com", "registry.example.com:5000"}, config.ImageRegistries())
+}
@@ -0,0 +1,180 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// Drift changes.
+const (
+	DriftAdded   = "added"
+	DriftRemoved = "removed"
+	DriftChanged = "changed"
+)
+
+// inventoryScript lists what's installed in a container, one "kind name version" line per item:
+// system and language packages, executables outside of the system directories, and environment variables.
+const inventoryScript = `
+if command -v dpkg-query >/dev/null 2>&1; then dpkg-query -W -f='dpkg ${Package} ${Version}\n' 2>/dev/null; fi
+if command -v apk >/dev/null 2>&1; then apk info -v 2>/dev/null | sed -nE 's/^(.+)-([0-9][^-]*-r[0-9]+)$/apk \1 \2/p'; fi
+if command -v python3 >/dev/null 2>&1; then python3 -m pip list --format=freeze 2>/dev/null | sed -nE 's/^([^=]+)==(.+)$/pip \1 \2/p'; fi
+if command -v npm >/dev/null 2>&1; then npm ls -g --depth=0 2>/dev/null | sed -nE 's/^.* (@?[^@ ]+)@([^ ]+)$/npm \1 \2/p'; fi
+for dir in $(echo "$PATH" | tr ':' ' '); do
+	case "$dir" in /bin|/sbin|/usr/bin|/usr/sbin) continue ;; esac
+	[ -d "$dir" ] && ls -1 "$dir" 2>/dev/null | sed "s|^|bin $dir/|; s|$| -|"
+done
+env | sed -nE 's/^([A-Za-z_][A-Za-z0-9_]*)=(.*)$/env \1 \2/p'
+`
+
+// driftIgnoredEnv are variables set by the shell or the runtime rather than by the environment.
+var driftIgnoredEnv = []string{"HOSTNAME", "OLDPWD", "PWD", "SHLVL", "_"}
+
+// DriftItem is something installed or set differently in the environment than its configuration says.
+type DriftItem struct {
+	// Kind is dpkg, apk, pip or npm for packages, bin for executables and env for environment variables.
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Change   string `json:"change"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// Drift compares an environment's container with the container its configuration builds.
+type Drift struct {
+	EnvironmentID string       `json:"environment_id"`
+	Items         []*DriftItem `json:"items"`
+	// Suggestions are the configuration changes that would reproduce the drift in new environments.
+	Suggestions []string `json:"suggestions"`
+}
+
+// Drift reports how the environment's container differs from what its configuration builds,
+// e.g. packages installed by the agent that should be promoted to setup commands.
+// The configuration is rebuilt on top of the current workdir to compare with.
+func (env *Environment) Drift(ctx context.Context) (*Drift, error) {
+	expected := &Environment{
+		EnvironmentInfo: &EnvironmentInfo{
+			ID:    env.ID,
+			State: &State{Config: env.State.Config.Copy()},
+		},
+		dag: env.dag,
+	}
+	expectedContainer, err := expected.buildBase(ctx, env.Workdir(), env.Workdir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the configured environment: %w", err)
+	}
+
+	expectedInventory, err := inventory(ctx, expectedContainer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect the configured environment: %w", err)
+	}
+	actualInventory, err := inventory(ctx, env.container())
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect the environment: %w", err)
+	}
+
+	// Secrets are configured, never drift, and must not be reported.
+	for _, name := range env.State.Config.Secrets.Keys() {
+		delete(expectedInventory, "env "+name)
+		delete(actualInventory, "env "+name)
+	}
+
+	items := diffInventories(expectedInventory, actualInventory)
+	return &Drift{
+		EnvironmentID: env.ID,
+		Items:         items,
+		Suggestions:   driftSuggestions(items),
+	}, nil
+}
+
+func inventory(ctx context.Context, container *dagger.Container) (map[string]string, error) {
+	output, err := container.WithExec([]string{"sh", "-c", inventoryScript}).Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseInventory(output), nil
+}
+
+// parseInventory maps "kind name" to the version of every line of the inventory script output.
+func parseInventory(output string) map[string]string {
+	items := map[string]string{}
+	for line := range strings.SplitSeq(output, "\n") {
+		kind, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		name, version, _ := strings.Cut(rest, " ")
+		if name == "" || (kind == "env" && slices.Contains(driftIgnoredEnv, name)) {
+			continue
+		}
+		items[kind+" "+name] = version
+	}
+	return items
+}
+
+func diffInventories(expected, actual map[string]string) []*DriftItem {
+	items := []*DriftItem{}
+	for key, version := range actual {
+		kind, name, _ := strings.Cut(key, " ")
+		expectedVersion, ok := expected[key]
+		switch {
+		case !ok:
+			items = append(items, &DriftItem{Kind: kind, Name: name, Change: DriftAdded, Actual: version})
+		case expectedVersion != version:
+			items = append(items, &DriftItem{Kind: kind, Name: name, Change: DriftChanged, Expected: expectedVersion, Actual: version})
+		}
+	}
+	for key, version := range expected {
+		if _, ok := actual[key]; !ok {
+			kind, name, _ := strings.Cut(key, " ")
+			items = append(items, &DriftItem{Kind: kind, Name: name, Change: DriftRemoved, Expected: version})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+// driftSuggestions returns the commands adding the installed packages and variables to the configuration.
+func driftSuggestions(items []*DriftItem) []string {
+	installs := map[string][]string{}
+	suggestions := []string{}
+	for _, item := range items {
+		if item.Change == DriftRemoved {
+			continue
+		}
+		switch item.Kind {
+		case "dpkg", "apk":
+			installs[item.Kind] = append(installs[item.Kind], item.Name)
+		case "pip":
+			installs[item.Kind] = append(installs[item.Kind], item.Name+"=="+item.Actual)
+		case "npm":
+			installs[item.Kind] = append(installs[item.Kind], item.Name+"@"+item.Actual)
+		case "env":
+			suggestions = append(suggestions, fmt.Sprintf("container-use config env set %s %s", item.Name, shellQuote(item.Actual)))
+		}
+	}
+
+	commands := map[string]string{
+		"dpkg": "apt-get update && apt-get install -y %s",
+		"apk":  "apk add --no-cache %s",
+		"pip":  "pip install %s",
+		"npm":  "npm install -g %s",
+	}
+	var setup []string
+	for _, kind := range []string{"dpkg", "apk", "pip", "npm"} {
+		if len(installs[kind]) > 0 {
+			setup = append(setup, fmt.Sprintf("container-use config setup-command add %s", shellQuote(fmt.Sprintf(commands[kind], strings.Join(installs[kind], " ")))))
+		}
+	}
+	return append(setup, suggestions...)
+}
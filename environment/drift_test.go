@@ -0,0 +1,44 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrift(t *testing.T) {
+	expected := parseInventory(`dpkg curl 8.5.0-2ubuntu10
+dpkg git 1:2.43.0-1ubuntu7
+env PATH /usr/local/bin:/usr/bin:/bin
+env HOSTNAME abc123
+env LANG C.UTF-8
+`)
+	actual := parseInventory(`dpkg curl 8.5.0-2ubuntu10
+dpkg git 1:2.43.0-1ubuntu8
+dpkg jq 1.7.1-3build1
+pip requests 2.32.3
+bin /usr/local/bin/golangci-lint -
+env PATH /usr/local/bin:/usr/bin:/bin
+env HOSTNAME def456
+env GOFLAGS -mod=mod -v
+`)
+	assert.Equal(t, "-mod=mod -v", actual["env GOFLAGS"])
+	assert.NotContains(t, actual, "env HOSTNAME")
+
+	items := diffInventories(expected, actual)
+	require.Equal(t, []*DriftItem{
+		{Kind: "bin", Name: "/usr/local/bin/golangci-lint", Change: DriftAdded, Actual: "-"},
+		{Kind: "dpkg", Name: "git", Change: DriftChanged, Expected: "1:2.43.0-1ubuntu7", Actual: "1:2.43.0-1ubuntu8"},
+		{Kind: "dpkg", Name: "jq", Change: DriftAdded, Actual: "1.7.1-3build1"},
+		{Kind: "env", Name: "GOFLAGS", Change: DriftAdded, Actual: "-mod=mod -v"},
+		{Kind: "env", Name: "LANG", Change: DriftRemoved, Expected: "C.UTF-8"},
+		{Kind: "pip", Name: "requests", Change: DriftAdded, Actual: "2.32.3"},
+	}, items)
+
+	assert.Equal(t, []string{
+		`container-use config setup-command add 'apt-get update && apt-get install -y git jq'`,
+		`container-use config setup-command add 'pip install requests==2.32.3'`,
+		`container-use config env set GOFLAGS '-mod=mod -v'`,
+	}, driftSuggestions(items))
+}
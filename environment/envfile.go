@@ -0,0 +1,161 @@
+package environment
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+var envVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseEnvFile reads the variables of a dotenv file: KEY=VALUE lines, optionally prefixed with export,
+// with # comments and blank lines. Values may be single-quoted, taken literally, or double-quoted, where
+// escapes such as \n are interpreted; unquoted values end at a " #" comment.
+func ParseEnvFile(path string) (KVList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := KVList{}
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !envVariableName.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		vars.Set(key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func parseEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return value[1 : end+1], nil
+	case strings.HasPrefix(value, `"`):
+		// Find the closing quote, skipping escaped ones.
+		for i := 1; i < len(value); i++ {
+			switch value[i] {
+			case '\\':
+				i++
+			case '"':
+				unquoted, err := strconv.Unquote(value[:i+1])
+				if err != nil {
+					return "", fmt.Errorf("invalid quoted value: %w", err)
+				}
+				return unquoted, nil
+			}
+		}
+		return "", fmt.Errorf("unterminated quoted value")
+	}
+	if comment := strings.Index(value, " #"); comment >= 0 {
+		value = value[:comment]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// ParseEnvVariables returns the variables of the dotenv files, in order, then of the KEY=VALUE
+// assignments, later ones overriding earlier ones. Like docker run -e, a bare KEY takes the value of
+// the host's variable, and is skipped when the host doesn't have it.
+func ParseEnvVariables(envFiles, assignments []string) (KVList, error) {
+	vars := KVList{}
+	for _, path := range envFiles {
+		fileVars, err := ParseEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range fileVars.Keys() {
+			vars.Set(key, fileVars.Get(key))
+		}
+	}
+	for _, assignment := range assignments {
+		key, value, found := strings.Cut(assignment, "=")
+		if !envVariableName.MatchString(key) {
+			return nil, fmt.Errorf("invalid environment variable %q: expected KEY=VALUE", assignment)
+		}
+		if !found {
+			if value, found = os.LookupEnv(key); !found {
+				continue
+			}
+		}
+		vars.Set(key, value)
+	}
+	return vars, nil
+}
+
+type commandEnvKey struct{}
+
+// WithCommandEnv returns a context running commands with these variables in addition to the
+// environment's, for these commands only: they're not kept in the environment.
+func WithCommandEnv(ctx context.Context, vars KVList) context.Context {
+	return context.WithValue(ctx, commandEnvKey{}, vars)
+}
+
+func commandEnvFromContext(ctx context.Context) KVList {
+	vars, _ := ctx.Value(commandEnvKey{}).(KVList)
+	return vars
+}
+
+// withCommandEnv sets the command variables of the context on container. The returned function restores
+// the variables they replaced on the container resulting from the command, so they're not kept.
+func withCommandEnv(ctx context.Context, container *dagger.Container) (*dagger.Container, func(*dagger.Container) *dagger.Container, error) {
+	vars := commandEnvFromContext(ctx)
+	if len(vars) == 0 {
+		return container, func(c *dagger.Container) *dagger.Container { return c }, nil
+	}
+
+	existing, err := container.EnvVariables(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the environment variables: %w", err)
+	}
+	previous := map[string]string{}
+	for _, variable := range existing {
+		name, err := variable.Name(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if value, err := variable.Value(ctx); err == nil {
+			previous[name] = value
+		}
+	}
+
+	for _, key := range vars.Keys() {
+		container = container.WithEnvVariable(key, vars.Get(key), dagger.ContainerWithEnvVariableOpts{Expand: true})
+	}
+	restore := func(c *dagger.Container) *dagger.Container {
+		for _, key := range vars.Keys() {
+			if value, ok := previous[key]; ok {
+				c = c.WithEnvVariable(key, value)
+			} else {
+				c = c.WithoutEnvVariable(key)
+			}
+		}
+		return c
+	}
+	return container, restore, nil
+}
@@ -0,0 +1,58 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte(`# Test database
+DATABASE_URL=postgres://db:5432/test
+export API_KEY = abc123
+EMPTY=
+GREETING="hello\nworld" # two lines
+LITERAL='$HOME is \n not expanded'
+LEVEL=debug # inline comment
+URL=http://example.com/#anchor
+`), 0600))
+
+	vars, err := ParseEnvFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, KVList{
+		"DATABASE_URL=postgres://db:5432/test",
+		"API_KEY=abc123",
+		"EMPTY=",
+		"GREETING=hello\nworld",
+		`LITERAL=$HOME is \n not expanded`,
+		"LEVEL=debug",
+		"URL=http://example.com/#anchor",
+	}, vars)
+
+	require.NoError(t, os.WriteFile(path, []byte("VALID=1\nnot a variable\n"), 0600))
+	_, err = ParseEnvFile(path)
+	assert.ErrorContains(t, err, ".env:2: expected KEY=VALUE")
+
+	require.NoError(t, os.WriteFile(path, []byte(`QUOTED="unterminated`), 0600))
+	_, err = ParseEnvFile(path)
+	assert.ErrorContains(t, err, "unterminated")
+}
+
+func TestParseEnvVariables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte("LEVEL=info\nPORT=8080\n"), 0600))
+	t.Setenv("CU_TEST_TOKEN", "from-host")
+
+	vars, err := ParseEnvVariables([]string{path}, []string{"LEVEL=debug", "CU_TEST_TOKEN", "CU_TEST_UNSET", "EXPR=a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, KVList{"PORT=8080", "LEVEL=debug", "CU_TEST_TOKEN=from-host", "EXPR=a=b"}, vars)
+
+	_, err = ParseEnvVariables(nil, []string{"1BAD=value"})
+	assert.ErrorContains(t, err, "expected KEY=VALUE")
+	_, err = ParseEnvVariables([]string{filepath.Join(t.TempDir(), "missing.env")}, nil)
+	assert.Error(t, err)
+}
@@ -28,6 +28,16 @@ type Environment struct {
 	Services []*Service
 	Notes    Notes
 
+	// background holds the services running background commands, so they can be stopped.
+	background []*dagger.Service
+	// docker is the environment's Docker daemon, if it runs one.
+	docker *dagger.Service
+
+	// OnEvent, if set, is called for every lifecycle event (commands, checkpoints).
+	OnEvent EventFunc
+	// OnInputPrompt, if set, asks the user to answer the prompts commands fail on.
+	OnInputPrompt InputPrompt
+
 	mu sync.RWMutex
 }
 
@@ -36,9 +46,17 @@ type NewEnvArgs struct {
 	Dag              *dagger.Client
 	ID               string
 	Title            string
+	Labels           []string
 	Config           *EnvironmentConfig
 	InitialSourceDir *dagger.Directory
 	SubmodulePaths   []string
+	// OnEvent, if set, receives the events emitted while the environment is built.
+	OnEvent EventFunc
+	// OnInputPrompt, if set, asks the user to answer the prompts setup commands fail on.
+	OnInputPrompt InputPrompt
+	// Container, if set, is the container the environment starts from instead of one built from its
+	// configuration, e.g. the container of the environment it's cloned from.
+	Container *dagger.Container
 }
 
 func New(ctx context.Context, args NewEnvArgs) (*Environment, error) {
@@ -48,17 +66,23 @@ func New(ctx context.Context, args NewEnvArgs) (*Environment, error) {
 			State: &State{
 				Config:         args.Config,
 				Title:          args.Title,
+				Labels:         args.Labels,
 				CreatedAt:      time.Now(),
 				UpdatedAt:      time.Now(),
 				SubmodulePaths: args.SubmodulePaths,
 			},
 		},
-		dag: args.Dag,
+		dag:           args.Dag,
+		OnEvent:       args.OnEvent,
+		OnInputPrompt: args.OnInputPrompt,
 	}
 
-	container, err := env.buildBase(ctx, args.InitialSourceDir)
-	if err != nil {
-		return nil, err
+	container := args.Container
+	if container == nil {
+		var err error
+		if container, err = env.buildBase(ctx, args.InitialSourceDir, args.InitialSourceDir); err != nil {
+			return nil, err
+		}
 	}
 
 	slog.Info("Creating environment", "id", env.ID, "workdir", env.State.Config.Workdir)
@@ -91,6 +115,10 @@ func Load(ctx context.Context, dag *dagger.Client, id string, state []byte, work
 	if err != nil {
 		return nil, err
 	}
+	// The state may have been edited since it was created: the network overrides are passed to a shell.
+	if err := envInfo.State.Config.ValidateNetwork(); err != nil {
+		return nil, fmt.Errorf("environment %s: %w", id, err)
+	}
 	env := &Environment{
 		EnvironmentInfo: envInfo,
 		dag:             dag,
@@ -125,8 +153,10 @@ func LoadInfo(ctx context.Context, id string, state []byte, worktree string) (*E
 	return envInfo, nil
 }
 
+// apply records newState as the environment's state. It's the environment's write barrier: newState is
+// evaluated first, so the state is never a change that could still fail, and anything loading the state
+// once a tool returned sees the tool's changes.
 func (env *Environment) apply(ctx context.Context, newState *dagger.Container) error {
-	// TODO(braa): is this sync redundant with newState.ID?
 	if _, err := newState.Sync(ctx); err != nil {
 		return err
 	}
@@ -135,11 +165,13 @@ func (env *Environment) apply(ctx context.Context, newState *dagger.Container) e
 	if err != nil {
 		return err
 	}
+	conflicts := env.openConflicts(ctx, newState)
 
 	env.mu.Lock()
 	defer env.mu.Unlock()
 	env.State.UpdatedAt = time.Now()
 	env.State.Container = string(containerID)
+	env.State.Conflicts = conflicts
 
 	return nil
 }
@@ -169,52 +201,156 @@ func containerWithEnvAndSecrets(dag *dagger.Client, container *dagger.Container,
 	return container, nil
 }
 
-func (env *Environment) buildBase(ctx context.Context, baseSourceDir *dagger.Directory) (*dagger.Container, error) {
-	container := env.dag.
-		Container().
-		From(env.State.Config.BaseImage).
-		WithWorkdir(env.State.Config.Workdir)
+// buildBase builds the environment's container from its configuration, with the files of baseSourceDir in
+// the workdir. A Containerfile base image is built from the files of buildSource.
+func (env *Environment) buildBase(ctx context.Context, baseSourceDir, buildSource *dagger.Directory) (*dagger.Container, error) {
+	if err := env.State.Config.validateHardened(); err != nil {
+		return nil, err
+	}
+	if err := env.State.Config.ValidateNetwork(); err != nil {
+		return nil, err
+	}
+	if limits := env.State.Config.Resources; limits != nil {
+		if err := limits.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := env.State.Config.Services.Validate(); err != nil {
+		return nil, err
+	}
 
-	container, err := containerWithEnvAndSecrets(env.dag, container, env.State.Config.Env, env.State.Config.Secrets)
+	base, err := env.baseContainer(buildSource)
 	if err != nil {
 		return nil, err
 	}
+	container := base.WithWorkdir(env.State.Config.Workdir)
 
-	runCommands := func(commands []string) error {
-		for _, command := range commands {
-			var err error
+	if env.OnEvent != nil {
+		// Pull the image right away so listeners can tell pulling from setting up.
+		if err := env.pullBaseImage(ctx, container); err != nil {
+			return nil, err
+		}
+	}
 
-			container = container.WithExec([]string{"sh", "-c", command})
+	container, err = containerWithEnvAndSecrets(env.dag, container, env.State.Config.Env, env.State.Config.Secrets)
+	if err != nil {
+		return nil, err
+	}
 
-			exitCode, err := container.ExitCode(ctx)
-			if err != nil {
-				var exitErr *dagger.ExecError
-				if errors.As(err, &exitErr) {
-					env.Notes.AddCommand(command, exitErr.ExitCode, exitErr.Stdout, exitErr.Stderr)
-					return fmt.Errorf("exit code %d.\nstdout: %s\nstderr: %s\n%w", exitErr.ExitCode, exitErr.Stdout, exitErr.Stderr, err)
-				}
+	// Provide host files before the setup commands, which may need them (e.g. ~/.npmrc)
+	if container, err = env.withHostFiles(container); err != nil {
+		return nil, fmt.Errorf("failed to provide host files: %w", err)
+	}
 
-				return err
+	// Steps are keyed like the engine caches them, so the build log tells which ones were reused.
+	cacheKey, err := env.baseCacheKey(ctx, container, buildSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base image %s: %w", env.State.Config.BaseImageDescription(), err)
+	}
+
+	// runCommand runs a step, with its input files (if any) added to the workdir first.
+	runCommand := func(command string, inputs *dagger.Directory) error {
+		startedAt := time.Now()
+		inputsDigest := ""
+		if inputs != nil {
+			var err error
+			if inputsDigest, err = inputs.Digest(ctx); err != nil {
+				return fmt.Errorf("failed to read the inputs of %q: %w", command, err)
 			}
-			stdout, err := container.Stdout(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to get stdout: %w", err)
+			container = container.WithDirectory(".", inputs)
+		}
+		cacheKey = stepCacheKey(cacheKey, command, inputsDigest)
+
+		// Run the step again with the user's answers as long as it fails on a prompt.
+		previous := container
+		var input commandInput
+		var exitCode int
+		var err error
+		for answers := 0; ; answers++ {
+			withInput, args, stdin, inputErr := env.withInput(previous, stepArgs(command), input)
+			if inputErr != nil {
+				return inputErr
 			}
-
-			stderr, err := container.Stderr(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to get stderr: %w", err)
+			container = withInput.WithExec(env.State.Config.withNetworkOverrides(args), dagger.ContainerWithExecOpts{Stdin: stdin})
+			exitCode, err = container.ExitCode(ctx)
+			var exitErr *dagger.ExecError
+			if err == nil || !errors.As(err, &exitErr) || answers == maxPromptAnswers {
+				break
+			}
+			next, ok, promptErr := env.answerPrompt(ctx, command, input, exitErr.Stdout, exitErr.Stderr)
+			if promptErr != nil {
+				return promptErr
+			}
+			if !ok {
+				break
 			}
+			input = next
+		}
+		container = withoutInput(container, input)
+		if err != nil {
+			var exitErr *dagger.ExecError
+			if errors.As(err, &exitErr) {
+				stderr, _ := splitStepStamp(exitErr.Stderr, startedAt)
+				env.Notes.AddCommand(command, exitErr.ExitCode, exitErr.Stdout, stderr)
+				return fmt.Errorf("exit code %d.\nstdout: %s\nstderr: %s\n%w", exitErr.ExitCode, exitErr.Stdout, stderr, err)
+			}
+
+			return err
+		}
+		stdout, err := container.Stdout(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get stdout: %w", err)
+		}
 
-			env.Notes.AddCommand(command, exitCode, stdout, stderr)
+		stderr, err := container.Stderr(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get stderr: %w", err)
 		}
+		stderr, cached := splitStepStamp(stderr, startedAt)
 
+		env.Notes.AddCommand(command, exitCode, stdout, stderr)
+		if cached {
+			env.Notes.Add("(cached, step %s)", shortKey(cacheKey))
+		}
+		slog.Info("Setup step complete", "environment-id", env.ID, "command", command, "cached", cached, "cache-key", shortKey(cacheKey))
+		env.emit(EventSetupStep, map[string]any{
+			"command":     command,
+			"exit_code":   exitCode,
+			"duration_ms": time.Since(startedAt).Milliseconds(),
+			"cached":      cached,
+			"cache_key":   cacheKey,
+		})
 		return nil
 	}
 
-	// Run setup commands without the source directory for caching purposes
-	if err := runCommands(env.State.Config.SetupCommands); err != nil {
-		return nil, fmt.Errorf("setup command failed: %w", err)
+	addSource := func() error {
+		digest, err := baseSourceDir.Digest(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read the source directory: %w", err)
+		}
+		cacheKey = stepCacheKey(cacheKey, "", digest)
+		container = container.WithDirectory(".", baseSourceDir)
+		return nil
+	}
+
+	// Install dev container features first so setup commands can rely on the tools they provide
+	for i, feature := range env.State.Config.Features {
+		install, err := env.prepareFeature(ctx, i, feature)
+		if err != nil {
+			return nil, err
+		}
+		container = container.WithDirectory(install.dir, install.source)
+		if err := runCommand(install.command, nil); err != nil {
+			return nil, fmt.Errorf("feature %s failed: %w", feature.Ref, err)
+		}
+		container = install.finish(container)
+	}
+
+	// Run setup commands without the source directory for caching purposes: only their inputs, if any
+	for _, command := range env.State.Config.SetupCommands {
+		if err := runCommand(command, env.commandInputs(baseSourceDir, command)); err != nil {
+			return nil, fmt.Errorf("setup command failed: %w", err)
+		}
 	}
 
 	env.Services, err = env.startServices(ctx)
@@ -225,11 +361,39 @@ func (env *Environment) buildBase(ctx context.Context, baseSourceDir *dagger.Dir
 		container = container.WithServiceBinding(service.Config.Name, service.svc)
 	}
 
-	container = container.WithDirectory(".", baseSourceDir)
+	if env.State.Config.Docker != nil {
+		if container, err = env.withDocker(container); err != nil {
+			return nil, fmt.Errorf("failed to set up docker: %w", err)
+		}
+	}
 
-	// Run the install commands after the source directory is set up
-	if err := runCommands(env.State.Config.InstallCommands); err != nil {
-		return nil, fmt.Errorf("install command failed: %w", err)
+	// Run the install commands after the source directory is set up, except the leading ones
+	// with inputs: they only need their inputs, so editing other files doesn't rerun them.
+	sourceAdded := false
+	for _, command := range env.State.Config.InstallCommands {
+		inputs := env.commandInputs(baseSourceDir, command)
+		if !sourceAdded && inputs == nil {
+			if err := addSource(); err != nil {
+				return nil, err
+			}
+			sourceAdded = true
+		}
+		if sourceAdded {
+			inputs = nil
+		}
+		if err := runCommand(command, inputs); err != nil {
+			return nil, fmt.Errorf("install command failed: %w", err)
+		}
+	}
+	if !sourceAdded {
+		if err := addSource(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Setup and install commands come from the configuration and run as root, the agent's commands don't.
+	if env.State.Config.Hardened {
+		container = env.harden(container)
 	}
 
 	return container, nil
@@ -239,7 +403,7 @@ func (env *Environment) UpdateConfig(ctx context.Context, newConfig *Environment
 	env.State.Config = newConfig
 
 	// Re-build the base image with the new config
-	container, err := env.buildBase(ctx, env.Workdir())
+	container, err := env.buildBase(ctx, env.Workdir(), env.Workdir())
 	if err != nil {
 		return err
 	}
@@ -251,34 +415,38 @@ func (env *Environment) UpdateConfig(ctx context.Context, newConfig *Environment
 	return nil
 }
 
+// RebuildBase rebuilds the environment with a new configuration, like UpdateConfig, building a
+// Containerfile base image from the files of buildSource (e.g. the user's repository) rather than the
+// environment's own files. The container state of previous commands is lost.
+func (env *Environment) RebuildBase(ctx context.Context, newConfig *EnvironmentConfig, buildSource *dagger.Directory) error {
+	env.State.Config = newConfig
+
+	container, err := env.buildBase(ctx, env.Workdir(), buildSource)
+	if err != nil {
+		return err
+	}
+	return env.apply(ctx, container)
+}
+
 func (env *Environment) Run(ctx context.Context, command, shell string, useEntrypoint bool) (string, error) {
 	args := []string{}
 	if command != "" {
 		args = []string{shell, "-c", command}
 	}
-	newState := env.container().WithExec(args, dagger.ContainerWithExecOpts{
-		UseEntrypoint:                 useEntrypoint,
-		Expect:                        dagger.ReturnTypeAny, // Don't treat non-zero exit as error
-		ExperimentalPrivilegedNesting: true,
-	})
-
-	exitCode, err := newState.ExitCode(ctx)
-	if err != nil {
-		return "", fmt.Errorf("failed to get exit code: %w", err)
+	if useEntrypoint && env.State.Config.Hardened {
+		return "", errHardenedEntrypoint
 	}
-
-	stdout, err := newState.Stdout(ctx)
-	if err != nil {
-		return "", fmt.Errorf("failed to get stdout: %w", err)
+	if !useEntrypoint {
+		args = env.State.Config.execArgs(args)
 	}
-
-	stderr, err := newState.Stderr(ctx)
+	newState, stdout, stderr, exitCode, err := env.exec(ctx, env.container(), command, args, useEntrypoint)
 	if err != nil {
-		return "", fmt.Errorf("failed to get stderr: %w", err)
+		return "", err
 	}
 
 	// Log the command execution with all details
 	env.Notes.AddCommand(command, exitCode, stdout, stderr)
+	env.recordStateChanges(ctx, command, env.container(), newState)
 
 	// Always apply the container state (preserving changes even on non-zero exit)
 	if err := env.apply(ctx, newState); err != nil {
@@ -298,45 +466,154 @@ func (env *Environment) Run(ctx context.Context, command, shell string, useEntry
 
 // RunWithExitCode executes a command in the environment and returns stdout, stderr, exit code, and error.
 func (env *Environment) RunWithExitCode(ctx context.Context, command, shell string, useEntrypoint bool) (stdout string, stderr string, exitCode int, err error) {
+	return env.RunWithAttachments(ctx, command, shell, useEntrypoint, nil, false)
+}
+
+// RunWithAttachments is RunWithExitCode with host files staged into the container for the command.
+// The attachments are removed once the command ran, unless keep is set.
+func (env *Environment) RunWithAttachments(ctx context.Context, command, shell string, useEntrypoint bool, attachments []*Attachment, keep bool) (stdout string, stderr string, exitCode int, err error) {
 	args := []string{}
 	if command != "" {
 		args = []string{shell, "-c", command}
 	}
-	newState := env.container().WithExec(args, dagger.ContainerWithExecOpts{
-		UseEntrypoint:                 useEntrypoint,
-		Expect:                        dagger.ReturnTypeAny,
-		ExperimentalPrivilegedNesting: true,
-	})
-
-	exitCode, err = newState.ExitCode(ctx)
-	if err != nil {
-		return "", "", 0, fmt.Errorf("failed to get exit code: %w", err)
+	if useEntrypoint && env.State.Config.Hardened {
+		return "", "", 0, errHardenedEntrypoint
 	}
-
-	stdout, err = newState.Stdout(ctx)
-	if err != nil {
-		return "", "", exitCode, fmt.Errorf("failed to get stdout: %w", err)
+	if !useEntrypoint {
+		args = env.State.Config.execArgs(args)
 	}
-
-	stderr, err = newState.Stderr(ctx)
+	container, cleanup := env.withAttachments(env.container(), attachments, keep)
+	newState, stdout, stderr, exitCode, err := env.exec(ctx, container, command, args, useEntrypoint)
 	if err != nil {
-		return stdout, "", exitCode, fmt.Errorf("failed to get stderr: %w", err)
+		return stdout, stderr, exitCode, err
 	}
 
 	env.Notes.AddCommand(command, exitCode, stdout, stderr)
+	after := cleanup(newState)
+	env.recordStateChanges(ctx, command, env.container(), after)
 
-	if err := env.apply(ctx, newState); err != nil {
+	if err := env.apply(ctx, after); err != nil {
 		return stdout, stderr, exitCode, fmt.Errorf("failed to apply container state: %w", err)
 	}
 
 	return stdout, stderr, exitCode, nil
 }
 
+// exec runs a command of the agent or the user on container, without treating a non-zero exit as an
+// error. The environment's services are started first, unless they're running. A command failing on a prompt
+// runs again with the user's answers, if they can be asked. Its output goes through the context's output
+// filter, if any, and it gets the context's command variables.
+func (env *Environment) exec(ctx context.Context, container *dagger.Container, command string, args []string, useEntrypoint bool) (newState *dagger.Container, stdout, stderr string, exitCode int, err error) {
+	if err := env.ensureServices(ctx); err != nil {
+		return nil, "", "", 0, err
+	}
+	container, restoreEnv, err := withCommandEnv(ctx, container)
+	if err != nil {
+		return nil, "", "", 0, err
+	}
+	newState, stdout, stderr, exitCode, err = env.execUnfiltered(ctx, container, command, args, useEntrypoint)
+	if newState != nil {
+		newState = restoreEnv(newState)
+	}
+	filter := outputFilterFromContext(ctx)
+	return newState, filter.Apply(stdout), filter.Apply(stderr), exitCode, err
+}
+
+func (env *Environment) execUnfiltered(ctx context.Context, container *dagger.Container, command string, args []string, useEntrypoint bool) (newState *dagger.Container, stdout, stderr string, exitCode int, err error) {
+	var input commandInput
+	installed := false
+	// The entrypoint would run the script enforcing the timeout instead of the command.
+	timeout := env.CommandTimeout(ctx)
+	if timeout != nil && (useEntrypoint || len(args) == 0) {
+		timeout = nil
+	}
+	if timeout != nil {
+		args = timeout.wrap(args)
+	}
+	for answers := 0; ; answers++ {
+		startedAt := time.Now()
+		env.emit(EventExecStarted, map[string]any{"command": command})
+		withInput, execArgs, stdin, inputErr := env.withInput(container, args, input)
+		if inputErr != nil {
+			return nil, "", "", 0, inputErr
+		}
+		opts := dagger.ContainerWithExecOpts{
+			UseEntrypoint:                 useEntrypoint,
+			Stdin:                         stdin,
+			Expect:                        dagger.ReturnTypeAny, // Don't treat non-zero exit as error
+			ExperimentalPrivilegedNesting: env.State.Config.privilegedNesting(),
+		}
+
+		// The entrypoint would run the wrapper writing the output of streamed commands.
+		if stream := outputStreamFromContext(ctx); stream != nil && !useEntrypoint && len(args) > 0 {
+			newState, exitCode, stdout, stderr, err = env.execStreaming(ctx, withInput, execArgs, opts, stream)
+			if err != nil {
+				env.emit(EventExecFinished, map[string]any{"command": command, "error": err.Error(), "duration_ms": time.Since(startedAt).Milliseconds()})
+				return nil, "", "", exitCode, err
+			}
+			env.emit(EventExecFinished, map[string]any{"command": command, "exit_code": exitCode, "duration_ms": time.Since(startedAt).Milliseconds()})
+		} else {
+			newState = withInput.WithExec(execArgs, opts)
+
+			// The command's own failures are exit codes: errors come from the engine, e.g. a lost connection.
+			err = env.retry(ctx, command, func() error {
+				exitCode, err = newState.ExitCode(ctx)
+				return err
+			})
+			if err != nil {
+				env.emit(EventExecFinished, map[string]any{"command": command, "error": err.Error(), "duration_ms": time.Since(startedAt).Milliseconds()})
+				return nil, "", "", 0, fmt.Errorf("failed to get exit code: %w", err)
+			}
+			env.emit(EventExecFinished, map[string]any{"command": command, "exit_code": exitCode, "duration_ms": time.Since(startedAt).Milliseconds()})
+
+			stdout, err = newState.Stdout(ctx)
+			if err != nil {
+				return nil, "", "", exitCode, fmt.Errorf("failed to get stdout: %w", err)
+			}
+
+			stderr, err = newState.Stderr(ctx)
+			if err != nil {
+				return nil, stdout, "", exitCode, fmt.Errorf("failed to get stderr: %w", err)
+			}
+		}
+		newState = withoutInput(newState, input)
+
+		if exitCode == 0 || answers == maxPromptAnswers {
+			return newState, stdout, stderr, exitCode, nil
+		}
+		// A command stuck on a prompt is stopped rather than answered once it timed out.
+		if timeout != nil && exitCode == TimedOutExitCode {
+			env.Notes.Add("Command timed out after %s: %s", timeout.Duration(), command)
+			return newState, stdout, stderr, exitCode, nil
+		}
+		if !installed {
+			if withCommand, ok := env.installMissingCommand(ctx, container, exitCode, stderr); ok {
+				container, installed = withCommand, true
+				continue
+			}
+		}
+		next, ok, err := env.answerPrompt(ctx, command, input, stdout, stderr)
+		if err != nil {
+			return nil, stdout, stderr, exitCode, err
+		}
+		if !ok {
+			return newState, stdout, stderr, exitCode, nil
+		}
+		input = next
+	}
+}
+
 func (env *Environment) RunBackground(ctx context.Context, command, shell string, ports []int, useEntrypoint bool) (EndpointMappings, error) {
 	args := []string{}
 	if command != "" {
 		args = []string{shell, "-c", command}
 	}
+	if useEntrypoint && env.State.Config.Hardened {
+		return nil, errHardenedEntrypoint
+	}
+	if !useEntrypoint {
+		args = env.State.Config.execArgs(args)
+	}
 	displayCommand := command + " &"
 	serviceState := env.container()
 
@@ -370,6 +647,11 @@ func (env *Environment) RunBackground(ctx context.Context, command, shell string
 	}
 
 	env.Notes.AddCommand(displayCommand, 0, "", "")
+	env.emit(EventExecStarted, map[string]any{"command": command, "background": true})
+
+	env.mu.Lock()
+	env.background = append(env.background, svc)
+	env.mu.Unlock()
 
 	endpoints := EndpointMappings{}
 	for _, port := range ports {
@@ -410,8 +692,14 @@ func (env *Environment) RunBackground(ctx context.Context, command, shell string
 	return endpoints, nil
 }
 
-func (env *Environment) Terminal(ctx context.Context) error {
-	container := env.container()
+// Terminal opens an interactive shell in the environment. The workdir is a copy the session can change:
+// it's returned once the session ends, to be merged into the environment with MergeTerminal. Changes made
+// outside the workdir are discarded.
+func (env *Environment) Terminal(ctx context.Context) (*TerminalSession, error) {
+	container, session, err := env.terminalContainer()
+	if err != nil {
+		return nil, err
+	}
 	var cmd []string
 	var sourceRC string
 	if shells, err := container.File("/etc/shells").Contents(ctx); err == nil {
@@ -435,14 +723,57 @@ func (env *Environment) Terminal(ctx context.Context) error {
 		cmd = []string{"sh"}
 	}
 	if _, err := container.Terminal(dagger.ContainerTerminalOpts{
-		ExperimentalPrivilegedNesting: true,
-		Cmd:                           cmd,
+		ExperimentalPrivilegedNesting: env.State.Config.privilegedNesting(),
+		Cmd:                           env.State.Config.execArgs(cmd),
 	}).Sync(ctx); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	if err := session.capture(ctx, container, env.State.Config.Workdir); err != nil {
+		return nil, fmt.Errorf("failed to copy the workdir of the terminal: %w", err)
+	}
+	return session, nil
+}
+
+// Running reports whether the environment has services or background commands running.
+func (env *Environment) Running() bool {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	return len(env.Services) > 0 || len(env.background) > 0 || env.docker != nil
+}
+
+// Stop stops the environment's services, Docker daemon and background commands, releasing their resources.
+// The environment's container state is unaffected: services are started again when they're next needed,
+// but background commands must be started again.
+func (env *Environment) Stop(ctx context.Context) error {
+	env.mu.Lock()
+	services := make([]*dagger.Service, 0, len(env.Services)+len(env.background))
+	for _, service := range env.Services {
+		services = append(services, service.svc)
+	}
+	services = append(services, env.background...)
+	if env.docker != nil {
+		services = append(services, env.docker)
+	}
+	env.Services = nil
+	env.background = nil
+	env.docker = nil
+	env.mu.Unlock()
+
+	var errs []error
+	for _, svc := range services {
+		if _, err := svc.Stop(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (env *Environment) Checkpoint(ctx context.Context, target string) (string, error) {
-	return env.container().Publish(ctx, target)
+	ref, err := env.container().Publish(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	env.emit(EventCheckpoint, map[string]any{"ref": ref})
+	return ref, nil
 }
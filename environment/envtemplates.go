@@ -0,0 +1,90 @@
+package environment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// envTemplatesDir holds the environment templates of a repository, in its configuration directory.
+const envTemplatesDir = "templates"
+
+// EnvironmentTemplate is a reusable variation of the repository's configuration, such as a base image with
+// its setup commands, secrets and services, that environments are created from by name. Templates are
+// .container-use/templates/<name>.json files.
+type EnvironmentTemplate struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Config holds the settings of the template. They're layered on the repository's configuration: the
+	// settings the template has replace the repository's, the others are kept.
+	Config json.RawMessage `json:"config"`
+}
+
+// EnvironmentTemplatesDir returns the directory of the environment templates of the repository at baseDir.
+func EnvironmentTemplatesDir(baseDir string) string {
+	return filepath.Join(baseDir, configDir, envTemplatesDir)
+}
+
+// EnvironmentTemplates returns the environment templates of the repository at baseDir, sorted by name.
+func EnvironmentTemplates(baseDir string) ([]*EnvironmentTemplate, error) {
+	entries, err := os.ReadDir(EnvironmentTemplatesDir(baseDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var templates []*EnvironmentTemplate
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		tmpl, err := LoadEnvironmentTemplate(baseDir, name)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// LoadEnvironmentTemplate returns the environment template of the repository at baseDir with the given name.
+func LoadEnvironmentTemplate(baseDir, name string) (*EnvironmentTemplate, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid template name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(EnvironmentTemplatesDir(baseDir), name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("unknown environment template %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &EnvironmentTemplate{}
+	if err := json.Unmarshal(data, tmpl); err != nil {
+		return nil, fmt.Errorf("invalid environment template %q: %w", name, err)
+	}
+	tmpl.Name = name
+	// Invalid settings fail when the template is loaded rather than when it's used.
+	if err := tmpl.Apply(DefaultConfig()); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Apply layers the settings of the template on config.
+func (t *EnvironmentTemplate) Apply(config *EnvironmentConfig) error {
+	if len(t.Config) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(t.Config, config); err != nil {
+		return fmt.Errorf("invalid environment template %q: %w", t.Name, err)
+	}
+	return nil
+}
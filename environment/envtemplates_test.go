@@ -0,0 +1,63 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironmentTemplates(t *testing.T) {
+	baseDir := t.TempDir()
+
+	templates, err := EnvironmentTemplates(baseDir)
+	require.NoError(t, err)
+	assert.Empty(t, templates)
+
+	dir := EnvironmentTemplatesDir(baseDir)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	writeTemplate := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	writeTemplate("postgres.json", `{
+		"description": "Go with a Postgres database",
+		"config": {
+			"base_image": "golang:1.24",
+			"setup_commands": ["apt-get update"],
+			"services": [{"name": "db", "image": "postgres:16", "exposed_ports": [5432]}]
+		}
+	}`)
+	writeTemplate("browser.json", `{"config": {"secrets": ["TOKEN=env://TOKEN"]}}`)
+	writeTemplate("README.md", "not a template")
+
+	templates, err = EnvironmentTemplates(baseDir)
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+	assert.Equal(t, "browser", templates[0].Name)
+	assert.Equal(t, "postgres", templates[1].Name)
+	assert.Equal(t, "Go with a Postgres database", templates[1].Description)
+
+	// The template's settings replace the repository's, the others are kept.
+	config := DefaultConfig()
+	config.InstallCommands = []string{"go mod download"}
+	config.SetupCommands = []string{"apt-get install -y git"}
+	require.NoError(t, templates[1].Apply(config))
+	assert.Equal(t, "golang:1.24", config.BaseImage)
+	assert.Equal(t, []string{"apt-get update"}, config.SetupCommands)
+	assert.Equal(t, []string{"go mod download"}, config.InstallCommands)
+	require.Len(t, config.Services, 1)
+	assert.Equal(t, []int{5432}, config.Services[0].ExposedPorts)
+
+	_, err = LoadEnvironmentTemplate(baseDir, "mysql")
+	assert.ErrorContains(t, err, `unknown environment template "mysql"`)
+	_, err = LoadEnvironmentTemplate(baseDir, "../environment")
+	assert.ErrorContains(t, err, "invalid template name")
+
+	writeTemplate("broken.json", `{"config": {"setup_commands": "apt-get update"}}`)
+	_, err = LoadEnvironmentTemplate(baseDir, "broken")
+	assert.ErrorContains(t, err, `invalid environment template "broken"`)
+	_, err = EnvironmentTemplates(baseDir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package environment
+
+// Lifecycle events emitted by environments.
+const (
+	EventExecStarted  = "exec_started"
+	EventExecFinished = "exec_finished"
+	EventCheckpoint   = "checkpoint"
+	// EventImageExported reports the export of the environment's container as an image, to the host's image
+	// store, a tarball or a registry.
+	EventImageExported = "image_exported"
+	// EventStateChanged reports the changes of a command to the configured snapshot paths.
+	EventStateChanged = "state_changed"
+	// EventRetry reports an operation retried after a transient error, such as an image pull or a command
+	// the engine failed to run.
+	EventRetry = "retry"
+	// EventInputPrompted reports a command that failed on a prompt for input (without the answer).
+	EventInputPrompted = "input_prompted"
+	// EventImagePullStarted, EventImagePullProgress, EventImagePulled and EventSetupStep report the
+	// progress of building an environment. They're only emitted to OnEvent listeners given to New.
+	EventImagePullStarted  = "image_pull_started"
+	EventImagePullProgress = "image_pull_progress"
+	EventImagePulled       = "image_pulled"
+	EventSetupStep         = "setup_step_complete"
+)
+
+// EventFunc receives lifecycle events emitted by an environment.
+type EventFunc func(eventType string, data map[string]any)
+
+func (env *Environment) emit(eventType string, data map[string]any) {
+	if env.OnEvent != nil {
+		env.OnEvent(eventType, data)
+	}
+}
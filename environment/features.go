@@ -0,0 +1,161 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+const (
+	orasImage        = "ghcr.io/oras-project/oras:v1.2.3"
+	featuresDir      = "/tmp/container-use-features"
+	featureMetadata  = "devcontainer-feature.json"
+	featureInstaller = "install.sh"
+)
+
+var (
+	featureOptionInvalidChars = regexp.MustCompile(`[^\w]`)
+	featureOptionLeading      = regexp.MustCompile(`^[\d_]+`)
+)
+
+// FeatureConfig is a dev container feature (https://containers.dev/implementors/features/) to install.
+type FeatureConfig struct {
+	// Ref is the OCI reference of the feature, e.g. ghcr.io/devcontainers/features/node:1.
+	Ref string `json:"ref"`
+	// Options are the feature's options, e.g. version=20.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+type FeatureConfigs []*FeatureConfig
+
+func (fc FeatureConfigs) Get(ref string) *FeatureConfig {
+	for _, cfg := range fc {
+		if cfg.Ref == ref {
+			return cfg
+		}
+	}
+	return nil
+}
+
+// featureManifest is the subset of devcontainer-feature.json used to install a feature.
+type featureManifest struct {
+	ID      string `json:"id"`
+	Options map[string]struct {
+		Default any `json:"default"`
+	} `json:"options"`
+	ContainerEnv map[string]string `json:"containerEnv"`
+}
+
+// featureOptionEnv returns the environment variable name for a feature option, as defined by the spec.
+func featureOptionEnv(option string) string {
+	name := featureOptionInvalidChars.ReplaceAllString(option, "_")
+	name = featureOptionLeading.ReplaceAllString(name, "_")
+	return strings.ToUpper(name)
+}
+
+// featureInstallEnv returns the variables passed to the feature's install script:
+// option defaults from the manifest, overridden by the configured options.
+func featureInstallEnv(manifest *featureManifest, options map[string]string) map[string]string {
+	vars := map[string]string{
+		"_REMOTE_USER":         "root",
+		"_REMOTE_USER_HOME":    "/root",
+		"_CONTAINER_USER":      "root",
+		"_CONTAINER_USER_HOME": "/root",
+	}
+	for option, spec := range manifest.Options {
+		if spec.Default != nil {
+			vars[featureOptionEnv(option)] = fmt.Sprint(spec.Default)
+		}
+	}
+	for option, value := range options {
+		vars[featureOptionEnv(option)] = value
+	}
+	return vars
+}
+
+// fetchFeature pulls a feature's OCI artifact and returns its extracted contents.
+func (env *Environment) fetchFeature(feature *FeatureConfig) *dagger.Directory {
+	artifact := env.dag.Container().
+		From(orasImage).
+		WithWorkdir("/artifact").
+		WithExec([]string{"oras", "pull", feature.Ref}).
+		Directory("/artifact")
+
+	return env.dag.Container().
+		From(alpineImage).
+		WithMountedDirectory("/artifact", artifact).
+		WithExec([]string{"sh", "-c", `mkdir -p /feature && for f in /artifact/*; do tar -xf "$f" -C /feature; done`}).
+		Directory("/feature")
+}
+
+// featureInstall is a fetched feature ready to be installed.
+type featureInstall struct {
+	source   *dagger.Directory
+	dir      string
+	command  string
+	manifest *featureManifest
+}
+
+// prepareFeature fetches a feature and builds the command installing it with the configured options.
+func (env *Environment) prepareFeature(ctx context.Context, index int, feature *FeatureConfig) (*featureInstall, error) {
+	source := env.fetchFeature(feature)
+
+	contents, err := source.File(featureMetadata).Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feature %s: %w", feature.Ref, err)
+	}
+	manifest := &featureManifest{}
+	if err := json.Unmarshal([]byte(contents), manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s in feature %s: %w", featureMetadata, feature.Ref, err)
+	}
+	for option := range feature.Options {
+		if _, ok := manifest.Options[option]; !ok {
+			return nil, fmt.Errorf("feature %s has no option %q", feature.Ref, option)
+		}
+	}
+
+	dir := fmt.Sprintf("%s/%d-%s", featuresDir, index, manifest.ID)
+	vars := featureInstallEnv(manifest, feature.Options)
+
+	// Options are passed inline rather than as container variables so they don't leak into the environment.
+	var command strings.Builder
+	fmt.Fprintf(&command, "cd %s && chmod +x %s && ", dir, featureInstaller)
+	for _, name := range sortedKeys(vars) {
+		fmt.Fprintf(&command, "%s=%s ", name, shellQuote(vars[name]))
+	}
+	fmt.Fprintf(&command, "./%s", featureInstaller)
+
+	return &featureInstall{
+		source:   source,
+		dir:      dir,
+		command:  command.String(),
+		manifest: manifest,
+	}, nil
+}
+
+// finish removes the installer from the container and applies the variables the feature declares.
+func (fi *featureInstall) finish(container *dagger.Container) *dagger.Container {
+	container = container.WithoutDirectory(fi.dir)
+	for _, name := range sortedKeys(fi.manifest.ContainerEnv) {
+		container = container.WithEnvVariable(name, fi.manifest.ContainerEnv[name], dagger.ContainerWithEnvVariableOpts{Expand: true})
+	}
+	return container
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,151 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"dagger.io/dagger"
+)
+
+// Actions of the operations of a file batch.
+const (
+	FileCreate = "create"
+	FileUpdate = "update"
+	FileDelete = "delete"
+	FileRename = "rename"
+)
+
+// FileOperation is an operation of a file batch, see FileBatch.
+type FileOperation struct {
+	// Action is create, update, delete or rename.
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	// To is the new path of a renamed file.
+	To string `json:"to,omitempty"`
+	// Contents are the contents of a created or updated file. A renamed file gets them when they're set,
+	// and keeps its own otherwise.
+	Contents *string `json:"contents,omitempty"`
+}
+
+func (op *FileOperation) String() string {
+	if op.Action == FileRename {
+		return fmt.Sprintf("rename %s to %s", op.Path, op.To)
+	}
+	return fmt.Sprintf("%s %s", op.Action, op.Path)
+}
+
+// Validate checks the operation is complete, without looking at the files it applies to.
+func (op *FileOperation) Validate() error {
+	if !slices.Contains([]string{FileCreate, FileUpdate, FileDelete, FileRename}, op.Action) {
+		return fmt.Errorf("unknown action %q: must be one of create, update, delete or rename", op.Action)
+	}
+	if op.Path == "" {
+		return fmt.Errorf("%s: missing path", op.Action)
+	}
+	switch op.Action {
+	case FileCreate, FileUpdate:
+		if op.Contents == nil {
+			return fmt.Errorf("%s %s: missing contents", op.Action, op.Path)
+		}
+	case FileDelete:
+		if op.Contents != nil {
+			return fmt.Errorf("delete %s: a deleted file has no contents", op.Path)
+		}
+	case FileRename:
+		if op.To == "" {
+			return fmt.Errorf("rename %s: missing new path", op.Path)
+		}
+	}
+	return nil
+}
+
+// FileBatch applies file operations in order, all or nothing. The whole batch is checked before any
+// operation is applied: created files mustn't exist, updated, deleted and renamed files must, taking the
+// previous operations of the batch into account. The operations are then applied to the container at once,
+// so a batch that fails leaves the environment as it was. Paths are relative to the workdir unless absolute.
+func (env *Environment) FileBatch(ctx context.Context, explanation string, operations []FileOperation) error {
+	if len(operations) == 0 {
+		return errors.New("no file operations")
+	}
+
+	base := env.container()
+	// Whether files exist once the previous operations of the batch are applied.
+	existing := map[string]bool{}
+	exists := func(p string) (bool, error) {
+		if exists, ok := existing[p]; ok {
+			return exists, nil
+		}
+		exists, err := base.Exists(ctx, p, dagger.ContainerExistsOpts{ExpectedType: dagger.ExistsTypeRegularType})
+		if err != nil {
+			return false, fmt.Errorf("failed to check %s: %w", p, err)
+		}
+		return exists, nil
+	}
+
+	container := base
+	owner := env.State.Config.fileOwner()
+	var notes []string
+	for i, op := range operations {
+		if err := op.Validate(); err != nil {
+			return fmt.Errorf("operation %d: %w", i+1, err)
+		}
+		target := env.containerPath(op.Path)
+		paths := []string{target}
+		if op.Action == FileRename {
+			paths = append(paths, env.containerPath(op.To))
+		}
+		for _, p := range paths {
+			if err := env.validateNotSubmoduleFile(p); err != nil {
+				return fmt.Errorf("operation %d: %w", i+1, err)
+			}
+		}
+
+		found, err := exists(target)
+		if err != nil {
+			return err
+		}
+		switch {
+		case op.Action == FileCreate && found:
+			return fmt.Errorf("operation %d: cannot create %s: the file already exists, update it instead", i+1, op.Path)
+		case op.Action != FileCreate && !found:
+			return fmt.Errorf("operation %d: cannot %s %s: no such file", i+1, op.Action, op.Path)
+		}
+
+		switch op.Action {
+		case FileCreate, FileUpdate:
+			container = container.WithNewFile(target, *op.Contents, dagger.ContainerWithNewFileOpts{Owner: owner})
+			existing[target] = true
+			notes = append(notes, fmt.Sprintf("Write %s", target))
+		case FileDelete:
+			container = container.WithoutFile(target)
+			existing[target] = false
+			notes = append(notes, fmt.Sprintf("Delete %s", target))
+		case FileRename:
+			destination := paths[1]
+			if found, err := exists(destination); err != nil {
+				return err
+			} else if found {
+				return fmt.Errorf("operation %d: cannot rename %s to %s: the file already exists, delete it first", i+1, op.Path, op.To)
+			}
+			if op.Contents != nil {
+				container = container.WithNewFile(destination, *op.Contents, dagger.ContainerWithNewFileOpts{Owner: owner})
+			} else {
+				container = container.WithFile(destination, container.File(target), dagger.ContainerWithFileOpts{Owner: owner})
+			}
+			container = container.WithoutFile(target)
+			existing[target] = false
+			existing[destination] = true
+			notes = append(notes, fmt.Sprintf("Rename %s to %s", target, destination))
+		}
+	}
+
+	if err := env.apply(ctx, container); err != nil {
+		return fmt.Errorf("failed applying file operations, skipping git propagation: %w", err)
+	}
+	for _, note := range notes {
+		env.Notes.Add("%s", note)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileOperationValidate(t *testing.T) {
+	contents := "package main\n"
+	assert.NoError(t, (&FileOperation{Action: FileCreate, Path: "main.go", Contents: &contents}).Validate())
+	assert.NoError(t, (&FileOperation{Action: FileDelete, Path: "main.go"}).Validate())
+	assert.NoError(t, (&FileOperation{Action: FileRename, Path: "main.go", To: "cmd/main.go"}).Validate())
+	assert.NoError(t, (&FileOperation{Action: FileRename, Path: "main.go", To: "cmd/main.go", Contents: &contents}).Validate())
+
+	assert.ErrorContains(t, (&FileOperation{Action: "move", Path: "main.go"}).Validate(), "unknown action")
+	assert.ErrorContains(t, (&FileOperation{Action: FileUpdate}).Validate(), "missing path")
+	assert.ErrorContains(t, (&FileOperation{Action: FileUpdate, Path: "main.go"}).Validate(), "missing contents")
+	assert.ErrorContains(t, (&FileOperation{Action: FileDelete, Path: "main.go", Contents: &contents}).Validate(), "no contents")
+	assert.ErrorContains(t, (&FileOperation{Action: FileRename, Path: "main.go"}).Validate(), "missing new path")
+
+	assert.Equal(t, "rename main.go to cmd/main.go", (&FileOperation{Action: FileRename, Path: "main.go", To: "cmd/main.go"}).String())
+	assert.Equal(t, "delete main.go", (&FileOperation{Action: FileDelete, Path: "main.go"}).String())
+}
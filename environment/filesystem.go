@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"dagger.io/dagger"
 	godiffpatch "github.com/sourcegraph/go-diff-patch"
 )
 
@@ -46,7 +47,9 @@ func (env *Environment) FileWrite(ctx context.Context, explanation, targetFile,
 		return err
 	}
 
-	err := env.apply(ctx, env.container().WithNewFile(targetFile, contents))
+	err := env.apply(ctx, env.container().WithNewFile(targetFile, contents, dagger.ContainerWithNewFileOpts{
+		Owner: env.State.Config.fileOwner(),
+	}))
 	if err != nil {
 		return fmt.Errorf("failed applying file write, skipping git propagation: %w", err)
 	}
@@ -126,7 +129,9 @@ func (env *Environment) FileEdit(ctx context.Context, explanation, targetFile, s
 	// the entire contents
 	patch := godiffpatch.GeneratePatch(targetFile, contents, newContents)
 	ctr := env.container()
-	err = env.apply(ctx, ctr.WithDirectory(".", ctr.Directory(".").WithPatch(patch)))
+	err = env.apply(ctx, ctr.WithDirectory(".", ctr.Directory(".").WithPatch(patch), dagger.ContainerWithDirectoryOpts{
+		Owner: env.State.Config.fileOwner(),
+	}))
 	if err != nil {
 		return fmt.Errorf("failed applying file edit, skipping git propagation: %w", err)
 	}
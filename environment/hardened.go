@@ -0,0 +1,97 @@
+package environment
+
+import (
+	_ "embed"
+	"errors"
+
+	"dagger.io/dagger"
+)
+
+// sandboxUser owns the workdir of hardened environments and runs their commands. It's unprivileged,
+// so the system directories, owned by root, are read-only to the commands.
+const (
+	sandboxUser = "65534:65534"
+	sandboxHome = "/home/sandbox"
+	// seccompHelper installs the seccomp filter of hardened environments, then execs the command.
+	seccompHelper = "/usr/local/libexec/container-use/seccomp"
+	goImage       = "golang:1.24-alpine"
+)
+
+//go:embed seccomp/main.go
+var seccompSource string
+
+// hardenScript checks the image can drop privileges and hands the workdir ($1) to the sandbox user.
+const hardenScript = `command -v setpriv >/dev/null || { echo "hardened environments need setpriv: install util-linux (or setpriv on Alpine) with a setup command" >&2; exit 1; }
+mkdir -p ` + sandboxHome + ` && chown -R ` + sandboxUser + ` "$1" ` + sandboxHome
+
+// validateHardened returns an error if the configuration needs privileges hardened environments don't grant.
+func (config *EnvironmentConfig) validateHardened() error {
+	if !config.Hardened {
+		return nil
+	}
+	if config.Docker != nil {
+		return errors.New("docker can't be enabled in hardened environments: the Docker daemon needs root capabilities")
+	}
+	return nil
+}
+
+// withHardening wraps exec args so they run as the sandbox user, with no capabilities, no way to gain
+// privileges (no_new_privs, e.g. through setuid binaries such as sudo) and under the seccomp filter, which
+// denies the syscalls that create namespaces, mount filesystems or load kernel code. Returns args unchanged
+// when the environment isn't hardened.
+func (config *EnvironmentConfig) withHardening(args []string) []string {
+	if !config.Hardened || len(args) == 0 {
+		return args
+	}
+	return append([]string{
+		"setpriv",
+		"--reuid=65534", "--regid=65534", "--clear-groups",
+		"--inh-caps=-all", "--bounding-set=-all",
+		"--no-new-privs",
+		"--",
+		seccompHelper,
+	}, args...)
+}
+
+// execArgs wraps the args of the environment's commands with the network overrides, the resource limits and
+// the hardening. The network overrides and the limits are applied first, as root.
+func (config *EnvironmentConfig) execArgs(args []string) []string {
+	return config.withNetworkOverrides(config.withResourceLimits(config.withHardening(args)))
+}
+
+// privilegedNesting reports whether commands may call the engine's API, e.g. to run dagger from the environment.
+// Hardened environments may not.
+func (config *EnvironmentConfig) privilegedNesting() bool {
+	return !config.Hardened
+}
+
+// fileOwner returns the owner of the files written by tools, or "" to keep the engine's default (root).
+func (config *EnvironmentConfig) fileOwner() string {
+	if config.Hardened {
+		return sandboxUser
+	}
+	return ""
+}
+
+// seccompBinary builds the seccomp helper for the engine's platform.
+func (env *Environment) seccompBinary() *dagger.File {
+	return env.dag.Container().
+		From(goImage).
+		WithWorkdir("/src").
+		WithNewFile("/src/main.go", seccompSource).
+		WithEnvVariable("CGO_ENABLED", "0").
+		WithExec([]string{"go", "build", "-trimpath", "-o", "/out/seccomp", "main.go"}).
+		File("/out/seccomp")
+}
+
+// harden finishes building a hardened environment, once the setup and install commands ran as root.
+func (env *Environment) harden(container *dagger.Container) *dagger.Container {
+	return container.
+		WithFile(seccompHelper, env.seccompBinary(), dagger.ContainerWithFileOpts{Permissions: 0o755}).
+		WithExec([]string{"sh", "-c", hardenScript, "sh", env.State.Config.Workdir}).
+		WithEnvVariable("HOME", sandboxHome)
+}
+
+// errHardenedEntrypoint is returned when a hardened environment is asked to run a command through the
+// image's entrypoint, which would run it with root privileges.
+var errHardenedEntrypoint = errors.New("hardened environments can't run commands through the image entrypoint")
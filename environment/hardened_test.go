@@ -0,0 +1,52 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHardening(t *testing.T) {
+	config := DefaultConfig()
+	args := []string{"sh", "-c", "make test"}
+	assert.Equal(t, args, config.withHardening(args))
+	assert.True(t, config.privilegedNesting())
+	assert.Empty(t, config.fileOwner())
+
+	config.Hardened = true
+	hardened := config.withHardening(args)
+	assert.Equal(t, "setpriv", hardened[0])
+	assert.Contains(t, hardened, "--no-new-privs")
+	assert.Contains(t, hardened, "--bounding-set=-all")
+	// The seccomp filter is installed once privileges are dropped, by the command setpriv runs.
+	assert.Equal(t, []string{"--", seccompHelper}, hardened[len(hardened)-len(args)-2:len(hardened)-len(args)])
+	assert.Equal(t, args, hardened[len(hardened)-len(args):])
+	assert.Empty(t, config.withHardening(nil))
+	assert.False(t, config.privilegedNesting())
+	assert.Equal(t, sandboxUser, config.fileOwner())
+}
+
+func TestExecArgsHardenedWithNetworkOverrides(t *testing.T) {
+	config := DefaultConfig()
+	config.Hardened = true
+	config.Hosts = KVList{"db.internal=10.0.0.5"}
+
+	// The network overrides write /etc/hosts, so they must run before privileges are dropped.
+	args := config.execArgs([]string{"sh", "-c", "curl db.internal"})
+	require.Greater(t, len(args), 8)
+	assert.Equal(t, "sh", args[0])
+	assert.Equal(t, "setpriv", args[7])
+}
+
+func TestValidateHardened(t *testing.T) {
+	config := DefaultConfig()
+	config.Docker = &DockerConfig{}
+	require.NoError(t, config.validateHardened())
+
+	config.Hardened = true
+	assert.ErrorContains(t, config.validateHardened(), "docker")
+
+	config.Docker = nil
+	assert.NoError(t, config.validateHardened())
+}
@@ -0,0 +1,204 @@
+package environment
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// Host file modes.
+const (
+	// HostFileCopy copies the file into the environment, after redaction.
+	HostFileCopy = "copy"
+	// HostFileSecret mounts the file as a read-only secret: its content stays out of the environment's
+	// container state and is scrubbed from command output, but can't be redacted.
+	HostFileSecret = "secret"
+)
+
+const redactedPlaceholder = "REDACTED"
+
+// HostFile is a file of the host provided to new environments, such as ~/.netrc, ~/.npmrc or a kube config,
+// so agents have working credentials and tool configuration.
+type HostFile struct {
+	// Source is the path of the file on the host. A leading ~/ refers to the user's home directory.
+	Source string `json:"source"`
+	// Target is the path of the file in the environment. It defaults to Source, with ~/ mapped to /root/.
+	Target string `json:"target,omitempty"`
+	// Mode is copy (default) or secret.
+	Mode string `json:"mode,omitempty"`
+	// Redact lists regular expressions whose matches are replaced with REDACTED before the file is copied.
+	// If an expression has groups, only the groups are replaced, e.g. `password (\S+)`.
+	Redact []string `json:"redact,omitempty"`
+	// Prompt asks the user whether to provide the file every time an environment is created. Files that
+	// don't prompt are only provided without asking once the user trusted them, since the configuration
+	// is committed with the repository.
+	Prompt bool `json:"prompt,omitempty"`
+}
+
+func (file *HostFile) mode() string {
+	if file.Mode == "" {
+		return HostFileCopy
+	}
+	return file.Mode
+}
+
+// TargetPath returns the path of the file in the environment.
+func (file *HostFile) TargetPath() string {
+	if file.Target != "" {
+		return file.Target
+	}
+	if rest, ok := strings.CutPrefix(file.Source, "~/"); ok {
+		return path.Join("/root", filepath.ToSlash(rest))
+	}
+	return filepath.ToSlash(file.Source)
+}
+
+// SourcePath returns the absolute path of the file on the host.
+func (file *HostFile) SourcePath() (string, error) {
+	rest, ok := strings.CutPrefix(file.Source, "~/")
+	if !ok {
+		return filepath.Abs(file.Source)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, rest), nil
+}
+
+// Validate checks the host file configuration.
+func (file *HostFile) Validate() error {
+	if file.Source == "" {
+		return fmt.Errorf("host file source is required")
+	}
+	if !path.IsAbs(file.TargetPath()) {
+		return fmt.Errorf("host file target %q must be an absolute path", file.TargetPath())
+	}
+	switch file.mode() {
+	case HostFileCopy:
+	case HostFileSecret:
+		if len(file.Redact) > 0 {
+			return fmt.Errorf("host file %s: secret files can't be redacted, use the copy mode", file.Source)
+		}
+	default:
+		return fmt.Errorf("unknown host file mode %q: must be %s or %s", file.Mode, HostFileCopy, HostFileSecret)
+	}
+	for _, pattern := range file.Redact {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("host file %s: invalid redact pattern: %w", file.Source, err)
+		}
+	}
+	return nil
+}
+
+func (file *HostFile) String() string {
+	s := fmt.Sprintf("%s -> %s (%s", file.Source, file.TargetPath(), file.mode())
+	if len(file.Redact) > 0 {
+		s += fmt.Sprintf(", %d redact patterns", len(file.Redact))
+	}
+	if file.Prompt {
+		s += ", prompt"
+	}
+	return s + ")"
+}
+
+// RedactContent replaces the matches of the file's redact patterns in content.
+func (file *HostFile) RedactContent(content string) (string, error) {
+	for _, pattern := range file.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		content = redact(re, content)
+	}
+	return content, nil
+}
+
+func redact(re *regexp.Regexp, content string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllString(content, redactedPlaceholder)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(content, -1) {
+		for group := 1; group <= re.NumSubexp(); group++ {
+			start, end := match[2*group], match[2*group+1]
+			if start < last {
+				// Unmatched or nested in an already redacted group.
+				continue
+			}
+			b.WriteString(content[last:start])
+			b.WriteString(redactedPlaceholder)
+			last = end
+		}
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+// HostFiles is the list of host files provided to environments.
+type HostFiles []*HostFile
+
+// Find returns the host file with the given source or target, or nil.
+func (files HostFiles) Find(name string) *HostFile {
+	for _, file := range files {
+		if file.Source == name || file.TargetPath() == name {
+			return file
+		}
+	}
+	return nil
+}
+
+// withHostFiles provides the configured host files to the container.
+// Files missing from the host are skipped: they may only exist on some machines.
+func (env *Environment) withHostFiles(container *dagger.Container) (*dagger.Container, error) {
+	for _, file := range env.State.Config.HostFiles {
+		if err := file.Validate(); err != nil {
+			return nil, err
+		}
+		source, err := file.SourcePath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(source); os.IsNotExist(err) {
+			slog.Warn("Skipping missing host file", "environment-id", env.ID, "source", source)
+			continue
+		}
+
+		if file.mode() == HostFileSecret {
+			container = container.WithMountedSecret(file.TargetPath(), env.dag.Secret("file://"+source))
+			continue
+		}
+
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host file %s: %w", file.Source, err)
+		}
+		content, err := file.RedactContent(string(data))
+		if err != nil {
+			return nil, err
+		}
+		container = container.WithNewFile(file.TargetPath(), content, dagger.ContainerWithNewFileOpts{Permissions: 0600})
+	}
+	return container, nil
+}
+
+// Confirmed returns the files that don't prompt the user, plus the prompting files found in confirmed,
+// e.g. the files an environment was created with. It lets configuration changes apply to existing
+// environments without providing files the user declined.
+func (files HostFiles) Confirmed(confirmed HostFiles) HostFiles {
+	var kept HostFiles
+	for _, file := range files {
+		if !file.Prompt || confirmed.Find(file.Source) != nil {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,71 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// EnvironmentLabel is the image label recording the environment an exported image comes from.
+const EnvironmentLabel = "dev.container-use.environment"
+
+// ImageExport is where to export the container of an environment as an image. Exactly one of its fields
+// is set.
+type ImageExport struct {
+	// Image is the name to load the image as in the host's image store, such as Docker's.
+	Image string
+	// Tarball is the path of the OCI tarball to write on the host.
+	Tarball string
+	// Registry is the reference to push the image to.
+	Registry string
+}
+
+// Validate checks that exactly one destination is set.
+func (e ImageExport) Validate() error {
+	set := 0
+	for _, destination := range []string{e.Image, e.Tarball, e.Registry} {
+		if destination != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("expected exactly one of an image name, a tarball path or a registry reference")
+	}
+	return nil
+}
+
+// ExportImage exports the container of the environment as an image, with all it installed, to reuse it as a
+// base image or in CI. The image is labeled with the environment and revision, the commit of its files. It
+// returns the reference of the image, with its digest when pushed to a registry.
+func (env *Environment) ExportImage(ctx context.Context, export ImageExport, revision string) (string, error) {
+	if err := export.Validate(); err != nil {
+		return "", err
+	}
+
+	container := env.container().
+		WithLabel("org.opencontainers.image.title", env.State.Title).
+		WithLabel("org.opencontainers.image.created", time.Now().UTC().Format(time.RFC3339)).
+		WithLabel(EnvironmentLabel, env.ID)
+	if revision != "" {
+		container = container.WithLabel("org.opencontainers.image.revision", revision)
+	}
+
+	ref := export.Image
+	var err error
+	switch {
+	case export.Image != "":
+		err = container.ExportImage(ctx, export.Image)
+	case export.Tarball != "":
+		ref = export.Tarball
+		_, err = container.Export(ctx, export.Tarball, dagger.ContainerExportOpts{MediaTypes: dagger.ImageMediaTypesOcimediaTypes})
+	default:
+		ref, err = container.Publish(ctx, export.Registry)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to export the image of environment %s: %w", env.ID, err)
+	}
+	env.emit(EventImageExported, map[string]any{"ref": ref})
+	return ref, nil
+}
@@ -0,0 +1,15 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageExportValidate(t *testing.T) {
+	assert.NoError(t, ImageExport{Image: "myapp-dev:latest"}.Validate())
+	assert.NoError(t, ImageExport{Tarball: "myapp-dev.tar"}.Validate())
+	assert.NoError(t, ImageExport{Registry: "ghcr.io/acme/myapp-dev:v1"}.Validate())
+	assert.Error(t, ImageExport{}.Validate())
+	assert.Error(t, ImageExport{Image: "myapp-dev:latest", Registry: "ghcr.io/acme/myapp-dev:v1"}.Validate())
+}
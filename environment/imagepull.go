@@ -0,0 +1,288 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+const (
+	// pullProgressInterval is how often EventImagePullProgress is emitted while pulling.
+	pullProgressInterval = time.Second
+	// manifestLookupTimeout caps looking up the layers of the base image, which never delays the pull.
+	manifestLookupTimeout = 5 * time.Second
+)
+
+// manifestMediaTypes are the manifest and index types accepted from registries.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ImageLayer is a layer of an image, as listed by its registry.
+type ImageLayer struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// imageReference is an image reference split into its registry, repository and tag or digest.
+type imageReference struct {
+	Registry   string
+	Repository string
+	Reference  string
+}
+
+// parseImageReference parses references such as "alpine:3", "ghcr.io/org/image@sha256:..." or
+// "localhost:5000/image", defaulting to Docker Hub and the latest tag like the engine.
+func parseImageReference(ref string) imageReference {
+	parsed := imageReference{Registry: "registry-1.docker.io", Reference: "latest"}
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, parsed.Reference = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, parsed.Reference = name[:i], name[i+1:]
+	}
+
+	if first, rest, found := strings.Cut(name, "/"); found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		if first != "docker.io" && first != "index.docker.io" {
+			parsed.Registry = first
+		}
+		name = rest
+	}
+	if parsed.Registry == "registry-1.docker.io" && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	parsed.Repository = name
+	return parsed
+}
+
+var bearerParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryClient looks up manifests anonymously, with a bearer token when the registry asks for one.
+type registryClient struct {
+	http  *http.Client
+	token string
+}
+
+func (c *registryClient) get(ctx context.Context, target string, accept []string) (*http.Response, error) {
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		return c.http.Do(req)
+	}
+
+	resp, err := do()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.token != "" {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if err := c.authenticate(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return do()
+}
+
+// authenticate gets an anonymous token for a Bearer challenge.
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("unsupported registry authentication %q", scheme)
+	}
+	values := url.Values{}
+	var realm string
+	for _, m := range bearerParam.FindAllStringSubmatch(params, -1) {
+		if m[1] == "realm" {
+			realm = m[2]
+		} else {
+			values.Set(m[1], m[2])
+		}
+	}
+	if realm == "" {
+		return fmt.Errorf("registry authentication without realm")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+values.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request failed: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	return nil
+}
+
+// manifest is the subset of image indexes and manifests needed to list layers.
+type manifest struct {
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+	Layers []ImageLayer `json:"layers"`
+	// digest is the digest of the manifest, from the registry's Docker-Content-Digest header.
+	digest string
+}
+
+func (c *registryClient) manifest(ctx context.Context, ref imageReference, reference string) (*manifest, error) {
+	target := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Registry, ref.Repository, reference)
+	resp, err := c.get(ctx, target, manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get manifest %s: %s", target, resp.Status)
+	}
+	m := &manifest{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(m); err != nil {
+		return nil, err
+	}
+	m.digest = resp.Header.Get("Docker-Content-Digest")
+	return m, nil
+}
+
+// ResolvedImage is an image reference resolved by its registry.
+type ResolvedImage struct {
+	// Digest is the digest the reference resolved to, the index of multi-platform images, if the registry
+	// reported it.
+	Digest string `json:"digest,omitempty"`
+	// Layers are the layers of the image for the platform of the engine.
+	Layers []ImageLayer `json:"layers"`
+}
+
+// Size returns the size of the layers of the image, what pulling it downloads when none is cached.
+func (i *ResolvedImage) Size() int64 {
+	var total int64
+	for _, layer := range i.Layers {
+		total += layer.Size
+	}
+	return total
+}
+
+// ImageLayers lists the layers of an image for the platform of the engine, assumed to be linux on the
+// host's architecture, by asking its registry anonymously.
+func ImageLayers(ctx context.Context, image string) ([]ImageLayer, error) {
+	resolved, err := ResolveImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.Layers, nil
+}
+
+// ResolveImage resolves an image reference to its digest and the layers of the platform of the engine,
+// like ImageLayers.
+func ResolveImage(ctx context.Context, image string) (*ResolvedImage, error) {
+	return (&registryClient{http: http.DefaultClient}).resolve(ctx, parseImageReference(image))
+}
+
+func (c *registryClient) resolve(ctx context.Context, ref imageReference) (*ResolvedImage, error) {
+	m, err := c.manifest(ctx, ref, ref.Reference)
+	if err != nil {
+		return nil, err
+	}
+	resolved := &ResolvedImage{Digest: m.digest}
+	if resolved.Digest == "" && strings.HasPrefix(ref.Reference, "sha256:") {
+		resolved.Digest = ref.Reference
+	}
+	if len(m.Manifests) > 0 {
+		digest := m.Manifests[0].Digest
+		for _, entry := range m.Manifests {
+			if entry.Platform.OS == "linux" && entry.Platform.Architecture == runtime.GOARCH {
+				digest = entry.Digest
+				break
+			}
+		}
+		if m, err = c.manifest(ctx, ref, digest); err != nil {
+			return nil, err
+		}
+	}
+	resolved.Layers = m.Layers
+	return resolved, nil
+}
+
+// pullBaseImage pulls the base image, reporting the image's layers, if the registry lists them, and
+// the time spent pulling every pullProgressInterval.
+func (env *Environment) pullBaseImage(ctx context.Context, container *dagger.Container) error {
+	image := env.State.Config.BaseImageDescription()
+	started := map[string]any{"image": image}
+	if env.State.Config.BaseBuild == nil {
+		lookupCtx, cancel := context.WithTimeout(ctx, manifestLookupTimeout)
+		layers, err := ImageLayers(lookupCtx, env.State.Config.BaseImage)
+		cancel()
+		if err == nil {
+			var total int64
+			for _, layer := range layers {
+				total += layer.Size
+			}
+			started["layers"] = layers
+			started["total_bytes"] = total
+		}
+	}
+
+	startedAt := time.Now()
+	env.emit(EventImagePullStarted, started)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pullProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				env.emit(EventImagePullProgress, map[string]any{"image": image, "elapsed_ms": time.Since(startedAt).Milliseconds()})
+			}
+		}
+	}()
+	err := env.retry(ctx, "pull of "+image, func() error {
+		_, err := container.Sync(ctx)
+		return err
+	})
+	close(done)
+	if err != nil {
+		return fmt.Errorf("failed to pull base image %s: %w", image, err)
+	}
+
+	pulled := map[string]any{"image": image, "duration_ms": time.Since(startedAt).Milliseconds()}
+	if total, ok := started["total_bytes"]; ok {
+		pulled["total_bytes"] = total
+	}
+	env.emit(EventImagePulled, pulled)
+	return nil
+}
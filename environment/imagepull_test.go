@@ -0,0 +1,68 @@
+package environment
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected imageReference
+	}{
+		{"alpine", imageReference{"registry-1.docker.io", "library/alpine", "latest"}},
+		{"ubuntu:24.04", imageReference{"registry-1.docker.io", "library/ubuntu", "24.04"}},
+		{"docker.io/golang:1.24", imageReference{"registry-1.docker.io", "library/golang", "1.24"}},
+		{"bitnami/redis:7.2", imageReference{"registry-1.docker.io", "bitnami/redis", "7.2"}},
+		{"ghcr.io/acme/tools/builder:v1", imageReference{"ghcr.io", "acme/tools/builder", "v1"}},
+		{"localhost:5000/app", imageReference{"localhost:5000", "app", "latest"}},
+		{"alpine@sha256:abc123", imageReference{"registry-1.docker.io", "library/alpine", "sha256:abc123"}},
+		{"alpine:3@sha256:abc123", imageReference{"registry-1.docker.io", "library/alpine:3", "sha256:abc123"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseImageReference(tt.ref))
+		})
+	}
+}
+
+func TestResolveImage(t *testing.T) {
+	registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/tools/builder/manifests/v1":
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			fmt.Fprintf(w, `{"manifests": [
+				{"digest": "sha256:other", "platform": {"os": "linux", "architecture": "s390x"}},
+				{"digest": "sha256:native", "platform": {"os": "linux", "architecture": %q}}
+			]}`, runtime.GOARCH)
+		case "/v2/tools/builder/manifests/sha256:native":
+			fmt.Fprint(w, `{"layers": [{"digest": "sha256:a", "size": 100}, {"digest": "sha256:b", "size": 23}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+	c := &registryClient{http: registry.Client()}
+	host := strings.TrimPrefix(registry.URL, "https://")
+
+	resolved, err := c.resolve(t.Context(), parseImageReference(host+"/tools/builder:v1"))
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:index", resolved.Digest)
+	assert.Equal(t, []ImageLayer{{"sha256:a", 100}, {"sha256:b", 23}}, resolved.Layers)
+	assert.EqualValues(t, 123, resolved.Size())
+
+	// Without a Docker-Content-Digest header, references by digest resolve to their digest.
+	resolved, err = c.resolve(t.Context(), parseImageReference(host+"/tools/builder@sha256:native"))
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:native", resolved.Digest)
+
+	_, err = c.resolve(t.Context(), parseImageReference(host+"/tools/missing:v1"))
+	assert.ErrorContains(t, err, "404")
+}
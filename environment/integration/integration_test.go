@@ -614,3 +614,121 @@ func TestEnvironmentConfigurationPersists(t *testing.T) {
 		})
 	})
 }
+
+// TestFileBatch verifies that file batches are applied in a single commit, all or nothing
+func TestFileBatch(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "file-batch", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := t.Context()
+		env := user.CreateEnvironment("Batch", "Testing file batches")
+		user.FileWrite(env.ID, "util.go", "package util\n", "Add util")
+		user.FileWrite(env.ID, "old.go", "package old\n", "Add old")
+
+		contents := func(s string) *string { return &s }
+		env = user.GetEnvironment(env.ID)
+		err := env.FileBatch(ctx, "Reorganize", []environment.FileOperation{
+			{Action: environment.FileRename, Path: "util.go", To: "strings.go"},
+			{Action: environment.FileUpdate, Path: "strings.go", Contents: contents("package strings\n")},
+			{Action: environment.FileCreate, Path: "strings_test.go", Contents: contents("package strings\n")},
+			{Action: environment.FileDelete, Path: "old.go"},
+		})
+		require.NoError(t, err)
+		require.NoError(t, repo.Update(ctx, env, "Reorganize"))
+
+		assert.Equal(t, "package strings\n", user.FileRead(env.ID, "strings.go"))
+		user.FileReadExpectError(env.ID, "util.go")
+		user.FileReadExpectError(env.ID, "old.go")
+		assert.Equal(t, "package strings\n", user.ReadWorktreeFile(env.ID, "strings_test.go"))
+
+		log, err := repository.RunGitCommand(ctx, user.WorktreePath(env.ID), "log", "--oneline", "-1", "--stat")
+		require.NoError(t, err)
+		assert.Contains(t, log, "Reorganize")
+		assert.Contains(t, log, "4 files changed")
+
+		// A failed operation leaves the environment as it was.
+		env = user.GetEnvironment(env.ID)
+		err = env.FileBatch(ctx, "Broken", []environment.FileOperation{
+			{Action: environment.FileCreate, Path: "new.go", Contents: contents("package new\n")},
+			{Action: environment.FileUpdate, Path: "missing.go", Contents: contents("package missing\n")},
+		})
+		assert.ErrorContains(t, err, "no such file")
+		user.FileReadExpectError(env.ID, "new.go")
+	})
+}
+
+// TestCommandEnv verifies that command variables apply to a single command without being kept
+func TestCommandEnv(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "command-env", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		config := environment.DefaultConfig()
+		config.Env.Set("LEVEL", "info")
+		ctx := repository.WithEnvVariables(repository.WithConfig(t.Context(), config), environment.KVList{"REGION=eu"})
+		env, err := repo.Create(ctx, user.dag, "Command env", "Testing command variables", "HEAD")
+		require.NoError(t, err)
+		assert.Equal(t, "eu", env.State.Config.Env.Get("REGION"), "create variables are kept in the environment")
+
+		ctx = environment.WithCommandEnv(t.Context(), environment.KVList{"LEVEL=debug", "TOKEN=secret"})
+		stdout, _, _, err := env.RunWithExitCode(ctx, "echo $LEVEL $TOKEN $REGION", "/bin/sh", false)
+		require.NoError(t, err)
+		assert.Equal(t, "debug secret eu\n", stdout)
+
+		stdout, _, _, err = env.RunWithExitCode(t.Context(), "echo $LEVEL $TOKEN", "/bin/sh", false)
+		require.NoError(t, err)
+		assert.Equal(t, "info\n", stdout, "command variables aren't kept")
+	})
+}
+
+// TestDependencies verifies that environments copy the outputs of the environments they depend on
+func TestDependencies(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "dependencies", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := t.Context()
+		build := user.CreateEnvironment("Build", "Testing dependencies")
+		user.FileWrite(build.ID, "README.md", "# Server\n", "Add readme")
+		user.RunCommand(build.ID, "mkdir -p bin && echo v1 > bin/server", "Build the server")
+
+		deps := []*environment.Dependency{
+			{Environment: build.ID, Path: "bin/server", Target: "/usr/local/bin/server"},
+			{Environment: build.ID, Target: "/deps/" + build.ID},
+		}
+		test, err := repo.Create(repository.WithDependencies(ctx, deps), user.dag, "Test", "Testing dependencies", "HEAD")
+		require.NoError(t, err)
+		assert.Equal(t, "v1\n", user.RunCommand(test.ID, "cat /usr/local/bin/server", "Read the dependency"))
+		assert.Equal(t, "# Server\n", user.RunCommand(test.ID, "cat /deps/"+build.ID+"/README.md", "Read the branch tip"))
+
+		statuses, err := repo.DependencyStatuses(ctx, test.ID)
+		require.NoError(t, err)
+		require.Len(t, statuses, 2)
+		assert.False(t, statuses[0].Stale)
+		assert.False(t, statuses[1].Stale)
+
+		user.RunCommand(build.ID, "echo v2 > bin/server", "Rebuild the server")
+		statuses, err = repo.DependencyStatuses(ctx, test.ID)
+		require.NoError(t, err)
+		assert.True(t, statuses[0].Stale, "the build environment's container changed")
+
+		test = user.GetEnvironment(test.ID)
+		refreshed, err := repo.RefreshDependencies(ctx, user.dag, test, []string{build.ID})
+		require.NoError(t, err)
+		assert.Len(t, refreshed, 2)
+		require.NoError(t, repo.Update(ctx, test, "Refresh"))
+		assert.Equal(t, "v2\n", user.RunCommand(test.ID, "cat /usr/local/bin/server", "Read the refreshed dependency"))
+
+		_, err = repo.RefreshDependencies(ctx, user.dag, test, []string{"unknown"})
+		assert.ErrorContains(t, err, "doesn't depend on unknown")
+		_, err = repo.Create(repository.WithDependencies(ctx, []*environment.Dependency{{Environment: "unknown", Target: "/deps/unknown"}}), user.dag, "Broken", "Testing dependencies", "HEAD")
+		assert.Error(t, err)
+	})
+}
@@ -231,6 +231,35 @@ func TestRepositoryCreateFromGitRef(t *testing.T) {
 	})
 }
 
+// TestRepositoryClone tests cloning an environment from its current state
+func TestRepositoryClone(t *testing.T) {
+	t.Parallel()
+	WithRepository(t, "repository-clone", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := t.Context()
+
+		source := user.CreateEnvironment("Parser", "Environment to clone")
+		user.FileWrite(source.ID, "parser.go", "package parser\n", "Add the parser")
+		user.RunCommand(source.ID, "echo installed > /opt/tool", "Install a tool outside the workdir")
+
+		clone, err := repo.Clone(ctx, user.dag, source.ID, "", "")
+		require.NoError(t, err)
+		assert.NotEqual(t, source.ID, clone.ID)
+		assert.Equal(t, "Clone of "+source.ID+": Parser", clone.State.Title)
+
+		// The clone has the environment's files and its container's state.
+		assert.Contains(t, user.FileRead(clone.ID, "parser.go"), "package parser")
+		assert.Contains(t, user.RunCommand(clone.ID, "cat /opt/tool", "Read the tool"), "installed")
+		assert.Contains(t, user.ReadWorktreeFile(clone.ID, "parser.go"), "package parser")
+
+		// Both environments then evolve independently.
+		user.FileWrite(clone.ID, "parser.go", "package parser // iterative\n", "Try another approach")
+		assert.NotContains(t, user.FileRead(source.ID, "parser.go"), "iterative")
+
+		_, err = repo.Clone(ctx, user.dag, "non-existent-env", "", "")
+		assert.Error(t, err)
+	})
+}
+
 func TestRepositoryWithSubmodule(t *testing.T) {
 	t.Parallel()
 	WithRepository(t, "repository-with-submodule", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
@@ -368,7 +397,7 @@ func TestRepositoryDiff(t *testing.T) {
 
 		// Get diff output
 		var diffBuf bytes.Buffer
-		err := repo.Diff(ctx, env.ID, &diffBuf)
+		err := repo.Diff(ctx, env.ID, repository.DiffOptions{}, &diffBuf)
 		diffOutput := diffBuf.String()
 		require.NoError(t, err, diffOutput)
 
@@ -376,7 +405,7 @@ func TestRepositoryDiff(t *testing.T) {
 		assert.Contains(t, diffOutput, "+updated content")
 
 		// Test diff with non-existent environment
-		err = repo.Diff(ctx, "non-existent-env", &diffBuf)
+		err = repo.Diff(ctx, "non-existent-env", repository.DiffOptions{}, &diffBuf)
 		assert.Error(t, err)
 	})
 }
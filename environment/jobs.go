@@ -0,0 +1,37 @@
+package environment
+
+import "time"
+
+// Job statuses.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	// JobLost is the status of jobs whose process exited without recording how the command ended, e.g. when
+	// it was killed or the host rebooted. It's never stored.
+	JobLost = "lost"
+)
+
+// Job is a command run in the background, detached from the CLI that started it.
+type Job struct {
+	ID      string `json:"id"`
+	Command string `json:"command"`
+	Shell   string `json:"shell"`
+	Status  string `json:"status"`
+	// ExitCode is the command's exit code, unset until it completed.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Error is why the command couldn't run, such as the environment's container failing to start.
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// LogPath is the host file the job's output is written to.
+	LogPath string `json:"log_path"`
+}
+
+// Duration is how long the job ran, or has been running.
+func (j *Job) Duration() time.Duration {
+	if j.FinishedAt != nil {
+		return j.FinishedAt.Sub(j.StartedAt)
+	}
+	return time.Since(j.StartedAt)
+}
@@ -0,0 +1,111 @@
+package environment
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// minResourceLimit is the smallest memory or disk limit: any less and commands couldn't even start.
+const minResourceLimit = 1 << 20
+
+// ResourceLimits caps the host resources the commands of an environment may use, so a runaway agent command
+// can't starve the host by accident. Limits of 0 are unlimited.
+//
+// The Dagger engine can't put its containers in cgroups of their own, so the limits are advisory: they're
+// applied to each process of the commands with ulimit and taskset, which commands running as root can undo.
+// See withResourceLimits.
+type ResourceLimits struct {
+	// CPUs is the number of CPUs the commands start on, rounded up to whole CPUs.
+	CPUs float64 `json:"cpus,omitempty"`
+	// Memory is the address space each process of the commands may map, in bytes.
+	Memory uint64 `json:"memory,omitempty"`
+	// Disk is the size of each file the commands may write, in bytes. Commands leaving the workdir larger
+	// than that are reported.
+	Disk uint64 `json:"disk,omitempty"`
+}
+
+// Validate checks the limits are positive, and large enough to run commands.
+func (l *ResourceLimits) Validate() error {
+	if l.CPUs < 0 || math.IsNaN(l.CPUs) || math.IsInf(l.CPUs, 0) {
+		return fmt.Errorf("invalid CPU limit %v", l.CPUs)
+	}
+	if l.Memory > 0 && l.Memory < minResourceLimit {
+		return fmt.Errorf("the memory limit must be at least 1MiB")
+	}
+	if l.Disk > 0 && l.Disk < minResourceLimit {
+		return fmt.Errorf("the disk limit must be at least 1MiB")
+	}
+	return nil
+}
+
+// IsZero reports whether the limits don't limit anything.
+func (l *ResourceLimits) IsZero() bool {
+	return l == nil || (l.CPUs == 0 && l.Memory == 0 && l.Disk == 0)
+}
+
+// Merge returns the limits with those set in override replacing them.
+func (l *ResourceLimits) Merge(override *ResourceLimits) *ResourceLimits {
+	merged := &ResourceLimits{}
+	if l != nil {
+		*merged = *l
+	}
+	if override == nil {
+		return merged
+	}
+	if override.CPUs > 0 {
+		merged.CPUs = override.CPUs
+	}
+	if override.Memory > 0 {
+		merged.Memory = override.Memory
+	}
+	if override.Disk > 0 {
+		merged.Disk = override.Disk
+	}
+	return merged
+}
+
+// limitsScript runs a command ($@, after the number of CPUs, the memory limit in KiB, the disk limit in
+// 512-byte blocks and the workdir) with the limits applied. ulimit counts in these units in both dash and
+// BusyBox's ash. CPUs are pinned with taskset, when the image has it. The command runs as a child rather
+// than with exec, so the size of the workdir can be checked once it exited.
+const limitsScript = `cpus=$1 memory=$2 disk=$3 workdir=$4
+shift 4
+if [ "$cpus" -gt 0 ]; then
+	if ! command -v taskset >/dev/null 2>&1; then
+		echo "container-use: taskset isn't installed: the CPU limit isn't applied (install util-linux with a setup command)" >&2
+	elif [ "$cpus" -lt "$(nproc 2>/dev/null || echo "$cpus")" ]; then
+		taskset -pc "0-$((cpus - 1))" $$ >/dev/null || echo "container-use: unable to apply the CPU limit" >&2
+	fi
+fi
+if [ "$memory" -gt 0 ]; then
+	ulimit -v "$memory" || echo "container-use: unable to apply the memory limit" >&2
+fi
+if [ "$disk" -gt 0 ]; then
+	ulimit -f "$disk" || echo "container-use: unable to apply the disk limit" >&2
+fi
+"$@"
+status=$?
+if [ "$disk" -gt 0 ]; then
+	used=$(du -sk "$workdir" 2>/dev/null | cut -f1)
+	if [ -n "$used" ] && [ "$used" -gt "$((disk / 2))" ]; then
+		echo "container-use: the workdir uses ${used}KiB, over the disk limit of $((disk / 2))KiB" >&2
+	fi
+fi
+exit "$status"`
+
+// withResourceLimits wraps exec args with limitsScript. Returns args unchanged when the environment
+// isn't limited.
+func (config *EnvironmentConfig) withResourceLimits(args []string) []string {
+	limits := config.Resources
+	if limits.IsZero() || len(args) == 0 {
+		return args
+	}
+	return append([]string{
+		"sh", "-c", limitsScript, "container-use-limits",
+		strconv.FormatInt(int64(math.Ceil(limits.CPUs)), 10),
+		strconv.FormatUint(limits.Memory/1024, 10),
+		strconv.FormatUint(limits.Disk/512, 10),
+		config.Workdir,
+	}, args...)
+}
@@ -0,0 +1,85 @@
+package environment
+
+import (
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceLimitsValidate(t *testing.T) {
+	assert.NoError(t, (&ResourceLimits{}).Validate())
+	assert.NoError(t, (&ResourceLimits{CPUs: 0.5, Memory: 512 << 20, Disk: 10 << 30}).Validate())
+	assert.Error(t, (&ResourceLimits{CPUs: -1}).Validate())
+	assert.Error(t, (&ResourceLimits{CPUs: math.Inf(1)}).Validate())
+	assert.ErrorContains(t, (&ResourceLimits{Memory: 1000}).Validate(), "at least 1MiB")
+	assert.ErrorContains(t, (&ResourceLimits{Disk: 1000}).Validate(), "at least 1MiB")
+}
+
+func TestResourceLimitsMerge(t *testing.T) {
+	config := &ResourceLimits{CPUs: 2, Memory: 4 << 30}
+	assert.Equal(t, &ResourceLimits{CPUs: 1, Memory: 4 << 30, Disk: 1 << 30}, config.Merge(&ResourceLimits{CPUs: 1, Disk: 1 << 30}))
+	assert.Equal(t, config, config.Merge(nil))
+	assert.Equal(t, &ResourceLimits{Disk: 1 << 30}, (*ResourceLimits)(nil).Merge(&ResourceLimits{Disk: 1 << 30}))
+	assert.True(t, (*ResourceLimits)(nil).IsZero())
+	assert.False(t, config.IsZero())
+}
+
+func TestExecArgsWithResourceLimits(t *testing.T) {
+	config := DefaultConfig()
+	args := []string{"sh", "-c", "make"}
+	assert.Equal(t, args, config.execArgs(args))
+
+	config.Hardened = true
+	config.Resources = &ResourceLimits{CPUs: 1.5, Memory: 1 << 30}
+	// The limits are applied as root, before privileges are dropped.
+	wrapped := config.execArgs(args)
+	require.Greater(t, len(wrapped), 9)
+	assert.Equal(t, []string{"sh", "-c", limitsScript, "container-use-limits", "2", "1048576", "0", "/workdir", "setpriv"}, wrapped[:9])
+}
+
+func TestResourceLimitsScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the script runs in Linux containers")
+	}
+	workdir := t.TempDir()
+	run := func(limits *ResourceLimits, args ...string) (string, int) {
+		t.Helper()
+		config := &EnvironmentConfig{Workdir: workdir, Resources: limits}
+		wrapped := config.withResourceLimits(args)
+		cmd := exec.Command(wrapped[0], wrapped[1:]...)
+		cmd.Dir = workdir
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode()
+		}
+		require.NoError(t, err)
+		return string(out), 0
+	}
+
+	out, exitCode := run(&ResourceLimits{Memory: 64 << 20}, "sh", "-c", "ulimit -v; exit 3")
+	assert.Equal(t, 3, exitCode, "the command's own exit code is kept")
+	assert.Equal(t, "65536\n", out)
+
+	// Files can't grow over the disk limit, and a workdir over it is reported.
+	limits := &ResourceLimits{Disk: 1 << 20}
+	_, exitCode = run(limits, "sh", "-c", "head -c 2097152 /dev/zero > big")
+	assert.NotZero(t, exitCode)
+	info, err := os.Stat(filepath.Join(workdir, "big"))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(1<<20))
+
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, os.WriteFile(filepath.Join(workdir, name), make([]byte, 1<<20), 0644))
+	}
+	out, exitCode = run(limits, "true")
+	assert.Zero(t, exitCode)
+	assert.Contains(t, out, "over the disk limit of 1024KiB")
+}
@@ -0,0 +1,78 @@
+package environment
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// ValidateNetwork checks that DNS servers and host entries are IP addresses
+// and that search domains and host names are valid names.
+func (config *EnvironmentConfig) ValidateNetwork() error {
+	for _, server := range config.DNSServers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid DNS server %q: must be an IP address", server)
+		}
+	}
+	for _, domain := range config.DNSSearch {
+		if !hostnamePattern.MatchString(domain) {
+			return fmt.Errorf("invalid search domain %q", domain)
+		}
+	}
+	for _, host := range config.Hosts.Keys() {
+		if !hostnamePattern.MatchString(host) {
+			return fmt.Errorf("invalid host name %q", host)
+		}
+		if ip := config.Hosts.Get(host); net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid address %q for host %s: must be an IP address", ip, host)
+		}
+	}
+	return nil
+}
+
+// networkScript applies the DNS and host overrides, then runs a command ($@, after the search domains, the
+// nameserver lines and the host entries). The overrides are passed as arguments, never pasted into the
+// script. Without nameservers, the runtime's are kept, read before /etc/resolv.conf is truncated.
+//
+// The container runtime regenerates /etc/resolv.conf and /etc/hosts for every exec, so the overrides can't
+// be baked into the container filesystem and are re-applied before each command.
+const networkScript = `search=$1 nameservers=$2 hosts=$3
+shift 3
+if [ -n "$search" ] || [ -n "$nameservers" ]; then
+	[ -n "$nameservers" ] || nameservers=$(grep '^nameserver' /etc/resolv.conf)
+	{
+		[ -z "$search" ] || printf 'search %s\n' "$search"
+		printf '%s\n' "$nameservers"
+	} > /etc/resolv.conf || echo 'container-use: unable to override /etc/resolv.conf' >&2
+fi
+if [ -n "$hosts" ]; then
+	printf '%s\n' "$hosts" >> /etc/hosts || echo 'container-use: unable to override /etc/hosts' >&2
+fi
+exec "$@"`
+
+// withNetworkOverrides wraps exec args with networkScript, so the network overrides are applied before
+// they run. Returns args unchanged when no overrides are configured.
+func (config *EnvironmentConfig) withNetworkOverrides(args []string) []string {
+	hosts := config.Hosts.Keys()
+	if (len(config.DNSServers) == 0 && len(config.DNSSearch) == 0 && len(hosts) == 0) || len(args) == 0 {
+		return args
+	}
+
+	nameservers := make([]string, len(config.DNSServers))
+	for i, server := range config.DNSServers {
+		nameservers[i] = "nameserver " + server
+	}
+	entries := make([]string, len(hosts))
+	for i, host := range hosts {
+		entries[i] = config.Hosts.Get(host) + " " + host
+	}
+	return append([]string{
+		"sh", "-c", networkScript, "container-use-network",
+		strings.Join(config.DNSSearch, " "),
+		strings.Join(nameservers, "\n"),
+		strings.Join(entries, "\n"),
+	}, args...)
+}
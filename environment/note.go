@@ -2,13 +2,15 @@ package environment
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 )
 
 type Notes struct {
-	items []string
-	mu    sync.Mutex
+	items    []string
+	commands []string
+	mu       sync.Mutex
 }
 
 func (n *Notes) Add(format string, a ...any) {
@@ -31,6 +33,18 @@ func (n *Notes) AddCommand(command string, exitCode int, stdout, stderr string)
 	}
 
 	n.Add("%s", msg)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.commands = append(n.commands, strings.TrimSpace(command))
+}
+
+// Commands returns the commands recorded since the notes were last cleared.
+func (n *Notes) Commands() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return slices.Clone(n.commands)
 }
 
 func (n *Notes) Clear() {
@@ -38,6 +52,7 @@ func (n *Notes) Clear() {
 	defer n.mu.Unlock()
 
 	n.items = []string{}
+	n.commands = nil
 }
 
 func (n *Notes) String() string {
@@ -53,6 +68,7 @@ func (n *Notes) Pop() string {
 
 	out := strings.TrimSpace(strings.Join(n.items, "\n"))
 	n.items = []string{}
+	n.commands = nil
 
 	return out
 }
@@ -0,0 +1,92 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ansiSequence matches terminal control sequences: colors and cursor movements (CSI), titles and
+// hyperlinks (OSC), and two-character escapes.
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// OutputFilter post-processes the output of commands before it's recorded in the environment's history
+// and returned, so that the relevant part of long or colored outputs isn't lost in the noise.
+type OutputFilter struct {
+	// StripANSI removes terminal control sequences, and the lines progress bars overwrite with \r.
+	StripANSI bool
+	// Grep keeps the lines matching it.
+	Grep *regexp.Regexp
+	// Tail keeps the last lines (0 for all).
+	Tail int
+}
+
+type outputFilterKey struct{}
+
+// WithOutputFilter returns a context filtering the output of the commands run with it.
+func WithOutputFilter(ctx context.Context, filter *OutputFilter) context.Context {
+	return context.WithValue(ctx, outputFilterKey{}, filter)
+}
+
+func outputFilterFromContext(ctx context.Context) *OutputFilter {
+	filter, _ := ctx.Value(outputFilterKey{}).(*OutputFilter)
+	return filter
+}
+
+// Apply filters an output: control sequences are stripped first, then lines are grepped, then the last
+// ones are kept. A first line tells how many lines were omitted, if any.
+func (f *OutputFilter) Apply(output string) string {
+	if f == nil || output == "" {
+		return output
+	}
+	if f.StripANSI {
+		output = stripANSI(output)
+	}
+	if f.Grep == nil && f.Tail <= 0 {
+		return output
+	}
+
+	trailingNewline := strings.HasSuffix(output, "\n")
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	total := len(lines)
+	if f.Grep != nil {
+		matching := lines[:0:0]
+		for _, line := range lines {
+			if f.Grep.MatchString(line) {
+				matching = append(matching, line)
+			}
+		}
+		lines = matching
+	}
+	if f.Tail > 0 && len(lines) > f.Tail {
+		lines = lines[len(lines)-f.Tail:]
+	}
+	if len(lines) == total {
+		return output
+	}
+
+	filtered := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		filtered += "\n"
+	}
+	return fmt.Sprintf("[%d of %d lines omitted by the output filter]\n", total-len(lines), total) + filtered
+}
+
+// stripANSI removes terminal control sequences, and keeps what's left visible of lines rewritten with
+// carriage returns.
+func stripANSI(output string) string {
+	output = ansiSequence.ReplaceAllString(output, "")
+	if !strings.Contains(output, "\r") {
+		return output
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if j := strings.LastIndex(line, "\r"); j >= 0 {
+			line = line[j+1:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
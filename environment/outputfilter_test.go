@@ -0,0 +1,71 @@
+package environment
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputFilter(t *testing.T) {
+	output := "\x1b[32mok\x1b[0m  pkg/a\n" +
+		"\x1b[31mFAIL\x1b[0m pkg/b\n" +
+		"downloading  10%\rdownloading 100%\n" +
+		"\x1b]8;;https://example.com\x07link\x1b]8;;\x07\n" +
+		"FAIL pkg/c\n"
+
+	tests := []struct {
+		name     string
+		filter   *OutputFilter
+		expected string
+	}{
+		{
+			name:     "no filter",
+			filter:   nil,
+			expected: output,
+		},
+		{
+			name:     "strip ansi",
+			filter:   &OutputFilter{StripANSI: true},
+			expected: "ok  pkg/a\nFAIL pkg/b\ndownloading 100%\nlink\nFAIL pkg/c\n",
+		},
+		{
+			name:     "grep",
+			filter:   &OutputFilter{StripANSI: true, Grep: regexp.MustCompile(`^FAIL`)},
+			expected: "[3 of 5 lines omitted by the output filter]\nFAIL pkg/b\nFAIL pkg/c\n",
+		},
+		{
+			name:     "tail",
+			filter:   &OutputFilter{StripANSI: true, Tail: 2},
+			expected: "[3 of 5 lines omitted by the output filter]\nlink\nFAIL pkg/c\n",
+		},
+		{
+			name:     "grep then tail",
+			filter:   &OutputFilter{StripANSI: true, Grep: regexp.MustCompile(`pkg/`), Tail: 1},
+			expected: "[4 of 5 lines omitted by the output filter]\nFAIL pkg/c\n",
+		},
+		{
+			name:     "tail longer than output",
+			filter:   &OutputFilter{Tail: 10},
+			expected: output,
+		},
+		{
+			name:     "nothing matching",
+			filter:   &OutputFilter{Grep: regexp.MustCompile(`panic`)},
+			expected: "[5 of 5 lines omitted by the output filter]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.Apply(output))
+		})
+	}
+}
+
+func TestOutputFilterFromContext(t *testing.T) {
+	assert.Nil(t, outputFilterFromContext(context.Background()))
+	filter := &OutputFilter{Tail: 5}
+	assert.Same(t, filter, outputFilterFromContext(WithOutputFilter(context.Background(), filter)))
+	assert.Equal(t, "", outputFilterFromContext(context.Background()).Apply(""))
+}
@@ -0,0 +1,128 @@
+package environment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+const (
+	// streamMountPath is where streamed commands write their output, on a cache volume shared with the execs
+	// reading it while they run.
+	streamMountPath = "/.container-use/stream"
+	// streamPollInterval is how often the output of a streamed command is read.
+	streamPollInterval = 500 * time.Millisecond
+)
+
+// streamScript runs a command ($@) with its output written to $0.stdout and $0.stderr.
+const streamScript = `exec "$@" >"$0.stdout" 2>"$0.stderr"`
+
+// streamReadScript prints the output of a streamed command ($0) past the given offsets ($1 for stdout, $2 for
+// stderr), on stdout and stderr. With $3 set, the output is removed once read.
+const streamReadScript = `tail -c +$(($1 + 1)) "$0.stdout" 2>/dev/null
+tail -c +$(($2 + 1)) "$0.stderr" >&2 2>/dev/null
+if [ -n "$3" ]; then rm -f "$0.stdout" "$0.stderr"; fi
+true`
+
+// OutputStream receives the output of commands while they run, e.g. to follow a long test suite. The
+// output is streamed before the output filter, if any, is applied.
+type OutputStream struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+type outputStreamKey struct{}
+
+// WithOutputStream returns a context streaming the output of the commands run with it.
+func WithOutputStream(ctx context.Context, stream *OutputStream) context.Context {
+	return context.WithValue(ctx, outputStreamKey{}, stream)
+}
+
+func outputStreamFromContext(ctx context.Context) *OutputStream {
+	stream, _ := ctx.Value(outputStreamKey{}).(*OutputStream)
+	return stream
+}
+
+// execStreaming runs args on container like WithExec, copying the output to the stream as it's produced.
+// Dagger only returns the output of an exec once it's done: the command writes it to a cache volume
+// instead, which other execs read in the meantime.
+func (env *Environment) execStreaming(ctx context.Context, container *dagger.Container, args []string, opts dagger.ContainerWithExecOpts, stream *OutputStream) (newState *dagger.Container, exitCode int, stdout, stderr string, err error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, 0, "", "", err
+	}
+	output := path.Join(streamMountPath, hex.EncodeToString(b))
+	volume := env.dag.CacheVolume("container-use-stream-" + env.ID)
+	mounted := container.WithMountedCache(streamMountPath, volume, dagger.ContainerWithMountedCacheOpts{
+		Sharing: dagger.CacheSharingModeShared,
+	})
+
+	newState = mounted.WithExec(append([]string{"sh", "-c", streamScript, output}, args...), opts)
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		exitCode, err = newState.ExitCode(ctx)
+		done <- err
+	}()
+
+	var stdoutBuf, stderrBuf strings.Builder
+	read := func(final bool) error {
+		newStdout, newStderr, err := readStreamedOutput(ctx, mounted, output, stdoutBuf.Len(), stderrBuf.Len(), final)
+		if err != nil {
+			return err
+		}
+		stdoutBuf.WriteString(newStdout)
+		stderrBuf.WriteString(newStderr)
+		io.WriteString(stream.Stdout, newStdout)
+		io.WriteString(stream.Stderr, newStderr)
+		return nil
+	}
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return nil, 0, "", "", fmt.Errorf("failed to get exit code: %w", err)
+			}
+			if err := read(true); err != nil {
+				return nil, exitCode, "", "", fmt.Errorf("failed to read output: %w", err)
+			}
+			return newState.WithoutMount(streamMountPath), exitCode, stdoutBuf.String(), stderrBuf.String(), nil
+		case <-ticker.C:
+			// The next read catches up after a failed one.
+			if err := read(false); err != nil {
+				slog.Debug("failed to read streamed output", "error", err)
+			}
+		}
+	}
+}
+
+// readStreamedOutput returns the output of a streamed command past the given offsets.
+func readStreamedOutput(ctx context.Context, container *dagger.Container, output string, stdoutOffset, stderrOffset int, remove bool) (stdout, stderr string, err error) {
+	removeArg := ""
+	if remove {
+		removeArg = "1"
+	}
+	reader := container.
+		// Each read must run: identical execs would be cached.
+		WithEnvVariable("CONTAINER_USE_STREAM_READ", strconv.FormatInt(time.Now().UnixNano(), 10)).
+		WithExec([]string{"sh", "-c", streamReadScript, output, strconv.Itoa(stdoutOffset), strconv.Itoa(stderrOffset), removeArg})
+	if stdout, err = reader.Stdout(ctx); err != nil {
+		return "", "", err
+	}
+	if stderr, err = reader.Stderr(ctx); err != nil {
+		return "", "", err
+	}
+	return stdout, stderr, nil
+}
@@ -0,0 +1,48 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputStreamFromContext(t *testing.T) {
+	assert.Nil(t, outputStreamFromContext(context.Background()))
+	stream := &OutputStream{}
+	assert.Same(t, stream, outputStreamFromContext(WithOutputStream(context.Background(), stream)))
+}
+
+func TestStreamScripts(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "run")
+	read := func(stdoutOffset, stderrOffset, remove string) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", streamReadScript, output, stdoutOffset, stderrOffset, remove)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		require.NoError(t, cmd.Run())
+		return stdout.String(), stderr.String()
+	}
+
+	stdout, stderr := read("0", "0", "")
+	assert.Empty(t, stdout, "nothing to read before the command starts")
+	assert.Empty(t, stderr)
+
+	err := exec.Command("sh", "-c", streamScript, output, "sh", "-c", "echo first; echo second; echo oops >&2; exit 3").Run()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode(), "the exit code of the command is kept")
+
+	stdout, stderr = read("0", "0", "")
+	assert.Equal(t, "first\nsecond\n", stdout)
+	assert.Equal(t, "oops\n", stderr)
+	stdout, stderr = read("6", "5", "1")
+	assert.Equal(t, "second\n", stdout)
+	assert.Empty(t, stderr)
+	assert.NoFileExists(t, output+".stdout")
+	assert.NoFileExists(t, output+".stderr")
+}
@@ -0,0 +1,220 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"golang.org/x/sync/errgroup"
+)
+
+// globChars are the characters with a meaning in include patterns: paths with them are merged one by one.
+const globChars = `*?[\`
+
+// ParallelCommand is the outcome of one of the commands run by RunParallel.
+type ParallelCommand struct {
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMS int64  `json:"duration_ms"`
+	// Changes are the files of the workdir the command added, changed or removed, relative to the workdir.
+	Changes []*StateChange `json:"changes"`
+}
+
+// ParallelConflict is a file of the workdir that several commands changed differently. None of their
+// changes to it are kept.
+type ParallelConflict struct {
+	Path     string   `json:"path"`
+	Commands []string `json:"commands"`
+}
+
+// ParallelResult is the combined outcome of commands run by RunParallel.
+type ParallelResult struct {
+	Commands []*ParallelCommand `json:"commands"`
+	// Merged are the files of the workdir whose changes were kept, relative to the workdir.
+	Merged    []string            `json:"merged"`
+	Conflicts []*ParallelConflict `json:"conflicts"`
+}
+
+// Failed returns the commands that exited with a non-zero code.
+func (r *ParallelResult) Failed() []*ParallelCommand {
+	var failed []*ParallelCommand
+	for _, command := range r.Commands {
+		if command.ExitCode != 0 {
+			failed = append(failed, command)
+		}
+	}
+	return failed
+}
+
+// parallelMerge is a change of a file kept from one of the commands.
+type parallelMerge struct {
+	path    string
+	from    int
+	removed bool
+}
+
+// planParallelMerge decides which changes of the workdir are kept from the commands, given the files
+// before and after each of them. Changes made by a single command, or identically by several, are kept;
+// a file changed differently by several commands is a conflict and keeps its previous content.
+func planParallelMerge(before map[string]snapshotEntry, after []map[string]snapshotEntry) ([]parallelMerge, map[string][]int) {
+	changedBy := map[string][]int{}
+	for i, files := range after {
+		for _, change := range diffSnapshots(nil, before, files) {
+			changedBy[change.Path] = append(changedBy[change.Path], i)
+		}
+	}
+
+	var merges []parallelMerge
+	conflicts := map[string][]int{}
+	for file, commands := range changedBy {
+		first, exists := after[commands[0]][file]
+		same := true
+		for _, i := range commands[1:] {
+			entry, ok := after[i][file]
+			if ok != exists || entry != first {
+				same = false
+				break
+			}
+		}
+		if !same {
+			conflicts[file] = commands
+			continue
+		}
+		merges = append(merges, parallelMerge{path: file, from: commands[0], removed: !exists})
+	}
+	sort.Slice(merges, func(i, j int) bool { return merges[i].path < merges[j].path })
+	return merges, conflicts
+}
+
+// RunParallel runs independent commands concurrently, each on its own copy of the environment (e.g.
+// lint, unit tests and type checking), then merges the changes they made to the workdir. Files changed
+// differently by several commands are reported as conflicts and left as they were. Changes outside the
+// workdir are discarded.
+func (env *Environment) RunParallel(ctx context.Context, commands []string, shell string) (*ParallelResult, error) {
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("no commands to run")
+	}
+	workdir := env.State.Config.Workdir
+	roots := []string{workdir}
+	base := env.container()
+	before, err := listFiles(ctx, base, roots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workdir files: %w", err)
+	}
+
+	result := &ParallelResult{Commands: make([]*ParallelCommand, len(commands))}
+	states := make([]*dagger.Container, len(commands))
+	after := make([]map[string]snapshotEntry, len(commands))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, command := range commands {
+		g.Go(func() error {
+			startedAt := time.Now()
+			args := env.State.Config.execArgs([]string{shell, "-c", command})
+			newState, stdout, stderr, exitCode, err := env.exec(gctx, base, command, args, false)
+			if err != nil {
+				return fmt.Errorf("%q: %w", command, err)
+			}
+			files, err := listFiles(gctx, newState, roots)
+			if err != nil {
+				return fmt.Errorf("failed to list workdir files after %q: %w", command, err)
+			}
+			changes := diffSnapshots(roots, before, files)
+			for _, change := range changes {
+				change.Path = relativeTo(workdir, change.Path)
+			}
+			states[i], after[i] = newState, files
+			result.Commands[i] = &ParallelCommand{
+				Command:    command,
+				ExitCode:   exitCode,
+				Stdout:     stdout,
+				Stderr:     stderr,
+				DurationMS: time.Since(startedAt).Milliseconds(),
+				Changes:    changes,
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	merges, conflicts := planParallelMerge(before, after)
+	merged := mergeParallelChanges(base, workdir, states, merges, env.State.Config.fileOwner())
+
+	result.Merged = make([]string, 0, len(merges))
+	for _, merge := range merges {
+		result.Merged = append(result.Merged, relativeTo(workdir, merge.path))
+	}
+	result.Conflicts = make([]*ParallelConflict, 0, len(conflicts))
+	for file, indexes := range conflicts {
+		conflict := &ParallelConflict{Path: relativeTo(workdir, file)}
+		for _, i := range indexes {
+			conflict.Commands = append(conflict.Commands, commands[i])
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool { return result.Conflicts[i].Path < result.Conflicts[j].Path })
+
+	for _, command := range result.Commands {
+		env.Notes.AddCommand(command.Command, command.ExitCode, command.Stdout, command.Stderr)
+	}
+	if len(result.Conflicts) > 0 {
+		paths := make([]string, 0, len(result.Conflicts))
+		for _, conflict := range result.Conflicts {
+			paths = append(paths, conflict.Path)
+		}
+		env.Notes.Add("Parallel commands changed the same files differently, their changes weren't kept: %s", strings.Join(paths, ", "))
+	}
+	env.recordStateChanges(ctx, strings.Join(commands, " & "), base, merged)
+
+	if err := env.apply(ctx, merged); err != nil {
+		return result, fmt.Errorf("failed to apply container state: %w", err)
+	}
+	return result, nil
+}
+
+// mergeParallelChanges applies the kept changes to base: the files of each command are copied with a
+// single operation when their paths can be used as include patterns.
+func mergeParallelChanges(base *dagger.Container, workdir string, states []*dagger.Container, merges []parallelMerge, owner string) *dagger.Container {
+	merged := base
+	includes := make([][]string, len(states))
+	var removed []string
+	for _, merge := range merges {
+		switch {
+		case merge.removed:
+			removed = append(removed, merge.path)
+		case strings.ContainsAny(merge.path, globChars):
+			merged = merged.WithFile(merge.path, states[merge.from].File(merge.path), dagger.ContainerWithFileOpts{Owner: owner})
+		default:
+			includes[merge.from] = append(includes[merge.from], relativeTo(workdir, merge.path))
+		}
+	}
+	for i, include := range includes {
+		if len(include) == 0 {
+			continue
+		}
+		merged = merged.WithDirectory(workdir, states[i].Directory(workdir), dagger.ContainerWithDirectoryOpts{
+			Include: include,
+			Owner:   owner,
+		})
+	}
+	if len(removed) > 0 {
+		merged = merged.WithoutFiles(removed)
+	}
+	return merged
+}
+
+// relativeTo returns file relative to dir, or file itself if it isn't under dir.
+func relativeTo(dir, file string) string {
+	prefix := strings.TrimSuffix(path.Clean(dir), "/") + "/"
+	if rel, ok := strings.CutPrefix(file, prefix); ok {
+		return rel
+	}
+	return file
+}
@@ -0,0 +1,53 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanParallelMerge(t *testing.T) {
+	before := parseSnapshot(`1 10 /workdir/go.mod
+2 20 /workdir/main.go
+3 30 /workdir/stale.txt
+`)
+	lint := parseSnapshot(`1 10 /workdir/go.mod
+2 20 /workdir/main.go
+40 40 /workdir/lint-report.txt
+50 50 /workdir/coverage.out
+`)
+	test := parseSnapshot(`1 10 /workdir/go.mod
+2 20 /workdir/main.go
+60 60 /workdir/coverage.out
+`)
+	generate := parseSnapshot(`1 10 /workdir/go.mod
+22 22 /workdir/main.go
+40 40 /workdir/lint-report.txt
+3 30 /workdir/stale.txt
+`)
+
+	merges, conflicts := planParallelMerge(before, []map[string]snapshotEntry{lint, test, generate})
+	assert.Equal(t, []parallelMerge{
+		{path: "/workdir/lint-report.txt", from: 0},
+		{path: "/workdir/main.go", from: 2},
+		// Removed identically by lint and test, untouched by generate.
+		{path: "/workdir/stale.txt", from: 0, removed: true},
+	}, merges)
+	assert.Equal(t, map[string][]int{
+		"/workdir/coverage.out": {0, 1},
+	}, conflicts)
+}
+
+func TestPlanParallelMergeRemovalConflict(t *testing.T) {
+	before := parseSnapshot("1 10 /workdir/build.lock\n")
+	rewritten := parseSnapshot("2 20 /workdir/build.lock\n")
+	merges, conflicts := planParallelMerge(before, []map[string]snapshotEntry{{}, rewritten})
+	assert.Empty(t, merges)
+	assert.Equal(t, map[string][]int{"/workdir/build.lock": {0, 1}}, conflicts)
+}
+
+func TestRelativeTo(t *testing.T) {
+	assert.Equal(t, "src/main.go", relativeTo("/workdir", "/workdir/src/main.go"))
+	assert.Equal(t, "main.go", relativeTo("/workdir/", "/workdir/main.go"))
+	assert.Equal(t, "/workdirs/main.go", relativeTo("/workdir", "/workdirs/main.go"))
+}
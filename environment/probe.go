@@ -0,0 +1,45 @@
+package environment
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// Probe runs a check command, such as a health check, in the environment and returns its exit code
+// and output. Unlike Run, the environment's state and notes are left untouched, and the command is
+// never served from the cache, so probing repeatedly reflects the environment's current state.
+func (env *Environment) Probe(ctx context.Context, command, shell string) (int, string, error) {
+	probe := env.container().
+		WithEnvVariable("CONTAINER_USE_PROBE", time.Now().Format(time.RFC3339Nano)).
+		WithExec(env.State.Config.execArgs([]string{shell, "-c", command}), dagger.ContainerWithExecOpts{
+			Expect:                        dagger.ReturnTypeAny,
+			ExperimentalPrivilegedNesting: env.State.Config.privilegedNesting(),
+		})
+
+	exitCode, err := probe.ExitCode(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	stdout, err := probe.Stdout(ctx)
+	if err != nil {
+		return exitCode, "", err
+	}
+	stderr, err := probe.Stderr(ctx)
+	if err != nil {
+		return exitCode, stdout, err
+	}
+	return exitCode, strings.TrimSpace(stdout + stderr), nil
+}
+
+// Exists reports whether a file or directory exists in the environment.
+// Relative paths are relative to the workdir.
+func (env *Environment) Exists(ctx context.Context, targetPath string) (bool, error) {
+	if !path.IsAbs(targetPath) {
+		targetPath = path.Join(env.State.Config.Workdir, targetPath)
+	}
+	return env.container().Exists(ctx, targetPath)
+}
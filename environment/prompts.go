@@ -0,0 +1,122 @@
+package environment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// Commands run with an empty standard input: a command asking for input (e.g. to accept a license or
+// for an MFA code) reads end-of-file and fails instead of hanging. When such a failure's output ends with
+// a prompt, the user is asked to answer it and the command runs again with the answer as its input.
+//
+// The command runs again from the start: whatever it did before prompting (writing files, installing
+// packages, calling remote services) is done again. Setup steps are run again the same way, so they
+// should only prompt once they're done with side effects, or be made non-interactive.
+
+// maxPromptAnswers caps the prompts answered for a single command.
+const maxPromptAnswers = 5
+
+// promptTailLines is how many of the last lines of each output are searched for a prompt.
+const promptTailLines = 3
+
+var (
+	// choicePrompt matches yes/no questions, e.g. "Do you want to continue? [Y/n]".
+	choicePrompt = regexp.MustCompile(`(?i)[\[(]\s*(y|yes)\s*/\s*(n|no)\s*[\])]`)
+	// questionPrompt matches requests for a value, e.g. "Password:" or "Enter the code from your app >".
+	questionPrompt = regexp.MustCompile(`(?i)\b(password|passphrase|passcode|pin|token|code|otp|username|login|accept|agree|continue|proceed|confirm|enter|licen[cs]e)\b.*[:?>]$`)
+	// secretPrompt matches prompts asking for secrets, e.g. "Password:" or "Enter your MFA code:".
+	secretPrompt = regexp.MustCompile(`(?i)(password|passphrase|passcode|token|otp|mfa|2fa|pin\b|code\b)`)
+)
+
+// stdinPath is where the input of commands answering secret prompts is mounted.
+const stdinPath = "/run/container-use/stdin"
+
+// IsSecretPrompt returns whether the prompt asks for a secret, whose answer isn't echoed nor recorded.
+func IsSecretPrompt(prompt string) bool {
+	return secretPrompt.MatchString(prompt)
+}
+
+// commandInput is the input of a command, made of the answers to the prompts it failed on.
+type commandInput struct {
+	text string
+	// secret is set once a secret prompt was answered.
+	secret bool
+}
+
+// withInput returns the container and arguments running args with the input, and the stdin to pass the exec.
+// Exec arguments are recorded in the container's ID, which is saved with the environment's state: input
+// holding secrets is mounted as a secret and redirected to the command instead. Callers remove the mount
+// from the resulting container with withoutInput.
+func (env *Environment) withInput(container *dagger.Container, args []string, input commandInput) (*dagger.Container, []string, string, error) {
+	if !input.secret {
+		return container, args, input.text, nil
+	}
+	// A random name keeps the answers (e.g. short MFA codes) from being guessed from a digest.
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, nil, "", err
+	}
+	secret := env.dag.SetSecret("stdin-"+env.ID+"-"+hex.EncodeToString(b), input.text)
+	container = container.WithMountedSecret(stdinPath, secret)
+	return container, append([]string{"sh", "-c", `exec "$@" < ` + stdinPath, "sh"}, args...), "", nil
+}
+
+// withoutInput removes the input mounted by withInput from a container a command ran on.
+func withoutInput(container *dagger.Container, input commandInput) *dagger.Container {
+	if !input.secret {
+		return container
+	}
+	return container.WithoutMount(stdinPath)
+}
+
+// InputPrompt asks the user to answer a prompt printed by a command waiting for input.
+// It returns false if the user didn't answer.
+type InputPrompt func(ctx context.Context, command, prompt string) (string, bool, error)
+
+// DetectPrompt returns the prompt a failed command printed before reading its empty input, if any:
+// one of the last lines of its output asking for a choice or a value.
+func DetectPrompt(stdout, stderr string) (string, bool) {
+	for _, output := range []string{stdout, stderr} {
+		lines := strings.Split(strings.TrimRight(output, " \t\r\n"), "\n")
+		for i := len(lines) - 1; i >= 0 && i >= len(lines)-promptTailLines; i-- {
+			line := strings.TrimSpace(lines[i])
+			if choicePrompt.MatchString(line) || questionPrompt.MatchString(line) {
+				return line, true
+			}
+		}
+	}
+	return "", false
+}
+
+// answerPrompt asks the user to answer the prompt a failed command ended on, returning the input to run
+// the command again with: its previous input followed by the answer. It returns false if the command
+// didn't prompt or the user didn't answer.
+func (env *Environment) answerPrompt(ctx context.Context, command string, input commandInput, stdout, stderr string) (commandInput, bool, error) {
+	prompt, found := DetectPrompt(stdout, stderr)
+	if !found {
+		return commandInput{}, false, nil
+	}
+	env.emit(EventInputPrompted, map[string]any{"command": command, "prompt": prompt})
+
+	answered := false
+	var answer string
+	if env.OnInputPrompt != nil {
+		var err error
+		if answer, answered, err = env.OnInputPrompt(ctx, command, prompt); err != nil {
+			return commandInput{}, false, err
+		}
+	}
+	if !answered {
+		env.Notes.Add("The command failed waiting for input (%q): commands can't read input. Make it non-interactive, e.g. with a --yes flag or by piping the answer.", prompt)
+		return commandInput{}, false, nil
+	}
+	return commandInput{
+		text:   input.text + answer + "\n",
+		secret: input.secret || IsSecretPrompt(prompt),
+	}, true, nil
+}
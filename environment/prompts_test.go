@@ -0,0 +1,65 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectPrompt(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stdout string
+		stderr string
+		prompt string
+	}{
+		{
+			name:   "apt confirmation",
+			stdout: "The following NEW packages will be installed:\n  jq\nDo you want to continue? [Y/n] Abort.\n",
+			prompt: "Do you want to continue? [Y/n] Abort.",
+		},
+		{
+			name:   "license",
+			stdout: "Do you accept the license terms? (yes/no)",
+			prompt: "Do you accept the license terms? (yes/no)",
+		},
+		{
+			name:   "read -p on stderr",
+			stderr: "Password: ",
+			prompt: "Password:",
+		},
+		{
+			name:   "python input",
+			stdout: "Enter the code from your authenticator app > ",
+			stderr: "Traceback (most recent call last):\n  File \"login.py\", line 3, in <module>\nEOFError: EOF when reading a line\n",
+			prompt: "Enter the code from your authenticator app >",
+		},
+		{
+			name:   "plain failure",
+			stdout: "running tests\n",
+			stderr: "FAIL: TestLogin\nexpected code 200, got 401\n",
+		},
+		{
+			name:   "prompt too far from the end",
+			stdout: "Password:\nline 1\nline 2\nline 3\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prompt, found := DetectPrompt(tc.stdout, tc.stderr)
+			assert.Equal(t, tc.prompt != "", found)
+			assert.Equal(t, tc.prompt, prompt)
+		})
+	}
+}
+
+func TestIsSecretPrompt(t *testing.T) {
+	for prompt, secret := range map[string]bool{
+		"Password:": true,
+		"Enter the code from your authenticator app >":      true,
+		"Enter passphrase for key '/root/.ssh/id_ed25519':": true,
+		"Do you want to continue? [Y/n]":                    false,
+		"Username:":                                         false,
+	} {
+		assert.Equal(t, secret, IsSecretPrompt(prompt), prompt)
+	}
+}
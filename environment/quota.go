@@ -0,0 +1,70 @@
+package environment
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// QuotaConfig caps the live environments of a repository, so a runaway orchestrator can't create hundreds of
+// them on a shared machine. Limits of 0 are unlimited.
+type QuotaConfig struct {
+	// MaxEnvironments is the number of environments of the repository.
+	MaxEnvironments int `json:"max_environments,omitempty"`
+	// MaxPerLabel is the number of environments with any given label, overridden for the labels of Labels.
+	MaxPerLabel int            `json:"max_per_label,omitempty"`
+	Labels      map[string]int `json:"labels,omitempty"`
+	// MaxPerAgent is the number of environments created by any given agent, the MCP client creating them,
+	// overridden for the agents of Agents.
+	MaxPerAgent int            `json:"max_per_agent,omitempty"`
+	Agents      map[string]int `json:"agents,omitempty"`
+}
+
+// LabelLimit returns the number of environments allowed with label, 0 when unlimited.
+func (q *QuotaConfig) LabelLimit(label string) int {
+	if limit, ok := q.Labels[label]; ok {
+		return limit
+	}
+	return q.MaxPerLabel
+}
+
+// AgentLimit returns the number of environments agent is allowed to create, 0 when unlimited.
+func (q *QuotaConfig) AgentLimit(agent string) int {
+	if limit, ok := q.Agents[agent]; ok {
+		return limit
+	}
+	return q.MaxPerAgent
+}
+
+// Validate checks that no limit is negative.
+func (q *QuotaConfig) Validate() error {
+	if q.MaxEnvironments < 0 || q.MaxPerLabel < 0 || q.MaxPerAgent < 0 {
+		return fmt.Errorf("quota limits can't be negative")
+	}
+	for _, limits := range []map[string]int{q.Labels, q.Agents} {
+		for _, name := range slices.Sorted(maps.Keys(limits)) {
+			if limits[name] < 0 {
+				return fmt.Errorf("the quota of %s can't be negative", name)
+			}
+		}
+	}
+	return nil
+}
+
+// IsZero reports whether the quota doesn't limit anything.
+func (q *QuotaConfig) IsZero() bool {
+	if q == nil {
+		return true
+	}
+	if q.MaxEnvironments > 0 || q.MaxPerLabel > 0 || q.MaxPerAgent > 0 {
+		return false
+	}
+	for _, limits := range []map[string]int{q.Labels, q.Agents} {
+		for _, limit := range limits {
+			if limit > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaConfig(t *testing.T) {
+	var unset *QuotaConfig
+	assert.True(t, unset.IsZero())
+	assert.True(t, (&QuotaConfig{Labels: map[string]int{"bugfix": 0}}).IsZero())
+
+	quota := &QuotaConfig{
+		MaxPerLabel: 5,
+		Labels:      map[string]int{"experiment": 2, "release": 0},
+		Agents:      map[string]int{"orchestrator": 20},
+	}
+	assert.False(t, quota.IsZero())
+	assert.Equal(t, 5, quota.LabelLimit("bugfix"))
+	assert.Equal(t, 2, quota.LabelLimit("experiment"))
+	assert.Equal(t, 0, quota.LabelLimit("release"), "a label's own quota of 0 lifts the default")
+	assert.Equal(t, 20, quota.AgentLimit("orchestrator"))
+	assert.Equal(t, 0, quota.AgentLimit("cursor"))
+	assert.NoError(t, quota.Validate())
+
+	quota.Agents["orchestrator"] = -1
+	assert.ErrorContains(t, quota.Validate(), "the quota of orchestrator can't be negative")
+	assert.Error(t, (&QuotaConfig{MaxEnvironments: -1}).Validate())
+}
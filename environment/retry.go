@@ -0,0 +1,165 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// RetryConfig sets how operations failing on transient errors, such as a network blip while connecting to
+// the engine, pulling an image or running a command, are retried with exponential backoff.
+type RetryConfig struct {
+	// Attempts is the number of attempts of an operation, 1 never retrying.
+	Attempts int `json:"attempts,omitempty"`
+	// InitialDelayMS is the delay before the first retry, doubled before each of the next ones.
+	InitialDelayMS int64 `json:"initial_delay_ms,omitempty"`
+	// MaxDelayMS caps the delay between retries.
+	MaxDelayMS int64 `json:"max_delay_ms,omitempty"`
+}
+
+// DefaultRetry returns the retries applying when the repository doesn't configure any.
+func DefaultRetry() *RetryConfig {
+	return &RetryConfig{
+		Attempts:       3,
+		InitialDelayMS: 1000,
+		MaxDelayMS:     30000,
+	}
+}
+
+// Validate checks the retries are consistent.
+func (c *RetryConfig) Validate() error {
+	if c.Attempts < 1 {
+		return fmt.Errorf("invalid number of attempts %d: at least 1 is required", c.Attempts)
+	}
+	if c.InitialDelayMS < 0 || c.MaxDelayMS < 0 {
+		return errors.New("retry delays must not be negative")
+	}
+	return nil
+}
+
+// Delay returns how long to wait before the given retry, from 1.
+func (c *RetryConfig) Delay(retry int) time.Duration {
+	delay := time.Duration(c.InitialDelayMS) * time.Millisecond
+	maxDelay := time.Duration(c.MaxDelayMS) * time.Millisecond
+	for range retry - 1 {
+		if delay >= maxDelay {
+			break
+		}
+		delay *= 2
+	}
+	if maxDelay > 0 {
+		delay = min(delay, maxDelay)
+	}
+	return delay
+}
+
+// RetryFunc is told about a retry of an operation: its number, from 1, the delay before it and the error
+// of the previous attempt.
+type RetryFunc func(retry int, delay time.Duration, err error)
+
+// Do runs fn until it succeeds, fails with an error that isn't transient, or the attempts are exhausted,
+// calling onRetry before each retry. A nil configuration applies DefaultRetry.
+func (c *RetryConfig) Do(ctx context.Context, fn func() error, onRetry RetryFunc) error {
+	if c == nil {
+		c = DefaultRetry()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= c.Attempts || ctx.Err() != nil || !IsTransient(err) {
+			return err
+		}
+		delay := c.Delay(attempt)
+		if onRetry != nil {
+			onRetry(attempt, delay, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// permanentErrors are messages of errors retrying doesn't fix, even when they also look like network errors.
+var permanentErrors = []string{
+	"unauthorized",
+	"authentication required",
+	"denied",
+	"forbidden",
+	"manifest unknown",
+	"not found",
+	"no such host",
+	"invalid reference",
+	"cannot connect to the docker daemon",
+}
+
+// transientErrors are messages of network and registry errors that usually go away when retried.
+var transientErrors = []string{
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"temporary failure in name resolution",
+	"server misbehaving",
+	"too many requests",
+	"toomanyrequests",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+	"502 ",
+	"503 ",
+	"504 ",
+	"429 ",
+	"stream error",
+	"transport is closing",
+	"error reading from server",
+	"deadline exceeded",
+}
+
+// IsTransient reports whether err looks like a transient network or registry error, worth retrying, rather
+// than a permanent one such as a missing image or a denied access.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, permanent := range permanentErrors {
+		if strings.Contains(message, permanent) {
+			return false
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, transient := range transientErrors {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry runs fn with the retries of the environment's configuration, reporting each retry with EventRetry
+// and in the environment's notes.
+func (env *Environment) retry(ctx context.Context, operation string, fn func() error) error {
+	config := env.State.Config.Retry
+	if config == nil {
+		config = DefaultRetry()
+	}
+	return config.Do(ctx, fn, func(retry int, delay time.Duration, err error) {
+		env.emit(EventRetry, map[string]any{
+			"operation": operation,
+			"retry":     retry,
+			"attempts":  config.Attempts,
+			"delay_ms":  delay.Milliseconds(),
+			"error":     err.Error(),
+		})
+		env.Notes.Add("Retrying %s in %s (retry %d of %d) after a transient error: %v", operation, delay, retry, config.Attempts-1, err)
+	})
+}
@@ -0,0 +1,75 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransient(t *testing.T) {
+	for _, err := range []error{
+		errors.New("failed to pull base image: dial tcp 10.0.0.1:443: connect: connection refused"),
+		errors.New("read tcp 10.0.0.2:5000: read: connection reset by peer"),
+		errors.New("unexpected status code 503 Service Unavailable"),
+		errors.New("toomanyrequests: You have reached your pull rate limit"),
+		fmt.Errorf("failed to get exit code: %w", errors.New("stream error: stream ID 3; INTERNAL_ERROR")),
+	} {
+		assert.True(t, IsTransient(err), err.Error())
+	}
+	for _, err := range []error{
+		nil,
+		context.Canceled,
+		errors.New("docker.io/library/nope:latest: not found"),
+		errors.New("unexpected status code 401 Unauthorized: authentication required"),
+		errors.New("dial tcp: lookup registry.invalid: no such host"),
+		errors.New("invalid base image build path"),
+	} {
+		assert.False(t, IsTransient(err), "%v", err)
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	config := &RetryConfig{Attempts: 5, InitialDelayMS: 1000, MaxDelayMS: 3000}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, time.Second, config.Delay(1))
+	assert.Equal(t, 2*time.Second, config.Delay(2))
+	assert.Equal(t, 3*time.Second, config.Delay(3))
+	assert.Equal(t, 3*time.Second, config.Delay(10))
+	assert.Error(t, (&RetryConfig{}).Validate())
+
+	ctx := context.Background()
+	config = &RetryConfig{Attempts: 3, InitialDelayMS: 1}
+	transient := errors.New("connection reset by peer")
+	attempts := 0
+	var retries []int
+	err := config.Do(ctx, func() error {
+		attempts++
+		if attempts < 3 {
+			return transient
+		}
+		return nil
+	}, func(retry int, _ time.Duration, err error) {
+		retries = append(retries, retry)
+		assert.Equal(t, transient, err)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, retries)
+
+	// Attempts are exhausted.
+	attempts = 0
+	err = config.Do(ctx, func() error { attempts++; return transient }, nil)
+	assert.Equal(t, transient, err)
+	assert.Equal(t, 3, attempts)
+
+	// Permanent errors fail at once.
+	attempts = 0
+	permanent := errors.New("manifest unknown")
+	err = config.Do(ctx, func() error { attempts++; return permanent }, nil)
+	assert.Equal(t, permanent, err)
+	assert.Equal(t, 1, attempts)
+}
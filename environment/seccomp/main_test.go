@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	for _, arch := range []string{"amd64", "arm64"} {
+		program, err := filter(arch)
+		require.NoError(t, err, arch)
+		// The kernel refuses programs longer than BPF_MAXINSNS.
+		require.Less(t, len(program), 4096, arch)
+		require.Equal(t, sockFilter{Code: bpfRetK, K: retAllow}, program[len(program)-1], arch)
+	}
+
+	_, err := filter("riscv64")
+	require.Error(t, err)
+}
+
+func TestInstall(t *testing.T) {
+	if _, err := filter(runtime.GOARCH); err != nil {
+		t.Skip(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		// The filter stays on the thread, which the runtime throws away when the goroutine exits locked.
+		runtime.LockOSThread()
+		if err := install(); err != nil {
+			errs <- err
+			return
+		}
+		errs <- syscall.Unshare(syscall.CLONE_NEWUSER)
+	}()
+	require.ErrorIs(t, <-errs, syscall.EPERM)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"dagger.io/dagger"
@@ -13,6 +16,85 @@ var (
 	serviceStartTimeout = 30 * time.Second
 )
 
+// Healthcheck defaults.
+const (
+	defaultHealthcheckInterval = time.Second
+	defaultHealthcheckRetries  = 30
+)
+
+// ServiceHealthcheck tells when a service is ready, e.g. once a database accepts connections, so the
+// environment's commands don't run before. Services are otherwise ready once their exposed ports listen.
+type ServiceHealthcheck struct {
+	// Command runs in a container of the service's image, reaching the service at its name, e.g.
+	// "pg_isready -h db". The service is ready once it exits with 0.
+	Command string `json:"command"`
+	// IntervalMS is the delay between attempts, defaultHealthcheckInterval if unset.
+	IntervalMS int64 `json:"interval_ms,omitempty"`
+	// Retries is the number of attempts, defaultHealthcheckRetries if unset.
+	Retries int `json:"retries,omitempty"`
+}
+
+// Interval returns the delay between attempts.
+func (h *ServiceHealthcheck) Interval() time.Duration {
+	if h.IntervalMS == 0 {
+		return defaultHealthcheckInterval
+	}
+	return time.Duration(h.IntervalMS) * time.Millisecond
+}
+
+// Attempts returns the number of attempts.
+func (h *ServiceHealthcheck) Attempts() int {
+	if h.Retries == 0 {
+		return defaultHealthcheckRetries
+	}
+	return h.Retries
+}
+
+// Validate checks the service has a name it can be reached at, an image, valid ports and environment
+// variables, and a valid healthcheck.
+func (cfg *ServiceConfig) Validate() error {
+	if !hostnamePattern.MatchString(cfg.Name) || strings.Contains(cfg.Name, ".") {
+		return fmt.Errorf("invalid service name %q: services are reached at their name, which must be a host name", cfg.Name)
+	}
+	if cfg.Image == "" {
+		return fmt.Errorf("service %s has no image", cfg.Name)
+	}
+	for _, port := range cfg.ExposedPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d for service %s", port, cfg.Name)
+		}
+	}
+	for _, env := range cfg.Env {
+		if key, _, ok := strings.Cut(env, "="); !ok || key == "" {
+			return fmt.Errorf("invalid environment variable %q for service %s: expected KEY=VALUE", env, cfg.Name)
+		}
+	}
+	if h := cfg.Healthcheck; h != nil {
+		if h.Command == "" {
+			return fmt.Errorf("the healthcheck of service %s has no command", cfg.Name)
+		}
+		if h.IntervalMS < 0 || h.Retries < 0 {
+			return fmt.Errorf("the healthcheck interval and retries of service %s can't be negative", cfg.Name)
+		}
+	}
+	return nil
+}
+
+// Validate checks every service is valid, with a unique name.
+func (sc ServiceConfigs) Validate() error {
+	seen := map[string]bool{}
+	for _, cfg := range sc {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		if seen[cfg.Name] {
+			return fmt.Errorf("service %q is defined more than once", cfg.Name)
+		}
+		seen[cfg.Name] = true
+	}
+	return nil
+}
+
 type Service struct {
 	Config    *ServiceConfig   `json:"config"`
 	Endpoints EndpointMappings `json:"endpoints"`
@@ -40,7 +122,7 @@ func (env *Environment) startServices(ctx context.Context) ([]*Service, error) {
 }
 
 func (env *Environment) startService(ctx context.Context, cfg *ServiceConfig) (*Service, error) {
-	container := env.dag.Container().From(cfg.Image)
+	container := env.imageContainer(cfg.Image)
 	container, err := containerWithEnvAndSecrets(env.dag, container, cfg.Env, env.State.Config.Secrets)
 	if err != nil {
 		return nil, err
@@ -80,6 +162,12 @@ func (env *Environment) startService(ctx context.Context, cfg *ServiceConfig) (*
 		}
 		return nil, err
 	}
+	if cfg.Healthcheck != nil {
+		if err := env.waitHealthy(ctx, cfg, svc); err != nil {
+			svc.Stop(context.WithoutCancel(ctx))
+			return nil, err
+		}
+	}
 
 	endpoints := EndpointMappings{}
 	for _, port := range cfg.ExposedPorts {
@@ -138,3 +226,57 @@ func (env *Environment) AddService(ctx context.Context, explanation string, cfg
 
 	return svc, nil
 }
+
+// waitHealthy runs the healthcheck of the service until it succeeds, or fails once it ran out of attempts.
+func (env *Environment) waitHealthy(ctx context.Context, cfg *ServiceConfig, svc *dagger.Service) error {
+	container, err := containerWithEnvAndSecrets(env.dag, env.imageContainer(cfg.Image), cfg.Env, env.State.Config.Secrets)
+	if err != nil {
+		return err
+	}
+	container = container.WithServiceBinding(cfg.Name, svc)
+
+	startedAt := time.Now()
+	healthcheck := cfg.Healthcheck
+	for attempt := 1; ; attempt++ {
+		check := container.
+			// Each attempt must run: identical execs would be cached.
+			WithEnvVariable("CONTAINER_USE_HEALTHCHECK", strconv.FormatInt(time.Now().UnixNano(), 10)).
+			WithExec([]string{"sh", "-c", healthcheck.Command}, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+		exitCode, err := check.ExitCode(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to run the healthcheck of service %s: %w", cfg.Name, err)
+		}
+		if exitCode == 0 {
+			slog.Info("Service healthy", "environment-id", env.ID, "service", cfg.Name, "duration", time.Since(startedAt))
+			return nil
+		}
+		if attempt >= healthcheck.Attempts() {
+			stderr, _ := check.Stderr(ctx)
+			return fmt.Errorf("service %s isn't healthy after %d attempts: %q exited with %d: %s", cfg.Name, attempt, healthcheck.Command, exitCode, strings.TrimSpace(stderr))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(healthcheck.Interval()):
+		}
+	}
+}
+
+// ensureServices starts the environment's services, unless they're running, waiting for them to be healthy.
+// The service bindings of its container would start them with its commands, but without their healthchecks.
+func (env *Environment) ensureServices(ctx context.Context) error {
+	env.mu.RLock()
+	started := len(env.Services) > 0
+	env.mu.RUnlock()
+	if started || len(env.State.Config.Services) == 0 {
+		return nil
+	}
+	services, err := env.startServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start services: %w", err)
+	}
+	env.mu.Lock()
+	env.Services = services
+	env.mu.Unlock()
+	return nil
+}
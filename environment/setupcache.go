@@ -0,0 +1,92 @@
+package environment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// CommandInputs maps setup and install commands to the source files they depend on, e.g.
+// "npm ci" to package.json and package-lock.json. Commands with inputs run with only those
+// files of the source in the workdir, so editing other files doesn't invalidate their cache.
+type CommandInputs map[string][]string
+
+// Set records the inputs of a command, or forgets them if inputs is empty.
+func (inputs *CommandInputs) Set(command string, patterns []string) {
+	if len(patterns) == 0 {
+		delete(*inputs, command)
+		return
+	}
+	if *inputs == nil {
+		*inputs = CommandInputs{}
+	}
+	(*inputs)[command] = patterns
+}
+
+// Prune forgets the inputs of commands that aren't configured anymore.
+func (inputs CommandInputs) Prune(commands ...[]string) {
+	for command := range inputs {
+		if !slices.ContainsFunc(commands, func(list []string) bool { return slices.Contains(list, command) }) {
+			delete(inputs, command)
+		}
+	}
+}
+
+// commandInputs returns the input files of a command from the source, or nil if it has none.
+func (env *Environment) commandInputs(source *dagger.Directory, command string) *dagger.Directory {
+	patterns := env.State.Config.CommandInputs[command]
+	if len(patterns) == 0 {
+		return nil
+	}
+	return source.Filter(dagger.DirectoryFilterOpts{Include: patterns})
+}
+
+// stepStampPrefix starts the line setup steps print on stderr with the time they ran. The engine replays
+// the output of cached steps, so an old time tells a cache hit from a fresh run.
+const stepStampPrefix = "container-use-step-ran-at="
+
+// stepScript runs the command passed as $1 and stamps its stderr, keeping its exit code.
+const stepScript = `sh -c "$1"; status=$?; echo "` + stepStampPrefix + `$(date +%s)" >&2; exit $status`
+
+// stepClockSkew tolerates clock differences between the host and the engine when detecting cache hits.
+const stepClockSkew = 2 * time.Second
+
+// stepArgs returns the exec arguments running a setup step.
+func stepArgs(command string) []string {
+	return []string{"sh", "-c", stepScript, "sh", command}
+}
+
+// splitStepStamp removes the stamp from a step's stderr, and reports whether the step's result was
+// replayed from the cache rather than run by a build started at startedAt.
+func splitStepStamp(stderr string, startedAt time.Time) (string, bool) {
+	before, stamp, found := strings.Cut(stderr, stepStampPrefix)
+	if !found {
+		return stderr, false
+	}
+	stamp, after, _ := strings.Cut(stamp, "\n")
+	ranAt, err := strconv.ParseInt(strings.TrimSpace(stamp), 10, 64)
+	cached := err == nil && time.Unix(ranAt, 0).Before(startedAt.Add(-stepClockSkew))
+	return before + after, cached
+}
+
+// stepCacheKey identifies a setup step by the key of the previous step (the base image digest for
+// the first one), its command and the digest of its input files. Steps with the same key reuse
+// the cached result of a previous build.
+func stepCacheKey(previous, command, inputsDigest string) string {
+	h := sha256.New()
+	for _, part := range []string{previous, command, inputsDigest} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// shortKey abbreviates a cache key for logs.
+func shortKey(key string) string {
+	return key[:min(len(key), 12)]
+}
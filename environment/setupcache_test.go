@@ -0,0 +1,53 @@
+package environment
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStepStamp(t *testing.T) {
+	startedAt := time.Now()
+
+	stderr, cached := splitStepStamp(fmt.Sprintf("warning: deprecated\n%s%d\n", stepStampPrefix, startedAt.Unix()), startedAt)
+	assert.Equal(t, "warning: deprecated\n", stderr)
+	assert.False(t, cached)
+
+	stderr, cached = splitStepStamp(fmt.Sprintf("%s%d\n", stepStampPrefix, startedAt.Add(-time.Hour).Unix()), startedAt)
+	assert.Empty(t, stderr)
+	assert.True(t, cached)
+
+	stderr, cached = splitStepStamp("no stamp", startedAt)
+	assert.Equal(t, "no stamp", stderr)
+	assert.False(t, cached)
+}
+
+func TestStepCacheKey(t *testing.T) {
+	base := stepCacheKey("ubuntu@sha256:abc", "apt-get install -y jq", "")
+	assert.Equal(t, base, stepCacheKey("ubuntu@sha256:abc", "apt-get install -y jq", ""))
+	assert.NotEqual(t, base, stepCacheKey("ubuntu@sha256:def", "apt-get install -y jq", ""))
+	assert.NotEqual(t, base, stepCacheKey("ubuntu@sha256:abc", "apt-get install -y jq", "sha256:123"))
+	assert.Len(t, shortKey(base), 12)
+}
+
+func TestCommandInputs(t *testing.T) {
+	config := DefaultConfig()
+	config.SetupCommands = []string{"pip install -r requirements.txt"}
+	config.InstallCommands = []string{"npm ci"}
+	config.CommandInputs.Set("pip install -r requirements.txt", []string{"requirements.txt"})
+	config.CommandInputs.Set("npm ci", []string{"package.json", "package-lock.json"})
+	config.CommandInputs.Set("go mod download", []string{"go.mod"})
+
+	copied := config.Copy()
+	copied.CommandInputs["npm ci"][0] = "changed"
+	assert.Equal(t, "package.json", config.CommandInputs["npm ci"][0])
+
+	config.CommandInputs.Prune(config.SetupCommands, config.InstallCommands)
+	assert.Len(t, config.CommandInputs, 2)
+	assert.NotContains(t, config.CommandInputs, "go mod download")
+
+	config.CommandInputs.Set("npm ci", nil)
+	assert.NotContains(t, config.CommandInputs, "npm ci")
+}
@@ -0,0 +1,182 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// snapshotScript lists the files under each snapshot path given as argument, one "checksum size path"
+// line per file (the output of cksum). Missing paths are skipped.
+const snapshotScript = `for root in "$@"; do
+	[ -e "$root" ] && find "$root" -type f -exec cksum {} + 2>/dev/null
+done
+exit 0`
+
+// maxNotedStateChanges caps the state changes listed in the notes of a command.
+const maxNotedStateChanges = 20
+
+// StateChange is a change of a file under a snapshot path, made by a command.
+type StateChange struct {
+	// Root is the snapshot path the file is under.
+	Root string `json:"root"`
+	Path string `json:"path"`
+	// Change is added, removed or changed, like drift changes.
+	Change       string `json:"change"`
+	Size         int64  `json:"size"`
+	PreviousSize int64  `json:"previous_size"`
+}
+
+type snapshotEntry struct {
+	checksum string
+	size     int64
+}
+
+// snapshot lists the files under the configured snapshot paths.
+// Listings are cached by the engine, so the state before a command was usually listed after the previous one.
+func (env *Environment) snapshot(ctx context.Context, container *dagger.Container) (map[string]snapshotEntry, error) {
+	return listFiles(ctx, container, env.snapshotRoots())
+}
+
+// listFiles lists the files under roots in container, by absolute path.
+func listFiles(ctx context.Context, container *dagger.Container, roots []string) (map[string]snapshotEntry, error) {
+	args := append([]string{"sh", "-c", snapshotScript, "sh"}, roots...)
+	output, err := container.WithExec(args).Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshot(output), nil
+}
+
+func (env *Environment) snapshotRoots() []string {
+	roots := make([]string, 0, len(env.State.Config.SnapshotPaths))
+	for _, root := range env.State.Config.SnapshotPaths {
+		if !path.IsAbs(root) {
+			root = path.Join(env.State.Config.Workdir, root)
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+func parseSnapshot(output string) map[string]snapshotEntry {
+	entries := map[string]snapshotEntry{}
+	for line := range strings.SplitSeq(output, "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries[fields[2]] = snapshotEntry{checksum: fields[0], size: size}
+	}
+	return entries
+}
+
+func diffSnapshots(roots []string, before, after map[string]snapshotEntry) []*StateChange {
+	changes := []*StateChange{}
+	for file, entry := range after {
+		previous, ok := before[file]
+		switch {
+		case !ok:
+			changes = append(changes, &StateChange{Root: rootOf(roots, file), Path: file, Change: DriftAdded, Size: entry.size})
+		case previous != entry:
+			changes = append(changes, &StateChange{Root: rootOf(roots, file), Path: file, Change: DriftChanged, Size: entry.size, PreviousSize: previous.size})
+		}
+	}
+	for file, entry := range before {
+		if _, ok := after[file]; !ok {
+			changes = append(changes, &StateChange{Root: rootOf(roots, file), Path: file, Change: DriftRemoved, PreviousSize: entry.size})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// rootOf returns the innermost snapshot path containing file.
+func rootOf(roots []string, file string) string {
+	var found string
+	for _, root := range roots {
+		if (file == root || strings.HasPrefix(file, strings.TrimSuffix(root, "/")+"/")) && len(root) > len(found) {
+			found = root
+		}
+	}
+	return found
+}
+
+// recordStateChanges reports the changes a command made to the snapshot paths, in the notes of the
+// command and as an event. Failing to snapshot never fails the command: the changes are only logged.
+func (env *Environment) recordStateChanges(ctx context.Context, command string, before, after *dagger.Container) {
+	if len(env.State.Config.SnapshotPaths) == 0 {
+		return
+	}
+
+	beforeSnapshot, err := env.snapshot(ctx, before)
+	if err != nil {
+		slog.Warn("Failed to snapshot state", "environment-id", env.ID, "command", command, "err", err)
+		return
+	}
+	afterSnapshot, err := env.snapshot(ctx, after)
+	if err != nil {
+		slog.Warn("Failed to snapshot state", "environment-id", env.ID, "command", command, "err", err)
+		return
+	}
+
+	changes := diffSnapshots(env.snapshotRoots(), beforeSnapshot, afterSnapshot)
+	if len(changes) == 0 {
+		return
+	}
+	env.Notes.Add("%s", FormatStateChanges(changes, maxNotedStateChanges))
+	env.emit(EventStateChanged, map[string]any{"command": command, "changes": changes})
+}
+
+// FormatStateChanges summarizes state changes: a line per snapshot path with the number of files
+// added, changed and removed and the size difference, followed by up to limit changed files
+// (all of them if limit is 0).
+func FormatStateChanges(changes []*StateChange, limit int) string {
+	type summary struct {
+		added, changed, removed int
+		delta                   int64
+	}
+	summaries := map[string]*summary{}
+	var roots []string
+	for _, change := range changes {
+		if summaries[change.Root] == nil {
+			summaries[change.Root] = &summary{}
+			roots = append(roots, change.Root)
+		}
+		s := summaries[change.Root]
+		switch change.Change {
+		case DriftAdded:
+			s.added++
+		case DriftChanged:
+			s.changed++
+		case DriftRemoved:
+			s.removed++
+		}
+		s.delta += change.Size - change.PreviousSize
+	}
+
+	var b strings.Builder
+	b.WriteString("State changes:")
+	for _, root := range roots {
+		s := summaries[root]
+		fmt.Fprintf(&b, "\n  %s: %d added, %d changed, %d removed (%+d bytes)", root, s.added, s.changed, s.removed, s.delta)
+	}
+	for i, change := range changes {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(changes)-limit)
+			break
+		}
+		fmt.Fprintf(&b, "\n  %-7s %s", change.Change, change.Path)
+	}
+	return b.String()
+}
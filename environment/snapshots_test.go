@@ -0,0 +1,44 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	roots := []string{"/var/lib/postgresql/data", "/root/.cache"}
+	before := parseSnapshot(`4294967295 8192 /var/lib/postgresql/data/base/1/1259
+1234 100 /var/lib/postgresql/data/postmaster.pid
+42 10 /root/.cache/tool/index
+`)
+	after := parseSnapshot(`4000000000 16384 /var/lib/postgresql/data/base/1/1259
+1234 100 /var/lib/postgresql/data/postmaster.pid
+77 300 /var/lib/postgresql/data/base/1/16384
+garbage
+`)
+
+	changes := diffSnapshots(roots, before, after)
+	assert.Equal(t, []*StateChange{
+		{Root: "/root/.cache", Path: "/root/.cache/tool/index", Change: DriftRemoved, PreviousSize: 10},
+		{Root: "/var/lib/postgresql/data", Path: "/var/lib/postgresql/data/base/1/1259", Change: DriftChanged, Size: 16384, PreviousSize: 8192},
+		{Root: "/var/lib/postgresql/data", Path: "/var/lib/postgresql/data/base/1/16384", Change: DriftAdded, Size: 300},
+	}, changes)
+
+	assert.Equal(t, `State changes:
+  /root/.cache: 0 added, 0 changed, 1 removed (-10 bytes)
+  /var/lib/postgresql/data: 1 added, 1 changed, 0 removed (+8492 bytes)
+  removed /root/.cache/tool/index
+  changed /var/lib/postgresql/data/base/1/1259
+  ... and 1 more`, FormatStateChanges(changes, 2))
+
+	assert.Empty(t, diffSnapshots(roots, before, before))
+}
+
+func TestRootOf(t *testing.T) {
+	roots := []string{"/data", "/data/db/", "/datastore"}
+	assert.Equal(t, "/data/db/", rootOf(roots, "/data/db/table"))
+	assert.Equal(t, "/data", rootOf(roots, "/data/other"))
+	assert.Equal(t, "/datastore", rootOf(roots, "/datastore/file"))
+	assert.Equal(t, "", rootOf(roots, "/tmp/file"))
+}
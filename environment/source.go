@@ -0,0 +1,10 @@
+package environment
+
+// Source is the git ref an environment was created from, and the commit it resolved to at the time.
+type Source struct {
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+	// Remote and RemoteURL are the remote the commit was fetched from, when the ref wasn't available locally.
+	Remote    string `json:"remote,omitempty"`
+	RemoteURL string `json:"remote_url,omitempty"`
+}
@@ -6,6 +6,11 @@ import (
 	"time"
 )
 
+// StateVersion is the version of the format of the states, and of the data directory holding them, this
+// container-use reads and writes. Formats changing incompatibly increment it, with a migration of the data
+// directory: see repository.Migrate.
+const StateVersion = 1
+
 type State struct {
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
@@ -13,7 +18,23 @@ type State struct {
 	Config         *EnvironmentConfig `json:"config,omitempty"`
 	Container      string             `json:"container,omitempty"`
 	Title          string             `json:"title,omitempty"`
+	Labels         []string           `json:"labels,omitempty"`
 	SubmodulePaths []string           `json:"submodule_paths,omitempty"`
+	// Engine is the engine of the pool hosting the environment, empty for the default engine.
+	Engine string `json:"engine,omitempty"`
+	// Agent is the MCP client that created the environment, empty for environments created from the CLI.
+	Agent string `json:"agent,omitempty"`
+	// Template is the environment template the environment was created from, if any.
+	Template string `json:"template,omitempty"`
+	// Conflicts are the files of the workdir, relative to it, left with conflicts by merging the changes of a
+	// terminal session. They're resolved once their conflict markers and .terminal copies are gone.
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Dependencies are the outputs of other environments copied into the container.
+	Dependencies []*Dependency `json:"dependencies,omitempty"`
+	// Source is the ref the environment was created from and its commit, unset for older environments.
+	Source *Source `json:"source,omitempty"`
+	// Jobs are the commands run in the background with exec --detach, oldest first.
+	Jobs []*Job `json:"jobs,omitempty"`
 }
 
 func (s *State) Marshal() ([]byte, error) {
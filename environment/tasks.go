@@ -0,0 +1,197 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TaskConfig is a named entry point of the project, such as build, test or lint, so agents run the blessed
+// command lines instead of inventing their own.
+type TaskConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Command     string `json:"command"`
+	// DependsOn are the tasks that run before this one, in order.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Services are started for the task's command only, e.g. a browser for end-to-end tests.
+	Services ServiceConfigs `json:"services,omitempty"`
+}
+
+type TaskConfigs []*TaskConfig
+
+func (tc TaskConfigs) Get(name string) *TaskConfig {
+	for _, task := range tc {
+		if task.Name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the tasks.
+func (tc TaskConfigs) Names() []string {
+	names := make([]string, 0, len(tc))
+	for _, task := range tc {
+		names = append(names, task.Name)
+	}
+	return names
+}
+
+// Validate checks that tasks have a unique name, a command and valid services, and that their dependencies
+// exist and don't form a cycle.
+func (tc TaskConfigs) Validate() error {
+	seen := map[string]bool{}
+	for _, task := range tc {
+		switch {
+		case task.Name == "":
+			return errors.New("tasks must have a name")
+		case task.Command == "":
+			return fmt.Errorf("task %q has no command", task.Name)
+		case seen[task.Name]:
+			return fmt.Errorf("task %q is defined more than once", task.Name)
+		}
+		if err := task.Services.Validate(); err != nil {
+			return fmt.Errorf("task %q: %w", task.Name, err)
+		}
+		seen[task.Name] = true
+	}
+	for _, task := range tc {
+		if _, err := tc.Plan(task.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Plan returns the tasks to run for the named one: its dependencies first, each of them once, then the task.
+func (tc TaskConfigs) Plan(name string) ([]*TaskConfig, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	var plan []*TaskConfig
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		task := tc.Get(name)
+		if task == nil {
+			if len(path) == 0 {
+				return fmt.Errorf("unknown task %q, expected one of: %s", name, strings.Join(tc.Names(), ", "))
+			}
+			return fmt.Errorf("task %q depends on unknown task %q", path[len(path)-1], name)
+		}
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("tasks depend on each other: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dependency := range task.DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		plan = append(plan, task)
+		return nil
+	}
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// TaskRun is the outcome of one of the tasks run by RunTask.
+type TaskRun struct {
+	Task       string `json:"task"`
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// TaskResult is the outcome of RunTask: the tasks run in order, up to the first one failing.
+type TaskResult struct {
+	Task string     `json:"task"`
+	Runs []*TaskRun `json:"runs"`
+	// Skipped are the tasks that didn't run because a dependency failed.
+	Skipped []string `json:"skipped"`
+}
+
+// Failed returns the task that failed, if any.
+func (r *TaskResult) Failed() *TaskRun {
+	for _, run := range r.Runs {
+		if run.ExitCode != 0 {
+			return run
+		}
+	}
+	return nil
+}
+
+// RunTask runs a task of the environment's configuration after its dependencies, stopping at the first one
+// that fails. The services of each task are only started for its command.
+func (env *Environment) RunTask(ctx context.Context, name, shell string) (*TaskResult, error) {
+	plan, err := env.State.Config.Tasks.Plan(name)
+	if err != nil {
+		return nil, err
+	}
+	result := &TaskResult{Task: name, Runs: []*TaskRun{}, Skipped: []string{}}
+	for i, task := range plan {
+		run, err := env.runTask(ctx, task, shell)
+		if err != nil {
+			return result, fmt.Errorf("task %s: %w", task.Name, err)
+		}
+		result.Runs = append(result.Runs, run)
+		if run.ExitCode != 0 {
+			for _, skipped := range plan[i+1:] {
+				result.Skipped = append(result.Skipped, skipped.Name)
+			}
+			break
+		}
+	}
+	return result, nil
+}
+
+func (env *Environment) runTask(ctx context.Context, task *TaskConfig, shell string) (*TaskRun, error) {
+	container := env.container()
+	for _, cfg := range task.Services {
+		service, err := env.startService(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start service %s: %w", cfg.Name, err)
+		}
+		defer service.svc.Stop(context.WithoutCancel(ctx))
+		container = container.WithServiceBinding(cfg.Name, service.svc)
+	}
+
+	startedAt := time.Now()
+	args := env.State.Config.execArgs([]string{shell, "-c", task.Command})
+	newState, stdout, stderr, exitCode, err := env.exec(ctx, container, task.Command, args, false)
+	if err != nil {
+		return nil, err
+	}
+	env.Notes.AddCommand(task.Command, exitCode, stdout, stderr)
+
+	if len(task.Services) > 0 {
+		// Keep the files of the task, not the bindings of its services, which would start again with the
+		// next commands.
+		newState = env.container().WithRootfs(newState.Rootfs())
+	}
+	env.recordStateChanges(ctx, task.Command, env.container(), newState)
+	if err := env.apply(ctx, newState); err != nil {
+		return nil, fmt.Errorf("failed to apply container state: %w", err)
+	}
+
+	return &TaskRun{
+		Task:       task.Name,
+		Command:    task.Command,
+		ExitCode:   exitCode,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		DurationMS: time.Since(startedAt).Milliseconds(),
+	}, nil
+}
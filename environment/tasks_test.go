@@ -0,0 +1,86 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func taskNames(tasks []*TaskConfig) []string {
+	return TaskConfigs(tasks).Names()
+}
+
+func TestTaskConfigs_Plan(t *testing.T) {
+	tasks := TaskConfigs{
+		{Name: "deps", Command: "go mod download"},
+		{Name: "generate", Command: "go generate ./...", DependsOn: []string{"deps"}},
+		{Name: "build", Command: "go build ./...", DependsOn: []string{"deps", "generate"}},
+		{Name: "test", Command: "go test ./...", DependsOn: []string{"generate", "build"}},
+	}
+	require.NoError(t, tasks.Validate())
+
+	plan, err := tasks.Plan("test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deps", "generate", "build", "test"}, taskNames(plan), "dependencies run once, before the task")
+
+	plan, err = tasks.Plan("deps")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deps"}, taskNames(plan))
+
+	_, err = tasks.Plan("lint")
+	assert.EqualError(t, err, `unknown task "lint", expected one of: deps, generate, build, test`)
+}
+
+func TestTaskConfigs_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tasks TaskConfigs
+		err   string
+	}{
+		{
+			name:  "missing command",
+			tasks: TaskConfigs{{Name: "build"}},
+			err:   `task "build" has no command`,
+		},
+		{
+			name:  "duplicate",
+			tasks: TaskConfigs{{Name: "build", Command: "make"}, {Name: "build", Command: "make all"}},
+			err:   `task "build" is defined more than once`,
+		},
+		{
+			name:  "unknown dependency",
+			tasks: TaskConfigs{{Name: "test", Command: "make test", DependsOn: []string{"build"}}},
+			err:   `task "test" depends on unknown task "build"`,
+		},
+		{
+			name: "cycle",
+			tasks: TaskConfigs{
+				{Name: "a", Command: "true", DependsOn: []string{"b"}},
+				{Name: "b", Command: "true", DependsOn: []string{"a"}},
+			},
+			err: "tasks depend on each other: a -> b -> a",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.EqualError(t, tc.tasks.Validate(), tc.err)
+		})
+	}
+}
+
+func TestEnvironmentConfig_CopyTasks(t *testing.T) {
+	config := DefaultConfig()
+	config.Tasks = TaskConfigs{
+		{Name: "e2e", Command: "npm run e2e", DependsOn: []string{"build"}, Services: ServiceConfigs{{Name: "browser", Image: "selenium/standalone-chrome"}}},
+		{Name: "build", Command: "npm run build"},
+	}
+
+	copied := config.Copy()
+	copied.Tasks[0].DependsOn[0] = "lint"
+	copied.Tasks[0].Services[0].Name = "chrome"
+	copied.Tasks[1].Command = "make"
+
+	assert.Equal(t, []string{"build"}, config.Tasks[0].DependsOn)
+	assert.Equal(t, "browser", config.Tasks[0].Services[0].Name)
+	assert.Equal(t, "npm run build", config.Tasks[1].Command)
+}
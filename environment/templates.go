@@ -0,0 +1,135 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"dagger.io/dagger"
+)
+
+// templateSuffix marks the files of a project template rendered with text/template. The suffix is removed
+// from their name, and keeps the Go files of templates out of the build.
+const templateSuffix = ".tmpl"
+
+//go:embed all:templates
+var projectTemplatesFS embed.FS
+
+// ProjectTemplate scaffolds a new project: the configuration of its repository, and starter files
+// written to the workdir of a new environment.
+type ProjectTemplate struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Config      *EnvironmentConfig `json:"config"`
+	files       fs.FS
+}
+
+// ProjectTemplateVars are the values the starter files of a project template are rendered with.
+type ProjectTemplateVars struct {
+	// Name is the name of the project, e.g. the directory it's created in.
+	Name string
+	// Module is the import path or package name of the project, defaulting to Name.
+	Module string
+}
+
+// ProjectTemplates returns the available project templates, sorted by name.
+func ProjectTemplates() ([]*ProjectTemplate, error) {
+	entries, err := fs.ReadDir(projectTemplatesFS, "templates")
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]*ProjectTemplate, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		tmpl, err := GetProjectTemplate(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// GetProjectTemplate returns the project template with the given name.
+func GetProjectTemplate(name string) (*ProjectTemplate, error) {
+	files, err := fs.Sub(projectTemplatesFS, path.Join("templates", name))
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(files, "template.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+	tmpl := &ProjectTemplate{Name: name, Config: DefaultConfig(), files: files}
+	if err := json.Unmarshal(data, tmpl); err != nil {
+		return nil, fmt.Errorf("invalid template %q: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Files renders the starter files of the template, by path relative to the workdir.
+func (t *ProjectTemplate) Files(vars ProjectTemplateVars) (map[string]string, error) {
+	if vars.Module == "" {
+		vars.Module = vars.Name
+	}
+	files := map[string]string{}
+	err := fs.WalkDir(t.files, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || name == "template.json" {
+			return err
+		}
+		data, err := fs.ReadFile(t.files, name)
+		if err != nil {
+			return err
+		}
+		target, ok := strings.CutSuffix(name, templateSuffix)
+		if !ok {
+			files[name] = string(data)
+			return nil
+		}
+		parsed, err := template.New(name).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid template file %s: %w", name, err)
+		}
+		var b bytes.Buffer
+		if err := parsed.Execute(&b, vars); err != nil {
+			return fmt.Errorf("failed to render %s: %w", name, err)
+		}
+		files[target] = b.String()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// WriteFiles writes files, by path relative to the workdir, in a single change of the environment.
+func (env *Environment) WriteFiles(ctx context.Context, files map[string]string) error {
+	paths := make([]string, 0, len(files))
+	for file := range files {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+
+	container := env.container()
+	for _, file := range paths {
+		container = container.WithNewFile(path.Join(env.State.Config.Workdir, file), files[file], dagger.ContainerWithNewFileOpts{
+			Owner: env.State.Config.fileOwner(),
+		})
+	}
+	if err := env.apply(ctx, container); err != nil {
+		return fmt.Errorf("failed applying file writes, skipping git propagation: %w", err)
+	}
+	env.Notes.Add("Write %s", strings.Join(paths, ", "))
+	return nil
+}
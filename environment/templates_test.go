@@ -0,0 +1,42 @@
+package environment
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectTemplates(t *testing.T) {
+	templates, err := ProjectTemplates()
+	require.NoError(t, err)
+	require.NotEmpty(t, templates)
+	for _, tmpl := range templates {
+		assert.NotEmpty(t, tmpl.Description, tmpl.Name)
+		files, err := tmpl.Files(ProjectTemplateVars{Name: "example"})
+		require.NoError(t, err, tmpl.Name)
+		assert.NotEmpty(t, files, tmpl.Name)
+	}
+
+	_, err = GetProjectTemplate("cobol-mainframe")
+	assert.ErrorContains(t, err, `unknown template "cobol-mainframe"`)
+}
+
+func TestGoServiceTemplate(t *testing.T) {
+	tmpl, err := GetProjectTemplate("go-service")
+	require.NoError(t, err)
+	assert.Equal(t, "/workdir", tmpl.Config.Workdir)
+	assert.Contains(t, tmpl.Config.BaseImage, "golang")
+
+	files, err := tmpl.Files(ProjectTemplateVars{Name: "billing", Module: "github.com/acme/billing"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{".gitignore", "Makefile", "README.md", "go.mod", "main.go", "main_test.go"}, slices.Collect(maps.Keys(files)))
+	assert.Contains(t, files["go.mod"], "module github.com/acme/billing\n")
+	assert.Contains(t, files["README.md"], "# billing\n")
+
+	files, err = tmpl.Files(ProjectTemplateVars{Name: "billing"})
+	require.NoError(t, err)
+	assert.Contains(t, files["go.mod"], "module billing\n", "the module defaults to the name")
+}
@@ -0,0 +1,253 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+const (
+	// terminalCopyPath is where the workdir of a terminal session is copied once the session ends.
+	terminalCopyPath = "/.container-use/terminal"
+	// ConflictCopySuffix is appended to the path of a file that couldn't be merged line by line, for the
+	// version of the terminal session written next to the environment's.
+	ConflictCopySuffix = ".terminal"
+)
+
+// conflictCheckScript prints the files ($@, relative to the workdir $0) that still have conflict markers or
+// a copy of the terminal's version.
+const conflictCheckScript = `cd "$0" || exit 0
+for file in "$@"; do
+	if grep -qs '^<<<<<<< ' "$file" || [ -e "$file` + ConflictCopySuffix + `" ]; then echo "$file"; fi
+done
+exit 0`
+
+// TerminalSession is the workdir of an environment before and after an interactive terminal session.
+type TerminalSession struct {
+	// Base is the workdir when the session started.
+	Base *dagger.Directory
+	// Workdir is the workdir as the session left it.
+	Workdir *dagger.Directory
+}
+
+// TerminalMerge is the outcome of merging the changes of a terminal session into an environment.
+type TerminalMerge struct {
+	// Merged are the files of the workdir changed in the session whose changes were kept, relative to it.
+	Merged []string `json:"merged"`
+	// Conflicts are the files changed both in the session and in the environment meanwhile, e.g. by the
+	// agent, where the changes overlap. Text files are left with conflict markers; for others, the
+	// environment's version is kept and the session's is written next to it with ConflictCopySuffix.
+	Conflicts []string `json:"conflicts"`
+}
+
+// terminalContainer returns the container of a terminal session, with the workdir on a cache volume the
+// session's changes are kept in.
+func (env *Environment) terminalContainer() (*dagger.Container, *TerminalSession, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, nil, err
+	}
+	container := env.container()
+	session := &TerminalSession{Base: container.Directory(env.State.Config.Workdir)}
+	volume := env.dag.CacheVolume("container-use-terminal-" + env.ID + "-" + hex.EncodeToString(b))
+	container = container.WithMountedCache(env.State.Config.Workdir, volume, dagger.ContainerWithMountedCacheOpts{
+		Source: session.Base,
+		Owner:  env.State.Config.fileOwner(),
+	})
+	return container, session, nil
+}
+
+// capture copies the workdir of the session out of its cache volume.
+func (s *TerminalSession) capture(ctx context.Context, container *dagger.Container, workdir string) error {
+	workdirCopy := container.
+		WithExec([]string{"cp", "-a", strings.TrimSuffix(workdir, "/") + "/.", terminalCopyPath}).
+		Directory(terminalCopyPath)
+	if _, err := workdirCopy.Sync(ctx); err != nil {
+		return err
+	}
+	s.Workdir = workdirCopy
+	return nil
+}
+
+// MergeTerminal merges the changes a terminal session made to the workdir into the environment, which may
+// have changed since the session started, e.g. by commands of the agent. Changes made on one side only are
+// kept. Files changed on both sides are merged line by line, with conflict markers where the changes
+// overlap, instead of one side overwriting the other. The files left with conflicts are recorded in the
+// state until they're resolved.
+func (env *Environment) MergeTerminal(ctx context.Context, session *TerminalSession) (*TerminalMerge, error) {
+	workdir := env.State.Config.Workdir
+	roots := []string{workdir}
+	current := env.container()
+	withWorkdir := func(dir *dagger.Directory) *dagger.Container {
+		return current.WithoutDirectory(workdir).WithDirectory(workdir, dir)
+	}
+	base, edited := withWorkdir(session.Base), withWorkdir(session.Workdir)
+
+	before, err := listFiles(ctx, base, roots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workdir files before the terminal: %w", err)
+	}
+	after := make([]map[string]snapshotEntry, 2)
+	for i, container := range []*dagger.Container{current, edited} {
+		if after[i], err = listFiles(ctx, container, roots); err != nil {
+			return nil, fmt.Errorf("failed to list workdir files: %w", err)
+		}
+	}
+
+	// Changes of the environment, and the ones it has in common with the session, are already applied.
+	merges, conflicts := planParallelMerge(before, after)
+	merges = slices.DeleteFunc(merges, func(merge parallelMerge) bool { return merge.from == 0 })
+	owner := env.State.Config.fileOwner()
+	merged := mergeParallelChanges(current, workdir, []*dagger.Container{current, edited}, merges, owner)
+
+	result := &TerminalMerge{Merged: []string{}, Conflicts: []string{}}
+	for _, merge := range merges {
+		result.Merged = append(result.Merged, relativeTo(workdir, merge.path))
+	}
+	files := make([]string, 0, len(conflicts))
+	for file := range conflicts {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		var conflicted bool
+		merged, conflicted, err = mergeConflictingFile(ctx, merged, file, owner, [3]*dagger.Container{base, current, edited}, [3]map[string]snapshotEntry{before, after[0], after[1]})
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge %s: %w", relativeTo(workdir, file), err)
+		}
+		if conflicted {
+			result.Conflicts = append(result.Conflicts, relativeTo(workdir, file))
+		} else {
+			result.Merged = append(result.Merged, relativeTo(workdir, file))
+		}
+	}
+	sort.Strings(result.Merged)
+	if len(result.Merged) == 0 && len(result.Conflicts) == 0 {
+		return result, nil
+	}
+
+	if len(result.Merged) > 0 {
+		env.Notes.Add("Merge changes made in a terminal to %s", strings.Join(result.Merged, ", "))
+	}
+	if len(result.Conflicts) > 0 {
+		env.Notes.Add("Changes made in a terminal conflict with changes made meanwhile, resolve the conflict markers (or %s copies) in: %s", ConflictCopySuffix, strings.Join(result.Conflicts, ", "))
+	}
+	env.mu.Lock()
+	for _, file := range result.Conflicts {
+		if !slices.Contains(env.State.Conflicts, file) {
+			env.State.Conflicts = append(env.State.Conflicts, file)
+		}
+	}
+	env.mu.Unlock()
+	env.recordStateChanges(ctx, "terminal", current, merged)
+
+	if err := env.apply(ctx, merged); err != nil {
+		return result, fmt.Errorf("failed to apply container state: %w", err)
+	}
+	return result, nil
+}
+
+// mergeConflictingFile merges a file changed both in the environment and in a terminal session into
+// container, given the base, environment and session versions of the workdir and their files. It reports
+// whether the changes conflict.
+func mergeConflictingFile(ctx context.Context, container *dagger.Container, file, owner string, versions [3]*dagger.Container, files [3]map[string]snapshotEntry) (*dagger.Container, bool, error) {
+	var contents [3]string
+	text := true
+	for i, version := range versions {
+		if _, ok := files[i][file]; !ok {
+			// A file added on both sides is merged from an empty base, but one removed on a side can't be
+			// merged line by line.
+			if i > 0 {
+				text = false
+			}
+			continue
+		}
+		var err error
+		if contents[i], err = version.File(file).Contents(ctx); err != nil {
+			return nil, false, err
+		}
+		text = text && !strings.ContainsRune(contents[i], 0)
+	}
+
+	if text {
+		mergedContents, conflicted, err := mergeFile(ctx, contents[0], contents[1], contents[2])
+		if err != nil {
+			return nil, false, err
+		}
+		return container.WithNewFile(file, mergedContents, dagger.ContainerWithNewFileOpts{Owner: owner}), conflicted, nil
+	}
+
+	// The environment's version is kept, and the session's written next to it.
+	if _, ok := files[2][file]; ok {
+		container = container.WithFile(file+ConflictCopySuffix, versions[2].File(file), dagger.ContainerWithFileOpts{Owner: owner})
+	}
+	return container, true, nil
+}
+
+// mergeFile merges the changes from base to ours and to theirs line by line with git merge-file. Where
+// they overlap, the result has conflict markers and conflicted is true.
+func mergeFile(ctx context.Context, base, ours, theirs string) (merged string, conflicted bool, err error) {
+	dir, err := os.MkdirTemp("", "container-use-merge-")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"merge-file", "-p", "-L", "environment", "-L", "base", "-L", "terminal"}
+	for name, contents := range map[string]string{"environment": ours, "base": base, "terminal": theirs} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			return "", false, err
+		}
+	}
+	args = append(args, filepath.Join(dir, "environment"), filepath.Join(dir, "base"), filepath.Join(dir, "terminal"))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return stdout.String(), false, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128:
+		// The exit code is the number of conflicts.
+		return stdout.String(), true, nil
+	default:
+		return "", false, fmt.Errorf("git merge-file failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+}
+
+// openConflicts returns the files of the state's conflicts that aren't resolved in container yet. Failing
+// to check keeps them all.
+func (env *Environment) openConflicts(ctx context.Context, container *dagger.Container) []string {
+	env.mu.RLock()
+	conflicts := env.State.Conflicts
+	env.mu.RUnlock()
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	args := append([]string{"sh", "-c", conflictCheckScript, env.State.Config.Workdir}, conflicts...)
+	output, err := container.WithExec(args).Stdout(ctx)
+	if err != nil {
+		slog.Warn("Failed to check conflicts", "environment-id", env.ID, "err", err)
+		return conflicts
+	}
+	var open []string
+	for line := range strings.Lines(output) {
+		open = append(open, strings.TrimSuffix(line, "\n"))
+	}
+	return open
+}
@@ -0,0 +1,54 @@
+package environment
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeFile(t *testing.T) {
+	ctx := context.Background()
+	base := "one\ntwo\nthree\nfour\nfive\n"
+
+	merged, conflicted, err := mergeFile(ctx, base, "ONE\ntwo\nthree\nfour\nfive\n", "one\ntwo\nthree\nfour\nFIVE\n")
+	require.NoError(t, err)
+	assert.False(t, conflicted, "changes to different lines are merged")
+	assert.Equal(t, "ONE\ntwo\nthree\nfour\nFIVE\n", merged)
+
+	merged, conflicted, err = mergeFile(ctx, base, "one\ntwo\nagent\nfour\nfive\n", "one\ntwo\nhuman\nfour\nfive\n")
+	require.NoError(t, err)
+	assert.True(t, conflicted)
+	assert.Equal(t, "one\ntwo\n<<<<<<< environment\nagent\n=======\nhuman\n>>>>>>> terminal\nfour\nfive\n", merged)
+
+	merged, conflicted, err = mergeFile(ctx, "", "added\n", "added\n")
+	require.NoError(t, err)
+	assert.False(t, conflicted, "identical files added on both sides")
+	assert.Equal(t, "added\n", merged)
+}
+
+func TestConflictCheckScript(t *testing.T) {
+	workdir := t.TempDir()
+	files := map[string]string{
+		"resolved.txt":          "merged by hand\n",
+		"markers.txt":           "<<<<<<< environment\nagent\n=======\nhuman\n>>>>>>> terminal\n",
+		"image.png":             "\x89PNG",
+		"image.png.terminal":    "\x89PNG",
+		"with space/notes.md":   "<<<<<<< environment\n",
+		"quoted <<<<<<< .txt":   "not at the start: <<<<<<< environment\n",
+		"removed.png.terminal2": "",
+	}
+	for file, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(workdir, file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(workdir, file), []byte(contents), 0644))
+	}
+
+	output, err := exec.Command("sh", "-c", conflictCheckScript, workdir,
+		"resolved.txt", "markers.txt", "image.png", "with space/notes.md", "quoted <<<<<<< .txt", "removed.png").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "markers.txt\nimage.png\nwith space/notes.md\n", string(output))
+}
@@ -0,0 +1,125 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimedOutExitCode is the exit code of commands stopped by their timeout, like timeout(1)'s.
+const TimedOutExitCode = 124
+
+// DefaultTimeoutGracePeriod is how long commands have to stop after their timeout signal, unless configured.
+const DefaultTimeoutGracePeriod = 10 * time.Second
+
+// timeoutSignals are the signals commands can be asked to stop with.
+var timeoutSignals = []string{"TERM", "INT", "HUP", "QUIT", "USR1", "USR2", "KILL"}
+
+// timeoutScript runs a command ($@, after the timeout in seconds, the signal and the grace period in seconds)
+// in the background, so a watcher can signal it once the timeout expired and kill it after the grace period.
+// With setsid, the command runs in its own process group, so the processes it started are stopped with it.
+// The command gets the script's stdin, which background commands don't otherwise. A marker left by the
+// watcher tells a timeout from the command's own exit, which is then reported with TimedOutExitCode.
+const timeoutScript = `timeout=$1 signal=$2 grace=$3
+shift 3
+marker="${TMPDIR:-/tmp}/.container-use-timeout.$$"
+exec 3<&0
+if command -v setsid >/dev/null 2>&1; then
+	setsid "$@" 0<&3 3<&- &
+	pid=$! target=-$!
+else
+	"$@" 0<&3 3<&- &
+	pid=$! target=$!
+fi
+(sleep "$timeout" && : >"$marker" && kill -s "$signal" -- "$target" && sleep "$grace" && kill -s KILL -- "$target") </dev/null >/dev/null 2>&1 &
+watcher=$!
+wait "$pid"
+status=$?
+kill "$watcher" 2>/dev/null
+if [ -e "$marker" ]; then
+	rm -f "$marker"
+	echo "container-use: the command timed out after ${timeout}s and was stopped with SIG$signal" >&2
+	exit 124
+fi
+exit "$status"`
+
+// CommandTimeout stops the commands of the agent and the user running for too long, such as commands stuck
+// on an interactive prompt or servers started in the foreground. The changes they made until then are kept.
+type CommandTimeout struct {
+	// DurationMS is how long commands may run.
+	DurationMS int64 `json:"duration_ms"`
+	// Signal asks the command to stop once the timeout expired, TERM if unset.
+	Signal string `json:"signal,omitempty"`
+	// GracePeriodMS is how long the command has to stop after the signal before it's killed,
+	// DefaultTimeoutGracePeriod if unset.
+	GracePeriodMS int64 `json:"grace_period_ms,omitempty"`
+}
+
+// Validate checks the timeout is at least a second, and its signal one commands can be stopped with.
+func (t *CommandTimeout) Validate() error {
+	if t.DurationMS < time.Second.Milliseconds() {
+		return fmt.Errorf("the timeout must be at least 1s")
+	}
+	if t.GracePeriodMS < 0 {
+		return fmt.Errorf("the grace period can't be negative")
+	}
+	if t.Signal != "" && !slices.Contains(timeoutSignals, t.Signal) {
+		return fmt.Errorf("unsupported signal %q: expected one of %s", t.Signal, strings.Join(timeoutSignals, ", "))
+	}
+	return nil
+}
+
+// Duration returns how long commands may run.
+func (t *CommandTimeout) Duration() time.Duration {
+	return time.Duration(t.DurationMS) * time.Millisecond
+}
+
+// StopSignal returns the signal asking the command to stop.
+func (t *CommandTimeout) StopSignal() string {
+	if t.Signal == "" {
+		return "TERM"
+	}
+	return t.Signal
+}
+
+// GracePeriod returns how long the command has to stop after the signal.
+func (t *CommandTimeout) GracePeriod() time.Duration {
+	if t.GracePeriodMS == 0 {
+		return DefaultTimeoutGracePeriod
+	}
+	return time.Duration(t.GracePeriodMS) * time.Millisecond
+}
+
+// ParseTimeoutSignal normalizes a signal name such as SIGINT or int to INT.
+func ParseTimeoutSignal(signal string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(signal)), "SIG")
+}
+
+// wrap wraps exec args with timeoutScript. Durations are rounded up to whole seconds, which any sleep
+// supports.
+func (t *CommandTimeout) wrap(args []string) []string {
+	seconds := func(d time.Duration) string {
+		return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+	}
+	return append([]string{"sh", "-c", timeoutScript, "container-use-timeout", seconds(t.Duration()), t.StopSignal(), seconds(t.GracePeriod())}, args...)
+}
+
+type commandTimeoutKey struct{}
+
+// WithCommandTimeout returns a context running commands with timeout instead of the environment's.
+func WithCommandTimeout(ctx context.Context, timeout *CommandTimeout) context.Context {
+	return context.WithValue(ctx, commandTimeoutKey{}, timeout)
+}
+
+// CommandTimeout returns the timeout of the commands run with ctx: the context's, or else the environment's.
+// It's nil when commands may run for any time.
+func (env *Environment) CommandTimeout(ctx context.Context) *CommandTimeout {
+	if timeout, ok := ctx.Value(commandTimeoutKey{}).(*CommandTimeout); ok {
+		return timeout
+	}
+	return env.State.Config.CommandTimeout
+}
@@ -0,0 +1,62 @@
+package environment
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandTimeoutValidate(t *testing.T) {
+	assert.NoError(t, (&CommandTimeout{DurationMS: 1000}).Validate())
+	assert.NoError(t, (&CommandTimeout{DurationMS: 60000, Signal: "INT", GracePeriodMS: 0}).Validate())
+	assert.ErrorContains(t, (&CommandTimeout{DurationMS: 500}).Validate(), "at least 1s")
+	assert.ErrorContains(t, (&CommandTimeout{DurationMS: 1000, Signal: "STOP"}).Validate(), `unsupported signal "STOP"`)
+	assert.Error(t, (&CommandTimeout{DurationMS: 1000, GracePeriodMS: -1}).Validate())
+
+	assert.Equal(t, "INT", ParseTimeoutSignal("sigint"))
+	assert.Equal(t, "TERM", ParseTimeoutSignal(" TERM "))
+}
+
+func TestCommandTimeoutScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the script runs in Linux containers")
+	}
+	run := func(timeout *CommandTimeout, stdin string, args ...string) (string, int) {
+		t.Helper()
+		wrapped := timeout.wrap(args)
+		cmd := exec.Command(wrapped[0], wrapped[1:]...)
+		cmd.Env = append(cmd.Environ(), "TMPDIR="+t.TempDir())
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode()
+		}
+		require.NoError(t, err)
+		return string(out), 0
+	}
+	timeout := &CommandTimeout{DurationMS: 1500, GracePeriodMS: 1000}
+
+	out, exitCode := run(timeout, "answer\n", "sh", "-c", "read line; echo got $line; exit 3")
+	assert.Equal(t, 3, exitCode, "the command's own exit code is kept")
+	assert.Equal(t, "got answer\n", out, "the command reads the stdin")
+
+	startedAt := time.Now()
+	out, exitCode = run(timeout, "", "sh", "-c", "echo started; exec sleep 30")
+	assert.Equal(t, TimedOutExitCode, exitCode)
+	assert.Contains(t, out, "started\n")
+	assert.Contains(t, out, "timed out after 2s and was stopped with SIGTERM")
+	assert.Less(t, time.Since(startedAt), 10*time.Second)
+
+	// Commands ignoring the signal are killed after the grace period.
+	startedAt = time.Now()
+	_, exitCode = run(timeout, "", "sh", "-c", "trap '' TERM; while :; do sleep 1; done")
+	assert.Equal(t, TimedOutExitCode, exitCode)
+	assert.Less(t, time.Since(startedAt), 10*time.Second)
+}
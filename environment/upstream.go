@@ -0,0 +1,234 @@
+package environment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	upstreamFile       = "upstream.json"
+	upstreamConfigFile = "upstream-environment.json"
+	ociPrefix          = "oci://"
+)
+
+// UpstreamConfig is a shared configuration, e.g. an organization's defaults, that the repository's
+// configuration is layered on: repository settings override upstream settings key by key.
+type UpstreamConfig struct {
+	// Source is a git URL, or an OCI artifact reference prefixed with oci://.
+	Source string `json:"source"`
+	// Ref is the git branch or tag to sync from (default: the remote's default branch).
+	Ref string `json:"ref,omitempty"`
+	// Path is the path of the configuration in the git repository or the artifact (default environment.json).
+	Path string `json:"path,omitempty"`
+	// Revision is the git commit or image reference last synced.
+	Revision string    `json:"revision,omitempty"`
+	SyncedAt time.Time `json:"synced_at,omitzero"`
+}
+
+// IsOCI reports whether the upstream configuration is distributed as an OCI artifact.
+func (upstream *UpstreamConfig) IsOCI() bool {
+	return strings.HasPrefix(upstream.Source, ociPrefix)
+}
+
+// OCIRef returns the reference of the OCI artifact.
+func (upstream *UpstreamConfig) OCIRef() string {
+	return strings.TrimPrefix(upstream.Source, ociPrefix)
+}
+
+// ConfigPath returns the path of the configuration in the source.
+func (upstream *UpstreamConfig) ConfigPath() string {
+	if upstream.Path != "" {
+		return upstream.Path
+	}
+	if upstream.IsOCI() {
+		return "/" + environmentFile
+	}
+	return environmentFile
+}
+
+func (upstream *UpstreamConfig) String() string {
+	s := upstream.Source
+	if upstream.Ref != "" {
+		s += "@" + upstream.Ref
+	}
+	return s + ":" + upstream.ConfigPath()
+}
+
+// LoadUpstream returns the upstream configuration of the repository at baseDir, or nil if it has none.
+func LoadUpstream(baseDir string) (*UpstreamConfig, error) {
+	data, err := os.ReadFile(filepath.Join(ConfigDir(baseDir), upstreamFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	upstream := &UpstreamConfig{}
+	if err := json.Unmarshal(data, upstream); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", upstreamFile, err)
+	}
+	return upstream, nil
+}
+
+// SaveUpstream records the upstream configuration and its synced settings in the repository at baseDir.
+func SaveUpstream(baseDir string, upstream *UpstreamConfig, settings []byte) error {
+	if err := os.MkdirAll(ConfigDir(baseDir), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(upstream, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(ConfigDir(baseDir), upstreamFile), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ConfigDir(baseDir), upstreamConfigFile), settings, 0644)
+}
+
+// RemoveUpstream stops layering the repository's configuration on an upstream configuration.
+func RemoveUpstream(baseDir string) error {
+	for _, name := range []string{upstreamFile, upstreamConfigFile} {
+		if err := os.Remove(filepath.Join(ConfigDir(baseDir), name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadUpstreamSettings returns the upstream settings last synced in the repository at baseDir, or nil.
+func LoadUpstreamSettings(baseDir string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(ConfigDir(baseDir), upstreamConfigFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// ValidateSettings checks that data is a valid environment configuration.
+func ValidateSettings(data []byte) error {
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config.ValidateNetwork()
+}
+
+// Setting changes.
+const (
+	SettingAdded   = "added"
+	SettingRemoved = "removed"
+	SettingChanged = "changed"
+)
+
+// SettingChange is a change of a top-level configuration setting.
+type SettingChange struct {
+	Key    string          `json:"key"`
+	Change string          `json:"change"`
+	Old    json.RawMessage `json:"old,omitempty"`
+	New    json.RawMessage `json:"new,omitempty"`
+	// Overridden is set when the repository's configuration overrides the setting, so the change has no effect.
+	Overridden bool `json:"overridden"`
+}
+
+// DiffSettings returns the settings that differ between two configurations,
+// flagging the ones overridden by the repository's configuration at baseDir.
+func DiffSettings(baseDir string, old, new []byte) ([]*SettingChange, error) {
+	oldSettings, err := settingsMap(old)
+	if err != nil {
+		return nil, err
+	}
+	newSettings, err := settingsMap(new)
+	if err != nil {
+		return nil, err
+	}
+	local, err := os.ReadFile(filepath.Join(ConfigDir(baseDir), environmentFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	localSettings, err := settingsMap(local)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for key := range oldSettings {
+		keys[key] = true
+	}
+	for key := range newSettings {
+		keys[key] = true
+	}
+
+	changes := []*SettingChange{}
+	for key := range keys {
+		oldValue, hadOld := oldSettings[key]
+		newValue, hasNew := newSettings[key]
+		change := &SettingChange{Key: key, Old: oldValue, New: newValue}
+		switch {
+		case !hadOld:
+			change.Change = SettingAdded
+		case !hasNew:
+			change.Change = SettingRemoved
+		case !jsonEqual(oldValue, newValue):
+			change.Change = SettingChanged
+		default:
+			continue
+		}
+		_, change.Overridden = localSettings[key]
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes, nil
+}
+
+func settingsMap(data []byte) (map[string]json.RawMessage, error) {
+	settings := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return settings, nil
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return settings, nil
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// withoutUpstreamSettings removes the settings of the encoded configuration that are identical upstream,
+// so upstream changes keep applying to them.
+func withoutUpstreamSettings(data, upstream []byte) ([]byte, error) {
+	upstreamSettings, err := settingsMap(upstream)
+	if err != nil || len(upstreamSettings) == 0 {
+		return data, err
+	}
+	settings, err := settingsMap(data)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range upstreamSettings {
+		if local, ok := settings[key]; ok && jsonEqual(local, value) {
+			delete(settings, key)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(settings); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
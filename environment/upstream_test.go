@@ -0,0 +1,66 @@
+package environment
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamLayering(t *testing.T) {
+	dir := t.TempDir()
+	upstream := []byte(`{"base_image": "golang:1.25", "setup_commands": ["apt-get install -y jq"], "env": ["CI=1"]}`)
+	require.NoError(t, SaveUpstream(dir, &UpstreamConfig{Source: "https://example.com/config.git"}, upstream))
+
+	config := DefaultConfig()
+	require.NoError(t, config.Load(dir))
+	assert.Equal(t, "golang:1.25", config.BaseImage)
+	assert.Equal(t, []string{"apt-get install -y jq"}, config.SetupCommands)
+
+	// Only the settings overriding upstream are saved in the repository's configuration.
+	config.SetupCommands = append(config.SetupCommands, "go mod download")
+	require.NoError(t, config.Save(dir))
+	data, err := os.ReadFile(filepath.Join(ConfigDir(dir), environmentFile))
+	require.NoError(t, err)
+	var local map[string]any
+	require.NoError(t, json.Unmarshal(data, &local))
+	assert.NotContains(t, local, "base_image")
+	assert.NotContains(t, local, "env")
+	assert.Contains(t, local, "setup_commands")
+	assert.Contains(t, local, "workdir")
+
+	// Upstream changes apply to the settings the repository doesn't override.
+	bumped := []byte(`{"base_image": "golang:1.26", "setup_commands": ["apt-get install -y curl"]}`)
+	changes, err := DiffSettings(dir, upstream, bumped)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, &SettingChange{Key: "base_image", Change: SettingChanged, Old: json.RawMessage(`"golang:1.25"`), New: json.RawMessage(`"golang:1.26"`)}, changes[0])
+	assert.Equal(t, "env", changes[1].Key)
+	assert.Equal(t, SettingRemoved, changes[1].Change)
+	assert.Equal(t, "setup_commands", changes[2].Key)
+	assert.True(t, changes[2].Overridden)
+
+	require.NoError(t, SaveUpstream(dir, &UpstreamConfig{Source: "https://example.com/config.git"}, bumped))
+	config = DefaultConfig()
+	require.NoError(t, config.Load(dir))
+	assert.Equal(t, "golang:1.26", config.BaseImage)
+	assert.Equal(t, []string{"apt-get install -y jq", "go mod download"}, config.SetupCommands)
+	assert.Empty(t, config.Env)
+
+	require.NoError(t, RemoveUpstream(dir))
+	loaded, err := LoadUpstream(dir)
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+}
+
+func TestUpstreamConfigPath(t *testing.T) {
+	assert.Equal(t, "environment.json", (&UpstreamConfig{Source: "https://example.com/config.git"}).ConfigPath())
+	oci := &UpstreamConfig{Source: "oci://ghcr.io/acme/config:latest"}
+	assert.True(t, oci.IsOCI())
+	assert.Equal(t, "ghcr.io/acme/config:latest", oci.OCIRef())
+	assert.Equal(t, "/environment.json", oci.ConfigPath())
+	assert.Equal(t, "https://example.com/config.git@main:go.json", (&UpstreamConfig{Source: "https://example.com/config.git", Ref: "main", Path: "go.json"}).String())
+}
@@ -0,0 +1,158 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const maxApprovalSummary = 500
+
+// destructiveTools are the tools gated behind the user's approval when approvals are required.
+var destructiveTools = map[string]bool{
+	"environment_config":      true,
+	"environment_file_delete": true,
+}
+
+// requiresApproval returns whether the call is destructive, and so waits for the user's approval.
+func requiresApproval(tool string, request mcp.CallToolRequest) bool {
+	if destructiveTools[tool] {
+		return true
+	}
+	for _, implied := range impliedTools(tool, request) {
+		if destructiveTools[implied] {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapToolWithApproval makes the tool wait for the user to approve destructive calls on the host before
+// running them.
+func wrapToolWithApproval(tool *Tool, timeout time.Duration, notify notifyFunc) *Tool {
+	name := tool.Definition.Name
+	return &Tool{
+		Definition: tool.Definition,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if !requiresApproval(name, request) {
+				return tool.Handler(ctx, request)
+			}
+
+			repo, err := openRepository(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			envID, err := requestEnvironmentID(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			approved, approvalID, err := awaitApproval(ctx, repo, name, envID, approvalSummary(request), timeout, notify)
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, fmt.Errorf("approval request %s was not approved within %s, %s was not performed", approvalID, timeout, name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !approved {
+				return nil, fmt.Errorf("the user denied approval request %s, %s was not performed. Do not retry without asking the user", approvalID, name)
+			}
+
+			return tool.Handler(ctx, request)
+		},
+	}
+}
+
+// awaitApproval asks the user to approve an operation on the host, and waits for their decision.
+func awaitApproval(ctx context.Context, repo *repository.Repository, operation, envID, summary string, timeout time.Duration, notify notifyFunc) (bool, string, error) {
+	req, err := repo.RequestApproval(operation, envID, summary)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to request approval: %w", err)
+	}
+
+	slog.Info("Waiting for approval", "operation", operation, "environment-id", envID, "approval-id", req.ID)
+	notify(mcp.LoggingLevelWarning, map[string]any{
+		"message": fmt.Sprintf("%s on environment %s requires approval. Run 'container-use approve-request %s' to approve it or 'container-use approve-request --deny %s' to deny it.",
+			operation, envID, req.ID, req.ID),
+		"approval_id":    req.ID,
+		"environment_id": envID,
+	})
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	approved, err := repo.WaitForApproval(waitCtx, req.ID)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return false, req.ID, fmt.Errorf("failed to wait for approval: %w", err)
+	}
+	return approved, req.ID, err
+}
+
+// hostFilePrompt asks the user to approve providing host files configured to prompt to new environments.
+// Files that aren't approved in time are not provided.
+func hostFilePrompt(timeout time.Duration, notify notifyFunc) repository.HostFilePrompt {
+	return func(ctx context.Context, repo *repository.Repository, envID string, file *environment.HostFile) (bool, error) {
+		approved, _, err := awaitApproval(ctx, repo, "host_file", envID, file.String(), timeout, notify)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return false, nil
+		}
+		return approved, err
+	}
+}
+
+// inputPrompt asks the user, on the host, to answer the prompts the commands of agents fail on.
+// Prompts that aren't answered in time leave the command failed.
+func inputPrompt(timeout time.Duration, notify notifyFunc) repository.InputPrompt {
+	return func(ctx context.Context, repo *repository.Repository, envID, command, prompt string) (string, bool, error) {
+		req, err := repo.RequestInput(envID, fmt.Sprintf("%s: %s", command, prompt))
+		if err != nil {
+			return "", false, fmt.Errorf("failed to request input: %w", err)
+		}
+
+		slog.Info("Waiting for input", "environment-id", envID, "approval-id", req.ID, "prompt", prompt)
+		notify(mcp.LoggingLevelWarning, map[string]any{
+			"message": fmt.Sprintf("%q on environment %s is waiting for input: %s\nRun 'container-use approve-request %s --answer <answer>' to answer it.",
+				command, envID, prompt, req.ID),
+			"approval_id":    req.ID,
+			"environment_id": envID,
+			"command":        command,
+			"prompt":         prompt,
+		})
+
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		answer, answered, err := repo.WaitForAnswer(waitCtx, req)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", false, nil
+		}
+		return answer, answered, err
+	}
+}
+
+// approvalSummary describes the call for the user deciding whether to approve it.
+func approvalSummary(request mcp.CallToolRequest) string {
+	args := map[string]any{}
+	for key, value := range request.GetArguments() {
+		switch key {
+		case "environment_source", "environment_id":
+			continue
+		}
+		args[key] = value
+	}
+
+	out, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	summary := string(out)
+	if len(summary) > maxApprovalSummary {
+		summary = summary[:maxApprovalSummary] + "…"
+	}
+	return summary
+}
@@ -0,0 +1,22 @@
+package mcpserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApprovalSummary(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"environment_source": "/repo",
+		"environment_id":     "fancy-mallard",
+		"target_file":        "main.go",
+	}
+	assert.Equal(t, `{"target_file":"main.go"}`, approvalSummary(request))
+
+	request.Params.Arguments = map[string]any{"explanation": strings.Repeat("x", 2*maxApprovalSummary)}
+	assert.Len(t, []rune(approvalSummary(request)), maxApprovalSummary+1)
+}
@@ -0,0 +1,225 @@
+package mcpserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const configPollInterval = 2 * time.Second
+
+type configWatcherKey struct{}
+
+// notifyFunc sends a log message notification to the MCP clients.
+type notifyFunc func(level mcp.LoggingLevel, data map[string]any)
+
+// configWatcher watches the configuration of every repository used by the server.
+//
+// New environments always load the configuration when they're created, so the watcher
+// mainly reports reloads and invalid configurations as soon as they're saved.
+// If reloadEnvironments is set, environments opened by this server are also rebuilt with the new configuration.
+type configWatcher struct {
+	engines            *repository.EnginePool
+	notify             notifyFunc
+	reloadEnvironments bool
+
+	mu      sync.Mutex
+	sources map[string]*watchedSource
+}
+
+type watchedSource struct {
+	digest       [sha256.Size]byte
+	environments map[string]struct{}
+}
+
+func newConfigWatcher(engines *repository.EnginePool, notify notifyFunc, reloadEnvironments bool) *configWatcher {
+	return &configWatcher{
+		engines:            engines,
+		notify:             notify,
+		reloadEnvironments: reloadEnvironments,
+		sources:            map[string]*watchedSource{},
+	}
+}
+
+// watchRepository starts watching the configuration of repo, if it isn't already.
+func (w *configWatcher) watchRepository(repo *repository.Repository) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	source := repo.SourcePath()
+	if _, ok := w.sources[source]; ok {
+		return
+	}
+	digest, err := configDigest(source)
+	if err != nil {
+		slog.Warn("Failed to read configuration", "source", source, "err", err)
+	}
+	w.sources[source] = &watchedSource{digest: digest, environments: map[string]struct{}{}}
+}
+
+// watchEnvironment records that the environment was used by this server, so it can be reloaded.
+func (w *configWatcher) watchEnvironment(repo *repository.Repository, envID string) {
+	w.watchRepository(repo)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sources[repo.SourcePath()].environments[envID] = struct{}{}
+}
+
+// Run polls the watched configurations until the context is cancelled.
+func (w *configWatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(configPollInterval):
+		}
+
+		for source, envIDs := range w.changedSources() {
+			w.reload(ctx, source, envIDs)
+		}
+	}
+}
+
+// changedSources returns the sources whose configuration changed since the last poll,
+// along with the environments opened from them.
+func (w *configWatcher) changedSources() map[string][]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := map[string][]string{}
+	for source, watched := range w.sources {
+		digest, err := configDigest(source)
+		if err != nil {
+			slog.Warn("Failed to read configuration", "source", source, "err", err)
+			continue
+		}
+		if digest == watched.digest {
+			continue
+		}
+		watched.digest = digest
+
+		envIDs := make([]string, 0, len(watched.environments))
+		for envID := range watched.environments {
+			envIDs = append(envIDs, envID)
+		}
+		sort.Strings(envIDs)
+		changed[source] = envIDs
+	}
+	return changed
+}
+
+func (w *configWatcher) reload(ctx context.Context, source string, envIDs []string) {
+	config := environment.DefaultConfig()
+	err := config.Load(source)
+	if err == nil {
+		err = config.ValidateNetwork()
+	}
+	if err != nil {
+		slog.Error("Invalid configuration", "source", source, "err", err)
+		w.notify(mcp.LoggingLevelError, map[string]any{
+			"message": fmt.Sprintf("The environment configuration is invalid and new environments will fail to start: %s", err),
+			"source":  source,
+		})
+		return
+	}
+
+	slog.Info("Configuration reloaded", "source", source)
+	w.notify(mcp.LoggingLevelInfo, map[string]any{
+		"message": "The environment configuration was reloaded. New environments will use it.",
+		"source":  source,
+	})
+
+	if !w.reloadEnvironments {
+		return
+	}
+	for _, envID := range envIDs {
+		if err := w.reloadEnvironment(ctx, source, envID, config); err != nil {
+			slog.Error("Failed to reload environment", "environment-id", envID, "err", err)
+			w.notify(mcp.LoggingLevelWarning, map[string]any{
+				"message":        fmt.Sprintf("Failed to apply the new configuration to environment %s: %s", envID, err),
+				"environment_id": envID,
+			})
+			continue
+		}
+		w.notify(mcp.LoggingLevelInfo, map[string]any{
+			"message":        fmt.Sprintf("Environment %s was rebuilt with the new configuration. All previous commands have been lost.", envID),
+			"environment_id": envID,
+		})
+	}
+}
+
+func (w *configWatcher) reloadEnvironment(ctx context.Context, source, envID string, config *environment.EnvironmentConfig) error {
+	repo, err := repository.Open(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	slot, err := repo.AcquireExec(ctx, envID, false, nil)
+	if err != nil {
+		return err
+	}
+	defer slot.Release()
+
+	dag, err := w.engines.ClientFor(ctx, repo, envID)
+	if err != nil {
+		return err
+	}
+	env, err := repo.Get(ctx, dag, envID)
+	if err != nil {
+		return err
+	}
+	newConfig := config.Copy()
+	// Don't provide host files the user wasn't asked about for this environment.
+	if newConfig.HostFiles, err = repo.KeptHostFiles(newConfig.HostFiles, env.State.Config.HostFiles); err != nil {
+		return err
+	}
+	if err := repo.DisableUntrustedDockerCredentials(envID, newConfig); err != nil {
+		return err
+	}
+	if err := env.UpdateConfig(ctx, newConfig); err != nil {
+		return err
+	}
+	return repo.Update(ctx, env, "Reload environment configuration")
+}
+
+// configDigest hashes every file in the repository's configuration directory.
+func configDigest(source string) ([sha256.Size]byte, error) {
+	dir := environment.ConfigDir(source)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return [sha256.Size]byte{}, err
+	}
+
+	h := sha256.New()
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", entry.Name(), len(data))
+		h.Write(data)
+	}
+
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest, nil
+}
+
+func configWatcherFromContext(ctx context.Context) *configWatcher {
+	w, _ := ctx.Value(configWatcherKey{}).(*configWatcher)
+	return w
+}
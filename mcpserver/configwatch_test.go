@@ -0,0 +1,46 @@
+package mcpserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	source := t.TempDir()
+	configPath := filepath.Join(source, ".container-use", "environment.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(configPath), 0755))
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"base_image": "python:3.11"}`), 0644))
+
+	var levels []mcp.LoggingLevel
+	w := newConfigWatcher(nil, func(level mcp.LoggingLevel, data map[string]any) {
+		levels = append(levels, level)
+		assert.Equal(t, source, data["source"])
+	}, false)
+
+	digest, err := configDigest(source)
+	require.NoError(t, err)
+	w.sources[source] = &watchedSource{digest: digest, environments: map[string]struct{}{"fancy-mallard": {}}}
+
+	assert.Empty(t, w.changedSources())
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"base_image": "python:3.12"}`), 0644))
+	changed := w.changedSources()
+	assert.Equal(t, map[string][]string{source: {"fancy-mallard"}}, changed)
+	assert.Empty(t, w.changedSources(), "changes are only reported once")
+
+	w.reload(context.Background(), source, changed[source])
+	assert.Equal(t, []mcp.LoggingLevel{mcp.LoggingLevelInfo}, levels)
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"dns_servers": ["not-an-ip"]}`), 0644))
+	w.reload(context.Background(), source, w.changedSources()[source])
+	assert.Equal(t, []mcp.LoggingLevel{mcp.LoggingLevelInfo, mcp.LoggingLevelError}, levels)
+
+	require.NoError(t, os.WriteFile(filepath.Join(source, ".container-use", "AGENT.md"), []byte("rules"), 0644))
+	assert.Contains(t, w.changedSources(), source, "any file in the configuration directory is watched")
+}
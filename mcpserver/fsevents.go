@@ -0,0 +1,29 @@
+package mcpserver
+
+import (
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// fileChangeURI is the URI identifying a file of an environment in resources/updated notifications.
+func fileChangeURI(envID, path string) string {
+	return "container-use://environments/" + envID + "/files/" + path
+}
+
+// notifyFileChanges sends a resources/updated notification to the clients for each changed file.
+// The notifications go to every client: clients opt in with the server's --fs-events flag rather than
+// resources/subscribe, which the server doesn't handle.
+func notifyFileChanges(s *server.MCPServer) repository.FileChangeFunc {
+	return func(envID string, changes []repository.FileChange) {
+		for _, change := range changes {
+			s.SendNotificationToAllClients(mcp.MethodNotificationResourceUpdated, map[string]any{
+				"uri":            fileChangeURI(envID, change.Path),
+				"environment_id": envID,
+				"path":           change.Path,
+				"change":         change.Change,
+				"commit":         change.Commit,
+			})
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+type idleMonitorKey struct{}
+
+// idleMonitor stops the services and background commands of environments that haven't been used
+// for a while. Stopped environments restart transparently from their last committed state when
+// they're next used; only background commands have to be started again.
+type idleMonitor struct {
+	timeout time.Duration
+	notify  notifyFunc
+	now     func() time.Time
+
+	mu           sync.Mutex
+	environments map[string]*idleEnvironment
+}
+
+type idleEnvironment struct {
+	repo     *repository.Repository
+	id       string
+	lastUsed time.Time
+	stopped  bool
+	// running are the environment objects holding running services or background commands.
+	running []*environment.Environment
+}
+
+func newIdleMonitor(timeout time.Duration, notify notifyFunc) *idleMonitor {
+	return &idleMonitor{
+		timeout:      timeout,
+		notify:       notify,
+		now:          time.Now,
+		environments: map[string]*idleEnvironment{},
+	}
+}
+
+func idleKey(repo *repository.Repository, envID string) string {
+	return repo.SourcePath() + "\x00" + envID
+}
+
+// touch records that the environment is being used, and tells the client if it's resumed after being stopped.
+func (m *idleMonitor) touch(repo *repository.Repository, envID string) {
+	m.mu.Lock()
+	key := idleKey(repo, envID)
+	idle, ok := m.environments[key]
+	if !ok {
+		idle = &idleEnvironment{repo: repo, id: envID}
+		m.environments[key] = idle
+	}
+	resumed := idle.stopped
+	idle.lastUsed = m.now()
+	idle.stopped = false
+	m.mu.Unlock()
+
+	if resumed {
+		slog.Info("Resuming idle environment", "environment-id", envID)
+		m.notify(mcp.LoggingLevelInfo, map[string]any{
+			"message":        fmt.Sprintf("Environment %s resumed from its last committed state.", envID),
+			"environment_id": envID,
+		})
+	}
+}
+
+// track records an environment object running services or background commands, so they can be stopped.
+func (m *idleMonitor) track(repo *repository.Repository, env *environment.Environment) {
+	if !env.Running() {
+		return
+	}
+	m.touch(repo, env.ID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idle := m.environments[idleKey(repo, env.ID)]
+	for _, running := range idle.running {
+		if running == env {
+			return
+		}
+	}
+	idle.running = append(idle.running, env)
+}
+
+// idleEnvironments returns the running environments that have been idle longer than the timeout.
+// Idle environments with nothing running are forgotten until they're used again.
+func (m *idleMonitor) idleEnvironments() []*idleEnvironment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var idle []*idleEnvironment
+	for key, env := range m.environments {
+		if env.stopped || m.now().Sub(env.lastUsed) < m.timeout {
+			continue
+		}
+		if len(env.running) == 0 {
+			delete(m.environments, key)
+			continue
+		}
+		idle = append(idle, env)
+	}
+	return idle
+}
+
+// Run stops idle environments until the context is cancelled.
+func (m *idleMonitor) Run(ctx context.Context) {
+	interval := max(min(m.timeout/4, 30*time.Second), time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		for _, idle := range m.idleEnvironments() {
+			if err := m.stop(ctx, idle); err != nil {
+				slog.Warn("Failed to stop idle environment", "environment-id", idle.id, "err", err)
+			}
+		}
+	}
+}
+
+func (m *idleMonitor) stop(ctx context.Context, idle *idleEnvironment) error {
+	// Don't stop an environment in the middle of a command: it isn't idle.
+	slot, err := idle.repo.AcquireExec(ctx, idle.id, true, nil)
+	if errors.Is(err, repository.ErrEnvironmentBusy) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer slot.Release()
+
+	m.mu.Lock()
+	if m.now().Sub(idle.lastUsed) < m.timeout {
+		// Used since it was found idle.
+		m.mu.Unlock()
+		return nil
+	}
+	running := idle.running
+	idle.running = nil
+	idle.stopped = true
+	m.mu.Unlock()
+
+	var errs []error
+	for _, env := range running {
+		errs = append(errs, env.Stop(ctx))
+	}
+
+	slog.Info("Stopped idle environment", "environment-id", idle.id, "idle-timeout", m.timeout)
+	m.notify(mcp.LoggingLevelInfo, map[string]any{
+		"message": fmt.Sprintf("Environment %s was stopped after being idle for %s. It restarts from its last committed state when it's next used, but background commands must be started again.",
+			idle.id, m.timeout),
+		"environment_id": idle.id,
+	})
+	return errors.Join(errs...)
+}
+
+func idleMonitorFromContext(ctx context.Context) *idleMonitor {
+	m, _ := ctx.Value(idleMonitorKey{}).(*idleMonitor)
+	return m
+}
@@ -0,0 +1,58 @@
+package mcpserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleMonitor(t *testing.T) {
+	ctx := context.Background()
+	source := t.TempDir()
+	_, err := repository.RunGitCommand(ctx, source, "init")
+	require.NoError(t, err)
+	repo, err := repository.OpenWithBasePath(ctx, source, t.TempDir())
+	require.NoError(t, err)
+
+	var messages []string
+	m := newIdleMonitor(time.Minute, func(_ mcp.LoggingLevel, data map[string]any) {
+		messages = append(messages, data["message"].(string))
+	})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	m.touch(repo, "quiet-env")
+	m.touch(repo, "busy-env")
+	// An environment running services or background commands.
+	idle := m.environments[idleKey(repo, "busy-env")]
+	idle.running = []*environment.Environment{{EnvironmentInfo: &environment.EnvironmentInfo{ID: "busy-env"}}}
+
+	assert.Empty(t, m.idleEnvironments())
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, []*idleEnvironment{idle}, m.idleEnvironments())
+	assert.NotContains(t, m.environments, idleKey(repo, "quiet-env"), "idle environments with nothing running are forgotten")
+
+	slot, err := repo.AcquireExec(ctx, "busy-env", true, nil)
+	require.NoError(t, err)
+	require.NoError(t, m.stop(ctx, idle))
+	assert.False(t, idle.stopped, "environments running a command aren't stopped")
+	slot.Release()
+
+	require.NoError(t, m.stop(ctx, idle))
+	assert.True(t, idle.stopped)
+	assert.Empty(t, idle.running)
+	assert.Empty(t, m.idleEnvironments(), "stopped environments aren't stopped again")
+
+	m.touch(repo, "busy-env")
+	assert.False(t, idle.stopped)
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0], "busy-env was stopped after being idle for 1m0s")
+	assert.Contains(t, messages[1], "busy-env resumed from its last committed state")
+}
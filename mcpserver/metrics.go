@@ -0,0 +1,169 @@
+package mcpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type metricsPublisherKey struct{}
+
+// metricsURI is the URI of the resource holding the live metrics of an environment.
+func metricsURI(envID string) string {
+	return "container-use://environments/" + envID + "/metrics"
+}
+
+// metricsPublisher publishes the live metrics of the environments of the repositories used by the server
+// (status, last command, diff stat and health) as resources, one per environment, refreshed every interval
+// so clients can render them without polling. New and removed environments are announced with
+// resources/list_changed notifications, changed metrics with resources/updated notifications. Like file
+// events, the notifications go to every client: the server doesn't handle resources/subscribe.
+type metricsPublisher struct {
+	s        *server.MCPServer
+	interval time.Duration
+
+	mu        sync.Mutex
+	repos     map[string]*repository.Repository
+	published map[string]*publishedMetrics
+}
+
+type publishedMetrics struct {
+	source string
+	data   []byte
+}
+
+func newMetricsPublisher(s *server.MCPServer, interval time.Duration) *metricsPublisher {
+	return &metricsPublisher{
+		s:         s,
+		interval:  interval,
+		repos:     map[string]*repository.Repository{},
+		published: map[string]*publishedMetrics{},
+	}
+}
+
+// watchRepository starts publishing the metrics of the environments of repo, if it isn't already.
+func (p *metricsPublisher) watchRepository(repo *repository.Repository) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.repos[repo.SourcePath()] = repo
+}
+
+// Run refreshes the metrics until the context is cancelled.
+func (p *metricsPublisher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.interval):
+		}
+
+		p.mu.Lock()
+		repos := make([]*repository.Repository, 0, len(p.repos))
+		for _, repo := range p.repos {
+			repos = append(repos, repo)
+		}
+		p.mu.Unlock()
+
+		for _, repo := range repos {
+			if err := p.refresh(ctx, repo); err != nil {
+				slog.Warn("Failed to refresh environment metrics", "source", repo.SourcePath(), "err", err)
+			}
+		}
+	}
+}
+
+// refresh publishes the current metrics of the environments of repo.
+func (p *metricsPublisher) refresh(ctx context.Context, repo *repository.Repository) error {
+	envs, err := repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	var metrics []*repository.EnvironmentMetrics
+	for _, env := range envs {
+		m, err := repo.Metrics(ctx, env.ID)
+		if err != nil {
+			slog.Warn("Failed to read environment metrics", "environment-id", env.ID, "err", err)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+
+	added, updated, removed := p.publish(repo.SourcePath(), metrics)
+	for _, resource := range added {
+		p.s.AddResource(resource, p.read)
+	}
+	for _, uri := range updated {
+		p.s.SendNotificationToAllClients(mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+	}
+	if len(removed) > 0 {
+		p.s.DeleteResources(removed...)
+	}
+	return nil
+}
+
+// publish records the metrics of the environments of the repository at source. It returns the resources of
+// the environments that appeared, and the URIs of the resources that changed and of the environments that
+// are gone.
+func (p *metricsPublisher) publish(source string, metrics []*repository.EnvironmentMetrics) (added []mcp.Resource, updated, removed []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := map[string]bool{}
+	for _, m := range metrics {
+		uri := metricsURI(m.ID)
+		current[uri] = true
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			continue
+		}
+		previous, ok := p.published[uri]
+		switch {
+		case !ok:
+			added = append(added, mcp.NewResource(uri, fmt.Sprintf("Environment %s", m.ID),
+				mcp.WithResourceDescription(fmt.Sprintf("Live status, last command, diff stat and health of %s: %s", m.ID, m.Title)),
+				mcp.WithMIMEType("application/json"),
+			))
+		case !bytes.Equal(previous.data, data):
+			updated = append(updated, uri)
+		}
+		p.published[uri] = &publishedMetrics{source: source, data: data}
+	}
+	for uri, published := range p.published {
+		if published.source == source && !current[uri] {
+			delete(p.published, uri)
+			removed = append(removed, uri)
+		}
+	}
+	sort.Strings(removed)
+	return added, updated, removed
+}
+
+// read returns the last published metrics of an environment.
+func (p *metricsPublisher) read(_ context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	published, ok := p.published[request.Params.URI]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource %s", request.Params.URI)
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(published.data),
+	}}, nil
+}
+
+func metricsPublisherFromContext(ctx context.Context) *metricsPublisher {
+	p, _ := ctx.Value(metricsPublisherKey{}).(*metricsPublisher)
+	return p
+}
@@ -0,0 +1,53 @@
+package mcpserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsPublisher(t *testing.T) {
+	p := newMetricsPublisher(nil, time.Second)
+
+	fancy := &repository.EnvironmentMetrics{ID: "fancy-mallard", Title: "Fix the login", Status: repository.StatusIdle, Healthy: true}
+	quiet := &repository.EnvironmentMetrics{ID: "quiet-otter", Status: repository.StatusCreating, Healthy: true}
+	added, updated, removed := p.publish("/src/app", []*repository.EnvironmentMetrics{fancy, quiet})
+	require.Len(t, added, 2)
+	assert.Equal(t, "container-use://environments/fancy-mallard/metrics", added[0].URI)
+	assert.Equal(t, "application/json", added[0].MIMEType)
+	assert.Empty(t, updated)
+	assert.Empty(t, removed)
+
+	// Environments of another repository are tracked separately.
+	other := &repository.EnvironmentMetrics{ID: "other-env", Status: repository.StatusIdle, Healthy: true}
+	added, _, _ = p.publish("/src/lib", []*repository.EnvironmentMetrics{other})
+	assert.Len(t, added, 1)
+
+	added, updated, removed = p.publish("/src/app", []*repository.EnvironmentMetrics{fancy, quiet})
+	assert.Empty(t, added)
+	assert.Empty(t, updated, "unchanged metrics aren't notified")
+	assert.Empty(t, removed)
+
+	changed := *fancy
+	changed.Status = repository.StatusRunning
+	changed.RunningCommands = []string{"go test ./..."}
+	added, updated, removed = p.publish("/src/app", []*repository.EnvironmentMetrics{&changed})
+	assert.Empty(t, added)
+	assert.Equal(t, []string{metricsURI("fancy-mallard")}, updated)
+	assert.Equal(t, []string{metricsURI("quiet-otter")}, removed)
+
+	contents, err := p.read(context.Background(), mcp.ReadResourceRequest{Params: mcp.ReadResourceParams{URI: metricsURI("fancy-mallard")}})
+	require.NoError(t, err)
+	require.Len(t, contents, 1)
+	text := contents[0].(mcp.TextResourceContents)
+	assert.Equal(t, "application/json", text.MIMEType)
+	assert.Contains(t, text.Text, `"status": "running"`)
+
+	_, err = p.read(context.Background(), mcp.ReadResourceRequest{Params: mcp.ReadResourceParams{URI: metricsURI("quiet-otter")}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package mcpserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+)
+
+type operationKey struct{}
+
+// operation is the tool call being handled. It's attributed to an environment once the handler opens
+// the environment's repository and resolves its ID, so it can be recorded in the environment's event log.
+type operation struct {
+	mu    sync.Mutex
+	repo  *repository.Repository
+	envID string
+}
+
+func withOperation(ctx context.Context) (context.Context, *operation) {
+	op := &operation{}
+	return context.WithValue(ctx, operationKey{}, op), op
+}
+
+func operationFromContext(ctx context.Context) *operation {
+	op, _ := ctx.Value(operationKey{}).(*operation)
+	return op
+}
+
+// attributeRepository records the repository of the tool call, if it's timed.
+func attributeRepository(ctx context.Context, repo *repository.Repository) {
+	if op := operationFromContext(ctx); op != nil {
+		op.mu.Lock()
+		defer op.mu.Unlock()
+		op.repo = repo
+	}
+}
+
+// attributeEnvironment records the environment of the tool call, if it's timed.
+func attributeEnvironment(ctx context.Context, envID string) {
+	if op := operationFromContext(ctx); op != nil {
+		op.mu.Lock()
+		defer op.mu.Unlock()
+		op.envID = envID
+	}
+}
+
+// record records the tool call in the event log of its environment, if it was attributed one.
+func (op *operation) record(tool string, startedAt time.Time, err error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.repo != nil && op.envID != "" {
+		op.repo.RecordOperation(op.envID, tool, repository.OperationSourceMCP, startedAt, err)
+	}
+}
@@ -0,0 +1,221 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// toolScopes groups the tools into the permission scopes the server can be restricted to.
+var toolScopes = map[string]string{
+	"environment_open":                 "read",
+	"environment_list":                 "read",
+	"environment_quota":                "read",
+	"environment_file_read":            "read",
+	"environment_file_list":            "read",
+	"environment_capture":              "read",
+	"environment_diff_files":           "read",
+	"environment_diff":                 "read",
+	"environment_create":               "create",
+	"environment_update_metadata":      "config",
+	"environment_config":               "config",
+	"environment_add_service":          "config",
+	"environment_run_cmd":              "exec",
+	"environment_affected_tests":       "exec",
+	"environment_run_tests":            "exec",
+	"environment_run_task":             "exec",
+	"environment_check":                "exec",
+	"environment_file_write":           "write",
+	"environment_file_edit":            "write",
+	"environment_file_delete":          "delete",
+	"environment_file_batch":           "write",
+	"environment_refresh_dependencies": "write",
+	"environment_checkpoint":           "checkpoint",
+}
+
+// Scopes returns the permission scopes, sorted.
+func Scopes() []string {
+	var scopes []string
+	for _, scope := range toolScopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// impliedTools returns the other tools a call amounts to, whose permissions and approvals apply to it too:
+// a batch of file operations deleting or renaming files deletes files.
+func impliedTools(tool string, request mcp.CallToolRequest) []string {
+	if tool != "environment_file_batch" {
+		return nil
+	}
+	// Invalid operations are refused by the tool itself.
+	operations, _ := fileOperations(request)
+	for _, op := range operations {
+		if op.Action == environment.FileDelete || op.Action == environment.FileRename {
+			return []string{"environment_file_delete"}
+		}
+	}
+	return nil
+}
+
+// scopeRule is a set of scopes, or of tool names for finer-grained rules.
+type scopeRule []string
+
+func (rule scopeRule) matches(tool string) bool {
+	return slices.Contains(rule, tool) || slices.Contains(rule, toolScopes[tool])
+}
+
+// Permissions restricts the tools MCP clients may call. Deny rules win over allow rules,
+// and a client's own rules are combined with the server's: its allow rule replaces the
+// server's, its deny rule adds to the server's.
+type Permissions struct {
+	// Allow is the scopes clients may use; nil allows them all.
+	Allow scopeRule
+	Deny  scopeRule
+	// ClientAllow and ClientDeny are keyed by the lowercased name MCP clients report, e.g. claude-code.
+	ClientAllow map[string]scopeRule
+	ClientDeny  map[string]scopeRule
+}
+
+// ParsePermissions builds permissions from lists of scopes or tool names, and from client overrides
+// in the "client=scope,scope" form.
+func ParsePermissions(allow, deny, clientAllow, clientDeny []string) (*Permissions, error) {
+	permissions := &Permissions{
+		ClientAllow: map[string]scopeRule{},
+		ClientDeny:  map[string]scopeRule{},
+	}
+	var err error
+	if len(allow) > 0 {
+		if permissions.Allow, err = parseScopeRule(allow); err != nil {
+			return nil, err
+		}
+	}
+	if permissions.Deny, err = parseScopeRule(deny); err != nil {
+		return nil, err
+	}
+	if err := parseClientRules(clientAllow, permissions.ClientAllow); err != nil {
+		return nil, err
+	}
+	if err := parseClientRules(clientDeny, permissions.ClientDeny); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func parseScopeRule(entries []string) (scopeRule, error) {
+	rule := scopeRule{}
+	for _, entry := range entries {
+		for name := range strings.SplitSeq(entry, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, isTool := toolScopes[name]; !isTool && !slices.Contains(Scopes(), name) {
+				return nil, fmt.Errorf("unknown scope %q: must be a tool name or one of %s", name, strings.Join(Scopes(), ", "))
+			}
+			rule = append(rule, name)
+		}
+	}
+	return rule, nil
+}
+
+func parseClientRules(entries []string, rules map[string]scopeRule) error {
+	for _, entry := range entries {
+		client, scopes, ok := strings.Cut(entry, "=")
+		client = strings.ToLower(strings.TrimSpace(client))
+		if !ok || client == "" {
+			return fmt.Errorf("invalid client rule %q: expected client=scope,scope", entry)
+		}
+		rule, err := parseScopeRule([]string{scopes})
+		if err != nil {
+			return fmt.Errorf("client %s: %w", client, err)
+		}
+		rules[client] = append(rules[client], rule...)
+	}
+	return nil
+}
+
+// Check returns an error explaining why the client may not call the tool, or nil.
+func (permissions *Permissions) Check(client, tool string) error {
+	client = strings.ToLower(client)
+	if permissions.Deny.matches(tool) || permissions.ClientDeny[client].matches(tool) {
+		return fmt.Errorf("%s (scope %s) is denied by the server's permissions", tool, toolScopes[tool])
+	}
+	allow, ok := permissions.ClientAllow[client]
+	if !ok {
+		allow = permissions.Allow
+	}
+	if allow != nil && !allow.matches(tool) {
+		return fmt.Errorf("%s (scope %s) is not allowed by the server's permissions", tool, toolScopes[tool])
+	}
+	return nil
+}
+
+// sessionClient returns the name and session ID of the MCP client making the call.
+func sessionClient(ctx context.Context) (string, string) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return "unknown", ""
+	}
+	client := "unknown"
+	if withInfo, ok := session.(server.SessionWithClientInfo); ok && withInfo.GetClientInfo().Name != "" {
+		client = withInfo.GetClientInfo().Name
+	}
+	return client, session.SessionID()
+}
+
+// wrapToolWithPermissions refuses calls the client isn't permitted to make,
+// and records every call in the repository's audit log.
+func wrapToolWithPermissions(tool *Tool, permissions *Permissions) *Tool {
+	name := tool.Definition.Name
+	return &Tool{
+		Definition: tool.Definition,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			client, session := sessionClient(ctx)
+			denied := permissions.Check(client, name)
+			for _, implied := range impliedTools(name, request) {
+				if denied == nil {
+					denied = permissions.Check(client, implied)
+				}
+			}
+
+			record := &repository.AuditRecord{
+				Client:  client,
+				Session: session,
+				Tool:    name,
+				Scope:   toolScopes[name],
+				Allowed: denied == nil,
+			}
+			// Tools such as environment_create and environment_list have no environment.
+			record.EnvironmentID, _ = requestEnvironmentID(ctx, request)
+			if denied != nil {
+				record.Reason = denied.Error()
+				slog.Warn("Tool call denied", "tool", name, "client", client, "reason", denied)
+			}
+			if repo, err := openRepository(ctx, request); err == nil {
+				if record.EnvironmentID != "" {
+					if info, err := repo.Info(ctx, record.EnvironmentID); err == nil {
+						record.Hardened = info.State.Config.Hardened
+					}
+				}
+				repo.RecordAudit(record)
+			}
+
+			if denied != nil {
+				return nil, fmt.Errorf("%w. Do not retry: ask the user to perform this operation", denied)
+			}
+			return tool.Handler(ctx, request)
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package mcpserver
+
+import (
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissions(t *testing.T) {
+	permissions, err := ParsePermissions(
+		[]string{"read,create", "exec"},
+		[]string{"environment_check"},
+		[]string{"Cursor=read"},
+		[]string{"claude-code=create"},
+	)
+	require.NoError(t, err)
+
+	assert.NoError(t, permissions.Check("claude-code", "environment_run_cmd"))
+	assert.ErrorContains(t, permissions.Check("claude-code", "environment_create"), "denied")
+	assert.ErrorContains(t, permissions.Check("goose", "environment_check"), "denied")
+	assert.ErrorContains(t, permissions.Check("goose", "environment_file_write"), "not allowed")
+	assert.NoError(t, permissions.Check("goose", "environment_create"))
+
+	// A client's allow rule replaces the server's.
+	assert.NoError(t, permissions.Check("cursor", "environment_file_read"))
+	assert.Error(t, permissions.Check("cursor", "environment_run_cmd"))
+
+	// Without allow rules, everything not denied is allowed.
+	permissions, err = ParsePermissions(nil, []string{"delete"}, nil, nil)
+	require.NoError(t, err)
+	assert.NoError(t, permissions.Check("unknown", "environment_file_write"))
+	assert.Error(t, permissions.Check("unknown", "environment_file_delete"))
+
+	_, err = ParsePermissions([]string{"merge"}, nil, nil, nil)
+	assert.ErrorContains(t, err, "unknown scope")
+	_, err = ParsePermissions(nil, nil, []string{"cursor"}, nil)
+	assert.ErrorContains(t, err, "invalid client rule")
+}
+
+func TestImpliedTools(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"operations": []any{
+		map[string]any{"action": "create", "path": "a.go", "contents": "package a"},
+		map[string]any{"action": "update", "path": "b.go", "contents": "package b"},
+	}}
+	assert.Empty(t, impliedTools("environment_file_batch", request))
+	assert.False(t, requiresApproval("environment_file_batch", request))
+
+	request.Params.Arguments = map[string]any{"operations": []any{
+		map[string]any{"action": "rename", "path": "a.go", "to": "c.go"},
+	}}
+	assert.Equal(t, []string{"environment_file_delete"}, impliedTools("environment_file_batch", request))
+	assert.True(t, requiresApproval("environment_file_batch", request), "renaming files deletes them")
+	assert.Empty(t, impliedTools("environment_file_write", request))
+}
+
+func TestToolScopes(t *testing.T) {
+	for _, tool := range Tools() {
+		assert.Contains(t, toolScopes, tool.Definition.Name, "every tool needs a permission scope")
+	}
+}
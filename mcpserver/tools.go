@@ -1,7 +1,10 @@
 package mcpserver
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,8 +12,10 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
+	"time"
 
-	"dagger.io/dagger"
 	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
 	"github.com/dagger/container-use/rules"
@@ -18,7 +23,7 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 )
 
-type daggerClientKey struct{}
+type enginePoolKey struct{}
 
 type singleTenantKey struct{}
 
@@ -53,6 +58,13 @@ func openRepository(ctx context.Context, request mcp.CallToolRequest) (*reposito
 	if err != nil {
 		return nil, fmt.Errorf("unable to open repository: %w", err)
 	}
+	attributeRepository(ctx, repo)
+	if w := configWatcherFromContext(ctx); w != nil {
+		w.watchRepository(repo)
+	}
+	if m := metricsPublisherFromContext(ctx); m != nil {
+		m.watchRepository(repo)
+	}
 	return repo, nil
 }
 
@@ -61,39 +73,111 @@ func openEnvironment(ctx context.Context, request mcp.CallToolRequest) (*reposit
 	if err != nil {
 		return nil, nil, err
 	}
+	envID, err := requestEnvironmentID(ctx, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	env, err := getEnvironment(ctx, repo, envID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, env, nil
+}
+
+// openEnvironmentExclusive is like openEnvironment, but first waits for the environment's exec queue
+// so concurrent execs (e.g. from the user's CLI) don't race on the container state.
+// The returned slot must be released once the repository has been updated.
+// It fails if the environment exceeded a blocking change budget that wasn't acknowledged yet, or if the host
+// is short of disk space or memory.
+func openEnvironmentExclusive(ctx context.Context, request mcp.CallToolRequest) (*repository.Repository, *environment.Environment, *repository.ExecSlot, error) {
+	return openEnvironmentSerialized(ctx, request, true)
+}
+
+// openEnvironmentForWrite is openEnvironmentExclusive for the tools writing files, metadata or
+// configuration, which aren't subject to change budgets. Serializing every write with the execs means a
+// write never loads a state that another write is about to replace, losing its changes.
+func openEnvironmentForWrite(ctx context.Context, request mcp.CallToolRequest) (*repository.Repository, *environment.Environment, *repository.ExecSlot, error) {
+	return openEnvironmentSerialized(ctx, request, false)
+}
+
+func openEnvironmentSerialized(ctx context.Context, request mcp.CallToolRequest, checkBudget bool) (*repository.Repository, *environment.Environment, *repository.ExecSlot, error) {
+	repo, err := openRepository(ctx, request)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	envID, err := requestEnvironmentID(ctx, request)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var resourceWarnings []string
+	if checkBudget {
+		if err := repo.CheckChangeBudget(envID); err != nil {
+			return nil, nil, nil, err
+		}
+		if resourceWarnings, err = repo.CheckHostResources(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	slot, err := repo.AcquireExec(ctx, envID, request.GetBool("no_wait", false), nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to acquire environment: %w", err)
+	}
+	env, err := getEnvironment(ctx, repo, envID)
+	if err != nil {
+		slot.Release()
+		return nil, nil, nil, err
+	}
+	for _, warning := range resourceWarnings {
+		env.Notes.Add("Warning: %s", warning)
+	}
+	return repo, env, slot, nil
+}
 
+func requestEnvironmentID(ctx context.Context, request mcp.CallToolRequest) (string, error) {
 	// Check if we're in single-tenant mode
 	singleTenant, _ := ctx.Value(singleTenantKey{}).(bool)
 
-	var envID string
+	envID, err := resolveEnvironmentID(singleTenant, request)
+	if err == nil {
+		attributeEnvironment(ctx, envID)
+	}
+	return envID, err
+}
+
+func resolveEnvironmentID(singleTenant bool, request mcp.CallToolRequest) (string, error) {
 	if singleTenant {
 		// in single-tenant mode, environment_open requests will have environment_id. all other env-scoped tools will have "".
-		envID = request.GetString("environment_id", "")
+		envID := request.GetString("environment_id", "")
 		if envID == "" {
-			currentEnvID, err := getCurrentEnvironmentID()
-			if err != nil {
-				return nil, nil, err
-			}
-			envID = currentEnvID
-		}
-	} else {
-		// In multi-tenant mode, environment_id is required
-		var err error
-		envID, err = request.RequireString("environment_id")
-		if err != nil {
-			return nil, nil, err
+			return getCurrentEnvironmentID()
 		}
+		return envID, nil
 	}
 
-	dag, ok := ctx.Value(daggerClientKey{}).(*dagger.Client)
+	// In multi-tenant mode, environment_id is required
+	return request.RequireString("environment_id")
+}
+
+func getEnvironment(ctx context.Context, repo *repository.Repository, envID string) (*environment.Environment, error) {
+	engines, ok := ctx.Value(enginePoolKey{}).(*repository.EnginePool)
 	if !ok {
-		return nil, nil, fmt.Errorf("dagger client not found in context")
+		return nil, fmt.Errorf("dagger client not found in context")
+	}
+	dag, err := engines.ClientFor(ctx, repo, envID)
+	if err != nil {
+		return nil, err
 	}
 	env, err := repo.Get(ctx, dag, envID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to get environment: %w", err)
+		return nil, fmt.Errorf("unable to get environment: %w", err)
 	}
-	return repo, env, nil
+	if w := configWatcherFromContext(ctx); w != nil {
+		w.watchEnvironment(repo, envID)
+	}
+	if m := idleMonitorFromContext(ctx); m != nil {
+		m.touch(repo, envID)
+	}
+	return env, nil
 }
 
 type Tool struct {
@@ -101,18 +185,75 @@ type Tool struct {
 	Handler    server.ToolHandlerFunc
 }
 
-func RunStdioServer(ctx context.Context, dag *dagger.Client, singleTenant bool) error {
+// ServerOptions configures the MCP server.
+type ServerOptions struct {
+	// SingleTenant makes environment IDs optional, assuming one session per server.
+	SingleTenant bool
+	// ReloadEnvironments rebuilds environments opened by the server when the repository configuration changes.
+	ReloadEnvironments bool
+	// RequireApproval gates destructive tools behind an out-of-band approval from the user.
+	RequireApproval bool
+	// ApprovalTimeout is how long destructive tools wait for approval before giving up.
+	ApprovalTimeout time.Duration
+	// IdleTimeout stops the services and background commands of environments unused for this long (0 disables it).
+	IdleTimeout time.Duration
+	// GitIdentity authors the commits of environments created by the server, e.g. to attribute them to the agent.
+	GitIdentity *environment.GitIdentity
+	// FileEvents notifies clients of the files changed by tool calls, with resources/updated notifications.
+	FileEvents bool
+	// Permissions restricts the tools clients may call, recording every call in the audit log (nil allows everything).
+	Permissions *Permissions
+	// MetricsInterval publishes the live metrics of environments as resources, refreshed this often (0 disables them).
+	MetricsInterval time.Duration
+}
+
+// RunStdioServer serves the tools over stdio, running environments on the engines of the pool.
+func RunStdioServer(ctx context.Context, engines *repository.EnginePool, opts ServerOptions) error {
 	// Store single-tenant mode in context for tool handlers
-	ctx = context.WithValue(ctx, singleTenantKey{}, singleTenant)
+	ctx = context.WithValue(ctx, singleTenantKey{}, opts.SingleTenant)
+	if opts.GitIdentity != nil {
+		ctx = repository.WithGitIdentity(ctx, opts.GitIdentity)
+	}
 
-	s := server.NewMCPServer(
-		"Dagger",
-		"1.0.0",
+	serverOpts := []server.ServerOption{
 		server.WithInstructions(rules.AgentRules),
-	)
+		server.WithLogging(),
+	}
+	if opts.MetricsInterval > 0 {
+		serverOpts = append(serverOpts, server.WithResourceCapabilities(false, true))
+	}
+	s := server.NewMCPServer("Dagger", "1.0.0", serverOpts...)
+
+	notify := func(level mcp.LoggingLevel, data map[string]any) {
+		s.SendNotificationToAllClients("notifications/message", map[string]any{
+			"level":  level,
+			"logger": "container-use",
+			"data":   data,
+		})
+	}
+	ctx = repository.WithHostFilePrompt(ctx, hostFilePrompt(opts.ApprovalTimeout, notify))
+	ctx = repository.WithInputPrompt(ctx, inputPrompt(opts.ApprovalTimeout, notify))
+	if opts.FileEvents {
+		ctx = repository.WithFileChanges(ctx, notifyFileChanges(s))
+	}
+	watcher := newConfigWatcher(engines, notify, opts.ReloadEnvironments)
+	var idle *idleMonitor
+	if opts.IdleTimeout > 0 {
+		idle = newIdleMonitor(opts.IdleTimeout, notify)
+	}
+	var metrics *metricsPublisher
+	if opts.MetricsInterval > 0 {
+		metrics = newMetricsPublisher(s, opts.MetricsInterval)
+	}
 
-	for _, t := range createTools(singleTenant) {
-		s.AddTool(t.Definition, wrapToolWithClient(t, dag, singleTenant).Handler)
+	for _, t := range createTools(opts.SingleTenant) {
+		if opts.RequireApproval {
+			t = wrapToolWithApproval(t, opts.ApprovalTimeout, notify)
+		}
+		if opts.Permissions != nil {
+			t = wrapToolWithPermissions(t, opts.Permissions)
+		}
+		s.AddTool(t.Definition, wrapToolWithClient(t, engines, opts.SingleTenant, watcher, idle, metrics).Handler)
 	}
 
 	slog.Info("starting server")
@@ -123,6 +264,14 @@ func RunStdioServer(ctx context.Context, dag *dagger.Client, singleTenant bool)
 	ctx, cancel := signal.NotifyContext(ctx, getNotifySignals()...)
 	defer cancel()
 
+	go watcher.Run(ctx)
+	if idle != nil {
+		go idle.Run(ctx)
+	}
+	if metrics != nil {
+		go metrics.Run(ctx)
+	}
+
 	err := stdioSrv.Listen(ctx, os.Stdin, os.Stdout)
 	if err != nil && !errors.Is(err, context.Canceled) {
 		return err
@@ -137,14 +286,24 @@ func createTools(singleTenant bool) []*Tool {
 		wrapTool(createEnvironmentUpdateMetadataTool(singleTenant)),
 		wrapTool(createEnvironmentConfigTool(singleTenant)),
 		wrapTool(createEnvironmentListTool(singleTenant)),
+		wrapTool(createEnvironmentQuotaTool(singleTenant)),
 		wrapTool(createEnvironmentRunCmdTool(singleTenant)),
 		wrapTool(createEnvironmentFileReadTool(singleTenant)),
+		wrapTool(createEnvironmentCaptureTool(singleTenant)),
 		wrapTool(createEnvironmentFileListTool(singleTenant)),
 		wrapTool(createEnvironmentFileWriteTool(singleTenant)),
 		wrapTool(createEnvironmentFileEditTool(singleTenant)),
 		wrapTool(createEnvironmentFileDeleteTool(singleTenant)),
+		wrapTool(createEnvironmentFileBatchTool(singleTenant)),
 		wrapTool(createEnvironmentAddServiceTool(singleTenant)),
+		wrapTool(createEnvironmentRefreshDependenciesTool(singleTenant)),
 		wrapTool(createEnvironmentCheckpointTool(singleTenant)),
+		wrapTool(createEnvironmentDiffFilesTool(singleTenant)),
+		wrapTool(createEnvironmentDiffTool(singleTenant)),
+		wrapTool(createEnvironmentAffectedTestsTool(singleTenant)),
+		wrapTool(createEnvironmentRunTestsTool(singleTenant)),
+		wrapTool(createEnvironmentRunTaskTool(singleTenant)),
+		wrapTool(createEnvironmentCheckTool(singleTenant)),
 	}
 }
 
@@ -160,7 +319,13 @@ func wrapTool(tool *Tool) *Tool {
 			defer func() {
 				slog.Info("Tool finished", "tool", tool.Definition.Name)
 			}()
+			startedAt := time.Now()
+			ctx, op := withOperation(ctx)
 			response, err := tool.Handler(ctx, request)
+			if err == nil && response != nil && response.IsError {
+				err = errors.New("tool returned an error")
+			}
+			op.record(tool.Definition.Name, startedAt, err)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -170,12 +335,19 @@ func wrapTool(tool *Tool) *Tool {
 }
 
 // keeping this modular for now. we could move tool registration to RunStdioServer and collapse the 2 wrapTool functions.
-func wrapToolWithClient(tool *Tool, dag *dagger.Client, singleTenant bool) *Tool {
+func wrapToolWithClient(tool *Tool, engines *repository.EnginePool, singleTenant bool, watcher *configWatcher, idle *idleMonitor, metrics *metricsPublisher) *Tool {
 	return &Tool{
 		Definition: tool.Definition,
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			ctx = context.WithValue(ctx, daggerClientKey{}, dag)
+			ctx = context.WithValue(ctx, enginePoolKey{}, engines)
 			ctx = context.WithValue(ctx, singleTenantKey{}, singleTenant)
+			ctx = context.WithValue(ctx, configWatcherKey{}, watcher)
+			if idle != nil {
+				ctx = context.WithValue(ctx, idleMonitorKey{}, idle)
+			}
+			if metrics != nil {
+				ctx = context.WithValue(ctx, metricsPublisherKey{}, metrics)
+			}
 			return tool.Handler(ctx, request)
 		},
 	}
@@ -277,7 +449,11 @@ func createEnvironmentCreateTool(singleTenant bool) *Tool {
 			mcp.Required(),
 		),
 		mcp.WithString("from_git_ref",
-			mcp.Description("Git reference to create the environment from (e.g., HEAD, main, feature-branch, SHA). Defaults to HEAD if not specified."),
+			mcp.Description("Git reference to create the environment from (e.g., HEAD, main, feature-branch, SHA). Defaults to HEAD if not specified. References missing locally, such as origin/feature-x, are fetched from their remote."),
+		),
+		mcp.WithArray("depends_on",
+			mcp.Description("Outputs of other environments to copy into the new environment, as <environment_id>[:<path>][=<target>]: the file or directory at path in that environment's container (relative to its workdir), or the files of its branch tip without a path, copied to target (default: /deps/<environment_id>[/<base name of path>]). E.g. build-env:bin/server for the binary a build environment produces. Refresh them later with environment_refresh_dependencies."),
+			mcp.Items(map[string]any{"type": "string"}),
 		),
 	}
 
@@ -319,16 +495,48 @@ Environment configuration is managed by the user via cu config commands.`,
 				}
 			}
 
-			dag, ok := ctx.Value(daggerClientKey{}).(*dagger.Client)
+			// The quotas of agents apply to the MCP client creating the environment.
+			if client, _ := sessionClient(ctx); client != "unknown" {
+				ctx = repository.WithAgent(ctx, strings.ToLower(client))
+			}
+
+			engines, ok := ctx.Value(enginePoolKey{}).(*repository.EnginePool)
 			if !ok {
 				return nil, fmt.Errorf("dagger client not found in context")
 			}
+			// Environments copying files of the containers of others are hosted by the same engine.
+			var deps []*environment.Dependency
+			var pinned []string
+			for _, spec := range request.GetStringSlice("depends_on", []string{}) {
+				dep, err := environment.ParseDependency(spec)
+				if err != nil {
+					return nil, err
+				}
+				deps = append(deps, dep)
+				if dep.Path != "" {
+					pinned = append(pinned, dep.Environment)
+				}
+			}
+			ctx, dag, err := engines.ScheduleWith(ctx, repo, pinned)
+			if err != nil {
+				return nil, err
+			}
+			if len(deps) > 0 {
+				ctx = repository.WithDependencies(ctx, deps)
+			}
 
 			gitRef := request.GetString("from_git_ref", "HEAD")
 			env, err := repo.Create(ctx, dag, title, request.GetString("explanation", ""), gitRef)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create environment: %w", err)
 			}
+			attributeEnvironment(ctx, env.ID)
+			if w := configWatcherFromContext(ctx); w != nil {
+				w.watchEnvironment(repo, env.ID)
+			}
+			if m := idleMonitorFromContext(ctx); m != nil {
+				m.track(repo, env)
+			}
 
 			// In single-tenant mode, set this as the current environment
 			if singleTenantMode, _ := ctx.Value(singleTenantKey{}).(bool); singleTenantMode {
@@ -375,10 +583,11 @@ func createEnvironmentUpdateMetadataTool(singleTenant bool) *Tool {
 			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			repo, env, err := openEnvironment(ctx, request)
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
 			if err != nil {
 				return nil, err
 			}
+			defer slot.Release()
 
 			// Update title if provided
 			if title := request.GetString("title", ""); title != "" {
@@ -425,14 +634,38 @@ func createEnvironmentConfigTool(singleTenant bool) *Tool {
 						"description": "The environment variables to set (e.g. `[\"FOO=bar\", \"BAZ=qux\"]`).",
 						"items":       map[string]any{"type": "string"},
 					},
+					"features": map[string]any{
+						"type":        "array",
+						"description": "Dev container features to install before the setup commands (see https://containers.dev/features). Prefer a feature over hand-written setup commands when one exists for the tool.",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"ref": map[string]any{
+									"type":        "string",
+									"description": "OCI reference of the feature (e.g. `ghcr.io/devcontainers/features/node:1`).",
+								},
+								"options": map[string]any{
+									"type":                 "object",
+									"description":          "Feature options (e.g. `{\"version\": \"20\"}`).",
+									"additionalProperties": map[string]any{"type": "string"},
+								},
+							},
+							"required": []string{"ref"},
+						},
+					},
+					"docker": map[string]any{
+						"type":        "boolean",
+						"description": "Run a Docker daemon in the environment so `docker` and `docker compose` work, e.g. for test suites using testcontainers. Containers started this way are reachable at the `docker` host.",
+					},
 				}),
 			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			repo, env, err := openEnvironment(ctx, request)
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
 			if err != nil {
 				return nil, err
 			}
+			defer slot.Release()
 
 			updatedConfig := env.State.Config.Copy()
 
@@ -440,9 +673,14 @@ func createEnvironmentConfigTool(singleTenant bool) *Tool {
 			if !ok {
 				return nil, errors.New("invalid config")
 			}
+			if err := checkHardenedConfigChanges(updatedConfig, newConfig); err != nil {
+				return nil, err
+			}
 
 			if baseImage, ok := newConfig["base_image"].(string); ok {
 				updatedConfig.BaseImage = baseImage
+				// An image replaces the Containerfile build, which would take precedence.
+				updatedConfig.BaseBuild = nil
 			}
 
 			if setupCommands, ok := newConfig["setup_commands"].([]any); ok {
@@ -459,6 +697,42 @@ func createEnvironmentConfigTool(singleTenant bool) *Tool {
 				}
 			}
 
+			if features, ok := newConfig["features"].([]any); ok {
+				updatedConfig.Features = make(environment.FeatureConfigs, 0, len(features))
+				for _, raw := range features {
+					feature, ok := raw.(map[string]any)
+					if !ok {
+						return nil, errors.New("invalid feature")
+					}
+					ref, _ := feature["ref"].(string)
+					if ref == "" {
+						return nil, errors.New("feature ref is required")
+					}
+					cfg := &environment.FeatureConfig{Ref: ref}
+					if options, ok := feature["options"].(map[string]any); ok {
+						cfg.Options = make(map[string]string, len(options))
+						for key, value := range options {
+							cfg.Options[key] = fmt.Sprint(value)
+						}
+					}
+					updatedConfig.Features = append(updatedConfig.Features, cfg)
+				}
+			}
+
+			if docker, ok := newConfig["docker"].(bool); ok {
+				switch {
+				case !docker:
+					updatedConfig.Docker = nil
+				case updatedConfig.Docker == nil:
+					// Agents may only get a dedicated daemon: access to the host's Docker socket is granted from the host.
+					updatedConfig.Docker = &environment.DockerConfig{Mode: environment.DockerModeDind}
+				}
+			}
+
+			// Changing the images changes the registries the credentials were trusted for.
+			if err := repo.DisableUntrustedDockerCredentials(env.ID, updatedConfig); err != nil {
+				return nil, err
+			}
 			if err := env.UpdateConfig(ctx, updatedConfig); err != nil {
 				return nil, fmt.Errorf("unable to update the environment: %w", err)
 			}
@@ -484,6 +758,24 @@ TELL THE USER: To make these changes persistent, they will have to run "cu confi
 	}
 }
 
+// hardenedConfigKeys are the environment_config keys whose changes run as root when the environment is
+// built: the base image, and the features and setup commands installed on it.
+var hardenedConfigKeys = []string{"base_image", "setup_commands", "features"}
+
+// checkHardenedConfigChanges returns an error if the agent changes how a hardened environment is built:
+// the agent's code runs unprivileged, so it may not run code as root through the configuration.
+func checkHardenedConfigChanges(config *environment.EnvironmentConfig, changes map[string]any) error {
+	if !config.Hardened {
+		return nil
+	}
+	for _, key := range hardenedConfigKeys {
+		if _, ok := changes[key]; ok {
+			return fmt.Errorf("%s can't be changed in a hardened environment: it runs as root when the environment is built. Ask the user to change the repository's configuration (container-use config) instead", key)
+		}
+	}
+	return nil
+}
+
 func createEnvironmentListTool(_ bool) *Tool {
 	return &Tool{
 		Definition: newRepositoryTool(
@@ -518,6 +810,31 @@ func createEnvironmentListTool(_ bool) *Tool {
 	}
 }
 
+func createEnvironmentQuotaTool(_ bool) *Tool {
+	return &Tool{
+		Definition: newRepositoryTool(
+			"environment_quota",
+			`Show how many environments the repository, each label and each agent have, and their quotas (max, unset when unlimited).
+Creating an environment fails once a quota is reached: check it before creating several environments, and delete environments you no longer need rather than creating more.`,
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, err := openRepository(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			status, err := repo.QuotaStatus(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the quotas: %w", err)
+			}
+			out, err := json.Marshal(status)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
 func createEnvironmentRunCmdTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -541,19 +858,59 @@ Failure to do so will result in the tool being stuck, awaiting for the command t
 			mcp.WithBoolean("use_entrypoint",
 				mcp.Description("Use the image entrypoint, if present, by prepending it to the args."),
 			),
+			mcp.WithBoolean("no_wait",
+				mcp.Description("Fail immediately instead of waiting if another command is running in the environment."),
+			),
 			mcp.WithArray("ports",
 				mcp.Description("Ports to expose. Only works with background environments. For each port, returns the environment_internal (for use inside environments) and host_external (for use by the user) addresses."),
 				mcp.Items(map[string]any{"type": "number"}),
 			),
+			mcp.WithArray("parallel_commands",
+				mcp.Description(`Independent commands to run concurrently instead of command (e.g. lint, unit tests and type checking), each on its own copy of the environment.
+The changes they make to the workdir are merged; files changed differently by several commands are reported as conflicts and left unchanged.
+Returns the combined result as JSON.`),
+				mcp.Items(map[string]any{"type": "string"}),
+			),
+			mcp.WithBoolean("strip_ansi",
+				mcp.Description("Strip colors, cursor movements and progress bars from the output."),
+			),
+			mcp.WithString("grep_output",
+				mcp.Description("Only keep the output lines matching this regular expression, e.g. FAIL|panic|error to find the failures of a long test run."),
+			),
+			mcp.WithNumber("tail",
+				mcp.Description("Only keep the last lines of the output, e.g. 200 for a verbose build."),
+			),
+			mcp.WithNumber("timeout_seconds",
+				mcp.Description("Stop the command if it runs for longer than this many seconds, e.g. for a command that may wait on a prompt. It can only shorten the timeout configured by the user. A command stopped by its timeout exits with code 124, and the changes it made until then are kept."),
+			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			repo, env, err := openEnvironment(ctx, request)
+			repo, env, slot, err := openEnvironmentExclusive(ctx, request)
 			if err != nil {
 				return nil, err
 			}
+			defer slot.Release()
 
 			command := request.GetString("command", "")
 			shell := request.GetString("shell", "sh")
+			filter, err := outputFilter(request)
+			if err != nil {
+				return nil, err
+			}
+			if filter != nil {
+				ctx = environment.WithOutputFilter(ctx, filter)
+			}
+			if seconds := request.GetFloat("timeout_seconds", 0); seconds > 0 {
+				timeout := &environment.CommandTimeout{DurationMS: int64(seconds * 1000)}
+				if configured := env.CommandTimeout(ctx); configured != nil {
+					timeout.Signal, timeout.GracePeriodMS = configured.Signal, configured.GracePeriodMS
+					timeout.DurationMS = min(timeout.DurationMS, configured.DurationMS)
+				}
+				if err := timeout.Validate(); err != nil {
+					return nil, fmt.Errorf("invalid timeout_seconds: %w", err)
+				}
+				ctx = environment.WithCommandTimeout(ctx, timeout)
+			}
 
 			updateRepo := func() error {
 				if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
@@ -571,6 +928,9 @@ Failure to do so will result in the tool being stuck, awaiting for the command t
 					}
 				}
 				endpoints, runErr := env.RunBackground(ctx, command, shell, ports, request.GetBool("use_entrypoint", false))
+				if m := idleMonitorFromContext(ctx); m != nil {
+					m.track(repo, env)
+				}
 				// We want to update the repository even if the command failed.
 				if err := updateRepo(); err != nil {
 					return nil, err
@@ -594,6 +954,21 @@ Background commands are unaffected by filesystem and any other kind of changes.
 					string(out), env.State.Config.Workdir, env.ID)), nil
 			}
 
+			if parallel := request.GetStringSlice("parallel_commands", []string{}); len(parallel) > 0 {
+				result, runErr := env.RunParallel(ctx, parallel, shell)
+				if err := updateRepo(); err != nil {
+					return nil, err
+				}
+				if runErr != nil {
+					return nil, fmt.Errorf("failed to run commands: %w", runErr)
+				}
+				out, err := json.Marshal(result)
+				if err != nil {
+					return nil, err
+				}
+				return mcp.NewToolResultText(fmt.Sprintf("%s\n\nThe merged changes to the container workdir (%s) have been committed and pushed to container-use/%s remote ref%s", out, env.State.Config.Workdir, env.ID, queueNote(slot))), nil
+			}
+
 			stdout, runErr := env.Run(ctx, command, shell, request.GetBool("use_entrypoint", false))
 			// We want to update the repository even if the command failed.
 			if err := updateRepo(); err != nil {
@@ -603,11 +978,39 @@ Background commands are unaffected by filesystem and any other kind of changes.
 				return nil, fmt.Errorf("failed to run command: %w", runErr)
 			}
 
-			return mcp.NewToolResultText(fmt.Sprintf("%s\n\nAny changes to the container workdir (%s) have been committed and pushed to container-use/%s remote ref", stdout, env.State.Config.Workdir, env.ID)), nil
+			return mcp.NewToolResultText(fmt.Sprintf("%s\n\nAny changes to the container workdir (%s) have been committed and pushed to container-use/%s remote ref%s", stdout, env.State.Config.Workdir, env.ID, queueNote(slot))), nil
 		},
 	}
 }
 
+// outputFilter returns the output filter of the strip_ansi, grep_output and tail arguments, or nil if
+// none is set.
+func outputFilter(request mcp.CallToolRequest) (*environment.OutputFilter, error) {
+	filter := &environment.OutputFilter{
+		StripANSI: request.GetBool("strip_ansi", false),
+		Tail:      request.GetInt("tail", 0),
+	}
+	if pattern := request.GetString("grep_output", ""); pattern != "" {
+		grep, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep_output pattern: %w", err)
+		}
+		filter.Grep = grep
+	}
+	if !filter.StripANSI && filter.Grep == nil && filter.Tail <= 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// queueNote tells the agent when its command had to wait for another one in the same environment.
+func queueNote(slot *repository.ExecSlot) string {
+	if slot.Waited < time.Second {
+		return ""
+	}
+	return fmt.Sprintf("\n\nNote: waited %s for another command in this environment to finish.", slot.Waited.Round(time.Second))
+}
+
 func createEnvironmentFileReadTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -655,6 +1058,54 @@ func createEnvironmentFileReadTool(singleTenant bool) *Tool {
 	}
 }
 
+func createEnvironmentCaptureTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_capture",
+				description: `Show an image or HTML file of the environment, such as a screenshot taken by a browser test or a rendered page, to the user.
+Supports PNG, JPEG, GIF, WebP, SVG and HTML files up to 5MB. Use it to show the user what frontend changes look like.`,
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("target_file",
+				mcp.Description("Path of the file to capture, absolute or relative to the workdir"),
+				mcp.Required(),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			targetFile, err := request.RequireString("target_file")
+			if err != nil {
+				return nil, err
+			}
+
+			capture, err := env.Capture(ctx, targetFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to capture file: %w", err)
+			}
+
+			summary := fmt.Sprintf("Captured %s (%s, %d bytes). The user can save it with: container-use capture %s %s", capture.Path, capture.MIMEType, len(capture.Data), env.ID, capture.Path)
+			if !capture.IsText() {
+				return mcp.NewToolResultImage(summary, base64.StdEncoding.EncodeToString(capture.Data), capture.MIMEType), nil
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.NewTextContent(summary),
+					mcp.NewEmbeddedResource(mcp.TextResourceContents{
+						URI:      "file://" + capture.Path,
+						MIMEType: capture.MIMEType,
+						Text:     string(capture.Data),
+					}),
+				},
+			}, nil
+		},
+	}
+}
+
 func createEnvironmentFileListTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -714,10 +1165,11 @@ func createEnvironmentFileEditTool(singleTenant bool) *Tool {
 			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			repo, env, err := openEnvironment(ctx, request)
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
 			if err != nil {
 				return mcp.NewToolResultErrorFromErr("unable to open the environment", err), nil
 			}
+			defer slot.Release()
 
 			targetFile, err := request.RequireString("target_file")
 			if err != nil {
@@ -769,10 +1221,11 @@ func createEnvironmentFileWriteTool(singleTenant bool) *Tool {
 			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			repo, env, err := openEnvironment(ctx, request)
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
 			if err != nil {
 				return nil, err
 			}
+			defer slot.Release()
 
 			targetFile, err := request.RequireString("target_file")
 			if err != nil {
@@ -810,10 +1263,11 @@ func createEnvironmentFileDeleteTool(singleTenant bool) *Tool {
 			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			repo, env, err := openEnvironment(ctx, request)
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
 			if err != nil {
 				return nil, err
 			}
+			defer slot.Release()
 
 			targetFile, err := request.RequireString("target_file")
 			if err != nil {
@@ -833,6 +1287,89 @@ func createEnvironmentFileDeleteTool(singleTenant bool) *Tool {
 	}
 }
 
+func createEnvironmentFileBatchTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_file_batch",
+				description:           "Create, update, delete and rename several files at once, in a single commit. The operations are applied in order, all or nothing: if one of them fails, none is applied. Prefer it to sequences of single-file writes for changes spanning several files, such as renaming a module and updating its imports.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithArray("operations",
+				mcp.Description("The file operations to apply, in order."),
+				mcp.Required(),
+				mcp.Items(map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"action": map[string]any{
+							"type":        "string",
+							"enum":        []string{environment.FileCreate, environment.FileUpdate, environment.FileDelete, environment.FileRename},
+							"description": "create a new file, update an existing file, delete a file, or rename a file to `to`.",
+						},
+						"path": map[string]any{
+							"type":        "string",
+							"description": "Path of the file, absolute or relative to the workdir.",
+						},
+						"to": map[string]any{
+							"type":        "string",
+							"description": "New path of a renamed file.",
+						},
+						"contents": map[string]any{
+							"type":        "string",
+							"description": "Full text content of a created or updated file. Optional for renames, to also rewrite the file.",
+						},
+					},
+					"required": []string{"action", "path"},
+				}),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			operations, err := fileOperations(request)
+			if err != nil {
+				return nil, err
+			}
+
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			defer slot.Release()
+
+			if err := env.FileBatch(ctx, request.GetString("explanation", ""), operations); err != nil {
+				return mcp.NewToolResultErrorFromErr("failed to apply the file operations, none was applied", err), nil
+			}
+
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return nil, fmt.Errorf("unable to update the environment: %w", err)
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("%d file operation(s) applied successfully and committed to container-use/%s remote ref", len(operations), env.ID)), nil
+		},
+	}
+}
+
+// fileOperations returns the operations of an environment_file_batch call.
+func fileOperations(request mcp.CallToolRequest) ([]environment.FileOperation, error) {
+	raw, ok := request.GetArguments()["operations"]
+	if !ok {
+		return nil, errors.New("required argument \"operations\" not found")
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var operations []environment.FileOperation
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return nil, fmt.Errorf("invalid operations: %w", err)
+	}
+	for i, op := range operations {
+		if err := op.Validate(); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i+1, err)
+		}
+	}
+	return operations, nil
+}
+
 func createEnvironmentCheckpointTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -867,6 +1404,334 @@ func createEnvironmentCheckpointTool(singleTenant bool) *Tool {
 	}
 }
 
+// Pagination defaults of the diff tools, keeping responses well within the message limits of clients.
+const (
+	defaultDiffFilesLimit = 200
+	defaultDiffMaxBytes   = 50_000
+)
+
+func createEnvironmentDiffFilesTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_diff_files",
+				description: "List the files changed in the environment relative to the user's current branch, with the lines inserted and deleted in each, " +
+					"renames with their old path, and mode changes such as files made executable. " +
+					"Use it to review large changes: list the files first, then fetch their diffs with environment_diff.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithNumber("offset",
+				mcp.Description("Index of the first file to return, for pagination. Defaults to 0."),
+			),
+			mcp.WithNumber("limit",
+				mcp.Description(fmt.Sprintf("Maximum number of files to return. Defaults to %d.", defaultDiffFilesLimit)),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, err := openRepository(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			envID, err := requestEnvironmentID(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			files, err := repo.ChangedFileStats(ctx, envID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list changed files: %w", err)
+			}
+
+			offset := min(max(request.GetInt("offset", 0), 0), len(files))
+			limit := request.GetInt("limit", defaultDiffFilesLimit)
+			if limit <= 0 {
+				limit = defaultDiffFilesLimit
+			}
+			end := min(offset+limit, len(files))
+			response := map[string]any{
+				"files": files[offset:end],
+				"total": len(files),
+			}
+			if end < len(files) {
+				response["next_offset"] = end
+			}
+
+			out, err := json.Marshal(response)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal changed files: %w", err)
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
+func createEnvironmentDiffTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_diff",
+				description: "Get the diff of the environment relative to the user's current branch, optionally limited to some files, in chunks. " +
+					"When the response has a next_offset, call the tool again with that offset to get the rest of the diff.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithArray("paths",
+				mcp.Description("Files or directories to diff, relative to the repository root. Defaults to every changed file."),
+				mcp.Items(map[string]any{"type": "string"}),
+			),
+			mcp.WithNumber("offset",
+				mcp.Description("Position in the diff to start from, in bytes: the next_offset of the previous chunk. Defaults to 0."),
+			),
+			mcp.WithNumber("max_bytes",
+				mcp.Description(fmt.Sprintf("Maximum size of the chunk, in bytes. Defaults to %d.", defaultDiffMaxBytes)),
+			),
+			mcp.WithBoolean("compress",
+				mcp.Description("Return the chunk gzip-compressed, as a base64 blob. Only use it if you can decompress it."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, err := openRepository(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			envID, err := requestEnvironmentID(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			maxBytes := request.GetInt("max_bytes", defaultDiffMaxBytes)
+			if maxBytes <= 0 {
+				maxBytes = defaultDiffMaxBytes
+			}
+			chunk, err := repo.DiffChunk(ctx, envID, request.GetStringSlice("paths", []string{}), request.GetInt("offset", 0), maxBytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get diff: %w", err)
+			}
+			return diffChunkResult(chunk, request.GetBool("compress", false))
+		},
+	}
+}
+
+// diffChunkResult describes a diff chunk, followed by the diff itself: as text, or gzip-compressed.
+func diffChunkResult(chunk *repository.DiffChunk, compress bool) (*mcp.CallToolResult, error) {
+	summary := fmt.Sprintf("Bytes %d-%d of %d.", chunk.Offset, chunk.Offset+len(chunk.Diff), chunk.TotalBytes)
+	if chunk.NextOffset > 0 {
+		summary += fmt.Sprintf(" More diff remains: call environment_diff again with offset %d.", chunk.NextOffset)
+	}
+	if chunk.TotalBytes == 0 {
+		summary = "No changes."
+	}
+	if !compress {
+		return mcp.NewToolResultText(summary + "\n\n" + chunk.Diff), nil
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write([]byte(chunk.Diff)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("%s The chunk is gzip-compressed (%d bytes).", summary, compressed.Len())),
+			mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+				URI:      "diff://chunk",
+				MIMEType: "application/gzip",
+				Blob:     base64.StdEncoding.EncodeToString(compressed.Bytes()),
+			}),
+		},
+	}, nil
+}
+
+func createEnvironmentAffectedTestsTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_affected_tests",
+				description: "Compute the test packages and files likely affected by the environment's changes, along with suggested commands to run them. " +
+					"Run these targeted tests first for fast feedback before running the full test suite.",
+				useCurrentEnvironment: singleTenant,
+			},
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			affected, err := repo.AffectedTests(ctx, env.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute affected tests: %w", err)
+			}
+
+			out, err := json.Marshal(affected)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal affected tests: %w", err)
+			}
+
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
+func createEnvironmentRunTestsTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_run_tests",
+				description: "Run a test command in the environment and record the parsed results. " +
+					"Reports tests that newly fail compared to the previous run and to the environment's base. " +
+					"Use verbose output (e.g. go test -v, pytest -rA) so individual test results can be parsed.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("command",
+				mcp.Description("The test command to execute."),
+				mcp.Required(),
+			),
+			mcp.WithString("shell",
+				mcp.Description("The shell that will be interpreting this command (default: sh)"),
+			),
+			mcp.WithBoolean("no_wait",
+				mcp.Description("Fail immediately instead of waiting if another command is running in the environment."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, slot, err := openEnvironmentExclusive(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			defer slot.Release()
+
+			command, err := request.RequireString("command")
+			if err != nil {
+				return nil, err
+			}
+
+			startedAt := time.Now()
+			stdout, stderr, exitCode, runErr := env.RunWithExitCode(ctx, command, request.GetString("shell", "sh"), false)
+			// We want to update the repository even if the command failed.
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return nil, fmt.Errorf("failed to update repository: %w", err)
+			}
+			if runErr != nil {
+				return nil, fmt.Errorf("failed to run tests: %w", runErr)
+			}
+
+			report, err := repo.RecordTestRun(ctx, env, &repository.TestRun{
+				Command:   command,
+				ExitCode:  exitCode,
+				StartedAt: startedAt,
+				Results:   repository.ParseTestOutput(stdout + "\n" + stderr),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to record test results: %w", err)
+			}
+
+			out, err := json.Marshal(report)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal test report: %w", err)
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("%s\n%s\n\nTest report: %s%s", stdout, stderr, out, queueNote(slot))), nil
+		},
+	}
+}
+
+func createEnvironmentRunTaskTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_run_task",
+				description: "Run a task of the environment's configuration, such as build, test or lint, after the tasks it depends on. " +
+					"Prefer the configured tasks over your own command lines: they are the project's blessed entry points. " +
+					"Stops at the first task failing and lists the tasks skipped after it.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("task",
+				mcp.Description("The name of the task to run."),
+				mcp.Required(),
+			),
+			mcp.WithString("shell",
+				mcp.Description("The shell that will be interpreting the tasks' commands (default: sh)"),
+			),
+			mcp.WithBoolean("no_wait",
+				mcp.Description("Fail immediately instead of waiting if another command is running in the environment."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, slot, err := openEnvironmentExclusive(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			defer slot.Release()
+
+			task, err := request.RequireString("task")
+			if err != nil {
+				return nil, err
+			}
+
+			result, runErr := env.RunTask(ctx, task, request.GetString("shell", "sh"))
+			if result != nil && len(result.Runs) > 0 {
+				// We want to update the repository even if a task failed.
+				if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+					return nil, fmt.Errorf("failed to update repository: %w", err)
+				}
+			}
+			if runErr != nil {
+				return nil, fmt.Errorf("failed to run task: %w", runErr)
+			}
+
+			out, err := json.Marshal(result)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal task result: %w", err)
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("%s%s", out, queueNote(slot))), nil
+		},
+	}
+}
+
+func createEnvironmentCheckTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_check",
+				description: "Run fast syntax and type checks on files of the environment and return structured diagnostics " +
+					"(gopls check for Go, tsc --noEmit for TypeScript, py_compile for Python). " +
+					"Use it after editing files for quick feedback, before building or running tests.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithArray("paths",
+				mcp.Description("Files or directories to check, relative to the workdir. Defaults to the files changed in the environment."),
+				mcp.Items(map[string]any{"type": "string"}),
+			),
+			mcp.WithBoolean("no_wait",
+				mcp.Description("Fail immediately instead of waiting if another command is running in the environment."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, slot, err := openEnvironmentExclusive(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			defer slot.Release()
+
+			report, err := repo.Check(ctx, env, request.GetStringSlice("paths", []string{}))
+			if err != nil {
+				return nil, fmt.Errorf("failed to check files: %w", err)
+			}
+
+			out, err := json.Marshal(report)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal check report: %w", err)
+			}
+
+			return mcp.NewToolResultText(string(out) + queueNote(slot)), nil
+		},
+	}
+}
+
 func createEnvironmentAddServiceTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -896,10 +1761,11 @@ func createEnvironmentAddServiceTool(singleTenant bool) *Tool {
 			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			repo, env, err := openEnvironment(ctx, request)
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
 			if err != nil {
 				return nil, err
 			}
+			defer slot.Release()
 			serviceName, err := request.RequireString("name")
 			if err != nil {
 				return nil, err
@@ -928,6 +1794,9 @@ func createEnvironmentAddServiceTool(singleTenant bool) *Tool {
 			if err != nil {
 				return nil, fmt.Errorf("failed to add service: %w", err)
 			}
+			if m := idleMonitorFromContext(ctx); m != nil {
+				m.track(repo, env)
+			}
 
 			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
 				return nil, fmt.Errorf("failed to update env: %w", err)
@@ -942,3 +1811,51 @@ func createEnvironmentAddServiceTool(singleTenant bool) *Tool {
 		},
 	}
 }
+
+func createEnvironmentRefreshDependenciesTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_refresh_dependencies",
+				description:           "Copy the current outputs of the environments this environment depends on again (see depends_on of environment_create), e.g. to get the binary a build environment just rebuilt, and commit them.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithArray("from",
+				mcp.Description("Only refresh the dependencies on these environments. Defaults to all the dependencies."),
+				mcp.Items(map[string]any{"type": "string"}),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, slot, err := openEnvironmentForWrite(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			defer slot.Release()
+
+			if len(env.State.Dependencies) == 0 {
+				return nil, fmt.Errorf("environment %s has no dependencies", env.ID)
+			}
+			engines, ok := ctx.Value(enginePoolKey{}).(*repository.EnginePool)
+			if !ok {
+				return nil, fmt.Errorf("dagger client not found in context")
+			}
+			dag, err := engines.ClientFor(ctx, repo, env.ID)
+			if err != nil {
+				return nil, err
+			}
+			refreshed, err := repo.RefreshDependencies(ctx, dag, env, request.GetStringSlice("from", []string{}))
+			if err != nil {
+				return nil, fmt.Errorf("failed to refresh the dependencies: %w", err)
+			}
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return nil, fmt.Errorf("unable to update the environment: %w", err)
+			}
+
+			var lines []string
+			for _, dep := range refreshed {
+				lines = append(lines, fmt.Sprintf("- %s (revision %s)", dep, dep.Revision[:min(len(dep.Revision), 7)]))
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("%d dependencies refreshed and committed to container-use/%s remote ref:\n%s", len(refreshed), env.ID, strings.Join(lines, "\n"))), nil
+		},
+	}
+}
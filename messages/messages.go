@@ -0,0 +1,183 @@
+// Package messages holds the user-facing messages of the CLI in several languages.
+//
+// Messages are looked up by key in the catalog of a locale, and formatted like fmt.Sprintf. Translations can
+// reorder the arguments with explicit indexes, e.g. %[2]s. Messages missing from a catalog fall back to
+// English. Catalogs are JSON objects mapping keys to messages: the built-in ones are in catalogs/, and those
+// of a user directory override their messages or add locales.
+package messages
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultLocale is the locale of the messages when none matches, which every catalog falls back to.
+const DefaultLocale = "en"
+
+//go:embed catalogs/*.json
+var builtinCatalogs embed.FS
+
+// Catalog is the set of messages of a locale.
+type Catalog struct {
+	// Locale is the locale of the messages.
+	Locale   string
+	messages map[string]string
+}
+
+// Locales returns the locales with a built-in catalog, sorted.
+func Locales() []string {
+	entries, _ := builtinCatalogs.ReadDir("catalogs")
+	locales := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		locales = append(locales, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// Load returns the catalog of a locale, such as ja or de-CH: the English messages, overridden by those of
+// the locale's language, then by those of its region if any. At each step, the built-in catalog is overridden
+// by <dir>/<locale>.json if dir is set. Locales without any catalog fail.
+func Load(locale, dir string) (*Catalog, error) {
+	catalog := &Catalog{Locale: DefaultLocale, messages: map[string]string{}}
+	for i, candidate := range localeCandidates(locale) {
+		found, err := catalog.merge(candidate, dir)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			catalog.Locale = candidate
+		} else if i == 0 {
+			return nil, fmt.Errorf("no messages for the default locale %q", DefaultLocale)
+		}
+	}
+	if normalized := normalizeLocale(locale); normalized != catalog.Locale && !strings.HasPrefix(normalized, catalog.Locale+"-") {
+		expected := strings.Join(Locales(), ", ")
+		if dir != "" {
+			expected += fmt.Sprintf(", or a catalog in %s", dir)
+		}
+		return nil, fmt.Errorf("unsupported language %q: expected one of %s", locale, expected)
+	}
+	return catalog, nil
+}
+
+// merge adds the messages of the built-in and user catalogs of locale, reporting whether there were any.
+func (c *Catalog) merge(locale, dir string) (bool, error) {
+	found := false
+	if data, err := builtinCatalogs.ReadFile("catalogs/" + locale + ".json"); err == nil {
+		if err := json.Unmarshal(data, &c.messages); err != nil {
+			return false, fmt.Errorf("invalid built-in messages for %s: %w", locale, err)
+		}
+		found = true
+	}
+	if dir == "" {
+		return found, nil
+	}
+	path := filepath.Join(dir, locale+".json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return found, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, &c.messages); err != nil {
+		return false, fmt.Errorf("invalid messages in %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Get returns the message of key formatted with args, or key itself if no catalog has it.
+func (c *Catalog) Get(key string, args ...any) string {
+	message, ok := c.messages[key]
+	if !ok {
+		message = key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Keys returns the keys of the messages of the catalog, sorted.
+func (c *Catalog) Keys() []string {
+	keys := make([]string, 0, len(c.messages))
+	for key := range c.messages {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// normalizeLocale turns a POSIX locale such as ja_JP.UTF-8 into a language tag such as ja-JP.
+func normalizeLocale(locale string) string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	language, region, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	language = strings.ToLower(language)
+	if language == "" || language == "c" || language == "posix" {
+		return DefaultLocale
+	}
+	if region != "" {
+		return language + "-" + strings.ToUpper(region)
+	}
+	return language
+}
+
+// localeCandidates returns the locales whose catalogs make up that of locale, from the most generic.
+func localeCandidates(locale string) []string {
+	candidates := []string{DefaultLocale}
+	normalized := normalizeLocale(locale)
+	language, _, hasRegion := strings.Cut(normalized, "-")
+	if language != DefaultLocale {
+		candidates = append(candidates, language)
+	}
+	if hasRegion {
+		candidates = append(candidates, normalized)
+	}
+	return candidates
+}
+
+// DetectLocale returns the locale of the user, from CONTAINER_USE_LANG or else the POSIX locale variables,
+// LC_ALL, LC_MESSAGES and LANG.
+func DetectLocale() string {
+	for _, variable := range []string{"CONTAINER_USE_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(variable); locale != "" {
+			return normalizeLocale(locale)
+		}
+	}
+	return DefaultLocale
+}
+
+var defaultCatalog atomic.Pointer[Catalog]
+
+// SetDefault sets the catalog of Get.
+func SetDefault(catalog *Catalog) {
+	defaultCatalog.Store(catalog)
+}
+
+// Default returns the catalog of Get: the one set with SetDefault, or else the built-in catalog of the
+// user's locale, English if it's not supported.
+func Default() *Catalog {
+	if catalog := defaultCatalog.Load(); catalog != nil {
+		return catalog
+	}
+	catalog, err := Load(DetectLocale(), "")
+	if err != nil {
+		catalog, _ = Load(DefaultLocale, "")
+	}
+	defaultCatalog.CompareAndSwap(nil, catalog)
+	return defaultCatalog.Load()
+}
+
+// Get returns the message of key in the default catalog, formatted with args.
+func Get(key string, args ...any) string {
+	return Default().Get(key, args...)
+}
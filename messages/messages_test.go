@@ -0,0 +1,94 @@
+package messages
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var verbPattern = regexp.MustCompile(`%(?:\[(\d+)\])?([a-zA-Z])`)
+
+// argumentVerbs returns the verb formatting each argument of a message.
+func argumentVerbs(message string) map[int]string {
+	verbs := map[int]string{}
+	next := 1
+	for _, match := range verbPattern.FindAllStringSubmatch(message, -1) {
+		if match[1] != "" {
+			next, _ = strconv.Atoi(match[1])
+		}
+		verbs[next] = match[2]
+		next++
+	}
+	return verbs
+}
+
+func TestBuiltinCatalogs(t *testing.T) {
+	assert.Equal(t, []string{"de", "en", "ja"}, Locales())
+
+	english, err := Load(DefaultLocale, "")
+	require.NoError(t, err)
+	for _, locale := range Locales() {
+		catalog, err := Load(locale, "")
+		require.NoError(t, err)
+		assert.Equal(t, locale, catalog.Locale)
+		assert.Equal(t, english.Keys(), catalog.Keys(), "%s translates every message", locale)
+		for _, key := range english.Keys() {
+			assert.Equal(t, argumentVerbs(english.messages[key]), argumentVerbs(catalog.messages[key]), "%s: %s formats the same arguments", locale, key)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	catalog, err := Load("ja_JP.UTF-8", "")
+	require.NoError(t, err)
+	assert.Equal(t, "ja", catalog.Locale)
+	assert.Equal(t, "環境を作成しました: fancy-mallard", catalog.Get("create.created", "fancy-mallard"))
+	assert.Equal(t, "コマンドが 2 個のファイルを変更したため、環境 fancy-mallard を残しました:", catalog.Get("run.kept", 2, "fancy-mallard"))
+	assert.Equal(t, "unknown.key", catalog.Get("unknown.key"))
+
+	for _, locale := range []string{"C", "POSIX", "en_US.UTF-8", ""} {
+		catalog, err := Load(locale, "")
+		require.NoError(t, err, locale)
+		assert.Equal(t, DefaultLocale, catalog.Locale)
+	}
+
+	_, err = Load("fr", "")
+	assert.ErrorContains(t, err, `unsupported language "fr"`)
+
+	// User catalogs override the built-in messages and add locales, falling back to English.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de-CH.json"), []byte(`{"docker.start": "Bitte starten Sie Docker neu."}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fr.json"), []byte(`{"docker.start": "Veuillez démarrer Docker."}`), 0600))
+	catalog, err = Load("de_CH", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "de-CH", catalog.Locale)
+	assert.Equal(t, "Bitte starten Sie Docker neu.", catalog.Get("docker.start"))
+	assert.Equal(t, "Fehler: Der Docker-Daemon läuft nicht.", catalog.Get("docker.not_running"))
+	catalog, err = Load("fr", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "Veuillez démarrer Docker.", catalog.Get("docker.start"))
+	assert.Equal(t, "Error: Docker daemon is not running.", catalog.Get("docker.not_running"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ja.json"), []byte(`not json`), 0600))
+	_, err = Load("ja", dir)
+	assert.ErrorContains(t, err, "invalid messages")
+}
+
+func TestDetectLocale(t *testing.T) {
+	for _, variable := range []string{"CONTAINER_USE_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		t.Setenv(variable, "")
+	}
+	assert.Equal(t, DefaultLocale, DetectLocale())
+
+	t.Setenv("LANG", "de_DE.UTF-8")
+	assert.Equal(t, "de-DE", DetectLocale())
+	t.Setenv("LC_ALL", "ja_JP.UTF-8")
+	assert.Equal(t, "ja-JP", DetectLocale())
+	t.Setenv("CONTAINER_USE_LANG", "en")
+	assert.Equal(t, "en", DetectLocale())
+}
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// AffectedTests describes the tests that are likely impacted by an environment's changes.
+type AffectedTests struct {
+	EnvironmentID string            `json:"environment_id"`
+	ChangedFiles  []string          `json:"changed_files"`
+	Targets       []*AffectedTarget `json:"targets"`
+	// Commands holds a suggested command per language to run the affected targets.
+	Commands map[string]string `json:"commands"`
+}
+
+// AffectedTarget is a single test package or file that should be run first.
+type AffectedTarget struct {
+	Language string `json:"language"`
+	Path     string `json:"path"`
+	Reason   string `json:"reason"`
+}
+
+func suggestedTestCommands(targets []*AffectedTarget) map[string]string {
+	byLanguage := map[string][]string{}
+	for _, target := range targets {
+		byLanguage[target.Language] = append(byLanguage[target.Language], target.Path)
+	}
+
+	commands := map[string]string{}
+	for language, paths := range byLanguage {
+		switch language {
+		case "go":
+			pkgs := make([]string, len(paths))
+			for i, p := range paths {
+				pkgs[i] = "./" + p
+				if p == "." {
+					pkgs[i] = "."
+				}
+			}
+			commands[language] = "go test " + strings.Join(pkgs, " ")
+		case "javascript":
+			commands[language] = "npx jest " + strings.Join(paths, " ")
+		case "python":
+			commands[language] = "python -m pytest " + strings.Join(paths, " ")
+		}
+	}
+	return commands
+}
+
+// ChangedFiles returns the files changed by an environment relative to the current branch.
+func (r *Repository) ChangedFiles(ctx context.Context, id string) ([]string, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--name-only", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for line := range strings.SplitSeq(strings.TrimSpace(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// AffectedTests computes the set of test packages and files likely affected by an environment's diff.
+// The analysis runs against the environment's worktree on the host and does not require dagger.
+func (r *Repository) AffectedTests(ctx context.Context, id string) (*AffectedTests, error) {
+	changed, err := r.ChangedFiles(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := r.getWorktree(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := findAffectedTests(worktree, changed)
+	return &AffectedTests{
+		EnvironmentID: id,
+		ChangedFiles:  changed,
+		Targets:       targets,
+		Commands:      suggestedTestCommands(targets),
+	}, nil
+}
+
+func findAffectedTests(root string, changed []string) []*AffectedTarget {
+	targets := []*AffectedTarget{}
+	seen := map[string]bool{}
+	add := func(language, p, reason string) {
+		key := language + ":" + p
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		targets = append(targets, &AffectedTarget{Language: language, Path: p, Reason: reason})
+	}
+
+	goPackages := []string{}
+	for _, file := range changed {
+		file = filepath.ToSlash(file)
+		switch ext := path.Ext(file); ext {
+		case ".go":
+			pkg := path.Dir(file)
+			if !slices.Contains(goPackages, pkg) {
+				goPackages = append(goPackages, pkg)
+			}
+		case ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs":
+			if isJSTestFile(file) {
+				add("javascript", file, "test file changed")
+				continue
+			}
+			for _, candidate := range jsTestCandidates(file) {
+				if fileExists(root, candidate) {
+					add("javascript", candidate, fmt.Sprintf("tests %s", file))
+				}
+			}
+		case ".py":
+			if isPythonTestFile(file) {
+				add("python", file, "test file changed")
+				continue
+			}
+			for _, candidate := range pythonTestCandidates(file) {
+				if fileExists(root, candidate) {
+					add("python", candidate, fmt.Sprintf("tests %s", file))
+				}
+			}
+		}
+	}
+
+	for _, pkg := range goPackages {
+		add("go", pkg, "package changed")
+	}
+	for _, dependent := range goReverseDependencies(root, goPackages) {
+		add("go", dependent.pkg, fmt.Sprintf("imports %s", dependent.imports))
+	}
+
+	return targets
+}
+
+func fileExists(root, rel string) bool {
+	_, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+	return err == nil
+}
+
+func isJSTestFile(file string) bool {
+	base := path.Base(file)
+	return strings.Contains(base, ".test.") || strings.Contains(base, ".spec.") || slices.Contains(strings.Split(file, "/"), "__tests__")
+}
+
+func jsTestCandidates(file string) []string {
+	dir, base := path.Split(file)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	candidates := []string{}
+	for _, testExt := range []string{ext, ".js", ".ts"} {
+		for _, suffix := range []string{".test", ".spec"} {
+			candidates = append(candidates,
+				path.Join(dir, name+suffix+testExt),
+				path.Join(dir, "__tests__", name+suffix+testExt),
+			)
+		}
+		candidates = append(candidates, path.Join(dir, "__tests__", name+testExt))
+	}
+	return candidates
+}
+
+func isPythonTestFile(file string) bool {
+	base := path.Base(file)
+	return strings.HasPrefix(base, "test_") || strings.HasSuffix(base, "_test.py")
+}
+
+func pythonTestCandidates(file string) []string {
+	dir, base := path.Split(file)
+	name := strings.TrimSuffix(base, ".py")
+
+	return []string{
+		path.Join(dir, "test_"+name+".py"),
+		path.Join(dir, name+"_test.py"),
+		path.Join(dir, "tests", "test_"+name+".py"),
+		path.Join("tests", "test_"+name+".py"),
+		path.Join("test", "test_"+name+".py"),
+	}
+}
+
+type goDependent struct {
+	pkg     string
+	imports string
+}
+
+// goReverseDependencies finds packages within the module that import any of the given packages.
+func goReverseDependencies(root string, pkgs []string) []goDependent {
+	if len(pkgs) == 0 {
+		return nil
+	}
+	module := goModulePath(root)
+	if module == "" {
+		return nil
+	}
+
+	importPaths := map[string]string{}
+	for _, pkg := range pkgs {
+		importPath := module
+		if pkg != "." {
+			importPath = module + "/" + pkg
+		}
+		importPaths[importPath] = pkg
+	}
+
+	dependents := map[string]string{}
+	_ = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(p))
+		if err != nil {
+			return nil
+		}
+		pkg := filepath.ToSlash(rel)
+		if _, ok := dependents[pkg]; ok || slices.Contains(pkgs, pkg) {
+			return nil
+		}
+		for _, imported := range goImports(p) {
+			if changedPkg, ok := importPaths[imported]; ok {
+				dependents[pkg] = changedPkg
+				break
+			}
+		}
+		return nil
+	})
+
+	result := make([]goDependent, 0, len(dependents))
+	for pkg, imports := range dependents {
+		result = append(result, goDependent{pkg: pkg, imports: imports})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].pkg < result[j].pkg })
+	return result
+}
+
+func goModulePath(root string) string {
+	f, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if module, ok := strings.CutPrefix(line, "module "); ok {
+			return strings.Trim(strings.TrimSpace(module), `"`)
+		}
+	}
+	return ""
+}
+
+// goImports does a lightweight scan of a Go file's import block without a full parse.
+func goImports(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	imports := []string{}
+	inBlock := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case inBlock && line == ")":
+			return imports
+		case inBlock:
+			if imported := quotedImport(line); imported != "" {
+				imports = append(imports, imported)
+			}
+		case line == "import (":
+			inBlock = true
+		case strings.HasPrefix(line, "import "):
+			if imported := quotedImport(strings.TrimPrefix(line, "import ")); imported != "" {
+				imports = append(imports, imported)
+			}
+		case strings.HasPrefix(line, "func ") || strings.HasPrefix(line, "type ") || strings.HasPrefix(line, "var "):
+			return imports
+		}
+	}
+	return imports
+}
+
+func quotedImport(spec string) string {
+	start := strings.Index(spec, `"`)
+	if start == -1 {
+		return ""
+	}
+	end := strings.Index(spec[start+1:], `"`)
+	if end == -1 {
+		return ""
+	}
+	return spec[start+1 : start+1+end]
+}
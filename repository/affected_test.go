@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Affected test detection lets agents run the tests that matter for their diff first
+func TestFindAffectedTests(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module example.com/app\n\ngo 1.24\n")
+	writeFile(t, dir, "lib/lib.go", "package lib\n\nfunc Hello() string { return \"hi\" }\n")
+	writeFile(t, dir, "cmd/app/main.go", "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/lib\"\n)\n\nfunc main() { fmt.Println(lib.Hello()) }\n")
+	writeFile(t, dir, "other/other.go", "package other\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint\n")
+	writeFile(t, dir, "web/button.js", "export const x = 1\n")
+	writeFile(t, dir, "web/button.test.js", "test('x', () => {})\n")
+	writeFile(t, dir, "pkg/util.py", "def f(): pass\n")
+	writeFile(t, dir, "tests/test_util.py", "def test_f(): pass\n")
+
+	targets := findAffectedTests(dir, []string{"lib/lib.go", "web/button.js", "pkg/util.py", "README.md"})
+
+	paths := map[string][]string{}
+	for _, target := range targets {
+		paths[target.Language] = append(paths[target.Language], target.Path)
+	}
+
+	assert.Equal(t, []string{"lib", "cmd/app"}, paths["go"], "changed package and its importers should be affected")
+	assert.Equal(t, []string{"web/button.test.js"}, paths["javascript"])
+	assert.Equal(t, []string{"tests/test_util.py"}, paths["python"])
+
+	commands := suggestedTestCommands(targets)
+	assert.Equal(t, "go test ./lib ./cmd/app", commands["go"])
+	assert.Equal(t, "python -m pytest tests/test_util.py", commands["python"])
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyCommits(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+	commit := func(name, message string) string {
+		t.Helper()
+		writeFile(t, userRepo, name, name+"\n")
+		runGit(t, userRepo, "add", ".")
+		runGit(t, userRepo, "commit", "-m", message, "--author", "Agent <agent@example.com>")
+		return runGit(t, userRepo, "rev-parse", "HEAD")
+	}
+
+	runGit(t, userRepo, "checkout", "-b", "work")
+	first := commit("a.txt", "Add a")
+	second := commit("b.txt", "Add b")
+	third := commit("c.txt", "Add c")
+	runGit(t, userRepo, "checkout", "main")
+	seedEnvironment(t, repo, "test-env", "work", &environment.State{Title: "Add files", Config: environment.DefaultConfig()})
+
+	err := repo.ApplyCommits(ctx, "test-env", []string{"main"}, io.Discard)
+	assert.ErrorContains(t, err, "is not one of the changes of environment test-env")
+
+	// Selected commits are applied oldest first, whatever the order they're given in.
+	require.NoError(t, repo.ApplyCommits(ctx, "test-env", []string{third[:7], first + ".." + second}, io.Discard))
+	assert.Equal(t, "Add c\nAdd b\ninit", runGit(t, userRepo, "log", "--format=%s"))
+	assert.Equal(t, "Agent <agent@example.com>", runGit(t, userRepo, "log", "-1", "--format=%an <%ae>"))
+	assert.Equal(t, "Test", runGit(t, userRepo, "log", "-1", "--format=%cn"))
+
+	_, err = os.Stat(filepath.Join(userRepo, "a.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Approval request statuses.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+const approvalPollInterval = 500 * time.Millisecond
+
+// ErrApprovalNotFound is returned when an approval request doesn't exist.
+var ErrApprovalNotFound = errors.New("approval request not found")
+
+// ApprovalRequest is an operation waiting for the user's out-of-band approval.
+type ApprovalRequest struct {
+	ID            string `json:"id"`
+	Operation     string `json:"operation"`
+	EnvironmentID string `json:"environment_id,omitempty"`
+	Summary       string `json:"summary,omitempty"`
+	// PublicKey seals the user's answer, for requests asking for input rather than a decision.
+	// Answers may be secrets: only the waiting server, which holds the private key, can read them.
+	PublicKey []byte `json:"public_key,omitempty"`
+	// SealedAnswer is the user's answer, sealed with PublicKey.
+	SealedAnswer []byte    `json:"sealed_answer,omitempty"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// key opens the sealed answer. It's never saved.
+	key *ecdh.PrivateKey
+}
+
+func (r *Repository) approvalsPath() string {
+	return filepath.Join(r.basePath, "approvals", fmt.Sprintf("%x", hashString(r.forkRepoPath)))
+}
+
+func (r *Repository) approvalPath(id string) string {
+	return filepath.Join(r.approvalsPath(), id+".json")
+}
+
+// RequestApproval records a pending approval request for an operation.
+func (r *Repository) RequestApproval(operation, envID, summary string) (*ApprovalRequest, error) {
+	req, err := newApprovalRequest(operation, envID, summary)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.saveApproval(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// RequestInput records a pending request for the user's answer to a prompt, to wait for with WaitForAnswer.
+func (r *Repository) RequestInput(envID, summary string) (*ApprovalRequest, error) {
+	req, err := newApprovalRequest("input", envID, summary)
+	if err != nil {
+		return nil, err
+	}
+	if req.key, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		return nil, err
+	}
+	req.PublicKey = req.key.PublicKey().Bytes()
+	if err := r.saveApproval(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func newApprovalRequest(operation, envID, summary string) (*ApprovalRequest, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &ApprovalRequest{
+		ID:            hex.EncodeToString(b),
+		Operation:     operation,
+		EnvironmentID: envID,
+		Summary:       summary,
+		Status:        ApprovalPending,
+		CreatedAt:     time.Now().UTC(),
+	}, nil
+}
+
+// WaitForApproval blocks until the request is approved or denied, returning whether it was approved.
+// The request is removed once resolved or when the context is done.
+func (r *Repository) WaitForApproval(ctx context.Context, id string) (bool, error) {
+	req, err := r.waitForResolution(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return req.Status == ApprovalApproved, nil
+}
+
+// WaitForAnswer is WaitForApproval for requests made with RequestInput, also returning the user's answer.
+func (r *Repository) WaitForAnswer(ctx context.Context, req *ApprovalRequest) (string, bool, error) {
+	if req.key == nil {
+		return "", false, fmt.Errorf("approval request %s doesn't ask for input", req.ID)
+	}
+	resolved, err := r.waitForResolution(ctx, req.ID)
+	if err != nil {
+		return "", false, err
+	}
+	if resolved.Status != ApprovalApproved {
+		return "", false, nil
+	}
+	answer, err := openAnswer(req.key, req.ID, resolved.SealedAnswer)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the answer to %s: %w", req.ID, err)
+	}
+	return answer, true, nil
+}
+
+func (r *Repository) waitForResolution(ctx context.Context, id string) (*ApprovalRequest, error) {
+	defer os.Remove(r.approvalPath(id))
+
+	for {
+		req, err := r.GetApproval(id)
+		if err != nil {
+			return nil, err
+		}
+		if req.Status != ApprovalPending {
+			return req, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(approvalPollInterval):
+		}
+	}
+}
+
+// GetApproval returns an approval request by ID.
+func (r *Repository) GetApproval(id string) (*ApprovalRequest, error) {
+	data, err := os.ReadFile(r.approvalPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+		}
+		return nil, err
+	}
+	req := &ApprovalRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("invalid approval request %s: %w", id, err)
+	}
+	return req, nil
+}
+
+// ListApprovals returns the pending approval requests, oldest first.
+func (r *Repository) ListApprovals() ([]*ApprovalRequest, error) {
+	entries, err := os.ReadDir(r.approvalsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var requests []*ApprovalRequest
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		req, err := r.GetApproval(id)
+		if err != nil {
+			if errors.Is(err, ErrApprovalNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if req.Status == ApprovalPending {
+			requests = append(requests, req)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
+
+// ResolveApproval approves or denies a pending approval request.
+func (r *Repository) ResolveApproval(id string, approve bool) error {
+	req, err := r.GetApproval(id)
+	if err != nil {
+		return err
+	}
+	if req.Status != ApprovalPending {
+		return fmt.Errorf("approval request %s is already %s", id, req.Status)
+	}
+
+	req.Status = ApprovalDenied
+	if approve {
+		req.Status = ApprovalApproved
+	}
+	return r.saveApproval(req)
+}
+
+// AnswerApproval approves a pending request asking for input, with the user's answer.
+func (r *Repository) AnswerApproval(id, answer string) error {
+	req, err := r.GetApproval(id)
+	if err != nil {
+		return err
+	}
+	if req.Status != ApprovalPending {
+		return fmt.Errorf("approval request %s is already %s", id, req.Status)
+	}
+	if len(req.PublicKey) == 0 {
+		return fmt.Errorf("approval request %s doesn't ask for input", id)
+	}
+
+	if req.SealedAnswer, err = sealAnswer(req.PublicKey, id, answer); err != nil {
+		return fmt.Errorf("failed to seal the answer: %w", err)
+	}
+	req.Status = ApprovalApproved
+	return r.saveApproval(req)
+}
+
+// sealAnswer encrypts an answer for the holder of the request's private key: an ephemeral X25519 key
+// agreement derives an AES-GCM key, and the sealed answer is the ephemeral public key, nonce and ciphertext.
+func sealAnswer(publicKey []byte, id, answer string) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := answerCipher(ephemeral, recipient)
+	if err != nil {
+		return nil, err
+	}
+	sealed := ephemeral.PublicKey().Bytes()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed = append(sealed, nonce...)
+	return aead.Seal(sealed, nonce, []byte(answer), []byte(id)), nil
+}
+
+// openAnswer decrypts an answer sealed by sealAnswer.
+func openAnswer(key *ecdh.PrivateKey, id string, sealed []byte) (string, error) {
+	keySize := len(key.PublicKey().Bytes())
+	if len(sealed) < keySize {
+		return "", errors.New("sealed answer is too short")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:keySize])
+	if err != nil {
+		return "", err
+	}
+	aead, err := answerCipher(key, ephemeral)
+	if err != nil {
+		return "", err
+	}
+	sealed = sealed[keySize:]
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("sealed answer is too short")
+	}
+	answer, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return string(answer), nil
+}
+
+func answerCipher(private *ecdh.PrivateKey, public *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(shared)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (r *Repository) saveApproval(req *ApprovalRequest) error {
+	if err := os.MkdirAll(r.approvalsPath(), 0755); err != nil {
+		return fmt.Errorf("failed to create approvals directory: %w", err)
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	// Write atomically so the waiting server never reads a partial request.
+	tmp := r.approvalPath(req.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.approvalPath(req.ID))
+}
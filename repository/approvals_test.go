@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApprovals(t *testing.T) {
+	ctx := context.Background()
+	repo := &Repository{basePath: t.TempDir(), forkRepoPath: "/fork"}
+
+	first, err := repo.RequestApproval("environment_config", "fancy-mallard", "change base image")
+	require.NoError(t, err)
+	second, err := repo.RequestApproval("environment_file_delete", "fancy-mallard", "delete main.go")
+	require.NoError(t, err)
+
+	pending, err := repo.ListApprovals()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, first.ID, pending[0].ID)
+
+	t.Run("approve", func(t *testing.T) {
+		go func() {
+			time.Sleep(approvalPollInterval)
+			assert.NoError(t, repo.ResolveApproval(first.ID, true))
+		}()
+		approved, err := repo.WaitForApproval(ctx, first.ID)
+		require.NoError(t, err)
+		assert.True(t, approved)
+
+		_, err = repo.GetApproval(first.ID)
+		assert.True(t, errors.Is(err, ErrApprovalNotFound), "resolved requests are removed")
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		require.NoError(t, repo.ResolveApproval(second.ID, false))
+		assert.Error(t, repo.ResolveApproval(second.ID, true), "requests can only be resolved once")
+
+		approved, err := repo.WaitForApproval(ctx, second.ID)
+		require.NoError(t, err)
+		assert.False(t, approved)
+	})
+
+	t.Run("answer", func(t *testing.T) {
+		req, err := repo.RequestInput("fancy-mallard", "Password:")
+		require.NoError(t, err)
+		require.NoError(t, repo.AnswerApproval(req.ID, "hunter2"))
+
+		saved, err := os.ReadFile(repo.approvalPath(req.ID))
+		require.NoError(t, err)
+		assert.NotContains(t, string(saved), "hunter2", "answers are saved sealed")
+
+		answer, answered, err := repo.WaitForAnswer(ctx, req)
+		require.NoError(t, err)
+		assert.True(t, answered)
+		assert.Equal(t, "hunter2", answer)
+	})
+
+	t.Run("answer requires input request", func(t *testing.T) {
+		req, err := repo.RequestApproval("environment_config", "fancy-mallard", "")
+		require.NoError(t, err)
+		assert.Error(t, repo.AnswerApproval(req.ID, "yes"))
+		require.NoError(t, repo.ResolveApproval(req.ID, false))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		req, err := repo.RequestApproval("environment_config", "fancy-mallard", "")
+		require.NoError(t, err)
+
+		waitCtx, cancel := context.WithTimeout(ctx, approvalPollInterval)
+		defer cancel()
+		_, err = repo.WaitForApproval(waitCtx, req.ID)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		pending, err := repo.ListApprovals()
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+}
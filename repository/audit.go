@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AuditRecord is an entry of the repository's audit log: a tool call an MCP client made,
+// and whether the server's permissions allowed it.
+type AuditRecord struct {
+	Time          time.Time `json:"time"`
+	Client        string    `json:"client"`
+	Session       string    `json:"session,omitempty"`
+	Tool          string    `json:"tool"`
+	Scope         string    `json:"scope"`
+	EnvironmentID string    `json:"environment_id,omitempty"`
+	// Hardened is set when the environment runs commands unprivileged.
+	Hardened bool `json:"hardened,omitempty"`
+	Allowed  bool `json:"allowed"`
+	// Reason explains why the call was denied.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (r *Repository) auditLogPath() string {
+	return filepath.Join(r.basePath, "audit", fmt.Sprintf("%x.ndjson", hashString(r.forkRepoPath)))
+}
+
+// RecordAudit appends a record to the repository's audit log.
+// Failures are logged rather than returned, like event log failures.
+func (r *Repository) RecordAudit(record *AuditRecord) {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		slog.Error("Failed to encode audit record", "tool", record.Tool, "err", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.auditLogPath()), 0755); err != nil {
+		slog.Error("Failed to create audit directory", "err", err)
+		return
+	}
+	f, err := os.OpenFile(r.auditLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Failed to open audit log", "err", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Error("Failed to write audit record", "tool", record.Tool, "err", err)
+	}
+}
+
+// AuditLog returns the records of the repository's audit log, oldest first.
+func (r *Repository) AuditLog() ([]*AuditRecord, error) {
+	f, err := os.Open(r.auditLogPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record := &AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			// A record cut short by a crash must not hide the others.
+			slog.Warn("Skipping invalid audit record", "err", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
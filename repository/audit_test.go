@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir(), forkRepoPath: "/fork"}
+
+	records, err := repo.AuditLog()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	repo.RecordAudit(&AuditRecord{Client: "cursor", Tool: "environment_run_cmd", Scope: "exec", Allowed: true})
+	repo.RecordAudit(&AuditRecord{Client: "cursor", Tool: "environment_file_delete", Scope: "delete", Reason: "denied"})
+
+	records, err = repo.AuditLog()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.True(t, records[0].Allowed)
+	assert.False(t, records[0].Time.IsZero())
+	assert.Equal(t, "environment_file_delete", records[1].Tool)
+	assert.False(t, records[1].Allowed)
+}
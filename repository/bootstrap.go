@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+)
+
+// ErrConfigExists is returned by Bootstrap when the repository is already configured.
+var ErrConfigExists = errors.New("the repository already has a container-use configuration")
+
+// Bootstrap prepares dir for container-use with the given configuration: dir becomes a git repository
+// if it isn't in one, and the configuration is saved unless the repository has one, which overwrite
+// replaces. A repository without commits gets a first one with the configuration, since environments
+// are created from a commit.
+func Bootstrap(ctx context.Context, dir string, config *environment.EnvironmentConfig, overwrite bool) (*Repository, error) {
+	if _, err := RunGitCommand(ctx, dir, "rev-parse", "--show-toplevel"); err != nil {
+		if _, err := RunGitCommand(ctx, dir, "init"); err != nil {
+			return nil, fmt.Errorf("failed to initialize a git repository: %w", err)
+		}
+	}
+	repo, err := Open(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.bootstrap(ctx, config, overwrite); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *Repository) bootstrap(ctx context.Context, config *environment.EnvironmentConfig, overwrite bool) error {
+	configFile := environment.ConfigFile(r.userRepoPath)
+	if _, err := os.Stat(configFile); err == nil && !overwrite {
+		return ErrConfigExists
+	}
+	if err := config.Save(r.userRepoPath); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		return nil
+	}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "add", "--", configFile); err != nil {
+		return err
+	}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "commit", "-m", "Add container-use configuration", "--", configFile); err != nil {
+		return fmt.Errorf("failed to commit the configuration: %w", err)
+	}
+	return nil
+}
+
+// Scaffold creates an environment with the starter files of a project template.
+func (r *Repository) Scaffold(ctx context.Context, dag *dagger.Client, tmpl *environment.ProjectTemplate, vars environment.ProjectTemplateVars, title string) (*environment.Environment, error) {
+	files, err := tmpl.Files(vars)
+	if err != nil {
+		return nil, err
+	}
+	env, err := r.Create(ctx, dag, title, "Scaffold a "+tmpl.Name+" project", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if err := env.WriteFiles(ctx, files); err != nil {
+		return env, err
+	}
+	if err := r.Update(ctx, env, "Scaffold a "+tmpl.Name+" project"); err != nil {
+		return env, fmt.Errorf("unable to update the environment: %w", err)
+	}
+	return env, nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrap(t *testing.T) {
+	ctx := context.Background()
+	setGitIdentity(t)
+	userRepo := t.TempDir()
+	runGit(t, userRepo, "init", "-b", "main")
+	repo, err := OpenWithBasePath(ctx, userRepo, t.TempDir())
+	require.NoError(t, err)
+
+	config := environment.DefaultConfig()
+	config.BaseImage = "golang:1.24"
+	require.NoError(t, repo.bootstrap(ctx, config, false))
+
+	loaded := environment.DefaultConfig()
+	require.NoError(t, loaded.Load(userRepo))
+	assert.Equal(t, "golang:1.24", loaded.BaseImage)
+
+	// The repository had no commits: environments need one to be created from.
+	assert.Equal(t, ".container-use/environment.json", runGit(t, userRepo, "ls-tree", "-r", "--name-only", "HEAD"))
+
+	config.BaseImage = "golang:1.25"
+	assert.ErrorIs(t, repo.bootstrap(ctx, config, false), ErrConfigExists)
+
+	require.NoError(t, repo.bootstrap(ctx, config, true))
+	require.NoError(t, loaded.Load(userRepo))
+	assert.Equal(t, "golang:1.25", loaded.BaseImage)
+	assert.Equal(t, "1", runGit(t, userRepo, "rev-list", "--count", "HEAD"), "existing commits are left alone")
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// EventBudgetExceeded is recorded when an environment's changes grow past its change budget.
+const EventBudgetExceeded = "budget_exceeded"
+
+// ErrChangeBudgetExceeded is returned when running commands in an environment that is over its
+// change budget, configured to block, and not acknowledged yet.
+var ErrChangeBudgetExceeded = errors.New("change budget exceeded")
+
+// BudgetStatus is the size of an environment's changes relative to its change budget.
+type BudgetStatus struct {
+	// Files and Lines are the changes since the environment's base.
+	Files int `json:"files"`
+	Lines int `json:"lines"`
+	// MaxFiles, MaxLines and Block are the budget the changes were checked against.
+	MaxFiles int  `json:"max_files,omitempty"`
+	MaxLines int  `json:"max_lines,omitempty"`
+	Block    bool `json:"block,omitempty"`
+	// AcknowledgedFiles and AcknowledgedLines are the changes a human acknowledged:
+	// the budget applies to the changes made since.
+	AcknowledgedFiles int       `json:"acknowledged_files,omitempty"`
+	AcknowledgedLines int       `json:"acknowledged_lines,omitempty"`
+	Exceeded          bool      `json:"exceeded"`
+	CheckedAt         time.Time `json:"checked_at"`
+}
+
+func (s *BudgetStatus) exceeds() bool {
+	return (s.MaxFiles > 0 && s.Files-s.AcknowledgedFiles > s.MaxFiles) ||
+		(s.MaxLines > 0 && s.Lines-s.AcknowledgedLines > s.MaxLines)
+}
+
+func (s *BudgetStatus) String() string {
+	return fmt.Sprintf("%d files and %d lines changed, budget is %s", s.Files, s.Lines, describeBudget(s.MaxFiles, s.MaxLines))
+}
+
+func describeBudget(maxFiles, maxLines int) string {
+	switch {
+	case maxFiles > 0 && maxLines > 0:
+		return fmt.Sprintf("%d files and %d lines", maxFiles, maxLines)
+	case maxFiles > 0:
+		return fmt.Sprintf("%d files", maxFiles)
+	default:
+		return fmt.Sprintf("%d lines", maxLines)
+	}
+}
+
+func (r *Repository) budgetPath(id string) string {
+	return filepath.Join(r.basePath, "budgets", fmt.Sprintf("%x", hashString(r.forkRepoPath)), id+".json")
+}
+
+// ChangeBudget returns the budget status of an environment, or nil if it has no change budget.
+func (r *Repository) ChangeBudget(id string) (*BudgetStatus, error) {
+	data, err := os.ReadFile(r.budgetPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status := &BudgetStatus{}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, fmt.Errorf("invalid budget status for %s: %w", id, err)
+	}
+	return status, nil
+}
+
+func (r *Repository) saveBudget(id string, status *BudgetStatus) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := r.budgetPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// CheckChangeBudget returns ErrChangeBudgetExceeded if commands must not run in the environment
+// until a human acknowledges its changes.
+func (r *Repository) CheckChangeBudget(id string) error {
+	status, err := r.ChangeBudget(id)
+	if err != nil || status == nil {
+		return err
+	}
+	if status.Exceeded && status.Block {
+		return fmt.Errorf("%w in environment %s (%s): ask the user to review the changes with 'container-use diff %s' and acknowledge them with 'container-use budget ack %s'",
+			ErrChangeBudgetExceeded, id, status, id, id)
+	}
+	return nil
+}
+
+// AcknowledgeChangeBudget records that a human reviewed the environment's changes so far.
+// The budget then applies to the changes made after the acknowledgement.
+func (r *Repository) AcknowledgeChangeBudget(id string) (*BudgetStatus, error) {
+	status, err := r.ChangeBudget(id)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, fmt.Errorf("environment %s has no change budget", id)
+	}
+	status.AcknowledgedFiles = status.Files
+	status.AcknowledgedLines = status.Lines
+	status.Exceeded = false
+	return status, r.saveBudget(id, status)
+}
+
+// updateChangeBudget measures the environment's changes against its change budget,
+// recording an event the first time they exceed it.
+// Failures are logged rather than returned: the budget must never break the operation that changed the environment.
+func (r *Repository) updateChangeBudget(ctx context.Context, env *environment.Environment) {
+	budget := env.State.Config.ChangeBudget
+	if budget == nil || (budget.MaxFiles <= 0 && budget.MaxLines <= 0) {
+		return
+	}
+
+	revisionRange, err := r.revisionRange(ctx, env.EnvironmentInfo)
+	if err != nil {
+		slog.Warn("Failed to measure changes against the change budget", "environment-id", env.ID, "err", err)
+		return
+	}
+	stats, err := r.diffStats(ctx, revisionRange)
+	if err != nil {
+		slog.Warn("Failed to measure changes against the change budget", "environment-id", env.ID, "err", err)
+		return
+	}
+
+	status, err := r.ChangeBudget(env.ID)
+	if err != nil || status == nil {
+		status = &BudgetStatus{}
+	}
+	wasExceeded := status.Exceeded
+	status.Files = stats.FilesChanged
+	status.Lines = stats.Insertions + stats.Deletions
+	status.MaxFiles = budget.MaxFiles
+	status.MaxLines = budget.MaxLines
+	status.Block = budget.Block
+	status.Exceeded = status.exceeds()
+	status.CheckedAt = time.Now().UTC()
+
+	if status.Exceeded && !wasExceeded {
+		slog.Warn("Environment exceeded its change budget", "environment-id", env.ID, "files", status.Files, "lines", status.Lines)
+		r.recordEvent(env.ID, EventBudgetExceeded, map[string]any{
+			"files":     status.Files,
+			"lines":     status.Lines,
+			"max_files": status.MaxFiles,
+			"max_lines": status.MaxLines,
+			"block":     status.Block,
+		})
+	}
+	if err := r.saveBudget(env.ID, status); err != nil {
+		slog.Warn("Failed to save change budget status", "environment-id", env.ID, "err", err)
+	}
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeBudget(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir(), forkRepoPath: "/fork"}
+
+	status, err := repo.ChangeBudget("test-env")
+	require.NoError(t, err)
+	assert.Nil(t, status)
+	require.NoError(t, repo.CheckChangeBudget("test-env"))
+	_, err = repo.AcknowledgeChangeBudget("test-env")
+	assert.Error(t, err)
+
+	status = &BudgetStatus{Files: 12, Lines: 300, MaxFiles: 10, MaxLines: 500, Block: true}
+	status.Exceeded = status.exceeds()
+	assert.True(t, status.Exceeded)
+	require.NoError(t, repo.saveBudget("test-env", status))
+
+	err = repo.CheckChangeBudget("test-env")
+	assert.ErrorIs(t, err, ErrChangeBudgetExceeded)
+	assert.Contains(t, err.Error(), "12 files and 300 lines changed, budget is 10 files and 500 lines")
+
+	acknowledged, err := repo.AcknowledgeChangeBudget("test-env")
+	require.NoError(t, err)
+	assert.False(t, acknowledged.Exceeded)
+	require.NoError(t, repo.CheckChangeBudget("test-env"))
+
+	// The budget applies to the changes made after the acknowledgement.
+	acknowledged.Files = 21
+	assert.False(t, acknowledged.exceeds())
+	acknowledged.Files = 23
+	assert.True(t, acknowledged.exceeds())
+}
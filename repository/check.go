@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// Diagnostic is a problem reported by a syntax or type check.
+type Diagnostic struct {
+	Language string `json:"language"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// CheckCommand is the command checking the files of one language.
+type CheckCommand struct {
+	Language string   `json:"language"`
+	Files    []string `json:"files"`
+	Command  string   `json:"command"`
+	ExitCode int      `json:"exit_code"`
+	// Output is set when the command failed without reporting any diagnostic, e.g. because the checker isn't installed.
+	Output string `json:"output,omitempty"`
+}
+
+// CheckReport is the result of checking an environment's files.
+type CheckReport struct {
+	EnvironmentID string          `json:"environment_id"`
+	Files         []string        `json:"files"`
+	Commands      []*CheckCommand `json:"commands"`
+	Diagnostics   []*Diagnostic   `json:"diagnostics"`
+}
+
+// Passed reports whether every check succeeded.
+func (report *CheckReport) Passed() bool {
+	for _, command := range report.Commands {
+		if command.ExitCode != 0 {
+			return false
+		}
+	}
+	return len(report.Diagnostics) == 0
+}
+
+var checkLanguages = map[string]string{
+	".go":  "go",
+	".ts":  "typescript",
+	".tsx": "typescript",
+	".mts": "typescript",
+	".cts": "typescript",
+	".py":  "python",
+}
+
+// checkCommands returns the commands checking the given files, one per language.
+// root is the environment's worktree, used to detect project configuration such as tsconfig.json.
+func checkCommands(root string, files []string) []*CheckCommand {
+	byLanguage := map[string][]string{}
+	for _, file := range files {
+		if language, ok := checkLanguages[path.Ext(file)]; ok {
+			byLanguage[language] = append(byLanguage[language], file)
+		}
+	}
+
+	commands := []*CheckCommand{}
+	for _, language := range []string{"go", "typescript", "python"} {
+		files := byLanguage[language]
+		if len(files) == 0 {
+			continue
+		}
+		quoted := make([]string, len(files))
+		for i, file := range files {
+			quoted[i] = shellQuote(file)
+		}
+		args := strings.Join(quoted, " ")
+
+		var command string
+		switch language {
+		case "go":
+			// gofmt only catches syntax errors, but ships with every Go toolchain.
+			command = fmt.Sprintf("if command -v gopls >/dev/null 2>&1; then gopls check %s; else gofmt -e -l %s >/dev/null; fi", args, args)
+		case "typescript":
+			// tsc ignores tsconfig.json when given files, and files can't be type-checked without it.
+			if fileExists(root, "tsconfig.json") {
+				command = "npx --no-install tsc --noEmit --pretty false -p ."
+			} else {
+				command = "npx --no-install tsc --noEmit --pretty false " + args
+			}
+		case "python":
+			// Keep bytecode out of the worktree.
+			command = "PYTHONPYCACHEPREFIX=/tmp/container-use-pycache python3 -m py_compile " + args
+		}
+		commands = append(commands, &CheckCommand{Language: language, Files: files, Command: command})
+	}
+	return commands
+}
+
+var (
+	goDiagnostic         = regexp.MustCompile(`^(\S+?\.go):(\d+):(\d+)(?:-[\d:]+)?: (.+)$`)
+	typescriptDiagnostic = regexp.MustCompile(`^(.+?)\((\d+),(\d+)\): (error|warning) (TS\d+: .+)$`)
+	pythonLocation       = regexp.MustCompile(`^\s*File "(.+)", line (\d+)`)
+	pythonError          = regexp.MustCompile(`^(\w+(?:Error|Exception|Warning)): (.+)$`)
+)
+
+// ParseCheckOutput extracts diagnostics from the output of gopls check, gofmt -e, tsc and py_compile.
+func ParseCheckOutput(language, output string) []*Diagnostic {
+	diagnostics := []*Diagnostic{}
+	var pending *Diagnostic
+	for line := range strings.SplitSeq(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch language {
+		case "go":
+			if m := goDiagnostic.FindStringSubmatch(line); m != nil {
+				diagnostics = append(diagnostics, newDiagnostic(language, m[1], m[2], m[3], "error", m[4]))
+			}
+		case "typescript":
+			if m := typescriptDiagnostic.FindStringSubmatch(line); m != nil {
+				diagnostics = append(diagnostics, newDiagnostic(language, m[1], m[2], m[3], m[4], m[5]))
+			}
+		case "python":
+			// py_compile reports the location and the error on separate lines.
+			if m := pythonLocation.FindStringSubmatch(line); m != nil {
+				pending = newDiagnostic(language, m[1], m[2], "", "error", "")
+			} else if m := pythonError.FindStringSubmatch(line); m != nil && pending != nil {
+				pending.Message = m[1] + ": " + m[2]
+				diagnostics = append(diagnostics, pending)
+				pending = nil
+			}
+		}
+	}
+	return diagnostics
+}
+
+func newDiagnostic(language, file, line, column, severity, message string) *Diagnostic {
+	diagnostic := &Diagnostic{Language: language, File: filepath.ToSlash(file), Severity: severity, Message: message}
+	diagnostic.Line, _ = strconv.Atoi(line)
+	diagnostic.Column, _ = strconv.Atoi(column)
+	return diagnostic
+}
+
+// checkFiles returns the files to check: the given paths, or the files changed by the environment if there are none.
+// Directories select the changed files they contain.
+func (r *Repository) checkFiles(ctx context.Context, id, root string, paths []string) ([]string, error) {
+	changed, err := r.ChangedFiles(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	files := []string{}
+	add := func(file string) {
+		// Skip deleted files.
+		if !seen[file] && fileExists(root, file) {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	if len(paths) == 0 {
+		for _, file := range changed {
+			add(file)
+		}
+		return files, nil
+	}
+	for _, p := range paths {
+		p = strings.TrimSuffix(path.Clean(filepath.ToSlash(p)), "/")
+		if _, ok := checkLanguages[path.Ext(p)]; ok {
+			add(p)
+			continue
+		}
+		for _, file := range changed {
+			if p == "." || strings.HasPrefix(file, p+"/") {
+				add(file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Check runs fast syntax and type checks on an environment's files, picking the checker from each file's language:
+// gopls check (or gofmt) for Go, tsc --noEmit for TypeScript and py_compile for Python.
+// Without paths, the files changed by the environment are checked.
+func (r *Repository) Check(ctx context.Context, env *environment.Environment, paths []string) (*CheckReport, error) {
+	root, err := r.getWorktree(ctx, env.ID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := r.checkFiles(ctx, env.ID, root, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CheckReport{
+		EnvironmentID: env.ID,
+		Files:         files,
+		Commands:      checkCommands(root, files),
+		Diagnostics:   []*Diagnostic{},
+	}
+	for _, command := range report.Commands {
+		stdout, stderr, exitCode, err := env.RunWithExitCode(ctx, command.Command, "sh", false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s files: %w", command.Language, err)
+		}
+		command.ExitCode = exitCode
+		diagnostics := ParseCheckOutput(command.Language, stdout+"\n"+stderr)
+		if exitCode != 0 && len(diagnostics) == 0 {
+			command.Output = strings.TrimSpace(stdout + "\n" + stderr)
+		}
+		for _, diagnostic := range diagnostics {
+			// gopls reports absolute paths.
+			diagnostic.File = strings.TrimPrefix(diagnostic.File, strings.TrimSuffix(env.State.Config.Workdir, "/")+"/")
+		}
+		report.Diagnostics = append(report.Diagnostics, diagnostics...)
+	}
+	return report, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCheckOutput(t *testing.T) {
+	t.Run("go", func(t *testing.T) {
+		output := "/workdir/main.go:3:2-5: undefined: fmtx\nmain.go:10:1: expected declaration, found '}'\nnot a diagnostic\n"
+		diagnostics := ParseCheckOutput("go", output)
+		require.Len(t, diagnostics, 2)
+		assert.Equal(t, &Diagnostic{Language: "go", File: "/workdir/main.go", Line: 3, Column: 2, Severity: "error", Message: "undefined: fmtx"}, diagnostics[0])
+		assert.Equal(t, "main.go", diagnostics[1].File)
+		assert.Equal(t, 10, diagnostics[1].Line)
+	})
+
+	t.Run("typescript", func(t *testing.T) {
+		output := "src/app.ts(4,7): error TS2322: Type 'string' is not assignable to type 'number'.\n"
+		diagnostics := ParseCheckOutput("typescript", output)
+		require.Len(t, diagnostics, 1)
+		assert.Equal(t, &Diagnostic{Language: "typescript", File: "src/app.ts", Line: 4, Column: 7, Severity: "error", Message: "TS2322: Type 'string' is not assignable to type 'number'."}, diagnostics[0])
+	})
+
+	t.Run("python", func(t *testing.T) {
+		output := "  File \"app/main.py\", line 2\n    x = (\n        ^\nSyntaxError: '(' was never closed\n"
+		diagnostics := ParseCheckOutput("python", output)
+		require.Len(t, diagnostics, 1)
+		assert.Equal(t, &Diagnostic{Language: "python", File: "app/main.py", Line: 2, Severity: "error", Message: "SyntaxError: '(' was never closed"}, diagnostics[0])
+	})
+}
+
+func TestCheckCommands(t *testing.T) {
+	root := t.TempDir()
+	commands := checkCommands(root, []string{"main.go", "README.md", "src/app.ts", "tool's.py"})
+	require.Len(t, commands, 3)
+
+	assert.Equal(t, "go", commands[0].Language)
+	assert.Contains(t, commands[0].Command, "gopls check 'main.go'")
+	assert.Equal(t, "npx --no-install tsc --noEmit --pretty false 'src/app.ts'", commands[1].Command)
+	assert.Contains(t, commands[2].Command, `python3 -m py_compile 'tool'\''s.py'`)
+
+	writeFile(t, root, "tsconfig.json", "{}")
+	commands = checkCommands(root, []string{"src/app.ts"})
+	require.Len(t, commands, 1)
+	assert.Equal(t, "npx --no-install tsc --noEmit --pretty false -p .", commands[0].Command)
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// CheckoutConfig returns the configuration for running the environment checked out at dir
+// outside of container-use's own repositories, e.g. in CI.
+//
+// The environment's state is read from git notes attached to one of revs, when the notes were
+// pushed along with the branch. Otherwise, the configuration committed in the checkout is used.
+// The returned source describes where the configuration came from.
+func CheckoutConfig(ctx context.Context, dir string, revs ...string) (config *environment.EnvironmentConfig, source string, err error) {
+	return CheckoutConfigFrom(ctx, dir, "origin", revs...)
+}
+
+// CheckoutConfigFrom is CheckoutConfig, fetching the environment's state from remote, a remote name
+// or URL such as the metadata repository environments are tracked in, rather than origin.
+func CheckoutConfigFrom(ctx context.Context, dir, remote string, revs ...string) (config *environment.EnvironmentConfig, source string, err error) {
+	ref := "refs/notes/" + gitNotesStateRef
+	if _, err := RunGitCommand(ctx, dir, "fetch", "--quiet", remote, "+"+ref+":"+ref); err != nil {
+		slog.Info("No environment state to fetch", "err", err)
+	}
+
+	for _, rev := range revs {
+		if rev == "" {
+			continue
+		}
+		note, err := RunGitCommand(ctx, dir, "notes", "--ref", gitNotesStateRef, "show", rev)
+		if err != nil {
+			continue
+		}
+		state := &environment.State{}
+		if err := state.Unmarshal([]byte(note)); err != nil {
+			return nil, "", fmt.Errorf("invalid environment state on %s: %w", rev, err)
+		}
+		if state.Config != nil {
+			return state.Config, fmt.Sprintf("environment state on %s", strings.TrimSpace(rev)), nil
+		}
+	}
+
+	config = environment.DefaultConfig()
+	if err := config.Load(dir); err != nil {
+		return nil, "", fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return config, "repository configuration", nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckoutConfig(t *testing.T) {
+	ctx := context.Background()
+	setGitIdentity(t)
+	dir := t.TempDir()
+
+	runGit(t, dir, "init")
+	config := environment.DefaultConfig()
+	config.BaseImage = "golang:1.24"
+	require.NoError(t, config.Save(dir))
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-m", "init")
+
+	loaded, source, err := CheckoutConfig(ctx, dir, "", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "repository configuration", source)
+	assert.Equal(t, "golang:1.24", loaded.BaseImage)
+
+	// State pushed along with the branch takes precedence.
+	state := &environment.State{Config: environment.DefaultConfig()}
+	state.Config.BaseImage = "python:3.12"
+	data, err := state.Marshal()
+	require.NoError(t, err)
+	notePath := dir + "/state.json"
+	require.NoError(t, os.WriteFile(notePath, data, 0644))
+	runGit(t, dir, "notes", "--ref", gitNotesStateRef, "add", "-F", notePath, "HEAD")
+
+	loaded, source, err = CheckoutConfig(ctx, dir, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "environment state on HEAD", source)
+	assert.Equal(t, "python:3.12", loaded.BaseImage)
+}
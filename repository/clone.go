@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+)
+
+type cloneSourceKey struct{}
+
+// cloneSource is the environment a new environment is cloned from.
+type cloneSource struct {
+	id        string
+	container *dagger.Container
+}
+
+func withCloneSource(ctx context.Context, source *cloneSource) context.Context {
+	return context.WithValue(ctx, cloneSourceKey{}, source)
+}
+
+func cloneSourceFromContext(ctx context.Context) *cloneSource {
+	source, _ := ctx.Value(cloneSourceKey{}).(*cloneSource)
+	return source
+}
+
+// Clone creates a new environment from the environment id, to branch an experiment off its current state:
+// from the tip of its branch, with its configuration and its container, so files and packages outside the
+// workdir come along. The new environment gets a generated ID unless requestedID is set, and the title
+// "Clone of <id>: <title>" unless title is set. It depends on the same environments, whose outputs are
+// copied again.
+func (r *Repository) Clone(ctx context.Context, dag *dagger.Client, id, requestedID, title string) (*environment.Environment, error) {
+	source, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		title = fmt.Sprintf("Clone of %s: %s", id, source.State.Title)
+	}
+	if len(labelsFromContext(ctx)) == 0 {
+		ctx = WithLabels(ctx, source.State.Labels)
+	}
+
+	if len(dependenciesFromContext(ctx)) == 0 && len(source.State.Dependencies) > 0 {
+		var deps []*environment.Dependency
+		for _, dep := range source.State.Dependencies {
+			deps = append(deps, &environment.Dependency{Environment: dep.Environment, Path: dep.Path, Target: dep.Target})
+		}
+		ctx = WithDependencies(ctx, deps)
+	}
+
+	ctx = WithConfig(ctx, source.State.Config)
+	ctx = withCloneSource(ctx, &cloneSource{id: id, container: dag.LoadContainerFromID(dagger.ContainerID(source.State.Container))})
+	gitRef := fmt.Sprintf("%s/%s", containerUseRemote, id)
+	return r.CreateWithID(ctx, dag, requestedID, title, fmt.Sprintf("Clone environment %s", id), gitRef)
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+const (
+	defaultCommitMaxFiles = 20
+	maxSubjectLength      = 72
+	maxHookDiffSize       = 256 * 1024
+	commitHookTimeout     = time.Minute
+)
+
+// changedFile is a staged change, as reported by git diff --name-status.
+type changedFile struct {
+	status string
+	path   string
+	// from is the path of a renamed file before the rename.
+	from string
+}
+
+// commitMessage builds the message for the staged changes in the worktree,
+// following the commit message configuration of the source repository.
+func (r *Repository) commitMessage(ctx context.Context, worktreePath, explanation string, commands []string) string {
+	config := environment.DefaultConfig()
+	if r.userRepoPath != "" {
+		if err := config.Load(r.userRepoPath); err != nil {
+			slog.Warn("Failed to load commit message configuration", "err", err)
+		}
+	}
+	msgConfig := config.CommitMessage
+	if msgConfig == nil {
+		msgConfig = &environment.CommitMessageConfig{}
+	}
+
+	if msgConfig.Style == environment.CommitMessageExplanation {
+		return explanation
+	}
+
+	files, err := stagedFiles(ctx, worktreePath)
+	if err != nil {
+		slog.Warn("Failed to list staged files", "err", err)
+		return explanation
+	}
+
+	message := explanation
+	if message == "" {
+		message = commitSubject(files, commands)
+	}
+	if msgConfig.Style != environment.CommitMessageSubject {
+		stat, _ := RunGitCommand(ctx, worktreePath, "diff", "--cached", "--shortstat")
+		message += "\n\n" + commitBody(files, commands, strings.TrimSpace(stat), msgConfig.MaxFiles)
+	}
+
+	if msgConfig.Hook != "" {
+		// The hook runs on the host: it comes from the committed configuration, so the user must trust it.
+		if err := r.requireTrusted(TrustCommitHook, msgConfig.Hook); err != nil {
+			slog.Warn("Skipping commit message hook, using the generated message", "err", err)
+			return strings.TrimSpace(message)
+		}
+		generated, err := runCommitHook(ctx, worktreePath, msgConfig.Hook, explanation, commands, message)
+		if err != nil {
+			slog.Warn("Commit message hook failed, using the generated message", "err", err)
+		} else if generated != "" {
+			return generated
+		}
+	}
+
+	return strings.TrimSpace(message)
+}
+
+func stagedFiles(ctx context.Context, worktreePath string) ([]changedFile, error) {
+	output, err := RunGitCommand(ctx, worktreePath, "diff", "--cached", "--name-status", "--find-renames")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []changedFile
+	for line := range strings.SplitSeq(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		file := changedFile{status: fields[0][:1], path: fields[len(fields)-1]}
+		if file.status == "R" && len(fields) == 3 {
+			file.from = fields[1]
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// commitSubject describes the changes in a single line, e.g. "Update go.mod and go.sum after `go mod tidy`".
+func commitSubject(files []changedFile, commands []string) string {
+	if len(files) == 0 {
+		if len(commands) > 0 {
+			return Ellipsis("Run `"+lastCommand(commands)+"`", maxSubjectLength-1)
+		}
+		return "Update environment"
+	}
+
+	verb := "Update"
+	switch commonStatus(files) {
+	case "A":
+		verb = "Add"
+	case "D":
+		verb = "Delete"
+	case "R":
+		verb = "Rename"
+	}
+
+	var subject string
+	switch {
+	case len(files) == 1 && files[0].from != "":
+		subject = fmt.Sprintf("Rename %s to %s", files[0].from, files[0].path)
+	case len(files) == 1:
+		subject = fmt.Sprintf("%s %s", verb, files[0].path)
+	case len(files) == 2:
+		subject = fmt.Sprintf("%s %s and %s", verb, files[0].path, files[1].path)
+	default:
+		subject = fmt.Sprintf("%s %d files", verb, len(files))
+		if dir := commonDir(files); dir != "" {
+			subject += " in " + dir
+		}
+	}
+	if len(subject) > maxSubjectLength {
+		subject = fmt.Sprintf("%s %d files", verb, len(files))
+	}
+
+	if len(commands) > 0 {
+		withCommand := fmt.Sprintf("%s after `%s`", subject, lastCommand(commands))
+		if len(withCommand) <= maxSubjectLength {
+			return withCommand
+		}
+	}
+	return subject
+}
+
+// commitBody lists the commands run and the files changed.
+func commitBody(files []changedFile, commands []string, stat string, maxFiles int) string {
+	if maxFiles <= 0 {
+		maxFiles = defaultCommitMaxFiles
+	}
+
+	var body strings.Builder
+	for _, command := range commands {
+		fmt.Fprintf(&body, "$ %s\n", command)
+	}
+	if len(commands) > 0 {
+		body.WriteString("\n")
+	}
+	for i, file := range files {
+		if i == maxFiles {
+			fmt.Fprintf(&body, "... and %d more files\n", len(files)-maxFiles)
+			break
+		}
+		if file.from != "" {
+			fmt.Fprintf(&body, "%s %s -> %s\n", file.status, file.from, file.path)
+		} else {
+			fmt.Fprintf(&body, "%s %s\n", file.status, file.path)
+		}
+	}
+	if stat != "" {
+		body.WriteString(stat + "\n")
+	}
+	return strings.TrimSpace(body.String())
+}
+
+// runCommitHook runs the configured hook with the staged diff on stdin and returns its output.
+func runCommitHook(ctx context.Context, worktreePath, hook, explanation string, commands []string, message string) (string, error) {
+	diff, err := RunGitCommand(ctx, worktreePath, "diff", "--cached", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return "", err
+	}
+	if len(diff) > maxHookDiffSize {
+		diff = diff[:maxHookDiffSize]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commitHookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook)
+	cmd.Dir = worktreePath
+	cmd.Stdin = strings.NewReader(diff)
+	cmd.Env = append(os.Environ(),
+		"CONTAINER_USE_EXPLANATION="+explanation,
+		"CONTAINER_USE_COMMANDS="+strings.Join(commands, "\n"),
+		"CONTAINER_USE_MESSAGE="+message,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func commonStatus(files []changedFile) string {
+	status := files[0].status
+	for _, file := range files[1:] {
+		if file.status != status {
+			return ""
+		}
+	}
+	return status
+}
+
+// commonDir returns the deepest directory containing all files, or "" for the repository root.
+func commonDir(files []changedFile) string {
+	dir := path.Dir(files[0].path)
+	for _, file := range files[1:] {
+		for dir != "." && !strings.HasPrefix(file.path, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func lastCommand(commands []string) string {
+	command := commands[len(commands)-1]
+	if first, _, multiline := strings.Cut(command, "\n"); multiline {
+		command = first + " ..."
+	}
+	return command
+}
+
+// Ellipsis shortens s to its first line, then to its first max runes followed by "…" if it's longer.
+// Multi-byte characters are never cut.
+func Ellipsis(s string, max int) string {
+	s, _, _ = strings.Cut(s, "\n")
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max]) + "…"
+	}
+	return s
+}
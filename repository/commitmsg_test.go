@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitSubject(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []changedFile
+		commands []string
+		expected string
+	}{
+		{
+			name:     "single file",
+			files:    []changedFile{{status: "M", path: "main.go"}},
+			expected: "Update main.go",
+		},
+		{
+			name:     "two added files after a command",
+			files:    []changedFile{{status: "A", path: "go.mod"}, {status: "A", path: "go.sum"}},
+			commands: []string{"go mod init example.com/foo", "go mod tidy"},
+			expected: "Add go.mod and go.sum after `go mod tidy`",
+		},
+		{
+			name:     "many files in a directory",
+			files:    []changedFile{{status: "D", path: "pkg/a/x.go"}, {status: "D", path: "pkg/a/y.go"}, {status: "D", path: "pkg/a/z/w.go"}},
+			expected: "Delete 3 files in pkg/a",
+		},
+		{
+			name:     "many files at the root",
+			files:    []changedFile{{status: "M", path: "a.go"}, {status: "A", path: "pkg/b.go"}, {status: "M", path: "c.go"}},
+			expected: "Update 3 files",
+		},
+		{
+			name:     "long command is left out",
+			files:    []changedFile{{status: "M", path: "main.go"}},
+			commands: []string{"go run ./cmd/generate --output internal/generated --package generated --verbose"},
+			expected: "Update main.go",
+		},
+		{
+			name:     "renamed file",
+			files:    []changedFile{{status: "R", path: "scripts/deploy.sh", from: "deploy.sh"}},
+			expected: "Rename deploy.sh to scripts/deploy.sh",
+		},
+		{
+			name:     "renamed files",
+			files:    []changedFile{{status: "R", path: "pkg/b/x.go", from: "pkg/a/x.go"}, {status: "R", path: "pkg/b/y.go", from: "pkg/a/y.go"}, {status: "R", path: "pkg/b/z.go", from: "pkg/a/z.go"}},
+			expected: "Rename 3 files in pkg/b",
+		},
+		{
+			name:     "no files",
+			commands: []string{"make"},
+			expected: "Run `make`",
+		},
+		{
+			name:     "long command with no files is cut between runes",
+			commands: []string{"echo " + strings.Repeat("é", 100)},
+			expected: "Run `echo " + strings.Repeat("é", 61) + "…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, commitSubject(tt.files, tt.commands))
+		})
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	assert.Equal(t, "short", Ellipsis("short", 10))
+	assert.Equal(t, "Ajouter l…", Ellipsis("Ajouter l'écran de connexion", 9))
+	// Multi-byte titles are cut between runes, not inside them.
+	assert.Equal(t, "修复登录…", Ellipsis("修复登录页面", 4))
+	assert.Equal(t, "first line", Ellipsis("first line\nsecond line", 20))
+}
+
+func TestCommitMessage(t *testing.T) {
+	ctx := context.Background()
+	source := t.TempDir()
+	worktree := t.TempDir()
+
+	runGit(t, worktree, "init")
+	writeFile(t, worktree, "main.go", "package main")
+	writeFile(t, worktree, "README.md", "hello")
+	runGit(t, worktree, "add", ".")
+
+	repo := &Repository{userRepoPath: source, basePath: t.TempDir()}
+	commands := []string{"go fmt ./..."}
+
+	t.Run("detailed", func(t *testing.T) {
+		message := repo.commitMessage(ctx, worktree, "", commands)
+		lines := strings.Split(message, "\n")
+		assert.Equal(t, "Add README.md and main.go after `go fmt ./...`", lines[0])
+		assert.Contains(t, message, "$ go fmt ./...")
+		assert.Contains(t, message, "A main.go")
+		assert.Contains(t, message, "2 files changed")
+	})
+
+	t.Run("explanation as subject", func(t *testing.T) {
+		message := repo.commitMessage(ctx, worktree, "Format the code", commands)
+		assert.True(t, strings.HasPrefix(message, "Format the code\n\n$ go fmt ./..."))
+	})
+
+	t.Run("explanation style", func(t *testing.T) {
+		config := environment.DefaultConfig()
+		config.CommitMessage = &environment.CommitMessageConfig{Style: environment.CommitMessageExplanation}
+		require.NoError(t, config.Save(source))
+
+		assert.Equal(t, "Format the code", repo.commitMessage(ctx, worktree, "Format the code", commands))
+	})
+
+	t.Run("hook", func(t *testing.T) {
+		config := environment.DefaultConfig()
+		config.CommitMessage = &environment.CommitMessageConfig{
+			Style: environment.CommitMessageSubject,
+			Hook:  `printf 'Hooked: %s new package(s) after %s' "$(grep -c '^+package')" "$CONTAINER_USE_COMMANDS"`,
+		}
+		require.NoError(t, config.Save(source))
+		assert.Equal(t, "Add README.md and main.go after `go fmt ./...`", repo.commitMessage(ctx, worktree, "", commands),
+			"untrusted hooks don't run")
+
+		require.NoError(t, repo.Trust(TrustCommitHook, config.CommitMessage.Hook))
+		assert.Equal(t, "Hooked: 1 new package(s) after go fmt ./...", repo.commitMessage(ctx, worktree, "", commands))
+
+		config.CommitMessage.Hook = "exit 1"
+		require.NoError(t, config.Save(source))
+		require.NoError(t, repo.Trust(TrustCommitHook, config.CommitMessage.Hook))
+		assert.Equal(t, "Add README.md and main.go after `go fmt ./...`", repo.commitMessage(ctx, worktree, "", commands),
+			"a failing hook falls back to the generated message")
+	})
+}
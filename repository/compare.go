@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// Comparison puts side by side environments addressing the same task, e.g. the attempts of several
+// agents, to pick the best one.
+type Comparison struct {
+	Environments []*EnvironmentExport `json:"environments"`
+	// ConfigDifferences are the settings of the configuration, by their JSON name, that aren't the same in
+	// every environment.
+	ConfigDifferences []string `json:"config_differences"`
+	// SameBase tells whether the changes of the environments are relative to the same commit, so their diff
+	// stats and test results compare.
+	SameBase bool `json:"same_base"`
+}
+
+// Compare summarizes the environments like Export, and tells how their configurations differ.
+func (r *Repository) Compare(ctx context.Context, ids ...string) (*Comparison, error) {
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("at least two environments are needed to compare")
+	}
+	for i, id := range ids {
+		if slices.Contains(ids[:i], id) {
+			return nil, fmt.Errorf("environment %s is given more than once", id)
+		}
+	}
+
+	comparison := &Comparison{SameBase: true}
+	configs := make([]*environment.EnvironmentConfig, 0, len(ids))
+	for _, id := range ids {
+		envInfo, err := r.Info(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		exported := r.ExportEnvironment(ctx, envInfo, true)
+		if first := comparison.Environments; len(first) > 0 && first[0].Base != exported.Base {
+			comparison.SameBase = false
+		}
+		comparison.Environments = append(comparison.Environments, exported)
+		configs = append(configs, envInfo.State.Config)
+	}
+
+	differences, err := configDifferences(configs)
+	if err != nil {
+		return nil, err
+	}
+	comparison.ConfigDifferences = differences
+	return comparison, nil
+}
+
+// configDifferences returns the JSON names of the settings that aren't the same in every configuration,
+// sorted.
+func configDifferences(configs []*environment.EnvironmentConfig) ([]string, error) {
+	settings := make([]map[string]json.RawMessage, 0, len(configs))
+	names := map[string]bool{}
+	for _, config := range configs {
+		setting := map[string]json.RawMessage{}
+		if config != nil {
+			data, err := json.Marshal(config)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &setting); err != nil {
+				return nil, err
+			}
+		}
+		for name := range setting {
+			names[name] = true
+		}
+		settings = append(settings, setting)
+	}
+
+	differences := []string{}
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		for _, setting := range settings[1:] {
+			// Unset settings are omitted, and differ from the set ones.
+			if !bytes.Equal(setting[name], settings[0][name]) {
+				differences = append(differences, name)
+				break
+			}
+		}
+	}
+	return differences, nil
+}
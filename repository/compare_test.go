@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDifferences(t *testing.T) {
+	a := environment.DefaultConfig()
+	b := a.Copy()
+	b.SetupCommands = append(b.SetupCommands, "apt-get install -y golang")
+	b.Features = environment.FeatureConfigs{{Ref: "ghcr.io/devcontainers/features/go:1"}}
+	c := a.Copy()
+
+	differences, err := configDifferences([]*environment.EnvironmentConfig{a, c})
+	require.NoError(t, err)
+	assert.Empty(t, differences)
+
+	differences, err = configDifferences([]*environment.EnvironmentConfig{a, b, c})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"features", "setup_commands"}, differences)
+
+	_, err = (&Repository{}).Compare(context.Background(), "fancy-mallard")
+	assert.ErrorContains(t, err, "at least two environments")
+	_, err = (&Repository{}).Compare(context.Background(), "fancy-mallard", "fancy-mallard")
+	assert.ErrorContains(t, err, "more than once")
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"bufio"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Coverage is the code coverage measured by a test run, in percent.
+type Coverage struct {
+	Total float64 `json:"total"`
+	// Packages is the coverage of each package, when reported (go test -cover).
+	Packages map[string]float64 `json:"packages,omitempty"`
+}
+
+// CoverageDelta compares the coverage of a test run with an earlier run.
+type CoverageDelta struct {
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+	// Dropped lists the packages whose coverage decreased.
+	Dropped []string `json:"dropped,omitempty"`
+}
+
+var (
+	// goPackageCoverage matches the lines of go test -cover, e.g. "ok  example.com/pkg  0.01s  coverage: 78.3% of statements".
+	goPackageCoverage = regexp.MustCompile(`^(?:ok\s+)?(\S+)\s+(?:\S+\s+)?coverage: ([\d.]+)% of statements`)
+	// goTotalCoverage matches the total of go tool cover -func.
+	goTotalCoverage = regexp.MustCompile(`^total:\s+\(statements\)\s+([\d.]+)%`)
+	// pythonTotalCoverage matches the total of coverage.py reports, including pytest --cov.
+	pythonTotalCoverage = regexp.MustCompile(`^TOTAL\s.*\s([\d.]+)%\s*$`)
+	// istanbulTotalCoverage matches the statements coverage of Istanbul text reports (jest --coverage, nyc).
+	istanbulTotalCoverage = regexp.MustCompile(`^All files\s*\|\s*([\d.]+)\s*\|`)
+)
+
+// ParseCoverage extracts the coverage reported by go test -cover, go tool cover -func, coverage.py
+// (pytest --cov) or Istanbul (jest --coverage, nyc) text reports. It returns nil if the output has none.
+// Without a reported total, the total is the average of the packages' coverage.
+func ParseCoverage(output string) *Coverage {
+	packages := map[string]float64{}
+	total := math.NaN()
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var m []string
+		switch {
+		case goTotalCoverage.MatchString(line):
+			m = goTotalCoverage.FindStringSubmatch(line)
+		case pythonTotalCoverage.MatchString(line):
+			m = pythonTotalCoverage.FindStringSubmatch(line)
+		case istanbulTotalCoverage.MatchString(line):
+			m = istanbulTotalCoverage.FindStringSubmatch(line)
+		default:
+			if pm := goPackageCoverage.FindStringSubmatch(line); pm != nil {
+				if percent, err := strconv.ParseFloat(pm[2], 64); err == nil {
+					packages[pm[1]] = percent
+				}
+			}
+			continue
+		}
+		if percent, err := strconv.ParseFloat(m[1], 64); err == nil {
+			total = percent
+		}
+	}
+
+	if math.IsNaN(total) {
+		if len(packages) == 0 {
+			return nil
+		}
+		sum := 0.0
+		for _, percent := range packages {
+			sum += percent
+		}
+		total = roundPercent(sum / float64(len(packages)))
+	}
+	coverage := &Coverage{Total: total}
+	if len(packages) > 0 {
+		coverage.Packages = packages
+	}
+	return coverage
+}
+
+// CompareCoverage returns the change of coverage from previous to current, or nil if either run
+// has no coverage.
+func CompareCoverage(previous, current *Coverage) *CoverageDelta {
+	if previous == nil || current == nil {
+		return nil
+	}
+	delta := &CoverageDelta{
+		Previous: previous.Total,
+		Current:  current.Total,
+		Delta:    roundPercent(current.Total - previous.Total),
+	}
+	for pkg, percent := range current.Packages {
+		if before, ok := previous.Packages[pkg]; ok && roundPercent(percent-before) < 0 {
+			delta.Dropped = append(delta.Dropped, pkg)
+		}
+	}
+	slices.Sort(delta.Dropped)
+	return delta
+}
+
+// roundPercent rounds to the precision coverage tools report, a tenth of a percent.
+func roundPercent(percent float64) float64 {
+	return math.Round(percent*10) / 10
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCoverage(t *testing.T) {
+	t.Run("go test -cover", func(t *testing.T) {
+		output := `=== RUN   TestAdd
+--- PASS: TestAdd (0.00s)
+PASS
+coverage: 80.0% of statements
+ok  	example.com/calc	0.003s	coverage: 80.0% of statements
+ok  	example.com/parse	(cached)	coverage: 65.5% of statements
+	example.com/cmd		coverage: 0.0% of statements
+`
+		assert.Equal(t, &Coverage{
+			Total:    48.5,
+			Packages: map[string]float64{"example.com/calc": 80, "example.com/parse": 65.5, "example.com/cmd": 0},
+		}, ParseCoverage(output))
+	})
+
+	t.Run("go tool cover -func", func(t *testing.T) {
+		output := "example.com/calc/add.go:3:\tAdd\t\t100.0%\ntotal:\t\t\t(statements)\t\t72.4%\n"
+		assert.Equal(t, &Coverage{Total: 72.4}, ParseCoverage(output))
+	})
+
+	t.Run("pytest --cov", func(t *testing.T) {
+		output := `Name          Stmts   Miss  Cover
+---------------------------------
+app/calc.py      20      4    80%
+---------------------------------
+TOTAL            40     10    75%
+`
+		assert.Equal(t, &Coverage{Total: 75}, ParseCoverage(output))
+	})
+
+	t.Run("jest --coverage", func(t *testing.T) {
+		output := `----------|---------|----------|---------|---------|
+File      | % Stmts | % Branch | % Funcs | % Lines |
+----------|---------|----------|---------|---------|
+All files |   91.3  |    75    |   100   |   91.3  |
+`
+		assert.Equal(t, &Coverage{Total: 91.3}, ParseCoverage(output))
+	})
+
+	t.Run("no coverage", func(t *testing.T) {
+		assert.Nil(t, ParseCoverage("--- PASS: TestAdd (0.00s)\nok  \texample.com/calc\t0.003s\n"))
+	})
+}
+
+func TestCompareCoverage(t *testing.T) {
+	base := &Coverage{Total: 80, Packages: map[string]float64{"a": 90, "b": 70, "c": 50}}
+	current := &Coverage{Total: 76.7, Packages: map[string]float64{"a": 90.02, "b": 60, "d": 10}}
+
+	assert.Equal(t, &CoverageDelta{Previous: 80, Current: 76.7, Delta: -3.3, Dropped: []string{"b"}}, CompareCoverage(base, current))
+	assert.Nil(t, CompareCoverage(nil, current))
+
+	run := CompareTestRuns(&TestRun{Coverage: base}, &TestRun{Coverage: current})
+	require.NotNil(t, run.Coverage)
+	assert.Equal(t, -3.3, run.Coverage.Delta)
+
+	coverage := 76.7
+	review := &Review{Environment: &EnvironmentExport{ID: "test-env", Tests: &TestSummary{
+		Coverage:          &coverage,
+		CoverageSinceBase: CompareCoverage(base, current),
+	}}}
+	var out bytes.Buffer
+	require.NoError(t, review.WriteHTML(&out))
+	assert.Contains(t, out.String(), "<tr><th>Coverage</th><td>76.7% (-3.3 since base; dropped in <code>b</code>)</td></tr>")
+}
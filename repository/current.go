@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+// branchEnvironmentConfig is the git config key, under branch.<name>, recording the environment a branch
+// was checked out from.
+const branchEnvironmentConfig = "containerUseEnvironment"
+
+// CurrentEnvironment returns the environment the current branch was checked out from, or "" if it wasn't
+// checked out from an existing environment. Branches checked out by Checkout are recorded in the git
+// config; other branches tracking an environment's branch are recognized too.
+func (r *Repository) CurrentEnvironment(ctx context.Context) (string, error) {
+	branch, err := r.VCS().CurrentBranch(ctx)
+	if err != nil || branch == "" {
+		return "", nil
+	}
+
+	id, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get", "branch."+branch+"."+branchEnvironmentConfig)
+	id = strings.TrimSpace(id)
+	if id == "" {
+		remote, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get", "branch."+branch+".remote")
+		merge, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get", "branch."+branch+".merge")
+		if strings.TrimSpace(remote) != containerUseRemote {
+			return "", nil
+		}
+		id = strings.TrimPrefix(strings.TrimSpace(merge), "refs/heads/")
+	}
+	if id == "" {
+		return "", nil
+	}
+
+	// The environment may have been deleted since.
+	if err := r.exists(ctx, id); err != nil {
+		return "", nil
+	}
+	return id, nil
+}
+
+func (r *Repository) setBranchEnvironment(ctx context.Context, branch, id string) error {
+	_, err := RunGitCommand(ctx, r.userRepoPath, "config", "branch."+branch+"."+branchEnvironmentConfig, id)
+	return err
+}
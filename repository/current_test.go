@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrentEnvironment(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+	seedEnvironment(t, repo, "test-env", "main", nil)
+
+	current, err := repo.CurrentEnvironment(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, current)
+
+	branch, err := repo.Checkout(ctx, "test-env", "review")
+	require.NoError(t, err)
+	assert.Equal(t, "review", branch)
+	current, err = repo.CurrentEnvironment(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "test-env", current)
+
+	// The mapping survives changing the branch's upstream.
+	runGit(t, userRepo, "branch", "--unset-upstream")
+	current, err = repo.CurrentEnvironment(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "test-env", current)
+
+	// Branches tracking an environment's branch are recognized too.
+	runGit(t, userRepo, "checkout", "-b", "tracking", "--track", containerUseRemote+"/test-env")
+	current, err = repo.CurrentEnvironment(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "test-env", current)
+
+	// Deleted environments aren't current anymore.
+	runGit(t, repo.forkRepoPath, "branch", "-D", "test-env")
+	current, err = repo.CurrentEnvironment(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, current)
+}
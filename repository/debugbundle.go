@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+const scrubbedPlaceholder = "REDACTED"
+
+// secretName matches the names of environment variables whose values are secrets.
+var secretName = regexp.MustCompile(`(?i)(secret|token|passw(or)?d|passphrase|api[_-]?key|access[_-]?key|private[_-]?key|credential|auth)`)
+
+// secretPatterns match well-known credentials, replaced with their replacement ($keep is kept).
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), scrubbedPlaceholder},
+	{regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{30,}|github_pat_[A-Za-z0-9_]{30,})\b`), scrubbedPlaceholder},
+	{regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), scrubbedPlaceholder},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`), scrubbedPlaceholder},
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), scrubbedPlaceholder},
+	{regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`), scrubbedPlaceholder},
+	{regexp.MustCompile(`(?i)(?P<keep>\bbearer\s+)[A-Za-z0-9._~+/-]+=*`), "${keep}" + scrubbedPlaceholder},
+	{regexp.MustCompile(`(?P<keep>://[^/\s:@]+:)[^/\s@]+@`), "${keep}" + scrubbedPlaceholder + "@"},
+	{regexp.MustCompile(`(?i)(?P<keep>\b[\w.-]*(secret|token|passw(or)?d|passphrase|api[_-]?key|access[_-]?key)[\w.-]*["']?\s*[=:]\s*["']?)[^\s"',;]+`), "${keep}" + scrubbedPlaceholder},
+}
+
+// DebugBundleOptions configures a debug bundle.
+type DebugBundleOptions struct {
+	// Execs is the number of most recent commits whose command outputs are included.
+	Execs int
+	// MaxBytes caps the size of the bundle's files before compression.
+	MaxBytes int64
+	// Files are added after the environment's files, e.g. host information and the CLI's log.
+	Files []*DebugBundleFile
+}
+
+// DebugBundleFile is a file of a debug bundle.
+type DebugBundleFile struct {
+	Name    string
+	Content []byte
+	// KeepTail keeps the end of the content rather than its start when the size cap truncates it, e.g. for logs.
+	KeepTail bool
+}
+
+// DebugBundleManifest describes the files of a debug bundle, stored in it as manifest.json.
+type DebugBundleManifest struct {
+	Environment string             `json:"environment"`
+	GeneratedAt time.Time          `json:"generated_at"`
+	MaxBytes    int64              `json:"max_bytes"`
+	Files       []*DebugBundleItem `json:"files"`
+	// Errors lists the parts of the bundle that couldn't be collected.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DebugBundleItem is a file of a debug bundle, as listed in its manifest.
+type DebugBundleItem struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	OriginalSize int64  `json:"original_size"`
+	Truncated    bool   `json:"truncated,omitempty"`
+}
+
+// DebugBundle writes a gzipped tar archive describing the environment for bug reports: its state and
+// configuration, event log (setup steps, commands and their durations), and the notes of its last
+// commits with the output of their commands, followed by the files of opts. Secrets are scrubbed from
+// every file, and files are truncated to keep the bundle under opts.MaxBytes. Parts of the environment
+// that can't be collected are listed in the manifest's errors rather than failing the bundle.
+func (r *Repository) DebugBundle(ctx context.Context, id string, w io.Writer, opts DebugBundleOptions) (*DebugBundleManifest, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &DebugBundleManifest{
+		Environment: id,
+		GeneratedAt: time.Now().UTC(),
+		MaxBytes:    opts.MaxBytes,
+		Files:       []*DebugBundleItem{},
+	}
+	fail := func(what string, err error) {
+		manifest.Errors = append(manifest.Errors, fmt.Sprintf("%s: %s", what, err))
+	}
+
+	var files []*DebugBundleFile
+	if state, err := json.MarshalIndent(redactedInfo(envInfo), "", "  "); err == nil {
+		files = append(files, &DebugBundleFile{Name: "state.json", Content: state})
+	} else {
+		fail("state", err)
+	}
+	if history, err := r.debugHistory(ctx, envInfo, opts.Execs); err == nil {
+		files = append(files, &DebugBundleFile{Name: "history.txt", Content: history})
+	} else {
+		fail("history", err)
+	}
+	if events, err := os.ReadFile(r.eventLogPath(id)); err == nil {
+		files = append(files, &DebugBundleFile{Name: "events.ndjson", Content: events, KeepTail: true})
+	} else if !os.IsNotExist(err) {
+		fail("events", err)
+	}
+	files = append(files, opts.Files...)
+
+	secrets := secretValues(envInfo)
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	remaining := opts.MaxBytes
+	for _, file := range files {
+		content := []byte(ScrubSecrets(string(file.Content), secrets...))
+		item := &DebugBundleItem{Name: file.Name, OriginalSize: int64(len(content))}
+		if opts.MaxBytes > 0 && int64(len(content)) > remaining {
+			content = truncateContent(content, max(remaining, 0), file.KeepTail)
+			item.Truncated = true
+		}
+		item.Size = int64(len(content))
+		remaining -= item.Size
+		if err := writeTarFile(tw, file.Name, content, manifest.GeneratedAt); err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, item)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, "manifest.json", data, manifest.GeneratedAt); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: modTime}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// truncateContent keeps size bytes of content, from its end if keepTail is set, cutting at a line.
+func truncateContent(content []byte, size int64, keepTail bool) []byte {
+	if keepTail {
+		content = content[int64(len(content))-size:]
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			content = content[i+1:]
+		}
+		return content
+	}
+	content = content[:size]
+	if i := bytes.LastIndexByte(content, '\n'); i >= 0 {
+		content = content[:i+1]
+	}
+	return content
+}
+
+// redactedInfo returns the environment's information without its container, which isn't useful outside
+// of the engine, and with the values of secret-looking variables redacted.
+func redactedInfo(envInfo *environment.EnvironmentInfo) *environment.EnvironmentInfo {
+	state := *envInfo.State
+	state.Container = ""
+	if state.Config != nil {
+		state.Config = state.Config.Copy()
+		state.Config.Env = slices.Clone(state.Config.Env)
+		for i, variable := range state.Config.Env {
+			if name, _, found := strings.Cut(variable, "="); found && secretName.MatchString(name) {
+				state.Config.Env[i] = name + "=" + scrubbedPlaceholder
+			}
+		}
+	}
+	return &environment.EnvironmentInfo{ID: envInfo.ID, State: &state}
+}
+
+// secretValues returns the values of the environment's secret-looking variables, to scrub them anywhere.
+func secretValues(envInfo *environment.EnvironmentInfo) []string {
+	if envInfo.State.Config == nil {
+		return nil
+	}
+	var values []string
+	for _, variable := range envInfo.State.Config.Env {
+		if name, value, found := strings.Cut(variable, "="); found && secretName.MatchString(name) && len(value) >= 4 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ScrubSecrets replaces well-known credentials (tokens, keys, passwords in URLs and assignments) and the
+// given secret values in content with REDACTED.
+func ScrubSecrets(content string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			content = strings.ReplaceAll(content, secret, scrubbedPlaceholder)
+		}
+	}
+	for _, secret := range secretPatterns {
+		content = secret.pattern.ReplaceAllString(content, secret.replacement)
+	}
+	return content
+}
+
+// debugHistory returns the notes of the environment's last commits, with the output of their commands.
+func (r *Repository) debugHistory(ctx context.Context, envInfo *environment.EnvironmentInfo, commits int) ([]byte, error) {
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"log", "--format=%H%x00%h%x00%cI%x00%s"}
+	if commits > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", commits))
+	}
+	output, err := RunGitCommand(ctx, r.userRepoPath, append(args, revisionRange)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	for line := range strings.SplitSeq(strings.TrimSpace(output), "\n") {
+		parts := strings.SplitN(line, "\x00", 4)
+		if len(parts) < 4 {
+			continue
+		}
+		fmt.Fprintf(&b, "commit %s %s %s\n", parts[1], parts[2], parts[3])
+		if notes, err := RunGitCommand(ctx, r.userRepoPath, "notes", "--ref="+gitNotesLogRef, "show", parts[0]); err == nil {
+			fmt.Fprintf(&b, "%s\n", strings.TrimSpace(notes))
+		}
+		b.WriteString("\n")
+	}
+	return b.Bytes(), nil
+}
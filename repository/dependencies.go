@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+)
+
+type dependenciesKey struct{}
+
+// WithDependencies returns a context creating environments consuming the outputs of other environments,
+// copied into their container at creation.
+func WithDependencies(ctx context.Context, deps []*environment.Dependency) context.Context {
+	return context.WithValue(ctx, dependenciesKey{}, deps)
+}
+
+func dependenciesFromContext(ctx context.Context) []*environment.Dependency {
+	deps, _ := ctx.Value(dependenciesKey{}).([]*environment.Dependency)
+	return deps
+}
+
+// DependencyStatus is a dependency of an environment, and whether its copy is up to date.
+type DependencyStatus struct {
+	*environment.Dependency
+	// Stale is set when the environment producing the output changed since it was copied: its branch moved
+	// for a branch tip, its container changed for a path.
+	Stale bool `json:"stale"`
+	// Error is set when the environment producing the output can't be read, e.g. it was deleted.
+	Error string `json:"error,omitempty"`
+}
+
+// branchTip returns the commit at the tip of an environment's branch.
+func (r *Repository) branchTip(ctx context.Context, id string) (string, error) {
+	out, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", id)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// dependencyOutput returns the current output of a dependency, for an environment hosted by engine.
+func (r *Repository) dependencyOutput(ctx context.Context, dag *dagger.Client, engine string, dep *environment.Dependency) (*environment.DependencyOutput, error) {
+	source, err := r.Info(ctx, dep.Environment)
+	if err != nil {
+		return nil, fmt.Errorf("dependency on %s: %w", dep.Environment, err)
+	}
+	revision, err := r.branchTip(ctx, dep.Environment)
+	if err != nil {
+		return nil, fmt.Errorf("dependency on %s: %w", dep.Environment, err)
+	}
+	output := &environment.DependencyOutput{Dependency: dep, Revision: revision, SourceUpdatedAt: source.State.UpdatedAt}
+
+	if dep.Path == "" {
+		err := r.lockManager.WithRLock(ctx, LockTypeForkRepo, func() error {
+			var err error
+			output.Directory, err = dag.
+				Host().
+				Directory(r.forkRepoPath, dagger.HostDirectoryOpts{NoCache: true}).
+				AsGit().
+				Ref(revision).
+				Tree(dagger.GitRefTreeOpts{DiscardGitDir: true}).
+				Sync(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dependency on %s: failed to load its branch tip: %w", dep.Environment, err)
+		}
+		return output, nil
+	}
+
+	// Containers can't be loaded across engines, unlike the branch tips read from the host.
+	if source.State.Engine != engine {
+		return nil, fmt.Errorf("dependency on %s: it's hosted by another engine, only its branch tip can be copied", dep.Environment)
+	}
+	container := dag.LoadContainerFromID(dagger.ContainerID(source.State.Container))
+	sourcePath := dep.Path
+	if !path.IsAbs(sourcePath) {
+		sourcePath = path.Join(source.State.Config.Workdir, sourcePath)
+	}
+	exists, err := container.Exists(ctx, sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("dependency on %s: failed to check %s: %w", dep.Environment, sourcePath, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("dependency on %s: %s not found in its container", dep.Environment, sourcePath)
+	}
+	isDir, err := container.Exists(ctx, sourcePath, dagger.ContainerExistsOpts{ExpectedType: dagger.ExistsTypeDirectoryType})
+	if err != nil {
+		return nil, fmt.Errorf("dependency on %s: failed to check %s: %w", dep.Environment, sourcePath, err)
+	}
+	if isDir {
+		output.Directory = container.Directory(sourcePath)
+	} else {
+		output.File = container.File(sourcePath)
+	}
+	return output, nil
+}
+
+// RefreshDependencies copies the current outputs of the dependencies of env into its container again: all
+// of them, or those on the environments from only. It returns the dependencies refreshed. Like the file
+// operations of environments, the caller saves the changes with Update.
+func (r *Repository) RefreshDependencies(ctx context.Context, dag *dagger.Client, env *environment.Environment, from []string) ([]*environment.Dependency, error) {
+	for _, id := range from {
+		if !slices.ContainsFunc(env.State.Dependencies, func(dep *environment.Dependency) bool { return dep.Environment == id }) {
+			return nil, fmt.Errorf("environment %s doesn't depend on %s", env.ID, id)
+		}
+	}
+
+	var outputs []*environment.DependencyOutput
+	var refreshed []*environment.Dependency
+	for _, dep := range env.State.Dependencies {
+		if len(from) > 0 && !slices.Contains(from, dep.Environment) {
+			continue
+		}
+		output, err := r.dependencyOutput(ctx, dag, env.State.Engine, dep)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+		refreshed = append(refreshed, dep)
+	}
+
+	if err := env.WireDependencies(ctx, outputs); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// DependencyStatuses returns the dependencies of an environment, telling which ones are stale.
+func (r *Repository) DependencyStatuses(ctx context.Context, id string) ([]*DependencyStatus, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*DependencyStatus{}
+	for _, dep := range envInfo.State.Dependencies {
+		status := &DependencyStatus{Dependency: dep}
+		statuses = append(statuses, status)
+
+		source, err := r.Info(ctx, dep.Environment)
+		if err != nil {
+			status.Error = err.Error()
+			continue
+		}
+		if dep.Path != "" {
+			status.Stale = source.State.UpdatedAt.After(dep.SourceUpdatedAt)
+			continue
+		}
+		revision, err := r.branchTip(ctx, dep.Environment)
+		if err != nil {
+			status.Error = err.Error()
+			continue
+		}
+		status.Stale = revision != dep.Revision
+	}
+	return statuses, nil
+}
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ChangedFile is a file changed by an environment, with the size of its change.
+type ChangedFile struct {
+	Path string `json:"path"`
+	// OldPath is the path of a renamed file before the rename.
+	OldPath string `json:"old_path,omitempty"`
+	// Status is A (added), M (modified), D (deleted), R (renamed) or T (type changed, such as a file replaced
+	// by a symlink), as reported by git.
+	Status string `json:"status"`
+	// Similarity is the percentage of a renamed file that's unchanged.
+	Similarity int `json:"similarity,omitempty"`
+	// Mode is the git mode of the file, unless deleted: 100644, 100755 for executables or 120000 for
+	// symlinks. OldMode is its mode before the change, when it changed.
+	Mode       string `json:"mode,omitempty"`
+	OldMode    string `json:"old_mode,omitempty"`
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+	Binary     bool   `json:"binary,omitempty"`
+}
+
+// DiffChunk is a part of a diff, for clients that can't receive large diffs at once.
+type DiffChunk struct {
+	Diff string `json:"diff"`
+	// Offset is the position of the chunk in the diff, in bytes; NextOffset is the offset of the next
+	// chunk, or 0 if this is the last one.
+	Offset     int `json:"offset"`
+	NextOffset int `json:"next_offset,omitempty"`
+	TotalBytes int `json:"total_bytes"`
+}
+
+// ChangedFileStats returns the files changed by an environment relative to the current branch, with the
+// lines inserted and deleted in each. Renames are detected by similarity, like git does.
+func (r *Repository) ChangedFileStats(ctx context.Context, id string) ([]*ChangedFile, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--find-renames", "--raw", "-z", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+	numstat, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--find-renames", "--numstat", "-z", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+	return parseChangedFiles(raw, numstat), nil
+}
+
+// parseChangedFiles parses the output of git diff --raw -z and git diff --numstat -z.
+func parseChangedFiles(raw, numstat string) []*ChangedFile {
+	const noMode = "000000"
+	files := []*ChangedFile{}
+	byPath := map[string]*ChangedFile{}
+	fields := strings.Split(raw, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		// :<old mode> <new mode> <old blob> <new blob> <status>, then the path, or the old and new paths
+		// of renames.
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 {
+			continue
+		}
+		file := &ChangedFile{Path: fields[i+1], Status: meta[4][:1]}
+		if file.Status == "R" || file.Status == "C" {
+			if i+2 >= len(fields) {
+				break
+			}
+			file.Similarity, _ = strconv.Atoi(meta[4][1:])
+			file.OldPath, file.Path = fields[i+1], fields[i+2]
+			i++
+		}
+		if meta[1] != noMode {
+			file.Mode = meta[1]
+		}
+		if meta[0] != noMode && meta[1] != noMode && meta[0] != meta[1] {
+			file.OldMode = meta[0]
+		}
+		files = append(files, file)
+		byPath[file.Path] = file
+	}
+
+	entries := strings.Split(numstat, "\x00")
+	for i := 0; i < len(entries); i++ {
+		stat := strings.SplitN(entries[i], "\t", 3)
+		if len(stat) < 3 {
+			continue
+		}
+		path := stat[2]
+		if path == "" {
+			// Renames are followed by their old and new paths.
+			if i+2 >= len(entries) {
+				break
+			}
+			path = entries[i+2]
+			i += 2
+		}
+		file := byPath[path]
+		if file == nil {
+			continue
+		}
+		// Binary files are reported as "-".
+		insertions, err := strconv.Atoi(stat[0])
+		if err != nil {
+			file.Binary = true
+			continue
+		}
+		file.Insertions = insertions
+		file.Deletions, _ = strconv.Atoi(stat[1])
+	}
+	return files
+}
+
+// FileVersions are the contents of a file before and after the changes of an environment, e.g. for editors to
+// show them side by side.
+type FileVersions struct {
+	Path string `json:"path"`
+	// BasePath is the path of the file at the environment's base, which differs from Path for renamed files.
+	BasePath string `json:"base_path"`
+	// Base is the content of the file at the environment's base, null if the environment added it.
+	Base *string `json:"base"`
+	// Head is the content of the file in the environment, null if the environment deleted it.
+	Head *string `json:"head"`
+	// Binary files have neither content.
+	Binary bool `json:"binary,omitempty"`
+}
+
+// FileVersions returns the contents of the file at path, relative to the repository root, at the environment's
+// base and in the environment. Renamed files are read from their path before the rename at the base.
+func (r *Repository) FileVersions(ctx context.Context, id, path string) (*FileVersions, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	mergeBase, err := r.mergeBase(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+	versions := &FileVersions{Path: path, BasePath: path}
+	changed, err := r.ChangedFileStats(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range changed {
+		if file.Path == path && file.OldPath != "" {
+			versions.BasePath = file.OldPath
+		}
+	}
+
+	if versions.Base, err = r.readBlob(ctx, mergeBase, versions.BasePath); err != nil {
+		return nil, err
+	}
+	if versions.Head, err = r.readBlob(ctx, containerUseRemote+"/"+id, path); err != nil {
+		return nil, err
+	}
+	for _, content := range []*string{versions.Base, versions.Head} {
+		if content != nil && !utf8.ValidString(*content) {
+			versions.Base, versions.Head, versions.Binary = nil, nil, true
+			break
+		}
+	}
+	if versions.Base == nil && versions.Head == nil && !versions.Binary {
+		return nil, fmt.Errorf("%s doesn't exist in environment %s nor at its base", path, id)
+	}
+	return versions, nil
+}
+
+// readBlob returns the content of the file at path in the revision, or nil if it doesn't have one.
+func (r *Repository) readBlob(ctx context.Context, revision, path string) (*string, error) {
+	entry, err := RunGitCommand(ctx, r.userRepoPath, "ls-tree", "--full-tree", revision, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	// <mode> <type> <object>\t<path>
+	if fields := strings.Fields(entry); len(fields) < 2 || fields[1] != "blob" {
+		return nil, nil
+	}
+	content, err := RunGitCommand(ctx, r.userRepoPath, "cat-file", "blob", revision+":"+path)
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// DiffChunk returns up to maxBytes of the environment's diff relative to the current branch, starting at
+// offset. The diff is limited to paths, if any. Chunks end on a line boundary unless a single line is
+// longer than maxBytes.
+func (r *Repository) DiffChunk(ctx context.Context, id string, paths []string, offset, maxBytes int) (*DiffChunk, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"diff", "--find-renames", revisionRange, "--"}, paths...)
+	diff, err := RunGitCommand(ctx, r.userRepoPath, args...)
+	if err != nil {
+		return nil, err
+	}
+	return chunk(diff, offset, maxBytes), nil
+}
+
+func chunk(diff string, offset, maxBytes int) *DiffChunk {
+	offset = min(max(offset, 0), len(diff))
+	result := &DiffChunk{Offset: offset, TotalBytes: len(diff)}
+	rest := diff[offset:]
+	if maxBytes <= 0 || len(rest) <= maxBytes {
+		result.Diff = rest
+		return result
+	}
+
+	end := maxBytes
+	if i := strings.LastIndexByte(rest[:maxBytes], '\n'); i >= 0 {
+		end = i + 1
+	} else {
+		// Don't split a multi-byte character.
+		for end > 1 && !utf8.RuneStart(rest[end]) {
+			end--
+		}
+	}
+	result.Diff = rest[:end]
+	result.NextOffset = offset + end
+	return result
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChangedFiles(t *testing.T) {
+	blob := strings.Repeat("0", 40)
+	raw := strings.Join([]string{
+		":100644 100644 " + blob + " " + blob + " M", "main.go",
+		":000000 100644 " + blob + " " + blob + " A", "docs/new.md",
+		":100644 000000 " + blob + " " + blob + " D", "old.txt",
+		":000000 100644 " + blob + " " + blob + " A", "logo.png",
+		":100644 100755 " + blob + " " + blob + " R087", "deploy.sh", "scripts/deploy.sh",
+		":100644 120000 " + blob + " " + blob + " T", "config.yaml",
+	}, "\x00") + "\x00"
+	numstat := "3\t1\tmain.go\x0010\t0\tdocs/new.md\x000\t4\told.txt\x00-\t-\tlogo.png\x00" +
+		"2\t1\t\x00deploy.sh\x00scripts/deploy.sh\x001\t5\tconfig.yaml\x00"
+
+	assert.Equal(t, []*ChangedFile{
+		{Path: "main.go", Status: "M", Mode: "100644", Insertions: 3, Deletions: 1},
+		{Path: "docs/new.md", Status: "A", Mode: "100644", Insertions: 10},
+		{Path: "old.txt", Status: "D", Deletions: 4},
+		{Path: "logo.png", Status: "A", Mode: "100644", Binary: true},
+		{Path: "scripts/deploy.sh", OldPath: "deploy.sh", Status: "R", Similarity: 87, Mode: "100755", OldMode: "100644", Insertions: 2, Deletions: 1},
+		{Path: "config.yaml", Status: "T", Mode: "120000", OldMode: "100644", Insertions: 1, Deletions: 5},
+	}, parseChangedFiles(raw, numstat))
+}
+
+func TestChunk(t *testing.T) {
+	diff := "line one\nline two\nline three\n"
+
+	assert.Equal(t, &DiffChunk{Diff: diff, TotalBytes: len(diff)}, chunk(diff, 0, 0))
+	assert.Equal(t, &DiffChunk{Diff: diff, TotalBytes: len(diff)}, chunk(diff, 0, 100))
+
+	// Chunks end on a line boundary.
+	first := chunk(diff, 0, 12)
+	assert.Equal(t, &DiffChunk{Diff: "line one\n", NextOffset: 9, TotalBytes: len(diff)}, first)
+	second := chunk(diff, first.NextOffset, 12)
+	assert.Equal(t, &DiffChunk{Diff: "line two\n", Offset: 9, NextOffset: 18, TotalBytes: len(diff)}, second)
+	third := chunk(diff, second.NextOffset, 12)
+	assert.Equal(t, &DiffChunk{Diff: "line three\n", Offset: 18, TotalBytes: len(diff)}, third)
+	assert.Equal(t, diff, first.Diff+second.Diff+third.Diff)
+
+	// Lines longer than a chunk are split, but not in the middle of a character.
+	long := strings.Repeat("é", 10)
+	split := chunk(long, 0, 5)
+	assert.Equal(t, "éé", split.Diff)
+	assert.Equal(t, 4, split.NextOffset)
+
+	assert.Equal(t, &DiffChunk{Offset: len(diff), TotalBytes: len(diff)}, chunk(diff, 1000, 12))
+}
+
+func TestFileVersions(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+	writeFile(t, userRepo, "old.go", "package main\n\nfunc main() {}\n")
+	runGit(t, userRepo, "add", ".")
+	runGit(t, userRepo, "commit", "-m", "Add old.go")
+
+	runGit(t, userRepo, "checkout", "-b", "work")
+	writeFile(t, userRepo, "README.md", "hello\nworld\n")
+	writeFile(t, userRepo, "main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, userRepo, "logo.png", "\x89PNG\r\n\x1a\n\xff\xfe")
+	runGit(t, userRepo, "rm", "-q", "old.go")
+	runGit(t, userRepo, "add", ".")
+	runGit(t, userRepo, "commit", "-m", "Rename old.go")
+	runGit(t, userRepo, "checkout", "main")
+	seedEnvironment(t, repo, "test-env", "work", &environment.State{Title: "Rename old.go", Config: environment.DefaultConfig()})
+
+	versions, err := repo.FileVersions(ctx, "test-env", "README.md")
+	require.NoError(t, err)
+	require.NotNil(t, versions.Base)
+	require.NotNil(t, versions.Head)
+	assert.Equal(t, "hello\n", *versions.Base)
+	assert.Equal(t, "hello\nworld\n", *versions.Head)
+
+	versions, err = repo.FileVersions(ctx, "test-env", "main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "old.go", versions.BasePath, "renamed files are read from their old path at the base")
+	require.NotNil(t, versions.Base)
+	assert.Equal(t, "package main\n\nfunc main() {}\n", *versions.Base)
+
+	versions, err = repo.FileVersions(ctx, "test-env", "logo.png")
+	require.NoError(t, err)
+	assert.True(t, versions.Binary)
+	assert.Nil(t, versions.Head)
+
+	_, err = repo.FileVersions(ctx, "test-env", "missing.txt")
+	assert.ErrorContains(t, err, "doesn't exist")
+}
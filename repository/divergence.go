@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Divergence describes how a ref differs from the user's HEAD, such as the ref an environment is created from.
+type Divergence struct {
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+	// Branch is the user's current branch the ref is compared with, empty when HEAD is detached.
+	Branch string `json:"branch"`
+	// Ahead counts the commits of the ref not in HEAD, and Behind those of HEAD not in the ref.
+	Ahead  int `json:"ahead"`
+	Behind int `json:"behind"`
+	// LastCommit is the commit the ref points to.
+	LastCommit struct {
+		Subject string    `json:"subject"`
+		Author  string    `json:"author"`
+		Time    time.Time `json:"time"`
+	} `json:"last_commit"`
+}
+
+// Stale reports whether HEAD has commits the ref doesn't.
+func (d *Divergence) Stale() bool {
+	return d.Behind > 0
+}
+
+// Divergence compares ref with the user's HEAD.
+func (r *Repository) Divergence(ctx context.Context, ref string) (*Divergence, error) {
+	commit, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("unknown ref %s: %w", ref, err)
+	}
+	divergence := &Divergence{Ref: ref, Commit: strings.TrimSpace(commit)}
+	divergence.Branch, _ = r.VCS().CurrentBranch(ctx)
+
+	counts, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--left-right", "--count", divergence.Commit+"...HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if fields := strings.Fields(counts); len(fields) == 2 {
+		divergence.Ahead, _ = strconv.Atoi(fields[0])
+		divergence.Behind, _ = strconv.Atoi(fields[1])
+	}
+
+	last, err := RunGitCommand(ctx, r.userRepoPath, "log", "-1", "--format=%ct%x00%an%x00%s", divergence.Commit)
+	if err != nil {
+		return nil, err
+	}
+	if fields := strings.SplitN(strings.TrimSpace(last), "\x00", 3); len(fields) == 3 {
+		timestamp, _ := strconv.ParseInt(fields[0], 10, 64)
+		divergence.LastCommit.Time = time.Unix(timestamp, 0).UTC()
+		divergence.LastCommit.Author = fields[1]
+		divergence.LastCommit.Subject = fields[2]
+	}
+	return divergence, nil
+}
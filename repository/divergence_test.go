@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDivergence(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	dir := repo.userRepoPath
+	runGit(t, dir, "branch", "release")
+	runGit(t, dir, "checkout", "release")
+	writeFile(t, dir, "fix.txt", "fix")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-m", "Fix the release")
+	release := runGit(t, dir, "rev-parse", "HEAD")
+	runGit(t, dir, "checkout", "main")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		writeFile(t, dir, name, name)
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-m", "Add "+name)
+	}
+
+	divergence, err := repo.Divergence(ctx, "release")
+	require.NoError(t, err)
+	assert.Equal(t, "release", divergence.Ref)
+	assert.Equal(t, release, divergence.Commit)
+	assert.Equal(t, "main", divergence.Branch)
+	assert.Equal(t, 1, divergence.Ahead)
+	assert.Equal(t, 2, divergence.Behind)
+	assert.True(t, divergence.Stale())
+	assert.Equal(t, "Fix the release", divergence.LastCommit.Subject)
+	assert.Equal(t, "Test", divergence.LastCommit.Author)
+	assert.False(t, divergence.LastCommit.Time.IsZero())
+
+	divergence, err = repo.Divergence(ctx, "main")
+	require.NoError(t, err)
+	assert.Zero(t, divergence.Ahead)
+	assert.False(t, divergence.Stale())
+
+	_, err = repo.Divergence(ctx, "missing")
+	assert.ErrorContains(t, err, "unknown ref missing")
+}
@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/mitchellh/go-homedir"
+)
+
+// enginesFile lists the engines of the pool, in the data directory: they're shared by the repositories.
+const enginesFile = "engines.json"
+
+// engineProbeTimeout bounds how long scheduling waits for an engine to report its load.
+const engineProbeTimeout = 30 * time.Second
+
+// Engine is a Dagger engine environments can be scheduled on, e.g. a build server shared by a team.
+type Engine struct {
+	Name string `json:"name"`
+	// Host is the runner host of the engine, e.g. tcp://build-server:8080 or docker-container://dagger-engine.
+	Host string `json:"host"`
+}
+
+// EngineLoad is the load of an engine when scheduling an environment.
+type EngineLoad struct {
+	Engine *Engine `json:"engine"`
+	// Load is the load average of the engine's host over the last minute, per CPU.
+	Load float64 `json:"load"`
+	// Environments is the number of environments of the repository hosted on the engine.
+	Environments int    `json:"environments"`
+	Error        string `json:"error,omitempty"`
+}
+
+type engineKey struct{}
+
+// WithEngine returns a context recording, in the state of the environments created with it, that they're
+// hosted on the named engine of the pool.
+func WithEngine(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, engineKey{}, name)
+}
+
+func engineFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(engineKey{}).(string)
+	return name
+}
+
+// LoadEngines returns the engines of the pool configured in the data directory at basePath.
+func LoadEngines(basePath string) ([]*Engine, error) {
+	path, err := homedir.Expand(filepath.Join(basePath, enginesFile))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Engines []*Engine `json:"engines"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return config.Engines, nil
+}
+
+// SaveEngines saves the engines of the pool in the data directory at basePath.
+func SaveEngines(basePath string, engines []*Engine) error {
+	path, err := homedir.Expand(filepath.Join(basePath, enginesFile))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(map[string]any{"engines": engines}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// EnginePool connects to the engines environments are hosted on, keeping a client per engine. The default
+// engine, named "", is the one Dagger provisions locally. Without configured engines, every environment is
+// hosted on it.
+type EnginePool struct {
+	Engines []*Engine
+	connect func(ctx context.Context, host string) (*dagger.Client, error)
+
+	mu      sync.Mutex
+	clients map[string]*engineClient
+}
+
+// engineClient is the connection to an engine, established once.
+type engineClient struct {
+	once sync.Once
+	dag  *dagger.Client
+	err  error
+}
+
+// NewEnginePool returns a pool of engines, connected to with connect, given the engine's host ("" for the
+// default engine).
+func NewEnginePool(engines []*Engine, connect func(ctx context.Context, host string) (*dagger.Client, error)) *EnginePool {
+	return &EnginePool{Engines: engines, connect: connect, clients: map[string]*engineClient{}}
+}
+
+// Engine returns the engine of the pool with the given name, or nil.
+func (p *EnginePool) Engine(name string) *Engine {
+	for _, engine := range p.Engines {
+		if engine.Name == name {
+			return engine
+		}
+	}
+	return nil
+}
+
+// Client returns a client of the named engine, connecting to it the first time.
+func (p *EnginePool) Client(ctx context.Context, name string) (*dagger.Client, error) {
+	host := ""
+	if name != "" {
+		engine := p.Engine(name)
+		if engine == nil {
+			return nil, fmt.Errorf("engine %q isn't configured", name)
+		}
+		host = engine.Host
+	}
+
+	p.mu.Lock()
+	client, ok := p.clients[name]
+	if !ok {
+		client = &engineClient{}
+		p.clients[name] = client
+	}
+	p.mu.Unlock()
+
+	// Engines are connected to concurrently, and the client outlives the caller's context.
+	client.once.Do(func() { client.dag, client.err = p.connect(context.WithoutCancel(ctx), host) })
+	if client.err != nil {
+		// The next call tries again.
+		p.mu.Lock()
+		if p.clients[name] == client {
+			delete(p.clients, name)
+		}
+		p.mu.Unlock()
+		return nil, client.err
+	}
+	return client.dag, nil
+}
+
+// EngineFor returns the engine of the pool hosting an environment, or nil for the default engine.
+// Environments hosted on an engine that was removed from the pool since move to the default engine: their
+// containers are rebuilt there from their state, which doesn't depend on the engine.
+func (p *EnginePool) EngineFor(ctx context.Context, r *Repository, envID string) *Engine {
+	info, err := r.Info(ctx, envID)
+	if err != nil || info.State.Engine == "" {
+		// Commands report missing environments themselves.
+		return nil
+	}
+	engine := p.Engine(info.State.Engine)
+	if engine == nil {
+		slog.Warn("the engine hosting the environment isn't configured anymore, using the default engine", "env_id", envID, "engine", info.State.Engine)
+	}
+	return engine
+}
+
+// ClientFor returns a client of the engine hosting an environment.
+func (p *EnginePool) ClientFor(ctx context.Context, r *Repository, envID string) (*dagger.Client, error) {
+	if engine := p.EngineFor(ctx, r, envID); engine != nil {
+		return p.Client(ctx, engine.Name)
+	}
+	return p.Client(ctx, "")
+}
+
+// Schedule picks the engine to host a new environment of the repository: the least loaded of the pool, or the
+// default engine if the pool is empty. Engines that can't be reached are skipped. It returns a context
+// recording the engine in the state of the environments created with it, and a client of the engine.
+func (p *EnginePool) Schedule(ctx context.Context, r *Repository) (context.Context, *dagger.Client, error) {
+	if len(p.Engines) == 0 {
+		dag, err := p.Client(ctx, "")
+		return ctx, dag, err
+	}
+
+	engine, err := leastLoadedEngine(p.Loads(ctx, r))
+	if err != nil {
+		return ctx, nil, err
+	}
+	slog.Info("scheduled environment", "engine", engine.Name, "host", engine.Host)
+	dag, err := p.Client(ctx, engine.Name)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return WithEngine(ctx, engine.Name), dag, nil
+}
+
+// ScheduleWith is Schedule for a new environment loading the containers of other environments, such as
+// the outputs of its dependencies: containers can't be loaded across engines, so it's hosted by the engine of
+// the first of envIDs that exists.
+func (p *EnginePool) ScheduleWith(ctx context.Context, r *Repository, envIDs []string) (context.Context, *dagger.Client, error) {
+	for _, id := range envIDs {
+		if _, err := r.Info(ctx, id); err != nil {
+			continue
+		}
+		if engine := p.EngineFor(ctx, r, id); engine != nil {
+			dag, err := p.Client(ctx, engine.Name)
+			return WithEngine(ctx, engine.Name), dag, err
+		}
+		dag, err := p.Client(ctx, "")
+		return ctx, dag, err
+	}
+	return p.Schedule(ctx, r)
+}
+
+// Loads probes the load of the engines of the pool concurrently, with the number of environments of the
+// repository each one hosts, if r is set.
+func (p *EnginePool) Loads(ctx context.Context, r *Repository) []*EngineLoad {
+	hosted := map[string]int{}
+	if r != nil {
+		if envs, err := r.List(ctx); err == nil {
+			for _, env := range envs {
+				hosted[env.State.Engine]++
+			}
+		}
+	}
+
+	loads := make([]*EngineLoad, len(p.Engines))
+	var wg sync.WaitGroup
+	for i, engine := range p.Engines {
+		loads[i] = &EngineLoad{Engine: engine, Environments: hosted[engine.Name]}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, engineProbeTimeout)
+			defer cancel()
+
+			type probe struct {
+				load float64
+				err  error
+			}
+			probed := make(chan probe, 1)
+			go func() {
+				dag, err := p.Client(ctx, engine.Name)
+				if err != nil {
+					probed <- probe{err: err}
+					return
+				}
+				load, err := probeEngineLoad(ctx, dag)
+				probed <- probe{load, err}
+			}()
+			select {
+			case result := <-probed:
+				loads[i].Load = result.load
+				if result.err != nil {
+					loads[i].Error = result.err.Error()
+				}
+			case <-ctx.Done():
+				loads[i].Error = "timed out"
+			}
+		}()
+	}
+	wg.Wait()
+	return loads
+}
+
+// Close closes the clients of the engines.
+func (p *EnginePool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, client := range p.clients {
+		if client.dag != nil {
+			client.dag.Close()
+		}
+		delete(p.clients, name)
+	}
+}
+
+// leastLoadedEngine returns the reachable engine with the lowest load per CPU, then with the fewest
+// environments.
+func leastLoadedEngine(loads []*EngineLoad) (*Engine, error) {
+	var best *EngineLoad
+	var errs []error
+	for _, load := range loads {
+		if load.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", load.Engine.Name, load.Error))
+			continue
+		}
+		if best == nil || load.Load < best.Load || (load.Load == best.Load && load.Environments < best.Environments) {
+			best = load
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no engine of the pool is reachable: %w", errors.Join(errs...))
+	}
+	return best.Engine, nil
+}
+
+// probeEngineLoad returns the load average of the engine's host per CPU. Containers share the kernel of the
+// engine's host, so they see its load.
+func probeEngineLoad(ctx context.Context, dag *dagger.Client) (float64, error) {
+	output, err := dag.Container().
+		From(environment.DefaultConfig().BaseImage).
+		// The load must be read every time, not cached.
+		WithEnvVariable("CONTAINER_USE_PROBE", strconv.FormatInt(time.Now().UnixNano(), 10)).
+		WithExec([]string{"sh", "-c", "cut -d ' ' -f 1 /proc/loadavg; nproc"}).
+		Stdout(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return parseEngineLoad(output)
+}
+
+// parseEngineLoad parses the load average and the number of CPUs printed by the probe.
+func parseEngineLoad(output string) (float64, error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("unexpected load %q", output)
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected load %q", output)
+	}
+	cpus, err := strconv.Atoi(fields[1])
+	if err != nil || cpus < 1 {
+		return 0, fmt.Errorf("unexpected number of CPUs %q", output)
+	}
+	return load / float64(cpus), nil
+}
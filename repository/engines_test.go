@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSaveEngines(t *testing.T) {
+	basePath := t.TempDir()
+
+	engines, err := LoadEngines(basePath)
+	require.NoError(t, err)
+	assert.Empty(t, engines)
+
+	saved := []*Engine{{Name: "build-server", Host: "tcp://build-server:8080"}}
+	require.NoError(t, SaveEngines(basePath, saved))
+	engines, err = LoadEngines(basePath)
+	require.NoError(t, err)
+	assert.Equal(t, saved, engines)
+}
+
+func TestLeastLoadedEngine(t *testing.T) {
+	small := &Engine{Name: "small"}
+	big := &Engine{Name: "big"}
+	tests := []struct {
+		name     string
+		loads    []*EngineLoad
+		expected *Engine
+	}{
+		{
+			name:     "lowest load per CPU",
+			loads:    []*EngineLoad{{Engine: small, Load: 0.8}, {Engine: big, Load: 0.2, Environments: 10}},
+			expected: big,
+		},
+		{
+			name:     "fewest environments on equal loads",
+			loads:    []*EngineLoad{{Engine: small, Load: 0.5, Environments: 3}, {Engine: big, Load: 0.5, Environments: 1}},
+			expected: big,
+		},
+		{
+			name:     "unreachable engines are skipped",
+			loads:    []*EngineLoad{{Engine: small, Load: 0.9}, {Engine: big, Error: "connection refused"}},
+			expected: small,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := leastLoadedEngine(tt.loads)
+			require.NoError(t, err)
+			assert.Same(t, tt.expected, engine)
+		})
+	}
+
+	_, err := leastLoadedEngine([]*EngineLoad{{Engine: small, Error: "connection refused"}})
+	assert.ErrorContains(t, err, "small: connection refused")
+}
+
+func TestParseEngineLoad(t *testing.T) {
+	load, err := parseEngineLoad("3.00\n4\n")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.75, load, 0.001)
+
+	_, err = parseEngineLoad("3.00\n")
+	assert.Error(t, err)
+	_, err = parseEngineLoad("3.00\n0\n")
+	assert.Error(t, err)
+}
+
+func TestEnginePoolClient(t *testing.T) {
+	ctx := context.Background()
+	var connected []string
+	fail := true
+	pool := NewEnginePool([]*Engine{{Name: "build-server", Host: "tcp://build-server:8080"}}, func(_ context.Context, host string) (*dagger.Client, error) {
+		connected = append(connected, host)
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return &dagger.Client{}, nil
+	})
+
+	_, err := pool.Client(ctx, "build-server")
+	require.Error(t, err)
+	fail = false
+	dag, err := pool.Client(ctx, "build-server")
+	require.NoError(t, err, "failed connections are tried again")
+	again, err := pool.Client(ctx, "build-server")
+	require.NoError(t, err)
+	assert.Same(t, dag, again, "the client is kept")
+	_, err = pool.Client(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tcp://build-server:8080", "tcp://build-server:8080", ""}, connected)
+
+	_, err = pool.Client(ctx, "laptop")
+	assert.ErrorContains(t, err, `engine "laptop" isn't configured`)
+}
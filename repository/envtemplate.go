@@ -0,0 +1,16 @@
+package repository
+
+import "context"
+
+type templateKey struct{}
+
+// WithTemplate returns a context creating environments from the named environment template of the
+// repository, layered on its configuration.
+func WithTemplate(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, templateKey{}, name)
+}
+
+func templateFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(templateKey{}).(string)
+	return name
+}
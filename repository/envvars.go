@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dagger/container-use/environment"
+)
+
+type envVariablesKey struct{}
+
+// WithEnvVariables returns a context creating environments with these variables in addition to the
+// configured ones, overriding them. The variables are kept in the configuration of the environments
+// created, not in the repository's.
+func WithEnvVariables(ctx context.Context, vars environment.KVList) context.Context {
+	return context.WithValue(ctx, envVariablesKey{}, vars)
+}
+
+func envVariablesFromContext(ctx context.Context) environment.KVList {
+	vars, _ := ctx.Value(envVariablesKey{}).(environment.KVList)
+	return vars
+}
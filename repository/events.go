@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// Repository-level lifecycle events. Environments emit the exec and checkpoint events.
+const (
+	EventCreated = "created"
+	EventCommit  = "commit"
+	EventMerged  = "merged"
+	EventApplied = "applied"
+	EventDeleted = "deleted"
+)
+
+const eventPollInterval = 500 * time.Millisecond
+
+// Event is a single entry in an environment's event log.
+type Event struct {
+	Time        time.Time      `json:"time"`
+	Environment string         `json:"environment"`
+	Type        string         `json:"type"`
+	Data        map[string]any `json:"data,omitempty"`
+}
+
+// getEventsPath returns the path for storing environment event logs
+func (r *Repository) getEventsPath() string {
+	return filepath.Join(r.basePath, "events")
+}
+
+func (r *Repository) eventLogPath(id string) string {
+	return filepath.Join(r.getEventsPath(), id+".ndjson")
+}
+
+// recordEvent appends an event to the environment's NDJSON event log.
+// Failures are logged rather than returned: the event log must never break the operation it describes.
+func (r *Repository) recordEvent(id, eventType string, data map[string]any) {
+	line, err := json.Marshal(Event{
+		Time:        time.Now().UTC(),
+		Environment: id,
+		Type:        eventType,
+		Data:        data,
+	})
+	if err != nil {
+		slog.Error("Failed to encode event", "environment-id", id, "type", eventType, "err", err)
+		return
+	}
+
+	if err := os.MkdirAll(r.getEventsPath(), 0755); err != nil {
+		slog.Error("Failed to create events directory", "err", err)
+		return
+	}
+
+	// O_APPEND writes of a single line are atomic enough for concurrent writers on the same host.
+	f, err := os.OpenFile(r.eventLogPath(id), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("Failed to open event log", "environment-id", id, "err", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Error("Failed to write event", "environment-id", id, "type", eventType, "err", err)
+	}
+}
+
+// events returns the events of the environment's event log, oldest first.
+func (r *Repository) events(id string) ([]Event, error) {
+	f, err := os.Open(r.eventLogPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			slog.Warn("Skipping invalid event", "environment-id", id, "err", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// trackEvents forwards the environment's own lifecycle events to its event log,
+// and to the progress listener of the context if any, remembering base image pulls.
+// The environment's commands ask the input prompt of the context, if any, to answer
+// their prompts.
+func (r *Repository) trackEvents(ctx context.Context, env *environment.Environment) {
+	env.OnInputPrompt = r.inputPrompt(ctx, env.ID)
+	progress := progressFromContext(ctx)
+	env.OnEvent = r.observePulls(func(eventType string, data map[string]any) {
+		// Pull progress is only worth showing live.
+		if eventType != environment.EventImagePullProgress {
+			r.recordEvent(env.ID, eventType, data)
+		}
+		if progress != nil {
+			progress(eventType, data)
+		}
+	})
+}
+
+// Events writes the environment's event log to w as NDJSON.
+// If follow is true, it keeps streaming new events until the context is cancelled.
+func (r *Repository) Events(ctx context.Context, id string, follow bool, w io.Writer) error {
+	return r.streamEvents(ctx, id, follow, w, nil)
+}
+
+// streamEvents is Events, only writing the events of the given types if any.
+func (r *Repository) streamEvents(ctx context.Context, id string, follow bool, w io.Writer, types []string) error {
+	f, err := os.Open(r.eventLogPath(id))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err := r.exists(ctx, id); err != nil {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+		// The environment exists but has no events yet: wait for the first one.
+		if f, err = r.waitForEventLog(ctx, id); err != nil || f == nil {
+			return err
+		}
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var partial []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			if hasEventType(partial, types) {
+				if _, err := w.Write(partial); err != nil {
+					return err
+				}
+			}
+			partial = partial[:0]
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(eventPollInterval):
+		}
+	}
+}
+
+// hasEventType reports whether the event line is of one of types, or types is empty.
+func hasEventType(line []byte, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	var event Event
+	if err := json.Unmarshal(line, &event); err != nil {
+		return false
+	}
+	return slices.Contains(types, event.Type)
+}
+
+func (r *Repository) waitForEventLog(ctx context.Context, id string) (*os.File, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-time.After(eventPollInterval):
+		}
+
+		f, err := os.Open(r.eventLogPath(id))
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to open event log: %w", err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := &Repository{basePath: t.TempDir()}
+
+	repo.recordEvent("test-env", EventCreated, map[string]any{"title": "Test"})
+	repo.recordEvent("test-env", EventCommit, map[string]any{"commit": "abc123"})
+	repo.recordEvent("other-env", EventCreated, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, repo.Events(ctx, "test-env", false, &buf))
+
+	var events []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 2)
+	assert.Equal(t, EventCreated, events[0].Type)
+	assert.Equal(t, "Test", events[0].Data["title"])
+	assert.Equal(t, EventCommit, events[1].Type)
+	assert.Equal(t, "test-env", events[1].Environment)
+	assert.WithinDuration(t, time.Now(), events[1].Time, time.Minute)
+}
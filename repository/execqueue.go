@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+const (
+	execQueuePollInterval = 100 * time.Millisecond
+	ticketSuffix          = ".ticket"
+)
+
+// ErrEnvironmentBusy is returned by AcquireExec when the environment is busy and waiting was not requested.
+var ErrEnvironmentBusy = errors.New("environment is busy")
+
+var ticketCounter atomic.Uint64
+
+// ExecSlot is a held turn in an environment's exec queue.
+type ExecSlot struct {
+	// Waited is how long the caller queued before getting the slot.
+	Waited time.Duration
+
+	path  string
+	flock *flock.Flock
+}
+
+// Release gives the environment to the next caller in the queue.
+func (s *ExecSlot) Release() {
+	os.Remove(s.path)
+	s.flock.Unlock()
+}
+
+func (r *Repository) execQueuePath(id string) string {
+	return filepath.Join(r.basePath, "queue", fmt.Sprintf("%x", hashString(r.forkRepoPath)), id)
+}
+
+// AcquireExec waits for the caller's turn to execute in the environment.
+//
+// Callers across processes are served in arrival order: each caller holds a lock on its own
+// ticket file in the environment's queue directory, and only the oldest live ticket may proceed.
+// Tickets whose lock can be taken belong to exited processes and are discarded.
+// onWait, if not nil, is called with the caller's queue position whenever it changes while waiting.
+// If noWait is true, ErrEnvironmentBusy is returned instead of waiting.
+func (r *Repository) AcquireExec(ctx context.Context, id string, noWait bool, onWait func(position int)) (*ExecSlot, error) {
+	dir := r.execQueuePath(id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create exec queue: %w", err)
+	}
+
+	startedAt := time.Now()
+	name := fmt.Sprintf("%020d-%d-%d", startedAt.UnixNano(), os.Getpid(), ticketCounter.Add(1))
+
+	// Lock the ticket before it becomes visible, so it's never mistaken for a stale one.
+	pending := filepath.Join(dir, name+".pending")
+	lock := flock.New(pending)
+	if locked, err := lock.TryLock(); err != nil {
+		return nil, fmt.Errorf("failed to lock exec ticket: %w", err)
+	} else if !locked {
+		return nil, fmt.Errorf("failed to lock exec ticket %s", pending)
+	}
+	slot := &ExecSlot{path: filepath.Join(dir, name+ticketSuffix), flock: lock}
+	if err := os.Rename(pending, slot.path); err != nil {
+		os.Remove(pending)
+		lock.Unlock()
+		return nil, fmt.Errorf("failed to enqueue exec ticket: %w", err)
+	}
+
+	lastPosition := -1
+	for {
+		position, err := queuePosition(dir, name+ticketSuffix)
+		if err != nil {
+			slot.Release()
+			return nil, err
+		}
+		if position == 0 {
+			slot.Waited = time.Since(startedAt)
+			return slot, nil
+		}
+		if noWait {
+			slot.Release()
+			return nil, fmt.Errorf("%w: %d exec(s) ahead in the queue for %s", ErrEnvironmentBusy, position, id)
+		}
+		if position != lastPosition && onWait != nil {
+			onWait(position)
+		}
+		lastPosition = position
+
+		select {
+		case <-ctx.Done():
+			slot.Release()
+			return nil, ctx.Err()
+		case <-time.After(execQueuePollInterval):
+		}
+	}
+}
+
+// queuePosition returns the number of live tickets ahead of ticket, removing stale ones.
+func queuePosition(dir, ticket string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read exec queue: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ticketSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	position := 0
+	for _, name := range names {
+		if name >= ticket {
+			break
+		}
+		path := filepath.Join(dir, name)
+		other := flock.New(path)
+		locked, err := other.TryLock()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, fmt.Errorf("failed to check exec ticket: %w", err)
+		}
+		if locked {
+			// Nobody holds this ticket anymore: its owner exited without releasing it.
+			os.Remove(path)
+			other.Unlock()
+			continue
+		}
+		position++
+	}
+	return position, nil
+}
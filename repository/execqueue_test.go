@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireExec(t *testing.T) {
+	ctx := context.Background()
+	repo := &Repository{basePath: t.TempDir(), forkRepoPath: "/fork"}
+
+	first, err := repo.AcquireExec(ctx, "test-env", false, nil)
+	require.NoError(t, err)
+
+	t.Run("no wait fails fast when busy", func(t *testing.T) {
+		_, err := repo.AcquireExec(ctx, "test-env", true, nil)
+		assert.True(t, errors.Is(err, ErrEnvironmentBusy))
+	})
+
+	t.Run("other environments are independent", func(t *testing.T) {
+		other, err := repo.AcquireExec(ctx, "other-env", true, nil)
+		require.NoError(t, err)
+		other.Release()
+	})
+
+	t.Run("waiters are served in order", func(t *testing.T) {
+		positions := make(chan int, 10)
+		acquired := make(chan *ExecSlot)
+		go func() {
+			slot, err := repo.AcquireExec(ctx, "test-env", false, func(position int) { positions <- position })
+			assert.NoError(t, err)
+			acquired <- slot
+		}()
+
+		assert.Equal(t, 1, <-positions)
+		select {
+		case <-acquired:
+			t.Fatal("acquired a busy environment")
+		case <-time.After(3 * execQueuePollInterval):
+		}
+
+		first.Release()
+		second := <-acquired
+		require.NotNil(t, second)
+		assert.Greater(t, second.Waited, time.Duration(0))
+		second.Release()
+	})
+
+	t.Run("stale tickets are discarded", func(t *testing.T) {
+		stale := filepath.Join(repo.execQueuePath("test-env"), "00000000000000000001-1-1"+ticketSuffix)
+		require.NoError(t, os.WriteFile(stale, nil, 0644))
+
+		slot, err := repo.AcquireExec(ctx, "test-env", true, nil)
+		require.NoError(t, err)
+		slot.Release()
+		assert.NoFileExists(t, stale)
+	})
+
+	t.Run("cancelled waiters leave the queue", func(t *testing.T) {
+		holder, err := repo.AcquireExec(ctx, "test-env", false, nil)
+		require.NoError(t, err)
+		defer holder.Release()
+
+		waitCtx, cancel := context.WithTimeout(ctx, 2*execQueuePollInterval)
+		defer cancel()
+		_, err = repo.AcquireExec(waitCtx, "test-env", false, nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		entries, err := os.ReadDir(repo.execQueuePath("test-env"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// ExportSchemaVersion is the version of the export document format.
+// It's bumped whenever fields are renamed or removed; new fields may be added at any time.
+const ExportSchemaVersion = 1
+
+// Export is a snapshot of environments for external tools such as dashboards.
+type Export struct {
+	SchemaVersion int                  `json:"schema_version"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Repository    string               `json:"repository"`
+	Environments  []*EnvironmentExport `json:"environments"`
+}
+
+// EnvironmentExport describes one environment in an Export.
+type EnvironmentExport struct {
+	ID        string                         `json:"id"`
+	Title     string                         `json:"title"`
+	CreatedAt time.Time                      `json:"created_at"`
+	UpdatedAt time.Time                      `json:"updated_at"`
+	Config    *environment.EnvironmentConfig `json:"config"`
+	Agent     string                         `json:"agent,omitempty"`
+	RemoteRef string                         `json:"remote_ref"`
+	Head      string                         `json:"head,omitempty"`
+	Base      string                         `json:"base,omitempty"`
+	Commits   []*CommitSummary               `json:"commits"`
+	DiffStat  *DiffStats                     `json:"diff_stat,omitempty"`
+	Tests     *TestSummary                   `json:"tests,omitempty"`
+	Time      *TimeReport                    `json:"time,omitempty"`
+	// Conflicts are the files left with conflicts by merging the changes of a terminal session.
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Errors lists the parts of the environment that couldn't be exported.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// CommitSummary describes a commit of an environment's history.
+type CommitSummary struct {
+	Hash        string    `json:"hash"`
+	Subject     string    `json:"subject"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// DiffStats summarizes the changes of an environment relative to its base.
+type DiffStats struct {
+	FilesChanged int `json:"files_changed"`
+	Insertions   int `json:"insertions"`
+	Deletions    int `json:"deletions"`
+}
+
+// TestSummary summarizes the most recent test run of an environment.
+type TestSummary struct {
+	Runs      int       `json:"runs"`
+	Command   string    `json:"command"`
+	ExitCode  int       `json:"exit_code"`
+	StartedAt time.Time `json:"started_at"`
+	Passed    int       `json:"passed"`
+	Failed    int       `json:"failed"`
+	Skipped   int       `json:"skipped"`
+	// Coverage is the total coverage of the run, if measured.
+	Coverage *float64 `json:"coverage,omitempty"`
+	// CoverageSinceBase is the change of coverage relative to the latest run on the environment's base,
+	// if both measured it.
+	CoverageSinceBase *CoverageDelta `json:"coverage_since_base,omitempty"`
+}
+
+// Export returns a snapshot of the given environments, or of all environments if ids is empty.
+// Failing to summarize part of an environment is reported in its Errors rather than failing the export.
+func (r *Repository) Export(ctx context.Context, ids ...string) (*Export, error) {
+	var envs []*environment.EnvironmentInfo
+	if len(ids) == 0 {
+		var err error
+		if envs, err = r.List(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range ids {
+		envInfo, err := r.Info(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, envInfo)
+	}
+
+	export := &Export{
+		SchemaVersion: ExportSchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		Repository:    r.userRepoPath,
+		Environments:  make([]*EnvironmentExport, 0, len(envs)),
+	}
+	for _, envInfo := range envs {
+		export.Environments = append(export.Environments, r.ExportEnvironment(ctx, envInfo, true))
+	}
+	return export, nil
+}
+
+// ExportEnvironment describes an environment like Export. Unless summarize is set, only the fields read
+// from its state are filled (id, title, timestamps, config and remote_ref), which is much faster.
+func (r *Repository) ExportEnvironment(ctx context.Context, envInfo *environment.EnvironmentInfo, summarize bool) *EnvironmentExport {
+	exported := &EnvironmentExport{
+		ID:        envInfo.ID,
+		Title:     envInfo.State.Title,
+		CreatedAt: envInfo.State.CreatedAt,
+		UpdatedAt: envInfo.State.UpdatedAt,
+		Config:    envInfo.State.Config,
+		Agent:     envInfo.State.Agent,
+		RemoteRef: fmt.Sprintf("%s/%s", containerUseRemote, envInfo.ID),
+		Conflicts: envInfo.State.Conflicts,
+		Commits:   []*CommitSummary{},
+	}
+	if !summarize {
+		return exported
+	}
+	fail := func(what string, err error) {
+		exported.Errors = append(exported.Errors, fmt.Sprintf("%s: %s", what, err))
+	}
+
+	if head, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", envInfo.ID); err == nil {
+		exported.Head = strings.TrimSpace(head)
+	} else {
+		fail("head", err)
+	}
+
+	if events, err := r.events(envInfo.ID); err == nil {
+		exported.Time = buildTimeReport(envInfo, events)
+	} else {
+		fail("time", err)
+	}
+
+	mergeBase, err := r.mergeBase(ctx, envInfo)
+	if err != nil {
+		fail("base", err)
+		return exported
+	}
+	exported.Base = mergeBase
+	revisionRange := fmt.Sprintf("%s..%s", mergeBase, exported.RemoteRef)
+
+	if commits, err := r.commitSummaries(ctx, revisionRange); err == nil {
+		exported.Commits = commits
+	} else {
+		fail("commits", err)
+	}
+
+	if stat, err := r.diffStats(ctx, revisionRange); err == nil {
+		exported.DiffStat = stat
+	} else {
+		fail("diff_stat", err)
+	}
+
+	if history, err := r.TestHistory(ctx, envInfo.ID); err != nil {
+		fail("tests", err)
+	} else if len(history) > 0 {
+		last := history[len(history)-1]
+		exported.Tests = &TestSummary{
+			Runs:      len(history),
+			Command:   last.Command,
+			ExitCode:  last.ExitCode,
+			StartedAt: last.StartedAt,
+			Passed:    last.Count(TestPassed),
+			Failed:    last.Count(TestFailed),
+			Skipped:   last.Count(TestSkipped),
+		}
+		if last.Coverage != nil {
+			exported.Tests.Coverage = &last.Coverage.Total
+			if base := r.baseTestRun(ctx, envInfo.ID, history); base != nil {
+				exported.Tests.CoverageSinceBase = CompareCoverage(base.Coverage, last.Coverage)
+			}
+		}
+	}
+
+	return exported
+}
+
+// commitSummaries returns the commits of a revision range, newest first.
+func (r *Repository) commitSummaries(ctx context.Context, revisionRange string) ([]*CommitSummary, error) {
+	output, err := RunGitCommand(ctx, r.userRepoPath, "log", "--format=%H%x00%s%x00%an%x00%ae%x00%ct", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []*CommitSummary{}
+	for line := range strings.SplitSeq(output, "\n") {
+		parts := strings.Split(line, "\x00")
+		if len(parts) < 5 {
+			continue
+		}
+		timestamp, _ := strconv.ParseInt(parts[4], 10, 64)
+		commits = append(commits, &CommitSummary{
+			Hash:        parts[0],
+			Subject:     parts[1],
+			AuthorName:  parts[2],
+			AuthorEmail: parts[3],
+			Timestamp:   time.Unix(timestamp, 0).UTC(),
+		})
+	}
+	return commits, nil
+}
+
+func (r *Repository) diffStats(ctx context.Context, revisionRange string) (*DiffStats, error) {
+	output, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--numstat", "--find-renames", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DiffStats{}
+	for line := range strings.SplitSeq(output, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		stats.FilesChanged++
+		// Binary files are reported as "-" and count as changed files only.
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			stats.Insertions += n
+		}
+		if n, err := strconv.Atoi(fields[1]); err == nil {
+			stats.Deletions += n
+		}
+	}
+	return stats, nil
+}
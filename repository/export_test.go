@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+
+	// Make the environment's changes on a side branch, then turn it into an environment by hand.
+	runGit(t, userRepo, "checkout", "-b", "work")
+	writeFile(t, userRepo, "README.md", "hello\nworld\n")
+	writeFile(t, userRepo, "main.go", "package main\n")
+	runGit(t, userRepo, "add", ".")
+	runGit(t, userRepo, "commit", "-m", "Add main")
+	runGit(t, userRepo, "checkout", "main")
+	seedEnvironment(t, repo, "test-env", "work", &environment.State{Title: "Add a main package", Config: environment.DefaultConfig()})
+
+	export, err := repo.Export(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ExportSchemaVersion, export.SchemaVersion)
+	require.Len(t, export.Environments, 1)
+
+	env := export.Environments[0]
+	assert.Empty(t, env.Errors)
+	assert.Equal(t, "test-env", env.ID)
+	assert.Equal(t, "Add a main package", env.Title)
+	assert.Equal(t, "container-use/test-env", env.RemoteRef)
+	require.Len(t, env.Commits, 1)
+	assert.Equal(t, "Add main", env.Commits[0].Subject)
+	assert.Equal(t, env.Head, env.Commits[0].Hash)
+	assert.Equal(t, &DiffStats{FilesChanged: 2, Insertions: 2}, env.DiffStat)
+	assert.Nil(t, env.Tests)
+
+	assert.Equal(t, runGit(t, userRepo, "rev-parse", "main"), env.Base)
+
+	_, err = repo.Export(ctx, "missing-env")
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// Formats of the scripts reproducing an environment.
+const (
+	ScriptFormatShell      = "sh"
+	ScriptFormatDockerfile = "dockerfile"
+)
+
+// SuccessfulCommands returns the commands that succeeded in the environment, from its event log and in the
+// order they ran. Repeated commands are kept: they may depend on the changes made in between.
+func (r *Repository) SuccessfulCommands(id string) ([]string, error) {
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := []string{}
+	for _, event := range events {
+		if event.Type != environment.EventExecFinished {
+			continue
+		}
+		command, _ := event.Data["command"].(string)
+		if exitCode, ok := event.Data["exit_code"].(float64); !ok || exitCode != 0 || command == "" {
+			continue
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// ReproductionScript returns a script reproducing an environment from the root of the repository: its
+// configuration (base image, variables, workdir, setup and install commands) then the commands that
+// succeeded in it. Each command runs in a shell of its own, like in the environment: a subshell in the
+// shell script, a RUN instruction in the Dockerfile.
+func ReproductionScript(envID string, config *environment.EnvironmentConfig, commands []string, format string) (string, error) {
+	switch format {
+	case ScriptFormatShell:
+		return shellReproductionScript(envID, config, commands), nil
+	case ScriptFormatDockerfile:
+		return dockerfileReproductionScript(envID, config, commands), nil
+	default:
+		return "", fmt.Errorf("unknown script format %q, use %s or %s", format, ScriptFormatShell, ScriptFormatDockerfile)
+	}
+}
+
+func shellReproductionScript(envID string, config *environment.EnvironmentConfig, commands []string) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Reproduces the environment %s from the commands that succeeded in it.\n", envID)
+	fmt.Fprintf(&b, "# Run it from the root of the repository, in a container of %s (the environment's workdir is %s).\n", config.BaseImageDescription(), config.Workdir)
+	writeReproductionCaveats(&b, config)
+	b.WriteString("set -e\n")
+
+	if len(config.Env) > 0 {
+		b.WriteString("\n")
+		for _, variable := range config.Env {
+			key, value, _ := strings.Cut(variable, "=")
+			fmt.Fprintf(&b, "export %s=%s\n", key, doubleQuote(value, "\"\\`"))
+		}
+	}
+	for _, section := range reproductionSections(config, commands) {
+		fmt.Fprintf(&b, "\n# %s\n", section.title)
+		for _, command := range section.commands {
+			if strings.Contains(command, "\n") {
+				fmt.Fprintf(&b, "(\n%s\n)\n", command)
+			} else {
+				fmt.Fprintf(&b, "(%s)\n", command)
+			}
+		}
+	}
+	return b.String()
+}
+
+func dockerfileReproductionScript(envID string, config *environment.EnvironmentConfig, commands []string) string {
+	var b strings.Builder
+	b.WriteString("# syntax=docker/dockerfile:1\n")
+	fmt.Fprintf(&b, "# Reproduces the environment %s from the commands that succeeded in it.\n", envID)
+	b.WriteString("# Build it from the root of the repository.\n")
+	if config.BaseBuild != nil {
+		fmt.Fprintf(&b, "# The environment's base image is built from %s: use it instead of the image below.\n", config.BaseImageDescription())
+	}
+	writeReproductionCaveats(&b, config)
+	fmt.Fprintf(&b, "FROM %s\n", config.BaseImage)
+	fmt.Fprintf(&b, "WORKDIR %s\n", config.Workdir)
+	for _, variable := range config.Env {
+		key, value, _ := strings.Cut(variable, "=")
+		fmt.Fprintf(&b, "ENV %s=%s\n", key, doubleQuote(value, "\"\\"))
+	}
+
+	sourceCopied := false
+	for _, section := range reproductionSections(config, commands) {
+		// The source is added after the setup commands, like in the environment.
+		if !section.beforeSource && !sourceCopied {
+			b.WriteString("\nCOPY . .\n")
+			sourceCopied = true
+		}
+		fmt.Fprintf(&b, "\n# %s\n", section.title)
+		for _, command := range section.commands {
+			if strings.Contains(command, "\n") {
+				fmt.Fprintf(&b, "RUN <<'EOF'\n%s\nEOF\n", command)
+			} else {
+				fmt.Fprintf(&b, "RUN %s\n", command)
+			}
+		}
+	}
+	if !sourceCopied {
+		b.WriteString("\nCOPY . .\n")
+	}
+	return b.String()
+}
+
+// reproductionSection is a group of commands of a reproduction script.
+type reproductionSection struct {
+	title        string
+	commands     []string
+	beforeSource bool
+}
+
+func reproductionSections(config *environment.EnvironmentConfig, commands []string) []reproductionSection {
+	var sections []reproductionSection
+	if len(config.SetupCommands) > 0 {
+		sections = append(sections, reproductionSection{title: "Setup commands", commands: config.SetupCommands, beforeSource: true})
+	}
+	if len(config.InstallCommands) > 0 {
+		sections = append(sections, reproductionSection{title: "Install commands", commands: config.InstallCommands})
+	}
+	if len(commands) > 0 {
+		sections = append(sections, reproductionSection{title: "Commands of the environment", commands: commands})
+	}
+	return sections
+}
+
+// writeReproductionCaveats notes the parts of the configuration a script doesn't reproduce.
+func writeReproductionCaveats(b *strings.Builder, config *environment.EnvironmentConfig) {
+	if len(config.Secrets) > 0 {
+		keys := make([]string, 0, len(config.Secrets))
+		for _, secret := range config.Secrets {
+			key, _, _ := strings.Cut(secret, "=")
+			keys = append(keys, key)
+		}
+		fmt.Fprintf(b, "# Secrets aren't included, provide them yourself: %s.\n", strings.Join(keys, ", "))
+	}
+	if len(config.Services) > 0 {
+		names := make([]string, 0, len(config.Services))
+		for _, service := range config.Services {
+			names = append(names, service.Name)
+		}
+		fmt.Fprintf(b, "# Services aren't started, run them yourself: %s.\n", strings.Join(names, ", "))
+	}
+	if len(config.Features) > 0 {
+		fmt.Fprintf(b, "# Dev container features aren't installed: %d configured.\n", len(config.Features))
+	}
+}
+
+// doubleQuote quotes s in double quotes, escaping the given characters with a backslash. Variables are
+// still expanded, like in the environment.
+func doubleQuote(s, escaped string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if strings.ContainsRune(escaped, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuccessfulCommands(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+
+	finished := func(command string, exitCode int) {
+		repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": command, "exit_code": exitCode})
+	}
+	finished("apt-get install -y jq", 0)
+	finished("go test ./...", 1)
+	finished("go generate ./...", 0)
+	finished("go test ./...", 0)
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "make", "error": "engine failure"})
+
+	commands, err := repo.SuccessfulCommands("test-env")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apt-get install -y jq", "go generate ./...", "go test ./..."}, commands)
+}
+
+func TestReproductionScript(t *testing.T) {
+	config := &environment.EnvironmentConfig{
+		Workdir:         "/workdir",
+		BaseImage:       "golang:1.24",
+		SetupCommands:   []string{"apt-get update"},
+		InstallCommands: []string{"go mod download"},
+		Env:             environment.KVList{`PATH=/go/bin:$PATH`, `GREETING=say "hi"`},
+		Secrets:         environment.KVList{"GITHUB_TOKEN=op://vault/github/token"},
+	}
+	commands := []string{"go test ./...", "cd tools\ngo build ./..."}
+
+	script, err := ReproductionScript("fancy-mallard", config, commands, ScriptFormatShell)
+	require.NoError(t, err)
+	assert.Equal(t, `#!/bin/sh
+# Reproduces the environment fancy-mallard from the commands that succeeded in it.
+# Run it from the root of the repository, in a container of golang:1.24 (the environment's workdir is /workdir).
+# Secrets aren't included, provide them yourself: GITHUB_TOKEN.
+set -e
+
+export PATH="/go/bin:$PATH"
+export GREETING="say \"hi\""
+
+# Setup commands
+(apt-get update)
+
+# Install commands
+(go mod download)
+
+# Commands of the environment
+(go test ./...)
+(
+cd tools
+go build ./...
+)
+`, script)
+
+	dockerfile, err := ReproductionScript("fancy-mallard", config, commands, ScriptFormatDockerfile)
+	require.NoError(t, err)
+	assert.Equal(t, `# syntax=docker/dockerfile:1
+# Reproduces the environment fancy-mallard from the commands that succeeded in it.
+# Build it from the root of the repository.
+# Secrets aren't included, provide them yourself: GITHUB_TOKEN.
+FROM golang:1.24
+WORKDIR /workdir
+ENV PATH="/go/bin:$PATH"
+ENV GREETING="say \"hi\""
+
+# Setup commands
+RUN apt-get update
+
+COPY . .
+
+# Install commands
+RUN go mod download
+
+# Commands of the environment
+RUN go test ./...
+RUN <<'EOF'
+cd tools
+go build ./...
+EOF
+`, dockerfile)
+
+	_, err = ReproductionScript("fancy-mallard", config, commands, "makefile")
+	assert.ErrorContains(t, err, `unknown script format "makefile"`)
+}
@@ -26,6 +26,13 @@ const (
 	LockTypeNotes LockType = "notes"
 )
 
+// environmentLockType is the lock type of publishing an environment's changes: exporting its workdir,
+// committing, saving its state and fetching it into the source repo. Readers hold it shared, so they never
+// see a partially published change.
+func environmentLockType(id string) LockType {
+	return LockType("environment-" + id)
+}
+
 // RepositoryLockManager provides granular process-level locking for repository operations
 // to prevent git concurrency issues when multiple container-use instances
 // operate on the same repository simultaneously.
@@ -57,6 +64,13 @@ func (rlm *RepositoryLockManager) GetLock(lockType LockType) *RepositoryLock {
 		return lock
 	}
 
+	lock := rlm.newLock(lockType)
+	rlm.locks[lockType] = lock
+	return lock
+}
+
+// newLock returns a lock for the specified operation type on a file descriptor of its own.
+func (rlm *RepositoryLockManager) newLock(lockType LockType) *RepositoryLock {
 	lockFileName := fmt.Sprintf("container-use-%x-%s.lock", hashString(rlm.repoPath), string(lockType))
 	lockDir := filepath.Join(os.TempDir(), "container-use-locks")
 	lockFile := filepath.Join(lockDir, lockFileName)
@@ -66,12 +80,9 @@ func (rlm *RepositoryLockManager) GetLock(lockType LockType) *RepositoryLock {
 		slog.Error("Failed to create lock directory", "error", err)
 	}
 
-	lock := &RepositoryLock{
+	return &RepositoryLock{
 		flock: flock.New(lockFile),
 	}
-
-	rlm.locks[lockType] = lock
-	return lock
 }
 
 // WithLock executes a function while holding an exclusive lock for the specified lock type
@@ -85,6 +96,17 @@ func (rlm *RepositoryLockManager) WithRLock(ctx context.Context, lockType LockTy
 	return rlm.GetLock(lockType).WithRLock(ctx, fn)
 }
 
+// WithIsolatedLock is like WithLock, but the lock also excludes the other goroutines of the process:
+// the locks returned by GetLock are shared by the whole process, so goroutines don't exclude each other.
+func (rlm *RepositoryLockManager) WithIsolatedLock(ctx context.Context, lockType LockType, fn func() error) error {
+	return rlm.newLock(lockType).WithLock(ctx, fn)
+}
+
+// WithIsolatedRLock is like WithRLock, but waits for the isolated exclusive locks of the process too.
+func (rlm *RepositoryLockManager) WithIsolatedRLock(ctx context.Context, lockType LockType, fn func() error) error {
+	return rlm.newLock(lockType).WithRLock(ctx, fn)
+}
+
 // Lock acquires an exclusive repository lock.
 func (rl *RepositoryLock) Lock(ctx context.Context) error {
 	const retryDelay = 100 * time.Millisecond
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Reads of an environment wait for the publication of its changes in progress, even from the same process.
+func TestIsolatedLockExcludesGoroutines(t *testing.T) {
+	ctx := context.Background()
+	locks := NewRepositoryLockManager(t.TempDir())
+	lockType := environmentLockType("fancy-mallard")
+
+	published := make(chan struct{})
+	locked := make(chan struct{})
+	go func() {
+		_ = locks.WithIsolatedLock(ctx, lockType, func() error {
+			close(locked)
+			time.Sleep(300 * time.Millisecond)
+			close(published)
+			return nil
+		})
+	}()
+	<-locked
+
+	require.NoError(t, locks.WithIsolatedRLock(ctx, lockType, func() error {
+		select {
+		case <-published:
+		default:
+			t.Error("read while publishing")
+		}
+		return nil
+	}))
+
+	// Readers don't wait for each other.
+	require.NoError(t, locks.WithIsolatedRLock(ctx, lockType, func() error {
+		readCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		return locks.WithIsolatedRLock(readCtx, lockType, func() error { return nil })
+	}))
+}
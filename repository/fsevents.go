@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// EventFileChanged reports a file of the environment's workdir that a tool call added, changed or removed.
+const EventFileChanged = "file_changed"
+
+// FileChange is a change of a file of an environment's workdir.
+type FileChange struct {
+	// Path is relative to the workdir.
+	Path string `json:"path"`
+	// Change is added, removed or changed, like drift changes.
+	Change string `json:"change"`
+	// Commit is the commit of the environment's branch with the change.
+	Commit string `json:"commit"`
+}
+
+// FileChangeFunc receives the file changes of each tool call of an environment.
+type FileChangeFunc func(envID string, changes []FileChange)
+
+type fileChangeKey struct{}
+
+// WithFileChanges returns a context reporting the file changes of environments to fn, e.g. to notify
+// the clients of the MCP server.
+func WithFileChanges(ctx context.Context, fn FileChangeFunc) context.Context {
+	return context.WithValue(ctx, fileChangeKey{}, fn)
+}
+
+// FileEvents writes the file_changed events of the environment to w as NDJSON.
+// If follow is true, it keeps streaming new events until the context is cancelled.
+func (r *Repository) FileEvents(ctx context.Context, id string, follow bool, w io.Writer) error {
+	return r.streamEvents(ctx, id, follow, w, []string{EventFileChanged})
+}
+
+// recordFileChanges records the files changed between two commits of the environment's branch, one
+// event per file. The container doesn't run between tool calls, so changes are reported once the tool
+// call's changes are committed rather than as they happen.
+func (r *Repository) recordFileChanges(ctx context.Context, envID, worktreePath, before, after string) {
+	if before == "" {
+		return
+	}
+	output, err := RunGitCommand(ctx, worktreePath, "diff", "--name-status", "--no-renames", "-z", before, after)
+	if err != nil {
+		slog.Warn("Failed to list file changes", "environment-id", envID, "err", err)
+		return
+	}
+	changes := parseFileChanges(output, after)
+	for _, change := range changes {
+		r.recordEvent(envID, EventFileChanged, map[string]any{"path": change.Path, "change": change.Change, "commit": change.Commit})
+	}
+	if fn, _ := ctx.Value(fileChangeKey{}).(FileChangeFunc); fn != nil && len(changes) > 0 {
+		fn(envID, changes)
+	}
+}
+
+// parseFileChanges parses the output of git diff --name-status -z.
+func parseFileChanges(output, commit string) []FileChange {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	changes := []FileChange{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		change := environment.DriftChanged
+		switch fields[i] {
+		case "A":
+			change = environment.DriftAdded
+		case "D":
+			change = environment.DriftRemoved
+		}
+		changes = append(changes, FileChange{Path: fields[i+1], Change: change, Commit: commit})
+	}
+	return changes
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileChanges(t *testing.T) {
+	output := "M\x00main.go\x00A\x00cmd/new file.go\x00D\x00old.go\x00T\x00link\x00"
+	assert.Equal(t, []FileChange{
+		{Path: "main.go", Change: "changed", Commit: "abc123"},
+		{Path: "cmd/new file.go", Change: "added", Commit: "abc123"},
+		{Path: "old.go", Change: "removed", Commit: "abc123"},
+		{Path: "link", Change: "changed", Commit: "abc123"},
+	}, parseFileChanges(output, "abc123"))
+
+	assert.Empty(t, parseFileChanges("", "abc123"))
+}
+
+func TestFileEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := &Repository{basePath: t.TempDir()}
+
+	repo.recordEvent("test-env", EventCreated, map[string]any{"title": "Test"})
+	repo.recordEvent("test-env", EventCommit, map[string]any{"commit": "abc123"})
+	repo.recordEvent("test-env", EventFileChanged, map[string]any{"path": "main.go", "change": "changed", "commit": "abc123"})
+
+	var buf bytes.Buffer
+	require.NoError(t, repo.FileEvents(ctx, "test-env", false, &buf))
+
+	var events []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 1)
+	assert.Equal(t, EventFileChanged, events[0].Type)
+	assert.Equal(t, "main.go", events[0].Data["path"])
+}
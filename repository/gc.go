@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// gcNotesRef is the prefix of the notes refs the notes left after a garbage collection are prepared in, before
+// replacing the actual refs.
+const gcNotesRef = "container-use-gc/"
+
+// GCOptions selects the environments to garbage collect.
+type GCOptions struct {
+	// OlderThan selects the environments without activity for that long: no change, command or tool call.
+	OlderThan time.Duration
+	// MergedOnly only selects the environments whose changes are in the history of the current branch.
+	MergedOnly bool
+}
+
+// GCCandidate is an environment selected for garbage collection.
+type GCCandidate struct {
+	ID             string    `json:"id"`
+	Title          string    `json:"title"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+	// Merged is set when the tip of the environment's branch is in the history of the current branch.
+	Merged bool `json:"merged"`
+}
+
+// GCCandidates returns the environments selected by opts, least recently active first.
+func (r *Repository) GCCandidates(ctx context.Context, opts GCOptions) ([]*GCCandidate, error) {
+	envs, err := r.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	cutoff := time.Now().Add(-opts.OlderThan)
+	var candidates []*GCCandidate
+	for _, env := range envs {
+		candidate := &GCCandidate{ID: env.ID, Title: env.State.Title, LastActivityAt: r.lastActivity(env)}
+		if candidate.LastActivityAt.After(cutoff) {
+			continue
+		}
+		candidate.Merged = r.isMerged(ctx, env.ID)
+		if opts.MergedOnly && !candidate.Merged {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	slices.SortFunc(candidates, func(a, b *GCCandidate) int { return a.LastActivityAt.Compare(b.LastActivityAt) })
+	return candidates, nil
+}
+
+// lastActivity returns the last time an environment changed or was used, from its state and its event log.
+func (r *Repository) lastActivity(env *environment.EnvironmentInfo) time.Time {
+	last := env.State.UpdatedAt
+	events, _ := r.events(env.ID)
+	for _, event := range events {
+		if event.Time.After(last) {
+			last = event.Time
+		}
+	}
+	return last
+}
+
+// isMerged reports whether the tip of an environment's branch is in the history of the user's current branch.
+func (r *Repository) isMerged(ctx context.Context, id string) bool {
+	tip, err := r.branchTip(ctx, id)
+	if err != nil {
+		return false
+	}
+	_, err = RunGitCommand(ctx, r.userRepoPath, "merge-base", "--is-ancestor", tip, "HEAD")
+	return err == nil
+}
+
+// exclusiveCommits returns the commits of an environment's branch that aren't in the history of another
+// environment or of a branch or tag of the user's repository: their notes only describe the environment.
+func (r *Repository) exclusiveCommits(ctx context.Context, id string) ([]string, error) {
+	out, err := RunGitCommand(ctx, r.forkRepoPath, "rev-list", id, "--not", "--exclude="+id, "--branches")
+	if err != nil {
+		return nil, err
+	}
+	commits := strings.Fields(out)
+	if len(commits) == 0 {
+		return nil, nil
+	}
+
+	// Commits the user's repository doesn't have can't be in its history.
+	out, err = runGitCommandWithInput(ctx, r.userRepoPath, nil, strings.Join(commits, "\n")+"\n", "cat-file", "--batch-check=%(objectname)")
+	if err != nil {
+		return nil, err
+	}
+	var known []string
+	for line := range strings.Lines(out) {
+		if fields := strings.Fields(line); len(fields) == 1 {
+			known = append(known, fields[0])
+		}
+	}
+	if len(known) == 0 {
+		return commits, nil
+	}
+	args := append([]string{"rev-list"}, known...)
+	args = append(args, "--not", "--branches", "--tags", "--exclude="+containerUseRemote+"/*", "--remotes")
+	out, err = RunGitCommand(ctx, r.userRepoPath, args...)
+	if err != nil {
+		return nil, err
+	}
+	unreachable := strings.Fields(out)
+	return slices.DeleteFunc(commits, func(commit string) bool {
+		return slices.Contains(known, commit) && !slices.Contains(unreachable, commit)
+	}), nil
+}
+
+// Collect deletes an environment for garbage collection: its branch, its remote branch and its worktree like
+// Delete, along with the notes of the commits only it has, its command logs, state and test results. The
+// branch and the notes are removed in a single ref transaction, so a failure leaves the environment intact;
+// the worktree, remote branches and copies of the notes are cleaned up once the transaction succeeded.
+func (r *Repository) Collect(ctx context.Context, id string) error {
+	if err := r.exists(ctx, id); err != nil {
+		return err
+	}
+	tip, err := r.branchTip(ctx, id)
+	if err != nil {
+		return err
+	}
+	commits, err := r.exclusiveCommits(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to list the commits of environment %s: %w", id, err)
+	}
+
+	var updatedRefs []string
+	err = r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
+		transaction := []string{"start", fmt.Sprintf("delete refs/heads/%s %s", id, tip)}
+		for _, ref := range metadataNotesRefs {
+			fullRef := "refs/notes/" + ref
+			scratchRef := "refs/notes/" + gcNotesRef + ref
+			old, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", "--quiet", fullRef)
+			if err != nil || len(commits) == 0 {
+				continue
+			}
+			old = strings.TrimSpace(old)
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "update-ref", scratchRef, old); err != nil {
+				return err
+			}
+			defer RunGitCommand(context.WithoutCancel(ctx), r.forkRepoPath, "update-ref", "-d", scratchRef)
+			if _, err := runGitCommandWithInput(ctx, r.forkRepoPath, nil, strings.Join(commits, "\n")+"\n", "notes", "--ref", gcNotesRef+ref, "remove", "--ignore-missing", "--stdin"); err != nil {
+				return fmt.Errorf("failed to remove the notes of environment %s: %w", id, err)
+			}
+			updated, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", scratchRef)
+			if err != nil {
+				return err
+			}
+			if updated = strings.TrimSpace(updated); updated != old {
+				transaction = append(transaction, fmt.Sprintf("update %s %s %s", fullRef, updated, old))
+				updatedRefs = append(updatedRefs, ref)
+			}
+		}
+		transaction = append(transaction, "commit")
+		_, err := runGitCommandWithInput(ctx, r.forkRepoPath, nil, strings.Join(transaction, "\n")+"\n", "update-ref", "--stdin")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete environment %s, it was left intact: %w", id, err)
+	}
+
+	// The environment is gone: what's left to clean up doesn't make it reappear.
+	var cleanupErrs []error
+	if worktreePath, err := r.WorktreePath(id); err != nil {
+		cleanupErrs = append(cleanupErrs, err)
+	} else if err := os.RemoveAll(worktreePath); err != nil {
+		cleanupErrs = append(cleanupErrs, err)
+	}
+	if _, err := RunGitCommand(ctx, r.forkRepoPath, "worktree", "prune"); err != nil {
+		cleanupErrs = append(cleanupErrs, err)
+	}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "remote", "prune", containerUseRemote); err != nil {
+		cleanupErrs = append(cleanupErrs, err)
+	}
+	for _, ref := range updatedRefs {
+		if err := r.propagateGitNotes(ctx, ref); err != nil {
+			cleanupErrs = append(cleanupErrs, err)
+		}
+	}
+	if err := os.Remove(r.budgetPath(id)); err != nil && !os.IsNotExist(err) {
+		cleanupErrs = append(cleanupErrs, err)
+	}
+	r.pushMetadata(ctx, id, true)
+	r.recordEvent(id, EventDeleted, map[string]any{"collected": true, "notes_removed": len(updatedRefs) > 0})
+	r.index(id, nil, IndexDeleted)
+	if err := errors.Join(cleanupErrs...); err != nil {
+		return fmt.Errorf("environment %s was deleted but cleaning up after it failed: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+	head := runGit(t, userRepo, "rev-parse", "HEAD")
+
+	// An environment with a commit of its own, on top of the user's HEAD.
+	seedEnvironment(t, repo, "stale", "HEAD", nil)
+	worktree, err := repo.WorktreePath("stale")
+	require.NoError(t, err)
+	runGit(t, repo.forkRepoPath, "worktree", "add", worktree, "stale")
+	runGit(t, worktree, "commit", "--allow-empty", "-m", "Work")
+	for _, commit := range []string{head, "stale"} {
+		for _, ref := range []string{gitNotesStateRef, gitNotesLogRef} {
+			runGit(t, repo.forkRepoPath, "notes", "--ref", ref, "add", "-f", "-m", "note", commit)
+		}
+	}
+	tip, err := repo.branchTip(ctx, "stale")
+	require.NoError(t, err)
+	runGit(t, userRepo, "fetch", containerUseRemote)
+
+	commits, err := repo.exclusiveCommits(ctx, "stale")
+	require.NoError(t, err)
+	assert.Equal(t, []string{tip}, commits, "the user's HEAD isn't exclusive to the environment")
+
+	require.NoError(t, repo.Collect(ctx, "stale"))
+
+	assert.Error(t, repo.exists(ctx, "stale"))
+	assert.NoDirExists(t, worktree)
+	_, err = RunGitCommand(ctx, userRepo, "rev-parse", "--verify", containerUseRemote+"/stale")
+	assert.Error(t, err, "the remote branch is pruned")
+	for _, ref := range []string{gitNotesStateRef, gitNotesLogRef} {
+		_, err = RunGitCommand(ctx, repo.forkRepoPath, "notes", "--ref", ref, "show", tip)
+		assert.Error(t, err, "the notes of the environment's commits are removed")
+		_, err = RunGitCommand(ctx, repo.forkRepoPath, "notes", "--ref", ref, "show", head)
+		assert.NoError(t, err, "the notes of the user's commits are kept")
+		_, err = RunGitCommand(ctx, userRepo, "notes", "--ref", ref, "show", tip)
+		assert.Error(t, err, "the notes are removed from the user's repository too")
+	}
+	assert.Empty(t, runGit(t, repo.forkRepoPath, "for-each-ref", "refs/notes/"+gcNotesRef))
+
+	assert.ErrorContains(t, repo.Collect(ctx, "stale"), "not found")
+}
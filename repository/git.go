@@ -31,6 +31,17 @@ var (
 // RunGitCommand executes a git command in the specified directory.
 // This is exported for use in tests and other packages that need direct git access.
 func RunGitCommand(ctx context.Context, dir string, args ...string) (out string, rerr error) {
+	return runGitCommandWithEnv(ctx, dir, nil, args...)
+}
+
+// runGitCommandWithEnv executes a git command with additional environment variables.
+func runGitCommandWithEnv(ctx context.Context, dir string, env []string, args ...string) (out string, rerr error) {
+	return runGitCommandWithInput(ctx, dir, env, "", args...)
+}
+
+// runGitCommandWithInput executes a git command with additional environment variables, writing input to its
+// stdin, e.g. for the commands taking a list of objects or ref updates with --stdin.
+func runGitCommandWithInput(ctx context.Context, dir string, env []string, input string, args ...string) (out string, rerr error) {
 	slog.Info(fmt.Sprintf("[%s] $ git %s", dir, strings.Join(args, " ")))
 	defer func() {
 		slog.Info(fmt.Sprintf("[%s] $ git %s (DONE)", dir, strings.Join(args, " ")), "err", rerr)
@@ -38,6 +49,12 @@ func RunGitCommand(ctx context.Context, dir string, args ...string) (out string,
 
 	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -119,7 +136,8 @@ func (r *Repository) deleteLocalRemoteBranch(id string) error {
 // initializeWorktree initializes a new worktree for environment creation.
 // It pushes the specified gitRef to create a new branch with the given id, then creates a worktree from that branch.
 // Returns the worktree path, any submodule warning, and an error.
-func (r *Repository) initializeWorktree(ctx context.Context, id, gitRef string) (string, string, error) {
+// When clone is partial, the branch is fetched into the fork with limited history instead of pushed.
+func (r *Repository) initializeWorktree(ctx context.Context, id, gitRef string, clone *environment.CloneConfig) (string, string, error) {
 	if gitRef == "" {
 		gitRef = "HEAD"
 	}
@@ -133,18 +151,29 @@ func (r *Repository) initializeWorktree(ctx context.Context, id, gitRef string)
 
 	var submoduleWarning string
 	err = r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		// Another process may have claimed the same ID since it was generated.
+		if !r.idAvailable(ctx, id) {
+			return errIDTaken
+		}
+
 		resolvedRef, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", gitRef)
 		if err != nil {
 			return err
 		}
 		resolvedRef = strings.TrimSpace(resolvedRef)
 
-		_, err = RunGitCommand(ctx, r.userRepoPath, "push", containerUseRemote, fmt.Sprintf("%s:refs/heads/%s", resolvedRef, id))
-		if err != nil {
-			// Retry once on failure
+		if clone.IsPartial() {
+			if err := r.fetchPartial(ctx, resolvedRef, id, clone); err != nil {
+				return fmt.Errorf("failed to fetch %s with limited history: %w", gitRef, err)
+			}
+		} else {
 			_, err = RunGitCommand(ctx, r.userRepoPath, "push", containerUseRemote, fmt.Sprintf("%s:refs/heads/%s", resolvedRef, id))
 			if err != nil {
-				return err
+				// Retry once on failure
+				_, err = RunGitCommand(ctx, r.userRepoPath, "push", containerUseRemote, fmt.Sprintf("%s:refs/heads/%s", resolvedRef, id))
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -182,6 +211,98 @@ func (r *Repository) initializeWorktree(ctx context.Context, id, gitRef string)
 	return worktreePath, submoduleWarning, err
 }
 
+// fetchPartial creates the environment branch in the fork by fetching resolvedRef from the user
+// repository with a shallow depth and/or a partial clone filter. The user repository is registered
+// as a promisor remote of the fork so that missing objects are fetched lazily when needed.
+// Must be called with the fork lock held.
+func (r *Repository) fetchPartial(ctx context.Context, resolvedRef, id string, clone *environment.CloneConfig) error {
+	if err := r.ensureSourceRemote(ctx, clone.Filter); err != nil {
+		return err
+	}
+
+	args := []string{"fetch", "--no-tags"}
+	if clone.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", clone.Depth))
+	}
+	if clone.Filter != "" {
+		args = append(args, "--filter="+clone.Filter)
+	}
+	args = append(args, sourceRemote, fmt.Sprintf("%s:refs/heads/%s", resolvedRef, id))
+
+	slog.Info("Fetching environment branch with limited history", "environment-id", id, "depth", clone.Depth, "filter", clone.Filter)
+	_, err := RunGitCommand(ctx, r.forkRepoPath, args...)
+	return err
+}
+
+// ensureSourceRemote points the fork's source remote at the user repository.
+func (r *Repository) ensureSourceRemote(ctx context.Context, filter string) error {
+	if _, err := RunGitCommand(ctx, r.forkRepoPath, "remote", "get-url", sourceRemote); err != nil {
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "remote", "add", sourceRemote, r.userRepoPath); err != nil {
+			return err
+		}
+	} else if _, err := RunGitCommand(ctx, r.forkRepoPath, "remote", "set-url", sourceRemote, r.userRepoPath); err != nil {
+		return err
+	}
+
+	// Local upload-pack ignores filters unless the serving side allows them.
+	if _, err := RunGitCommand(ctx, r.forkRepoPath, "config", "remote."+sourceRemote+".uploadpack", "git -c uploadpack.allowFilter=true upload-pack"); err != nil {
+		return err
+	}
+
+	if filter != "" {
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "config", "remote."+sourceRemote+".promisor", "true"); err != nil {
+			return err
+		}
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "config", "remote."+sourceRemote+".partialclonefilter", filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isShallow reports whether the fork was provisioned with truncated history.
+func (r *Repository) isShallow(ctx context.Context) bool {
+	out, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--is-shallow-repository")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// unshallow fetches the remaining history into a shallow fork.
+func (r *Repository) unshallow(ctx context.Context) error {
+	return r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		if !r.isShallow(ctx) {
+			return nil
+		}
+		slog.Info("Deepening shallow fork to full history", "fork-repo", r.forkRepoPath)
+		_, err := RunGitCommand(ctx, r.forkRepoPath, "fetch", "--no-tags", "--unshallow", sourceRemote)
+		return err
+	})
+}
+
+// withHistory runs fn and, if it failed because the shallow fork lacks older history,
+// deepens the fork and retries once.
+func (r *Repository) withHistory(ctx context.Context, fn func() error) error {
+	err := fn()
+	if err == nil || !isMissingHistoryError(err) || !r.isShallow(ctx) {
+		return err
+	}
+
+	if deepenErr := r.unshallow(ctx); deepenErr != nil {
+		return fmt.Errorf("%w (deepening shallow history also failed: %v)", err, deepenErr)
+	}
+	return fn()
+}
+
+func isMissingHistoryError(err error) bool {
+	msg := err.Error()
+	for _, needle := range []string{"shallow", "no merge base", "bad object", "unknown revision", "did not send all necessary objects"} {
+		if strings.Contains(msg, needle) {
+			return true
+		}
+	}
+	return false
+}
+
 // getWorktree gets or recreates a worktree for an existing environment.
 // It assumes the environment branch already exists in the forkRepo and will fail if it doesn't.
 func (r *Repository) getWorktree(ctx context.Context, id string) (string, error) {
@@ -214,22 +335,28 @@ func (r *Repository) getWorktree(ctx context.Context, id string) (string, error)
 			return err
 		}
 
-		_, err = RunGitCommand(ctx, r.userRepoPath, "fetch", containerUseRemote, id)
-		if err != nil {
+		return r.withHistory(ctx, func() error {
+			_, err := RunGitCommand(ctx, r.userRepoPath, "fetch", containerUseRemote, id)
 			return err
-		}
-
-		return nil
+		})
 	})
 }
 
 // createInitialCommit creates an empty commit with the environment creation message - this prevents multiple environments from overwriting the container-use-state on the parent commit
-func (r *Repository) createInitialCommit(ctx context.Context, worktreePath, id, title string) error {
+func (r *Repository) createInitialCommit(ctx context.Context, worktreePath, id, title string, identity *environment.GitIdentity) error {
 	commitMessage := fmt.Sprintf("Create environment %s: %s", id, title)
-	_, err := RunGitCommand(ctx, worktreePath, "commit", "--allow-empty", "-m", commitMessage)
+	_, err := runGitCommandWithEnv(ctx, worktreePath, identityEnv(identity), "commit", "--allow-empty", "-m", commitMessage)
 	return err
 }
 
+// identityEnv returns the environment variables applying the identity configured for an environment's commits, if any.
+func identityEnv(identity *environment.GitIdentity) []string {
+	if identity == nil {
+		return nil
+	}
+	return identity.Env()
+}
+
 func (r *Repository) propagateToWorktree(ctx context.Context, env *environment.Environment, explanation string) (rerr error) {
 	slog.Info("Propagating to worktree...",
 		"environment.id", env.ID,
@@ -243,11 +370,12 @@ func (r *Repository) propagateToWorktree(ctx context.Context, env *environment.E
 			"err", rerr)
 	}()
 
-	if err := r.exportEnvironment(ctx, env); err != nil {
-		return err
-	}
-
-	return r.propagateToGit(ctx, env, explanation)
+	return r.publish(ctx, env.ID, func() error {
+		if err := r.exportEnvironment(ctx, env); err != nil {
+			return err
+		}
+		return r.propagateToGit(ctx, env, explanation)
+	})
 }
 
 // propagateToGit commits exported changes and syncs them back to the user's git repository
@@ -257,30 +385,49 @@ func (r *Repository) propagateToGit(ctx context.Context, env *environment.Enviro
 		return fmt.Errorf("failed to get worktree path: %w", err)
 	}
 
-	if err := r.commitWorktreeChanges(ctx, worktreePath, explanation, env.State.SubmodulePaths); err != nil {
+	if err := r.keepStoredJobs(ctx, env, worktreePath); err != nil {
+		return fmt.Errorf("failed to load jobs: %w", err)
+	}
+
+	before, _ := RunGitCommand(ctx, worktreePath, "rev-parse", "HEAD")
+	if err := r.commitWorktreeChanges(ctx, worktreePath, explanation, env.Notes.Commands(), env.State.SubmodulePaths, env.State.Config.GitIdentity); err != nil {
 		return fmt.Errorf("failed to commit worktree changes: %w", err)
 	}
+	after, err := RunGitCommand(ctx, worktreePath, "rev-parse", "HEAD")
+	if err == nil && after != before {
+		r.recordEvent(env.ID, EventCommit, map[string]any{"commit": strings.TrimSpace(after), "explanation": explanation})
+		r.recordFileChanges(ctx, env.ID, worktreePath, strings.TrimSpace(before), strings.TrimSpace(after))
+	}
 
 	if err := r.saveState(ctx, env); err != nil {
 		return fmt.Errorf("failed to add notes: %w", err)
 	}
+	r.index(env.ID, env.State, IndexActive)
 
 	if err := r.lockManager.WithLock(ctx, LockTypeUserRepo, func() error {
 		slog.Info("Fetching container-use remote in source repository")
-		_, err := RunGitCommand(ctx, r.userRepoPath, "fetch", containerUseRemote, env.ID)
-		return err
+		return r.withHistory(ctx, func() error {
+			_, err := RunGitCommand(ctx, r.userRepoPath, "fetch", containerUseRemote, env.ID)
+			return err
+		})
 	}); err != nil {
 		return err
 	}
+	r.updateChangeBudget(ctx, env)
 
 	if err := r.propagateGitNotes(ctx, gitNotesStateRef); err != nil {
 		return err
 	}
 
 	if note := env.Notes.Pop(); note != "" {
-		return r.addGitNote(ctx, env, note)
+		if err := r.addGitNote(ctx, env, note); err != nil {
+			return err
+		}
 	}
 
+	r.pushMetadata(ctx, env.ID, false)
+
+	reportProgress(ctx, ProgressCommitted, map[string]any{"commit": strings.TrimSpace(after), "changed": after != before})
 	return nil
 }
 
@@ -334,11 +481,18 @@ func (r *Repository) propagateFileToWorktree(ctx context.Context, env *environme
 			"err", rerr)
 	}()
 
-	if err := r.exportEnvironmentFile(ctx, env, filePath); err != nil {
-		return err
-	}
+	return r.publish(ctx, env.ID, func() error {
+		if err := r.exportEnvironmentFile(ctx, env, filePath); err != nil {
+			return err
+		}
+		return r.propagateToGit(ctx, env, explanation)
+	})
+}
 
-	return r.propagateToGit(ctx, env, explanation)
+// publish runs fn, which exports an environment's changes and commits them, while holding the
+// environment's lock exclusively: reads wait for it to finish, see loadPublishedState.
+func (r *Repository) publish(ctx context.Context, id string, fn func() error) error {
+	return r.lockManager.WithIsolatedLock(ctx, environmentLockType(id), fn)
 }
 
 func (r *Repository) exportEnvironment(ctx context.Context, env *environment.Environment) error {
@@ -416,24 +570,7 @@ func (r *Repository) saveState(ctx context.Context, env *environment.Environment
 	if err != nil {
 		return err
 	}
-	worktreePath, err := r.WorktreePath(env.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get worktree path: %w", err)
-	}
-
-	f, err := os.CreateTemp(os.TempDir(), ".container-use-git-notes-*")
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	if _, err := f.Write(state); err != nil {
-		return err
-	}
-
-	return r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
-		_, err = RunGitCommand(ctx, worktreePath, "notes", "--ref", gitNotesStateRef, "add", "-f", "-F", f.Name())
-		return err
-	})
+	return r.writeStateNote(ctx, env.ID, state)
 }
 
 func (r *Repository) loadState(ctx context.Context, worktreePath string) ([]byte, error) {
@@ -484,7 +621,12 @@ func (r *Repository) mergeBase(ctx context.Context, env *environment.Environment
 		currentBranch = "HEAD"
 	}
 	envGitRef := fmt.Sprintf("%s/%s", containerUseRemote, env.ID)
-	mergeBase, err := RunGitCommand(ctx, r.userRepoPath, "merge-base", currentBranch, envGitRef)
+	var mergeBase string
+	err = r.withHistory(ctx, func() error {
+		var err error
+		mergeBase, err = RunGitCommand(ctx, r.userRepoPath, "merge-base", currentBranch, envGitRef)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -500,7 +642,10 @@ func (r *Repository) revisionRange(ctx context.Context, env *environment.Environ
 	return fmt.Sprintf("%s..%s", mergeBase, envGitRef), nil
 }
 
-func (r *Repository) commitWorktreeChanges(ctx context.Context, worktreePath, explanation string, submodulePaths []string) error {
+// commitWorktreeChanges commits all changes in the worktree.
+// The message is generated from the staged diff, the explanation and the commands that caused the changes.
+// The commit is authored by identity when it's set, and by the user's git identity otherwise.
+func (r *Repository) commitWorktreeChanges(ctx context.Context, worktreePath, explanation string, commands, submodulePaths []string, identity *environment.GitIdentity) error {
 	return r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
 		status, err := RunGitCommand(ctx, worktreePath, "status", "--porcelain")
 		if err != nil {
@@ -515,7 +660,8 @@ func (r *Repository) commitWorktreeChanges(ctx context.Context, worktreePath, ex
 			return err
 		}
 
-		_, err = RunGitCommand(ctx, worktreePath, "commit", "--allow-empty", "--allow-empty-message", "-m", explanation)
+		message := r.commitMessage(ctx, worktreePath, explanation, commands)
+		_, err = runGitCommandWithEnv(ctx, worktreePath, identityEnv(identity), "commit", "--allow-empty", "--allow-empty-message", "-m", message)
 		return err
 	})
 }
@@ -576,26 +722,27 @@ func (r *Repository) isWithinSubmodule(filePath string, submodulePaths []string)
 }
 
 func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string, submodulePaths []string) error {
-	statusOutput, err := RunGitCommand(ctx, worktreePath, "status", "--porcelain")
+	// -z keeps paths unquoted, and lists the original path of renames as a separate entry.
+	statusOutput, err := RunGitCommand(ctx, worktreePath, "status", "--porcelain", "-z")
 	if err != nil {
 		return err
 	}
 
 	// Use cached submodule paths from environment state instead of re-detecting
 
-	for line := range strings.SplitSeq(strings.TrimSpace(statusOutput), "\n") {
-		if line == "" {
-			continue
-		}
-		if len(line) < 3 {
+	entries := strings.Split(statusOutput, "\x00")
+	for i := 0; i < len(entries); i++ {
+		line := entries[i]
+		if len(line) < 4 {
 			continue
 		}
 
 		indexStatus := line[0]
 		workTreeStatus := line[1]
-		fileName := strings.TrimSpace(line[2:])
-		if fileName == "" {
-			continue
+		fileName := line[3:]
+		if indexStatus == 'R' || indexStatus == 'C' {
+			// The next entry is the original path, already staged.
+			i++
 		}
 
 		if r.shouldSkipFile(fileName) {
@@ -620,7 +767,7 @@ func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string,
 			} else if !r.isBinaryFile(worktreePath, fileName) {
 				// Untracked file - add if not binary
 
-				_, err = RunGitCommand(ctx, worktreePath, "add", fileName)
+				_, err = RunGitCommand(ctx, worktreePath, "add", "--", fileName)
 				if err != nil {
 					return err
 				}
@@ -630,14 +777,15 @@ func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string,
 			continue
 		case indexStatus == 'D' || workTreeStatus == 'D':
 			// D = deleted files (always stage deletion)
-			_, err = RunGitCommand(ctx, worktreePath, "add", fileName)
+			_, err = RunGitCommand(ctx, worktreePath, "add", "--", fileName)
 			if err != nil {
 				return err
 			}
 		default:
-			// M, R, C and other statuses - add if not binary
-			if !r.isBinaryFile(worktreePath, fileName) {
-				_, err = RunGitCommand(ctx, worktreePath, "add", fileName)
+			// M, R, C, T and other statuses - add if not binary, or if only the mode of a binary file changed,
+			// e.g. it was made executable
+			if !r.isBinaryFile(worktreePath, fileName) || r.isModeChange(ctx, worktreePath, fileName) {
+				_, err = RunGitCommand(ctx, worktreePath, "add", "--", fileName)
 				if err != nil {
 					return err
 				}
@@ -648,6 +796,15 @@ func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string,
 	return nil
 }
 
+// isModeChange reports whether only the mode of a tracked file changed in the worktree, not its content.
+func (r *Repository) isModeChange(ctx context.Context, worktreePath, fileName string) bool {
+	if _, err := RunGitCommand(ctx, worktreePath, "diff", "--quiet", "--", fileName); err == nil {
+		return false
+	}
+	_, err := RunGitCommand(ctx, worktreePath, "-c", "core.fileMode=false", "diff", "--quiet", "--", fileName)
+	return err == nil
+}
+
 func (r *Repository) shouldSkipFile(fileName string) bool {
 	skipExtensions := []string{
 		".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz",
@@ -734,7 +891,7 @@ func (r *Repository) addFilesFromUntrackedDirectory(ctx context.Context, worktre
 		}
 
 		if !r.isBinaryFile(worktreePath, relPath) {
-			_, err = RunGitCommand(ctx, worktreePath, "add", relPath)
+			_, err = RunGitCommand(ctx, worktreePath, "add", "--", relPath)
 			if err != nil {
 				return err
 			}
@@ -744,15 +901,17 @@ func (r *Repository) addFilesFromUntrackedDirectory(ctx context.Context, worktre
 	})
 }
 
+// isBinaryFile reports whether a file of the worktree shouldn't be committed: binary or too large. Symlinks
+// are committed as links, wherever they point.
 func (r *Repository) isBinaryFile(worktreePath, fileName string) bool {
 	fullPath := filepath.Join(worktreePath, fileName)
 
-	stat, err := os.Stat(fullPath)
+	stat, err := os.Lstat(fullPath)
 	if err != nil {
 		return true
 	}
 
-	if stat.IsDir() {
+	if stat.IsDir() || stat.Mode()&os.ModeSymlink != 0 {
 		return false
 	}
 
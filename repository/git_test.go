@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -154,7 +155,7 @@ func TestCommitWorktreeChanges(t *testing.T) {
 
 		// This verifies that commitWorktreeChanges handles empty directories gracefully
 		// It should return nil (success) when there's nothing to commit
-		err := repo.commitWorktreeChanges(ctx, dir, "Empty dirs", []string{})
+		err := repo.commitWorktreeChanges(ctx, dir, "Empty dirs", nil, []string{}, nil)
 		assert.NoError(t, err, "commitWorktreeChanges should handle empty dirs gracefully")
 	})
 
@@ -162,7 +163,7 @@ func TestCommitWorktreeChanges(t *testing.T) {
 		// Create a file to commit
 		writeFile(t, dir, "test.txt", "hello world")
 
-		err := repo.commitWorktreeChanges(ctx, dir, "Testing commit functionality", []string{})
+		err := repo.commitWorktreeChanges(ctx, dir, "Testing commit functionality", nil, []string{}, nil)
 		require.NoError(t, err)
 
 		// Verify commit was created
@@ -170,6 +171,95 @@ func TestCommitWorktreeChanges(t *testing.T) {
 		require.NoError(t, err)
 		assert.Contains(t, log, "Testing commit functionality")
 	})
+
+	t.Run("uses_git_identity", func(t *testing.T) {
+		writeFile(t, dir, "bot.txt", "beep")
+
+		identity := &environment.GitIdentity{Name: "agent[bot]", Email: "agent@example.com"}
+		err := repo.commitWorktreeChanges(ctx, dir, "Bot change", nil, []string{}, identity)
+		require.NoError(t, err)
+
+		log, err := RunGitCommand(ctx, dir, "log", "-1", "--format=%an <%ae>|%cn <%ce>")
+		require.NoError(t, err)
+		assert.Equal(t, "agent[bot] <agent@example.com>|agent[bot] <agent@example.com>", strings.TrimSpace(log))
+	})
+
+	t.Run("keeps_modes_renames_and_symlinks", func(t *testing.T) {
+		writeFile(t, dir, "deploy.sh", "#!/bin/sh\necho deploying\n")
+		writeBinaryFile(t, dir, "tool", 100)
+		_, err := RunGitCommand(ctx, dir, "add", "-f", "tool")
+		require.NoError(t, err)
+		require.NoError(t, repo.commitWorktreeChanges(ctx, dir, "Add the scripts", nil, []string{}, nil))
+
+		createDir(t, dir, "scripts")
+		require.NoError(t, os.Rename(filepath.Join(dir, "deploy.sh"), filepath.Join(dir, "scripts/deploy.sh")))
+		require.NoError(t, os.Chmod(filepath.Join(dir, "scripts/deploy.sh"), 0755))
+		require.NoError(t, os.Chmod(filepath.Join(dir, "tool"), 0755))
+		require.NoError(t, os.Symlink("scripts/deploy.sh", filepath.Join(dir, "deploy")))
+		require.NoError(t, os.Symlink("missing.bin", filepath.Join(dir, "dangling")))
+		writeFile(t, dir, "notes with spaces.md", "spaces")
+		require.NoError(t, repo.commitWorktreeChanges(ctx, dir, "", nil, []string{}, nil))
+
+		status, err := RunGitCommand(ctx, dir, "status", "--porcelain")
+		require.NoError(t, err)
+		assert.Empty(t, status, "everything is committed")
+		tree, err := RunGitCommand(ctx, dir, "ls-tree", "-r", "HEAD")
+		require.NoError(t, err)
+		assert.Regexp(t, `100755 blob \w+\tscripts/deploy.sh`, tree)
+		assert.Regexp(t, `100755 blob \w+\ttool`, tree, "mode changes of binary files are committed")
+		assert.Regexp(t, `120000 blob \w+\tdeploy\n`, tree)
+		assert.Regexp(t, `120000 blob \w+\tdangling`, tree)
+		assert.Contains(t, tree, "notes with spaces.md")
+
+		changes, err := RunGitCommand(ctx, dir, "diff", "--find-renames", "--raw", "-z", "HEAD~1", "HEAD")
+		require.NoError(t, err)
+		numstat, err := RunGitCommand(ctx, dir, "diff", "--find-renames", "--numstat", "-z", "HEAD~1", "HEAD")
+		require.NoError(t, err)
+		files := parseChangedFiles(changes, numstat)
+		assert.Contains(t, files, &ChangedFile{Path: "scripts/deploy.sh", OldPath: "deploy.sh", Status: "R", Similarity: 100, Mode: "100755", OldMode: "100644"})
+		assert.Contains(t, files, &ChangedFile{Path: "tool", Status: "M", Mode: "100755", OldMode: "100644", Binary: true})
+
+		message, err := RunGitCommand(ctx, dir, "log", "-1", "--format=%B")
+		require.NoError(t, err)
+		assert.Contains(t, message, "R deploy.sh -> scripts/deploy.sh")
+	})
+}
+
+// Partial forks let giant repositories provision environments without copying their full history
+func TestFetchPartial(t *testing.T) {
+	ctx := context.Background()
+	userRepo := t.TempDir()
+
+	_, err := RunGitCommand(ctx, userRepo, "init")
+	require.NoError(t, err)
+	for i, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeFile(t, userRepo, name, strings.Repeat("x", i+1))
+		_, err = RunGitCommand(ctx, userRepo, "add", name)
+		require.NoError(t, err)
+		_, err = RunGitCommand(ctx, userRepo, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-m", "add "+name)
+		require.NoError(t, err)
+	}
+
+	repo, err := OpenWithBasePath(ctx, userRepo, t.TempDir())
+	require.NoError(t, err)
+
+	head, err := RunGitCommand(ctx, userRepo, "rev-parse", "HEAD")
+	require.NoError(t, err)
+
+	err = repo.fetchPartial(ctx, strings.TrimSpace(head), "test-env", &environment.CloneConfig{Depth: 1, Filter: "blob:none"})
+	require.NoError(t, err)
+	assert.True(t, repo.isShallow(ctx), "fork should be shallow after a depth-limited fetch")
+
+	count, err := RunGitCommand(ctx, repo.forkRepoPath, "rev-list", "--count", "test-env")
+	require.NoError(t, err)
+	assert.Equal(t, "1", strings.TrimSpace(count))
+
+	require.NoError(t, repo.unshallow(ctx))
+	assert.False(t, repo.isShallow(ctx), "fork should have full history after deepening")
+
+	count, err = RunGitCommand(ctx, repo.forkRepoPath, "rev-list", "--count", "test-env")
+	require.NoError(t, err)
+	assert.Equal(t, "3", strings.TrimSpace(count))
 }
 
 // Test helper functions
@@ -0,0 +1,16 @@
+package repository
+
+import "context"
+
+type hardenedKey struct{}
+
+// WithHardened returns a context creating hardened environments, for running untrusted code,
+// whatever the repository's configuration.
+func WithHardened(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hardenedKey{}, true)
+}
+
+func hardenedFromContext(ctx context.Context) bool {
+	hardened, _ := ctx.Value(hardenedKey{}).(bool)
+	return hardened
+}
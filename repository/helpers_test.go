@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/require"
+)
+
+// setGitIdentity sets the identity git commits with for the rest of the test.
+func setGitIdentity(t *testing.T) {
+	t.Helper()
+	for _, role := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_"+role+"_NAME", "Test")
+		t.Setenv("GIT_"+role+"_EMAIL", "test@example.com")
+	}
+}
+
+// runGit runs git in dir and returns its trimmed output, failing the test if git fails.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	output, err := RunGitCommand(context.Background(), dir, args...)
+	require.NoError(t, err)
+	return strings.TrimSpace(output)
+}
+
+// newTestRepository opens a new user repository whose main branch has a single commit adding README.md.
+// The fork and the rest of the data directory are in a temporary directory too.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	setGitIdentity(t)
+	userRepo := t.TempDir()
+	writeFile(t, userRepo, "README.md", "hello\n")
+	runGit(t, userRepo, "init", "-b", "main")
+	runGit(t, userRepo, "add", ".")
+	runGit(t, userRepo, "commit", "-m", "init")
+
+	repo, err := OpenWithBasePath(context.Background(), userRepo, t.TempDir())
+	require.NoError(t, err)
+	return repo
+}
+
+// seedEnvironment creates the environment id by hand, without a container: its branch points to ref of the
+// user's repository, and it has the state unless state is nil. The branch is then fetched into the user's
+// repository, like container-use does. States are notes of the head commits, so environments seeded at the
+// same commit share theirs.
+func seedEnvironment(t *testing.T, repo *Repository, id, ref string, state *environment.State) {
+	t.Helper()
+	runGit(t, repo.forkRepoPath, "fetch", repo.userRepoPath, ref+":refs/heads/"+id)
+	if state != nil {
+		data, err := state.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, repo.SetRawState(context.Background(), id, data))
+	}
+	runGit(t, repo.userRepoPath, "fetch", containerUseRemote, id)
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// HostFilePrompt asks the user whether to provide a host file to a new environment.
+type HostFilePrompt func(ctx context.Context, repo *Repository, envID string, file *environment.HostFile) (bool, error)
+
+type hostFilePromptKey struct{}
+
+// WithHostFilePrompt returns a context creating environments that ask the user, with prompt,
+// about the host files configured to prompt. Without a prompt, such files are never provided.
+func WithHostFilePrompt(ctx context.Context, prompt HostFilePrompt) context.Context {
+	return context.WithValue(ctx, hostFilePromptKey{}, prompt)
+}
+
+// HostFileTrustValue identifies a host file for the user to trust: trusting a file to be provided
+// without asking doesn't trust it with another target, mode or redaction.
+func HostFileTrustValue(file *environment.HostFile) string {
+	trusted := *file
+	trusted.Prompt = false
+	value := trusted.String()
+	for _, pattern := range file.Redact {
+		value += fmt.Sprintf(" redact=%q", pattern)
+	}
+	return value
+}
+
+// hostFileTrusted returns whether the user trusted the file to be provided without asking. The
+// configuration is committed: the repository alone can't have the user's files provided silently.
+func (r *Repository) hostFileTrusted(file *environment.HostFile) (bool, error) {
+	if file.Prompt {
+		return false, nil
+	}
+	return r.IsTrusted(TrustHostFile, HostFileTrustValue(file))
+}
+
+// confirmHostFiles returns the host files to provide to a new environment: the files the user trusted
+// to be provided without asking, and the other files the user accepted.
+func (r *Repository) confirmHostFiles(ctx context.Context, envID string, files environment.HostFiles) (environment.HostFiles, error) {
+	prompt, _ := ctx.Value(hostFilePromptKey{}).(HostFilePrompt)
+
+	var confirmed environment.HostFiles
+	for _, file := range files {
+		trusted, err := r.hostFileTrusted(file)
+		if err != nil {
+			return nil, err
+		}
+		if trusted {
+			confirmed = append(confirmed, file)
+			continue
+		}
+		if prompt == nil {
+			slog.Warn("Skipping host file, no way to ask the user about it", "environment-id", envID, "source", file.Source)
+			continue
+		}
+		ok, err := prompt(ctx, r, envID, file)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			slog.Info("User declined host file", "environment-id", envID, "source", file.Source)
+			continue
+		}
+		confirmed = append(confirmed, file)
+	}
+	return confirmed, nil
+}
+
+// KeptHostFiles returns the host files to provide to an existing environment after a configuration change:
+// the files it was provided already, and the files the user trusted to be provided without asking. Files
+// the user wasn't asked about for this environment aren't provided.
+func (r *Repository) KeptHostFiles(files, provided environment.HostFiles) (environment.HostFiles, error) {
+	var kept environment.HostFiles
+	for _, file := range files.Confirmed(provided) {
+		if provided.Find(file.Source) == nil {
+			trusted, err := r.hostFileTrusted(file)
+			if err != nil {
+				return nil, err
+			}
+			if !trusted {
+				continue
+			}
+		}
+		kept = append(kept, file)
+	}
+	return kept, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmHostFiles(t *testing.T) {
+	ctx := context.Background()
+	repo := &Repository{basePath: t.TempDir()}
+	npmrc := &environment.HostFile{Source: "~/.npmrc"}
+	sshKey := &environment.HostFile{Source: "~/.ssh/id_rsa"}
+	netrc := &environment.HostFile{Source: "~/.netrc", Prompt: true}
+	kubeconfig := &environment.HostFile{Source: "~/.kube/config", Prompt: true}
+	files := environment.HostFiles{npmrc, sshKey, netrc, kubeconfig}
+	require.NoError(t, repo.Trust(TrustHostFile, HostFileTrustValue(npmrc)))
+
+	// Without a way to ask, only the trusted files are provided.
+	confirmed, err := repo.confirmHostFiles(ctx, "test-env", files)
+	require.NoError(t, err)
+	assert.Equal(t, environment.HostFiles{npmrc}, confirmed)
+
+	// Untrusted files are asked about even though they don't prompt.
+	var asked []string
+	ctx = WithHostFilePrompt(ctx, func(_ context.Context, _ *Repository, envID string, file *environment.HostFile) (bool, error) {
+		assert.Equal(t, "test-env", envID)
+		asked = append(asked, file.Source)
+		return file == kubeconfig, nil
+	})
+	confirmed, err = repo.confirmHostFiles(ctx, "test-env", files)
+	require.NoError(t, err)
+	assert.Equal(t, environment.HostFiles{npmrc, kubeconfig}, confirmed)
+	assert.Equal(t, []string{"~/.ssh/id_rsa", "~/.netrc", "~/.kube/config"}, asked)
+
+	// Trust doesn't carry over to another target or mode.
+	secretNpmrc := &environment.HostFile{Source: "~/.npmrc", Mode: environment.HostFileSecret}
+	trusted, err := repo.hostFileTrusted(secretNpmrc)
+	require.NoError(t, err)
+	assert.False(t, trusted)
+}
+
+func TestKeptHostFiles(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+	npmrc := &environment.HostFile{Source: "~/.npmrc"}
+	sshKey := &environment.HostFile{Source: "~/.ssh/id_rsa"}
+	netrc := &environment.HostFile{Source: "~/.netrc", Prompt: true}
+	require.NoError(t, repo.Trust(TrustHostFile, HostFileTrustValue(npmrc)))
+
+	// New files are only provided to existing environments if trusted.
+	kept, err := repo.KeptHostFiles(environment.HostFiles{npmrc, sshKey, netrc}, environment.HostFiles{netrc})
+	require.NoError(t, err)
+	assert.Equal(t, environment.HostFiles{npmrc, netrc}, kept)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HostFileStamp identifies a version of a file of the working tree: the file changed when its stamp did.
+type HostFileStamp struct {
+	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
+}
+
+// WorkingTreeFiles returns the stamps of the regular files of the working tree git doesn't ignore, tracked or
+// not, by path relative to the repository root. Symlinks and submodules aren't listed.
+func (r *Repository) WorkingTreeFiles(ctx context.Context) (map[string]HostFileStamp, error) {
+	out, err := RunGitCommand(ctx, r.userRepoPath, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]HostFileStamp{}
+	for _, p := range strings.Split(out, "\x00") {
+		if p == "" {
+			continue
+		}
+		p = filepath.FromSlash(p)
+		// Tracked files deleted from the working tree are still listed.
+		info, err := os.Lstat(filepath.Join(r.userRepoPath, p))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files[p] = HostFileStamp{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+	}
+	return files, nil
+}
+
+// ChangedFiles compares two listings of WorkingTreeFiles, returning the files of after that are new or
+// changed, and those of before that were removed, sorted.
+func ChangedFiles(before, after map[string]HostFileStamp) (changed, removed []string) {
+	for p, stamp := range after {
+		if previous, ok := before[p]; !ok || previous != stamp {
+			changed = append(changed, p)
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	slices.Sort(changed)
+	slices.Sort(removed)
+	return changed, removed
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkingTreeFiles(t *testing.T) {
+	ctx := context.Background()
+	setGitIdentity(t)
+
+	dir := t.TempDir()
+	runGit(t, dir, "init")
+	writeFile(t, dir, ".gitignore", "build/\n")
+	writeFile(t, dir, "main.go", "package main")
+	writeFile(t, dir, "gone.go", "package main")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-m", "init")
+	writeFile(t, dir, "build/main", "binary")
+	require.NoError(t, os.Symlink("main.go", filepath.Join(dir, "link.go")))
+	repo := &Repository{userRepoPath: dir}
+
+	before, err := repo.WorkingTreeFiles(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{".gitignore", "main.go", "gone.go"}, slices.Collect(maps.Keys(before)), "ignored files and symlinks aren't listed")
+
+	// Edit a file, add one and remove one, tracked or not.
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "main.go"), time.Now(), time.Now().Add(time.Minute)))
+	writeFile(t, dir, "new.go", "package main")
+	require.NoError(t, os.Remove(filepath.Join(dir, "gone.go")))
+
+	after, err := repo.WorkingTreeFiles(ctx)
+	require.NoError(t, err)
+	changed, removed := ChangedFiles(before, after)
+	assert.Equal(t, []string{"main.go", "new.go"}, changed)
+	assert.Equal(t, []string{"gone.go"}, removed)
+
+	changed, removed = ChangedFiles(after, after)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dagger/container-use/environment"
+)
+
+type gitIdentityKey struct{}
+
+// WithGitIdentity returns a context creating environments whose commits are authored by identity,
+// e.g. the identity of the agent creating them, overriding the repository's configuration.
+func WithGitIdentity(ctx context.Context, identity *environment.GitIdentity) context.Context {
+	return context.WithValue(ctx, gitIdentityKey{}, identity)
+}
+
+func gitIdentityFromContext(ctx context.Context) *environment.GitIdentity {
+	identity, _ := ctx.Value(gitIdentityKey{}).(*environment.GitIdentity)
+	return identity
+}
+
+type agentKey struct{}
+
+// WithAgent returns a context creating environments attributed to agent, the MCP client creating them, which
+// the quotas of agents apply to.
+func WithAgent(ctx context.Context, agent string) context.Context {
+	return context.WithValue(ctx, agentKey{}, agent)
+}
+
+func agentFromContext(ctx context.Context) string {
+	agent, _ := ctx.Value(agentKey{}).(string)
+	return agent
+}
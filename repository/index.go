@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/gofrs/flock"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Lifecycle statuses of the environments of the global index.
+const (
+	IndexActive  = "active"
+	IndexMerged  = "merged"
+	IndexApplied = "applied"
+	IndexDeleted = "deleted"
+)
+
+// IndexEntry is an environment of the global index, which lists the environments of every repository so they
+// can be found from any directory.
+type IndexEntry struct {
+	ID string `json:"id"`
+	// Repository is the user repository the environment was last used from.
+	Repository string   `json:"repository"`
+	Title      string   `json:"title"`
+	Labels     []string `json:"labels,omitempty"`
+	// Status is active, merged, applied or deleted: deleted environments are kept so their repository can
+	// still be found.
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+}
+
+// Matches reports whether every word of query is found, ignoring case, in the entry's ID, title, labels or
+// repository.
+func (e *IndexEntry) Matches(query string) bool {
+	text := strings.ToLower(strings.Join(append([]string{e.ID, e.Title, e.Repository}, e.Labels...), "\n"))
+	for word := range strings.FieldsSeq(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func indexPath(basePath string) string {
+	return filepath.Join(basePath, "index.json")
+}
+
+// index records the environment in the global index: its state if not nil, and its status if set. Failures
+// are logged rather than returned: the index must never break the operation it records.
+func (r *Repository) index(id string, state *environment.State, status string) {
+	err := updateIndex(r.basePath, func(entries []*IndexEntry) []*IndexEntry {
+		i := slices.IndexFunc(entries, func(entry *IndexEntry) bool {
+			return entry.ID == id && entry.Repository == r.userRepoPath
+		})
+		if i < 0 {
+			if state == nil {
+				return entries
+			}
+			entries = append(entries, &IndexEntry{ID: id, Repository: r.userRepoPath, Status: IndexActive})
+			i = len(entries) - 1
+		}
+		entry := entries[i]
+		if state != nil {
+			entry.Title = state.Title
+			entry.Labels = state.Labels
+			entry.CreatedAt = state.CreatedAt
+		}
+		if status != "" {
+			entry.Status = status
+		}
+		entry.LastActivityAt = time.Now().UTC()
+		return entries
+	})
+	if err != nil {
+		slog.Error("Failed to update the environment index", "environment-id", id, "err", err)
+	}
+}
+
+// SearchIndex returns the environments of the global index of the data directory at basePath matching query,
+// see IndexEntry.Matches, most recently active first. An empty query matches every environment.
+func SearchIndex(basePath, query string) ([]*IndexEntry, error) {
+	basePath, err := homedir.Expand(basePath)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := loadIndex(basePath)
+	if err != nil {
+		return nil, err
+	}
+	matches := []*IndexEntry{}
+	for _, entry := range entries {
+		if entry.Matches(query) {
+			matches = append(matches, entry)
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b *IndexEntry) int { return b.LastActivityAt.Compare(a.LastActivityAt) })
+	return matches, nil
+}
+
+// RebuildIndex records the environments of every fork of the data directory at basePath in its global index,
+// e.g. those created before the index existed, and marks the environments that no longer exist as deleted.
+// Forks whose repositories were deleted or moved are left out. It returns the number of environments found.
+func RebuildIndex(ctx context.Context, basePath string) (int, error) {
+	basePath, err := homedir.Expand(basePath)
+	if err != nil {
+		return 0, err
+	}
+	forks, err := findForks(filepath.Join(basePath, "repos"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list forks: %w", err)
+	}
+
+	found := []*IndexEntry{}
+	// repositories are the user repositories whose environments were all found.
+	repositories := map[string]bool{}
+	for _, fork := range forks {
+		sources := forkSources(ctx, fork)
+		i := slices.IndexFunc(sources, func(source string) bool { return usesFork(ctx, source, fork) })
+		if i < 0 {
+			continue
+		}
+		ids, err := forkEnvironments(ctx, fork)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list the environments of %s: %w", fork, err)
+		}
+		repositories[sources[i]] = true
+		for _, id := range ids {
+			note, err := RunGitCommand(ctx, fork, "notes", "--ref", gitNotesStateRef, "show", id)
+			if err != nil {
+				// Environments whose creation didn't complete have no state yet.
+				continue
+			}
+			state := &environment.State{}
+			if err := state.Unmarshal([]byte(note)); err != nil {
+				continue
+			}
+			found = append(found, &IndexEntry{
+				ID:             id,
+				Repository:     sources[i],
+				Title:          state.Title,
+				Labels:         state.Labels,
+				Status:         IndexActive,
+				CreatedAt:      state.CreatedAt,
+				LastActivityAt: state.UpdatedAt,
+			})
+		}
+	}
+
+	err = updateIndex(basePath, func(entries []*IndexEntry) []*IndexEntry {
+		for _, rebuilt := range found {
+			i := slices.IndexFunc(entries, func(entry *IndexEntry) bool {
+				return entry.ID == rebuilt.ID && entry.Repository == rebuilt.Repository
+			})
+			if i < 0 {
+				entries = append(entries, rebuilt)
+				continue
+			}
+			// The statuses recorded as they changed, such as merged, are kept.
+			entry := entries[i]
+			if entry.Status == IndexDeleted {
+				entry.Status = IndexActive
+			}
+			entry.Title, entry.Labels, entry.CreatedAt = rebuilt.Title, rebuilt.Labels, rebuilt.CreatedAt
+			if rebuilt.LastActivityAt.After(entry.LastActivityAt) {
+				entry.LastActivityAt = rebuilt.LastActivityAt
+			}
+		}
+		for _, entry := range entries {
+			if repositories[entry.Repository] && !slices.ContainsFunc(found, func(rebuilt *IndexEntry) bool {
+				return rebuilt.ID == entry.ID && rebuilt.Repository == entry.Repository
+			}) {
+				entry.Status = IndexDeleted
+			}
+		}
+		return entries
+	})
+	return len(found), err
+}
+
+func loadIndex(basePath string) ([]*IndexEntry, error) {
+	data, err := os.ReadFile(indexPath(basePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*IndexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid environment index %s: %w", indexPath(basePath), err)
+	}
+	return entries, nil
+}
+
+// updateIndex replaces the entries of the global index with those fn returns, holding its lock: processes of
+// every repository update it.
+func updateIndex(basePath string, fn func(entries []*IndexEntry) []*IndexEntry) error {
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return err
+	}
+	lock := flock.New(indexPath(basePath) + ".lock")
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("failed to lock the environment index: %w", err)
+	}
+	defer lock.Unlock()
+
+	entries, err := loadIndex(basePath)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fn(entries), "", "  ")
+	if err != nil {
+		return err
+	}
+	// Readers don't take the lock: the index is replaced at once.
+	tmp, err := os.CreateTemp(basePath, ".index-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), indexPath(basePath))
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexEntryMatches(t *testing.T) {
+	entry := &IndexEntry{ID: "fancy-mallard", Title: "Fix the login redirect", Labels: []string{"backend"}, Repository: "/src/shop"}
+	assert.True(t, entry.Matches(""))
+	assert.True(t, entry.Matches("LOGIN redirect"))
+	assert.True(t, entry.Matches("backend shop mallard"))
+	assert.False(t, entry.Matches("login frontend"), "every word must match")
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+	basePath := repo.basePath
+
+	seedEnvironment(t, repo, "login-fix", "HEAD", &environment.State{Title: "Fix the login redirect", Labels: []string{"backend"}, Config: environment.DefaultConfig()})
+	// States are notes of the head commits: the environments need their own.
+	runGit(t, userRepo, "checkout", "-b", "docs")
+	runGit(t, userRepo, "commit", "--allow-empty", "-m", "docs")
+	runGit(t, userRepo, "checkout", "main")
+	seedEnvironment(t, repo, "docs", "docs", nil)
+
+	entries, err := SearchIndex(basePath, "login")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "login-fix", entries[0].ID)
+	assert.Equal(t, repo.userRepoPath, entries[0].Repository)
+	assert.Equal(t, []string{"backend"}, entries[0].Labels)
+	assert.Equal(t, IndexActive, entries[0].Status)
+
+	// Environments that weren't recorded as they were used are found by rebuilding the index.
+	data, err := (&environment.State{Title: "Update the docs", Config: environment.DefaultConfig()}).Marshal()
+	require.NoError(t, err)
+	runGit(t, repo.forkRepoPath, "notes", "--ref", gitNotesStateRef, "add", "-m", string(data), "docs")
+	entries, err = SearchIndex(basePath, "docs")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	count, err := RebuildIndex(ctx, basePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	entries, err = SearchIndex(basePath, "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// Deleted environments are kept, so their repository can still be found.
+	require.NoError(t, repo.Delete(ctx, "login-fix"))
+	entries, err = SearchIndex(basePath, "login")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, IndexDeleted, entries[0].Status)
+
+	// Environments deleted while the index wasn't updated are marked deleted by rebuilding it.
+	runGit(t, repo.forkRepoPath, "branch", "-D", "docs")
+	count, err = RebuildIndex(ctx, basePath)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	entries, err = SearchIndex(basePath, "docs")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, IndexDeleted, entries[0].Status)
+
+	// Forks whose repository is gone are left out.
+	require.NoError(t, os.RemoveAll(userRepo))
+	_, err = RebuildIndex(ctx, basePath)
+	require.NoError(t, err)
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// InputPrompt asks the user to answer the prompt a command of an environment failed on.
+// It returns false if the user didn't answer.
+type InputPrompt func(ctx context.Context, repo *Repository, envID, command, prompt string) (string, bool, error)
+
+type inputPromptKey struct{}
+
+// WithInputPrompt returns a context creating and opening environments that ask the user, with prompt,
+// to answer the prompts their commands fail on. Without a prompt, such commands just fail.
+func WithInputPrompt(ctx context.Context, prompt InputPrompt) context.Context {
+	return context.WithValue(ctx, inputPromptKey{}, prompt)
+}
+
+// inputPrompt returns the input prompt of the context for the environment envID, if any.
+func (r *Repository) inputPrompt(ctx context.Context, envID string) environment.InputPrompt {
+	prompt, _ := ctx.Value(inputPromptKey{}).(InputPrompt)
+	if prompt == nil {
+		return nil
+	}
+	return func(ctx context.Context, command, text string) (string, bool, error) {
+		return prompt(ctx, r, envID, command, text)
+	}
+}
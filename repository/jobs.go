@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/gofrs/flock"
+)
+
+// jobStartGrace is how long a job's process has to hold its lock once the job is recorded, before the job
+// is considered lost.
+const jobStartGrace = 30 * time.Second
+
+// ErrJobNotFound is returned when a job doesn't exist.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobInfo is a job and the environment it runs in.
+type JobInfo struct {
+	EnvironmentID string `json:"environment_id"`
+	*environment.Job
+}
+
+func (r *Repository) jobsPath(id string) string {
+	return filepath.Join(r.basePath, "jobs", fmt.Sprintf("%x", hashString(r.forkRepoPath)), id)
+}
+
+func (r *Repository) jobLockPath(id, jobID string) string {
+	return filepath.Join(r.jobsPath(id), jobID+".lock")
+}
+
+// StartJob records a job running command in the environment, with its log file created. The process running
+// the job must hold it with HoldJob, then record how it ended with FinishJob.
+func (r *Repository) StartJob(ctx context.Context, id, command, shell string) (*environment.Job, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	job := &environment.Job{
+		ID:        hex.EncodeToString(b),
+		Command:   command,
+		Shell:     shell,
+		Status:    environment.JobRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	job.LogPath = filepath.Join(r.jobsPath(id), job.ID+".log")
+	if err := os.MkdirAll(r.jobsPath(id), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job log: %w", err)
+	}
+	f, err := os.Create(job.LogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job log: %w", err)
+	}
+	f.Close()
+
+	if err := r.updateJobs(ctx, id, func(jobs []*environment.Job) []*environment.Job {
+		return append(jobs, job)
+	}); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// HoldJob marks the job as running in the calling process until release is called: jobs whose process exited
+// without finishing them are reported lost.
+func (r *Repository) HoldJob(id, jobID string) (release func(), err error) {
+	lock := flock.New(r.jobLockPath(id, jobID))
+	locked, err := lock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock job %s: %w", jobID, err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("job %s is already running", jobID)
+	}
+	return func() { lock.Unlock() }, nil
+}
+
+// FinishJob records how the job ended: with the exit code of its command, or with runErr when the command
+// couldn't run.
+func (r *Repository) FinishJob(ctx context.Context, id, jobID string, exitCode *int, runErr error) error {
+	finishedAt := time.Now().UTC()
+	found := false
+	err := r.updateJobs(ctx, id, func(jobs []*environment.Job) []*environment.Job {
+		for _, job := range jobs {
+			if job.ID != jobID {
+				continue
+			}
+			found = true
+			job.FinishedAt = &finishedAt
+			job.ExitCode = exitCode
+			switch {
+			case exitCode != nil && *exitCode == 0:
+				job.Status = environment.JobSucceeded
+			case exitCode != nil:
+				job.Status = environment.JobFailed
+			default:
+				job.Status = environment.JobFailed
+				job.Error = "the command couldn't run"
+				if runErr != nil {
+					job.Error = runErr.Error()
+				}
+			}
+		}
+		return jobs
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	return nil
+}
+
+// Jobs returns the jobs of the environment, or of every environment if id is empty, oldest first.
+func (r *Repository) Jobs(ctx context.Context, id string) ([]*JobInfo, error) {
+	var envs []*environment.EnvironmentInfo
+	if id != "" {
+		envInfo, err := r.Info(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		envs = []*environment.EnvironmentInfo{envInfo}
+	} else {
+		var err error
+		if envs, err = r.List(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	jobs := []*JobInfo{}
+	for _, envInfo := range envs {
+		for _, job := range envInfo.State.Jobs {
+			if job.Status == environment.JobRunning && r.jobLost(envInfo.ID, job) {
+				job.Status = environment.JobLost
+			}
+			jobs = append(jobs, &JobInfo{EnvironmentID: envInfo.ID, Job: job})
+		}
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+	return jobs, nil
+}
+
+// Job returns the job of any environment with the given ID.
+func (r *Repository) Job(ctx context.Context, jobID string) (*JobInfo, error) {
+	jobs, err := r.Jobs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.ID == jobID {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+}
+
+// jobLost reports whether the running job's process exited without finishing it: its lock is free, once the
+// process had time to take it.
+func (r *Repository) jobLost(id string, job *environment.Job) bool {
+	if time.Since(job.StartedAt) < jobStartGrace {
+		return false
+	}
+	lock := flock.New(r.jobLockPath(id, job.ID))
+	locked, err := lock.TryLock()
+	if err != nil || !locked {
+		return false
+	}
+	lock.Unlock()
+	return true
+}
+
+// updateJobs replaces the jobs of the environment's stored state with those fn returns, while no change to
+// the environment is being published.
+func (r *Repository) updateJobs(ctx context.Context, id string, fn func(jobs []*environment.Job) []*environment.Job) error {
+	if err := r.exists(ctx, id); err != nil {
+		return err
+	}
+	if err := r.publish(ctx, id, func() error {
+		raw, err := r.RawState(ctx, id)
+		if err != nil {
+			return err
+		}
+		state := &environment.State{}
+		if err := state.Unmarshal(raw); err != nil {
+			return err
+		}
+		state.Jobs = fn(state.Jobs)
+		data, err := state.Marshal()
+		if err != nil {
+			return err
+		}
+		return r.writeStateNote(ctx, id, data)
+	}); err != nil {
+		return fmt.Errorf("failed to record job: %w", err)
+	}
+	if err := r.propagateGitNotes(ctx, gitNotesStateRef); err != nil {
+		return err
+	}
+	r.pushMetadata(ctx, id, false)
+	return nil
+}
+
+// keepStoredJobs replaces the jobs of env, as loaded, with those of its stored state: jobs are started and
+// finished by other processes while env is in use.
+func (r *Repository) keepStoredJobs(ctx context.Context, env *environment.Environment, worktreePath string) error {
+	raw, err := r.loadState(ctx, worktreePath)
+	if err != nil || raw == nil {
+		return err
+	}
+	stored := &environment.State{}
+	if err := stored.Unmarshal(raw); err != nil {
+		return err
+	}
+	env.State.Jobs = stored.Jobs
+	return nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobs(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	seedEnvironment(t, repo, "test-env", "HEAD", &environment.State{Title: "Build", Config: environment.DefaultConfig()})
+
+	build, err := repo.StartJob(ctx, "test-env", "make release", "sh")
+	require.NoError(t, err)
+	assert.FileExists(t, build.LogPath)
+	release, err := repo.HoldJob("test-env", build.ID)
+	require.NoError(t, err)
+	_, err = repo.HoldJob("test-env", build.ID)
+	assert.Error(t, err, "a job is run by a single process")
+
+	lint, err := repo.StartJob(ctx, "test-env", "make lint", "sh")
+	require.NoError(t, err)
+	exitCode := 2
+	require.NoError(t, repo.FinishJob(ctx, "test-env", lint.ID, &exitCode, errors.New("command exited with code 2")))
+
+	jobs, err := repo.Jobs(ctx, "test-env")
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, build.ID, jobs[0].ID)
+	assert.Equal(t, "test-env", jobs[0].EnvironmentID)
+	assert.Equal(t, environment.JobRunning, jobs[0].Status)
+	assert.Equal(t, environment.JobFailed, jobs[1].Status)
+	assert.Equal(t, 2, *jobs[1].ExitCode)
+	assert.Empty(t, jobs[1].Error, "the command ran")
+
+	// Other fields of the state are kept.
+	info, err := repo.Info(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Equal(t, "Build", info.State.Title)
+
+	// A job whose process exited without finishing it is lost, once it had time to start.
+	release()
+	job, err := repo.Job(ctx, build.ID)
+	require.NoError(t, err)
+	assert.Equal(t, environment.JobRunning, job.Status, "the job's process may not have started yet")
+	require.NoError(t, repo.updateJobs(ctx, "test-env", func(jobs []*environment.Job) []*environment.Job {
+		jobs[0].StartedAt = jobs[0].StartedAt.Add(-time.Hour)
+		return jobs
+	}))
+	job, err = repo.Job(ctx, build.ID)
+	require.NoError(t, err)
+	assert.Equal(t, environment.JobLost, job.Status)
+
+	require.NoError(t, repo.FinishJob(ctx, "test-env", build.ID, nil, errors.New("failed to start the container")))
+	job, err = repo.Job(ctx, build.ID)
+	require.NoError(t, err)
+	assert.Equal(t, environment.JobFailed, job.Status)
+	assert.Nil(t, job.ExitCode)
+	assert.Equal(t, "failed to start the container", job.Error)
+
+	_, err = repo.Job(ctx, "missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.ErrorIs(t, repo.FinishJob(ctx, "test-env", "missing", nil, nil), ErrJobNotFound)
+}
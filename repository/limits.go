@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dagger/container-use/environment"
+)
+
+type resourceLimitsKey struct{}
+
+// WithResourceLimits returns a context creating environments with limits, replacing the limits of the
+// repository's configuration they set.
+func WithResourceLimits(ctx context.Context, limits *environment.ResourceLimits) context.Context {
+	return context.WithValue(ctx, resourceLimitsKey{}, limits)
+}
+
+func resourceLimitsFromContext(ctx context.Context) *environment.ResourceLimits {
+	limits, _ := ctx.Value(resourceLimitsKey{}).(*environment.ResourceLimits)
+	return limits
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// protectedBranchConfig is the git config key listing the branches that can't be pushed to directly,
+// as glob patterns (e.g. "release/*"), for hosts whose protection can't be looked up.
+const protectedBranchConfig = "container-use.protectedBranch"
+
+// MergeTarget is the branch environments are merged into, and how it relates to its upstream branch.
+type MergeTarget struct {
+	// Branch is the current branch, empty when HEAD is detached.
+	Branch string `json:"branch"`
+	// Remote and RemoteBranch are the upstream branch, if the branch tracks one.
+	Remote       string `json:"remote,omitempty"`
+	RemoteBranch string `json:"remote_branch,omitempty"`
+	RemoteURL    string `json:"remote_url,omitempty"`
+	// Ahead and Behind count the commits of the branch not on its upstream branch, and conversely,
+	// as of the last fetch.
+	Ahead  int `json:"ahead"`
+	Behind int `json:"behind"`
+	// Protected is set when the upstream branch can't be pushed to directly.
+	Protected bool `json:"protected"`
+	// ProtectedBy tells how the protection was detected, e.g. the matching git config pattern.
+	ProtectedBy string `json:"protected_by,omitempty"`
+}
+
+// Upstream returns the upstream branch, such as origin/main, or "" if the branch tracks none.
+func (target *MergeTarget) Upstream() string {
+	if target.Remote == "" {
+		return ""
+	}
+	return target.Remote + "/" + target.RemoteBranch
+}
+
+// Diverged reports whether the upstream branch has commits the branch doesn't, so pushing a merge
+// into the branch would be rejected.
+func (target *MergeTarget) Diverged() bool {
+	return target.Behind > 0
+}
+
+// MergeTarget describes the current branch of the repository, as the target of a merge.
+// The protection is only looked up in the git config here: hosts such as GitHub are queried by the caller.
+func (r *Repository) MergeTarget(ctx context.Context) (*MergeTarget, error) {
+	target := &MergeTarget{}
+	branch, err := r.VCS().CurrentBranch(ctx)
+	if err != nil || branch == "" {
+		// Detached HEAD: there's no branch to push.
+		return target, nil
+	}
+	target.Branch = branch
+
+	remote, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get", "branch."+target.Branch+".remote")
+	merge, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get", "branch."+target.Branch+".merge")
+	target.Remote = strings.TrimSpace(remote)
+	target.RemoteBranch = strings.TrimPrefix(strings.TrimSpace(merge), "refs/heads/")
+	if target.Remote == "" || target.Remote == "." || target.RemoteBranch == "" {
+		target.Remote, target.RemoteBranch = "", ""
+	} else {
+		remoteURL, _ := RunGitCommand(ctx, r.userRepoPath, "remote", "get-url", target.Remote)
+		target.RemoteURL = strings.TrimSpace(remoteURL)
+
+		// The upstream branch may not have been fetched yet.
+		if counts, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--left-right", "--count", "HEAD...@{upstream}"); err == nil {
+			if fields := strings.Fields(counts); len(fields) == 2 {
+				target.Ahead, _ = strconv.Atoi(fields[0])
+				target.Behind, _ = strconv.Atoi(fields[1])
+			}
+		}
+	}
+
+	patterns, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get-all", protectedBranchConfig)
+	for _, pattern := range strings.Fields(patterns) {
+		if branchMatches(pattern, target.Branch) || (target.RemoteBranch != "" && branchMatches(pattern, target.RemoteBranch)) {
+			target.Protected = true
+			target.ProtectedBy = fmt.Sprintf("git config %s %s", protectedBranchConfig, pattern)
+			break
+		}
+	}
+	return target, nil
+}
+
+func branchMatches(pattern, branch string) bool {
+	matched, err := path.Match(pattern, branch)
+	return err == nil && matched
+}
+
+// PushMergeTarget pushes the current branch to its upstream branch, or to a branch of the same name on
+// the given remote (tracking it from then on) if it has none. It returns the pushed ref and commit.
+func (r *Repository) PushMergeTarget(ctx context.Context, target *MergeTarget, remote string, w io.Writer) (string, string, error) {
+	if target.Branch == "" {
+		return "", "", fmt.Errorf("HEAD is detached: there is no branch to push")
+	}
+
+	args := []string{"push", target.Remote, "HEAD:refs/heads/" + target.RemoteBranch}
+	ref := target.Upstream()
+	if target.Remote == "" {
+		args = []string{"push", "--set-upstream", remote, target.Branch}
+		ref = remote + "/" + target.Branch
+	}
+	if err := RunInteractiveGitCommand(ctx, r.userRepoPath, w, args...); err != nil {
+		return "", "", fmt.Errorf("failed to push %s: %w", target.Branch, err)
+	}
+
+	commit, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	return ref, strings.TrimSpace(commit), nil
+}
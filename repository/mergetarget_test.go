@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeTarget(t *testing.T) {
+	ctx := context.Background()
+	setGitIdentity(t)
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, "", "init", "--bare", "--initial-branch=main", remote)
+	other := filepath.Join(t.TempDir(), "other")
+	runGit(t, "", "clone", remote, other)
+	runGit(t, other, "checkout", "-b", "main")
+	writeFile(t, other, "README.md", "hello")
+	runGit(t, other, "add", ".")
+	runGit(t, other, "commit", "-m", "init")
+	runGit(t, other, "push", "origin", "main")
+
+	dir := filepath.Join(t.TempDir(), "user")
+	runGit(t, "", "clone", remote, dir)
+	repo := &Repository{userRepoPath: dir}
+
+	target, err := repo.MergeTarget(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "main", target.Branch)
+	assert.Equal(t, "origin/main", target.Upstream())
+	assert.Equal(t, remote, target.RemoteURL)
+	assert.False(t, target.Diverged())
+	assert.False(t, target.Protected)
+
+	// Someone else pushed in the meantime.
+	writeFile(t, other, "other.txt", "other")
+	runGit(t, other, "add", ".")
+	runGit(t, other, "commit", "-m", "other")
+	runGit(t, other, "push", "origin", "main")
+	runGit(t, dir, "fetch", "origin")
+	writeFile(t, dir, "mine.txt", "mine")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-m", "mine")
+
+	target, err = repo.MergeTarget(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, target.Ahead)
+	assert.Equal(t, 1, target.Behind)
+	assert.True(t, target.Diverged())
+
+	runGit(t, dir, "config", "--add", protectedBranchConfig, "release/*")
+	runGit(t, dir, "config", "--add", protectedBranchConfig, "ma*")
+	target, err = repo.MergeTarget(ctx)
+	require.NoError(t, err)
+	assert.True(t, target.Protected)
+	assert.Contains(t, target.ProtectedBy, "ma*")
+
+	// A branch without upstream is pushed to a branch of the same name.
+	runGit(t, dir, "checkout", "-b", "feature")
+	target, err = repo.MergeTarget(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, target.Upstream())
+	assert.False(t, target.Protected)
+
+	ref, commit, err := repo.PushMergeTarget(ctx, target, "origin", io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "origin/feature", ref)
+	assert.Equal(t, runGit(t, dir, "rev-parse", "HEAD"), commit)
+	assert.Equal(t, commit, runGit(t, remote, "rev-parse", "feature"))
+
+	target, err = repo.MergeTarget(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "origin/feature", target.Upstream())
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+const (
+	// metadataRepoConfig is the git config key of the user repository naming the metadata repository.
+	metadataRepoConfig = "container-use.metadataRepo"
+	// metadataRemote is the fork's remote pointing at the metadata repository.
+	metadataRemote = "metadata"
+)
+
+// metadataNotesRefs are the notes refs mirrored to the metadata repository.
+var metadataNotesRefs = []string{gitNotesLogRef, gitNotesStateRef, gitNotesTestsRef}
+
+// MetadataRepo returns the metadata repository configured for the repository at dir, or "" if
+// environments aren't tracked in one.
+func MetadataRepo(ctx context.Context, dir string) string {
+	url, _ := RunGitCommand(ctx, dir, "config", "--get", metadataRepoConfig)
+	return strings.TrimSpace(url)
+}
+
+// MetadataRepo returns the metadata repository the environments of the repository are tracked in, if any.
+func (r *Repository) MetadataRepo(ctx context.Context) string {
+	return MetadataRepo(ctx, r.userRepoPath)
+}
+
+// SetMetadataRepo tracks the environments of the repository in the repository at url, a path or git
+// URL, or stops tracking them if url is empty. Environments tracked there from another clone become
+// available here.
+func (r *Repository) SetMetadataRepo(ctx context.Context, url string) error {
+	if url == "" {
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "config", "--unset", metadataRepoConfig); err != nil && r.MetadataRepo(ctx) != "" {
+			return err
+		}
+	} else if _, err := RunGitCommand(ctx, r.userRepoPath, "config", metadataRepoConfig, url); err != nil {
+		return err
+	}
+	return r.ensureMetadataRemote(ctx)
+}
+
+// ensureMetadataRemote points the fork's metadata remote at the configured metadata repository, fetching
+// its environments when it changes.
+func (r *Repository) ensureMetadataRemote(ctx context.Context) error {
+	url := r.MetadataRepo(ctx)
+	current, err := RunGitCommand(ctx, r.forkRepoPath, "remote", "get-url", metadataRemote)
+	hasRemote := err == nil
+	if strings.TrimSpace(current) == url || (url == "" && !hasRemote) {
+		return nil
+	}
+
+	return r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		switch {
+		case url == "":
+			_, err := RunGitCommand(ctx, r.forkRepoPath, "remote", "remove", metadataRemote)
+			return err
+		case hasRemote:
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "remote", "set-url", metadataRemote, url); err != nil {
+				return err
+			}
+		default:
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "remote", "add", metadataRemote, url); err != nil {
+				return err
+			}
+		}
+
+		// Environments of this clone are pushed as they change: only fetch the others'.
+		slog.Info("Fetching environments from metadata repository", "url", url)
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "fetch", "--no-tags", metadataRemote, "refs/heads/*:refs/heads/*"); err != nil {
+			slog.Warn("Failed to fetch some environments from metadata repository", "url", url, "err", err)
+		}
+		for _, ref := range metadataNotesRefs {
+			if err := r.mergeMetadataNotes(ctx, ref); err != nil {
+				slog.Warn("Failed to fetch notes from metadata repository", "url", url, "ref", ref, "err", err)
+			}
+		}
+		return nil
+	})
+}
+
+// mergeMetadataNotes merges the notes of the metadata repository into the fork's, keeping the fork's
+// notes on conflicts.
+func (r *Repository) mergeMetadataNotes(ctx context.Context, ref string) error {
+	fullRef := "refs/notes/" + ref
+	remoteRef := "refs/notes/" + metadataRemote + "/" + ref
+	if _, err := RunGitCommand(ctx, r.forkRepoPath, "fetch", "--no-tags", metadataRemote, "+"+fullRef+":"+remoteRef); err != nil {
+		// The metadata repository has no such notes yet.
+		return nil
+	}
+	if _, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", ref, "merge", "--strategy=ours", "--quiet", remoteRef); err != nil {
+		return fmt.Errorf("failed to merge %s notes from metadata repository: %w", ref, err)
+	}
+	return nil
+}
+
+// pushMetadata mirrors an environment's branch, or its deletion, and the notes to the metadata
+// repository, if one is configured. The metadata repository being unreachable never fails the
+// operation: the next push catches up.
+func (r *Repository) pushMetadata(ctx context.Context, id string, deleted bool) {
+	if r.MetadataRepo(ctx) == "" {
+		return
+	}
+	branch := "+refs/heads/" + id + ":refs/heads/" + id
+	if deleted {
+		branch = ":refs/heads/" + id
+	}
+	if _, err := RunGitCommand(ctx, r.forkRepoPath, "push", "--quiet", metadataRemote, branch); err != nil {
+		slog.Warn("Failed to push environment to metadata repository", "environment-id", id, "err", err)
+		return
+	}
+	r.pushMetadataNotes(ctx)
+}
+
+// pushMetadataNotes pushes the notes to the metadata repository, merging the notes pushed there by
+// other clones first when the push is rejected.
+func (r *Repository) pushMetadataNotes(ctx context.Context) {
+	for _, ref := range metadataNotesRefs {
+		fullRef := "refs/notes/" + ref
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", "--quiet", fullRef); err != nil {
+			continue
+		}
+		push := func() error {
+			_, err := RunGitCommand(ctx, r.forkRepoPath, "push", "--quiet", metadataRemote, fullRef+":"+fullRef)
+			return err
+		}
+		err := push()
+		if err != nil && strings.Contains(err.Error(), "rejected") {
+			err = r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
+				if err := r.mergeMetadataNotes(ctx, ref); err != nil {
+					return err
+				}
+				return push()
+			})
+		}
+		if err != nil {
+			slog.Warn("Failed to push notes to metadata repository", "ref", ref, "err", err)
+		}
+	}
+}
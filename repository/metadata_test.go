@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataRepo(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+	metadataRepo := t.TempDir()
+	runGit(t, metadataRepo, "init", "--bare")
+
+	assert.Empty(t, repo.MetadataRepo(ctx))
+	require.NoError(t, repo.SetMetadataRepo(ctx, metadataRepo))
+	assert.Equal(t, metadataRepo, repo.MetadataRepo(ctx))
+
+	seedEnvironment(t, repo, "test-env", "HEAD", &environment.State{Title: "Tracked", Config: environment.DefaultConfig()})
+	head := runGit(t, userRepo, "rev-parse", "HEAD")
+
+	// The branch and its state are pushed to the metadata repository.
+	assert.Equal(t, head, runGit(t, metadataRepo, "rev-parse", "refs/heads/test-env"))
+	assert.Contains(t, runGit(t, metadataRepo, "notes", "--ref", gitNotesStateRef, "show", head), "Tracked")
+
+	// Another clone tracking the same metadata repository gets the environment.
+	otherRepo := t.TempDir()
+	runGit(t, otherRepo, "init")
+	runGit(t, otherRepo, "pull", userRepo, "HEAD")
+	other, err := OpenWithBasePath(ctx, otherRepo, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, other.SetMetadataRepo(ctx, metadataRepo))
+	raw, err := other.RawState(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), "Tracked")
+
+	// Deleted environments are deleted from the metadata repository.
+	repo.pushMetadata(ctx, "test-env", true)
+	_, err = RunGitCommand(ctx, metadataRepo, "rev-parse", "--verify", "refs/heads/test-env")
+	assert.Error(t, err)
+
+	// Resetting removes the remote.
+	require.NoError(t, repo.SetMetadataRepo(ctx, ""))
+	assert.Empty(t, repo.MetadataRepo(ctx))
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "remote", "get-url", metadataRemote)
+	assert.Error(t, err)
+}
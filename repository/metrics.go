@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// Statuses of an environment, as reported by its metrics.
+const (
+	// StatusCreating is an environment whose creation didn't complete yet.
+	StatusCreating = "creating"
+	// StatusRunning is an environment running a command, other than a background command.
+	StatusRunning = "running"
+	// StatusIdle is an environment waiting for its next command.
+	StatusIdle = "idle"
+)
+
+// EnvironmentMetrics is a live summary of an environment, cheap enough to be refreshed every few seconds
+// for dashboards: it's read from the environment's state and event log, plus a diff stat.
+type EnvironmentMetrics struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Status is creating, running or idle.
+	Status          string          `json:"status"`
+	RunningCommands []string        `json:"running_commands,omitempty"`
+	LastCommand     *CommandSummary `json:"last_command,omitempty"`
+	DiffStat        *DiffStats      `json:"diff_stat,omitempty"`
+	// Healthy is unset when the environment needs attention, for the reasons listed in Problems: its last
+	// command failed, it has conflicts, or it's over its change budget.
+	Healthy   bool      `json:"healthy"`
+	Problems  []string  `json:"problems,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// CommandSummary describes the last command that finished in an environment.
+type CommandSummary struct {
+	Command string `json:"command"`
+	// ExitCode is unset when the command couldn't run, see Error.
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Metrics returns the live summary of an environment.
+func (r *Repository) Metrics(ctx context.Context, id string) (*EnvironmentMetrics, error) {
+	if !r.CreationComplete(ctx, id) {
+		return &EnvironmentMetrics{ID: id, Status: StatusCreating, Healthy: true}, nil
+	}
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := &EnvironmentMetrics{
+		ID:        id,
+		Title:     envInfo.State.Title,
+		Status:    StatusIdle,
+		UpdatedAt: envInfo.State.UpdatedAt,
+	}
+	metrics.RunningCommands, metrics.LastCommand = commandActivity(events)
+	if len(metrics.RunningCommands) > 0 {
+		metrics.Status = StatusRunning
+	}
+	if revisionRange, err := r.revisionRange(ctx, envInfo); err == nil {
+		metrics.DiffStat, _ = r.diffStats(ctx, revisionRange)
+	}
+
+	if last := metrics.LastCommand; last != nil {
+		switch {
+		case last.Error != "":
+			metrics.Problems = append(metrics.Problems, fmt.Sprintf("last command couldn't run: %s", last.Error))
+		case last.ExitCode != nil && *last.ExitCode != 0:
+			metrics.Problems = append(metrics.Problems, fmt.Sprintf("last command exited with code %d", *last.ExitCode))
+		}
+	}
+	if len(envInfo.State.Conflicts) > 0 {
+		metrics.Problems = append(metrics.Problems, fmt.Sprintf("%d file(s) with conflicts", len(envInfo.State.Conflicts)))
+	}
+	if budget, err := r.ChangeBudget(id); err == nil && budget != nil && budget.Exceeded {
+		metrics.Problems = append(metrics.Problems, fmt.Sprintf("over its change budget: %s", budget))
+	}
+	metrics.Healthy = len(metrics.Problems) == 0
+	return metrics, nil
+}
+
+// commandActivity returns the commands running according to an event log, the commands started and not
+// finished yet except background commands, and the last command that finished.
+func commandActivity(events []Event) ([]string, *CommandSummary) {
+	var running []string
+	var last *CommandSummary
+	for _, event := range events {
+		command, _ := event.Data["command"].(string)
+		switch event.Type {
+		case environment.EventExecStarted:
+			if background, _ := event.Data["background"].(bool); !background {
+				running = append(running, command)
+			}
+		case environment.EventExecFinished:
+			for i, started := range running {
+				if started == command {
+					running = append(running[:i], running[i+1:]...)
+					break
+				}
+			}
+			last = &CommandSummary{Command: command, FinishedAt: event.Time}
+			if exitCode, ok := event.Data["exit_code"].(float64); ok {
+				code := int(exitCode)
+				last.ExitCode = &code
+			}
+			last.Error, _ = event.Data["error"].(string)
+			if duration, ok := event.Data["duration_ms"].(float64); ok {
+				last.DurationMS = int64(duration)
+			}
+		}
+	}
+	return running, last
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandActivity(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "go build ./..."})
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "go build ./...", "exit_code": 0, "duration_ms": 1500})
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "npm run dev", "background": true})
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "go test ./..."})
+
+	events, err := repo.events("test-env")
+	require.NoError(t, err)
+	running, last := commandActivity(events)
+	assert.Equal(t, []string{"go test ./..."}, running)
+	require.NotNil(t, last)
+	assert.Equal(t, "go build ./...", last.Command)
+	require.NotNil(t, last.ExitCode)
+	assert.Equal(t, 0, *last.ExitCode)
+	assert.EqualValues(t, 1500, last.DurationMS)
+	assert.False(t, last.FinishedAt.IsZero())
+
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "go test ./...", "error": "engine failure"})
+	events, err = repo.events("test-env")
+	require.NoError(t, err)
+	running, last = commandActivity(events)
+	assert.Empty(t, running)
+	assert.Equal(t, "go test ./...", last.Command)
+	assert.Nil(t, last.ExitCode, "the command couldn't run")
+	assert.Equal(t, "engine failure", last.Error)
+}
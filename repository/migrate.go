@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/gofrs/flock"
+	"github.com/mitchellh/go-homedir"
+)
+
+// ErrNewerData is returned when the data directory was migrated by a newer container-use, whose
+// environments this one can't read.
+var ErrNewerData = errors.New("the data directory was written by a newer container-use")
+
+// migration upgrades the data directory at basePath from the previous version to version.
+type migration struct {
+	version     int
+	description string
+	run         func(ctx context.Context, basePath string) error
+}
+
+// migrations upgrade the data directory from each version to the next, up to environment.StateVersion, in
+// order. Version 1 is the format of the data written before the version was recorded.
+var migrations = []migration{}
+
+func dataVersionPath(basePath string) string {
+	return filepath.Join(basePath, "version")
+}
+
+// DataVersion returns the version of the data directory at basePath: see environment.StateVersion.
+func DataVersion(basePath string) (int, error) {
+	basePath, err := homedir.Expand(basePath)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(dataVersionPath(basePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid data version in %s: %w", dataVersionPath(basePath), err)
+	}
+	return version, nil
+}
+
+// checkDataVersion fails with ErrNewerData if this container-use can't read the data directory at basePath.
+func checkDataVersion(basePath string) error {
+	version, err := DataVersion(basePath)
+	if err != nil {
+		return err
+	}
+	if version > environment.StateVersion {
+		return fmt.Errorf("%w (version %d, this one reads version %d): upgrade container-use", ErrNewerData, version, environment.StateVersion)
+	}
+	return nil
+}
+
+// Migrate upgrades the data directory at basePath to environment.StateVersion, and returns the descriptions of
+// the migrations it ran. It fails with ErrNewerData if the data directory is newer.
+func Migrate(ctx context.Context, basePath string) ([]string, error) {
+	basePath, err := homedir.Expand(basePath)
+	if err != nil {
+		return nil, err
+	}
+	return migrate(ctx, basePath, environment.StateVersion, migrations)
+}
+
+func migrate(ctx context.Context, basePath string, target int, migrations []migration) ([]string, error) {
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, err
+	}
+	lock := flock.New(dataVersionPath(basePath) + ".lock")
+	if err := lock.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock the data directory: %w", err)
+	}
+	defer lock.Unlock()
+
+	version, err := DataVersion(basePath)
+	if err != nil {
+		return nil, err
+	}
+	if version > target {
+		return nil, fmt.Errorf("%w (version %d, this one reads version %d)", ErrNewerData, version, target)
+	}
+	ran := []string{}
+	for _, m := range migrations {
+		if m.version <= version || m.version > target {
+			continue
+		}
+		if err := m.run(ctx, basePath); err != nil {
+			return ran, fmt.Errorf("failed to migrate the data directory to version %d (%s): %w", m.version, m.description, err)
+		}
+		// The version is recorded after each migration, so a failed one is the first to run again.
+		if err := os.WriteFile(dataVersionPath(basePath), []byte(strconv.Itoa(m.version)+"\n"), 0644); err != nil {
+			return ran, err
+		}
+		ran = append(ran, m.description)
+	}
+	if version < target {
+		if err := os.WriteFile(dataVersionPath(basePath), []byte(strconv.Itoa(target)+"\n"), 0644); err != nil {
+			return ran, err
+		}
+	}
+	return ran, nil
+}
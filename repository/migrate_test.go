@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+
+	version, err := DataVersion(basePath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version, "data written before versions were recorded is version 1")
+
+	var ran []int
+	migrations := []migration{
+		{version: 2, description: "split the states", run: func(context.Context, string) error { ran = append(ran, 2); return nil }},
+		{version: 3, description: "rename the worktrees", run: func(context.Context, string) error { ran = append(ran, 3); return nil }},
+	}
+	descriptions, err := migrate(ctx, basePath, 2, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"split the states"}, descriptions)
+	assert.Equal(t, []int{2}, ran)
+
+	// Migrations already run aren't run again; failed ones run again next time.
+	migrations[1].run = func(context.Context, string) error { return errors.New("disk full") }
+	_, err = migrate(ctx, basePath, 3, migrations)
+	assert.ErrorContains(t, err, "failed to migrate the data directory to version 3 (rename the worktrees): disk full")
+	version, err = DataVersion(basePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	descriptions, err = migrate(ctx, basePath, 2, migrations)
+	require.NoError(t, err)
+	assert.Empty(t, descriptions)
+
+	// Older binaries refuse data they can't read.
+	_, err = migrate(ctx, basePath, 1, migrations)
+	assert.ErrorIs(t, err, ErrNewerData)
+	assert.ErrorIs(t, checkDataVersion(basePath), ErrNewerData)
+	_, err = OpenWithBasePath(ctx, ".", basePath)
+	assert.ErrorIs(t, err, ErrNewerData)
+
+	require.NoError(t, os.WriteFile(dataVersionPath(basePath), []byte("garbage"), 0644))
+	_, err = DataVersion(basePath)
+	assert.ErrorContains(t, err, "invalid data version")
+}
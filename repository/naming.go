@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	petname "github.com/dustinkirkland/golang-petname"
+)
+
+const (
+	maxIDAttempts = 20
+	seqWidth      = 4
+)
+
+var idPlaceholder = regexp.MustCompile(`\{(name|seq|date|rand)\}`)
+
+// errIDTaken is returned when a generated ID was claimed concurrently by another environment.
+var errIDTaken = errors.New("environment ID already taken")
+
+// ErrEnvironmentExists is returned when creating an environment with the ID of an existing one.
+var ErrEnvironmentExists = errors.New("environment already exists")
+
+// generateID returns a new environment ID following the naming configuration.
+// IDs already used by an environment (or a leftover worktree) are never returned.
+func (r *Repository) generateID(ctx context.Context, naming *environment.NamingConfig) (string, error) {
+	if naming == nil {
+		naming = &environment.NamingConfig{}
+	}
+
+	template := naming.Template
+	if template == "" {
+		template = "{name}"
+		if naming.Style == environment.NamingStyleSequential {
+			template = "{seq}"
+		}
+	}
+	template = naming.Prefix + template
+
+	seq := 0
+	if strings.Contains(template, "{seq}") {
+		var err error
+		if seq, err = r.lastSequence(ctx, template); err != nil {
+			return "", err
+		}
+	}
+
+	tried := map[string]bool{}
+	for attempt := range maxIDAttempts {
+		seq++
+		id, err := renderID(template, naming, seq)
+		if err != nil {
+			return "", err
+		}
+		// Templates without random or sequential parts render the same ID every time:
+		// make it unique with a stable suffix, e.g. review-2026-10-16-2.
+		if tried[id] {
+			id = fmt.Sprintf("%s-%d", id, attempt+1)
+		}
+		tried[id] = true
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "check-ref-format", "--branch", id); err != nil {
+			return "", fmt.Errorf("naming configuration produced an invalid environment ID %q", id)
+		}
+		if r.idAvailable(ctx, id) {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate a unique environment ID after %d attempts, check the naming configuration", maxIDAttempts)
+}
+
+func renderID(template string, naming *environment.NamingConfig, seq int) (string, error) {
+	var renderErr error
+	id := idPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch placeholder {
+		case "{name}":
+			name, err := generateName(naming)
+			if err != nil {
+				renderErr = err
+			}
+			return name
+		case "{seq}":
+			return fmt.Sprintf("%0*d", seqWidth, seq)
+		case "{date}":
+			return time.Now().Format("20060102")
+		default: // {rand}
+			b := make([]byte, 3)
+			if _, err := rand.Read(b); err != nil {
+				renderErr = err
+			}
+			return hex.EncodeToString(b)
+		}
+	})
+	return id, renderErr
+}
+
+func generateName(naming *environment.NamingConfig) (string, error) {
+	length := naming.Length
+	if length <= 0 {
+		length = 2
+	}
+
+	switch naming.Style {
+	case "", environment.NamingStylePetname, environment.NamingStyleSequential:
+		return petname.Generate(length, "-"), nil
+	case environment.NamingStyleWords:
+		if len(naming.Words) == 0 {
+			return "", fmt.Errorf("naming style %q requires a word list", naming.Style)
+		}
+		words := make([]string, length)
+		for i := range words {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(naming.Words))))
+			if err != nil {
+				return "", err
+			}
+			words[i] = naming.Words[n.Int64()]
+		}
+		return strings.Join(words, "-"), nil
+	default:
+		return "", fmt.Errorf("unknown naming style %q", naming.Style)
+	}
+}
+
+// lastSequence returns the highest sequence number used by existing environments matching the template.
+func (r *Repository) lastSequence(ctx context.Context, template string) (int, error) {
+	// QuoteMeta escapes the placeholder braces, so replace the escaped forms.
+	pattern := "^" + strings.NewReplacer(
+		`\{seq\}`, `(\d+)`,
+		`\{name\}`, `.+?`,
+		`\{date\}`, `.+?`,
+		`\{rand\}`, `.+?`,
+	).Replace(regexp.QuoteMeta(template)) + "$"
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	branches, err := RunGitCommand(ctx, r.forkRepoPath, "branch", "--format", "%(refname:short)")
+	if err != nil {
+		return 0, err
+	}
+
+	last := 0
+	for _, branch := range strings.Fields(branches) {
+		if m := re.FindStringSubmatch(branch); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > last {
+				last = n
+			}
+		}
+	}
+	return last, nil
+}
+
+func (r *Repository) idAvailable(ctx context.Context, id string) bool {
+	if r.exists(ctx, id) == nil {
+		return false
+	}
+	worktreePath, err := r.WorktreePath(id)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(worktreePath)
+	return os.IsNotExist(err)
+}
+
+// prepareRequestedID checks that an environment can be created with the requested ID,
+// cleaning up the leftovers of an interrupted creation of it.
+func (r *Repository) prepareRequestedID(ctx context.Context, id string) error {
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "check-ref-format", "--branch", id); err != nil {
+		return fmt.Errorf("invalid environment ID %q: it must be a valid git branch name", id)
+	}
+	if r.idAvailable(ctx, id) {
+		return nil
+	}
+	if !r.isPartialCreate(ctx, id) {
+		return fmt.Errorf("%w: %s", ErrEnvironmentExists, id)
+	}
+	slog.Warn("Cleaning up an interrupted environment creation", "environment-id", id)
+	return r.cleanupPartialCreate(ctx, id)
+}
+
+// isPartialCreate reports whether the ID is only claimed by what an interrupted creation left behind:
+// a worktree without a branch, or a branch without environment state.
+func (r *Repository) isPartialCreate(ctx context.Context, id string) bool {
+	if r.exists(ctx, id) != nil {
+		return true
+	}
+	_, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", gitNotesStateRef, "show", id)
+	return err != nil && strings.Contains(err.Error(), "no note found")
+}
+
+// cleanupPartialCreate removes the worktree and branches of an environment whose creation didn't complete.
+// Failures are logged: the creation's own error is the one worth reporting.
+func (r *Repository) cleanupPartialCreate(ctx context.Context, id string) error {
+	worktreePath, err := r.WorktreePath(id)
+	if err != nil {
+		return err
+	}
+	err = r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		if err := os.RemoveAll(worktreePath); err != nil {
+			return err
+		}
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "worktree", "prune"); err != nil {
+			return err
+		}
+		if r.exists(ctx, id) == nil {
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "branch", "-D", id); err != nil {
+				return err
+			}
+		}
+		_, err := RunGitCommand(ctx, r.userRepoPath, "remote", "prune", containerUseRemote)
+		return err
+	})
+	if err != nil {
+		slog.Error("Failed to clean up an interrupted environment creation", "environment-id", id, "err", err)
+	}
+	return err
+}
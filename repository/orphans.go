@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// forkSourcesConfig lists, in the git config of a fork, the user repositories using it, so forks left behind by
+// repositories that were deleted or moved can be found. Forks of the same origin are shared by its clones.
+const forkSourcesConfig = "container-use.source"
+
+// ensureSourceRecorded records the user repository among the repositories using the fork.
+func (r *Repository) ensureSourceRecorded(ctx context.Context) error {
+	if slices.Contains(forkSources(ctx, r.forkRepoPath), r.userRepoPath) {
+		return nil
+	}
+	return r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		_, err := RunGitCommand(ctx, r.forkRepoPath, "config", "--add", forkSourcesConfig, r.userRepoPath)
+		return err
+	})
+}
+
+// forkSources returns the user repositories recorded as using a fork.
+func forkSources(ctx context.Context, forkPath string) []string {
+	var sources []string
+	output, _ := RunGitCommand(ctx, forkPath, "config", "--get-all", forkSourcesConfig)
+	for line := range strings.Lines(output) {
+		if source := strings.TrimSpace(line); source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// usesFork reports whether a user repository still exists and still uses the fork.
+func usesFork(ctx context.Context, source, forkPath string) bool {
+	if _, err := os.Stat(source); err != nil {
+		return false
+	}
+	remote, err := getContainerUseRemote(ctx, source)
+	if err != nil {
+		return false
+	}
+	return filepath.Clean(remote) == filepath.Clean(forkPath)
+}
+
+// Orphan is a fork whose user repositories no longer exist, with the state container-use keeps for its
+// environments. The fork itself may be gone already, leaving worktrees behind.
+type Orphan struct {
+	Fork string `json:"fork"`
+	// Sources are the user repositories that used the fork.
+	Sources      []string `json:"sources"`
+	Environments []string `json:"environments"`
+	// Paths are the files and directories to delete: the fork, the worktrees, the event logs...
+	Paths []string `json:"paths"`
+	Size  int64    `json:"size"`
+}
+
+// OrphanReport is the result of FindOrphans.
+type OrphanReport struct {
+	Orphans []*Orphan `json:"orphans"`
+	// Unknown are the forks that don't record their user repositories, as they were last used by an older
+	// version of container-use. They are recorded the next time one of their repositories is used.
+	Unknown []string `json:"unknown"`
+}
+
+// Size returns the disk space taken by the orphans.
+func (r *OrphanReport) Size() int64 {
+	var size int64
+	for _, orphan := range r.Orphans {
+		size += orphan.Size
+	}
+	return size
+}
+
+// FindOrphans finds the forks of the data directory at basePath whose user repositories were deleted or moved
+// away, along with the worktrees left behind by forks that no longer exist.
+func FindOrphans(ctx context.Context, basePath string) (*OrphanReport, error) {
+	basePath, err := homedir.Expand(basePath)
+	if err != nil {
+		return nil, err
+	}
+	forks, err := findForks(filepath.Join(basePath, "repos"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forks: %w", err)
+	}
+
+	report := &OrphanReport{Orphans: []*Orphan{}, Unknown: []string{}}
+	// Environment IDs are only unique within a fork: the state of the environments of other forks is kept.
+	liveEnvironments := map[string]bool{}
+	for _, fork := range forks {
+		sources := forkSources(ctx, fork)
+		environments, err := forkEnvironments(ctx, fork)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the environments of %s: %w", fork, err)
+		}
+		switch {
+		case len(sources) == 0:
+			report.Unknown = append(report.Unknown, fork)
+		case !slices.ContainsFunc(sources, func(source string) bool { return usesFork(ctx, source, fork) }):
+			report.Orphans = append(report.Orphans, &Orphan{Fork: fork, Sources: sources, Environments: environments})
+			continue
+		}
+		for _, id := range environments {
+			liveEnvironments[id] = true
+		}
+	}
+
+	strays, err := findStrayWorktrees(filepath.Join(basePath, "worktrees"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+	for fork, ids := range strays {
+		report.Orphans = append(report.Orphans, &Orphan{Fork: fork, Sources: []string{}, Environments: ids})
+	}
+	slices.SortFunc(report.Orphans, func(a, b *Orphan) int { return strings.Compare(a.Fork, b.Fork) })
+
+	for _, orphan := range report.Orphans {
+		if _, err := os.Stat(orphan.Fork); err == nil {
+			orphan.Paths = append(orphan.Paths, orphan.Fork)
+		}
+		for _, id := range orphan.Environments {
+			worktree := filepath.Join(basePath, "worktrees", id)
+			if worktreeFork(worktree) == orphan.Fork {
+				orphan.Paths = append(orphan.Paths, worktree)
+			}
+			if !liveEnvironments[id] {
+				orphan.Paths = append(orphan.Paths, filepath.Join(basePath, "events", id+".ndjson"))
+			}
+		}
+		hash := fmt.Sprintf("%x", hashString(orphan.Fork))
+		orphan.Paths = append(orphan.Paths,
+			filepath.Join(basePath, "queue", hash),
+			filepath.Join(basePath, "approvals", hash),
+			filepath.Join(basePath, "budgets", hash),
+			filepath.Join(basePath, "audit", hash+".ndjson"),
+			filepath.Join(basePath, "trust", hash+".json"),
+		)
+		orphan.Paths = slices.DeleteFunc(orphan.Paths, func(path string) bool {
+			_, err := os.Lstat(path)
+			return err != nil
+		})
+		for _, path := range orphan.Paths {
+			orphan.Size += diskUsage(path)
+		}
+	}
+	return report, nil
+}
+
+// PurgeOrphan deletes the fork and the environment state of an orphan.
+func PurgeOrphan(orphan *Orphan) error {
+	var errs []error
+	for _, path := range orphan.Paths {
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findForks returns the bare repositories under dir. Forks are nested after their origin, e.g.
+// repos/github.com/dagger/container-use.
+func findForks(dir string) ([]string, error) {
+	var forks []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if isBareRepository(path) {
+			forks = append(forks, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return forks, err
+}
+
+func isBareRepository(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// forkEnvironments returns the environments of a fork, i.e. its branches.
+func forkEnvironments(ctx context.Context, forkPath string) ([]string, error) {
+	output, err := RunGitCommand(ctx, forkPath, "for-each-ref", "--format=%(refname:short)", "refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	environments := []string{}
+	for line := range strings.Lines(output) {
+		if id := strings.TrimSpace(line); id != "" {
+			environments = append(environments, id)
+		}
+	}
+	return environments, nil
+}
+
+// findStrayWorktrees returns the worktrees whose fork no longer exists, by fork.
+func findStrayWorktrees(dir string) (map[string][]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	strays := map[string][]string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		fork := worktreeFork(filepath.Join(dir, entry.Name()))
+		if fork == "" {
+			continue
+		}
+		if _, err := os.Stat(fork); errors.Is(err, fs.ErrNotExist) {
+			strays[fork] = append(strays[fork], entry.Name())
+		}
+	}
+	return strays, nil
+}
+
+// worktreeFork returns the repository a worktree belongs to, from its .git file pointing at
+// <fork>/worktrees/<name>.
+func worktreeFork(worktree string) string {
+	content, err := os.ReadFile(filepath.Join(worktree, ".git"))
+	if err != nil {
+		return ""
+	}
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+	if !ok {
+		return ""
+	}
+	return filepath.Dir(filepath.Dir(filepath.Clean(gitdir)))
+}
+
+func diskUsage(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
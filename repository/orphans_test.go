@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindOrphans(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	setGitIdentity(t)
+	// openWithEnvironment opens a new user repository with an environment, its worktree and its events.
+	openWithEnvironment := func(id string) *Repository {
+		userRepo := t.TempDir()
+		runGit(t, userRepo, "init", "-b", "main")
+		runGit(t, userRepo, "commit", "--allow-empty", "-m", "init")
+		repo, err := OpenWithBasePath(ctx, userRepo, basePath)
+		require.NoError(t, err)
+		seedEnvironment(t, repo, id, "main", nil)
+		worktree, err := repo.WorktreePath(id)
+		require.NoError(t, err)
+		runGit(t, repo.forkRepoPath, "worktree", "add", worktree, id)
+		repo.recordEvent(id, "created", nil)
+		return repo
+	}
+
+	deleted := openWithEnvironment("fancy-mallard")
+	kept := openWithEnvironment("adaptive-koala")
+	// The same environment ID in two forks.
+	runGit(t, kept.userRepoPath, "push", containerUseRemote, "main:fancy-mallard")
+
+	report, err := FindOrphans(ctx, basePath)
+	require.NoError(t, err)
+	assert.Empty(t, report.Orphans)
+	assert.Empty(t, report.Unknown)
+
+	require.NoError(t, os.RemoveAll(deleted.userRepoPath))
+	report, err = FindOrphans(ctx, basePath)
+	require.NoError(t, err)
+	require.Len(t, report.Orphans, 1)
+	orphan := report.Orphans[0]
+	assert.Equal(t, deleted.forkRepoPath, orphan.Fork)
+	assert.Equal(t, []string{deleted.userRepoPath}, orphan.Sources)
+	assert.Equal(t, []string{"fancy-mallard"}, orphan.Environments)
+	assert.Equal(t, []string{deleted.forkRepoPath, filepath.Join(basePath, "worktrees", "fancy-mallard")}, orphan.Paths,
+		"the events of fancy-mallard are kept, as another fork has an environment of the same name")
+	assert.Positive(t, report.Size())
+
+	require.NoError(t, PurgeOrphan(orphan))
+	assert.NoDirExists(t, deleted.forkRepoPath)
+	assert.FileExists(t, kept.eventLogPath("fancy-mallard"))
+	assert.DirExists(t, kept.forkRepoPath)
+	report, err = FindOrphans(ctx, basePath)
+	require.NoError(t, err)
+	assert.Empty(t, report.Orphans)
+
+	// Forks used by an older version don't record their repositories yet.
+	runGit(t, kept.forkRepoPath, "config", "--unset-all", forkSourcesConfig)
+	report, err = FindOrphans(ctx, basePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{kept.forkRepoPath}, report.Unknown)
+	_, err = OpenWithBasePath(ctx, kept.userRepoPath, basePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{kept.userRepoPath}, forkSources(ctx, kept.forkRepoPath))
+
+	// Worktrees left behind by a fork deleted by hand.
+	require.NoError(t, os.RemoveAll(kept.forkRepoPath))
+	report, err = FindOrphans(ctx, basePath)
+	require.NoError(t, err)
+	require.Len(t, report.Orphans, 1)
+	assert.Equal(t, kept.forkRepoPath, report.Orphans[0].Fork)
+	assert.Equal(t, []string{"adaptive-koala"}, report.Orphans[0].Environments)
+	assert.Contains(t, report.Orphans[0].Paths, filepath.Join(basePath, "worktrees", "adaptive-koala"))
+	assert.Contains(t, report.Orphans[0].Paths, kept.eventLogPath("adaptive-koala"))
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// planImageTimeout caps resolving the base image of a plan with its registry.
+const planImageTimeout = 10 * time.Second
+
+// resolveImage resolves base images with their registry, replaced in tests.
+var resolveImage = environment.ResolveImage
+
+// CreatePlan is what creating an environment would do, resolved without the container runtime.
+type CreatePlan struct {
+	// ID is the ID the environment would get. Generated IDs with random parts are drawn again on creation,
+	// unless requested with --id.
+	ID          string `json:"id"`
+	IDGenerated bool   `json:"id_generated"`
+	// Branch is the branch the environment's work would be pushed to.
+	Branch   string   `json:"branch"`
+	Title    string   `json:"title"`
+	Labels   []string `json:"labels"`
+	Template string   `json:"template,omitempty"`
+	// Source is the ref the environment would be created from and its commit, fetched from a remote if needed.
+	Source       *environment.Source       `json:"source"`
+	Dependencies []*environment.Dependency `json:"dependencies,omitempty"`
+	Image        *ImagePlan                `json:"image"`
+	// SetupCommands and InstallCommands are run, in order, on the base image.
+	SetupCommands   []string `json:"setup_commands"`
+	InstallCommands []string `json:"install_commands"`
+	// Config is the configuration the environment would have.
+	Config *environment.EnvironmentConfig `json:"config"`
+	// Warnings are what creating the environment would warn about, such as low host resources.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ImagePlan is the base container of a plan: a base image to pull, or a Containerfile to build.
+type ImagePlan struct {
+	Image string                       `json:"image,omitempty"`
+	Build *environment.BaseBuildConfig `json:"build,omitempty"`
+	// Digest and Layers are the image's, when its registry could be asked anonymously.
+	Digest string                   `json:"digest,omitempty"`
+	Layers []environment.ImageLayer `json:"layers,omitempty"`
+	// PullBytes is the size of the layers, what pulling the image downloads when the engine has none cached.
+	PullBytes int64 `json:"pull_bytes,omitempty"`
+	// EstimatedPullMS is how long pulling the image is expected to take, from the pulls of previous creations.
+	EstimatedPullMS int64 `json:"estimated_pull_ms,omitempty"`
+}
+
+// Plan resolves what CreateWithID would do with the same context and arguments, without creating anything:
+// the configuration, source commit, ID, base image and setup commands. It fails like CreateWithID would
+// before the container is built, such as on an unknown ref, a taken ID or an exceeded quota. Refs missing
+// locally are fetched from their remote, as on creation.
+func (r *Repository) Plan(ctx context.Context, requestedID, description, gitRef string) (*CreatePlan, error) {
+	if gitRef == "" {
+		gitRef = "HEAD"
+	}
+	config, err := r.createConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dependencies := dependenciesFromContext(ctx)
+	if err := r.checkDependencies(ctx, dependencies); err != nil {
+		return nil, err
+	}
+	warnings, err := r.CheckHostResources()
+	if err != nil {
+		return nil, err
+	}
+	source, err := r.resolveSource(ctx, gitRef)
+	if err != nil {
+		return nil, err
+	}
+	labels := labelsFromContext(ctx)
+	if !config.Quota.IsZero() {
+		if err := r.checkQuota(ctx, config.Quota, labels, agentFromContext(ctx)); err != nil {
+			return nil, err
+		}
+	}
+	id, err := r.planID(ctx, requestedID, config.Naming)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CreatePlan{
+		ID:              id,
+		IDGenerated:     requestedID == "",
+		Branch:          containerUseRemote + "/" + id,
+		Title:           description,
+		Labels:          labels,
+		Template:        templateFromContext(ctx),
+		Source:          source,
+		Dependencies:    dependencies,
+		Image:           r.planImage(ctx, config),
+		SetupCommands:   config.SetupCommands,
+		InstallCommands: config.InstallCommands,
+		Config:          config,
+		Warnings:        warnings,
+	}
+	if plan.Labels == nil {
+		plan.Labels = []string{}
+	}
+	if plan.SetupCommands == nil {
+		plan.SetupCommands = []string{}
+	}
+	if plan.InstallCommands == nil {
+		plan.InstallCommands = []string{}
+	}
+	if plan.Image.Build == nil && plan.Image.Layers == nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("the registry of %s couldn't be asked for its digest and size", plan.Image.Image))
+	}
+	return plan, nil
+}
+
+// planID returns the ID an environment would get, like claimID without claiming it. The leftovers of an
+// interrupted creation of the requested ID are left alone: creating the environment cleans them up.
+func (r *Repository) planID(ctx context.Context, requestedID string, naming *environment.NamingConfig) (string, error) {
+	if requestedID == "" {
+		return r.generateID(ctx, naming)
+	}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "check-ref-format", "--branch", requestedID); err != nil {
+		return "", fmt.Errorf("invalid environment ID %q: it must be a valid git branch name", requestedID)
+	}
+	if !r.idAvailable(ctx, requestedID) && !r.isPartialCreate(ctx, requestedID) {
+		return "", fmt.Errorf("%w: %s", ErrEnvironmentExists, requestedID)
+	}
+	return requestedID, nil
+}
+
+// planImage resolves the base image of config with its registry. Registries that can't be asked anonymously
+// leave the digest and layers unset: the engine may still pull the image with credentials.
+func (r *Repository) planImage(ctx context.Context, config *environment.EnvironmentConfig) *ImagePlan {
+	if config.BaseBuild != nil {
+		return &ImagePlan{Build: config.BaseBuild}
+	}
+	plan := &ImagePlan{Image: config.BaseImage}
+	lookupCtx, cancel := context.WithTimeout(ctx, planImageTimeout)
+	defer cancel()
+	if resolved, err := resolveImage(lookupCtx, config.BaseImage); err == nil {
+		plan.Digest = resolved.Digest
+		plan.Layers = resolved.Layers
+		plan.PullBytes = resolved.Size()
+	}
+	if estimate, ok := r.estimatePull(config.BaseImageDescription(), plan.PullBytes); ok {
+		plan.EstimatedPullMS = estimate.Milliseconds()
+	}
+	return plan
+}
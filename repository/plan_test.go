@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	head := runGit(t, repo.userRepoPath, "rev-parse", "HEAD")
+
+	diskSpace = func(string) (uint64, string, error) { return 100e9, "root", nil }
+	availableMemory = func() (uint64, bool) { return 8e9, true }
+	resolveImage = func(_ context.Context, image string) (*environment.ResolvedImage, error) {
+		if image != "golang:1.24" {
+			return nil, errors.New("401 Unauthorized")
+		}
+		return &environment.ResolvedImage{Digest: "sha256:index", Layers: []environment.ImageLayer{{Digest: "sha256:a", Size: 30e6}, {Digest: "sha256:b", Size: 12e6}}}, nil
+	}
+	t.Cleanup(func() {
+		diskSpace = freeDiskSpace
+		availableMemory = readAvailableMemory
+		resolveImage = environment.ResolveImage
+	})
+
+	config := environment.DefaultConfig()
+	config.BaseImage = "golang:1.24"
+	config.SetupCommands = []string{"go mod download"}
+	config.Naming = &environment.NamingConfig{Style: environment.NamingStyleSequential, Prefix: "task-"}
+	ctx = WithConfig(ctx, config)
+
+	plan, err := repo.Plan(WithLabels(ctx, []string{"backend"}), "", "Fix the login redirect", "")
+	require.NoError(t, err)
+	assert.Equal(t, "task-0001", plan.ID)
+	assert.True(t, plan.IDGenerated)
+	assert.Equal(t, "container-use/task-0001", plan.Branch)
+	assert.Equal(t, []string{"backend"}, plan.Labels)
+	assert.Equal(t, head, plan.Source.Commit)
+	assert.Equal(t, "sha256:index", plan.Image.Digest)
+	assert.EqualValues(t, 42e6, plan.Image.PullBytes)
+	assert.Equal(t, []string{"go mod download"}, plan.SetupCommands)
+	assert.Empty(t, plan.Warnings)
+
+	_, err = repo.Plan(ctx, "", "Fix the login redirect", "missing-branch")
+	assert.ErrorContains(t, err, "unknown ref missing-branch")
+	_, err = repo.Plan(ctx, "not a branch", "Fix the login redirect", "")
+	assert.ErrorContains(t, err, "invalid environment ID")
+
+	// Images whose registry requires credentials are still planned, without their digest and size.
+	config.BaseImage = "registry.example.com/private/image:1"
+	plan, err = repo.Plan(ctx, "fix-login", "Fix the login redirect", "")
+	require.NoError(t, err)
+	assert.Equal(t, "fix-login", plan.ID)
+	assert.False(t, plan.IDGenerated)
+	assert.Empty(t, plan.Image.Digest)
+	assert.Contains(t, plan.Warnings, "the registry of registry.example.com/private/image:1 couldn't be asked for its digest and size")
+
+	config.BaseBuild = &environment.BaseBuildConfig{Containerfile: "Dockerfile"}
+	plan, err = repo.Plan(ctx, "", "Fix the login redirect", "")
+	require.NoError(t, err)
+	assert.Equal(t, config.BaseBuild, plan.Image.Build)
+	assert.Empty(t, plan.Warnings)
+
+	// Resource limits of the options replace those of the configuration.
+	config.Resources = &environment.ResourceLimits{CPUs: 2, Memory: 4 << 30}
+	plan, err = repo.Plan(WithResourceLimits(ctx, &environment.ResourceLimits{Memory: 1 << 30, Disk: 10 << 30}), "", "Fix the login redirect", "")
+	require.NoError(t, err)
+	assert.Equal(t, &environment.ResourceLimits{CPUs: 2, Memory: 1 << 30, Disk: 10 << 30}, plan.Config.Resources)
+	assert.Equal(t, &environment.ResourceLimits{CPUs: 2, Memory: 4 << 30}, config.Resources, "the configuration is left unchanged")
+	_, err = repo.Plan(WithResourceLimits(ctx, &environment.ResourceLimits{Memory: 1000}), "", "Fix the login redirect", "")
+	assert.ErrorContains(t, err, "the memory limit must be at least 1MiB")
+
+	envs, err := repo.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, envs, "planning creates nothing")
+}
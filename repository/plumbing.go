@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// NotesRefs maps the short names of the git notes refs used by container-use to their ref names.
+var NotesRefs = map[string]string{
+	"log":   gitNotesLogRef,
+	"state": gitNotesStateRef,
+	"tests": gitNotesTestsRef,
+}
+
+// StateRefs lists the raw git objects and paths backing an environment.
+type StateRefs struct {
+	Environment string            `json:"environment"`
+	Head        string            `json:"head"`
+	Branch      string            `json:"branch"`
+	RemoteRef   string            `json:"remote_ref"`
+	ForkRepo    string            `json:"fork_repo"`
+	Worktree    string            `json:"worktree"`
+	Notes       map[string]string `json:"notes"`
+}
+
+// StateRefs returns the refs and paths backing the environment.
+func (r *Repository) StateRefs(ctx context.Context, id string) (*StateRefs, error) {
+	if err := r.exists(ctx, id); err != nil {
+		return nil, err
+	}
+	head, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", id)
+	if err != nil {
+		return nil, err
+	}
+	worktree, err := r.WorktreePath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make(map[string]string, len(NotesRefs))
+	for _, ref := range NotesRefs {
+		notes["refs/notes/"+ref] = ""
+		if out, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", ref, "list", id); err == nil {
+			// "git notes list <object>" prints the note blob for the object, if any
+			notes["refs/notes/"+ref] = strings.TrimSpace(out)
+		}
+	}
+
+	return &StateRefs{
+		Environment: id,
+		Head:        strings.TrimSpace(head),
+		Branch:      "refs/heads/" + id,
+		RemoteRef:   fmt.Sprintf("refs/remotes/%s/%s", containerUseRemote, id),
+		ForkRepo:    r.forkRepoPath,
+		Worktree:    worktree,
+		Notes:       notes,
+	}, nil
+}
+
+// Note returns the raw contents of a notes ref (see NotesRefs) attached to the environment's head
+// or, if rev is set, to the given revision of the environment's history.
+func (r *Repository) Note(ctx context.Context, id, ref, rev string) (string, error) {
+	if err := r.exists(ctx, id); err != nil {
+		return "", err
+	}
+	if rev == "" {
+		rev = id
+	}
+
+	var note string
+	err := r.lockManager.WithRLock(ctx, LockTypeNotes, func() error {
+		out, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", ref, "show", rev)
+		if err != nil {
+			if strings.Contains(err.Error(), "no note found") {
+				return nil
+			}
+			return err
+		}
+		note = out
+		return nil
+	})
+	return note, err
+}
+
+// RawState returns the environment's state exactly as stored in git notes.
+func (r *Repository) RawState(ctx context.Context, id string) ([]byte, error) {
+	note, err := r.Note(ctx, id, gitNotesStateRef, "")
+	if err != nil {
+		return nil, err
+	}
+	if note == "" {
+		return nil, fmt.Errorf("environment %q has no state", id)
+	}
+	return []byte(note), nil
+}
+
+// SetRawState replaces the environment's state. The state is validated before it's written.
+func (r *Repository) SetRawState(ctx context.Context, id string, data []byte) error {
+	if err := r.exists(ctx, id); err != nil {
+		return err
+	}
+	state := &environment.State{}
+	if err := state.Unmarshal(data); err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+	if state.Config == nil {
+		return fmt.Errorf("invalid state: missing config")
+	}
+
+	// Normalize the state, so it's stored exactly as if container-use wrote it.
+	normalized, err := state.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := r.writeStateNote(ctx, id, normalized); err != nil {
+		return err
+	}
+	r.index(id, state, "")
+	if err := r.propagateGitNotes(ctx, gitNotesStateRef); err != nil {
+		return err
+	}
+	r.pushMetadata(ctx, id, false)
+	return nil
+}
+
+// writeStateNote attaches the state to the head of the environment's branch.
+func (r *Repository) writeStateNote(ctx context.Context, id string, state []byte) error {
+	f, err := os.CreateTemp(os.TempDir(), ".container-use-git-notes-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(state); err != nil {
+		return err
+	}
+
+	return r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
+		_, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", gitNotesStateRef, "add", "-f", "-F", f.Name(), id)
+		return err
+	})
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawState(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	seedEnvironment(t, repo, "test-env", "HEAD", nil)
+	head := runGit(t, repo.userRepoPath, "rev-parse", "HEAD")
+
+	_, err := repo.RawState(ctx, "test-env")
+	assert.Error(t, err, "environment has no state yet")
+
+	state := &environment.State{Title: "Original", Config: environment.DefaultConfig()}
+	data, err := state.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, repo.SetRawState(ctx, "test-env", data))
+
+	raw, err := repo.RawState(ctx, "test-env")
+	require.NoError(t, err)
+	loaded := &environment.State{}
+	require.NoError(t, json.Unmarshal(raw, loaded))
+	assert.Equal(t, "Original", loaded.Title)
+
+	assert.Error(t, repo.SetRawState(ctx, "test-env", []byte(`{"title": 42}`)), "invalid state is rejected")
+	assert.Error(t, repo.SetRawState(ctx, "test-env", []byte(`{"title": "No config"}`)), "state without config is rejected")
+
+	refs, err := repo.StateRefs(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Equal(t, head, refs.Head)
+	assert.Equal(t, "refs/heads/test-env", refs.Branch)
+	assert.NotEmpty(t, refs.Notes["refs/notes/"+gitNotesStateRef])
+	assert.Empty(t, refs.Notes["refs/notes/"+gitNotesLogRef])
+
+	// The state is propagated to the user's repository.
+	note, err := RunGitCommand(ctx, repo.userRepoPath, "notes", "--ref", gitNotesStateRef, "show", head)
+	require.NoError(t, err)
+	assert.Contains(t, note, "Original")
+}
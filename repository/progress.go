@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// ProgressCommitted reports that an environment's changes were committed and synced to the repository.
+const ProgressCommitted = "committed"
+
+type progressKey struct{}
+
+// WithProgress returns a context reporting the progress of long-running operations to fn:
+// the environment build steps, the environment's lifecycle events and ProgressCommitted.
+func WithProgress(ctx context.Context, fn environment.EventFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progressFromContext(ctx context.Context) environment.EventFunc {
+	fn, _ := ctx.Value(progressKey{}).(environment.EventFunc)
+	return fn
+}
+
+func reportProgress(ctx context.Context, eventType string, data map[string]any) {
+	if fn := progressFromContext(ctx); fn != nil {
+		fn(eventType, data)
+	}
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// InstallCommand is a command that installed tools in an environment, found in its history.
+type InstallCommand struct {
+	Command string `json:"command"`
+	// Install is set when the command installs from the source, e.g. `pip install -r requirements.txt`,
+	// and so belongs with the install commands rather than the setup commands.
+	Install bool `json:"install"`
+}
+
+// installers maps package managers to the subcommands installing packages.
+var installers = map[string][]string{
+	"apt-get":  {"install"},
+	"apt":      {"install"},
+	"yum":      {"install"},
+	"dnf":      {"install"},
+	"microdnf": {"install"},
+	"apk":      {"add"},
+	"pip":      {"install"},
+	"pip3":     {"install"},
+	"pipx":     {"install"},
+	"npm":      {"install", "i"},
+	"pnpm":     {"add"},
+	"cargo":    {"install"},
+	"go":       {"install"},
+	"gem":      {"install"},
+	"brew":     {"install"},
+}
+
+// projectInstallers are the package managers whose plain installs are local to the project,
+// and only install tools with a global flag.
+var projectInstallers = []string{"npm", "pnpm"}
+
+// sourceFlags are the flags installing from files of the source, such as requirements files.
+var sourceFlags = []string{"-r", "-e", "--requirement", "--editable"}
+
+// InstallCommands returns the commands that successfully installed tools in the environment,
+// such as `apt-get install -y jq`, from its event log and in the order they ran.
+func (r *Repository) InstallCommands(id string) ([]*InstallCommand, error) {
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := []*InstallCommand{}
+	for _, event := range events {
+		if event.Type != environment.EventExecFinished {
+			continue
+		}
+		command, _ := event.Data["command"].(string)
+		if exitCode, ok := event.Data["exit_code"].(float64); !ok || exitCode != 0 {
+			continue
+		}
+		isInstall, fromSource := classifyInstall(command)
+		if !isInstall || slices.ContainsFunc(commands, func(c *InstallCommand) bool { return c.Command == command }) {
+			continue
+		}
+		commands = append(commands, &InstallCommand{Command: command, Install: fromSource})
+	}
+	return commands, nil
+}
+
+// classifyInstall reports whether a shell command installs packages, and whether it installs them
+// from the source rather than from a registry.
+func classifyInstall(command string) (isInstall, fromSource bool) {
+	segments := strings.FieldsFunc(command, func(r rune) bool { return r == ';' || r == '&' || r == '|' || r == '\n' })
+	for _, segment := range segments {
+		args := strings.Fields(segment)
+		// Skip sudo and environment assignments such as DEBIAN_FRONTEND=noninteractive.
+		for len(args) > 0 && (args[0] == "sudo" || strings.Contains(args[0], "=")) {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
+		tool := path.Base(args[0])
+		args = args[1:]
+		// python -m pip install ...
+		if strings.HasPrefix(tool, "python") && len(args) >= 2 && args[0] == "-m" {
+			tool, args = args[1], args[2:]
+		}
+		// uv pip install ...
+		if tool == "uv" && len(args) > 0 && args[0] == "pip" {
+			tool, args = "pip", args[1:]
+		}
+		// yarn global add ...
+		if tool == "yarn" && len(args) > 0 && args[0] == "global" {
+			tool, args = "pnpm", append(args[1:], "--global")
+		}
+
+		subcommands, ok := installers[tool]
+		if !ok {
+			continue
+		}
+		var operands, flags []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				flags = append(flags, arg)
+			} else {
+				operands = append(operands, arg)
+			}
+		}
+		if len(operands) == 0 || !slices.Contains(subcommands, operands[0]) {
+			continue
+		}
+		if slices.Contains(projectInstallers, tool) && !slices.Contains(flags, "-g") && !slices.Contains(flags, "--global") {
+			continue
+		}
+
+		isInstall = true
+		if slices.ContainsFunc(flags, func(flag string) bool { return slices.Contains(sourceFlags, flag) }) ||
+			slices.ContainsFunc(operands[1:], func(operand string) bool { return operand == "." || strings.HasPrefix(operand, "./") }) {
+			fromSource = true
+		}
+	}
+	return isInstall, fromSource
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyInstall(t *testing.T) {
+	tests := []struct {
+		command    string
+		isInstall  bool
+		fromSource bool
+	}{
+		{"apt-get install -y jq", true, false},
+		{"apt-get update && DEBIAN_FRONTEND=noninteractive sudo apt-get install -y ripgrep", true, false},
+		{"apk add --no-cache curl", true, false},
+		{"pip install ruff", true, false},
+		{"python3 -m pip install --user black", true, false},
+		{"uv pip install mypy", true, false},
+		{"pip install -r requirements.txt", true, true},
+		{"pip install -e .", true, true},
+		{"npm install -g typescript", true, false},
+		{"yarn global add prettier", true, false},
+		{"go install golang.org/x/tools/gopls@latest", true, false},
+		{"go install ./cmd/...", true, true},
+		{"/usr/local/bin/cargo install ripgrep", true, false},
+		{"npm install", false, false},
+		{"npm i lodash", false, false},
+		{"apt-get update", false, false},
+		{"go test ./...", false, false},
+		{"echo pip install ruff", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			isInstall, fromSource := classifyInstall(tt.command)
+			assert.Equal(t, tt.isInstall, isInstall)
+			assert.Equal(t, tt.fromSource, fromSource)
+		})
+	}
+}
+
+func TestInstallCommands(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+
+	commands, err := repo.InstallCommands("test-env")
+	require.NoError(t, err)
+	assert.Empty(t, commands)
+
+	finished := func(command string, exitCode int) {
+		repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": command})
+		repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": command, "exit_code": exitCode})
+	}
+	finished("apt-get install -y jq", 0)
+	finished("pip install ruff", 1)
+	finished("go test ./...", 0)
+	finished("pip install -r requirements.txt", 0)
+	finished("apt-get install -y jq", 0)
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "apk add curl", "error": "engine failure"})
+
+	commands, err = repo.InstallCommands("test-env")
+	require.NoError(t, err)
+	assert.Equal(t, []*InstallCommand{
+		{Command: "apt-get install -y jq"},
+		{Command: "pip install -r requirements.txt", Install: true},
+	}, commands)
+}
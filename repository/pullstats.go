@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+const (
+	// maxPullSamples is the number of pulls remembered per image.
+	maxPullSamples = 10
+	// minRecordedPull is the shortest pull remembered: faster pulls were served from the engine's cache.
+	minRecordedPull = time.Second
+)
+
+// PullSample is a pull of a base image that wasn't cached by the engine.
+type PullSample struct {
+	Time       time.Time `json:"time"`
+	DurationMS int64     `json:"duration_ms"`
+	// Bytes is the size of the image's layers, when its registry listed them.
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+func (r *Repository) pullStatsPath() string {
+	return filepath.Join(r.basePath, "pull-stats.json")
+}
+
+// pullStats returns the pulls remembered for each base image, oldest first.
+func (r *Repository) pullStats() map[string][]PullSample {
+	stats := map[string][]PullSample{}
+	data, err := os.ReadFile(r.pullStatsPath())
+	if err != nil {
+		return stats
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		slog.Warn("Ignoring invalid pull stats", "err", err)
+		return map[string][]PullSample{}
+	}
+	return stats
+}
+
+// recordPull remembers a pull of image. Failures are only logged: stats must never fail a creation.
+func (r *Repository) recordPull(image string, duration time.Duration, bytes int64) {
+	if duration < minRecordedPull {
+		return
+	}
+	stats := r.pullStats()
+	samples := append(stats[image], PullSample{Time: time.Now().UTC(), DurationMS: duration.Milliseconds(), Bytes: bytes})
+	if len(samples) > maxPullSamples {
+		samples = samples[len(samples)-maxPullSamples:]
+	}
+	stats[image] = samples
+
+	data, err := json.Marshal(stats)
+	if err == nil {
+		err = os.MkdirAll(r.basePath, 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(r.pullStatsPath(), data, 0644)
+	}
+	if err != nil {
+		slog.Warn("Failed to record pull stats", "image", image, "err", err)
+	}
+}
+
+// UsualPullDuration returns how long pulls of image usually take (the median of the remembered pulls),
+// and the number of pulls it's based on.
+func (r *Repository) UsualPullDuration(image string) (time.Duration, int) {
+	samples := r.pullStats()[image]
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	durations := make([]int64, 0, len(samples))
+	for _, sample := range samples {
+		durations = append(durations, sample.DurationMS)
+	}
+	return time.Duration(median(durations)) * time.Millisecond, len(samples)
+}
+
+// estimatePull returns how long pulling image is expected to take: as long as it usually does, or
+// else as long as its bytes take at the usual throughput of other images' pulls.
+func (r *Repository) estimatePull(image string, bytes int64) (time.Duration, bool) {
+	if usual, n := r.UsualPullDuration(image); n > 0 {
+		return usual, true
+	}
+	if bytes <= 0 {
+		return 0, false
+	}
+	var throughputs []int64 // bytes per second
+	for _, samples := range r.pullStats() {
+		for _, sample := range samples {
+			if sample.Bytes > 0 && sample.DurationMS > 0 {
+				throughputs = append(throughputs, sample.Bytes*1000/sample.DurationMS)
+			}
+		}
+	}
+	if len(throughputs) == 0 {
+		return 0, false
+	}
+	throughput := median(throughputs)
+	if throughput <= 0 {
+		return 0, false
+	}
+	return time.Duration(bytes * int64(time.Second) / throughput), true
+}
+
+func median(values []int64) int64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// observePulls returns an event listener remembering the pulls of base images and adding the expected
+// duration to their progress events (estimated_ms, eta_ms and usual_ms) before forwarding events to
+// forward, if any.
+func (r *Repository) observePulls(forward environment.EventFunc) environment.EventFunc {
+	var estimate time.Duration
+	var estimated bool
+	return func(eventType string, data map[string]any) {
+		image, _ := data["image"].(string)
+		switch eventType {
+		case environment.EventImagePullStarted:
+			bytes, _ := data["total_bytes"].(int64)
+			if estimate, estimated = r.estimatePull(image, bytes); estimated {
+				data["estimated_ms"] = estimate.Milliseconds()
+			}
+		case environment.EventImagePullProgress:
+			if elapsed, ok := data["elapsed_ms"].(int64); ok && estimated {
+				data["eta_ms"] = max(estimate.Milliseconds()-elapsed, 0)
+			}
+		case environment.EventImagePulled:
+			if usual, n := r.UsualPullDuration(image); n > 0 {
+				data["usual_ms"] = usual.Milliseconds()
+			}
+			duration, _ := data["duration_ms"].(int64)
+			bytes, _ := data["total_bytes"].(int64)
+			r.recordPull(image, time.Duration(duration)*time.Millisecond, bytes)
+		}
+		if forward != nil {
+			forward(eventType, data)
+		}
+	}
+}
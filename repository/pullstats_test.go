@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullStats(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+
+	_, ok := repo.estimatePull("alpine:3", 10<<20)
+	assert.False(t, ok, "nothing to estimate from")
+
+	repo.recordPull("alpine:3", 200*time.Millisecond, 4<<20)
+	_, n := repo.UsualPullDuration("alpine:3")
+	assert.Zero(t, n, "cached pulls aren't remembered")
+
+	repo.recordPull("alpine:3", 4*time.Second, 4<<20)
+	repo.recordPull("alpine:3", 2*time.Second, 4<<20)
+	repo.recordPull("alpine:3", 30*time.Second, 4<<20)
+	usual, n := repo.UsualPullDuration("alpine:3")
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 4*time.Second, usual)
+
+	estimate, ok := repo.estimatePull("alpine:3", 0)
+	require.True(t, ok)
+	assert.Equal(t, 4*time.Second, estimate, "images pulled before take as long as usual")
+
+	// 4 MiB in 4s is the median throughput.
+	estimate, ok = repo.estimatePull("ubuntu:24.04", 8<<20)
+	require.True(t, ok)
+	assert.Equal(t, 8*time.Second, estimate, "other images take as long as their size at the usual throughput")
+
+	for range maxPullSamples {
+		repo.recordPull("alpine:3", 10*time.Second, 0)
+	}
+	assert.Len(t, repo.pullStats()["alpine:3"], maxPullSamples)
+}
+
+func TestObservePulls(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+	repo.recordPull("alpine:3", 10*time.Second, 0)
+
+	var forwarded []map[string]any
+	observe := repo.observePulls(func(eventType string, data map[string]any) {
+		forwarded = append(forwarded, data)
+	})
+
+	observe(environment.EventImagePullStarted, map[string]any{"image": "alpine:3"})
+	observe(environment.EventImagePullProgress, map[string]any{"image": "alpine:3", "elapsed_ms": int64(3000)})
+	observe(environment.EventImagePulled, map[string]any{"image": "alpine:3", "duration_ms": int64(20000)})
+
+	require.Len(t, forwarded, 3)
+	assert.Equal(t, int64(10000), forwarded[0]["estimated_ms"])
+	assert.Equal(t, int64(7000), forwarded[1]["eta_ms"])
+	assert.Equal(t, int64(10000), forwarded[2]["usual_ms"], "the usual duration doesn't include this pull")
+	assert.Len(t, repo.pullStats()["alpine:3"], 2)
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// lockTypeQuota serializes checking the quotas with claiming the ID of a new environment, so concurrent
+// creations can't all pass the check.
+const lockTypeQuota LockType = "quota"
+
+// ErrQuotaExceeded is returned when creating an environment would exceed a quota of the repository.
+var ErrQuotaExceeded = errors.New("environment quota exceeded")
+
+// QuotaUsage is how many environments count toward a quota.
+type QuotaUsage struct {
+	Used int `json:"used"`
+	// Max is unset when unlimited.
+	Max int `json:"max,omitempty"`
+}
+
+// Exceeded reports whether one more environment would exceed the quota.
+func (u QuotaUsage) Exceeded() bool {
+	return u.Max > 0 && u.Used >= u.Max
+}
+
+// QuotaStatus is the usage of the quotas of a repository.
+type QuotaStatus struct {
+	Environments QuotaUsage `json:"environments"`
+	// Labels and Agents are keyed by the labels and agents of the environments, and those with a quota.
+	Labels map[string]QuotaUsage `json:"labels,omitempty"`
+	Agents map[string]QuotaUsage `json:"agents,omitempty"`
+}
+
+// QuotaStatus returns the usage of the repository's quotas.
+func (r *Repository) QuotaStatus(ctx context.Context) (*QuotaStatus, error) {
+	config := environment.DefaultConfig()
+	if err := config.Load(r.userRepoPath); err != nil {
+		return nil, err
+	}
+	envs, creating, err := r.liveEnvironments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quotaStatus(config.Quota, envs, creating), nil
+}
+
+// liveEnvironments returns the environments of the repository, and the number of those still being created
+// that aren't listed yet.
+func (r *Repository) liveEnvironments(ctx context.Context) ([]*environment.EnvironmentInfo, int, error) {
+	envs, err := r.List(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list environments: %w", err)
+	}
+	branches, err := RunGitCommand(ctx, r.forkRepoPath, "branch", "--format", "%(refname:short)")
+	if err != nil {
+		return nil, 0, err
+	}
+	creating := 0
+	for _, branch := range strings.Fields(branches) {
+		if !slices.ContainsFunc(envs, func(env *environment.EnvironmentInfo) bool { return env.ID == branch }) && !r.CreationComplete(ctx, branch) {
+			creating++
+		}
+	}
+	return envs, creating, nil
+}
+
+// quotaStatus counts the environments toward the quotas. Environments being created only count toward the
+// repository's, their labels and agent aren't known yet.
+func quotaStatus(quota *environment.QuotaConfig, envs []*environment.EnvironmentInfo, creating int) *QuotaStatus {
+	if quota == nil {
+		quota = &environment.QuotaConfig{}
+	}
+	status := &QuotaStatus{
+		Environments: QuotaUsage{Used: len(envs) + creating, Max: quota.MaxEnvironments},
+		Labels:       map[string]QuotaUsage{},
+		Agents:       map[string]QuotaUsage{},
+	}
+	for label, limit := range quota.Labels {
+		status.Labels[label] = QuotaUsage{Max: limit}
+	}
+	for agent, limit := range quota.Agents {
+		status.Agents[agent] = QuotaUsage{Max: limit}
+	}
+	for _, env := range envs {
+		for _, label := range env.State.Labels {
+			usage := status.Labels[label]
+			usage.Used++
+			usage.Max = quota.LabelLimit(label)
+			status.Labels[label] = usage
+		}
+		if agent := env.State.Agent; agent != "" {
+			usage := status.Agents[agent]
+			usage.Used++
+			usage.Max = quota.AgentLimit(agent)
+			status.Agents[agent] = usage
+		}
+	}
+	if len(status.Labels) == 0 {
+		status.Labels = nil
+	}
+	if len(status.Agents) == 0 {
+		status.Agents = nil
+	}
+	return status
+}
+
+// checkQuota fails with ErrQuotaExceeded if an environment with labels, created by agent, would exceed a quota.
+func (r *Repository) checkQuota(ctx context.Context, quota *environment.QuotaConfig, labels []string, agent string) error {
+	envs, creating, err := r.liveEnvironments(ctx)
+	if err != nil {
+		return err
+	}
+	return exceededQuota(quota, envs, creating, labels, agent)
+}
+
+// exceededQuota returns the error of checkQuota from the live environments.
+func exceededQuota(quota *environment.QuotaConfig, envs []*environment.EnvironmentInfo, creating int, labels []string, agent string) error {
+	if quota.IsZero() {
+		return nil
+	}
+	status := quotaStatus(quota, envs, creating)
+	remedy := "delete environments with 'container-use delete' or 'container-use gc', or raise the quota with 'container-use config quota set'"
+	if usage := status.Environments; usage.Exceeded() {
+		return fmt.Errorf("%w: the repository has %d live environments, the maximum is %d (%s); %s",
+			ErrQuotaExceeded, usage.Used, usage.Max, oldestEnvironments(envs, nil), remedy)
+	}
+	for _, label := range labels {
+		usage := status.Labels[label]
+		usage.Max = quota.LabelLimit(label)
+		if usage.Exceeded() {
+			return fmt.Errorf("%w: %d environments are labeled %q, the maximum is %d (%s); %s",
+				ErrQuotaExceeded, usage.Used, label, usage.Max, oldestEnvironments(envs, func(env *environment.EnvironmentInfo) bool {
+					return slices.Contains(env.State.Labels, label)
+				}), remedy)
+		}
+	}
+	if agent != "" {
+		usage := status.Agents[agent]
+		usage.Max = quota.AgentLimit(agent)
+		if usage.Exceeded() {
+			return fmt.Errorf("%w: %s created %d environments, the maximum is %d (%s); %s",
+				ErrQuotaExceeded, agent, usage.Used, usage.Max, oldestEnvironments(envs, func(env *environment.EnvironmentInfo) bool {
+					return env.State.Agent == agent
+				}), remedy)
+		}
+	}
+	return nil
+}
+
+// oldestEnvironments describes the least recently updated environments matching filter, the first ones to
+// consider deleting.
+func oldestEnvironments(envs []*environment.EnvironmentInfo, filter func(*environment.EnvironmentInfo) bool) string {
+	const shown = 3
+	var matching []*environment.EnvironmentInfo
+	for _, env := range envs {
+		if filter == nil || filter(env) {
+			matching = append(matching, env)
+		}
+	}
+	if len(matching) == 0 {
+		return "some are still being created"
+	}
+	slices.SortFunc(matching, func(a, b *environment.EnvironmentInfo) int { return a.State.UpdatedAt.Compare(b.State.UpdatedAt) })
+	ids := make([]string, 0, shown)
+	for _, env := range matching[:min(shown, len(matching))] {
+		ids = append(ids, env.ID)
+	}
+	return "least recently updated: " + strings.Join(ids, ", ")
+}
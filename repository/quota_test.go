@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	now := time.Now()
+	envInfo := func(id, agent string, age time.Duration, labels ...string) *environment.EnvironmentInfo {
+		return &environment.EnvironmentInfo{ID: id, State: &environment.State{Agent: agent, Labels: labels, UpdatedAt: now.Add(-age)}}
+	}
+	envs := []*environment.EnvironmentInfo{
+		envInfo("fancy-mallard", "orchestrator", time.Minute, "experiment"),
+		envInfo("backend-api", "orchestrator", time.Hour, "experiment", "api"),
+		envInfo("docs", "", 2*time.Hour),
+	}
+	quota := &environment.QuotaConfig{
+		MaxEnvironments: 5,
+		Labels:          map[string]int{"experiment": 2, "release": 1},
+		MaxPerAgent:     3,
+	}
+
+	status := quotaStatus(quota, envs, 1)
+	assert.Equal(t, QuotaUsage{Used: 4, Max: 5}, status.Environments, "environments being created count toward the repository's quota")
+	assert.Equal(t, map[string]QuotaUsage{
+		"experiment": {Used: 2, Max: 2},
+		"api":        {Used: 1},
+		"release":    {Max: 1},
+	}, status.Labels)
+	assert.Equal(t, map[string]QuotaUsage{"orchestrator": {Used: 2, Max: 3}}, status.Agents)
+
+	assert.NoError(t, exceededQuota(quota, envs, 1, []string{"api", "release"}, "orchestrator"))
+	assert.NoError(t, exceededQuota(nil, envs, 100, nil, ""))
+
+	err := exceededQuota(quota, envs, 1, []string{"experiment"}, "")
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, `2 environments are labeled "experiment", the maximum is 2 (least recently updated: backend-api, fancy-mallard)`)
+
+	quota.Agents = map[string]int{"orchestrator": 2}
+	err = exceededQuota(quota, envs, 1, nil, "orchestrator")
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "orchestrator created 2 environments, the maximum is 2")
+	assert.NoError(t, exceededQuota(quota, envs, 1, nil, "cursor"))
+
+	err = exceededQuota(quota, envs, 2, nil, "")
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "the repository has 5 live environments, the maximum is 5 (least recently updated: docs, backend-api, fancy-mallard)")
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+)
+
+// RebuildBase rolls the base image configured in the repository out to an environment: the environment
+// is rebuilt on it, keeping the rest of its configuration and its files. Containerfile base images are
+// built from the repository's working tree, so uncommitted changes to the Containerfile are picked up.
+// The container state of the environment's previous commands is lost.
+func (r *Repository) RebuildBase(ctx context.Context, dag *dagger.Client, id string) (*environment.Environment, error) {
+	config := environment.DefaultConfig()
+	if err := config.Load(r.userRepoPath); err != nil {
+		return nil, err
+	}
+
+	env, err := r.Get(ctx, dag, id)
+	if err != nil {
+		return nil, err
+	}
+
+	newConfig := env.State.Config.Copy()
+	newConfig.BaseImage = config.BaseImage
+	newConfig.BaseBuild = config.Copy().BaseBuild
+	buildSource := dag.Host().Directory(r.userRepoPath, dagger.HostDirectoryOpts{
+		Exclude: []string{".git", "**/.git"},
+		NoCache: true,
+	})
+	if err := env.RebuildBase(ctx, newConfig, buildSource); err != nil {
+		return nil, fmt.Errorf("failed to rebuild %s on %s: %w", id, newConfig.BaseImageDescription(), err)
+	}
+
+	if err := r.Update(ctx, env, "Rebuild base image: "+newConfig.BaseImageDescription()); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
@@ -19,7 +19,6 @@ import (
 
 	"dagger.io/dagger"
 	"github.com/dagger/container-use/environment"
-	petname "github.com/dustinkirkland/golang-petname"
 	"github.com/mitchellh/go-homedir"
 	"golang.org/x/sync/errgroup"
 )
@@ -28,6 +27,10 @@ const (
 	containerUseRemote = "container-use"
 	gitNotesLogRef     = "container-use"
 	gitNotesStateRef   = "container-use-state"
+	gitNotesTestsRef   = "container-use-tests"
+	// sourceRemote is the fork's remote pointing back at the user repository,
+	// used to fetch limited history for shallow or partial environments.
+	sourceRemote = "source"
 )
 
 // getDefaultConfigPath returns the default configuration path for the current OS
@@ -57,11 +60,18 @@ var (
 	cuGlobalConfigPath = getDefaultConfigPath()
 )
 
+// DataDir returns the directory container-use keeps its data in: the forks of the repositories, their
+// worktrees and the logs.
+func DataDir() string {
+	return cuGlobalConfigPath
+}
+
 type Repository struct {
 	userRepoPath string
 	forkRepoPath string
 	basePath     string // defaults to OS-appropriate config path if empty
 	lockManager  *RepositoryLockManager
+	vcs          VCS
 }
 
 // getRepoPath returns the path for storing repository data
@@ -87,6 +97,9 @@ func OpenWithBasePath(ctx context.Context, repo string, basePath string) (*Repos
 		// If expansion fails, use the original path
 		expandedBasePath = basePath
 	}
+	if err := checkDataVersion(expandedBasePath); err != nil {
+		return nil, err
+	}
 
 	output, err := RunGitCommand(ctx, repo, "rev-parse", "--show-toplevel")
 	if err != nil {
@@ -117,6 +130,7 @@ func OpenWithBasePath(ctx context.Context, repo string, basePath string) (*Repos
 		forkRepoPath: forkRepoPath,
 		basePath:     expandedBasePath,
 		lockManager:  NewRepositoryLockManager(userRepoPath),
+		vcs:          detectVCS(ctx, userRepoPath),
 	}
 
 	if err := r.ensureFork(ctx); err != nil {
@@ -125,6 +139,12 @@ func OpenWithBasePath(ctx context.Context, repo string, basePath string) (*Repos
 	if err := r.ensureUserRemote(ctx); err != nil {
 		return nil, fmt.Errorf("unable to set container-use remote: %w", err)
 	}
+	if err := r.ensureMetadataRemote(ctx); err != nil {
+		return nil, fmt.Errorf("unable to set metadata repository: %w", err)
+	}
+	if err := r.ensureSourceRecorded(ctx); err != nil {
+		return nil, fmt.Errorf("unable to record the repository in its fork: %w", err)
+	}
 
 	return r, nil
 }
@@ -174,10 +194,13 @@ func (r *Repository) SourcePath() string {
 	return r.userRepoPath
 }
 
+// ErrEnvironmentNotFound is returned when an environment doesn't exist.
+var ErrEnvironmentNotFound = errors.New("environment not found")
+
 func (r *Repository) exists(ctx context.Context, id string) error {
 	if _, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", id); err != nil {
 		if strings.Contains(err.Error(), "Needed a single revision") {
-			return fmt.Errorf("environment %q not found", id)
+			return fmt.Errorf("%w: %s", ErrEnvironmentNotFound, id)
 		}
 		return err
 	}
@@ -188,18 +211,76 @@ func (r *Repository) exists(ctx context.Context, id string) error {
 // The git reference can be HEAD (default), a SHA, a branch name, or a tag.
 // Requires a dagger client for container operations during environment initialization.
 func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description, explanation, gitRef string) (*environment.Environment, error) {
+	return r.CreateWithID(ctx, dag, "", description, explanation, gitRef)
+}
+
+// CreateWithID creates a new environment like Create, with the given ID instead of a generated one if set.
+// The leftovers of an interrupted creation of the same ID are cleaned up first; an existing environment
+// with that ID fails with ErrEnvironmentExists.
+func (r *Repository) CreateWithID(ctx context.Context, dag *dagger.Client, requestedID, description, explanation, gitRef string) (_ *environment.Environment, rerr error) {
 	if gitRef == "" {
 		gitRef = "HEAD"
 	}
-	id := petname.Generate(2, "-")
-	worktree, submoduleWarning, err := r.initializeWorktree(ctx, id, gitRef)
+	config, err := r.createConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	templateName := templateFromContext(ctx)
+	// Dependencies on unknown environments fail before anything is created.
+	dependencies := dependenciesFromContext(ctx)
+	if err := r.checkDependencies(ctx, dependencies); err != nil {
+		return nil, err
+	}
+	resourceWarnings, err := r.CheckHostResources()
+	if err != nil {
+		return nil, err
+	}
+	// Refs missing locally are fetched from their remote, once: the environment is created from the same
+	// commit whatever happens to the ref in the meantime.
+	source, err := r.resolveSource(ctx, gitRef)
 	if err != nil {
 		return nil, err
 	}
 
+	// The quotas are checked and the ID claimed at once, the environment counting toward them from then on.
+	labels, agent := labelsFromContext(ctx), agentFromContext(ctx)
+	var id, worktree, submoduleWarning string
+	claim := func() (err error) {
+		id, worktree, submoduleWarning, err = r.claimID(ctx, requestedID, config, source.Commit)
+		return err
+	}
+	if config.Quota.IsZero() {
+		err = claim()
+	} else {
+		err = r.lockManager.WithIsolatedLock(ctx, lockTypeQuota, func() error {
+			if err := r.checkQuota(ctx, config.Quota, labels, agent); err != nil {
+				return err
+			}
+			return claim()
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Don't leave a branch and worktree behind that would collide with the next creation of the ID.
+	defer func() {
+		if rerr != nil {
+			r.cleanupPartialCreate(context.WithoutCancel(ctx), id)
+		}
+	}()
+
+	hostFiles, err := r.confirmHostFiles(ctx, id, config.HostFiles)
+	if err != nil {
+		return nil, err
+	}
+	config.HostFiles = hostFiles
+	if err := r.DisableUntrustedDockerCredentials(id, config); err != nil {
+		return nil, err
+	}
+
 	// Protect createInitialCommit to prevent concurrent writes to .git/worktrees/*/logs/HEAD
 	if err := r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
-		return r.createInitialCommit(ctx, worktree, id, description)
+		return r.createInitialCommit(ctx, worktree, id, description, config.GitIdentity)
 	}); err != nil {
 		return nil, fmt.Errorf("failed to create initial commit: %w", err)
 	}
@@ -213,6 +294,15 @@ func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description
 	var baseSourceDir *dagger.Directory
 	err = r.lockManager.WithRLock(ctx, LockTypeForkRepo, func() error {
 		var err error
+		if config.Clone.IsPartial() {
+			// A partial fork can't be read as a git repository by dagger since objects may be
+			// missing, so load the checked out worktree instead.
+			baseSourceDir, err = dag.
+				Host().
+				Directory(worktree, dagger.HostDirectoryOpts{NoCache: true, Exclude: []string{".git", "**/.git"}}).
+				Sync(ctx)
+			return err
+		}
 		baseSourceDir, err = dag.
 			Host().
 			Directory(r.forkRepoPath, dagger.HostDirectoryOpts{NoCache: true}). // bust cache for each Create call
@@ -227,38 +317,141 @@ func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description
 		return nil, fmt.Errorf("failed loading initial source directory: %w", err)
 	}
 
-	config := environment.DefaultConfig()
-	if err := config.Load(r.userRepoPath); err != nil {
-		return nil, err
-	}
-
 	// Detect submodules from the host worktree before creating the environment
 	submodulePaths := r.getSubmodulePaths(ctx, worktree)
 
+	// Clones start from the container of their source instead of building one.
+	clone := cloneSourceFromContext(ctx)
+	if clone == nil {
+		clone = &cloneSource{}
+	}
 	env, err := environment.New(ctx, environment.NewEnvArgs{
 		Dag:              dag,
 		ID:               id,
 		Title:            description,
+		Labels:           labels,
 		Config:           config,
 		InitialSourceDir: baseSourceDir,
 		SubmodulePaths:   submodulePaths,
+		OnEvent:          r.observePulls(progressFromContext(ctx)),
+		OnInputPrompt:    r.inputPrompt(ctx, id),
+		Container:        clone.container,
 	})
 	if err != nil {
 		return nil, err
 	}
+	env.State.Engine = engineFromContext(ctx)
+	env.State.Agent = agent
+	env.State.Template = templateName
+	env.State.Source = source
+	if len(dependencies) > 0 {
+		env.State.Dependencies = dependencies
+		if _, err := r.RefreshDependencies(ctx, dag, env, nil); err != nil {
+			return nil, err
+		}
+	}
 
 	// Add submodule warning to environment notes if initialization failed
 	if submoduleWarning != "" {
 		env.Notes.Add("Warning: %s", submoduleWarning)
 	}
+	for _, warning := range resourceWarnings {
+		env.Notes.Add("Warning: %s", warning)
+	}
+	if clone.id != "" {
+		env.Notes.Add("Cloned from environment %s", clone.id)
+	}
 
 	if err := r.propagateToWorktree(ctx, env, explanation); err != nil {
 		return nil, err
 	}
 
+	r.trackEvents(ctx, env)
+	created := map[string]any{"title": description, "labels": env.State.Labels, "from_ref": gitRef, "from_commit": source.Commit, "hardened": config.Hardened}
+	if clone.id != "" {
+		created["cloned_from"] = clone.id
+	}
+	r.recordEvent(id, EventCreated, created)
+
 	return env, nil
 }
 
+// createConfig resolves the configuration of a new environment: the repository's, or the context's, with the
+// settings of the context's template and options.
+func (r *Repository) createConfig(ctx context.Context) (*environment.EnvironmentConfig, error) {
+	config := environment.DefaultConfig()
+	if override := configFromContext(ctx); override != nil {
+		config = override.Copy()
+	} else if err := config.Load(r.userRepoPath); err != nil {
+		return nil, err
+	}
+	if templateName := templateFromContext(ctx); templateName != "" {
+		tmpl, err := environment.LoadEnvironmentTemplate(r.userRepoPath, templateName)
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.Apply(config); err != nil {
+			return nil, err
+		}
+	}
+	if identity := gitIdentityFromContext(ctx); identity != nil {
+		config.GitIdentity = identity
+	}
+	if hardenedFromContext(ctx) {
+		config.Hardened = true
+	}
+	if limits := resourceLimitsFromContext(ctx); limits != nil {
+		config.Resources = config.Resources.Merge(limits)
+		if err := config.Resources.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	vars := envVariablesFromContext(ctx)
+	for _, key := range vars.Keys() {
+		config.Env.Set(key, vars.Get(key))
+	}
+	return config, nil
+}
+
+// checkDependencies checks the environments whose outputs a new environment depends on exist.
+func (r *Repository) checkDependencies(ctx context.Context, dependencies []*environment.Dependency) error {
+	for _, dep := range dependencies {
+		if err := r.exists(ctx, dep.Environment); err != nil {
+			return fmt.Errorf("dependency on %s: %w", dep.Environment, err)
+		}
+	}
+	return nil
+}
+
+// claimID claims the requested ID of a new environment, or else a generated one, by creating its branch and
+// worktree from commit.
+func (r *Repository) claimID(ctx context.Context, requestedID string, config *environment.EnvironmentConfig, commit string) (id, worktree, submoduleWarning string, err error) {
+	for attempt := 0; ; attempt++ {
+		if requestedID != "" {
+			id = requestedID
+			err = r.prepareRequestedID(ctx, id)
+		} else {
+			id, err = r.generateID(ctx, config.Naming)
+		}
+		if err != nil {
+			return "", "", "", err
+		}
+
+		worktree, submoduleWarning, err = r.initializeWorktree(ctx, id, commit, config.Clone)
+		if errors.Is(err, errIDTaken) {
+			if requestedID == "" && attempt < maxIDAttempts {
+				continue
+			}
+			return "", "", "", fmt.Errorf("%w: %s", ErrEnvironmentExists, id)
+		}
+		if err != nil {
+			r.cleanupPartialCreate(ctx, id)
+			return "", "", "", err
+		}
+		return id, worktree, submoduleWarning, nil
+	}
+}
+
 // Get retrieves a full Environment with dagger client embedded for container operations.
 // Use this when you need to perform container operations like running commands, terminals, etc.
 // For basic metadata access without container operations, use Info() instead.
@@ -267,20 +460,19 @@ func (r *Repository) Get(ctx context.Context, dag *dagger.Client, id string) (*e
 		return nil, err
 	}
 
-	worktree, err := r.getWorktree(ctx, id)
+	worktree, state, err := r.loadPublishedState(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	state, err := r.loadState(ctx, worktree)
+	env, err := environment.Load(ctx, dag, id, state, worktree)
 	if err != nil {
 		return nil, err
 	}
-
-	env, err := environment.Load(ctx, dag, id, state, worktree)
-	if err != nil {
+	if err := r.DisableUntrustedDockerCredentials(id, env.State.Config); err != nil {
 		return nil, err
 	}
+	r.trackEvents(ctx, env)
 
 	return env, nil
 }
@@ -293,12 +485,7 @@ func (r *Repository) Info(ctx context.Context, id string) (*environment.Environm
 		return nil, err
 	}
 
-	worktree, err := r.getWorktree(ctx, id)
-	if err != nil {
-		return nil, err
-	}
-
-	state, err := r.loadState(ctx, worktree)
+	worktree, state, err := r.loadPublishedState(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -311,6 +498,20 @@ func (r *Repository) Info(ctx context.Context, id string) (*environment.Environm
 	return envInfo, nil
 }
 
+// loadPublishedState loads the worktree and state of an environment once the publication of its changes
+// in progress, if any, is done: reads never see a commit without its state or a workdir being exported,
+// and see every change whose tool call returned.
+func (r *Repository) loadPublishedState(ctx context.Context, id string) (worktree string, state []byte, err error) {
+	err = r.lockManager.WithIsolatedRLock(ctx, environmentLockType(id), func() error {
+		if worktree, err = r.getWorktree(ctx, id); err != nil {
+			return err
+		}
+		state, err = r.loadState(ctx, worktree)
+		return err
+	})
+	return worktree, state, err
+}
+
 // List returns information about all environments in the repository.
 // Returns EnvironmentInfo slice avoiding dagger client initialization.
 // Use Get() on individual environments when you need full Environment with container operations.
@@ -448,6 +649,15 @@ func (r *Repository) Delete(ctx context.Context, id string) error {
 	if err := r.deleteLocalRemoteBranch(id); err != nil {
 		return err
 	}
+	if err := os.Remove(r.budgetPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.RemoveAll(r.jobsPath(id)); err != nil {
+		return err
+	}
+	r.pushMetadata(ctx, id, true)
+	r.recordEvent(id, EventDeleted, nil)
+	r.index(id, nil, IndexDeleted)
 	return nil
 }
 
@@ -462,46 +672,13 @@ func (r *Repository) Checkout(ctx context.Context, id, branch string) (string, e
 		branch = "cu-" + id
 	}
 
-	// set up remote tracking branch if it's not already there
-	_, err := RunGitCommand(ctx, r.userRepoPath, "show-ref", "--verify", "--quiet", fmt.Sprintf("refs/heads/%s", branch))
-	localBranchExists := err == nil
-	if !localBranchExists {
-		_, err = RunGitCommand(ctx, r.userRepoPath, "branch", "--track", branch, fmt.Sprintf("%s/%s", containerUseRemote, id))
-		if err != nil {
-			return "", err
-		}
-	}
-
-	_, err = RunGitCommand(ctx, r.userRepoPath, "checkout", branch)
-	if err != nil {
-		return "", err
-	}
-
-	if localBranchExists {
-		remoteRef := fmt.Sprintf("%s/%s", containerUseRemote, id)
-
-		counts, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--left-right", "--count", fmt.Sprintf("HEAD...%s", remoteRef))
-		if err != nil {
+	checkoutErr := r.VCS().Checkout(ctx, branch, fmt.Sprintf("%s/%s", containerUseRemote, id))
+	if current, _ := r.VCS().CurrentBranch(ctx); current == branch {
+		if err := r.setBranchEnvironment(ctx, branch, id); err != nil {
 			return branch, err
 		}
-
-		parts := strings.Split(strings.TrimSpace(counts), "\t")
-		if len(parts) != 2 {
-			return branch, fmt.Errorf("unexpected git rev-list output: %s", counts)
-		}
-		aheadCount, behindCount := parts[0], parts[1]
-
-		if behindCount != "0" && aheadCount == "0" {
-			_, err = RunGitCommand(ctx, r.userRepoPath, "merge", "--ff-only", remoteRef)
-			if err != nil {
-				return branch, err
-			}
-		} else if behindCount != "0" {
-			return branch, fmt.Errorf("switched to %s, but %s is %s ahead and container-use/ remote has %s additional commits", branch, branch, aheadCount, behindCount)
-		}
 	}
-
-	return branch, err
+	return branch, checkoutErr
 }
 
 func (r *Repository) Log(ctx context.Context, id string, patch bool, jsonOutput bool, w io.Writer) error {
@@ -525,7 +702,7 @@ func (r *Repository) Log(ctx context.Context, id string, patch bool, jsonOutput
 	}
 
 	if patch {
-		logArgs = append(logArgs, "--patch")
+		logArgs = append(logArgs, "--patch", "--find-renames")
 	} else {
 		logArgs = append(logArgs, "--format=%C(yellow)%h%Creset  %s %Cgreen(%cr)%Creset %+N")
 	}
@@ -535,6 +712,25 @@ func (r *Repository) Log(ctx context.Context, id string, patch bool, jsonOutput
 	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, logArgs...)
 }
 
+// EnvironmentLog is the history of an environment, as output by log --json.
+type EnvironmentLog struct {
+	EnvironmentID string       `json:"environment_id"`
+	Commits       []*LogCommit `json:"commits"`
+}
+
+// LogCommit is a commit of an environment's history, with the notes of the commands it ran.
+type LogCommit struct {
+	Hash      string `json:"hash"`
+	ShortHash string `json:"short_hash"`
+	Message   string `json:"message"`
+	// Timestamp is the commit time, in seconds since the Unix epoch.
+	Timestamp    int64  `json:"timestamp"`
+	AuthorName   string `json:"author_name"`
+	AuthorEmail  string `json:"author_email"`
+	RelativeTime string `json:"relative_time"`
+	Notes        string `json:"notes"`
+}
+
 func (r *Repository) logJSON(ctx context.Context, id, revisionRange string, w io.Writer) error {
 	logArgs := []string{
 		"log",
@@ -548,7 +744,7 @@ func (r *Repository) logJSON(ctx context.Context, id, revisionRange string, w io
 	}
 
 	lines := strings.Split(strings.TrimSpace(output), "\n")
-	commits := []map[string]interface{}{}
+	commits := []*LogCommit{}
 
 	for _, line := range lines {
 		if line == "" {
@@ -581,23 +777,21 @@ func (r *Repository) logJSON(ctx context.Context, id, revisionRange string, w io
 		}
 		notes = strings.TrimSpace(notes)
 
-		commit := map[string]interface{}{
-			"hash":          hash,
-			"short_hash":    shortHash,
-			"message":       message,
-			"timestamp":     timestamp,
-			"author_name":   authorName,
-			"author_email":  authorEmail,
-			"relative_time": relativeTime,
-			"notes":         notes,
-		}
-
-		commits = append(commits, commit)
+		commits = append(commits, &LogCommit{
+			Hash:         hash,
+			ShortHash:    shortHash,
+			Message:      message,
+			Timestamp:    timestamp,
+			AuthorName:   authorName,
+			AuthorEmail:  authorEmail,
+			RelativeTime: relativeTime,
+			Notes:        notes,
+		})
 	}
 
-	result := map[string]interface{}{
-		"environment_id": id,
-		"commits":        commits,
+	result := &EnvironmentLog{
+		EnvironmentID: id,
+		Commits:       commits,
 	}
 
 	enc := json.NewEncoder(w)
@@ -644,7 +838,17 @@ func formatRelativeTime(t time.Time) string {
 	return fmt.Sprintf("%d years ago", years)
 }
 
-func (r *Repository) Diff(ctx context.Context, id string, w io.Writer) error {
+// DiffOptions narrow down or summarize the diff of an environment.
+type DiffOptions struct {
+	// Stat summarizes the changes of each file instead of showing them.
+	Stat bool
+	// NameOnly only lists the changed files.
+	NameOnly bool
+	// Paths limits the diff to these files or directories, relative to the repository root.
+	Paths []string
+}
+
+func (r *Repository) Diff(ctx context.Context, id string, opts DiffOptions, w io.Writer) error {
 	envInfo, err := r.Info(ctx, id)
 	if err != nil {
 		return err
@@ -652,6 +856,13 @@ func (r *Repository) Diff(ctx context.Context, id string, w io.Writer) error {
 
 	diffArgs := []string{
 		"diff",
+		"--find-renames",
+	}
+	if opts.Stat {
+		diffArgs = append(diffArgs, "--stat")
+	}
+	if opts.NameOnly {
+		diffArgs = append(diffArgs, "--name-only")
 	}
 
 	revisionRange, err := r.revisionRange(ctx, envInfo)
@@ -660,17 +871,44 @@ func (r *Repository) Diff(ctx context.Context, id string, w io.Writer) error {
 	}
 
 	diffArgs = append(diffArgs, revisionRange)
+	if len(opts.Paths) > 0 {
+		diffArgs = append(append(diffArgs, "--"), opts.Paths...)
+	}
 
 	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, diffArgs...)
 }
 
+// DiffStat returns a one-line summary of the environment's changes, e.g. "2 files changed, 10 insertions(+)".
+func (r *Repository) DiffStat(ctx context.Context, id string) (string, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return "", err
+	}
+
+	stat, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--shortstat", "--find-renames", revisionRange)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stat), nil
+}
+
 func (r *Repository) Merge(ctx context.Context, id string, w io.Writer) error {
 	envInfo, err := r.Info(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, "merge", "--no-ff", "--autostash", "-m", "Merge environment "+envInfo.ID, "--", "container-use/"+envInfo.ID)
+	if err := r.VCS().Merge(ctx, "container-use/"+envInfo.ID, "Merge environment "+envInfo.ID, w); err != nil {
+		return err
+	}
+	r.recordEvent(id, EventMerged, nil)
+	r.index(id, nil, IndexMerged)
+	return nil
 }
 
 func (r *Repository) Apply(ctx context.Context, id string, w io.Writer) error {
@@ -679,5 +917,84 @@ func (r *Repository) Apply(ctx context.Context, id string, w io.Writer) error {
 		return err
 	}
 
-	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, "merge", "--autostash", "--squash", "--", "container-use/"+envInfo.ID)
+	if err := r.VCS().Apply(ctx, "container-use/"+envInfo.ID, w); err != nil {
+		return err
+	}
+	r.recordEvent(id, EventApplied, nil)
+	r.index(id, nil, IndexApplied)
+	return nil
+}
+
+// ApplyCommits cherry-picks some of an environment's commits onto the current branch, oldest first.
+// Each revision is either a commit or a range of commits (a..b, excluding a) of the environment's history.
+// The commits keep their message and author.
+func (r *Repository) ApplyCommits(ctx context.Context, id string, revisions []string, w io.Writer) error {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return err
+	}
+	history, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--reverse", revisionRange)
+	if err != nil {
+		return err
+	}
+	envCommits := strings.Fields(history)
+	inEnvironment := make(map[string]bool, len(envCommits))
+	for _, commit := range envCommits {
+		inEnvironment[commit] = true
+	}
+
+	selected := map[string]bool{}
+	for _, revision := range revisions {
+		commits, err := r.resolveCommits(ctx, revision)
+		if err != nil {
+			return err
+		}
+		if len(commits) == 0 {
+			return fmt.Errorf("%s doesn't contain any commit", revision)
+		}
+		for _, commit := range commits {
+			if !inEnvironment[commit] {
+				return fmt.Errorf("commit %s is not one of the changes of environment %s that aren't on the current branch yet", commit, id)
+			}
+			selected[commit] = true
+		}
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no commits to apply")
+	}
+
+	picks := make([]string, 0, len(selected))
+	for _, commit := range envCommits {
+		if selected[commit] {
+			picks = append(picks, commit)
+		}
+	}
+
+	if err := RunInteractiveGitCommand(ctx, r.userRepoPath, w, append([]string{"cherry-pick"}, picks...)...); err != nil {
+		return fmt.Errorf("%w: resolve the conflicts and run 'git cherry-pick --continue', or 'git cherry-pick --abort'", err)
+	}
+	r.recordEvent(id, EventApplied, map[string]any{"commits": picks})
+	r.index(id, nil, IndexApplied)
+	return nil
+}
+
+// resolveCommits returns the commits of a revision: a single commit, or every commit of a range.
+func (r *Repository) resolveCommits(ctx context.Context, revision string) ([]string, error) {
+	if strings.Contains(revision, "..") {
+		output, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", revision, "--")
+		if err != nil {
+			return nil, fmt.Errorf("invalid commit range %s: %w", revision, err)
+		}
+		return strings.Fields(output), nil
+	}
+	output, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("unknown commit %s", revision)
+	}
+	return []string{strings.TrimSpace(output)}, nil
 }
@@ -1,12 +1,14 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -66,3 +68,147 @@ func TestRepositoryOpen(t *testing.T) {
 		assert.Equal(t, repo.forkRepoPath, strings.TrimSpace(remote))
 	})
 }
+
+// Custom naming lets teams control environment IDs while never reusing an existing one
+func TestGenerateID(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+
+	_, err := RunGitCommand(ctx, tempDir, "init")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, tempDir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "Initial commit")
+	require.NoError(t, err)
+
+	repo, err := OpenWithBasePath(ctx, tempDir, t.TempDir())
+	require.NoError(t, err)
+
+	t.Run("default_petname", func(t *testing.T) {
+		id, err := repo.generateID(ctx, nil)
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(id, "-"), 2)
+	})
+
+	t.Run("words_with_prefix", func(t *testing.T) {
+		id, err := repo.generateID(ctx, &environment.NamingConfig{
+			Prefix: "team-a-",
+			Style:  environment.NamingStyleWords,
+			Words:  []string{"red"},
+			Length: 3,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "team-a-red-red-red", id)
+	})
+
+	t.Run("sequential_skips_existing", func(t *testing.T) {
+		naming := &environment.NamingConfig{Prefix: "env-", Style: environment.NamingStyleSequential}
+
+		id, err := repo.generateID(ctx, naming)
+		require.NoError(t, err)
+		assert.Equal(t, "env-0001", id)
+
+		_, err = RunGitCommand(ctx, tempDir, "push", containerUseRemote, "HEAD:refs/heads/env-0007")
+		require.NoError(t, err)
+
+		id, err = repo.generateID(ctx, naming)
+		require.NoError(t, err)
+		assert.Equal(t, "env-0008", id)
+	})
+
+	t.Run("collision_adds_suffix", func(t *testing.T) {
+		_, err := RunGitCommand(ctx, tempDir, "push", containerUseRemote, "HEAD:refs/heads/fixed")
+		require.NoError(t, err)
+
+		id, err := repo.generateID(ctx, &environment.NamingConfig{Template: "fixed"})
+		require.NoError(t, err)
+		assert.Equal(t, "fixed-2", id)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		id, err := repo.generateID(ctx, &environment.NamingConfig{Template: "ci-{date}-{seq}"})
+		require.NoError(t, err)
+		assert.Regexp(t, `^ci-\d{8}-0001$`, id)
+	})
+}
+
+func TestPrepareRequestedID(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+
+	require.NoError(t, repo.prepareRequestedID(ctx, "fresh"))
+	assert.ErrorContains(t, repo.prepareRequestedID(ctx, "bad..id"), "invalid environment ID")
+
+	// A branch without environment state was left by an interrupted creation.
+	seedEnvironment(t, repo, "interrupted", "HEAD", nil)
+	worktree, err := repo.WorktreePath("interrupted")
+	require.NoError(t, err)
+	runGit(t, repo.forkRepoPath, "worktree", "add", worktree, "interrupted")
+
+	require.NoError(t, repo.prepareRequestedID(ctx, "interrupted"))
+	assert.True(t, repo.idAvailable(ctx, "interrupted"))
+	assert.NoDirExists(t, worktree)
+
+	// A complete environment is never cleaned up.
+	seedEnvironment(t, repo, "complete", "HEAD", &environment.State{Config: environment.DefaultConfig()})
+	assert.ErrorIs(t, repo.prepareRequestedID(ctx, "complete"), ErrEnvironmentExists)
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	userRepo := t.TempDir()
+	for _, role := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_"+role+"_NAME", "Test")
+		t.Setenv("GIT_"+role+"_EMAIL", "test@example.com")
+	}
+
+	_, err := RunGitCommand(ctx, userRepo, "init", "-b", "main")
+	require.NoError(t, err)
+	writeFile(t, userRepo, "README.md", "hello\n")
+	_, err = RunGitCommand(ctx, userRepo, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, userRepo, "commit", "-m", "init")
+	require.NoError(t, err)
+
+	_, err = RunGitCommand(ctx, userRepo, "checkout", "-b", "work")
+	require.NoError(t, err)
+	writeFile(t, userRepo, "README.md", "hello\nworld\n")
+	writeFile(t, userRepo, "src/main.go", "package main\n")
+	_, err = RunGitCommand(ctx, userRepo, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, userRepo, "commit", "-m", "Add main")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, userRepo, "checkout", "main")
+	require.NoError(t, err)
+
+	repo, err := OpenWithBasePath(ctx, userRepo, t.TempDir())
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "fetch", userRepo, "work:test-env")
+	require.NoError(t, err)
+	state := &environment.State{Title: "Add a main package", Config: environment.DefaultConfig()}
+	data, err := state.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, repo.SetRawState(ctx, "test-env", data))
+	_, err = RunGitCommand(ctx, userRepo, "fetch", containerUseRemote, "test-env")
+	require.NoError(t, err)
+
+	diff := func(opts DiffOptions) string {
+		var out bytes.Buffer
+		require.NoError(t, repo.Diff(ctx, "test-env", opts, &out))
+		return out.String()
+	}
+
+	full := diff(DiffOptions{})
+	assert.Contains(t, full, "+world")
+	assert.Contains(t, full, "+package main")
+
+	assert.Equal(t, "README.md\nsrc/main.go\n", diff(DiffOptions{NameOnly: true}))
+
+	stat := diff(DiffOptions{Stat: true})
+	assert.Contains(t, stat, "src/main.go | 1 +")
+	assert.Contains(t, stat, "2 files changed, 2 insertions(+)")
+	assert.NotContains(t, stat, "+package main")
+
+	filtered := diff(DiffOptions{Paths: []string{"src"}})
+	assert.Contains(t, filtered, "+package main")
+	assert.NotContains(t, filtered, "README.md")
+	assert.Equal(t, "src/main.go\n", diff(DiffOptions{NameOnly: true, Paths: []string{"src/main.go"}}))
+}
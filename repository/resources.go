@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dustin/go-humanize"
+)
+
+// ErrHostResources is returned when the host is too short of disk space or memory to create environments
+// or run commands without putting the Dagger engine's builds at risk.
+var ErrHostResources = errors.New("host resources too low")
+
+// enginePaths are the default data directories of the container runtimes the Dagger engine runs in, whose
+// disk is checked when they exist.
+var enginePaths = []string{"/var/lib/docker", "/var/lib/containers"}
+
+// Measures of the host's resources, replaced in tests.
+var (
+	diskSpace       = freeDiskSpace
+	availableMemory = readAvailableMemory
+)
+
+// CheckHostResources checks the host's free disk space and available memory against the repository's
+// resource guard, or the default one. Shortages are returned as warnings when the guard only warns, and
+// fail with ErrHostResources otherwise. Resources that can't be measured on the host aren't checked.
+func (r *Repository) CheckHostResources() ([]string, error) {
+	config := environment.DefaultConfig()
+	if err := config.Load(r.userRepoPath); err != nil {
+		return nil, err
+	}
+	guard := config.ResourceGuard
+	if guard == nil {
+		guard = environment.DefaultResourceGuard()
+	}
+
+	var shortages []string
+	if guard.MinFreeDisk > 0 {
+		paths := append([]string{r.basePath}, guard.Paths...)
+		for _, path := range enginePaths {
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		checked := map[string]bool{}
+		for _, path := range paths {
+			free, filesystem, err := diskSpace(path)
+			if err != nil {
+				slog.Warn("Unable to measure free disk space", "path", path, "err", err)
+				continue
+			}
+			if checked[filesystem] {
+				continue
+			}
+			checked[filesystem] = true
+			if free < guard.MinFreeDisk {
+				shortages = append(shortages, fmt.Sprintf(
+					"only %s of disk space left on %s (%s required): delete old environments with 'container-use prune', prune the Dagger engine's cache with 'dagger core engine local-cache prune', or free up space on that disk",
+					humanize.Bytes(free), path, humanize.Bytes(guard.MinFreeDisk)))
+			}
+		}
+	}
+	if guard.MinFreeMemory > 0 {
+		if available, ok := availableMemory(); ok && available < guard.MinFreeMemory {
+			shortages = append(shortages, fmt.Sprintf(
+				"only %s of memory available (%s required): stop the background commands and services you don't need, or close other applications",
+				humanize.Bytes(available), humanize.Bytes(guard.MinFreeMemory)))
+		}
+	}
+
+	if len(shortages) == 0 {
+		return nil, nil
+	}
+	if guard.WarnOnly {
+		return shortages, nil
+	}
+	return nil, fmt.Errorf("%w: %s\nTo proceed anyway, lower the thresholds or only warn with 'container-use config resource-guard set'",
+		ErrHostResources, strings.Join(shortages, "\n"))
+}
+
+// readAvailableMemory returns the memory available for new processes without swapping, as estimated by the
+// Linux kernel. It isn't measured on other systems.
+func readAvailableMemory() (uint64, bool) {
+	meminfo, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	return parseMemInfo(meminfo)
+}
+
+// parseMemInfo returns MemAvailable from the content of /proc/meminfo.
+func parseMemInfo(meminfo []byte) (uint64, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return kb * 1024, true
+	}
+	return 0, false
+}
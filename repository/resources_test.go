@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHostResources(t *testing.T) {
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+
+	free := map[string]uint64{}
+	memory := uint64(8e9)
+	diskSpace = func(path string) (uint64, string, error) {
+		if space, ok := free[path]; ok {
+			return space, path, nil
+		}
+		return 100e9, "root", nil
+	}
+	availableMemory = func() (uint64, bool) { return memory, true }
+	t.Cleanup(func() {
+		diskSpace = freeDiskSpace
+		availableMemory = readAvailableMemory
+	})
+
+	warnings, err := repo.CheckHostResources()
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	// The default guard applies without configuration.
+	free[repo.basePath] = 1e9
+	_, err = repo.CheckHostResources()
+	assert.ErrorIs(t, err, ErrHostResources)
+	assert.ErrorContains(t, err, "only 1.0 GB of disk space left on "+repo.basePath+" (2.0 GB required)")
+	assert.ErrorContains(t, err, "container-use prune")
+
+	config := environment.DefaultConfig()
+	config.ResourceGuard = &environment.ResourceGuardConfig{MinFreeDisk: 500e6, MinFreeMemory: 1e9, Paths: []string{"/mnt/engine"}}
+	require.NoError(t, config.Save(userRepo))
+	warnings, err = repo.CheckHostResources()
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	free["/mnt/engine"] = 100e6
+	memory = 200e6
+	_, err = repo.CheckHostResources()
+	assert.ErrorContains(t, err, "only 100 MB of disk space left on /mnt/engine (500 MB required)")
+	assert.ErrorContains(t, err, "only 200 MB of memory available (1.0 GB required)")
+
+	config.ResourceGuard.WarnOnly = true
+	require.NoError(t, config.Save(userRepo))
+	warnings, err = repo.CheckHostResources()
+	require.NoError(t, err)
+	assert.Len(t, warnings, 2)
+
+	config.ResourceGuard = &environment.ResourceGuardConfig{}
+	require.NoError(t, config.Save(userRepo))
+	warnings, err = repo.CheckHostResources()
+	require.NoError(t, err)
+	assert.Empty(t, warnings, "thresholds of 0 disable the checks")
+}
+
+func TestParseMemInfo(t *testing.T) {
+	available, ok := parseMemInfo([]byte("MemTotal:       16318412 kB\nMemFree:         1183148 kB\nMemAvailable:    9035640 kB\n"))
+	require.True(t, ok)
+	assert.Equal(t, uint64(9035640*1024), available)
+
+	_, ok = parseMemInfo([]byte("MemTotal:       16318412 kB\n"))
+	assert.False(t, ok, "kernels before 3.14 don't estimate it")
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package repository
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeDiskSpace returns the disk space available to unprivileged users on the filesystem of path, and an
+// identifier of that filesystem.
+func freeDiskSpace(path string) (uint64, string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, "", err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), fmt.Sprint(stat.Fsid), nil
+}
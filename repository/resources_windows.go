@@ -0,0 +1,22 @@
+//go:build windows
+
+package repository
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// freeDiskSpace returns the disk space available to the user on the volume of path, and the volume.
+func freeDiskSpace(path string) (uint64, string, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, "", err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &free, nil, nil); err != nil {
+		return 0, "", err
+	}
+	return free, filepath.VolumeName(path), nil
+}
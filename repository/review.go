@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+//go:embed review.html.tmpl
+var reviewTemplateSource string
+
+var reviewTemplate = template.Must(template.New("review").Funcs(template.FuncMap{
+	"diffLines": diffLines,
+	"percent":   func(percent *float64) string { return fmt.Sprintf("%.1f%%", *percent) },
+	"shortHash": func(hash string) string { return hash[:min(len(hash), 12)] },
+	"timestamp": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+}).Parse(reviewTemplateSource))
+
+// Review is everything a reviewer needs to audit an environment's work without access to the repository:
+// its summary, the commands it ran with their output, and its diff.
+type Review struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Repository  string             `json:"repository"`
+	Environment *EnvironmentExport `json:"environment"`
+	// History is the environment's commits with the notes recording the commands of each, oldest first.
+	History []*ReviewCommit `json:"history"`
+	Diff    string          `json:"diff"`
+}
+
+// ReviewCommit is a commit of an environment, with its notes.
+type ReviewCommit struct {
+	*CommitSummary
+	Notes string `json:"notes,omitempty"`
+}
+
+// Review collects the review of an environment. Like Export, parts of the environment that can't be
+// collected are reported in its Errors rather than failing the review.
+func (r *Repository) Review(ctx context.Context, id string) (*Review, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := r.ExportEnvironment(ctx, envInfo, true)
+	review := &Review{
+		GeneratedAt: time.Now().UTC(),
+		Repository:  r.userRepoPath,
+		Environment: exported,
+		History:     []*ReviewCommit{},
+	}
+	for _, commit := range slices.Backward(exported.Commits) {
+		notes, err := RunGitCommand(ctx, r.userRepoPath, "notes", "--ref="+gitNotesLogRef, "show", commit.Hash)
+		if err != nil {
+			// Commits without notes, e.g. the initial commit
+			notes = ""
+		}
+		review.History = append(review.History, &ReviewCommit{CommitSummary: commit, Notes: strings.TrimSpace(notes)})
+	}
+
+	if exported.Base != "" {
+		diff, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--find-renames", fmt.Sprintf("%s..%s", exported.Base, exported.RemoteRef))
+		if err != nil {
+			exported.Errors = append(exported.Errors, fmt.Sprintf("diff: %s", err))
+		}
+		review.Diff = diff
+	}
+	return review, nil
+}
+
+// WriteHTML writes the review as a single self-contained HTML page, with no external resources.
+func (review *Review) WriteHTML(w io.Writer) error {
+	return reviewTemplate.Execute(w, review)
+}
+
+// diffLine is a line of a diff, with the class it's rendered with.
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+func diffLines(diff string) []diffLine {
+	lines := []diffLine{}
+	// The header of each file (modes, index, ---/+++) lasts until its first hunk.
+	inHeader := false
+	for line := range strings.SplitSeq(strings.TrimSuffix(diff, "\n"), "\n") {
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "diff --git"):
+			class = "file"
+			inHeader = true
+		case strings.HasPrefix(line, "@@"):
+			class = "hunk"
+			inHeader = false
+		case inHeader:
+			class = "meta"
+		case strings.HasPrefix(line, "+"):
+			class = "add"
+		case strings.HasPrefix(line, "-"):
+			class = "del"
+		}
+		lines = append(lines, diffLine{Class: class, Text: line})
+	}
+	return lines
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReview(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+
+	runGit(t, userRepo, "checkout", "-b", "work")
+	writeFile(t, userRepo, "main.go", "package main\n\nfunc main() { println(\"<b>hi</b>\") }\n")
+	runGit(t, userRepo, "add", ".")
+	runGit(t, userRepo, "commit", "-m", "Add main")
+	runGit(t, userRepo, "notes", "--ref", gitNotesLogRef, "add", "-m", "$ go run .\n<b>hi</b>")
+	runGit(t, userRepo, "checkout", "main")
+	seedEnvironment(t, repo, "test-env", "work", &environment.State{Title: "Add a main package", Config: environment.DefaultConfig()})
+
+	review, err := repo.Review(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Empty(t, review.Environment.Errors)
+	require.Len(t, review.History, 1)
+	assert.Equal(t, "Add main", review.History[0].Subject)
+	assert.Equal(t, "$ go run .\n<b>hi</b>", review.History[0].Notes)
+	assert.Contains(t, review.Diff, "+++ b/main.go")
+
+	var out bytes.Buffer
+	require.NoError(t, review.WriteHTML(&out))
+	page := out.String()
+	assert.Contains(t, page, "<title>Review of test-env: Add a main package</title>")
+	assert.Contains(t, page, "$ go run .\n&lt;b&gt;hi&lt;/b&gt;")
+	assert.Contains(t, page, `<span class="add">&#43;func main() { println(&#34;&lt;b&gt;hi&lt;/b&gt;&#34;) }</span>`)
+	assert.Contains(t, page, `<span class="meta">new file mode 100644</span>`)
+	assert.NotContains(t, page, "<b>hi</b>", "outputs and diffs are escaped")
+	assert.NotContains(t, page, "src=", "the page has no external resources")
+
+	_, err = repo.Review(ctx, "missing-env")
+	assert.Error(t, err)
+}
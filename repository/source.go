@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// resolveSource resolves the ref an environment is created from. A ref the repository doesn't have is fetched
+// from its remote, with the host's git credentials (SSH agent, credential helpers): origin/feature-x from
+// origin, and other refs, such as a branch only pushed by a teammate, from the remote of the current branch
+// or else origin.
+func (r *Repository) resolveSource(ctx context.Context, ref string) (*environment.Source, error) {
+	source := &environment.Source{Ref: ref}
+	if commit, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+		source.Commit = strings.TrimSpace(commit)
+		return source, nil
+	}
+
+	remote, remoteRef := r.remoteOf(ctx, ref)
+	if remote == "" {
+		return nil, fmt.Errorf("unknown ref %s, and no remote to fetch it from", ref)
+	}
+	slog.Info("fetching ref", "ref", ref, "remote", remote)
+	// Fetching a branch of a remote also updates its remote-tracking branch, e.g. origin/feature-x. Prompting
+	// for credentials would hang the MCP server: they come from the SSH agent or a credential helper.
+	if _, err := runGitCommandWithEnv(ctx, r.userRepoPath, []string{"GIT_TERMINAL_PROMPT=0"}, "fetch", "--no-tags", remote, remoteRef); err != nil {
+		return nil, fmt.Errorf("unknown ref %s, and fetching %s from %s failed: %w", ref, remoteRef, remote, err)
+	}
+	commit, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("fetched %s from %s, but it isn't a commit: %w", remoteRef, remote, err)
+	}
+	source.Commit = strings.TrimSpace(commit)
+	source.Remote = remote
+	remoteURL, _ := RunGitCommand(ctx, r.userRepoPath, "remote", "get-url", remote)
+	source.RemoteURL = strings.TrimSpace(remoteURL)
+	return source, nil
+}
+
+// remoteOf returns the remote to fetch ref from and the name of ref there, or "" if there's none.
+func (r *Repository) remoteOf(ctx context.Context, ref string) (string, string) {
+	out, err := RunGitCommand(ctx, r.userRepoPath, "remote")
+	if err != nil {
+		return "", ""
+	}
+	remotes := slices.DeleteFunc(strings.Fields(out), func(remote string) bool { return remote == containerUseRemote })
+
+	ref = strings.TrimPrefix(ref, "refs/remotes/")
+	if remote, branch, ok := strings.Cut(ref, "/"); ok && slices.Contains(remotes, remote) {
+		return remote, "refs/heads/" + branch
+	}
+
+	branch, _ := r.VCS().CurrentBranch(ctx)
+	upstream, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get", "branch."+branch+".remote")
+	for _, remote := range []string{strings.TrimSpace(upstream), "origin"} {
+		if slices.Contains(remotes, remote) {
+			return remote, ref
+		}
+	}
+	if len(remotes) == 1 {
+		return remotes[0], ref
+	}
+	return "", ""
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSource(t *testing.T) {
+	ctx := context.Background()
+	setGitIdentity(t)
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, "", "init", "--bare", "--initial-branch=main", remote)
+	other := filepath.Join(t.TempDir(), "other")
+	runGit(t, "", "clone", remote, other)
+	runGit(t, other, "checkout", "-b", "main")
+	writeFile(t, other, "README.md", "hello")
+	runGit(t, other, "add", ".")
+	runGit(t, other, "commit", "-m", "init")
+	runGit(t, other, "push", "origin", "main")
+
+	dir := filepath.Join(t.TempDir(), "user")
+	runGit(t, "", "clone", remote, dir)
+	repo := &Repository{userRepoPath: dir}
+
+	source, err := repo.resolveSource(ctx, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, runGit(t, dir, "rev-parse", "HEAD"), source.Commit)
+	assert.Empty(t, source.Remote, "local refs aren't fetched")
+
+	// A teammate pushed branches since the last fetch.
+	for _, branch := range []string{"feature-x", "feature-y"} {
+		runGit(t, other, "checkout", "-b", branch, "main")
+		writeFile(t, other, branch+".txt", branch)
+		runGit(t, other, "add", ".")
+		runGit(t, other, "commit", "-m", branch)
+		runGit(t, other, "push", "origin", branch)
+	}
+
+	source, err = repo.resolveSource(ctx, "origin/feature-x")
+	require.NoError(t, err)
+	assert.Equal(t, runGit(t, other, "rev-parse", "feature-x"), source.Commit)
+	assert.Equal(t, "origin", source.Remote)
+	assert.Equal(t, remote, source.RemoteURL)
+	assert.Equal(t, source.Commit, runGit(t, dir, "rev-parse", "origin/feature-x"), "the remote-tracking branch is updated")
+
+	source, err = repo.resolveSource(ctx, "feature-y")
+	require.NoError(t, err)
+	assert.Equal(t, runGit(t, other, "rev-parse", "feature-y"), source.Commit)
+	assert.Equal(t, "origin", source.Remote)
+
+	_, err = repo.resolveSource(ctx, "origin/missing")
+	assert.ErrorContains(t, err, "fetching refs/heads/missing from origin failed")
+}
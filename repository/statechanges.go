@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// CommandStateChanges are the changes a command made to the snapshot paths of an environment.
+type CommandStateChanges struct {
+	Time    time.Time                  `json:"time"`
+	Command string                     `json:"command"`
+	Changes []*environment.StateChange `json:"changes"`
+}
+
+// StateChanges returns the changes the environment's commands made to its snapshot paths, according to
+// its event log, oldest first.
+func (r *Repository) StateChanges(id string) ([]*CommandStateChanges, error) {
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*CommandStateChanges
+	for _, event := range events {
+		if event.Type != environment.EventStateChanged {
+			continue
+		}
+		// Round-trip the event data to decode the changes.
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, err
+		}
+		commandChanges := &CommandStateChanges{Time: event.Time}
+		if err := json.Unmarshal(data, commandChanges); err != nil {
+			return nil, err
+		}
+		changes = append(changes, commandChanges)
+	}
+	return changes, nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+const (
+	suggesterTimeout  = time.Minute
+	suggesterCommits  = 20
+	maxSuggestedTitle = 100
+)
+
+// ErrNoSuggester is returned by SuggestTitle when no suggester is configured.
+var ErrNoSuggester = errors.New("no suggester configured")
+
+// Suggestion is the title and labels a suggester proposed for a new environment.
+type Suggestion struct {
+	Title  string   `json:"title"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// SuggestionRequest is what suggesters receive on stdin, as JSON.
+type SuggestionRequest struct {
+	// Task describes the work to be done, if the caller provided it.
+	Task    string `json:"task,omitempty"`
+	FromRef string `json:"from_ref"`
+	// Commits are the latest commits of FromRef, newest first.
+	Commits []SuggestionCommit `json:"commits"`
+}
+
+// SuggestionCommit is one of the commits of the ref the environment is created from.
+type SuggestionCommit struct {
+	Commit  string `json:"commit"`
+	Subject string `json:"subject"`
+	Body    string `json:"body,omitempty"`
+}
+
+type labelsKey struct{}
+
+// WithLabels returns a context creating environments labeled with labels.
+func WithLabels(ctx context.Context, labels []string) context.Context {
+	return context.WithValue(ctx, labelsKey{}, normalizeLabels(labels))
+}
+
+func labelsFromContext(ctx context.Context) []string {
+	labels, _ := ctx.Value(labelsKey{}).([]string)
+	return labels
+}
+
+// SuggestTitle asks the configured suggester for the title and labels of an environment created from
+// gitRef to work on task (which may be empty).
+//
+// The suggester is a host command receiving a SuggestionRequest as JSON on stdin, and CONTAINER_USE_TASK
+// and CONTAINER_USE_FROM_REF in its environment. It prints either a Suggestion as JSON, or the title as
+// plain text.
+func (r *Repository) SuggestTitle(ctx context.Context, gitRef, task string) (*Suggestion, error) {
+	config := environment.DefaultConfig()
+	if err := config.Load(r.userRepoPath); err != nil {
+		return nil, err
+	}
+	if config.Suggester == "" {
+		return nil, ErrNoSuggester
+	}
+	if err := r.requireTrusted(TrustSuggester, config.Suggester); err != nil {
+		return nil, err
+	}
+	if gitRef == "" {
+		gitRef = "HEAD"
+	}
+
+	commits, err := r.recentCommits(ctx, gitRef)
+	if err != nil {
+		return nil, err
+	}
+	input, err := json.Marshal(&SuggestionRequest{Task: task, FromRef: gitRef, Commits: commits})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, suggesterTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", config.Suggester)
+	cmd.Dir = r.userRepoPath
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"CONTAINER_USE_TASK="+task,
+		"CONTAINER_USE_FROM_REF="+gitRef,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("suggester failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseSuggestion(out)
+}
+
+func (r *Repository) recentCommits(ctx context.Context, gitRef string) ([]SuggestionCommit, error) {
+	output, err := RunGitCommand(ctx, r.userRepoPath, "log", "-n", fmt.Sprint(suggesterCommits), "--format=%H%x00%s%x00%b%x1e", gitRef, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []SuggestionCommit{}
+	for record := range strings.SplitSeq(output, "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(record), "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, SuggestionCommit{Commit: fields[0], Subject: fields[1], Body: strings.TrimSpace(fields[2])})
+	}
+	return commits, nil
+}
+
+// parseSuggestion reads the output of a suggester: a Suggestion as JSON, or the title as plain text.
+func parseSuggestion(out []byte) (*Suggestion, error) {
+	out = bytes.TrimSpace(out)
+	suggestion := &Suggestion{}
+	if bytes.HasPrefix(out, []byte("{")) {
+		if err := json.Unmarshal(out, suggestion); err != nil {
+			return nil, fmt.Errorf("invalid suggestion: %w", err)
+		}
+	} else {
+		suggestion.Title, _, _ = strings.Cut(string(out), "\n")
+	}
+
+	// Models like to quote their answers.
+	suggestion.Title = strings.Trim(strings.TrimSpace(suggestion.Title), "\"'`")
+	if suggestion.Title == "" {
+		return nil, errors.New("the suggester didn't suggest a title")
+	}
+	if title := []rune(suggestion.Title); len(title) > maxSuggestedTitle {
+		suggestion.Title = strings.TrimSpace(string(title[:maxSuggestedTitle]))
+	}
+	suggestion.Labels = normalizeLabels(suggestion.Labels)
+	return suggestion, nil
+}
+
+// normalizeLabels lowercases labels and drops empty and duplicate ones.
+func normalizeLabels(labels []string) []string {
+	var normalized []string
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label != "" && !slices.Contains(normalized, label) {
+			normalized = append(normalized, label)
+		}
+	}
+	return normalized
+}
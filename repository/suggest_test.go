@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSuggestion(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected *Suggestion
+	}{
+		{"plain", "Fix session refresh\n", &Suggestion{Title: "Fix session refresh"}},
+		{"first line", "\"Fix session refresh\"\nThe session is refreshed...", &Suggestion{Title: "Fix session refresh"}},
+		{"json", `{"title": "Fix session refresh", "labels": ["Bug", " auth ", "bug", ""]}`, &Suggestion{Title: "Fix session refresh", Labels: []string{"bug", "auth"}}},
+		{"long", strings.Repeat("a", 150), &Suggestion{Title: strings.Repeat("a", maxSuggestedTitle)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestion, err := parseSuggestion([]byte(tt.output))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, suggestion)
+		})
+	}
+
+	_, err := parseSuggestion([]byte("  \n"))
+	assert.Error(t, err)
+	_, err = parseSuggestion([]byte(`{"title": `))
+	assert.Error(t, err)
+}
+
+func TestSuggestTitle(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	dir := repo.userRepoPath
+	runGit(t, dir, "commit", "--allow-empty", "-m", "Refresh sessions in the background")
+
+	_, err := repo.SuggestTitle(ctx, "HEAD", "")
+	require.ErrorIs(t, err, ErrNoSuggester)
+
+	setSuggester := func(command string) {
+		config := environment.DefaultConfig()
+		config.Suggester = command
+		require.NoError(t, config.Save(dir))
+		require.NoError(t, repo.Trust(TrustSuggester, command))
+	}
+
+	// Suggesters from the repository's configuration only run once trusted.
+	config := environment.DefaultConfig()
+	config.Suggester = "touch ran"
+	require.NoError(t, config.Save(dir))
+	_, err = repo.SuggestTitle(ctx, "HEAD", "")
+	require.ErrorIs(t, err, ErrUntrusted)
+	assert.NoFileExists(t, filepath.Join(dir, "ran"))
+
+	// The request is given on stdin.
+	setSuggester(`cat > request.json && echo "$CONTAINER_USE_TASK"`)
+	suggestion, err := repo.SuggestTitle(ctx, "HEAD", "Fix logouts")
+	require.NoError(t, err)
+	assert.Equal(t, "Fix logouts", suggestion.Title)
+	request, err := os.ReadFile(filepath.Join(dir, "request.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(request), `"task":"Fix logouts"`)
+	assert.Contains(t, string(request), `"subject":"Refresh sessions in the background"`)
+
+	setSuggester(`echo '{"title": "Session refresh", "labels": ["auth"]}'`)
+	suggestion, err = repo.SuggestTitle(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Equal(t, &Suggestion{Title: "Session refresh", Labels: []string{"auth"}}, suggestion)
+
+	setSuggester(`echo "no model" >&2; exit 1`)
+	_, err = repo.SuggestTitle(ctx, "HEAD", "")
+	require.ErrorContains(t, err, "no model")
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+type TestStatus string
+
+const (
+	TestPassed  TestStatus = "pass"
+	TestFailed  TestStatus = "fail"
+	TestSkipped TestStatus = "skip"
+)
+
+// TestRun is the parsed result of running a test command in an environment.
+type TestRun struct {
+	Commit    string                `json:"commit"`
+	Command   string                `json:"command"`
+	ExitCode  int                   `json:"exit_code"`
+	StartedAt time.Time             `json:"started_at"`
+	Results   map[string]TestStatus `json:"results"`
+	// Coverage is the coverage reported by the test or coverage command, if any.
+	Coverage *Coverage `json:"coverage,omitempty"`
+}
+
+// Count returns the number of tests with the given status.
+func (run *TestRun) Count(status TestStatus) int {
+	n := 0
+	for _, s := range run.Results {
+		if s == status {
+			n++
+		}
+	}
+	return n
+}
+
+// TestComparison lists tests whose outcome changed relative to an earlier run, and the change of coverage
+// if both runs measured it.
+type TestComparison struct {
+	Commit      string         `json:"commit"`
+	NewFailures []string       `json:"new_failures"`
+	Fixed       []string       `json:"fixed"`
+	Coverage    *CoverageDelta `json:"coverage,omitempty"`
+}
+
+// TestReport is the result of recording a test run, compared against the previous run
+// in the environment and against the base the environment was created from.
+type TestReport struct {
+	Run           *TestRun        `json:"run"`
+	SincePrevious *TestComparison `json:"since_previous,omitempty"`
+	SinceBase     *TestComparison `json:"since_base,omitempty"`
+}
+
+var (
+	goTestResult     = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+)`)
+	pytestVerbose    = regexp.MustCompile(`^(\S+::\S+) (PASSED|FAILED|SKIPPED|ERROR)\b`)
+	pytestSummary    = regexp.MustCompile(`^(PASSED|FAILED|SKIPPED|ERROR) (\S+::\S+)`)
+	testStatusByWord = map[string]TestStatus{
+		"PASS":    TestPassed,
+		"PASSED":  TestPassed,
+		"FAIL":    TestFailed,
+		"FAILED":  TestFailed,
+		"ERROR":   TestFailed,
+		"SKIP":    TestSkipped,
+		"SKIPPED": TestSkipped,
+	}
+)
+
+// ParseTestOutput extracts per-test outcomes from `go test -v` and `pytest -v`/`-rA` output.
+func ParseTestOutput(output string) map[string]TestStatus {
+	results := map[string]TestStatus{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := goTestResult.FindStringSubmatch(line); m != nil {
+			results[m[2]] = testStatusByWord[m[1]]
+		} else if m := pytestVerbose.FindStringSubmatch(line); m != nil {
+			results[m[1]] = testStatusByWord[m[2]]
+		} else if m := pytestSummary.FindStringSubmatch(line); m != nil {
+			results[m[2]] = testStatusByWord[m[1]]
+		}
+	}
+	return results
+}
+
+// CompareTestRuns reports tests that fail in current but not in previous, and the reverse.
+// Tests that are new in current and failing count as new failures.
+func CompareTestRuns(previous, current *TestRun) *TestComparison {
+	comparison := &TestComparison{
+		Commit:      previous.Commit,
+		NewFailures: []string{},
+		Fixed:       []string{},
+		Coverage:    CompareCoverage(previous.Coverage, current.Coverage),
+	}
+	for name, status := range current.Results {
+		if status == TestFailed && previous.Results[name] != TestFailed {
+			comparison.NewFailures = append(comparison.NewFailures, name)
+		}
+	}
+	for name, status := range previous.Results {
+		if status == TestFailed && current.Results[name] == TestPassed {
+			comparison.Fixed = append(comparison.Fixed, name)
+		}
+	}
+	slices.Sort(comparison.NewFailures)
+	slices.Sort(comparison.Fixed)
+	return comparison
+}
+
+// RecordTestRun stores a test run against the environment's current commit and compares it
+// with the previous run and with the most recent run recorded on the environment's base.
+func (r *Repository) RecordTestRun(ctx context.Context, env *environment.Environment, run *TestRun) (*TestReport, error) {
+	worktreePath, err := r.WorktreePath(env.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree path: %w", err)
+	}
+
+	head, err := RunGitCommand(ctx, worktreePath, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	run.Commit = strings.TrimSpace(head)
+
+	report := &TestReport{Run: run}
+
+	history, err := r.TestHistory(ctx, env.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) > 0 {
+		report.SincePrevious = CompareTestRuns(history[len(history)-1], run)
+	}
+	if base := r.baseTestRun(ctx, env.ID, history); base != nil {
+		report.SinceBase = CompareTestRuns(base, run)
+	}
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
+		_, err := RunGitCommand(ctx, worktreePath, "notes", "--ref", gitNotesTestsRef, "append", "-m", string(data))
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store test results: %w", err)
+	}
+
+	if err := r.propagateGitNotes(ctx, gitNotesTestsRef); err != nil {
+		return nil, err
+	}
+	r.pushMetadata(ctx, env.ID, false)
+
+	return report, nil
+}
+
+// TestHistory returns the test runs recorded for an environment, oldest first.
+// Runs recorded on the environment's base commit are included.
+func (r *Repository) TestHistory(ctx context.Context, id string) ([]*TestRun, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	mergeBase, err := r.mergeBase(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--reverse", fmt.Sprintf("%s..%s/%s", mergeBase, containerUseRemote, id))
+	if err != nil {
+		return nil, err
+	}
+
+	commits := append([]string{mergeBase}, strings.Fields(revisions)...)
+	runs := []*TestRun{}
+	for _, commit := range commits {
+		notes, err := RunGitCommand(ctx, r.userRepoPath, "notes", "--ref", gitNotesTestsRef, "show", commit)
+		if err != nil {
+			// No tests were recorded on this commit
+			continue
+		}
+		for line := range strings.SplitSeq(notes, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			var run TestRun
+			if err := json.Unmarshal([]byte(line), &run); err != nil {
+				continue
+			}
+			runs = append(runs, &run)
+		}
+	}
+
+	slices.SortStableFunc(runs, func(a, b *TestRun) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return runs, nil
+}
+
+// baseTestRun returns the most recent run whose source tree is identical to the environment's
+// base, i.e. a run recorded on the base commit or before the environment made any changes.
+func (r *Repository) baseTestRun(ctx context.Context, id string, history []*TestRun) *TestRun {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil
+	}
+	mergeBase, err := r.mergeBase(ctx, envInfo)
+	if err != nil {
+		return nil
+	}
+	baseTree, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", mergeBase+"^{tree}")
+	if err != nil {
+		return nil
+	}
+
+	for _, run := range slices.Backward(history) {
+		tree, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", run.Commit+"^{tree}")
+		if err == nil && tree == baseTree {
+			return run
+		}
+	}
+	return nil
+}
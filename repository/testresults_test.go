@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTestOutput(t *testing.T) {
+	output := `=== RUN   TestAdd
+--- PASS: TestAdd (0.00s)
+=== RUN   TestSub
+    --- FAIL: TestSub/negative (0.00s)
+--- FAIL: TestSub (0.00s)
+--- SKIP: TestSlow (0.00s)
+tests/test_util.py::test_join PASSED                                     [ 50%]
+tests/test_util.py::test_split FAILED                                    [100%]
+ERROR tests/test_db.py::test_connect - ConnectionError
+`
+	assert.Equal(t, map[string]TestStatus{
+		"TestAdd":                        TestPassed,
+		"TestSub":                        TestFailed,
+		"TestSub/negative":               TestFailed,
+		"TestSlow":                       TestSkipped,
+		"tests/test_util.py::test_join":  TestPassed,
+		"tests/test_util.py::test_split": TestFailed,
+		"tests/test_db.py::test_connect": TestFailed,
+	}, ParseTestOutput(output))
+}
+
+func TestCompareTestRuns(t *testing.T) {
+	previous := &TestRun{
+		Commit: "abc",
+		Results: map[string]TestStatus{
+			"TestA": TestPassed,
+			"TestB": TestFailed,
+			"TestC": TestFailed,
+		},
+	}
+	current := &TestRun{
+		Results: map[string]TestStatus{
+			"TestA": TestFailed,
+			"TestB": TestPassed,
+			"TestC": TestFailed,
+			"TestD": TestFailed,
+		},
+	}
+
+	comparison := CompareTestRuns(previous, current)
+	assert.Equal(t, "abc", comparison.Commit)
+	assert.Equal(t, []string{"TestA", "TestD"}, comparison.NewFailures)
+	assert.Equal(t, []string{"TestB"}, comparison.Fixed)
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// EventOperation records an operation on an environment, such as a tool call of an agent or a command
+// of the user, with when it started and ended.
+const EventOperation = "operation"
+
+// Operation sources.
+const (
+	OperationSourceMCP = "mcp"
+	OperationSourceCLI = "cli"
+	OperationSourceIDE = "ide"
+)
+
+// Operation is an operation on an environment, as recorded in its event log.
+type Operation struct {
+	// Name is the tool or the command, e.g. environment_run_cmd or exec.
+	Name       string    `json:"name"`
+	Source     string    `json:"source"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RecordOperation records an operation on the environment that ended now.
+func (r *Repository) RecordOperation(id, name, source string, startedAt time.Time, err error) {
+	endedAt := time.Now().UTC()
+	data := map[string]any{
+		"name":        name,
+		"source":      source,
+		"started_at":  startedAt.UTC(),
+		"ended_at":    endedAt,
+		"duration_ms": endedAt.Sub(startedAt).Milliseconds(),
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	r.recordEvent(id, EventOperation, data)
+}
+
+// OperationTotal sums up the operations of an environment with the same name.
+type OperationTotal struct {
+	Name    string `json:"name"`
+	Count   int    `json:"count"`
+	TotalMS int64  `json:"total_ms"`
+	Errors  int    `json:"errors"`
+}
+
+// TimeReport accounts for the time spent on an environment.
+type TimeReport struct {
+	Environment    string    `json:"environment"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+	// WallClockMS is the time from the creation of the environment to its last activity.
+	WallClockMS int64 `json:"wall_clock_ms"`
+	// ActiveMS is the time at least one operation was running: concurrent operations count once.
+	ActiveMS int64 `json:"active_ms"`
+	// ExecMS is the time commands ran in the environment's container.
+	ExecMS     int64             `json:"exec_ms"`
+	Operations []*OperationTotal `json:"operations"`
+}
+
+// IdleMS is the part of the wall clock time no operation was running, e.g. while the agent was thinking.
+func (t *TimeReport) IdleMS() int64 {
+	return max(t.WallClockMS-t.ActiveMS, 0)
+}
+
+// Operations returns the operations recorded for the environment, oldest first.
+func (r *Repository) Operations(id string) ([]*Operation, error) {
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+	return operationsOf(events), nil
+}
+
+// TimeReport accounts for the time spent on the environment, from its event log.
+func (r *Repository) TimeReport(ctx context.Context, id string) (*TimeReport, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+	return buildTimeReport(envInfo, events), nil
+}
+
+func operationsOf(events []Event) []*Operation {
+	var operations []*Operation
+	for _, event := range events {
+		if event.Type != EventOperation {
+			continue
+		}
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			continue
+		}
+		operation := &Operation{}
+		if err := json.Unmarshal(data, operation); err != nil || operation.StartedAt.IsZero() {
+			continue
+		}
+		operations = append(operations, operation)
+	}
+	return operations
+}
+
+func buildTimeReport(envInfo *environment.EnvironmentInfo, events []Event) *TimeReport {
+	report := &TimeReport{
+		Environment:    envInfo.ID,
+		CreatedAt:      envInfo.State.CreatedAt,
+		LastActivityAt: envInfo.State.UpdatedAt,
+		Operations:     []*OperationTotal{},
+	}
+	for _, event := range events {
+		if event.Time.After(report.LastActivityAt) {
+			report.LastActivityAt = event.Time
+		}
+		if event.Type == environment.EventExecFinished {
+			if duration, ok := event.Data["duration_ms"].(float64); ok {
+				report.ExecMS += int64(duration)
+			}
+		}
+	}
+	if !report.CreatedAt.IsZero() && report.LastActivityAt.After(report.CreatedAt) {
+		report.WallClockMS = report.LastActivityAt.Sub(report.CreatedAt).Milliseconds()
+	}
+
+	operations := operationsOf(events)
+	totals := map[string]*OperationTotal{}
+	for _, operation := range operations {
+		total := totals[operation.Name]
+		if total == nil {
+			total = &OperationTotal{Name: operation.Name}
+			totals[operation.Name] = total
+			report.Operations = append(report.Operations, total)
+		}
+		total.Count++
+		total.TotalMS += operation.DurationMS
+		if operation.Error != "" {
+			total.Errors++
+		}
+	}
+	sort.SliceStable(report.Operations, func(i, j int) bool { return report.Operations[i].TotalMS > report.Operations[j].TotalMS })
+	report.ActiveMS = activeTime(operations).Milliseconds()
+	return report
+}
+
+// activeTime returns the time at least one of the operations was running.
+func activeTime(operations []*Operation) time.Duration {
+	sorted := make([]*Operation, len(operations))
+	copy(sorted, operations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartedAt.Before(sorted[j].StartedAt) })
+
+	var active time.Duration
+	var start, end time.Time
+	for _, operation := range sorted {
+		if operation.StartedAt.After(end) {
+			active += end.Sub(start)
+			start, end = operation.StartedAt, operation.EndedAt
+		} else if operation.EndedAt.After(end) {
+			end = operation.EndedAt
+		}
+	}
+	return active + end.Sub(start)
+}
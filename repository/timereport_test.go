@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordOperation(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+	startedAt := time.Now().Add(-2 * time.Second)
+	repo.RecordOperation("test-env", "environment_run_cmd", OperationSourceMCP, startedAt, nil)
+	repo.RecordOperation("test-env", "exec", OperationSourceCLI, startedAt, errors.New("command exited with code 1"))
+	repo.recordEvent("test-env", EventCommit, map[string]any{"commit": "abc123"})
+
+	operations, err := repo.Operations("test-env")
+	require.NoError(t, err)
+	require.Len(t, operations, 2)
+	assert.Equal(t, "environment_run_cmd", operations[0].Name)
+	assert.Equal(t, OperationSourceMCP, operations[0].Source)
+	assert.WithinDuration(t, startedAt, operations[0].StartedAt, time.Millisecond)
+	assert.GreaterOrEqual(t, operations[0].DurationMS, int64(2000))
+	assert.Empty(t, operations[0].Error)
+	assert.Equal(t, "command exited with code 1", operations[1].Error)
+}
+
+func TestBuildTimeReport(t *testing.T) {
+	created := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return created.Add(time.Duration(minutes) * time.Minute) }
+	operation := func(name string, from, to int, failed bool) Event {
+		data := map[string]any{
+			"name":        name,
+			"source":      OperationSourceMCP,
+			"started_at":  at(from),
+			"ended_at":    at(to),
+			"duration_ms": float64((time.Duration(to-from) * time.Minute).Milliseconds()),
+		}
+		if failed {
+			data["error"] = "failed"
+		}
+		return Event{Time: at(to), Type: EventOperation, Data: data}
+	}
+
+	envInfo := &environment.EnvironmentInfo{ID: "test-env", State: &environment.State{CreatedAt: created, UpdatedAt: at(30)}}
+	report := buildTimeReport(envInfo, []Event{
+		operation("environment_run_cmd", 0, 10, false),
+		// Overlaps the previous operation: counts once in the active time.
+		operation("environment_file_read", 5, 12, false),
+		{Time: at(12), Type: environment.EventExecFinished, Data: map[string]any{"duration_ms": float64(9 * time.Minute / time.Millisecond)}},
+		operation("environment_run_cmd", 40, 45, true),
+		{Time: at(60), Type: EventCommit},
+	})
+
+	assert.Equal(t, at(60), report.LastActivityAt)
+	assert.Equal(t, (60 * time.Minute).Milliseconds(), report.WallClockMS)
+	assert.Equal(t, (17 * time.Minute).Milliseconds(), report.ActiveMS)
+	assert.Equal(t, (43 * time.Minute).Milliseconds(), report.IdleMS())
+	assert.Equal(t, (9 * time.Minute).Milliseconds(), report.ExecMS)
+	assert.Equal(t, []*OperationTotal{
+		{Name: "environment_run_cmd", Count: 2, TotalMS: (15 * time.Minute).Milliseconds(), Errors: 1},
+		{Name: "environment_file_read", Count: 1, TotalMS: (7 * time.Minute).Milliseconds()},
+	}, report.Operations)
+}
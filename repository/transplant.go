@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+)
+
+type configKey struct{}
+
+// WithConfig returns a context creating environments with config instead of the repository's configuration.
+func WithConfig(ctx context.Context, config *environment.EnvironmentConfig) context.Context {
+	return context.WithValue(ctx, configKey{}, config)
+}
+
+func configFromContext(ctx context.Context) *environment.EnvironmentConfig {
+	config, _ := ctx.Value(configKey{}).(*environment.EnvironmentConfig)
+	return config
+}
+
+// applyFailure matches the errors of git apply about files a patch can't be applied to at all, which don't
+// leave a .rej file behind.
+var applyFailure = regexp.MustCompile(`(?m)^error: (.+): (No such file or directory|does not exist in index|already exists in working directory|does not match index|patch does not apply)$`)
+
+// Patch is one of the commits of an environment, as a patch that can be applied to another repository.
+type Patch struct {
+	Commit      string `json:"commit"`
+	AuthorName  string `json:"author_name"`
+	AuthorEmail string `json:"author_email"`
+	AuthorDate  string `json:"author_date"`
+	Message     string `json:"message"`
+	Diff        string `json:"-"`
+}
+
+// Subject returns the first line of the patch's message.
+func (p *Patch) Subject() string {
+	subject, _, _ := strings.Cut(p.Message, "\n")
+	return subject
+}
+
+// PatchSeries returns the changes of an environment that aren't on the current branch yet, oldest first,
+// one patch per commit. Merges and commits without changes are left out.
+func (r *Repository) PatchSeries(ctx context.Context, id string) ([]*Patch, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+	history, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--reverse", "--no-merges", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []*Patch
+	for _, commit := range strings.Fields(history) {
+		diff, err := RunGitCommand(ctx, r.userRepoPath, "diff-tree", "-p", "--binary", "--full-index", "--find-renames", "--no-commit-id", commit)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(diff) == "" {
+			continue
+		}
+		meta, err := RunGitCommand(ctx, r.userRepoPath, "show", "-s", "--format=%an%x00%ae%x00%aI%x00%B", commit)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.SplitN(meta, "\x00", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected metadata of commit %s", commit)
+		}
+		patches = append(patches, &Patch{
+			Commit:      commit,
+			AuthorName:  fields[0],
+			AuthorEmail: fields[1],
+			AuthorDate:  fields[2],
+			Message:     strings.TrimSpace(fields[3]),
+			Diff:        diff,
+		})
+	}
+	return patches, nil
+}
+
+// TransplantOptions locate the environment's changes in the target repository, for code that was moved or
+// vendored.
+type TransplantOptions struct {
+	// Strip removes leading directories from the changed paths.
+	Strip int
+	// Directory is prepended to the changed paths, once stripped.
+	Directory string
+}
+
+// RejectedChange is a part of a patch that didn't apply to the target repository.
+type RejectedChange struct {
+	File string `json:"file"`
+	// Reason tells why the change didn't apply.
+	Reason string `json:"reason"`
+	// Hunks are the rejected hunks, as in .rej files. It's empty when the whole file was rejected.
+	Hunks string `json:"hunks,omitempty"`
+}
+
+// TransplantedPatch is the outcome of applying a patch to the target repository.
+type TransplantedPatch struct {
+	*Patch
+	// Applied is the commit of the target repository with the changes that applied, empty if none did.
+	Applied  string            `json:"applied,omitempty"`
+	Rejected []*RejectedChange `json:"rejected"`
+}
+
+// PatchSeriesResult is the outcome of applying a patch series to a repository.
+type PatchSeriesResult struct {
+	// Base is the commit the patches were applied on.
+	Base string `json:"base"`
+	// Head is the commit with all the changes that applied.
+	Head    string               `json:"head"`
+	Patches []*TransplantedPatch `json:"patches"`
+}
+
+// Rejected returns the number of changes that didn't apply.
+func (res *PatchSeriesResult) Rejected() int {
+	rejected := 0
+	for _, patch := range res.Patches {
+		rejected += len(patch.Rejected)
+	}
+	return rejected
+}
+
+// ApplyPatchSeries applies patches on top of HEAD, one commit per patch keeping its message and author,
+// without touching the user's working tree. Hunks that don't apply are reported instead of failing the
+// series, so it's as complete as possible.
+func (r *Repository) ApplyPatchSeries(ctx context.Context, patches []*Patch, opts TransplantOptions, source string) (_ *PatchSeriesResult, rerr error) {
+	head, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("the repository has no commit to apply the changes on: %w", err)
+	}
+	result := &PatchSeriesResult{Base: strings.TrimSpace(head), Head: strings.TrimSpace(head), Patches: []*TransplantedPatch{}}
+
+	tmp, err := os.MkdirTemp("", "container-use-transplant-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	worktree := filepath.Join(tmp, "worktree")
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "worktree", "add", "--detach", worktree, result.Base); err != nil {
+		return nil, fmt.Errorf("failed to create a worktree to apply the changes in: %w", err)
+	}
+	defer func() {
+		if _, err := RunGitCommand(context.WithoutCancel(ctx), r.userRepoPath, "worktree", "remove", "--force", worktree); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	applyArgs := []string{"apply", "--reject", "--whitespace=nowarn", fmt.Sprintf("-p%d", opts.Strip+1)}
+	if opts.Directory != "" {
+		applyArgs = append(applyArgs, "--directory="+strings.Trim(filepath.ToSlash(opts.Directory), "/"))
+	}
+
+	for i, patch := range patches {
+		transplanted := &TransplantedPatch{Patch: patch, Rejected: []*RejectedChange{}}
+		result.Patches = append(result.Patches, transplanted)
+
+		patchFile := filepath.Join(tmp, fmt.Sprintf("%04d.patch", i+1))
+		if err := os.WriteFile(patchFile, []byte(patch.Diff), 0644); err != nil {
+			return nil, err
+		}
+		output, applyErr := RunGitCommand(ctx, worktree, append(applyArgs, patchFile)...)
+		if applyErr != nil {
+			output = applyErr.Error()
+		}
+		if transplanted.Rejected, err = collectRejects(ctx, worktree, output); err != nil {
+			return nil, err
+		}
+		if applyErr != nil && len(transplanted.Rejected) == 0 {
+			return nil, fmt.Errorf("failed to apply commit %s: %w", patch.Commit, applyErr)
+		}
+
+		if _, err := RunGitCommand(ctx, worktree, "add", "--all"); err != nil {
+			return nil, err
+		}
+		if _, err := RunGitCommand(ctx, worktree, "diff", "--cached", "--quiet"); err == nil {
+			continue
+		}
+		message := fmt.Sprintf("%s\n\n(transplanted from commit %s of %s)", patch.Message, patch.Commit, source)
+		env := []string{
+			"GIT_AUTHOR_NAME=" + patch.AuthorName,
+			"GIT_AUTHOR_EMAIL=" + patch.AuthorEmail,
+			"GIT_AUTHOR_DATE=" + patch.AuthorDate,
+		}
+		if _, err := runGitCommandWithEnv(ctx, worktree, env, "commit", "--no-verify", "-m", message); err != nil {
+			return nil, fmt.Errorf("failed to commit the changes of %s: %w", patch.Commit, err)
+		}
+		applied, err := RunGitCommand(ctx, worktree, "rev-parse", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		transplanted.Applied = strings.TrimSpace(applied)
+		result.Head = transplanted.Applied
+	}
+	return result, nil
+}
+
+// collectRejects gathers the changes git apply --reject couldn't apply in worktree from its output and the
+// .rej files it left, which are removed.
+func collectRejects(ctx context.Context, worktree, output string) ([]*RejectedChange, error) {
+	rejected := []*RejectedChange{}
+	for _, match := range applyFailure.FindAllStringSubmatch(output, -1) {
+		rejected = append(rejected, &RejectedChange{File: match[1], Reason: match[2]})
+	}
+
+	rejFiles, err := RunGitCommand(ctx, worktree, "ls-files", "-z", "--others", "--", "*.rej")
+	if err != nil {
+		return nil, err
+	}
+	for rejFile := range strings.SplitSeq(rejFiles, "\x00") {
+		if rejFile == "" {
+			continue
+		}
+		path := filepath.Join(worktree, rejFile)
+		hunks, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		// The first line is the header of the file's diff.
+		_, body, _ := strings.Cut(string(hunks), "\n")
+		count := strings.Count("\n"+body, "\n@@ ")
+		rejected = append(rejected, &RejectedChange{
+			File:   strings.TrimSuffix(rejFile, ".rej"),
+			Reason: fmt.Sprintf("%d hunk(s) didn't apply", count),
+			Hunks:  body,
+		})
+	}
+	return rejected, nil
+}
+
+// Transplant recreates an environment of source in this repository: a new environment is created with the
+// same configuration, from HEAD with the environment's changes applied on top, one commit each. The changes
+// that didn't apply are reported in the result.
+func (r *Repository) Transplant(ctx context.Context, dag *dagger.Client, source *Repository, id string, opts TransplantOptions) (*environment.Environment, *PatchSeriesResult, error) {
+	envInfo, err := source.Info(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	patches, err := source.PatchSeries(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(patches) == 0 {
+		return nil, nil, errors.New("the environment has no changes to transplant")
+	}
+
+	result, err := r.ApplyPatchSeries(ctx, patches, opts, fmt.Sprintf("environment %s of %s", id, source.SourcePath()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx = WithConfig(ctx, envInfo.State.Config)
+	title := fmt.Sprintf("Transplant of %s: %s", id, envInfo.State.Title)
+	explanation := fmt.Sprintf("Transplant environment %s from %s", id, source.SourcePath())
+	env, err := r.Create(ctx, dag, title, explanation, result.Head)
+	if err != nil {
+		return nil, result, err
+	}
+	return env, result, nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransplantPatchSeries(t *testing.T) {
+	ctx := context.Background()
+	source := newTestRepository(t)
+	sourceRepo := source.userRepoPath
+
+	writeFile(t, sourceRepo, "lib/parse.go", "package lib\n\nfunc Parse() {}\n")
+	writeFile(t, sourceRepo, "lib/format.go", "package lib\n\nfunc Format() {}\n")
+	runGit(t, sourceRepo, "add", ".")
+	runGit(t, sourceRepo, "commit", "-m", "Add lib")
+
+	runGit(t, sourceRepo, "checkout", "-b", "work")
+	runGit(t, sourceRepo, "commit", "--allow-empty", "-m", "Create environment test-env")
+	writeFile(t, sourceRepo, "lib/parse.go", "package lib\n\nfunc Parse() error { return nil }\n")
+	runGit(t, sourceRepo, "commit", "-am", "Return parse errors", "--author", "Agent <agent@example.com>")
+	writeFile(t, sourceRepo, "lib/format.go", "package lib\n\nfunc Format() string { return \"\" }\n")
+	writeFile(t, sourceRepo, "lib/missing.go", "package lib\n")
+	runGit(t, sourceRepo, "add", ".")
+	runGit(t, sourceRepo, "commit", "-m", "Return formatted strings\n\nWith details.")
+	runGit(t, sourceRepo, "checkout", "main")
+	seedEnvironment(t, source, "test-env", "work", &environment.State{Title: "Improve lib", Config: environment.DefaultConfig()})
+
+	patches, err := source.PatchSeries(ctx, "test-env")
+	require.NoError(t, err)
+	require.Len(t, patches, 2, "commits without changes are left out")
+	assert.Equal(t, "Return parse errors", patches[0].Subject())
+	assert.Equal(t, "agent@example.com", patches[0].AuthorEmail)
+	assert.Equal(t, "Return formatted strings\n\nWith details.", patches[1].Message)
+
+	// The library was vendored in the target repository, and its format.go has diverged.
+	target := newTestRepository(t)
+	targetRepo := target.userRepoPath
+	writeFile(t, targetRepo, "third_party/lib/parse.go", "package lib\n\nfunc Parse() {}\n")
+	writeFile(t, targetRepo, "third_party/lib/format.go", "package lib\n\nfunc Format(verbose bool) {}\n")
+	runGit(t, targetRepo, "add", ".")
+	runGit(t, targetRepo, "commit", "-m", "vendor lib")
+	base := runGit(t, targetRepo, "rev-parse", "HEAD")
+
+	result, err := target.ApplyPatchSeries(ctx, patches, TransplantOptions{Strip: 1, Directory: "third_party/lib"}, "environment test-env")
+	require.NoError(t, err)
+	assert.Equal(t, base, result.Base)
+	assert.Equal(t, base, runGit(t, targetRepo, "rev-parse", "HEAD"), "the user's branch is left alone")
+	require.Len(t, result.Patches, 2)
+
+	assert.Empty(t, result.Patches[0].Rejected)
+	assert.Equal(t, "Agent <agent@example.com>", runGit(t, targetRepo, "log", "-1", "--format=%an <%ae>", result.Patches[0].Applied))
+	assert.Contains(t, runGit(t, targetRepo, "log", "-1", "--format=%B", result.Patches[0].Applied), "(transplanted from commit "+patches[0].Commit+" of environment test-env)")
+	assert.Equal(t, "package lib\n\nfunc Parse() error { return nil }", runGit(t, targetRepo, "show", result.Head+":third_party/lib/parse.go"))
+
+	// The new file applies, the diverged one is reported.
+	second := result.Patches[1]
+	assert.Equal(t, result.Head, second.Applied)
+	assert.Equal(t, 1, result.Rejected())
+	require.Len(t, second.Rejected, 1)
+	assert.Equal(t, "third_party/lib/format.go", second.Rejected[0].File)
+	assert.Equal(t, "1 hunk(s) didn't apply", second.Rejected[0].Reason)
+	assert.Contains(t, second.Rejected[0].Hunks, "+func Format() string")
+	assert.Equal(t, "package lib", runGit(t, targetRepo, "show", result.Head+":third_party/lib/missing.go"))
+	_, err = RunGitCommand(ctx, targetRepo, "show", result.Head+":third_party/lib/format.go.rej")
+	assert.Error(t, err)
+
+	worktrees := runGit(t, targetRepo, "worktree", "list", "--porcelain")
+	assert.Equal(t, 1, strings.Count(worktrees, "worktree "), "the temporary worktree is removed")
+	_, err = os.Stat(filepath.Join(targetRepo, "third_party/lib/format.go.rej"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Files that don't exist at all in the target are reported too.
+	result, err = target.ApplyPatchSeries(ctx, patches, TransplantOptions{}, "environment test-env")
+	require.NoError(t, err)
+	assert.Equal(t, []*RejectedChange{{File: "lib/parse.go", Reason: "No such file or directory"}}, result.Patches[0].Rejected)
+	assert.Empty(t, result.Patches[0].Applied, "nothing applied")
+	assert.Equal(t, []*RejectedChange{{File: "lib/format.go", Reason: "No such file or directory"}}, result.Patches[1].Rejected)
+	assert.Equal(t, "package lib", runGit(t, targetRepo, "show", result.Head+":lib/missing.go"))
+}
+
+func TestTransplantRenamesAndModes(t *testing.T) {
+	ctx := context.Background()
+	source := newTestRepository(t)
+	sourceRepo := source.userRepoPath
+	target := newTestRepository(t)
+	targetRepo := target.userRepoPath
+
+	for _, dir := range []string{sourceRepo, filepath.Join(targetRepo, "third_party")} {
+		writeFile(t, dir, "lib/parse.go", "package lib\n\nfunc Parse() {}\n")
+		writeFile(t, dir, "lib/gen.sh", "#!/bin/sh\ngo generate ./...\n")
+	}
+	runGit(t, sourceRepo, "add", ".")
+	runGit(t, sourceRepo, "commit", "-m", "Add lib")
+	runGit(t, sourceRepo, "checkout", "-b", "work")
+	runGit(t, sourceRepo, "mv", "lib/parse.go", "lib/parser.go")
+	require.NoError(t, os.Chmod(filepath.Join(sourceRepo, "lib/gen.sh"), 0755))
+	runGit(t, sourceRepo, "commit", "-am", "Rename the parser and make the generator executable")
+	runGit(t, sourceRepo, "checkout", "main")
+	seedEnvironment(t, source, "test-env", "work", &environment.State{Title: "Tidy lib", Config: environment.DefaultConfig()})
+
+	patches, err := source.PatchSeries(ctx, "test-env")
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+	assert.Contains(t, patches[0].Diff, "rename from lib/parse.go")
+
+	runGit(t, targetRepo, "add", ".")
+	runGit(t, targetRepo, "commit", "-m", "vendor lib")
+
+	result, err := target.ApplyPatchSeries(ctx, patches, TransplantOptions{Directory: "third_party"}, "environment test-env")
+	require.NoError(t, err)
+	assert.Empty(t, result.Patches[0].Rejected)
+	tree := runGit(t, targetRepo, "ls-tree", "-r", result.Head)
+	assert.Regexp(t, `100755 blob \w+\tthird_party/lib/gen.sh`, tree)
+	assert.Contains(t, tree, "third_party/lib/parser.go")
+	assert.NotContains(t, tree, "third_party/lib/parse.go")
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// The repository's configuration is committed: cloning a repository and creating an environment must not
+// be enough to run its host commands, or to read host files or Docker credentials, outside of the sandbox. They're only used
+// once the user trusted them, which is recorded per repository, outside of it, and keyed by a hash of the
+// trusted value, so changing the command or file asks again.
+
+// Kinds of configuration the user trusts.
+const (
+	TrustCommitHook = "commit_hook"
+	TrustSuggester  = "suggester"
+	TrustHostFile   = "host_file"
+	// TrustDockerCredentials trusts the environments with the host's Docker credentials of the registries
+	// of their images: see DockerCredentialsTrustValue.
+	TrustDockerCredentials = "docker_credentials"
+)
+
+// ErrUntrusted is returned when the configuration would run a host command the user didn't trust.
+// Untrusted host files are asked about instead, like the files configured to prompt.
+var ErrUntrusted = errors.New("not trusted: run 'container-use config trust' to review and trust it")
+
+// Trusted is a value of the configuration the user trusted.
+type Trusted struct {
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Hash      string    `json:"hash"`
+	TrustedAt time.Time `json:"trusted_at"`
+}
+
+// TrustedValues returns the values of the configuration that are only used once trusted.
+func TrustedValues(config *environment.EnvironmentConfig) []*Trusted {
+	var values []*Trusted
+	if config.CommitMessage != nil && config.CommitMessage.Hook != "" {
+		values = append(values, &Trusted{Kind: TrustCommitHook, Value: config.CommitMessage.Hook})
+	}
+	if config.Suggester != "" {
+		values = append(values, &Trusted{Kind: TrustSuggester, Value: config.Suggester})
+	}
+	for _, file := range config.HostFiles {
+		if !file.Prompt {
+			values = append(values, &Trusted{Kind: TrustHostFile, Value: HostFileTrustValue(file)})
+		}
+	}
+	if config.DockerCredentials {
+		values = append(values, &Trusted{Kind: TrustDockerCredentials, Value: DockerCredentialsTrustValue(config)})
+	}
+	return values
+}
+
+// DockerCredentialsTrustValue identifies the Docker credentials the configuration uses for the user to trust:
+// those of the registries of its images, so pulling from another registry asks again.
+func DockerCredentialsTrustValue(config *environment.EnvironmentConfig) string {
+	return "registries " + strings.Join(config.ImageRegistries(), ", ")
+}
+
+// DisableUntrustedDockerCredentials stops the configuration from using the host's Docker credentials unless
+// the user trusted them for the registries of its images. It's called before environments are built with
+// a configuration, as the agent may change their images.
+func (r *Repository) DisableUntrustedDockerCredentials(envID string, config *environment.EnvironmentConfig) error {
+	if !config.DockerCredentials {
+		return nil
+	}
+	value := DockerCredentialsTrustValue(config)
+	ok, err := r.IsTrusted(TrustDockerCredentials, value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slog.Warn("Not using the host's Docker credentials: run 'container-use config trust' to trust them", "environment-id", envID, "credentials", value)
+		config.DockerCredentials = false
+	}
+	return nil
+}
+
+// Untrusted returns the values of the configuration the user didn't trust yet.
+func (r *Repository) Untrusted(config *environment.EnvironmentConfig) ([]*Trusted, error) {
+	var untrusted []*Trusted
+	for _, value := range TrustedValues(config) {
+		ok, err := r.IsTrusted(value.Kind, value.Value)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			untrusted = append(untrusted, value)
+		}
+	}
+	return untrusted, nil
+}
+
+func trustHash(kind, value string) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Repository) trustPath() string {
+	return filepath.Join(r.basePath, "trust", fmt.Sprintf("%x.json", hashString(r.forkRepoPath)))
+}
+
+// ListTrusted returns the values of the configuration the user trusted.
+func (r *Repository) ListTrusted() ([]*Trusted, error) {
+	data, err := os.ReadFile(r.trustPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var trusted []*Trusted
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		return nil, fmt.Errorf("invalid trust file %s: %w", r.trustPath(), err)
+	}
+	return trusted, nil
+}
+
+// IsTrusted returns whether the user trusted the value of the configuration.
+func (r *Repository) IsTrusted(kind, value string) (bool, error) {
+	trusted, err := r.ListTrusted()
+	if err != nil {
+		return false, err
+	}
+	hash := trustHash(kind, value)
+	return slices.ContainsFunc(trusted, func(t *Trusted) bool { return t.Hash == hash }), nil
+}
+
+// Trust records that the user trusted the value of the configuration.
+func (r *Repository) Trust(kind, value string) error {
+	trusted, err := r.ListTrusted()
+	if err != nil {
+		return err
+	}
+	hash := trustHash(kind, value)
+	if slices.ContainsFunc(trusted, func(t *Trusted) bool { return t.Hash == hash }) {
+		return nil
+	}
+	trusted = append(trusted, &Trusted{Kind: kind, Value: value, Hash: hash, TrustedAt: time.Now().UTC()})
+	return r.saveTrusted(trusted)
+}
+
+// ResetTrust forgets everything the user trusted in the repository.
+func (r *Repository) ResetTrust() error {
+	if err := os.Remove(r.trustPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *Repository) saveTrusted(trusted []*Trusted) error {
+	if err := os.MkdirAll(filepath.Dir(r.trustPath()), 0755); err != nil {
+		return fmt.Errorf("failed to create trust directory: %w", err)
+	}
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.trustPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.trustPath())
+}
+
+// requireTrusted returns ErrUntrusted if the user didn't trust the value of the configuration.
+func (r *Repository) requireTrusted(kind, value string) error {
+	ok, err := r.IsTrusted(kind, value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s %q is %w", kind, value, ErrUntrusted)
+	}
+	return nil
+}
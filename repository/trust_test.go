@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrust(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir(), forkRepoPath: "/tmp/fork"}
+
+	config := environment.DefaultConfig()
+	config.CommitMessage = &environment.CommitMessageConfig{Hook: "./commit-message.sh"}
+	config.Suggester = "./suggest.sh"
+
+	untrusted, err := repo.Untrusted(config)
+	require.NoError(t, err)
+	assert.Len(t, untrusted, 2)
+	require.NoError(t, repo.Trust(TrustSuggester, "./suggest.sh"))
+	untrusted, err = repo.Untrusted(config)
+	require.NoError(t, err)
+	require.Len(t, untrusted, 1)
+	assert.Equal(t, TrustCommitHook, untrusted[0].Kind)
+	assert.ErrorIs(t, repo.requireTrusted(TrustCommitHook, "./commit-message.sh"), ErrUntrusted)
+
+	require.NoError(t, repo.Trust(TrustCommitHook, "./commit-message.sh"))
+	require.NoError(t, repo.Trust(TrustCommitHook, "./commit-message.sh"))
+	trusted, err := repo.ListTrusted()
+	require.NoError(t, err)
+	assert.Len(t, trusted, 2, "trusting twice records once")
+
+	untrusted, err = repo.Untrusted(config)
+	require.NoError(t, err)
+	assert.Empty(t, untrusted)
+
+	// Trust is keyed by the exact value: a changed command isn't trusted.
+	ok, err := repo.IsTrusted(TrustCommitHook, "./commit-message.sh --other")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = repo.IsTrusted(TrustCommitHook, "./suggest.sh")
+	require.NoError(t, err)
+	assert.False(t, ok, "trust is per kind of command")
+
+	// Trust is per repository.
+	other := &Repository{basePath: repo.basePath, forkRepoPath: "/tmp/other"}
+	ok, err = other.IsTrusted(TrustCommitHook, "./commit-message.sh")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, repo.ResetTrust())
+	ok, err = repo.IsTrusted(TrustCommitHook, "./commit-message.sh")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestDisableUntrustedDockerCredentials(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir(), forkRepoPath: "/tmp/fork"}
+
+	config := environment.DefaultConfig()
+	config.DockerCredentials = true
+	require.NoError(t, repo.DisableUntrustedDockerCredentials("test-env", config))
+	assert.False(t, config.DockerCredentials, "the committed configuration alone doesn't give the credentials")
+
+	config.DockerCredentials = true
+	untrusted, err := repo.Untrusted(config)
+	require.NoError(t, err)
+	require.Len(t, untrusted, 1)
+	assert.Equal(t, &Trusted{Kind: TrustDockerCredentials, Value: "registries docker.io"}, untrusted[0])
+	require.NoError(t, repo.Trust(TrustDockerCredentials, untrusted[0].Value))
+	require.NoError(t, repo.DisableUntrustedDockerCredentials("test-env", config))
+	assert.True(t, config.DockerCredentials)
+
+	// The agent changing the images changes the registries the credentials were trusted for.
+	config.BaseImage = "ghcr.io/acme/base"
+	require.NoError(t, repo.DisableUntrustedDockerCredentials("test-env", config))
+	assert.False(t, config.DockerCredentials)
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Categories of uncommitted changes.
+const (
+	// UncommittedStaged are the changes added to the index.
+	UncommittedStaged = "staged"
+	// UncommittedUnstaged are the changes to tracked files not added to the index.
+	UncommittedUnstaged = "unstaged"
+	// UncommittedUntracked are the files neither tracked nor ignored.
+	UncommittedUntracked = "untracked"
+	// UncommittedIgnored are the ignored files environments usually need, such as .env files.
+	UncommittedIgnored = "ignored"
+)
+
+// UncommittedCategories are the categories of uncommitted changes, in the order they're layered.
+var UncommittedCategories = []string{UncommittedStaged, UncommittedUnstaged, UncommittedUntracked, UncommittedIgnored}
+
+// relevantIgnoredFiles are pathspecs of the ignored files reported as uncommitted changes: local
+// settings that projects keep out of git but need to run.
+var relevantIgnoredFiles = []string{
+	":(glob)**/.env",
+	":(glob)**/.env.*",
+	":(glob)**/.envrc",
+	":(glob)**/*.local",
+	":(glob)**/*.local.*",
+}
+
+// UncommittedChanges are the files of the user's repository that differ from HEAD, by category.
+// A file can be both staged and unstaged.
+type UncommittedChanges struct {
+	Staged    []string `json:"staged"`
+	Unstaged  []string `json:"unstaged"`
+	Untracked []string `json:"untracked"`
+	// Ignored are the ignored files environments usually need, such as .env files.
+	Ignored []string `json:"ignored"`
+}
+
+// Files returns the files of a category.
+func (c *UncommittedChanges) Files(category string) []string {
+	switch category {
+	case UncommittedStaged:
+		return c.Staged
+	case UncommittedUnstaged:
+		return c.Unstaged
+	case UncommittedUntracked:
+		return c.Untracked
+	case UncommittedIgnored:
+		return c.Ignored
+	}
+	return nil
+}
+
+// Dirty reports whether there are staged, unstaged or untracked changes. Ignored files don't make a
+// repository dirty.
+func (c *UncommittedChanges) Dirty() bool {
+	return len(c.Staged) > 0 || len(c.Unstaged) > 0 || len(c.Untracked) > 0
+}
+
+// Excluded returns the categories with changes, ignored files aside, that aren't included.
+func (c *UncommittedChanges) Excluded(included []string) []string {
+	var excluded []string
+	for _, category := range UncommittedCategories {
+		if category != UncommittedIgnored && len(c.Files(category)) > 0 && !slices.Contains(included, category) {
+			excluded = append(excluded, category)
+		}
+	}
+	return excluded
+}
+
+// ParseUncommittedCategories validates a list of categories, "all" standing for every one of them.
+func ParseUncommittedCategories(categories []string) ([]string, error) {
+	var parsed []string
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		switch {
+		case category == "all":
+			return slices.Clone(UncommittedCategories), nil
+		case slices.Contains(UncommittedCategories, category):
+			if !slices.Contains(parsed, category) {
+				parsed = append(parsed, category)
+			}
+		default:
+			return nil, fmt.Errorf("unknown category of uncommitted changes %q: expected %s or all", category, strings.Join(UncommittedCategories, ", "))
+		}
+	}
+	return parsed, nil
+}
+
+// UncommittedChanges returns the uncommitted changes of the user's repository.
+func (r *Repository) UncommittedChanges(ctx context.Context) (*UncommittedChanges, error) {
+	changes := &UncommittedChanges{Staged: []string{}, Unstaged: []string{}, Untracked: []string{}, Ignored: []string{}}
+	status, err := RunGitCommand(ctx, r.userRepoPath, "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	entries := strings.Split(status, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		x, y, file := entry[0], entry[1], entry[3:]
+		if x == 'R' || x == 'C' {
+			// The original path of renames and copies follows.
+			i++
+		}
+		switch {
+		case x == '?':
+			changes.Untracked = append(changes.Untracked, file)
+		default:
+			if x != ' ' {
+				changes.Staged = append(changes.Staged, file)
+			}
+			if y != ' ' {
+				changes.Unstaged = append(changes.Unstaged, file)
+			}
+		}
+	}
+
+	ignored, err := RunGitCommand(ctx, r.userRepoPath, append([]string{"ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--"}, relevantIgnoredFiles...)...)
+	if err != nil {
+		return nil, err
+	}
+	for file := range strings.SplitSeq(ignored, "\x00") {
+		if file != "" {
+			changes.Ignored = append(changes.Ignored, file)
+		}
+	}
+	return changes, nil
+}
+
+// CommitUncommitted records the uncommitted changes of the given categories in a commit on top of HEAD,
+// without touching the index or the working tree, so an environment can be created from it. It returns
+// "" when there are no such changes.
+func (r *Repository) CommitUncommitted(ctx context.Context, categories []string) (string, error) {
+	changes, err := r.UncommittedChanges(ctx)
+	if err != nil {
+		return "", err
+	}
+	var included []string
+	for _, category := range categories {
+		if len(changes.Files(category)) > 0 {
+			included = append(included, category)
+		}
+	}
+	if len(included) == 0 {
+		return "", nil
+	}
+
+	head, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("the repository has no commit to include uncommitted changes on: %w", err)
+	}
+	head = strings.TrimSpace(head)
+
+	index, err := os.CreateTemp("", "container-use-index-")
+	if err != nil {
+		return "", err
+	}
+	index.Close()
+	os.Remove(index.Name())
+	defer os.Remove(index.Name())
+	env := []string{"GIT_INDEX_FILE=" + index.Name(), "GIT_LITERAL_PATHSPECS=1"}
+
+	// The staged changes are the tree of the real index.
+	base := head
+	if slices.Contains(included, UncommittedStaged) {
+		if base, err = RunGitCommand(ctx, r.userRepoPath, "write-tree"); err != nil {
+			return "", fmt.Errorf("failed to record the staged changes, resolve the conflicts first: %w", err)
+		}
+		base = strings.TrimSpace(base)
+	}
+	if _, err := runGitCommandWithEnv(ctx, r.userRepoPath, env, "read-tree", base); err != nil {
+		return "", err
+	}
+
+	for _, category := range included {
+		var args []string
+		switch category {
+		case UncommittedUnstaged:
+			args = []string{"add", "--all", "--"}
+		case UncommittedUntracked:
+			args = []string{"add", "--"}
+		case UncommittedIgnored:
+			args = []string{"add", "--force", "--"}
+		default:
+			continue
+		}
+		if _, err := runGitCommandWithEnv(ctx, r.userRepoPath, env, append(args, changes.Files(category)...)...); err != nil {
+			return "", fmt.Errorf("failed to record the %s changes: %w", category, err)
+		}
+	}
+
+	tree, err := runGitCommandWithEnv(ctx, r.userRepoPath, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	message := fmt.Sprintf("Uncommitted changes (%s)", strings.Join(included, ", "))
+	commit, err := RunGitCommand(ctx, r.userRepoPath, "commit-tree", strings.TrimSpace(tree), "-p", head, "-m", message)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(commit), nil
+}
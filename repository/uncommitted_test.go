@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUncommittedChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userRepo := repo.userRepoPath
+
+	writeFile(t, userRepo, ".gitignore", ".env\nbuild/\n")
+	writeFile(t, userRepo, "staged.txt", "v1\n")
+	writeFile(t, userRepo, "both.txt", "v1\n")
+	writeFile(t, userRepo, "unstaged.txt", "v1\n")
+	runGit(t, userRepo, "add", ".")
+	runGit(t, userRepo, "commit", "-m", "Add files")
+
+	writeFile(t, userRepo, "staged.txt", "v2\n")
+	writeFile(t, userRepo, "both.txt", "v2\n")
+	runGit(t, userRepo, "add", "staged.txt", "both.txt")
+	writeFile(t, userRepo, "both.txt", "v3\n")
+	writeFile(t, userRepo, "unstaged.txt", "v2\n")
+	writeFile(t, userRepo, "notes/todo.txt", "later\n")
+	writeFile(t, userRepo, ".env", "TOKEN=abc\n")
+	writeFile(t, userRepo, "build/out.bin", "binary\n")
+
+	changes, err := repo.UncommittedChanges(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"both.txt", "staged.txt"}, changes.Staged)
+	assert.ElementsMatch(t, []string{"both.txt", "unstaged.txt"}, changes.Unstaged)
+	assert.Equal(t, []string{"notes/todo.txt"}, changes.Untracked)
+	assert.Equal(t, []string{".env"}, changes.Ignored, "only ignored files environments need")
+	assert.True(t, changes.Dirty())
+	assert.Equal(t, []string{UncommittedUnstaged}, changes.Excluded([]string{UncommittedStaged, UncommittedUntracked}))
+
+	status := runGit(t, userRepo, "status", "--porcelain")
+	commit, err := repo.CommitUncommitted(ctx, []string{UncommittedStaged, UncommittedUntracked})
+	require.NoError(t, err)
+	assert.Equal(t, status, runGit(t, userRepo, "status", "--porcelain"), "the index and working tree are left alone")
+	assert.Equal(t, runGit(t, userRepo, "rev-parse", "HEAD"), runGit(t, userRepo, "rev-parse", commit+"^"))
+	assert.Equal(t, "Uncommitted changes (staged, untracked)", runGit(t, userRepo, "log", "-1", "--format=%s", commit))
+	assert.Equal(t, "v2", runGit(t, userRepo, "show", commit+":staged.txt"))
+	assert.Equal(t, "v2", runGit(t, userRepo, "show", commit+":both.txt"), "the staged version")
+	assert.Equal(t, "v1", runGit(t, userRepo, "show", commit+":unstaged.txt"))
+	assert.Equal(t, "later", runGit(t, userRepo, "show", commit+":notes/todo.txt"))
+	_, err = RunGitCommand(ctx, userRepo, "show", commit+":.env")
+	assert.Error(t, err)
+
+	commit, err = repo.CommitUncommitted(ctx, UncommittedCategories)
+	require.NoError(t, err)
+	assert.Equal(t, "v3", runGit(t, userRepo, "show", commit+":both.txt"), "the working tree version")
+	assert.Equal(t, "v2", runGit(t, userRepo, "show", commit+":unstaged.txt"))
+	assert.Equal(t, "TOKEN=abc", runGit(t, userRepo, "show", commit+":.env"))
+	_, err = RunGitCommand(ctx, userRepo, "show", commit+":build/out.bin")
+	assert.Error(t, err)
+
+	commit, err = repo.CommitUncommitted(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, commit, "nothing to include")
+}
+
+func TestParseUncommittedCategories(t *testing.T) {
+	categories, err := ParseUncommittedCategories([]string{"untracked", "staged", "untracked"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{UncommittedUntracked, UncommittedStaged}, categories)
+
+	categories, err = ParseUncommittedCategories([]string{"staged", "all"})
+	require.NoError(t, err)
+	assert.Equal(t, UncommittedCategories, categories)
+
+	_, err = ParseUncommittedCategories([]string{"stashed"})
+	assert.ErrorContains(t, err, `unknown category of uncommitted changes "stashed"`)
+}
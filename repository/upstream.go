@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+)
+
+// UpstreamSync is the outcome of syncing the repository's configuration with its upstream configuration.
+type UpstreamSync struct {
+	Source   string `json:"source"`
+	Revision string `json:"revision"`
+	// Changes are the upstream settings that changed since the previous sync.
+	Changes []*environment.SettingChange `json:"changes"`
+}
+
+// SyncUpstreamConfig fetches the upstream configuration, e.g. an organization's defaults, and records it
+// in the repository's configuration directory, where the repository's own settings are layered on it.
+// dag is only used by OCI sources. With dryRun, the changes are reported but not recorded.
+func (r *Repository) SyncUpstreamConfig(ctx context.Context, dag *dagger.Client, upstream *environment.UpstreamConfig, dryRun bool) (*UpstreamSync, error) {
+	settings, revision, err := fetchUpstreamConfig(ctx, dag, upstream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", upstream, err)
+	}
+	if err := environment.ValidateSettings(settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", upstream, err)
+	}
+
+	previous, err := environment.LoadUpstreamSettings(r.userRepoPath)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := environment.DiffSettings(r.userRepoPath, previous, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		synced := *upstream
+		synced.Revision = revision
+		synced.SyncedAt = time.Now().UTC()
+		if err := environment.SaveUpstream(r.userRepoPath, &synced, settings); err != nil {
+			return nil, fmt.Errorf("failed to save upstream configuration: %w", err)
+		}
+	}
+
+	return &UpstreamSync{
+		Source:   upstream.String(),
+		Revision: revision,
+		Changes:  changes,
+	}, nil
+}
+
+func fetchUpstreamConfig(ctx context.Context, dag *dagger.Client, upstream *environment.UpstreamConfig) ([]byte, string, error) {
+	if upstream.IsOCI() {
+		if dag == nil {
+			return nil, "", fmt.Errorf("OCI sources require dagger")
+		}
+		image := dag.Container().From(upstream.OCIRef())
+		content, err := image.File(upstream.ConfigPath()).Contents(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		revision, err := image.ImageRef(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(content), revision, nil
+	}
+
+	dir, err := os.MkdirTemp("", "container-use-upstream-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if upstream.Ref != "" {
+		args = append(args, "--branch", upstream.Ref)
+	}
+	if _, err := RunGitCommand(ctx, "", append(args, "--", upstream.Source, dir)...); err != nil {
+		return nil, "", err
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(upstream.ConfigPath())))
+	if err != nil {
+		return nil, "", err
+	}
+	revision, err := RunGitCommand(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+	return content, strings.TrimSpace(revision), nil
+}
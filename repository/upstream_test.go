@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncUpstreamConfig(t *testing.T) {
+	ctx := context.Background()
+	setGitIdentity(t)
+
+	source := t.TempDir()
+	runGit(t, source, "init")
+	commit := func(content string) string {
+		writeFile(t, source, "defaults/environment.json", content)
+		runGit(t, source, "add", ".")
+		runGit(t, source, "commit", "-m", "update defaults")
+		return runGit(t, source, "rev-parse", "HEAD")
+	}
+
+	repo := &Repository{userRepoPath: t.TempDir()}
+	upstream := &environment.UpstreamConfig{Source: source, Path: "defaults/environment.json"}
+
+	head := commit(`{"base_image": "golang:1.25"}`)
+	result, err := repo.SyncUpstreamConfig(ctx, nil, upstream, false)
+	require.NoError(t, err)
+	assert.Equal(t, head, result.Revision)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, environment.SettingAdded, result.Changes[0].Change)
+
+	commit(`{"base_image": "golang:1.26"}`)
+	result, err = repo.SyncUpstreamConfig(ctx, nil, upstream, true)
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, environment.SettingChanged, result.Changes[0].Change)
+
+	// A dry run doesn't record the changes.
+	config := environment.DefaultConfig()
+	require.NoError(t, config.Load(repo.userRepoPath))
+	assert.Equal(t, "golang:1.25", config.BaseImage)
+
+	_, err = repo.SyncUpstreamConfig(ctx, nil, upstream, false)
+	require.NoError(t, err)
+	config = environment.DefaultConfig()
+	require.NoError(t, config.Load(repo.userRepoPath))
+	assert.Equal(t, "golang:1.26", config.BaseImage)
+
+	recorded, err := environment.LoadUpstream(repo.userRepoPath)
+	require.NoError(t, err)
+	assert.Equal(t, source, recorded.Source)
+	assert.NotEmpty(t, recorded.Revision)
+
+	commit(`{"base_image": 42}`)
+	_, err = repo.SyncUpstreamConfig(ctx, nil, upstream, false)
+	assert.ErrorContains(t, err, "invalid configuration")
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// vcsConfig is the git config key forcing the VCS driving the user's repository, "git" or "jj",
+// instead of detecting it.
+const vcsConfig = "container-use.vcs"
+
+// VCS is the version control system the user drives their repository with. Environments are always
+// stored as branches of the container-use remote: the VCS decides how the user's working copy moves
+// to them and brings their changes in.
+type VCS interface {
+	// Name is the name of the VCS, e.g. "git".
+	Name() string
+	// CurrentBranch returns the branch the working copy is on, or "" if it isn't on any.
+	CurrentBranch(ctx context.Context) (string, error)
+	// Checkout moves the working copy to branch, created or fast-forwarded to ref, the environment's
+	// remote branch.
+	Checkout(ctx context.Context, branch, ref string) error
+	// Merge merges ref into the working copy with a merge commit.
+	Merge(ctx context.Context, ref, message string, w io.Writer) error
+	// Apply brings the changes of ref into the working copy, without committing them.
+	Apply(ctx context.Context, ref string, w io.Writer) error
+}
+
+// detectVCS returns the VCS of the repository: jj for a repository colocated with jj (with both a .jj
+// and a .git directory) when the jj CLI is installed, and git otherwise. The vcsConfig git config
+// key overrides the detection.
+func detectVCS(ctx context.Context, dir string) VCS {
+	forced, _ := RunGitCommand(ctx, dir, "config", "--get", vcsConfig)
+	switch strings.TrimSpace(forced) {
+	case "git":
+		return &gitVCS{dir: dir}
+	case "jj":
+		return &jjVCS{gitVCS{dir: dir}}
+	case "":
+	default:
+		slog.Warn("Unknown VCS, using git", "config", vcsConfig, "vcs", strings.TrimSpace(forced))
+		return &gitVCS{dir: dir}
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, ".jj")); err != nil || !info.IsDir() {
+		return &gitVCS{dir: dir}
+	}
+	if _, err := exec.LookPath("jj"); err != nil {
+		slog.Warn("Repository is colocated with jj, but jj isn't installed: using git", "repository", dir)
+		return &gitVCS{dir: dir}
+	}
+	return &jjVCS{gitVCS{dir: dir}}
+}
+
+// VCS returns the version control system of the user's repository.
+func (r *Repository) VCS() VCS {
+	if r.vcs == nil {
+		return &gitVCS{dir: r.userRepoPath}
+	}
+	return r.vcs
+}
+
+type gitVCS struct {
+	dir string
+}
+
+func (v *gitVCS) Name() string {
+	return "git"
+}
+
+func (v *gitVCS) CurrentBranch(ctx context.Context) (string, error) {
+	branch, err := RunGitCommand(ctx, v.dir, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		// Detached HEAD.
+		return "", nil
+	}
+	return strings.TrimSpace(branch), nil
+}
+
+func (v *gitVCS) Checkout(ctx context.Context, branch, ref string) error {
+	// set up remote tracking branch if it's not already there
+	_, err := RunGitCommand(ctx, v.dir, "show-ref", "--verify", "--quiet", fmt.Sprintf("refs/heads/%s", branch))
+	localBranchExists := err == nil
+	if !localBranchExists {
+		_, err = RunGitCommand(ctx, v.dir, "branch", "--track", branch, ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := RunGitCommand(ctx, v.dir, "checkout", branch); err != nil {
+		return err
+	}
+	if !localBranchExists {
+		return nil
+	}
+
+	counts, err := RunGitCommand(ctx, v.dir, "rev-list", "--left-right", "--count", fmt.Sprintf("HEAD...%s", ref))
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(strings.TrimSpace(counts), "\t")
+	if len(parts) != 2 {
+		return fmt.Errorf("unexpected git rev-list output: %s", counts)
+	}
+	aheadCount, behindCount := parts[0], parts[1]
+
+	if behindCount != "0" && aheadCount == "0" {
+		_, err = RunGitCommand(ctx, v.dir, "merge", "--ff-only", ref)
+		return err
+	} else if behindCount != "0" {
+		return fmt.Errorf("switched to %s, but %s is %s ahead and container-use/ remote has %s additional commits", branch, branch, aheadCount, behindCount)
+	}
+	return nil
+}
+
+func (v *gitVCS) Merge(ctx context.Context, ref, message string, w io.Writer) error {
+	return RunInteractiveGitCommand(ctx, v.dir, w, "merge", "--no-ff", "--autostash", "-m", message, "--", ref)
+}
+
+func (v *gitVCS) Apply(ctx context.Context, ref string, w io.Writer) error {
+	return RunInteractiveGitCommand(ctx, v.dir, w, "merge", "--autostash", "--squash", "--", ref)
+}
+
+// jjVCS drives a repository colocated with jj: git and jj share the repository, jj importing and
+// exporting git refs on every command, and git's HEAD being the parent of jj's working-copy change
+// (@-). Environments are checked out as bookmarks, with a new change on top of them.
+type jjVCS struct {
+	gitVCS
+}
+
+func (v *jjVCS) Name() string {
+	return "jj"
+}
+
+// CurrentBranch returns the most recent bookmark the working copy descends from, since jj doesn't
+// move bookmarks as changes are committed.
+func (v *jjVCS) CurrentBranch(ctx context.Context) (string, error) {
+	branches, err := RunGitCommand(ctx, v.dir, "for-each-ref", "--merged", "HEAD", "--sort=-committerdate", "--count=1", "--format=%(refname:short)", "refs/heads/")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(branches), nil
+}
+
+func (v *jjVCS) Checkout(ctx context.Context, branch, ref string) error {
+	target, err := v.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	_, err = RunGitCommand(ctx, v.dir, "show-ref", "--verify", "--quiet", "refs/heads/"+branch)
+	switch {
+	case err != nil:
+		_, err = runJJCommand(ctx, v.dir, "bookmark", "create", branch, "--revision", target)
+	case v.isAncestor(ctx, "refs/heads/"+branch, target):
+		_, err = runJJCommand(ctx, v.dir, "bookmark", "set", branch, "--revision", target)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := runJJCommand(ctx, v.dir, "new", branch); err != nil {
+		return err
+	}
+	if !v.isAncestor(ctx, target, "refs/heads/"+branch) {
+		return fmt.Errorf("switched to %s, but %s and container-use/ remote have diverged", branch, branch)
+	}
+	return nil
+}
+
+// Merge creates a merge change of the working copy and ref, and a new working-copy change on top of it.
+// An empty working-copy change is replaced rather than merged.
+func (v *jjVCS) Merge(ctx context.Context, ref, message string, w io.Writer) error {
+	target, err := v.resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	parent := "@"
+	if empty, err := runJJCommand(ctx, v.dir, "log", "--no-graph", "--revisions", "@", "--template", "empty"); err == nil && strings.TrimSpace(empty) == "true" {
+		parent = "@-"
+	}
+	if err := runInteractiveJJCommand(ctx, v.dir, w, "new", parent, target, "--message", message); err != nil {
+		return err
+	}
+	return runInteractiveJJCommand(ctx, v.dir, w, "new")
+}
+
+// Apply squashes ref into git's working tree, which jj snapshots into the working-copy change.
+func (v *jjVCS) Apply(ctx context.Context, ref string, w io.Writer) error {
+	if err := v.gitVCS.Apply(ctx, ref, w); err != nil {
+		return err
+	}
+	_, err := runJJCommand(ctx, v.dir, "status")
+	return err
+}
+
+// resolve returns the commit of a git ref: jj names remote branches differently (id@container-use).
+func (v *jjVCS) resolve(ctx context.Context, ref string) (string, error) {
+	commit, err := RunGitCommand(ctx, v.dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %s", ref)
+	}
+	return strings.TrimSpace(commit), nil
+}
+
+func (v *jjVCS) isAncestor(ctx context.Context, ancestor, descendant string) bool {
+	_, err := RunGitCommand(ctx, v.dir, "merge-base", "--is-ancestor", ancestor, descendant)
+	return err == nil
+}
+
+// runJJCommand executes a jj command in the specified directory.
+func runJJCommand(ctx context.Context, dir string, args ...string) (out string, rerr error) {
+	slog.Info(fmt.Sprintf("[%s] $ jj %s", dir, strings.Join(args, " ")))
+	defer func() {
+		slog.Info(fmt.Sprintf("[%s] $ jj %s (DONE)", dir, strings.Join(args, " ")), "err", rerr)
+	}()
+
+	cmd := exec.CommandContext(ctx, "jj", append([]string{"--no-pager", "--color=never"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("jj command failed (exit code %d): %w\nOutput: %s", exitErr.ExitCode(), err, string(output))
+		}
+		return "", fmt.Errorf("jj command failed: %w", err)
+	}
+	return string(output), nil
+}
+
+// runInteractiveJJCommand executes a jj command in the specified directory, writing its output to w.
+func runInteractiveJJCommand(ctx context.Context, dir string, w io.Writer, args ...string) (rerr error) {
+	slog.Info(fmt.Sprintf("[%s] $ jj %s", dir, strings.Join(args, " ")))
+	defer func() {
+		slog.Info(fmt.Sprintf("[%s] $ jj %s (DONE)", dir, strings.Join(args, " ")), "err", rerr)
+	}()
+
+	cmd := exec.CommandContext(ctx, "jj", append([]string{"--no-pager"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectVCS(t *testing.T) {
+	ctx := context.Background()
+	userRepo := t.TempDir()
+	runGit(t, userRepo, "init", "-b", "main")
+
+	assert.Equal(t, "git", detectVCS(ctx, userRepo).Name())
+
+	require.NoError(t, os.Mkdir(filepath.Join(userRepo, ".jj"), 0755))
+	if _, err := exec.LookPath("jj"); err != nil {
+		assert.Equal(t, "git", detectVCS(ctx, userRepo).Name(), "jj isn't installed")
+	}
+
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "jj"), []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	assert.Equal(t, "jj", detectVCS(ctx, userRepo).Name())
+
+	runGit(t, userRepo, "config", vcsConfig, "git")
+	assert.Equal(t, "git", detectVCS(ctx, userRepo).Name())
+}
+
+func TestJJCurrentBranch(t *testing.T) {
+	ctx := context.Background()
+	userRepo := t.TempDir()
+	setGitIdentity(t)
+
+	t.Setenv("GIT_COMMITTER_DATE", "2025-07-01T10:00:00Z")
+	writeFile(t, userRepo, "README.md", "hello\n")
+	runGit(t, userRepo, "init", "-b", "main")
+	runGit(t, userRepo, "add", ".")
+	runGit(t, userRepo, "commit", "-m", "init")
+	runGit(t, userRepo, "checkout", "-b", "cu-test-env")
+	t.Setenv("GIT_COMMITTER_DATE", "2025-07-01T11:00:00Z")
+	writeFile(t, userRepo, "README.md", "hello world\n")
+	runGit(t, userRepo, "commit", "-am", "environment change")
+	// jj leaves git's HEAD detached at the parent of the working-copy change, and doesn't move bookmarks.
+	runGit(t, userRepo, "checkout", "--detach")
+	writeFile(t, userRepo, "README.md", "hello jj\n")
+	runGit(t, userRepo, "commit", "-am", "user change")
+
+	vcs := &jjVCS{gitVCS{dir: userRepo}}
+	branch, err := vcs.CurrentBranch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "cu-test-env", branch, "the bookmark the working copy descends from")
+
+	branch, err = vcs.gitVCS.CurrentBranch(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, branch, "git sees a detached HEAD")
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// CreationComplete reports whether the environment's creation completed, so it can be used.
+func (r *Repository) CreationComplete(ctx context.Context, id string) bool {
+	return !r.isPartialCreate(ctx, id)
+}
+
+// RunningCommands returns the commands running in the environment, according to its event log:
+// the commands started and not finished yet. Background commands are never finished, so they're left out.
+func (r *Repository) RunningCommands(id string) ([]string, error) {
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+
+	running, _ := commandActivity(events)
+	return running, nil
+}
+
+// CommandFinished returns the event of the last run of a command containing pattern, if that run finished.
+// It returns nil while the command is running, or if it never ran.
+func (r *Repository) CommandFinished(id, pattern string) (*Event, error) {
+	events, err := r.events(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		command, _ := event.Data["command"].(string)
+		if !strings.Contains(command, pattern) {
+			continue
+		}
+		switch event.Type {
+		case environment.EventExecStarted:
+			return nil, nil
+		case environment.EventExecFinished:
+			return &event, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunningCommands(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+
+	running, err := repo.RunningCommands("test-env")
+	require.NoError(t, err)
+	assert.Empty(t, running)
+
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "go build ./..."})
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "npm run dev", "background": true})
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "go test ./..."})
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "go build ./...", "exit_code": 0})
+
+	running, err = repo.RunningCommands("test-env")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go test ./..."}, running)
+
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "go test ./...", "exit_code": 1})
+	running, err = repo.RunningCommands("test-env")
+	require.NoError(t, err)
+	assert.Empty(t, running)
+}
+
+func TestCommandFinished(t *testing.T) {
+	repo := &Repository{basePath: t.TempDir()}
+
+	event, err := repo.CommandFinished("test-env", "go test")
+	require.NoError(t, err)
+	assert.Nil(t, event, "never ran")
+
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "go test ./..."})
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "go test ./...", "exit_code": 1})
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "go test -run TestFoo ./..."})
+	repo.recordEvent("test-env", environment.EventExecStarted, map[string]any{"command": "ls"})
+
+	event, err = repo.CommandFinished("test-env", "go test")
+	require.NoError(t, err)
+	assert.Nil(t, event, "the last run is still running")
+
+	repo.recordEvent("test-env", environment.EventExecFinished, map[string]any{"command": "go test -run TestFoo ./...", "exit_code": 0})
+	event, err = repo.CommandFinished("test-env", "go test")
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, "go test -run TestFoo ./...", event.Data["command"])
+	assert.EqualValues(t, 0, event.Data["exit_code"])
+}
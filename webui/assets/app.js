@@ -0,0 +1,291 @@
+"use strict";
+
+const token = new URLSearchParams(window.location.search).get("token") || "";
+let current = null;
+let logSource = null;
+let terminal = null;
+let terminalSocket = null;
+
+async function api(method, path, body) {
+  const opts = { method, headers: { "X-Container-Use-Token": token } };
+  if (body !== undefined) {
+    opts.headers["Content-Type"] = "application/json";
+    opts.body = JSON.stringify(body);
+  }
+  const res = await fetch(path, opts);
+  if (!res.ok) {
+    let message = res.statusText;
+    try {
+      message = (await res.json()).error || message;
+    } catch (_) {}
+    throw new Error(message);
+  }
+  if (res.status === 204) {
+    return null;
+  }
+  const type = res.headers.get("Content-Type") || "";
+  return type.startsWith("application/json") ? res.json() : res.text();
+}
+
+function el(tag, className, text) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+function timeAgo(iso) {
+  const seconds = Math.floor((Date.now() - new Date(iso).getTime()) / 1000);
+  if (seconds < 60) return "just now";
+  if (seconds < 3600) return Math.floor(seconds / 60) + "m ago";
+  if (seconds < 86400) return Math.floor(seconds / 3600) + "h ago";
+  return Math.floor(seconds / 86400) + "d ago";
+}
+
+async function loadEnvironments() {
+  const nav = document.getElementById("environments");
+  nav.replaceChildren();
+  try {
+    const envs = await api("GET", "/api/environments");
+    if (envs.length === 0) {
+      nav.append(el("div", "env muted", "No environments"));
+    }
+    for (const env of envs) {
+      const item = el("div", "env");
+      item.dataset.id = env.id;
+      item.append(el("div", "id", env.id));
+      item.append(el("div", "title", env.title));
+      item.append(el("div", "meta", "updated " + timeAgo(env.updated_at)));
+      item.addEventListener("click", () => select(env.id));
+      if (env.id === current) item.classList.add("selected");
+      nav.append(item);
+    }
+  } catch (err) {
+    nav.append(el("div", "env exit-error", err.message));
+  }
+}
+
+// Strings and keywords, matched in a single pass over the raw line so neither is found inside the other.
+const tokens = /("[^"]*"|'[^']*'|`[^`]*`)|\b(func|return|if|else|for|range|import|package|type|struct|const|var|def|class|from|function|let|export|async|await)\b/g;
+
+function highlight(line, node) {
+  let last = 0;
+  for (const match of line.matchAll(tokens)) {
+    if (match.index > last) {
+      node.append(document.createTextNode(line.slice(last, match.index)));
+    }
+    node.append(el("span", match[1] !== undefined ? "diff-string" : "diff-keyword", match[0]));
+    last = match.index + match[0].length;
+  }
+  if (last < line.length) {
+    node.append(document.createTextNode(line.slice(last)));
+  }
+}
+
+function renderDiff(text) {
+  const pre = document.getElementById("diff");
+  pre.replaceChildren();
+  if (!text.trim()) {
+    pre.append(el("span", "muted", "No changes"));
+    return;
+  }
+  for (const line of text.split("\n")) {
+    let cls = "";
+    if (line.startsWith("diff --git") || line.startsWith("+++") || line.startsWith("---")) {
+      cls = "diff-file";
+    } else if (line.startsWith("@@")) {
+      cls = "diff-hunk";
+    } else if (line.startsWith("+")) {
+      cls = "diff-add";
+    } else if (line.startsWith("-")) {
+      cls = "diff-del";
+    }
+    const node = el("div", cls);
+    if (cls === "diff-file" || cls === "diff-hunk") {
+      node.textContent = line;
+    } else {
+      highlight(line, node);
+    }
+    pre.append(node);
+  }
+}
+
+function renderLog(data) {
+  const log = document.getElementById("log");
+  log.replaceChildren();
+  for (const commit of data.commits || []) {
+    const node = el("div", "commit");
+    const header = el("div");
+    header.append(el("span", "hash", commit.short_hash + " "));
+    header.append(document.createTextNode(commit.message + " "));
+    header.append(el("span", "muted", commit.relative_time));
+    node.append(header);
+    if (commit.notes) {
+      node.append(el("pre", "", commit.notes));
+    }
+    log.append(node);
+  }
+}
+
+function streamLog(id) {
+  if (logSource) logSource.close();
+  logSource = new EventSource(`/api/environments/${encodeURIComponent(id)}/log?token=${encodeURIComponent(token)}`);
+  logSource.onmessage = (event) => renderLog(JSON.parse(event.data));
+  logSource.addEventListener("error", (event) => {
+    if (event.data) {
+      document.getElementById("log").textContent = JSON.parse(event.data);
+    }
+  });
+}
+
+async function select(id) {
+  current = id;
+  document.querySelectorAll("nav .env").forEach((node) => {
+    node.classList.toggle("selected", node.dataset.id === id);
+  });
+  document.getElementById("details").hidden = false;
+  document.getElementById("env-id").textContent = id;
+  document.getElementById("run-output").textContent = "";
+  closeTerminal();
+  if (!document.getElementById("terminal").hidden) openTerminal();
+
+  try {
+    const info = await api("GET", `/api/environments/${encodeURIComponent(id)}`);
+    document.getElementById("env-title").textContent = info.state.title || "";
+    renderDiff(await api("GET", `/api/environments/${encodeURIComponent(id)}/diff`));
+  } catch (err) {
+    document.getElementById("diff").textContent = err.message;
+  }
+  streamLog(id);
+}
+
+function showTab(name) {
+  document.querySelectorAll(".tabs button").forEach((button) => {
+    button.classList.toggle("active", button.dataset.tab === name);
+  });
+  for (const panel of ["diff", "log", "terminal", "run"]) {
+    document.getElementById(panel).hidden = panel !== name;
+  }
+  if (name === "run") {
+    document.getElementById("run-input").focus();
+  }
+  if (name === "terminal") {
+    openTerminal();
+  }
+}
+
+// openTerminal attaches the Terminal tab to `container-use terminal` in the selected environment, unless it
+// already is. Its changes to the workdir are merged into the environment when the shell exits.
+function openTerminal() {
+  const node = document.getElementById("terminal");
+  if (!terminal) {
+    terminal = new Terminal(node, (data) => sendTerminal({ input: data }));
+    window.addEventListener("resize", fitTerminal);
+  }
+  node.focus();
+  if (terminalSocket || !current) return;
+
+  terminal.reset();
+  const scheme = window.location.protocol === "https:" ? "wss:" : "ws:";
+  const socket = new WebSocket(`${scheme}//${window.location.host}/api/environments/${encodeURIComponent(current)}/terminal?token=${encodeURIComponent(token)}`);
+  socket.binaryType = "arraybuffer";
+  const decoder = new TextDecoder();
+  socket.onopen = () => fitTerminal(true);
+  socket.onmessage = (event) => {
+    terminal.write(typeof event.data === "string" ? event.data : decoder.decode(event.data, { stream: true }));
+  };
+  socket.onclose = () => {
+    if (terminalSocket !== socket) return;
+    terminalSocket = null;
+    terminal.write("\r\n\x1b[2m[terminal closed: press Enter to open a new one]\x1b[0m\r\n");
+  };
+  terminalSocket = socket;
+}
+
+function closeTerminal() {
+  if (!terminalSocket) return;
+  const socket = terminalSocket;
+  terminalSocket = null;
+  socket.close();
+}
+
+function sendTerminal(message) {
+  if (terminalSocket && terminalSocket.readyState === WebSocket.OPEN) {
+    terminalSocket.send(JSON.stringify(message));
+  } else if (message.input === "\r") {
+    openTerminal();
+  }
+}
+
+// fitTerminal sizes the terminal to its panel, and tells the PTY when the size changed.
+function fitTerminal(force) {
+  const node = document.getElementById("terminal");
+  if (!terminal || node.hidden) return;
+  const probe = el("span", "", "W");
+  node.append(probe);
+  const { width, height } = probe.getBoundingClientRect();
+  probe.remove();
+  if (!width || !height) return;
+  const style = window.getComputedStyle(node);
+  const cols = Math.floor((node.clientWidth - parseFloat(style.paddingLeft) - parseFloat(style.paddingRight)) / width);
+  const rows = Math.floor((node.clientHeight - parseFloat(style.paddingTop) - parseFloat(style.paddingBottom)) / height);
+  if (terminal.resize(cols, rows) || force === true) {
+    sendTerminal({ cols: terminal.cols, rows: terminal.rows });
+  }
+}
+
+async function runAction(action) {
+  if (!current) return;
+  if (!window.confirm(`${action} environment ${current}?`)) return;
+  const path = `/api/environments/${encodeURIComponent(current)}`;
+  try {
+    if (action === "delete") {
+      await api("DELETE", path);
+      document.getElementById("details").hidden = true;
+      current = null;
+      if (logSource) logSource.close();
+      closeTerminal();
+    } else {
+      const result = await api("POST", `${path}/${action}`);
+      window.alert(result.output || `${action} succeeded`);
+    }
+  } catch (err) {
+    window.alert(err.message);
+  }
+  loadEnvironments();
+}
+
+document.getElementById("run-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const input = document.getElementById("run-input");
+  const output = document.getElementById("run-output");
+  const command = input.value;
+  if (!command.trim() || !current) return;
+  input.value = "";
+  input.disabled = true;
+
+  output.append(el("span", "prompt", "$ "), document.createTextNode(command + "\n"));
+  try {
+    const result = await api("POST", `/api/environments/${encodeURIComponent(current)}/exec`, { command });
+    output.append(document.createTextNode(result.stdout));
+    if (result.stderr) output.append(document.createTextNode(result.stderr));
+    if (result.exit_code !== 0) {
+      output.append(el("span", "exit-error", `exit ${result.exit_code}\n`));
+    }
+  } catch (err) {
+    output.append(el("span", "exit-error", err.message + "\n"));
+  }
+  input.disabled = false;
+  input.focus();
+  output.scrollTop = output.scrollHeight;
+});
+
+document.querySelectorAll(".tabs button").forEach((button) => {
+  button.addEventListener("click", () => showTab(button.dataset.tab));
+});
+document.querySelectorAll(".actions button").forEach((button) => {
+  button.addEventListener("click", () => runAction(button.dataset.action));
+});
+document.getElementById("refresh").addEventListener("click", loadEnvironments);
+
+loadEnvironments();
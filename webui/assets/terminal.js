@@ -0,0 +1,496 @@
+"use strict";
+
+// A terminal emulator for the environment's terminal, rendered with el(). It implements the subset of
+// xterm (TERM=xterm-256color) shells and full-screen programs rely on: cursor movement, erasing, scroll
+// regions, the alternate screen and colors.
+
+const palette = [
+  "#282c34", "#e06c75", "#98c379", "#e5c07b", "#61afef", "#c678dd", "#56b6c2", "#abb2bf",
+  "#5c6370", "#ef8891", "#b5e890", "#ffd68a", "#8cc8ff", "#de9bf0", "#7fd4df", "#ffffff",
+];
+for (let i = 0; i < 216; i++) {
+  const level = (n) => (n === 0 ? 0 : 55 + n * 40);
+  palette.push(`rgb(${level(Math.floor(i / 36))}, ${level(Math.floor(i / 6) % 6)}, ${level(i % 6)})`);
+}
+for (let i = 0; i < 24; i++) {
+  const gray = 8 + i * 10;
+  palette.push(`rgb(${gray}, ${gray}, ${gray})`);
+}
+
+const defaultStyle = Object.freeze({});
+
+// Keys sent as escape sequences. Cursor keys change in application cursor mode (ESC [?1h).
+const keySequences = {
+  Enter: "\r", Backspace: "\x7f", Tab: "\t", Escape: "\x1b",
+  Home: "\x1b[H", End: "\x1b[F", Insert: "\x1b[2~", Delete: "\x1b[3~", PageUp: "\x1b[5~", PageDown: "\x1b[6~",
+  F1: "\x1bOP", F2: "\x1bOQ", F3: "\x1bOR", F4: "\x1bOS", F5: "\x1b[15~", F6: "\x1b[17~",
+  F7: "\x1b[18~", F8: "\x1b[19~", F9: "\x1b[20~", F10: "\x1b[21~", F11: "\x1b[23~", F12: "\x1b[24~",
+};
+const cursorKeys = { ArrowUp: "A", ArrowDown: "B", ArrowRight: "C", ArrowLeft: "D" };
+
+class Terminal {
+  // node is the element the terminal renders into, and onData receives the input to send to the terminal.
+  constructor(node, onData) {
+    this.node = node;
+    this.onData = onData;
+    this.cols = 80;
+    this.rows = 24;
+    this.reset();
+    node.tabIndex = 0;
+    node.addEventListener("keydown", (event) => this.keydown(event));
+    node.addEventListener("paste", (event) => {
+      event.preventDefault();
+      const text = event.clipboardData.getData("text").replace(/\r?\n/g, "\r");
+      this.onData(this.bracketedPaste ? `\x1b[200~${text}\x1b[201~` : text);
+    });
+  }
+
+  reset() {
+    this.style = defaultStyle;
+    this.x = 0;
+    this.y = 0;
+    this.saved = { x: 0, y: 0, style: defaultStyle };
+    this.top = 0;
+    this.bottom = this.rows - 1;
+    this.wrapPending = false;
+    this.cursorVisible = true;
+    this.applicationCursor = false;
+    this.bracketedPaste = false;
+    this.primary = null;
+    this.lines = this.blankLines(this.rows);
+    this.state = "text";
+    this.render();
+  }
+
+  blankLine() {
+    return Array.from({ length: this.cols }, () => [" ", defaultStyle]);
+  }
+
+  blankLines(count) {
+    return Array.from({ length: count }, () => this.blankLine());
+  }
+
+  resize(cols, rows) {
+    cols = Math.max(cols, 10);
+    rows = Math.max(rows, 2);
+    if (cols === this.cols && rows === this.rows) return false;
+    for (const screen of [this.lines, this.primary]) {
+      if (!screen) continue;
+      for (const line of screen) {
+        line.length = Math.min(line.length, cols);
+        while (line.length < cols) line.push([" ", defaultStyle]);
+      }
+    }
+    this.cols = cols;
+    this.rows = rows;
+    while (this.lines.length > rows) this.lines.shift();
+    while (this.lines.length < rows) this.lines.push(this.blankLine());
+    this.top = 0;
+    this.bottom = rows - 1;
+    this.x = Math.min(this.x, cols - 1);
+    this.y = Math.min(this.y, rows - 1);
+    this.render();
+    return true;
+  }
+
+  write(text) {
+    for (const ch of text) {
+      this.consume(ch);
+    }
+    this.scheduleRender();
+  }
+
+  consume(ch) {
+    switch (this.state) {
+      case "escape":
+        this.escape(ch);
+        return;
+      case "csi":
+        if (ch >= "0" && ch <= "9" || ch === ";" || ch === ":") {
+          this.params += ch;
+        } else if (ch === "?" || ch === ">" || ch === "=" || ch === "!") {
+          this.prefix += ch;
+        } else if (ch >= "@" && ch <= "~") {
+          this.state = "text";
+          this.csi(ch, this.params.split(/[;:]/).map((p) => (p === "" ? 0 : parseInt(p, 10))));
+        }
+        return;
+      case "osc":
+        // Window titles and the like are ignored, up to BEL or ST (ESC \).
+        if (ch === "\x07") this.state = "text";
+        else if (ch === "\x1b") this.state = "osc-escape";
+        return;
+      case "osc-escape":
+        this.state = ch === "\\" ? "text" : "osc";
+        return;
+      case "charset":
+        this.state = "text";
+        return;
+    }
+
+    switch (ch) {
+      case "\x1b":
+        this.state = "escape";
+        return;
+      case "\r":
+        this.x = 0;
+        this.wrapPending = false;
+        return;
+      case "\n":
+      case "\x0b":
+      case "\x0c":
+        this.lineFeed();
+        return;
+      case "\b":
+        this.x = Math.max(this.x - 1, 0);
+        this.wrapPending = false;
+        return;
+      case "\t":
+        this.x = Math.min((Math.floor(this.x / 8) + 1) * 8, this.cols - 1);
+        return;
+      case "\x07":
+      case "\x0e":
+      case "\x0f":
+        return;
+    }
+    if (ch < " ") return;
+
+    if (this.wrapPending) {
+      this.x = 0;
+      this.lineFeed();
+    }
+    this.lines[this.y][this.x] = [ch, this.style];
+    if (this.x === this.cols - 1) {
+      this.wrapPending = true;
+    } else {
+      this.x++;
+    }
+  }
+
+  escape(ch) {
+    this.state = "text";
+    switch (ch) {
+      case "[":
+        this.state = "csi";
+        this.params = "";
+        this.prefix = "";
+        break;
+      case "]":
+        this.state = "osc";
+        break;
+      case "(":
+      case ")":
+        this.state = "charset";
+        break;
+      case "7":
+        this.saved = { x: this.x, y: this.y, style: this.style };
+        break;
+      case "8":
+        ({ x: this.x, y: this.y, style: this.style } = this.saved);
+        break;
+      case "D":
+        this.lineFeed();
+        break;
+      case "E":
+        this.x = 0;
+        this.lineFeed();
+        break;
+      case "M":
+        if (this.y === this.top) this.scrollDown(1);
+        else this.y = Math.max(this.y - 1, 0);
+        break;
+      case "c":
+        this.reset();
+        break;
+    }
+  }
+
+  csi(final, params) {
+    const n = params[0] || 1;
+    this.wrapPending = false;
+    if (this.prefix === "?") {
+      if (final === "h" || final === "l") this.setMode(params, final === "h");
+      return;
+    }
+    if (this.prefix) return;
+
+    switch (final) {
+      case "A":
+        this.y = Math.max(this.y - n, this.y >= this.top ? this.top : 0);
+        break;
+      case "B":
+        this.y = Math.min(this.y + n, this.y <= this.bottom ? this.bottom : this.rows - 1);
+        break;
+      case "C":
+        this.x = Math.min(this.x + n, this.cols - 1);
+        break;
+      case "D":
+        this.x = Math.max(this.x - n, 0);
+        break;
+      case "E":
+        this.x = 0;
+        this.y = Math.min(this.y + n, this.rows - 1);
+        break;
+      case "F":
+        this.x = 0;
+        this.y = Math.max(this.y - n, 0);
+        break;
+      case "G":
+      case "`":
+        this.x = Math.min(n - 1, this.cols - 1);
+        break;
+      case "d":
+        this.y = Math.min(n - 1, this.rows - 1);
+        break;
+      case "H":
+      case "f":
+        this.y = Math.min((params[0] || 1) - 1, this.rows - 1);
+        this.x = Math.min((params[1] || 1) - 1, this.cols - 1);
+        break;
+      case "J":
+        this.eraseDisplay(params[0]);
+        break;
+      case "K":
+        this.eraseLine(params[0]);
+        break;
+      case "L":
+        if (this.y >= this.top && this.y <= this.bottom) {
+          for (let i = 0; i < n; i++) {
+            this.lines.splice(this.bottom, 1);
+            this.lines.splice(this.y, 0, this.blankLine());
+          }
+        }
+        break;
+      case "M":
+        if (this.y >= this.top && this.y <= this.bottom) {
+          for (let i = 0; i < n; i++) {
+            this.lines.splice(this.y, 1);
+            this.lines.splice(this.bottom, 0, this.blankLine());
+          }
+        }
+        break;
+      case "P": {
+        const line = this.lines[this.y];
+        line.splice(this.x, Math.min(n, this.cols - this.x));
+        while (line.length < this.cols) line.push([" ", defaultStyle]);
+        break;
+      }
+      case "@": {
+        const line = this.lines[this.y];
+        line.splice(this.x, 0, ...Array.from({ length: n }, () => [" ", defaultStyle]));
+        line.length = this.cols;
+        break;
+      }
+      case "X":
+        for (let i = this.x; i < Math.min(this.x + n, this.cols); i++) {
+          this.lines[this.y][i] = [" ", defaultStyle];
+        }
+        break;
+      case "S":
+        this.scrollUp(n);
+        break;
+      case "T":
+        this.scrollDown(n);
+        break;
+      case "r":
+        this.top = Math.min((params[0] || 1) - 1, this.rows - 1);
+        this.bottom = Math.min((params[1] || this.rows) - 1, this.rows - 1);
+        this.x = 0;
+        this.y = 0;
+        break;
+      case "s":
+        this.saved = { x: this.x, y: this.y, style: this.style };
+        break;
+      case "u":
+        ({ x: this.x, y: this.y, style: this.style } = this.saved);
+        break;
+      case "m":
+        this.setStyle(params);
+        break;
+      case "n":
+        if (params[0] === 6) this.onData(`\x1b[${this.y + 1};${this.x + 1}R`);
+        else if (params[0] === 5) this.onData("\x1b[0n");
+        break;
+      case "c":
+        this.onData("\x1b[?1;2c");
+        break;
+    }
+  }
+
+  setMode(params, enabled) {
+    for (const mode of params) {
+      switch (mode) {
+        case 1:
+          this.applicationCursor = enabled;
+          break;
+        case 25:
+          this.cursorVisible = enabled;
+          break;
+        case 2004:
+          this.bracketedPaste = enabled;
+          break;
+        case 47:
+        case 1047:
+        case 1049:
+          if (enabled && !this.primary) {
+            this.saved = { x: this.x, y: this.y, style: this.style };
+            this.primary = this.lines;
+            this.lines = this.blankLines(this.rows);
+          } else if (!enabled && this.primary) {
+            this.lines = this.primary;
+            this.primary = null;
+            ({ x: this.x, y: this.y, style: this.style } = this.saved);
+          }
+          break;
+      }
+    }
+  }
+
+  setStyle(params) {
+    const style = { ...this.style };
+    for (let i = 0; i < params.length; i++) {
+      const p = params[i];
+      if (p === 0) {
+        for (const key of Object.keys(style)) delete style[key];
+      } else if (p === 1) style.bold = true;
+      else if (p === 2) style.dim = true;
+      else if (p === 3) style.italic = true;
+      else if (p === 4) style.underline = true;
+      else if (p === 7) style.inverse = true;
+      else if (p === 22) {
+        delete style.bold;
+        delete style.dim;
+      }
+      else if (p === 23) delete style.italic;
+      else if (p === 24) delete style.underline;
+      else if (p === 27) delete style.inverse;
+      else if (p >= 30 && p <= 37) style.fg = palette[p - 30];
+      else if (p >= 90 && p <= 97) style.fg = palette[p - 90 + 8];
+      else if (p >= 40 && p <= 47) style.bg = palette[p - 40];
+      else if (p >= 100 && p <= 107) style.bg = palette[p - 100 + 8];
+      else if (p === 39) delete style.fg;
+      else if (p === 49) delete style.bg;
+      else if (p === 38 || p === 48) {
+        let color;
+        if (params[i + 1] === 5) {
+          color = palette[params[i + 2]];
+          i += 2;
+        } else if (params[i + 1] === 2) {
+          color = `rgb(${params[i + 2] || 0}, ${params[i + 3] || 0}, ${params[i + 4] || 0})`;
+          i += 4;
+        }
+        if (color) style[p === 38 ? "fg" : "bg"] = color;
+      }
+    }
+    this.style = Object.keys(style).length ? Object.freeze(style) : defaultStyle;
+  }
+
+  lineFeed() {
+    this.wrapPending = false;
+    if (this.y === this.bottom) {
+      this.scrollUp(1);
+    } else if (this.y < this.rows - 1) {
+      this.y++;
+    }
+  }
+
+  scrollUp(n) {
+    for (let i = 0; i < n; i++) {
+      this.lines.splice(this.top, 1);
+      this.lines.splice(this.bottom, 0, this.blankLine());
+    }
+  }
+
+  scrollDown(n) {
+    for (let i = 0; i < n; i++) {
+      this.lines.splice(this.bottom, 1);
+      this.lines.splice(this.top, 0, this.blankLine());
+    }
+  }
+
+  eraseLine(mode) {
+    const line = this.lines[this.y];
+    const [from, to] = mode === 1 ? [0, this.x + 1] : mode === 2 ? [0, this.cols] : [this.x, this.cols];
+    for (let i = from; i < to; i++) line[i] = [" ", defaultStyle];
+  }
+
+  eraseDisplay(mode) {
+    if (mode === 2 || mode === 3) {
+      this.lines = this.blankLines(this.rows);
+      return;
+    }
+    this.eraseLine(mode);
+    const [from, to] = mode === 1 ? [0, this.y] : [this.y + 1, this.rows];
+    for (let i = from; i < to; i++) this.lines[i] = this.blankLine();
+  }
+
+  keydown(event) {
+    if (event.metaKey || (event.ctrlKey && event.shiftKey)) return;
+    let data;
+    if (cursorKeys[event.key]) {
+      data = (this.applicationCursor ? "\x1bO" : "\x1b[") + cursorKeys[event.key];
+    } else if (keySequences[event.key]) {
+      data = event.shiftKey && event.key === "Tab" ? "\x1b[Z" : keySequences[event.key];
+    } else if (event.ctrlKey && event.key.length === 1) {
+      const code = event.key.toUpperCase().charCodeAt(0);
+      if (code >= 64 && code <= 95) data = String.fromCharCode(code - 64);
+      else if (event.key === " ") data = "\x00";
+    } else if (event.key.length === 1) {
+      data = event.key;
+    }
+    if (data === undefined) return;
+    event.preventDefault();
+    this.onData(event.altKey ? "\x1b" + data : data);
+  }
+
+  scheduleRender() {
+    if (this.renderPending) return;
+    this.renderPending = true;
+    requestAnimationFrame(() => {
+      this.renderPending = false;
+      this.render();
+    });
+  }
+
+  render() {
+    const rows = this.lines.map((line, y) => {
+      const row = el("div", "terminal-row");
+      let text = "";
+      let style = null;
+      const flush = () => {
+        if (text) row.append(styledSpan(text, style));
+        text = "";
+      };
+      line.forEach(([ch, cellStyle], x) => {
+        const cursor = this.cursorVisible && x === this.x && y === this.y;
+        if (cursor) {
+          flush();
+          const span = styledSpan(ch, cellStyle);
+          span.classList.add("terminal-cursor");
+          row.append(span);
+          style = null;
+          return;
+        }
+        if (cellStyle !== style) flush();
+        style = cellStyle;
+        text += ch;
+      });
+      flush();
+      return row;
+    });
+    this.node.replaceChildren(...rows);
+  }
+}
+
+function styledSpan(text, style) {
+  const span = el("span", "", text);
+  let { fg, bg } = style;
+  if (style.inverse) [fg, bg] = [bg || "#111418", fg || "#e6e6e6"];
+  if (fg) span.style.color = fg;
+  if (bg) span.style.background = bg;
+  if (style.bold) span.style.fontWeight = "bold";
+  if (style.dim) span.style.opacity = "0.6";
+  if (style.italic) span.style.fontStyle = "italic";
+  if (style.underline) span.style.textDecoration = "underline";
+  return span;
+}
@@ -0,0 +1,318 @@
+// Package webui serves a local browser dashboard for reviewing environments.
+//
+// All assets are embedded in the binary. The server only binds to the address it
+// is given (loopback by default) and every API request must carry the session
+// token printed at startup, so other pages open in the browser can't drive it.
+package webui
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/repository"
+)
+
+//go:embed assets
+var assets embed.FS
+
+const (
+	tokenHeader     = "X-Container-Use-Token"
+	logPollInterval = 2 * time.Second
+)
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errNoDagger       = errors.New("running commands requires a dagger connection")
+)
+
+type Server struct {
+	repo  *repository.Repository
+	dag   *dagger.Client
+	self  string
+	token string
+}
+
+// NewToken generates a random session token.
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// New returns the dashboard of the repository. self is the container-use executable, which terminals run.
+func New(repo *repository.Repository, dag *dagger.Client, self, token string) *Server {
+	return &Server{
+		repo:  repo,
+		dag:   dag,
+		self:  self,
+		token: token,
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	static, _ := fs.Sub(assets, "assets")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+
+	mux.HandleFunc("GET /api/environments", s.authorized(s.handleList))
+	mux.HandleFunc("GET /api/environments/{id}", s.authorized(s.handleInfo))
+	mux.HandleFunc("GET /api/environments/{id}/diff", s.authorized(s.handleDiff))
+	mux.HandleFunc("GET /api/environments/{id}/log", s.authorized(s.handleLogStream))
+	mux.HandleFunc("POST /api/environments/{id}/exec", s.authorized(s.handleExec))
+	mux.HandleFunc("GET /api/environments/{id}/terminal", s.authorized(s.handleTerminal))
+	mux.HandleFunc("POST /api/environments/{id}/merge", s.authorized(s.handleMerge))
+	mux.HandleFunc("POST /api/environments/{id}/apply", s.authorized(s.handleApply))
+	mux.HandleFunc("DELETE /api/environments/{id}", s.authorized(s.handleDelete))
+
+	return mux
+}
+
+// Serve serves the dashboard on the listener until the context is cancelled.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(tokenHeader)
+		if token == "" {
+			// EventSource and WebSocket can't set headers, so streaming endpoints pass it as a query parameter.
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type environmentSummary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	envs, err := s.repo.List(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	summaries := make([]environmentSummary, len(envs))
+	for i, env := range envs {
+		summaries[i] = environmentSummary{
+			ID:        env.ID,
+			Title:     env.State.Title,
+			CreatedAt: env.State.CreatedAt,
+			UpdatedAt: env.State.UpdatedAt,
+		}
+	}
+	writeJSON(w, summaries)
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	envInfo, err := s.repo.Info(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	envInfo.State.Container = ""
+	writeJSON(w, envInfo)
+}
+
+func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := s.repo.Diff(r.Context(), r.PathValue("id"), repository.DiffOptions{}, &buf); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// handleLogStream streams the environment log as server-sent events, pushing a new
+// event whenever the log changes.
+func (s *Server) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ctx := r.Context()
+	id := r.PathValue("id")
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		var buf bytes.Buffer
+		if err := s.repo.Log(ctx, id, false, true, &buf); err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", jsonString(err.Error()))
+			flusher.Flush()
+			return
+		}
+		if current := buf.String(); current != last {
+			last = current
+			fmt.Fprintf(w, "data: %s\n\n", bytes.ReplaceAll(bytes.TrimSpace(buf.Bytes()), []byte("\n"), nil))
+			flusher.Flush()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type execRequest struct {
+	Command string `json:"command"`
+	Shell   string `json:"shell"`
+}
+
+type execResponse struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// handleExec runs a single command in the environment, and its changes are committed like
+// any other `container-use exec`. It's not a terminal: commands get no TTY nor input, so
+// interactive programs need `container-use terminal`.
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	var req execRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errInvalidRequest, err))
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeError(w, fmt.Errorf("%w: command is required", errInvalidRequest))
+		return
+	}
+	if req.Shell == "" {
+		req.Shell = "sh"
+	}
+
+	ctx := r.Context()
+	id := r.PathValue("id")
+	if _, err := s.repo.Info(ctx, id); err != nil {
+		writeError(w, err)
+		return
+	}
+	if s.dag == nil {
+		writeError(w, errNoDagger)
+		return
+	}
+
+	env, err := s.repo.Get(ctx, s.dag, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	stdout, stderr, exitCode, err := env.RunWithExitCode(ctx, req.Command, req.Shell, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.repo.Update(ctx, env, ""); err != nil {
+		writeError(w, fmt.Errorf("command executed but failed to update repository: %w", err))
+		return
+	}
+
+	writeJSON(w, execResponse{Stdout: stdout, Stderr: stderr, ExitCode: exitCode})
+}
+
+func (s *Server) handleMerge(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := s.repo.Merge(r.Context(), r.PathValue("id"), &buf); err != nil {
+		writeError(w, fmt.Errorf("%w\n%s", err, buf.String()))
+		return
+	}
+	writeJSON(w, map[string]string{"output": buf.String()})
+}
+
+func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := s.repo.Apply(r.Context(), r.PathValue("id"), &buf); err != nil {
+		writeError(w, fmt.Errorf("%w\n%s", err, buf.String()))
+		return
+	}
+	writeJSON(w, map[string]string{"output": buf.String()})
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if err := s.repo.Delete(r.Context(), r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode response", "err", err)
+	}
+}
+
+// writeError writes err as a JSON error, with the status of the errors the client can do something about.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, repository.ErrEnvironmentNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errInvalidRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, errNoDagger):
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func jsonString(s string) string {
+	out, _ := json.Marshal(s)
+	return string(out)
+}
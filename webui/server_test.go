@@ -0,0 +1,184 @@
+package webui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+const testToken = "secret"
+
+// fakeTerminal stands in for container-use in terminals: it prints its arguments, then echoes a line.
+const fakeTerminal = `#!/bin/sh
+echo "$@"
+read line
+echo "read $line"
+`
+
+// newTestServer serves the dashboard of a repository with an environment, test-env, and no dagger connection.
+// Terminals run fakeTerminal.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ctx := context.Background()
+	for _, role := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_"+role+"_NAME", "Test")
+		t.Setenv("GIT_"+role+"_EMAIL", "test@example.com")
+	}
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	userRepo := t.TempDir()
+	git(userRepo, "init", "-b", "main")
+	git(userRepo, "commit", "--allow-empty", "-m", "init")
+	repo, err := repository.OpenWithBasePath(ctx, userRepo, t.TempDir())
+	require.NoError(t, err)
+
+	state, err := (&environment.State{Title: "Test environment", Config: environment.DefaultConfig()}).Marshal()
+	require.NoError(t, err)
+	fork := git(userRepo, "remote", "get-url", "container-use")
+	git(fork, "fetch", userRepo, "main:test-env")
+	git(fork, "notes", "--ref", "container-use-state", "add", "-m", string(state), "test-env")
+
+	self := filepath.Join(t.TempDir(), "container-use")
+	require.NoError(t, os.WriteFile(self, []byte(fakeTerminal), 0o755))
+
+	server := httptest.NewServer(New(repo, nil, self, testToken).Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, server *httptest.Server, path, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set(tokenHeader, token)
+	}
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAuthorization(t *testing.T) {
+	server := newTestServer(t)
+
+	assert.Equal(t, http.StatusUnauthorized, get(t, server, "/api/environments", "").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get(t, server, "/api/environments", "wrong").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get(t, server, "/api/environments?token=wrong", "").StatusCode)
+
+	assert.Equal(t, http.StatusOK, get(t, server, "/api/environments", testToken).StatusCode)
+	assert.Equal(t, http.StatusOK, get(t, server, "/api/environments?token="+testToken, "").StatusCode,
+		"streaming endpoints pass the token as a query parameter")
+
+	assert.Equal(t, http.StatusNotFound, get(t, server, "/api/environments/missing-env", testToken).StatusCode)
+
+	// Assets don't need the token, which is only in the URL the user opens.
+	assert.Equal(t, http.StatusOK, get(t, server, "/app.js", "").StatusCode)
+}
+
+func TestLogStream(t *testing.T) {
+	server := newTestServer(t)
+
+	resp := get(t, server, "/api/environments/test-env/log?token="+testToken, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	data, ok := strings.CutPrefix(line, "data: ")
+	require.True(t, ok, line)
+	assert.Contains(t, data, `"commits"`)
+
+	resp = get(t, server, "/api/environments/missing-env/log?token="+testToken, "")
+	reader := bufio.NewReader(resp.Body)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event: error\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, "not found")
+}
+
+func TestExec(t *testing.T) {
+	server := newTestServer(t)
+
+	post := func(path, body string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(tokenHeader, testToken)
+		client := server.Client()
+		client.Timeout = 10 * time.Second
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var out strings.Builder
+		_, err = bufio.NewReader(resp.Body).WriteTo(&out)
+		require.NoError(t, err)
+		return resp.StatusCode, out.String()
+	}
+
+	status, body := post("/api/environments/test-env/exec", "{")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, `"error":"invalid request`)
+
+	status, _ = post("/api/environments/test-env/exec", `{"command": " "}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, body = post("/api/environments/missing-env/exec", `{"command": "ls"}`)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Contains(t, body, "not found")
+
+	status, body = post("/api/environments/test-env/exec", `{"command": "ls"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Contains(t, body, "requires a dagger connection")
+}
+
+func TestTerminal(t *testing.T) {
+	server := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/environments/%s/terminal?token=" + testToken
+
+	_, err := websocket.Dial(fmt.Sprintf(url, "test-env"), "", "http://evil.example.com")
+	assert.Error(t, err, "pages of other origins can't open terminals")
+	assert.Equal(t, http.StatusNotFound, get(t, server, "/api/environments/missing-env/terminal?token="+testToken, "").StatusCode)
+
+	ws, err := websocket.Dial(fmt.Sprintf(url, "test-env"), "", server.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+	require.NoError(t, ws.SetDeadline(time.Now().Add(10*time.Second)))
+
+	var output strings.Builder
+	readUntil := func(s string) {
+		t.Helper()
+		for !strings.Contains(output.String(), s) {
+			var data []byte
+			require.NoError(t, websocket.Message.Receive(ws, &data), output.String())
+			output.Write(data)
+		}
+	}
+	readUntil("terminal test-env")
+	require.NoError(t, websocket.JSON.Send(ws, terminalMessage{Cols: 100, Rows: 30}))
+	require.NoError(t, websocket.JSON.Send(ws, terminalMessage{Input: "hello\r"}))
+	readUntil("read hello")
+}
@@ -0,0 +1,108 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/net/websocket"
+)
+
+// terminalHangupDelay is how long a terminal has to exit once the page is gone.
+const terminalHangupDelay = 10 * time.Second
+
+// terminalMessage is a message from the page's terminal: the keys typed, or the terminal's new size.
+type terminalMessage struct {
+	Input string `json:"input,omitempty"`
+	Cols  uint16 `json:"cols,omitempty"`
+	Rows  uint16 `json:"rows,omitempty"`
+}
+
+// handleTerminal runs `container-use terminal` in a PTY and attaches it to a websocket, so the page gets
+// the same terminal as the command line: changes made to the workdir are merged into the environment when
+// the shell exits. The terminal's output is sent as binary messages, and the page sends terminalMessages.
+func (s *Server) handleTerminal(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := s.repo.Info(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	websocket.Server{
+		Handshake: checkOrigin,
+		Handler:   func(ws *websocket.Conn) { s.serveTerminal(ws, id) },
+	}.ServeHTTP(w, r)
+}
+
+// checkOrigin refuses websockets opened by pages of other origins, which browsers don't prevent.
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || origin.Host != r.Host {
+		return fmt.Errorf("%w: origin %q not allowed", errInvalidRequest, r.Header.Get("Origin"))
+	}
+	config.Origin = origin
+	return nil
+}
+
+func (s *Server) serveTerminal(ws *websocket.Conn, id string) {
+	defer ws.Close()
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	var ptmx *os.File
+	cmd := exec.CommandContext(ctx, s.self, "terminal", id)
+	cmd.Dir = s.repo.SourcePath()
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	// When the page goes away, closing the PTY hangs the terminal up, like closing a terminal window: it's
+	// only killed if it doesn't exit.
+	cmd.Cancel = func() error { return ptmx.Close() }
+	cmd.WaitDelay = terminalHangupDelay
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: 80, Rows: 24})
+	if err != nil {
+		_ = websocket.Message.Send(ws, fmt.Sprintf("failed to start the terminal: %v\r\n", err))
+		return
+	}
+	defer ptmx.Close()
+
+	go func() {
+		defer cancel()
+		for {
+			var msg terminalMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			if msg.Cols > 0 && msg.Rows > 0 {
+				if err := pty.Setsize(ptmx, &pty.Winsize{Cols: msg.Cols, Rows: msg.Rows}); err != nil {
+					slog.Warn("failed to resize terminal", "environment", id, "err", err)
+				}
+			}
+			if msg.Input != "" {
+				if _, err := ptmx.Write([]byte(msg.Input)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := ptmx.Read(buf)
+		if n > 0 {
+			if err := websocket.Message.Send(ws, buf[:n]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		_ = websocket.Message.Send(ws, fmt.Sprintf("\r\nterminal exited: %v\r\n", err))
+	}
+}